@@ -4,6 +4,7 @@
 package arch
 
 import (
+	"fmt"
 	"regexp"
 	"runtime"
 	"strings"
@@ -96,3 +97,61 @@ func IsSupportedArch(arch string) bool {
 	}
 	return false
 }
+
+// Arch holds a machine architecture recognised by Juju. It implements
+// encoding.TextMarshaler and encoding.TextUnmarshaler, along with the
+// YAML equivalents, so that it can be used directly in configuration
+// structs. When decoded, values are normalised with NormaliseArch and
+// rejected if the result is not a supported architecture.
+type Arch string
+
+// ParseArch normalises the given architecture name and returns it as
+// an Arch. It returns an error if the architecture is not supported.
+func ParseArch(s string) (Arch, error) {
+	a := NormaliseArch(s)
+	if !IsSupportedArch(a) {
+		return "", fmt.Errorf("invalid architecture %q", s)
+	}
+	return Arch(a), nil
+}
+
+// String implements fmt.Stringer.
+func (a Arch) String() string {
+	return string(a)
+}
+
+// Info returns information about the architecture. The second
+// result reports whether the architecture is recognised.
+func (a Arch) Info() (ArchInfo, bool) {
+	info, ok := Info[string(a)]
+	return info, ok
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (a Arch) MarshalText() ([]byte, error) {
+	return []byte(a), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (a *Arch) UnmarshalText(data []byte) error {
+	parsed, err := ParseArch(string(data))
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// MarshalYAML implements yaml.Marshaler.
+func (a Arch) MarshalYAML() (interface{}, error) {
+	return string(a), nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (a *Arch) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	return a.UnmarshalText([]byte(s))
+}
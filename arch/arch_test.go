@@ -4,8 +4,11 @@
 package arch_test
 
 import (
+	"encoding/json"
+
 	jc "github.com/juju/testing/checkers"
 	gc "gopkg.in/check.v1"
+	"gopkg.in/yaml.v2"
 
 	"github.com/juju/utils/v3/arch"
 )
@@ -63,3 +66,60 @@ func (s *archSuite) TestArchInfo(c *gc.C) {
 		c.Assert(ok, jc.IsTrue)
 	}
 }
+
+func (s *archSuite) TestParseArch(c *gc.C) {
+	a, err := arch.ParseArch(" x86_64 ")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(a, gc.Equals, arch.Arch(arch.AMD64))
+
+	_, err = arch.ParseArch("windows")
+	c.Assert(err, gc.ErrorMatches, `invalid architecture "windows"`)
+}
+
+type archConfig struct {
+	Arch  arch.Arch   `json:"arch" yaml:"arch"`
+	Other []arch.Arch `json:"other" yaml:"other"`
+}
+
+func (s *archSuite) TestJSON(c *gc.C) {
+	var cfg archConfig
+	err := json.Unmarshal([]byte(`{"arch": "aarch64", "other": ["ppc64le", "i686"]}`), &cfg)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cfg, jc.DeepEquals, archConfig{
+		Arch:  arch.ARM64,
+		Other: []arch.Arch{arch.PPC64EL, arch.I386},
+	})
+
+	data, err := json.Marshal(cfg)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(data), gc.Equals, `{"arch":"arm64","other":["ppc64el","i386"]}`)
+
+	err = json.Unmarshal([]byte(`{"arch": "vax"}`), &cfg)
+	c.Assert(err, gc.ErrorMatches, `invalid architecture "vax"`)
+}
+
+func (s *archSuite) TestYAML(c *gc.C) {
+	var cfg archConfig
+	err := yaml.Unmarshal([]byte("arch: x86_64\nother: [armv7]\n"), &cfg)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cfg, jc.DeepEquals, archConfig{
+		Arch:  arch.AMD64,
+		Other: []arch.Arch{arch.ARM},
+	})
+
+	data, err := yaml.Marshal(cfg)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(data), gc.Equals, "arch: amd64\nother:\n- armhf\n")
+
+	err = yaml.Unmarshal([]byte("arch: vax\n"), &cfg)
+	c.Assert(err, gc.ErrorMatches, `invalid architecture "vax"`)
+}
+
+func (s *archSuite) TestArchTypeInfo(c *gc.C) {
+	info, ok := arch.Arch(arch.I386).Info()
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(info.WordSize, gc.Equals, 32)
+
+	_, ok = arch.Arch("vax").Info()
+	c.Assert(ok, jc.IsFalse)
+}
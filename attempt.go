@@ -5,6 +5,8 @@ package utils
 
 import (
 	"time"
+
+	"github.com/juju/clock"
 )
 
 // The Attempt and AttemptStrategy types are copied from those in launchpad.net/goamz/aws.
@@ -15,10 +17,15 @@ type AttemptStrategy struct {
 	Total time.Duration // total duration of attempt.
 	Delay time.Duration // interval between each try in the burst.
 	Min   int           // minimum number of retries; overrides Total
+
+	// Clock is used to measure time and to wait between
+	// attempts. If it is nil, the wall clock is used.
+	Clock clock.Clock
 }
 
 type Attempt struct {
 	strategy AttemptStrategy
+	clock    clock.Clock
 	last     time.Time
 	end      time.Time
 	force    bool
@@ -27,9 +34,14 @@ type Attempt struct {
 
 // Start begins a new sequence of attempts for the given strategy.
 func (s AttemptStrategy) Start() *Attempt {
-	now := time.Now()
+	clk := s.Clock
+	if clk == nil {
+		clk = clock.WallClock
+	}
+	now := clk.Now()
 	return &Attempt{
 		strategy: s,
+		clock:    clk,
 		last:     now,
 		end:      now.Add(s.Total),
 		force:    true,
@@ -41,15 +53,15 @@ func (s AttemptStrategy) Start() *Attempt {
 // It always returns true the first time it is called - we are guaranteed to
 // make at least one attempt.
 func (a *Attempt) Next() bool {
-	now := time.Now()
+	now := a.clock.Now()
 	sleep := a.nextSleep(now)
 	if !a.force && !now.Add(sleep).Before(a.end) && a.strategy.Min <= a.count {
 		return false
 	}
 	a.force = false
 	if sleep > 0 && a.count > 0 {
-		time.Sleep(sleep)
-		now = time.Now()
+		<-a.clock.After(sleep)
+		now = a.clock.Now()
 	}
 	a.count++
 	a.last = now
@@ -71,7 +83,7 @@ func (a *Attempt) HasNext() bool {
 	if a.force || a.strategy.Min > a.count {
 		return true
 	}
-	now := time.Now()
+	now := a.clock.Now()
 	if now.Add(a.nextSleep(now)).Before(a.end) {
 		a.force = true
 		return true
@@ -6,6 +6,9 @@ package utils_test
 import (
 	"time"
 
+	"github.com/juju/clock/testclock"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
 	gc "gopkg.in/check.v1"
 
 	"github.com/juju/utils/v3"
@@ -64,6 +67,34 @@ func (*utilsSuite) TestAttemptTiming(c *gc.C) {
 	}
 }
 
+func (*utilsSuite) TestAttemptTimingWithClock(c *gc.C) {
+	t0 := time.Now()
+	clk := testclock.NewClock(t0)
+	testAttempt := utils.AttemptStrategy{
+		Total: 0.25e9,
+		Delay: 0.1e9,
+		Clock: clk,
+	}
+	done := make(chan []time.Duration)
+	go func() {
+		var got []time.Duration
+		for a := testAttempt.Start(); a.Next(); {
+			got = append(got, clk.Now().Sub(t0))
+		}
+		done <- got
+	}()
+	for i := 0; i < 2; i++ {
+		err := clk.WaitAdvance(0.1e9, testing.LongWait, 1)
+		c.Assert(err, jc.ErrorIsNil)
+	}
+	select {
+	case got := <-done:
+		c.Assert(got, jc.DeepEquals, []time.Duration{0, 0.1e9, 0.2e9})
+	case <-time.After(testing.LongWait):
+		c.Fatalf("timed out waiting for attempts")
+	}
+}
+
 func (*utilsSuite) TestAttemptNextHasNext(c *gc.C) {
 	a := utils.AttemptStrategy{}.Start()
 	c.Assert(a.Next(), gc.Equals, true)
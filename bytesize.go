@@ -0,0 +1,247 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package utils
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// ByteSize is a size in bytes.
+type ByteSize int64
+
+// SI (decimal) sizes.
+const (
+	Byte ByteSize = 1
+	KB            = 1000 * Byte
+	MB            = 1000 * KB
+	GB            = 1000 * MB
+	TB            = 1000 * GB
+	PB            = 1000 * TB
+	EB            = 1000 * PB
+)
+
+// IEC (binary) sizes.
+const (
+	KiB = 1024 * Byte
+	MiB = 1024 * KiB
+	GiB = 1024 * MiB
+	TiB = 1024 * GiB
+	PiB = 1024 * TiB
+	EiB = 1024 * PiB
+)
+
+// byteSizeUnit associates a unit suffix with its size.
+type byteSizeUnit struct {
+	suffix string
+	size   ByteSize
+}
+
+// siUnits and iecUnits hold the units used when formatting
+// sizes, largest first.
+var (
+	siUnits = []byteSizeUnit{
+		{"EB", EB}, {"PB", PB}, {"TB", TB}, {"GB", GB}, {"MB", MB}, {"kB", KB},
+	}
+	iecUnits = []byteSizeUnit{
+		{"EiB", EiB}, {"PiB", PiB}, {"TiB", TiB}, {"GiB", GiB}, {"MiB", MiB}, {"KiB", KiB},
+	}
+)
+
+// byteSizeSuffixes maps each lower-cased suffix accepted
+// by ParseByteSize to the size it represents.
+var byteSizeSuffixes = map[string]ByteSize{
+	"":  Byte,
+	"b": Byte,
+}
+
+func init() {
+	for _, u := range siUnits {
+		byteSizeSuffixes[strings.ToLower(u.suffix)] = u.size
+	}
+	for _, u := range iecUnits {
+		byteSizeSuffixes[strings.ToLower(u.suffix)] = u.size
+		// A bare prefix, as in "10M", is taken to be binary.
+		byteSizeSuffixes[strings.ToLower(u.suffix[:1])] = u.size
+	}
+}
+
+// ParseByteSize parses the string as a size in bytes.
+//
+// The string must hold a non-negative number, which may be
+// fractional, followed by an optional unit. SI units (kB, MB, GB, TB,
+// PB and EB) are powers of 1000; IEC units (KiB, MiB, GiB, TiB, PiB
+// and EiB) are powers of 1024. A bare multiplier, as in "10M", is
+// taken to be an IEC unit. Units are case-insensitive and may be
+// separated from the number by spaces. If no unit is given, the
+// number is in bytes. Fractional bytes are rounded up.
+func ParseByteSize(str string) (ByteSize, error) {
+	s := strings.TrimSpace(str)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return r != '.' && r != '-' && r != '+' && (r < '0' || r > '9')
+	})
+	num, suffix := s, ""
+	if i >= 0 {
+		num, suffix = s[:i], strings.TrimSpace(s[i:])
+	}
+	val, ok := new(big.Rat).SetString(num)
+	if !ok || num == "" {
+		return 0, errors.Errorf("invalid size %q", str)
+	}
+	unit, ok := byteSizeSuffixes[strings.ToLower(suffix)]
+	if !ok {
+		return 0, errors.Errorf("invalid size unit %q in %q", suffix, str)
+	}
+	if val.Sign() < 0 {
+		return 0, errors.Errorf("expected a non-negative size, got %q", str)
+	}
+	val.Mul(val, new(big.Rat).SetInt64(int64(unit)))
+	// Round up to a whole number of bytes.
+	n := new(big.Int).Quo(val.Num(), val.Denom())
+	if !val.IsInt() {
+		n.Add(n, big.NewInt(1))
+	}
+	if !n.IsInt64() {
+		return 0, errors.Errorf("size %q too large", str)
+	}
+	return ByteSize(n.Int64()), nil
+}
+
+// Bytes returns the size as a number of bytes.
+func (s ByteSize) Bytes() int64 {
+	return int64(s)
+}
+
+// Add returns s+t. It returns an error if the
+// result cannot be represented.
+func (s ByteSize) Add(t ByteSize) (ByteSize, error) {
+	r := s + t
+	if (t > 0 && r < s) || (t < 0 && r > s) {
+		return 0, errors.Errorf("size overflow adding %d to %d", t, s)
+	}
+	return r, nil
+}
+
+// Sub returns s-t. It returns an error if the
+// result cannot be represented.
+func (s ByteSize) Sub(t ByteSize) (ByteSize, error) {
+	r := s - t
+	if (t > 0 && r > s) || (t < 0 && r < s) {
+		return 0, errors.Errorf("size overflow subtracting %d from %d", t, s)
+	}
+	return r, nil
+}
+
+// Mul returns s*n. It returns an error if the
+// result cannot be represented.
+func (s ByteSize) Mul(n int64) (ByteSize, error) {
+	if s == 0 || n == 0 {
+		return 0, nil
+	}
+	r := s * ByteSize(n)
+	if r/ByteSize(n) != s || (s == -1 && n == math.MinInt64) || (n == -1 && s == math.MinInt64) {
+		return 0, errors.Errorf("size overflow multiplying %d by %d", s, n)
+	}
+	return r, nil
+}
+
+// String returns the size formatted with IEC units.
+func (s ByteSize) String() string {
+	return s.IEC()
+}
+
+// IEC returns the size formatted with the largest IEC unit that
+// leaves a value of at least one, to at most two decimal places;
+// for example "1.5GiB".
+func (s ByteSize) IEC() string {
+	return formatByteSize(s, iecUnits)
+}
+
+// SI returns the size formatted with the largest SI unit that
+// leaves a value of at least one, to at most two decimal places;
+// for example "1.5GB".
+func (s ByteSize) SI() string {
+	return formatByteSize(s, siUnits)
+}
+
+func formatByteSize(s ByteSize, units []byteSizeUnit) string {
+	sign, abs := "", float64(s)
+	if s < 0 {
+		sign, abs = "-", -abs
+	}
+	for _, u := range units {
+		if abs >= float64(u.size) {
+			val := strconv.FormatFloat(abs/float64(u.size), 'f', 2, 64)
+			val = strings.TrimRight(strings.TrimRight(val, "0"), ".")
+			return sign + val + u.suffix
+		}
+	}
+	return strconv.FormatInt(int64(s), 10) + "B"
+}
+
+// exact returns the size formatted without loss of precision,
+// using the largest IEC unit that divides it exactly.
+func (s ByteSize) exact() string {
+	for _, u := range iecUnits {
+		if s != 0 && s%u.size == 0 {
+			return strconv.FormatInt(int64(s/u.size), 10) + u.suffix
+		}
+	}
+	return strconv.FormatInt(int64(s), 10)
+}
+
+// MarshalText implements encoding.TextMarshaler. The size is
+// formatted exactly, in the largest IEC unit that divides it.
+func (s ByteSize) MarshalText() ([]byte, error) {
+	return []byte(s.exact()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+// by calling ParseByteSize.
+func (s *ByteSize) UnmarshalText(data []byte) error {
+	size, err := ParseByteSize(string(data))
+	if err != nil {
+		return err
+	}
+	*s = size
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It accepts either a
+// string, as understood by ParseByteSize, or a number of bytes.
+func (s *ByteSize) UnmarshalJSON(data []byte) error {
+	var str string
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &str); err != nil {
+			return err
+		}
+	} else {
+		var n json.Number
+		if err := json.Unmarshal(data, &n); err != nil {
+			return err
+		}
+		str = n.String()
+	}
+	return s.UnmarshalText([]byte(str))
+}
+
+// MarshalYAML implements yaml.Marshaler.
+func (s ByteSize) MarshalYAML() (interface{}, error) {
+	return s.exact(), nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler. It accepts either a
+// string, as understood by ParseByteSize, or a number of bytes.
+func (s *ByteSize) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var str string
+	if err := unmarshal(&str); err != nil {
+		return err
+	}
+	return s.UnmarshalText([]byte(str))
+}
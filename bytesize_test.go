@@ -0,0 +1,177 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package utils_test
+
+import (
+	"encoding/json"
+	"math"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/yaml.v2"
+
+	"github.com/juju/utils/v3"
+)
+
+var _ = gc.Suite(&byteSizeSuite{})
+
+type byteSizeSuite struct {
+	testing.IsolationSuite
+}
+
+var parseByteSizeTests = []struct {
+	in  string
+	out utils.ByteSize
+	err string
+}{{
+	in:  "0",
+	out: 0,
+}, {
+	in:  "123",
+	out: 123,
+}, {
+	in:  "123B",
+	out: 123,
+}, {
+	in:  "1kB",
+	out: 1000,
+}, {
+	in:  "1KB",
+	out: 1000,
+}, {
+	in:  "1KiB",
+	out: 1024,
+}, {
+	in:  "1K",
+	out: 1024,
+}, {
+	in:  "1.5 GB",
+	out: 1500000000,
+}, {
+	in:  "1.5GiB",
+	out: 3 * 512 * 1024 * 1024,
+}, {
+	in:  "0.5mib",
+	out: 512 * 1024,
+}, {
+	in:  "  2 TB  ",
+	out: 2e12,
+}, {
+	in:  "1.0001kB",
+	out: 1001,
+}, {
+	in:  "7EiB",
+	out: 7 * utils.EiB,
+}, {
+	in:  "8EiB",
+	err: `size "8EiB" too large`,
+}, {
+	in:  "",
+	err: `invalid size ""`,
+}, {
+	in:  "GB",
+	err: `invalid size "GB"`,
+}, {
+	in:  "1..2",
+	err: `invalid size "1..2"`,
+}, {
+	in:  "-1",
+	err: `expected a non-negative size, got "-1"`,
+}, {
+	in:  "1XB",
+	err: `invalid size unit "XB" in "1XB"`,
+}}
+
+func (*byteSizeSuite) TestParseByteSize(c *gc.C) {
+	for i, test := range parseByteSizeTests {
+		c.Logf("test %d: %q", i, test.in)
+		size, err := utils.ParseByteSize(test.in)
+		if test.err != "" {
+			c.Check(err, gc.ErrorMatches, test.err)
+			continue
+		}
+		c.Check(err, jc.ErrorIsNil)
+		c.Check(size, gc.Equals, test.out)
+	}
+}
+
+func (*byteSizeSuite) TestFormat(c *gc.C) {
+	tests := []struct {
+		size    utils.ByteSize
+		iec, si string
+	}{
+		{0, "0B", "0B"},
+		{999, "999B", "999B"},
+		{1000, "1000B", "1kB"},
+		{1024, "1KiB", "1.02kB"},
+		{3 * 512 * utils.MiB, "1.5GiB", "1.61GB"},
+		{-2 * utils.GB, "-1.86GiB", "-2GB"},
+		{utils.ByteSize(math.MaxInt64), "8EiB", "9.22EB"},
+	}
+	for i, test := range tests {
+		c.Logf("test %d: %d", i, test.size)
+		c.Check(test.size.IEC(), gc.Equals, test.iec)
+		c.Check(test.size.String(), gc.Equals, test.iec)
+		c.Check(test.size.SI(), gc.Equals, test.si)
+	}
+}
+
+func (*byteSizeSuite) TestArithmetic(c *gc.C) {
+	s, err := utils.GiB.Add(utils.MiB)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(s, gc.Equals, 1025*utils.MiB)
+	s, err = s.Sub(utils.GiB)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(s, gc.Equals, utils.MiB)
+	s, err = s.Mul(3)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(s, gc.Equals, 3*utils.MiB)
+	c.Check(s.Bytes(), gc.Equals, int64(3*1024*1024))
+
+	_, err = utils.ByteSize(math.MaxInt64).Add(1)
+	c.Check(err, gc.ErrorMatches, "size overflow adding 1 to 9223372036854775807")
+	_, err = utils.ByteSize(math.MinInt64).Sub(1)
+	c.Check(err, gc.ErrorMatches, "size overflow subtracting 1 from -9223372036854775808")
+	_, err = utils.EiB.Mul(8)
+	c.Check(err, gc.ErrorMatches, "size overflow multiplying 1152921504606846976 by 8")
+	_, err = utils.ByteSize(math.MinInt64).Mul(-1)
+	c.Check(err, gc.NotNil)
+}
+
+type byteSizeDoc struct {
+	Size utils.ByteSize `json:"size" yaml:"size"`
+}
+
+func (*byteSizeSuite) TestJSON(c *gc.C) {
+	data, err := json.Marshal(byteSizeDoc{Size: 3 * utils.GiB})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(data), gc.Equals, `{"size":"3GiB"}`)
+	data, err = json.Marshal(byteSizeDoc{Size: 1500})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(data), gc.Equals, `{"size":"1500"}`)
+
+	for _, in := range []string{`{"size":"3GiB"}`, `{"size":3221225472}`, `{"size":"3 gib"}`} {
+		var doc byteSizeDoc
+		err := json.Unmarshal([]byte(in), &doc)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(doc.Size, gc.Equals, 3*utils.GiB)
+	}
+	var doc byteSizeDoc
+	err = json.Unmarshal([]byte(`{"size":"lots"}`), &doc)
+	c.Check(err, gc.ErrorMatches, `invalid size "lots"`)
+}
+
+func (*byteSizeSuite) TestYAML(c *gc.C) {
+	data, err := yaml.Marshal(byteSizeDoc{Size: 512 * utils.KiB})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(data), gc.Equals, "size: 512KiB\n")
+
+	for _, in := range []string{"size: 512KiB\n", "size: 524288\n", "size: 0.5M\n"} {
+		var doc byteSizeDoc
+		err := yaml.Unmarshal([]byte(in), &doc)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(doc.Size, gc.Equals, 512*utils.KiB)
+	}
+}
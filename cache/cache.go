@@ -7,11 +7,16 @@
 package cache
 
 import (
+	"fmt"
 	"math/rand"
 	"sync"
 	"time"
 
+	"github.com/juju/clock"
 	"gopkg.in/errgo.v1"
+
+	"github.com/juju/utils/v3/panics"
+	"github.com/juju/utils/v3/parallel"
 )
 
 // entry holds a cache entry. The expire field
@@ -28,6 +33,7 @@ type Key interface{}
 // Cache holds a time-limited set of values for arbitrary keys.
 type Cache struct {
 	maxAge time.Duration
+	clock  clock.Clock
 
 	// mu guards the fields below it.
 	mu sync.Mutex
@@ -57,11 +63,22 @@ type fetchCall struct {
 // at most maxAge. If maxAge is zero, items will
 // never be cached.
 func New(maxAge time.Duration) *Cache {
+	return NewWithClock(maxAge, clock.WallClock)
+}
+
+// NewWithClock is like New but uses the given clock to
+// determine the age of cache entries. If clk is nil,
+// the wall clock is used.
+func NewWithClock(maxAge time.Duration, clk clock.Clock) *Cache {
+	if clk == nil {
+		clk = clock.WallClock
+	}
 	// The returned cache will have a zero-valued expire
 	// time, so will expire immediately, causing the new
 	// map to be created.
 	return &Cache{
 		maxAge:   maxAge,
+		clock:    clk,
 		inFlight: make(map[Key]*fetchCall),
 	}
 }
@@ -92,9 +109,9 @@ func (c *Cache) EvictAll() {
 // Get returns the value for the given key, using fetch to fetch
 // the value if it is not found in the cache.
 // If fetch returns an error, the returned error from Get will have
-// the same cause.
+// the same cause. If fetch panics, the cause is a *panics.Error.
 func (c *Cache) Get(key Key, fetch func() (interface{}, error)) (interface{}, error) {
-	return c.getAtTime(key, fetch, time.Now())
+	return c.getAtTime(key, fetch, c.clock.Now())
 }
 
 // getAtTime is the internal version of Get, useful for testing; now represents the current
@@ -127,7 +144,7 @@ func (c *Cache) getAtTime(key Key, fetch func() (interface{}, error), now time.T
 	// so that one slow fetch doesn't hold up
 	// all the other cache accesses.
 	c.mu.Unlock()
-	val, err := fetch()
+	val, err := panics.CallValue(fetch)
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -196,3 +213,85 @@ func (c *Cache) entry(m map[Key]entry, key Key, now time.Time) (entry, bool) {
 	}
 	return e, true
 }
+
+// Entry holds a key to be loaded into the cache by WarmUp,
+// along with the function used to fetch its value.
+type Entry struct {
+	Key   Key
+	Fetch func() (interface{}, error)
+}
+
+// WarmUpError is returned by WarmUp and WarmUpFrom when
+// one or more entries could not be fetched.
+type WarmUpError struct {
+	// Errors holds the error returned when fetching
+	// each failed entry, indexed by key.
+	Errors map[Key]error
+}
+
+// Error implements the error interface.
+func (e *WarmUpError) Error() string {
+	switch len(e.Errors) {
+	case 0:
+		return "no error"
+	case 1:
+		for key, err := range e.Errors {
+			return fmt.Sprintf("cannot warm up cache entry %v: %v", key, err)
+		}
+	}
+	return fmt.Sprintf("cannot warm up %d cache entries", len(e.Errors))
+}
+
+// WarmUp pre-populates the cache by fetching all the given entries
+// concurrently, running at most maxParallel fetches at once. It returns
+// when all fetches have completed. Values are cached exactly as if
+// they had been retrieved with Get.
+//
+// If any fetch fails, WarmUp returns a *WarmUpError holding the error
+// for each failed entry; the successfully fetched entries are still
+// cached.
+func (c *Cache) WarmUp(entries []Entry, maxParallel int) error {
+	if maxParallel < 1 {
+		return errgo.Newf("invalid parallelism %d", maxParallel)
+	}
+	var (
+		mu   sync.Mutex
+		errs map[Key]error
+	)
+	run := parallel.NewRun(maxParallel)
+	for _, e := range entries {
+		e := e
+		run.Do(func() error {
+			if _, err := c.Get(e.Key, e.Fetch); err != nil {
+				mu.Lock()
+				defer mu.Unlock()
+				if errs == nil {
+					errs = make(map[Key]error)
+				}
+				errs[e.Key] = err
+			}
+			return nil
+		})
+	}
+	run.Wait()
+	if len(errs) > 0 {
+		return &WarmUpError{Errors: errs}
+	}
+	return nil
+}
+
+// WarmUpFrom is like WarmUp except that the value for each of the given
+// keys is fetched by calling load with the key.
+func (c *Cache) WarmUpFrom(keys []Key, load func(Key) (interface{}, error), maxParallel int) error {
+	entries := make([]Entry, len(keys))
+	for i, key := range keys {
+		key := key
+		entries[i] = Entry{
+			Key: key,
+			Fetch: func() (interface{}, error) {
+				return load(key)
+			},
+		}
+	}
+	return c.WarmUp(entries, maxParallel)
+}
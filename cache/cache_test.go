@@ -8,10 +8,12 @@ import (
 	"sync"
 	"time"
 
+	"github.com/juju/clock/testclock"
 	gc "gopkg.in/check.v1"
 	"gopkg.in/errgo.v1"
 
 	"github.com/juju/utils/v3/cache"
+	"github.com/juju/utils/v3/panics"
 )
 
 type suite struct{}
@@ -25,6 +27,21 @@ func (*suite) TestSimpleGet(c *gc.C) {
 	c.Assert(v, gc.Equals, 2)
 }
 
+func (*suite) TestGetPanic(c *gc.C) {
+	p := cache.New(time.Hour)
+	v, err := p.Get("a", func() (interface{}, error) {
+		panic("oops")
+	})
+	c.Assert(err, gc.ErrorMatches, "panic: oops")
+	c.Assert(panics.IsPanic(err), gc.Equals, true)
+	c.Assert(v, gc.IsNil)
+
+	// Nothing is cached, so the next Get fetches again.
+	v, err = p.Get("a", fetchValue(2))
+	c.Assert(err, gc.IsNil)
+	c.Assert(v, gc.Equals, 2)
+}
+
 func (*suite) TestEvict(c *gc.C) {
 	p := cache.New(time.Hour)
 	v, err := p.Get("a", fetchValue(2))
@@ -114,6 +131,24 @@ func (*suite) TestEntryExpiresAfterMaxEntryAge(c *gc.C) {
 	c.Assert(v, gc.Equals, 3)
 }
 
+func (*suite) TestEntryExpiresWithClock(c *gc.C) {
+	clk := testclock.NewClock(time.Now())
+	p := cache.NewWithClock(time.Minute, clk)
+	v, err := p.Get("a", fetchValue(2))
+	c.Assert(err, gc.IsNil)
+	c.Assert(v, gc.Equals, 2)
+
+	clk.Advance(time.Minute/2 - 1)
+	v, err = p.Get("a", fetchError(errUnexpectedFetch))
+	c.Assert(err, gc.IsNil)
+	c.Assert(v, gc.Equals, 2)
+
+	clk.Advance(time.Minute/2 + 2)
+	v, err = p.Get("a", fetchValue(3))
+	c.Assert(err, gc.IsNil)
+	c.Assert(v, gc.Equals, 3)
+}
+
 func (*suite) TestEntriesRemovedWhenNotRetrieved(c *gc.C) {
 	now := time.Now()
 	p := cache.New(time.Minute)
@@ -289,6 +324,70 @@ func (*suite) TestSingleFlight(c *gc.C) {
 
 var errUnexpectedFetch = errgo.New("fetch called unexpectedly")
 
+func (*suite) TestWarmUp(c *gc.C) {
+	p := cache.New(time.Hour)
+	err := p.WarmUp([]cache.Entry{
+		{Key: "a", Fetch: fetchValue(1)},
+		{Key: "b", Fetch: fetchValue(2)},
+		{Key: "c", Fetch: fetchValue(3)},
+	}, 2)
+	c.Assert(err, gc.IsNil)
+	c.Assert(p.Len(), gc.Equals, 3)
+
+	v, err := p.Get("b", fetchValue(99))
+	c.Assert(err, gc.IsNil)
+	c.Assert(v, gc.Equals, 2)
+}
+
+func (*suite) TestWarmUpErrors(c *gc.C) {
+	p := cache.New(time.Hour)
+	errFail := errgo.New("fail")
+	err := p.WarmUp([]cache.Entry{
+		{Key: "a", Fetch: fetchValue(1)},
+		{Key: "b", Fetch: fetchError(errFail)},
+	}, 4)
+	c.Assert(err, gc.ErrorMatches, `cannot warm up cache entry b: fail`)
+	wErr, ok := err.(*cache.WarmUpError)
+	c.Assert(ok, gc.Equals, true)
+	c.Assert(wErr.Errors, gc.HasLen, 1)
+	c.Assert(errgo.Cause(wErr.Errors["b"]), gc.Equals, errFail)
+	c.Assert(p.Len(), gc.Equals, 1)
+}
+
+func (*suite) TestWarmUpBoundedParallelism(c *gc.C) {
+	p := cache.New(time.Hour)
+	var (
+		mu            sync.Mutex
+		running, peak int
+		keys          []cache.Key
+	)
+	for i := 0; i < 20; i++ {
+		keys = append(keys, i)
+	}
+	err := p.WarmUpFrom(keys, func(key cache.Key) (interface{}, error) {
+		mu.Lock()
+		running++
+		if running > peak {
+			peak = running
+		}
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return key, nil
+	}, 3)
+	c.Assert(err, gc.IsNil)
+	c.Assert(p.Len(), gc.Equals, 20)
+	c.Assert(peak <= 3, gc.Equals, true, gc.Commentf("peak %d", peak))
+}
+
+func (*suite) TestWarmUpInvalidParallelism(c *gc.C) {
+	p := cache.New(time.Hour)
+	err := p.WarmUp(nil, 0)
+	c.Assert(err, gc.ErrorMatches, `invalid parallelism 0`)
+}
+
 func fetchError(err error) func() (interface{}, error) {
 	return func() (interface{}, error) {
 		return nil, err
@@ -0,0 +1,529 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package cert
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// KeyType identifies the kind of private key to generate.
+type KeyType string
+
+const (
+	// RSA keys are RSA keys of the size given by KeyBits,
+	// 2048 bits by default.
+	RSA KeyType = "rsa"
+
+	// ECDSA keys are ECDSA keys on the NIST curve with the size given
+	// by KeyBits (224, 256, 384 or 521), P-256 by default.
+	ECDSA KeyType = "ecdsa"
+
+	// Ed25519 keys are Ed25519 keys. KeyBits is ignored.
+	Ed25519 KeyType = "ed25519"
+)
+
+// notBeforeSkew holds how long before their creation certificates
+// become valid, to allow for clocks that are behind.
+const notBeforeSkew = 7 * 24 * time.Hour
+
+// NewPrivateKey generates a new private key of the given type. If bits
+// is zero, the default size for the key type is used.
+func NewPrivateKey(keyType KeyType, bits int) (crypto.Signer, error) {
+	switch keyType {
+	case RSA, "":
+		if bits == 0 {
+			bits = 2048
+		}
+		key, err := rsa.GenerateKey(rand.Reader, bits)
+		if err != nil {
+			return nil, errors.Annotate(err, "cannot generate RSA key")
+		}
+		return key, nil
+	case ECDSA:
+		var curve elliptic.Curve
+		switch bits {
+		case 224:
+			curve = elliptic.P224()
+		case 256, 0:
+			curve = elliptic.P256()
+		case 384:
+			curve = elliptic.P384()
+		case 521:
+			curve = elliptic.P521()
+		default:
+			return nil, errors.NotValidf("ECDSA key size %d", bits)
+		}
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			return nil, errors.Annotate(err, "cannot generate ECDSA key")
+		}
+		return key, nil
+	case Ed25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, errors.Annotate(err, "cannot generate Ed25519 key")
+		}
+		return key, nil
+	}
+	return nil, errors.NotValidf("key type %q", keyType)
+}
+
+// CAParams holds the parameters for a new certificate authority.
+type CAParams struct {
+	// CommonName holds the common name of the CA.
+	CommonName string
+
+	// Organization holds the organization of the CA.
+	Organization []string
+
+	// KeyType and KeyBits specify the CA's key. See NewPrivateKey.
+	KeyType KeyType
+	KeyBits int
+
+	// Expiry holds the time at which the CA certificate expires.
+	Expiry time.Time
+
+	// MaxPathLen holds the maximum number of intermediate CAs that
+	// may follow this one in a chain. If it is zero, there is no
+	// limit; use -1 to forbid intermediate CAs.
+	MaxPathLen int
+}
+
+// CA is a certificate authority, which issues certificates signed with
+// its key.
+type CA struct {
+	// Cert holds the certificate of the CA.
+	Cert *x509.Certificate
+
+	// Key holds the private key of the CA.
+	Key crypto.Signer
+
+	// Chain holds the certificates of the CAs above this one, if it
+	// is an intermediate CA, starting with the one that issued it and
+	// ending with the root.
+	Chain []*x509.Certificate
+}
+
+// NewRootCA creates a new self-signed root certificate authority.
+func NewRootCA(p CAParams) (*CA, error) {
+	key, err := NewPrivateKey(p.KeyType, p.KeyBits)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	template, err := caTemplate(p, key)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	cert, err := createCertificate(template, template, key.Public(), key)
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot create root CA certificate")
+	}
+	return &CA{Cert: cert, Key: key}, nil
+}
+
+// NewIntermediate creates a new intermediate certificate authority
+// whose certificate is issued by ca.
+func (ca *CA) NewIntermediate(p CAParams) (*CA, error) {
+	key, err := NewPrivateKey(p.KeyType, p.KeyBits)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	template, err := caTemplate(p, key)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	cert, err := createCertificate(template, ca.Cert, key.Public(), ca.Key)
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot create intermediate CA certificate")
+	}
+	return &CA{
+		Cert:  cert,
+		Key:   key,
+		Chain: append([]*x509.Certificate{ca.Cert}, ca.Chain...),
+	}, nil
+}
+
+func caTemplate(p CAParams, key crypto.Signer) (*x509.Certificate, error) {
+	template, err := baseTemplate(p.CommonName, p.Organization, p.Expiry, key)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	template.BasicConstraintsValid = true
+	template.IsCA = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+	switch {
+	case p.MaxPathLen < 0:
+		template.MaxPathLenZero = true
+	case p.MaxPathLen > 0:
+		template.MaxPathLen = p.MaxPathLen
+	}
+	return template, nil
+}
+
+// LeafParams holds the parameters for a certificate issued by a CA.
+type LeafParams struct {
+	// CommonName holds the common name of the certificate.
+	CommonName string
+
+	// Organization holds the organization of the certificate.
+	Organization []string
+
+	// DNSNames, IPAddresses and URIs hold the subject
+	// alternative names of the certificate.
+	DNSNames    []string
+	IPAddresses []net.IP
+	URIs        []*url.URL
+
+	// Server and Client specify whether the certificate
+	// may be used for TLS server and client authentication.
+	Server bool
+	Client bool
+
+	// KeyType and KeyBits specify the certificate's key.
+	// See NewPrivateKey.
+	KeyType KeyType
+	KeyBits int
+
+	// Expiry holds the time at which the certificate expires. It is
+	// brought forward to the expiry of the CA if that is earlier.
+	Expiry time.Time
+}
+
+// Issued holds a certificate issued by a CA, with its private key.
+type Issued struct {
+	// Cert holds the issued certificate.
+	Cert *x509.Certificate
+
+	// Key holds the private key for the certificate.
+	Key crypto.Signer
+
+	// Chain holds the certificates of the issuing CA and any CAs
+	// above it, ending with the root.
+	Chain []*x509.Certificate
+}
+
+// Issue creates a new key and issues a certificate for it.
+func (ca *CA) Issue(p LeafParams) (*Issued, error) {
+	if !p.Server && !p.Client {
+		return nil, errors.NotValidf("certificate for neither server nor client use")
+	}
+	key, err := NewPrivateKey(p.KeyType, p.KeyBits)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	expiry := p.Expiry
+	if expiry.After(ca.Cert.NotAfter) {
+		expiry = ca.Cert.NotAfter
+	}
+	template, err := baseTemplate(p.CommonName, p.Organization, expiry, key)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	if _, ok := key.(*rsa.PrivateKey); ok {
+		template.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
+	if p.Server {
+		template.ExtKeyUsage = append(template.ExtKeyUsage, x509.ExtKeyUsageServerAuth)
+	}
+	if p.Client {
+		template.ExtKeyUsage = append(template.ExtKeyUsage, x509.ExtKeyUsageClientAuth)
+	}
+	template.DNSNames = p.DNSNames
+	template.IPAddresses = p.IPAddresses
+	template.URIs = p.URIs
+	cert, err := createCertificate(template, ca.Cert, key.Public(), ca.Key)
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot create certificate")
+	}
+	return &Issued{
+		Cert:  cert,
+		Key:   key,
+		Chain: ca.chain(),
+	}, nil
+}
+
+// Renew issues a new certificate with the same subject, names, usage
+// and public key as cert, expiring at the given time. The renewed
+// certificate has a new serial number, so the old one may be revoked.
+func (ca *CA) Renew(cert *x509.Certificate, expiry time.Time) (*x509.Certificate, error) {
+	if expiry.After(ca.Cert.NotAfter) {
+		expiry = ca.Cert.NotAfter
+	}
+	serial, err := newSerialNumber()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               cert.Subject,
+		NotBefore:             now.Add(-notBeforeSkew).UTC(),
+		NotAfter:              expiry.UTC(),
+		SubjectKeyId:          cert.SubjectKeyId,
+		KeyUsage:              cert.KeyUsage,
+		ExtKeyUsage:           cert.ExtKeyUsage,
+		BasicConstraintsValid: cert.BasicConstraintsValid,
+		IsCA:                  cert.IsCA,
+		MaxPathLen:            cert.MaxPathLen,
+		MaxPathLenZero:        cert.MaxPathLenZero,
+		DNSNames:              cert.DNSNames,
+		IPAddresses:           cert.IPAddresses,
+		URIs:                  cert.URIs,
+		EmailAddresses:        cert.EmailAddresses,
+	}
+	renewed, err := createCertificate(template, ca.Cert, cert.PublicKey, ca.Key)
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot renew certificate")
+	}
+	return renewed, nil
+}
+
+// Revoked describes a revoked certificate
+// for inclusion in a CRL.
+type Revoked struct {
+	// SerialNumber holds the serial number of the certificate.
+	SerialNumber *big.Int
+
+	// RevokedAt holds the time at which it was revoked.
+	RevokedAt time.Time
+}
+
+// CreateCRL returns a PEM-encoded certificate revocation list, signed
+// by the CA, listing the given certificates. The number must increase
+// with each CRL issued by the CA. The CRL is valid until nextUpdate.
+func (ca *CA) CreateCRL(revoked []Revoked, number int64, nextUpdate time.Time) ([]byte, error) {
+	if ca.Cert.KeyUsage&x509.KeyUsageCRLSign == 0 {
+		return nil, errors.Errorf("CA certificate cannot sign CRLs")
+	}
+	entries := make([]pkix.RevokedCertificate, len(revoked))
+	for i, r := range revoked {
+		entries[i] = pkix.RevokedCertificate{
+			SerialNumber:   r.SerialNumber,
+			RevocationTime: r.RevokedAt.UTC(),
+		}
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		RevokedCertificates: entries,
+		Number:              big.NewInt(number),
+		ThisUpdate:          time.Now().UTC(),
+		NextUpdate:          nextUpdate.UTC(),
+	}, ca.Cert, ca.Key)
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot create CRL")
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), nil
+}
+
+// chain returns the certificates of ca and the CAs above it.
+func (ca *CA) chain() []*x509.Certificate {
+	return append([]*x509.Certificate{ca.Cert}, ca.Chain...)
+}
+
+// CertPEM returns the PEM-encoded certificate of the CA.
+func (ca *CA) CertPEM() string {
+	return EncodeCertPEM(ca.Cert)
+}
+
+// KeyPEM returns the PEM-encoded private key of the CA.
+func (ca *CA) KeyPEM() (string, error) {
+	return EncodePrivateKeyPEM(ca.Key)
+}
+
+// ChainPEM returns the PEM-encoded certificates of the CA and the
+// CAs above it, as served by a TLS server using an intermediate CA.
+func (ca *CA) ChainPEM() string {
+	return EncodeCertPEM(ca.chain()...)
+}
+
+// LoadCA returns the CA with the given PEM-encoded certificate and
+// private key. If the CA is an intermediate, certPEM may hold the
+// certificates of the CAs above it following its own.
+func LoadCA(certPEM, keyPEM string) (*CA, error) {
+	certs, err := ParseCerts(certPEM)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if !certs[0].BasicConstraintsValid || !certs[0].IsCA {
+		return nil, errors.Errorf("CA certificate is not a valid CA")
+	}
+	key, err := ParsePrivateKeyPEM(keyPEM)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if _, err := tls.X509KeyPair([]byte(EncodeCertPEM(certs[0])), []byte(keyPEM)); err != nil {
+		return nil, errors.Annotate(err, "CA certificate and key do not match")
+	}
+	return &CA{Cert: certs[0], Key: key, Chain: certs[1:]}, nil
+}
+
+// CertPEM returns the PEM-encoded issued certificate.
+func (i *Issued) CertPEM() string {
+	return EncodeCertPEM(i.Cert)
+}
+
+// KeyPEM returns the PEM-encoded private key.
+func (i *Issued) KeyPEM() (string, error) {
+	return EncodePrivateKeyPEM(i.Key)
+}
+
+// FullChainPEM returns the PEM-encoded certificate followed by those
+// of the CAs that issued it, excluding the root, as a TLS server
+// should present it.
+func (i *Issued) FullChainPEM() string {
+	certs := []*x509.Certificate{i.Cert}
+	if len(i.Chain) > 1 {
+		certs = append(certs, i.Chain[:len(i.Chain)-1]...)
+	}
+	return EncodeCertPEM(certs...)
+}
+
+// TLSCertificate returns the issued certificate
+// and its chain as a tls.Certificate.
+func (i *Issued) TLSCertificate() tls.Certificate {
+	tlsCert := tls.Certificate{
+		Certificate: [][]byte{i.Cert.Raw},
+		PrivateKey:  i.Key,
+		Leaf:        i.Cert,
+	}
+	if len(i.Chain) > 1 {
+		for _, c := range i.Chain[:len(i.Chain)-1] {
+			tlsCert.Certificate = append(tlsCert.Certificate, c.Raw)
+		}
+	}
+	return tlsCert
+}
+
+// EncodeCertPEM returns the given certificates in PEM format.
+func EncodeCertPEM(certs ...*x509.Certificate) string {
+	var data []byte
+	for _, c := range certs {
+		data = append(data, pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: c.Raw,
+		})...)
+	}
+	return string(data)
+}
+
+// EncodePrivateKeyPEM returns the given private key
+// in PEM-encoded PKCS #8 format.
+func EncodePrivateKeyPEM(key crypto.Signer) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", errors.Annotate(err, "cannot marshal private key")
+	}
+	return string(pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: der,
+	})), nil
+}
+
+// ParsePrivateKeyPEM parses a PEM-encoded private key in PKCS #8,
+// PKCS #1 (RSA) or SEC 1 (EC) format.
+func ParsePrivateKeyPEM(keyPEM string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(keyPEM))
+	if block == nil {
+		return nil, errors.New("no private key found")
+	}
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot parse private key")
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.Errorf("private key with unexpected type %T", key)
+	}
+	return signer, nil
+}
+
+// ParseCerts parses all the PEM-formatted X509 certificates in certPEM.
+func ParseCerts(certPEM string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	data := []byte(certPEM)
+	for len(data) > 0 {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no certificates found")
+	}
+	return certs, nil
+}
+
+func baseTemplate(commonName string, organization []string, expiry time.Time, key crypto.Signer) (*x509.Certificate, error) {
+	serial, err := newSerialNumber()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	keyID, err := subjectKeyID(key.Public())
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   commonName,
+			Organization: organization,
+		},
+		NotBefore:    now.Add(-notBeforeSkew).UTC(),
+		NotAfter:     expiry.UTC(),
+		SubjectKeyId: keyID,
+	}, nil
+}
+
+// subjectKeyID returns the SHA-1 hash of the marshaled public key.
+func subjectKeyID(pub crypto.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot marshal public key")
+	}
+	h := sha1.Sum(der)
+	return h[:], nil
+}
+
+func createCertificate(template, parent *x509.Certificate, pub crypto.PublicKey, signer crypto.Signer) (*x509.Certificate, error) {
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, signer)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
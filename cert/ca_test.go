@@ -0,0 +1,251 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package cert_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/url"
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/cert"
+)
+
+type caSuite struct{}
+
+var _ = gc.Suite(caSuite{})
+
+func newTestRootCA(c *gc.C) *cert.CA {
+	ca, err := cert.NewRootCA(cert.CAParams{
+		CommonName:   "test root",
+		Organization: []string{"juju"},
+		KeyType:      cert.ECDSA,
+		Expiry:       time.Now().AddDate(10, 0, 0),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	return ca
+}
+
+func (caSuite) TestNewRootCA(c *gc.C) {
+	now := time.Now()
+	expiry := now.AddDate(10, 0, 0)
+	ca, err := cert.NewRootCA(cert.CAParams{
+		CommonName:   "test root",
+		Organization: []string{"juju"},
+		KeyType:      cert.RSA,
+		KeyBits:      1024,
+		Expiry:       expiry,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(ca.Cert.Subject.CommonName, gc.Equals, "test root")
+	c.Check(ca.Cert.Subject.Organization, jc.DeepEquals, []string{"juju"})
+	c.Check(ca.Cert.IsCA, jc.IsTrue)
+	c.Check(ca.Cert.BasicConstraintsValid, jc.IsTrue)
+	c.Check(ca.Cert.KeyUsage&x509.KeyUsageCertSign, gc.Not(gc.Equals), x509.KeyUsage(0))
+	c.Check(ca.Cert.KeyUsage&x509.KeyUsageCRLSign, gc.Not(gc.Equals), x509.KeyUsage(0))
+	c.Check(ca.Cert.CheckSignatureFrom(ca.Cert), jc.ErrorIsNil)
+	c.Check(ca.Chain, gc.HasLen, 0)
+	checkNotBefore(c, ca.Cert, now)
+	checkNotAfter(c, ca.Cert, expiry)
+	c.Check(ca.Key.(*rsa.PrivateKey).N.BitLen(), gc.Equals, 1024)
+}
+
+func (caSuite) TestKeyTypes(c *gc.C) {
+	for _, test := range []struct {
+		keyType cert.KeyType
+		bits    int
+		check   func(key interface{})
+	}{{
+		keyType: cert.RSA,
+		bits:    1024,
+		check: func(key interface{}) {
+			c.Check(key.(*rsa.PrivateKey).N.BitLen(), gc.Equals, 1024)
+		},
+	}, {
+		keyType: cert.ECDSA,
+		bits:    384,
+		check: func(key interface{}) {
+			c.Check(key.(*ecdsa.PrivateKey).Curve.Params().BitSize, gc.Equals, 384)
+		},
+	}, {
+		keyType: cert.ECDSA,
+		check: func(key interface{}) {
+			c.Check(key.(*ecdsa.PrivateKey).Curve.Params().BitSize, gc.Equals, 256)
+		},
+	}, {
+		keyType: cert.Ed25519,
+		check: func(key interface{}) {
+			_, ok := key.(ed25519.PrivateKey)
+			c.Check(ok, jc.IsTrue)
+		},
+	}} {
+		c.Logf("key type %s, bits %d", test.keyType, test.bits)
+		key, err := cert.NewPrivateKey(test.keyType, test.bits)
+		c.Assert(err, jc.ErrorIsNil)
+		test.check(key)
+
+		keyPEM, err := cert.EncodePrivateKeyPEM(key)
+		c.Assert(err, jc.ErrorIsNil)
+		parsed, err := cert.ParsePrivateKeyPEM(keyPEM)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(parsed, jc.DeepEquals, key)
+	}
+
+	_, err := cert.NewPrivateKey(cert.ECDSA, 123)
+	c.Check(err, gc.ErrorMatches, "ECDSA key size 123 not valid")
+	_, err = cert.NewPrivateKey("dsa", 0)
+	c.Check(err, gc.ErrorMatches, `key type "dsa" not valid`)
+}
+
+func (caSuite) TestIssueServerCert(c *gc.C) {
+	root := newTestRootCA(c)
+	inter, err := root.NewIntermediate(cert.CAParams{
+		CommonName: "test intermediate",
+		KeyType:    cert.Ed25519,
+		Expiry:     time.Now().AddDate(5, 0, 0),
+		MaxPathLen: -1,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(inter.Chain, jc.DeepEquals, []*x509.Certificate{root.Cert})
+	c.Check(inter.Cert.MaxPathLenZero, jc.IsTrue)
+
+	spiffe, err := url.Parse("spiffe://juju/controller")
+	c.Assert(err, jc.ErrorIsNil)
+	issued, err := inter.Issue(cert.LeafParams{
+		CommonName:  "server",
+		DNSNames:    []string{"juju.example.com"},
+		IPAddresses: []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("::1")},
+		URIs:        []*url.URL{spiffe},
+		Server:      true,
+		KeyType:     cert.ECDSA,
+		// Later than the expiry of the intermediate.
+		Expiry: time.Now().AddDate(20, 0, 0),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(issued.Cert.NotAfter, gc.Equals, inter.Cert.NotAfter)
+	c.Check(issued.Cert.ExtKeyUsage, jc.DeepEquals, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth})
+	c.Check(issued.Cert.KeyUsage, gc.Equals, x509.KeyUsageDigitalSignature)
+	c.Check(issued.Cert.URIs, jc.DeepEquals, []*url.URL{spiffe})
+	c.Check(issued.Chain, jc.DeepEquals, []*x509.Certificate{inter.Cert, root.Cert})
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root.Cert)
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(inter.Cert)
+	for _, name := range []string{"juju.example.com", "10.0.0.1", "::1"} {
+		_, err = issued.Cert.Verify(x509.VerifyOptions{
+			DNSName:       name,
+			Roots:         roots,
+			Intermediates: intermediates,
+		})
+		c.Check(err, jc.ErrorIsNil, gc.Commentf("name %q", name))
+	}
+
+	// The full chain excludes the root, as should be served over TLS.
+	certs, err := cert.ParseCerts(issued.FullChainPEM())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(certs, jc.DeepEquals, []*x509.Certificate{issued.Cert, inter.Cert})
+	tlsCert := issued.TLSCertificate()
+	c.Check(tlsCert.Certificate, jc.DeepEquals, [][]byte{issued.Cert.Raw, inter.Cert.Raw})
+}
+
+func (caSuite) TestIssueClientCert(c *gc.C) {
+	root := newTestRootCA(c)
+	issued, err := root.Issue(cert.LeafParams{
+		CommonName: "client",
+		Client:     true,
+		KeyType:    cert.RSA,
+		KeyBits:    1024,
+		Expiry:     time.Now().AddDate(1, 0, 0),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(issued.Cert.ExtKeyUsage, jc.DeepEquals, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth})
+	c.Check(issued.Cert.KeyUsage, gc.Equals, x509.KeyUsageDigitalSignature|x509.KeyUsageKeyEncipherment)
+	c.Check(issued.Cert.CheckSignatureFrom(root.Cert), jc.ErrorIsNil)
+
+	_, err = root.Issue(cert.LeafParams{CommonName: "nothing"})
+	c.Check(err, gc.ErrorMatches, "certificate for neither server nor client use not valid")
+}
+
+func (caSuite) TestRenew(c *gc.C) {
+	root := newTestRootCA(c)
+	issued, err := root.Issue(cert.LeafParams{
+		CommonName: "server",
+		DNSNames:   []string{"juju.example.com"},
+		Server:     true,
+		Expiry:     time.Now().AddDate(0, 1, 0),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	expiry := time.Now().AddDate(1, 0, 0)
+	renewed, err := root.Renew(issued.Cert, expiry)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(renewed.SerialNumber, gc.Not(jc.DeepEquals), issued.Cert.SerialNumber)
+	c.Check(renewed.PublicKey, jc.DeepEquals, issued.Cert.PublicKey)
+	c.Check(renewed.DNSNames, jc.DeepEquals, issued.Cert.DNSNames)
+	c.Check(renewed.ExtKeyUsage, jc.DeepEquals, issued.Cert.ExtKeyUsage)
+	c.Check(renewed.CheckSignatureFrom(root.Cert), jc.ErrorIsNil)
+	checkNotAfter(c, renewed, expiry)
+}
+
+func (caSuite) TestCreateCRL(c *gc.C) {
+	root := newTestRootCA(c)
+	revokedAt := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	crlPEM, err := root.CreateCRL([]cert.Revoked{{
+		SerialNumber: big.NewInt(1234),
+		RevokedAt:    revokedAt,
+	}}, 1, time.Now().AddDate(0, 0, 7))
+	c.Assert(err, jc.ErrorIsNil)
+
+	block, _ := pem.Decode(crlPEM)
+	c.Assert(block, gc.NotNil)
+	c.Check(block.Type, gc.Equals, "X509 CRL")
+	crl, err := x509.ParseCRL(block.Bytes)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(root.Cert.CheckCRLSignature(crl), jc.ErrorIsNil)
+	revoked := crl.TBSCertList.RevokedCertificates
+	c.Assert(revoked, gc.HasLen, 1)
+	c.Check(revoked[0].SerialNumber, jc.DeepEquals, big.NewInt(1234))
+	c.Check(revoked[0].RevocationTime.Equal(revokedAt), jc.IsTrue)
+}
+
+func (caSuite) TestLoadCA(c *gc.C) {
+	root := newTestRootCA(c)
+	inter, err := root.NewIntermediate(cert.CAParams{
+		CommonName: "test intermediate",
+		Expiry:     time.Now().AddDate(5, 0, 0),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	keyPEM, err := inter.KeyPEM()
+	c.Assert(err, jc.ErrorIsNil)
+
+	loaded, err := cert.LoadCA(inter.ChainPEM(), keyPEM)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(loaded.Cert, jc.DeepEquals, inter.Cert)
+	c.Check(loaded.Chain, jc.DeepEquals, inter.Chain)
+
+	rootKeyPEM, err := root.KeyPEM()
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = cert.LoadCA(inter.CertPEM(), rootKeyPEM)
+	c.Check(err, gc.ErrorMatches, "CA certificate and key do not match: .*")
+
+	issued, err := root.Issue(cert.LeafParams{
+		CommonName: "server",
+		Server:     true,
+		Expiry:     time.Now().AddDate(1, 0, 0),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	issuedKeyPEM, err := issued.KeyPEM()
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = cert.LoadCA(issued.CertPEM(), issuedKeyPEM)
+	c.Check(err, gc.ErrorMatches, "CA certificate is not a valid CA")
+}
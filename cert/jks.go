@@ -0,0 +1,242 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package cert
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha1"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// KeyStoreEntry holds an entry read from a Java key store.
+type KeyStoreEntry struct {
+	// Alias holds the name of the entry.
+	Alias string
+
+	// Created holds the time at which the entry was created.
+	Created time.Time
+
+	// Key holds the private key of a key entry, and is nil
+	// for a trusted certificate entry.
+	Key crypto.Signer
+
+	// Certs holds the certificate chain of a key entry, starting
+	// with the certificate for the key, or the certificate of a
+	// trusted certificate entry.
+	Certs []*x509.Certificate
+}
+
+const (
+	jksMagic         = 0xfeedfeed
+	jceksMagic       = 0xcececece
+	jksPrivateKeyTag = 1
+	jksTrustedTag    = 2
+
+	// jksIntegritySalt is hashed with the password and the contents
+	// of a key store to give the digest that ends it.
+	jksIntegritySalt = "Mighty Aphrodite"
+)
+
+// oidJKSKeyProtector identifies the proprietary algorithm
+// with which Sun's key store protects private keys.
+var oidJKSKeyProtector = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 42, 2, 17, 1, 1}
+
+// DecodeJKS decodes a Java key store in the JKS format, as written by
+// keytool before Java 9, returning its entries in the order in which
+// they are stored. The password is used both to check the integrity
+// of the store and to decrypt its private keys, as keytool uses the
+// same password for both by default.
+func DecodeJKS(data []byte, password string) ([]KeyStoreEntry, error) {
+	if len(data) < sha1.Size {
+		return nil, errors.New("key store too short")
+	}
+	body, digest := data[:len(data)-sha1.Size], data[len(data)-sha1.Size:]
+	passwordBytes := bmpString(password, false)
+	h := sha1.New()
+	h.Write(passwordBytes)
+	h.Write([]byte(jksIntegritySalt))
+	h.Write(body)
+	if subtle.ConstantTimeCompare(h.Sum(nil), digest) != 1 {
+		return nil, ErrIncorrectPassword
+	}
+	r := &jksReader{r: bytes.NewReader(body)}
+	switch magic := r.uint32(); magic {
+	case jksMagic:
+	case jceksMagic:
+		return nil, errors.NotSupportedf("JCEKS key store")
+	default:
+		if r.err == nil {
+			return nil, errors.Errorf("not a JKS key store")
+		}
+	}
+	if version := r.uint32(); version != 2 && r.err == nil {
+		return nil, errors.NotSupportedf("JKS version %d", version)
+	}
+	count := r.uint32()
+	var entries []KeyStoreEntry
+	for i := uint32(0); i < count && r.err == nil; i++ {
+		tag := r.uint32()
+		entry := KeyStoreEntry{
+			Alias:   r.utf(),
+			Created: time.Unix(0, int64(r.uint64())*int64(time.Millisecond)),
+		}
+		switch tag {
+		case jksPrivateKeyTag:
+			protected := r.bytes()
+			chainLen := r.uint32()
+			for j := uint32(0); j < chainLen && r.err == nil; j++ {
+				entry.Certs = append(entry.Certs, r.cert())
+			}
+			if r.err != nil {
+				break
+			}
+			key, err := jksDecryptKey(protected, passwordBytes)
+			if err != nil {
+				return nil, errors.Annotatef(err, "cannot decrypt key %q", entry.Alias)
+			}
+			entry.Key = key
+		case jksTrustedTag:
+			entry.Certs = []*x509.Certificate{r.cert()}
+		default:
+			if r.err == nil {
+				return nil, errors.NotSupportedf("key store entry type %d", tag)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	if r.err != nil {
+		return nil, errors.Annotate(r.err, "cannot read key store")
+	}
+	return entries, nil
+}
+
+// jksDecryptKey decrypts a private key protected by Sun's key store.
+// The protected data is a 20-byte salt, the key XORed with a
+// keystream made by repeatedly hashing the password with the salt,
+// and the hash of the password with the key.
+func jksDecryptKey(der, password []byte) (crypto.Signer, error) {
+	var info encryptedPrivateKeyInfo
+	if err := unmarshalAll(der, &info); err != nil {
+		return nil, errors.Annotate(err, "cannot parse encrypted private key")
+	}
+	if !info.Algorithm.Algorithm.Equal(oidJKSKeyProtector) {
+		return nil, errors.NotSupportedf("key protection algorithm %v", info.Algorithm.Algorithm)
+	}
+	data := info.EncryptedData
+	if len(data) < 2*sha1.Size {
+		return nil, errors.New("protected key too short")
+	}
+	salt := data[:sha1.Size]
+	encrypted := data[sha1.Size : len(data)-sha1.Size]
+	check := data[len(data)-sha1.Size:]
+	plain := make([]byte, len(encrypted))
+	digest := salt
+	for i := 0; i < len(plain); i += sha1.Size {
+		h := sha1.New()
+		h.Write(password)
+		h.Write(digest)
+		digest = h.Sum(nil)
+		for j := 0; j < sha1.Size && i+j < len(plain); j++ {
+			plain[i+j] = encrypted[i+j] ^ digest[j]
+		}
+	}
+	h := sha1.New()
+	h.Write(password)
+	h.Write(plain)
+	if subtle.ConstantTimeCompare(h.Sum(nil), check) != 1 {
+		return nil, ErrIncorrectPassword
+	}
+	key, err := x509.ParsePKCS8PrivateKey(plain)
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot parse private key")
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.Errorf("private key with unexpected type %T", key)
+	}
+	return signer, nil
+}
+
+// jksReader reads the big-endian values of a key store. Once a read
+// fails, err is set and all later reads return zero values.
+type jksReader struct {
+	r   io.Reader
+	err error
+}
+
+func (r *jksReader) read(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r.r, buf); err != nil {
+		r.err = errors.New("unexpected end of data")
+		return nil
+	}
+	return buf
+}
+
+func (r *jksReader) uint16() uint16 {
+	if b := r.read(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *jksReader) uint32() uint32 {
+	if b := r.read(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *jksReader) uint64() uint64 {
+	if b := r.read(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+// utf reads a string as written by Java's DataOutput.writeUTF. Its
+// "modified UTF-8" differs from UTF-8 only for characters that
+// aliases rarely hold.
+func (r *jksReader) utf() string {
+	return string(r.read(int(r.uint16())))
+}
+
+// bytes reads a block of data preceded by its length.
+func (r *jksReader) bytes() []byte {
+	n := r.uint32()
+	if r.err == nil && n > 1<<24 {
+		r.err = errors.Errorf("entry too large")
+	}
+	return r.read(int(n))
+}
+
+// cert reads a certificate preceded by its type.
+func (r *jksReader) cert() *x509.Certificate {
+	certType := r.utf()
+	der := r.bytes()
+	if r.err != nil {
+		return nil
+	}
+	if certType != "X.509" {
+		r.err = errors.NotSupportedf("certificate type %q", certType)
+		return nil
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		r.err = errors.Annotate(err, "cannot parse certificate")
+		return nil
+	}
+	return cert
+}
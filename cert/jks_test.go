@@ -0,0 +1,233 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package cert_test
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"time"
+	"unicode/utf16"
+
+	"github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/cert"
+)
+
+type jksSuite struct{}
+
+var _ = gc.Suite(jksSuite{})
+
+// jksEntry describes an entry written by writeJKS.
+type jksEntry struct {
+	cert.KeyStoreEntry
+
+	// keyPassword, if not empty, holds the password
+	// protecting the key instead of the store password.
+	keyPassword string
+}
+
+// writeJKS returns a key store holding the given entries, written as
+// keytool would write it.
+func writeJKS(c *gc.C, magic uint32, password string, entries []jksEntry) []byte {
+	var buf bytes.Buffer
+	write := func(v interface{}) {
+		err := binary.Write(&buf, binary.BigEndian, v)
+		c.Assert(err, jc.ErrorIsNil)
+	}
+	writeUTF := func(s string) {
+		write(uint16(len(s)))
+		buf.WriteString(s)
+	}
+	writeCert := func(xcert *x509.Certificate) {
+		writeUTF("X.509")
+		write(uint32(len(xcert.Raw)))
+		buf.Write(xcert.Raw)
+	}
+	write(magic)
+	write(uint32(2))
+	write(uint32(len(entries)))
+	for _, entry := range entries {
+		if entry.Key == nil {
+			write(uint32(2))
+		} else {
+			write(uint32(1))
+		}
+		writeUTF(entry.Alias)
+		write(entry.Created.UnixNano() / int64(time.Millisecond))
+		if entry.Key == nil {
+			writeCert(entry.Certs[0])
+			continue
+		}
+		keyPassword := entry.keyPassword
+		if keyPassword == "" {
+			keyPassword = password
+		}
+		protected := protectJKSKey(c, entry.Key, keyPassword)
+		write(uint32(len(protected)))
+		buf.Write(protected)
+		write(uint32(len(entry.Certs)))
+		for _, xcert := range entry.Certs {
+			writeCert(xcert)
+		}
+	}
+	h := sha1.New()
+	h.Write(jksPassword(password))
+	h.Write([]byte("Mighty Aphrodite"))
+	h.Write(buf.Bytes())
+	buf.Write(h.Sum(nil))
+	return buf.Bytes()
+}
+
+// protectJKSKey encrypts key as Sun's key store does.
+func protectJKSKey(c *gc.C, key crypto.Signer, password string) []byte {
+	plain, err := x509.MarshalPKCS8PrivateKey(key)
+	c.Assert(err, jc.ErrorIsNil)
+	pw := jksPassword(password)
+	salt := make([]byte, sha1.Size)
+	_, err = rand.Read(salt)
+	c.Assert(err, jc.ErrorIsNil)
+	data := append([]byte(nil), salt...)
+	digest := salt
+	for i := 0; i < len(plain); i += sha1.Size {
+		sum := sha1.Sum(append(append([]byte(nil), pw...), digest...))
+		digest = sum[:]
+		for j := 0; j < sha1.Size && i+j < len(plain); j++ {
+			data = append(data, plain[i+j]^digest[j])
+		}
+	}
+	check := sha1.Sum(append(append([]byte(nil), pw...), plain...))
+	data = append(data, check[:]...)
+	info := struct {
+		Algorithm     pkix.AlgorithmIdentifier
+		EncryptedData []byte
+	}{
+		Algorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 42, 2, 17, 1, 1},
+			Parameters: asn1.NullRawValue,
+		},
+		EncryptedData: data,
+	}
+	der, err := asn1.Marshal(info)
+	c.Assert(err, jc.ErrorIsNil)
+	return der
+}
+
+// jksPassword returns password as the big-endian
+// UTF-16 used by Java.
+func jksPassword(password string) []byte {
+	var pw []byte
+	for _, r := range utf16.Encode([]rune(password)) {
+		pw = append(pw, byte(r>>8), byte(r))
+	}
+	return pw
+}
+
+func (jksSuite) TestDecodeJKS(c *gc.C) {
+	created := time.Date(2022, 3, 4, 5, 6, 7, 8e6, time.UTC)
+	rsaIssued := newTestIssued(c, cert.RSA)
+	ecIssued := newTestIssued(c, cert.ECDSA)
+	ca := newTestRootCA(c)
+	data := writeJKS(c, 0xfeedfeed, "changeit", []jksEntry{{
+		KeyStoreEntry: cert.KeyStoreEntry{
+			Alias:   "rsa",
+			Created: created,
+			Key:     rsaIssued.Key,
+			Certs:   issuedCerts(rsaIssued),
+		},
+	}, {
+		KeyStoreEntry: cert.KeyStoreEntry{
+			Alias:   "ecdsa",
+			Created: created,
+			Key:     ecIssued.Key,
+			Certs:   issuedCerts(ecIssued),
+		},
+	}, {
+		KeyStoreEntry: cert.KeyStoreEntry{
+			Alias:   "ca",
+			Created: created,
+			Certs:   []*x509.Certificate{ca.Cert},
+		},
+	}})
+
+	entries, err := cert.DecodeJKS(data, "changeit")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(entries, gc.HasLen, 3)
+
+	c.Check(entries[0].Alias, gc.Equals, "rsa")
+	c.Check(entries[0].Created.Equal(created), jc.IsTrue)
+	checkSameKey(c, entries[0].Key, rsaIssued.Key)
+	checkSameCerts(c, entries[0].Certs, issuedCerts(rsaIssued))
+
+	c.Check(entries[1].Alias, gc.Equals, "ecdsa")
+	checkSameKey(c, entries[1].Key, ecIssued.Key)
+	checkSameCerts(c, entries[1].Certs, issuedCerts(ecIssued))
+
+	c.Check(entries[2].Alias, gc.Equals, "ca")
+	c.Check(entries[2].Created.Equal(created), jc.IsTrue)
+	c.Check(entries[2].Key, gc.IsNil)
+	checkSameCerts(c, entries[2].Certs, []*x509.Certificate{ca.Cert})
+}
+
+func (jksSuite) TestIncorrectPassword(c *gc.C) {
+	ca := newTestRootCA(c)
+	data := writeJKS(c, 0xfeedfeed, "changeit", []jksEntry{{
+		KeyStoreEntry: cert.KeyStoreEntry{
+			Alias: "ca",
+			Certs: []*x509.Certificate{ca.Cert},
+		},
+	}})
+	_, err := cert.DecodeJKS(data, "wrong")
+	c.Assert(errors.Cause(err), gc.Equals, cert.ErrIncorrectPassword)
+}
+
+func (jksSuite) TestIncorrectKeyPassword(c *gc.C) {
+	issued := newTestIssued(c, cert.ECDSA)
+	data := writeJKS(c, 0xfeedfeed, "changeit", []jksEntry{{
+		KeyStoreEntry: cert.KeyStoreEntry{
+			Alias: "server",
+			Key:   issued.Key,
+			Certs: issuedCerts(issued),
+		},
+		keyPassword: "other",
+	}})
+	_, err := cert.DecodeJKS(data, "changeit")
+	c.Assert(err, gc.ErrorMatches, `cannot decrypt key "server": incorrect password`)
+	c.Assert(errors.Cause(err), gc.Equals, cert.ErrIncorrectPassword)
+}
+
+func (jksSuite) TestJCEKSNotSupported(c *gc.C) {
+	data := writeJKS(c, 0xcececece, "changeit", nil)
+	_, err := cert.DecodeJKS(data, "changeit")
+	c.Assert(err, jc.Satisfies, errors.IsNotSupported)
+}
+
+func (jksSuite) TestTruncated(c *gc.C) {
+	ca := newTestRootCA(c)
+	data := writeJKS(c, 0xfeedfeed, "changeit", []jksEntry{{
+		KeyStoreEntry: cert.KeyStoreEntry{
+			Alias: "ca",
+			Certs: []*x509.Certificate{ca.Cert},
+		},
+	}})
+	// Drop the certificate but keep a valid digest.
+	body := data[:40]
+	h := sha1.New()
+	h.Write(jksPassword("changeit"))
+	h.Write([]byte("Mighty Aphrodite"))
+	h.Write(body)
+	data = append(append([]byte(nil), body...), h.Sum(nil)...)
+	_, err := cert.DecodeJKS(data, "changeit")
+	c.Assert(err, gc.ErrorMatches, "cannot read key store: unexpected end of data")
+
+	_, err = cert.DecodeJKS([]byte("short"), "changeit")
+	c.Assert(err, gc.ErrorMatches, "key store too short")
+}
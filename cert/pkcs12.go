@@ -0,0 +1,901 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package cert
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"hash"
+	"unicode/utf16"
+
+	"github.com/juju/errors"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/pkcs12"
+)
+
+// PKCS12Options holds the options for EncodePKCS12.
+type PKCS12Options struct {
+	// Password holds the password protecting the bundle.
+	Password string
+
+	// FriendlyName, if not empty, is recorded as the name of the
+	// key and its certificate. Java's keytool uses it as the alias
+	// of the key entry.
+	FriendlyName string
+
+	// Legacy specifies that the bundle is protected with 3DES and a
+	// SHA-1 MAC, which older tools, such as those of Windows before
+	// Server 2019 and Java before 8u301, require. Otherwise AES-256
+	// and a SHA-256 MAC are used, as by OpenSSL 3.
+	Legacy bool
+
+	// Iterations holds the number of iterations used to derive keys
+	// from the password. If it is zero, 2048 is used.
+	Iterations int
+}
+
+// ErrIncorrectPassword is returned when a bundle cannot
+// be decoded because its password is incorrect.
+var ErrIncorrectPassword = errors.New("incorrect password")
+
+var (
+	oidData                = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidEncryptedData       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 6}
+	oidKeyBag              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 1}
+	oidShroudedKeyBag      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidCertBag             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidX509Certificate     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+	oidFriendlyName        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 20}
+	oidLocalKeyID          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 21}
+	oidJavaTrustedKeyUsage = asn1.ObjectIdentifier{2, 16, 840, 1, 113894, 746875, 1, 1}
+	oidAnyExtendedKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37, 0}
+	oidPBEWithSHA1And3DES  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 3}
+	oidPBEWithSHA1And40RC2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 6}
+	oidPBES2               = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1        = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256      = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384      = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512      = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+	oidAES128CBC           = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC           = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC           = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3CBC          = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+	oidSHA1                = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256              = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384              = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512              = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+)
+
+// defaultPKCS12Iterations holds the number of iterations used
+// to derive keys from passwords, as by OpenSSL.
+const defaultPKCS12Iterations = 2048
+
+// errLegacyRC2Encryption is returned when a bundle is
+// found to use RC2 encryption.
+var errLegacyRC2Encryption = errors.New("RC2 encryption")
+
+// The types below describe the ASN.1 structures of RFC 7292.
+// Explicitly tagged fields are asn1.RawValues holding the tag, with
+// the tagged value in Bytes, as encoding/asn1 ignores the tag
+// parameters of raw values.
+
+type pfxPDU struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  macData `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"tag:0,explicit,optional"`
+}
+
+type macData struct {
+	Mac        digestInfo
+	MacSalt    []byte
+	Iterations int `asn1:"optional,default:1"`
+}
+
+type digestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+type encryptedData struct {
+	Version              int
+	EncryptedContentInfo encryptedContentInfo
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           []byte `asn1:"tag:0,optional"`
+}
+
+type safeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue     `asn1:"tag:0,explicit"`
+	Attributes []pkcs12Attribute `asn1:"set,optional"`
+}
+
+type pkcs12Attribute struct {
+	ID     asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+type certBag struct {
+	ID   asn1.ObjectIdentifier
+	Data []byte `asn1:"tag:0,explicit"`
+}
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbeParams struct {
+	Salt       []byte
+	Iterations int
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt       []byte
+	Iterations int
+	KeyLength  int                      `asn1:"optional"`
+	PRF        pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// EncodePKCS12 returns a PKCS #12 bundle, also known as a PFX or .p12
+// file, holding the given key and certificates. The first certificate
+// should be that of the key, and any others those of the CAs that
+// issued it. If key is nil, the bundle holds only the certificates,
+// marked as trusted for Java.
+func EncodePKCS12(key crypto.Signer, certs []*x509.Certificate, options PKCS12Options) ([]byte, error) {
+	if options.Iterations == 0 {
+		options.Iterations = defaultPKCS12Iterations
+	}
+	e := &pkcs12Encoder{options: options}
+	var localKeyID []byte
+	if key != nil {
+		if len(certs) == 0 {
+			return nil, errors.NotValidf("key without certificate")
+		}
+		sum := sha1.Sum(certs[0].Raw)
+		localKeyID = sum[:]
+	}
+	var certBags []safeBag
+	for i, cert := range certs {
+		var attrs []pkcs12Attribute
+		switch {
+		case i == 0 && key != nil:
+			attrs = e.keyAttributes(localKeyID)
+		case key == nil:
+			attrs = []pkcs12Attribute{attribute(oidJavaTrustedKeyUsage, oidAnyExtendedKeyUsage)}
+		}
+		bag, err := newCertBag(cert, attrs)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		certBags = append(certBags, bag)
+	}
+	var authSafe []contentInfo
+	if len(certBags) > 0 {
+		info, err := e.encryptedContent(certBags)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		authSafe = append(authSafe, info)
+	}
+	if key != nil {
+		bag, err := e.shroudedKeyBag(key, e.keyAttributes(localKeyID))
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		info, err := dataContent([]safeBag{bag})
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		authSafe = append(authSafe, info)
+	}
+	authSafeData, err := asn1.Marshal(authSafe)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	mac, err := e.mac(authSafeData)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	pfx := pfxPDU{
+		Version: 3,
+		AuthSafe: contentInfo{
+			ContentType: oidData,
+			Content:     explicit(octetString(authSafeData)),
+		},
+		MacData: mac,
+	}
+	data, err := asn1.Marshal(pfx)
+	return data, errors.Trace(err)
+}
+
+// PKCS12 returns a PKCS #12 bundle holding the issued key and
+// certificate with the certificates of the CAs that issued it.
+func (i *Issued) PKCS12(options PKCS12Options) ([]byte, error) {
+	return EncodePKCS12(i.Key, append([]*x509.Certificate{i.Cert}, i.Chain...), options)
+}
+
+type pkcs12Encoder struct {
+	options PKCS12Options
+}
+
+func (e *pkcs12Encoder) keyAttributes(localKeyID []byte) []pkcs12Attribute {
+	attrs := []pkcs12Attribute{attribute(oidLocalKeyID, localKeyID)}
+	if e.options.FriendlyName != "" {
+		attrs = append(attrs, attribute(oidFriendlyName, asn1.RawValue{
+			Tag:   asn1.TagBMPString,
+			Bytes: bmpString(e.options.FriendlyName, false),
+		}))
+	}
+	return attrs
+}
+
+func (e *pkcs12Encoder) shroudedKeyBag(key crypto.Signer, attrs []pkcs12Attribute) (safeBag, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return safeBag{}, errors.Annotate(err, "cannot marshal private key")
+	}
+	alg, ciphertext, err := e.encrypt(der)
+	if err != nil {
+		return safeBag{}, errors.Trace(err)
+	}
+	value, err := asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm:     alg,
+		EncryptedData: ciphertext,
+	})
+	if err != nil {
+		return safeBag{}, errors.Trace(err)
+	}
+	return safeBag{
+		ID:         oidShroudedKeyBag,
+		Value:      explicit(asn1.RawValue{FullBytes: value}),
+		Attributes: attrs,
+	}, nil
+}
+
+func newCertBag(cert *x509.Certificate, attrs []pkcs12Attribute) (safeBag, error) {
+	value, err := asn1.Marshal(certBag{
+		ID:   oidX509Certificate,
+		Data: cert.Raw,
+	})
+	if err != nil {
+		return safeBag{}, errors.Trace(err)
+	}
+	return safeBag{
+		ID:         oidCertBag,
+		Value:      explicit(asn1.RawValue{FullBytes: value}),
+		Attributes: attrs,
+	}, nil
+}
+
+// dataContent returns the given bags as unencrypted content.
+func dataContent(bags []safeBag) (contentInfo, error) {
+	data, err := asn1.Marshal(bags)
+	if err != nil {
+		return contentInfo{}, errors.Trace(err)
+	}
+	return contentInfo{
+		ContentType: oidData,
+		Content:     explicit(octetString(data)),
+	}, nil
+}
+
+// encryptedContent returns the given bags as encrypted content.
+func (e *pkcs12Encoder) encryptedContent(bags []safeBag) (contentInfo, error) {
+	data, err := asn1.Marshal(bags)
+	if err != nil {
+		return contentInfo{}, errors.Trace(err)
+	}
+	alg, ciphertext, err := e.encrypt(data)
+	if err != nil {
+		return contentInfo{}, errors.Trace(err)
+	}
+	content, err := asn1.Marshal(encryptedData{
+		EncryptedContentInfo: encryptedContentInfo{
+			ContentType:                oidData,
+			ContentEncryptionAlgorithm: alg,
+			EncryptedContent:           ciphertext,
+		},
+	})
+	if err != nil {
+		return contentInfo{}, errors.Trace(err)
+	}
+	return contentInfo{
+		ContentType: oidEncryptedData,
+		Content:     explicit(asn1.RawValue{FullBytes: content}),
+	}, nil
+}
+
+// encrypt encrypts data with a key derived from the password,
+// returning the algorithm used and the ciphertext.
+func (e *pkcs12Encoder) encrypt(data []byte) (pkix.AlgorithmIdentifier, []byte, error) {
+	salt, err := randomBytes(16)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, errors.Trace(err)
+	}
+	if e.options.Legacy {
+		params, err := asn1.Marshal(pbeParams{Salt: salt[:8], Iterations: e.options.Iterations})
+		if err != nil {
+			return pkix.AlgorithmIdentifier{}, nil, errors.Trace(err)
+		}
+		password := bmpString(e.options.Password, true)
+		key := pkcs12KDF(sha1.New, salt[:8], password, e.options.Iterations, 1, 24)
+		iv := pkcs12KDF(sha1.New, salt[:8], password, e.options.Iterations, 2, 8)
+		block, err := des.NewTripleDESCipher(key)
+		if err != nil {
+			return pkix.AlgorithmIdentifier{}, nil, errors.Trace(err)
+		}
+		alg := pkix.AlgorithmIdentifier{
+			Algorithm:  oidPBEWithSHA1And3DES,
+			Parameters: asn1.RawValue{FullBytes: params},
+		}
+		return alg, cbcEncrypt(block, iv, data), nil
+	}
+	iv, err := randomBytes(aes.BlockSize)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, errors.Trace(err)
+	}
+	kdfParams, err := asn1.Marshal(pbkdf2Params{
+		Salt:       salt,
+		Iterations: e.options.Iterations,
+		PRF: pkix.AlgorithmIdentifier{
+			Algorithm:  oidHMACWithSHA256,
+			Parameters: asn1.NullRawValue,
+		},
+	})
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, errors.Trace(err)
+	}
+	ivParam, err := asn1.Marshal(iv)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, errors.Trace(err)
+	}
+	params, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{
+			Algorithm:  oidPBKDF2,
+			Parameters: asn1.RawValue{FullBytes: kdfParams},
+		},
+		EncryptionScheme: pkix.AlgorithmIdentifier{
+			Algorithm:  oidAES256CBC,
+			Parameters: asn1.RawValue{FullBytes: ivParam},
+		},
+	})
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, errors.Trace(err)
+	}
+	key := pbkdf2.Key([]byte(e.options.Password), salt, e.options.Iterations, 32, sha256.New)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, errors.Trace(err)
+	}
+	alg := pkix.AlgorithmIdentifier{
+		Algorithm:  oidPBES2,
+		Parameters: asn1.RawValue{FullBytes: params},
+	}
+	return alg, cbcEncrypt(block, iv, data), nil
+}
+
+func (e *pkcs12Encoder) mac(data []byte) (macData, error) {
+	salt, err := randomBytes(8)
+	if err != nil {
+		return macData{}, errors.Trace(err)
+	}
+	newHash, alg := sha256.New, oidSHA256
+	if e.options.Legacy {
+		newHash, alg = sha1.New, oidSHA1
+	}
+	digest := computeMAC(newHash, data, salt, bmpString(e.options.Password, true), e.options.Iterations)
+	return macData{
+		Mac: digestInfo{
+			Algorithm: pkix.AlgorithmIdentifier{
+				Algorithm:  alg,
+				Parameters: asn1.NullRawValue,
+			},
+			Digest: digest,
+		},
+		MacSalt:    salt,
+		Iterations: e.options.Iterations,
+	}, nil
+}
+
+// DecodePKCS12 decodes a PKCS #12 bundle protected with the given
+// password, returning the private key it holds, if any, and its
+// certificates. If there is a key, the first certificate is the one
+// for it. Bundles protected with AES, 3DES or RC2, as written by
+// OpenSSL, Windows and Java, can be decoded, as can bundles with RSA,
+// ECDSA and Ed25519 keys, except that Ed25519 keys cannot be decoded
+// from bundles protected with RC2.
+func DecodePKCS12(data []byte, password string) (crypto.Signer, []*x509.Certificate, error) {
+	var pfx pfxPDU
+	if err := unmarshalAll(data, &pfx); err != nil {
+		return nil, nil, errors.Annotate(err, "cannot parse PKCS #12 bundle")
+	}
+	if pfx.Version != 3 {
+		return nil, nil, errors.NotSupportedf("PKCS #12 version %d", pfx.Version)
+	}
+	if !pfx.AuthSafe.ContentType.Equal(oidData) {
+		return nil, nil, errors.NotSupportedf("PKCS #12 bundle signed with public key")
+	}
+	var authSafeData []byte
+	if err := unmarshalAll(pfx.AuthSafe.Content.Bytes, &authSafeData); err != nil {
+		return nil, nil, errors.Annotate(err, "cannot parse PKCS #12 bundle")
+	}
+	d := &pkcs12Decoder{}
+	if err := d.verifyMAC(pfx.MacData, authSafeData, password); err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	var authSafe []contentInfo
+	if err := unmarshalAll(authSafeData, &authSafe); err != nil {
+		return nil, nil, errors.Annotate(err, "cannot parse PKCS #12 contents")
+	}
+	var key crypto.Signer
+	var certs []*x509.Certificate
+	for _, info := range authSafe {
+		bags, err := d.safeBags(info)
+		if err == errLegacyRC2Encryption {
+			return decodeLegacyPKCS12(data, password)
+		}
+		if err != nil {
+			return nil, nil, errors.Trace(err)
+		}
+		for _, bag := range bags {
+			switch {
+			case bag.ID.Equal(oidCertBag):
+				cert, err := parseCertBag(bag.Value.Bytes)
+				if err != nil {
+					return nil, nil, errors.Trace(err)
+				}
+				certs = append(certs, cert)
+			case bag.ID.Equal(oidKeyBag), bag.ID.Equal(oidShroudedKeyBag):
+				if key != nil {
+					return nil, nil, errors.NotSupportedf("PKCS #12 bundle with several keys")
+				}
+				key, err = d.parseKeyBag(bag)
+				if err == errLegacyRC2Encryption {
+					return decodeLegacyPKCS12(data, password)
+				}
+				if err != nil {
+					return nil, nil, errors.Trace(err)
+				}
+			}
+		}
+	}
+	return key, keyCertFirst(key, certs), nil
+}
+
+type pkcs12Decoder struct {
+	// password holds the BMPString form of the password
+	// that was found to match the MAC.
+	password []byte
+	// utf8Password holds the password as given.
+	utf8Password []byte
+}
+
+func (d *pkcs12Decoder) verifyMAC(mac macData, data []byte, password string) error {
+	d.utf8Password = []byte(password)
+	d.password = bmpString(password, true)
+	if mac.Mac.Algorithm.Algorithm == nil {
+		// There is no MAC, so the password cannot be checked
+		// until it is used to decrypt the contents.
+		return nil
+	}
+	newHash := hashForOID(mac.Mac.Algorithm.Algorithm)
+	if newHash == nil {
+		return errors.NotSupportedf("PKCS #12 MAC algorithm %v", mac.Mac.Algorithm.Algorithm)
+	}
+	candidates := [][]byte{d.password}
+	if password == "" {
+		// Some tools encode an empty password without
+		// the terminating zero.
+		candidates = append(candidates, nil)
+	}
+	for _, candidate := range candidates {
+		expect := computeMAC(newHash, data, mac.MacSalt, candidate, mac.Iterations)
+		if hmac.Equal(expect, mac.Mac.Digest) {
+			d.password = candidate
+			return nil
+		}
+	}
+	return ErrIncorrectPassword
+}
+
+// safeBags returns the bags in the given content.
+func (d *pkcs12Decoder) safeBags(info contentInfo) ([]safeBag, error) {
+	var data []byte
+	switch {
+	case info.ContentType.Equal(oidData):
+		if err := unmarshalAll(info.Content.Bytes, &data); err != nil {
+			return nil, errors.Annotate(err, "cannot parse PKCS #12 contents")
+		}
+	case info.ContentType.Equal(oidEncryptedData):
+		var encrypted encryptedData
+		if err := unmarshalAll(info.Content.Bytes, &encrypted); err != nil {
+			return nil, errors.Annotate(err, "cannot parse PKCS #12 encrypted contents")
+		}
+		var err error
+		data, err = d.decrypt(
+			encrypted.EncryptedContentInfo.ContentEncryptionAlgorithm,
+			encrypted.EncryptedContentInfo.EncryptedContent,
+		)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.NotSupportedf("PKCS #12 content type %v", info.ContentType)
+	}
+	var bags []safeBag
+	if err := unmarshalAll(data, &bags); err != nil {
+		return nil, errors.Annotate(err, "cannot parse PKCS #12 safe contents")
+	}
+	return bags, nil
+}
+
+func (d *pkcs12Decoder) parseKeyBag(bag safeBag) (crypto.Signer, error) {
+	der := bag.Value.Bytes
+	if bag.ID.Equal(oidShroudedKeyBag) {
+		var info encryptedPrivateKeyInfo
+		if err := unmarshalAll(der, &info); err != nil {
+			return nil, errors.Annotate(err, "cannot parse encrypted private key")
+		}
+		var err error
+		der, err = d.decrypt(info.Algorithm, info.EncryptedData)
+		if err != nil {
+			return nil, err
+		}
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot parse private key")
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.Errorf("private key with unexpected type %T", key)
+	}
+	return signer, nil
+}
+
+func parseCertBag(der []byte) (*x509.Certificate, error) {
+	var bag certBag
+	if err := unmarshalAll(der, &bag); err != nil {
+		return nil, errors.Annotate(err, "cannot parse certificate bag")
+	}
+	if !bag.ID.Equal(oidX509Certificate) {
+		return nil, errors.NotSupportedf("certificate type %v", bag.ID)
+	}
+	cert, err := x509.ParseCertificate(bag.Data)
+	return cert, errors.Annotate(err, "cannot parse certificate")
+}
+
+// decrypt decrypts data encrypted with the given algorithm.
+func (d *pkcs12Decoder) decrypt(alg pkix.AlgorithmIdentifier, data []byte) ([]byte, error) {
+	var block cipher.Block
+	var iv []byte
+	switch {
+	case alg.Algorithm.Equal(oidPBEWithSHA1And3DES):
+		var params pbeParams
+		if err := unmarshalAll(alg.Parameters.FullBytes, &params); err != nil {
+			return nil, errors.Annotate(err, "cannot parse encryption parameters")
+		}
+		key := pkcs12KDF(sha1.New, params.Salt, d.password, params.Iterations, 1, 24)
+		iv = pkcs12KDF(sha1.New, params.Salt, d.password, params.Iterations, 2, 8)
+		var err error
+		if block, err = des.NewTripleDESCipher(key); err != nil {
+			return nil, errors.Trace(err)
+		}
+	case alg.Algorithm.Equal(oidPBEWithSHA1And40RC2):
+		return nil, errLegacyRC2Encryption
+	case alg.Algorithm.Equal(oidPBES2):
+		var err error
+		if block, iv, err = d.pbes2Cipher(alg.Parameters.FullBytes); err != nil {
+			return nil, errors.Trace(err)
+		}
+	default:
+		return nil, errors.NotSupportedf("encryption algorithm %v", alg.Algorithm)
+	}
+	plain, err := cbcDecrypt(block, iv, data)
+	if err != nil {
+		// Without a MAC, a wrong password is
+		// only found when decryption fails.
+		return nil, ErrIncorrectPassword
+	}
+	return plain, nil
+}
+
+// pbes2Cipher returns the cipher and IV described
+// by the given PBES2 parameters.
+func (d *pkcs12Decoder) pbes2Cipher(der []byte) (cipher.Block, []byte, error) {
+	var params pbes2Params
+	if err := unmarshalAll(der, &params); err != nil {
+		return nil, nil, errors.Annotate(err, "cannot parse PBES2 parameters")
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, nil, errors.NotSupportedf("key derivation function %v", params.KeyDerivationFunc.Algorithm)
+	}
+	var kdf pbkdf2Params
+	if err := unmarshalAll(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, nil, errors.Annotate(err, "cannot parse PBKDF2 parameters")
+	}
+	prf := sha1.New
+	switch alg := kdf.PRF.Algorithm; {
+	case alg == nil || alg.Equal(oidHMACWithSHA1):
+	case alg.Equal(oidHMACWithSHA256):
+		prf = sha256.New
+	case alg.Equal(oidHMACWithSHA384):
+		prf = sha512.New384
+	case alg.Equal(oidHMACWithSHA512):
+		prf = sha512.New
+	default:
+		return nil, nil, errors.NotSupportedf("PBKDF2 function %v", alg)
+	}
+	var keyLen int
+	var newCipher func([]byte) (cipher.Block, error)
+	switch alg := params.EncryptionScheme.Algorithm; {
+	case alg.Equal(oidAES128CBC):
+		keyLen, newCipher = 16, aes.NewCipher
+	case alg.Equal(oidAES192CBC):
+		keyLen, newCipher = 24, aes.NewCipher
+	case alg.Equal(oidAES256CBC):
+		keyLen, newCipher = 32, aes.NewCipher
+	case alg.Equal(oidDESEDE3CBC):
+		keyLen, newCipher = 24, des.NewTripleDESCipher
+	default:
+		return nil, nil, errors.NotSupportedf("encryption scheme %v", alg)
+	}
+	var iv []byte
+	if err := unmarshalAll(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, nil, errors.Annotate(err, "cannot parse encryption IV")
+	}
+	key := pbkdf2.Key(d.utf8Password, kdf.Salt, kdf.Iterations, keyLen, prf)
+	block, err := newCipher(key)
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	if len(iv) != block.BlockSize() {
+		return nil, nil, errors.NotValidf("IV length %d", len(iv))
+	}
+	return block, iv, nil
+}
+
+// decodeLegacyPKCS12 decodes a bundle using RC2 encryption, which is
+// not available in the standard library, with the decoder of
+// golang.org/x/crypto/pkcs12.
+func decodeLegacyPKCS12(data []byte, password string) (crypto.Signer, []*x509.Certificate, error) {
+	blocks, err := pkcs12.ToPEM(data, password)
+	if err == pkcs12.ErrIncorrectPassword {
+		return nil, nil, ErrIncorrectPassword
+	}
+	if err != nil {
+		return nil, nil, errors.Annotate(err, "cannot decode PKCS #12 bundle")
+	}
+	var key crypto.Signer
+	var certs []*x509.Certificate
+	for _, block := range blocks {
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, nil, errors.Annotate(err, "cannot parse certificate")
+			}
+			certs = append(certs, cert)
+		case "PRIVATE KEY":
+			// The key is in PKCS #1 or SEC 1 form, despite
+			// the block type.
+			if rsaKey, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+				key = rsaKey
+				break
+			}
+			pemKey := string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: block.Bytes}))
+			if key, err = ParsePrivateKeyPEM(pemKey); err != nil {
+				return nil, nil, errors.Trace(err)
+			}
+		}
+	}
+	return key, keyCertFirst(key, certs), nil
+}
+
+// keyCertFirst returns certs with the certificate
+// for key, if any, moved to the start.
+func keyCertFirst(key crypto.Signer, certs []*x509.Certificate) []*x509.Certificate {
+	if key == nil {
+		return certs
+	}
+	pub, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok {
+		return certs
+	}
+	for i, cert := range certs {
+		if pub.Equal(cert.PublicKey) {
+			result := append([]*x509.Certificate{cert}, certs[:i]...)
+			return append(result, certs[i+1:]...)
+		}
+	}
+	return certs
+}
+
+// pkcs12KDF derives size bytes of key material from the password and
+// salt, for the purpose given by id, as in appendix B of RFC 7292.
+func pkcs12KDF(newHash func() hash.Hash, salt, password []byte, iterations int, id byte, size int) []byte {
+	h := newHash()
+	u, v := h.Size(), h.BlockSize()
+	d := bytes.Repeat([]byte{id}, v)
+	s := fillBlocks(salt, v)
+	p := fillBlocks(password, v)
+	i := append(s, p...)
+	var a []byte
+	for len(a) < size {
+		h.Reset()
+		h.Write(d)
+		h.Write(i)
+		ai := h.Sum(nil)
+		for j := 1; j < iterations; j++ {
+			h.Reset()
+			h.Write(ai)
+			ai = h.Sum(ai[:0])
+		}
+		a = append(a, ai...)
+		if len(a) >= size {
+			break
+		}
+		// Add B+1 to each v-byte block of I, with B
+		// being Ai repeated to v bytes.
+		b := bytes.Repeat(ai, (v+u-1)/u)[:v]
+		for j := 0; j < len(i); j += v {
+			carry := 1
+			for k := v - 1; k >= 0; k-- {
+				sum := int(i[j+k]) + int(b[k]) + carry
+				i[j+k] = byte(sum)
+				carry = sum >> 8
+			}
+		}
+	}
+	return a[:size]
+}
+
+// fillBlocks returns pattern repeated to fill
+// a whole number of blocks of v bytes.
+func fillBlocks(pattern []byte, v int) []byte {
+	if len(pattern) == 0 {
+		return nil
+	}
+	n := v * ((len(pattern) + v - 1) / v)
+	return bytes.Repeat(pattern, (n+len(pattern)-1)/len(pattern))[:n]
+}
+
+func computeMAC(newHash func() hash.Hash, data, salt, password []byte, iterations int) []byte {
+	key := pkcs12KDF(newHash, salt, password, iterations, 3, newHash().Size())
+	mac := hmac.New(newHash, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func hashForOID(oid asn1.ObjectIdentifier) func() hash.Hash {
+	switch {
+	case oid.Equal(oidSHA1):
+		return sha1.New
+	case oid.Equal(oidSHA256):
+		return sha256.New
+	case oid.Equal(oidSHA384):
+		return sha512.New384
+	case oid.Equal(oidSHA512):
+		return sha512.New
+	}
+	return nil
+}
+
+// bmpString returns s encoded as a big-endian UTF-16 string,
+// with a terminating zero if terminate is true, as passwords
+// are encoded.
+func bmpString(s string, terminate bool) []byte {
+	var b []byte
+	for _, c := range utf16.Encode([]rune(s)) {
+		b = append(b, byte(c>>8), byte(c))
+	}
+	if terminate {
+		b = append(b, 0, 0)
+	}
+	return b
+}
+
+func cbcEncrypt(block cipher.Block, iv, data []byte) []byte {
+	n := block.BlockSize() - len(data)%block.BlockSize()
+	padded := append(append([]byte(nil), data...), bytes.Repeat([]byte{byte(n)}, n)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(padded, padded)
+	return padded
+}
+
+func cbcDecrypt(block cipher.Block, iv, data []byte) ([]byte, error) {
+	size := block.BlockSize()
+	if len(data) == 0 || len(data)%size != 0 {
+		return nil, errors.New("bad ciphertext length")
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+	n := int(plain[len(plain)-1])
+	if n == 0 || n > size {
+		return nil, errors.New("bad padding")
+	}
+	for _, b := range plain[len(plain)-n:] {
+		if int(b) != n {
+			return nil, errors.New("bad padding")
+		}
+	}
+	return plain[:len(plain)-n], nil
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, errors.Annotate(err, "cannot generate random data")
+	}
+	return b, nil
+}
+
+// attribute returns an attribute with the single given value.
+func attribute(id asn1.ObjectIdentifier, value interface{}) pkcs12Attribute {
+	// The values are all marshalable.
+	der, _ := asn1.Marshal(value)
+	return pkcs12Attribute{
+		ID: id,
+		Values: asn1.RawValue{
+			Tag:        asn1.TagSet,
+			IsCompound: true,
+			Bytes:      der,
+		},
+	}
+}
+
+// explicit returns v wrapped in an explicit context-specific
+// tag 0, which encoding/asn1 does not add to raw values.
+func explicit(v asn1.RawValue) asn1.RawValue {
+	der, _ := asn1.Marshal(v)
+	return asn1.RawValue{
+		Class:      asn1.ClassContextSpecific,
+		Tag:        0,
+		IsCompound: true,
+		Bytes:      der,
+	}
+}
+
+func octetString(data []byte) asn1.RawValue {
+	return asn1.RawValue{Tag: asn1.TagOctetString, Bytes: data}
+}
+
+// unmarshalAll unmarshals der into v, failing if
+// there is data left over.
+func unmarshalAll(der []byte, v interface{}) error {
+	rest, err := asn1.Unmarshal(der, v)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return errors.New("trailing data")
+	}
+	return nil
+}
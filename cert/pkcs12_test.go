@@ -0,0 +1,170 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package cert_test
+
+import (
+	"crypto"
+	"crypto/x509"
+	"time"
+
+	"github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	"golang.org/x/crypto/pkcs12"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/cert"
+)
+
+type pkcs12Suite struct{}
+
+var _ = gc.Suite(pkcs12Suite{})
+
+func newTestIssued(c *gc.C, keyType cert.KeyType) *cert.Issued {
+	bits := 0
+	if keyType == cert.RSA {
+		// Small keys make the tests faster.
+		bits = 1024
+	}
+	ca := newTestRootCA(c)
+	issued, err := ca.Issue(cert.LeafParams{
+		CommonName: "test leaf",
+		DNSNames:   []string{"example.com"},
+		Server:     true,
+		KeyType:    keyType,
+		KeyBits:    bits,
+		Expiry:     time.Now().AddDate(1, 0, 0),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	return issued
+}
+
+func issuedCerts(issued *cert.Issued) []*x509.Certificate {
+	return append([]*x509.Certificate{issued.Cert}, issued.Chain...)
+}
+
+func checkSameKey(c *gc.C, got, want crypto.Signer) {
+	type equaler interface {
+		Equal(crypto.PrivateKey) bool
+	}
+	c.Assert(got, gc.NotNil)
+	c.Check(got.(equaler).Equal(want), jc.IsTrue)
+}
+
+func checkSameCerts(c *gc.C, got, want []*x509.Certificate) {
+	c.Assert(got, gc.HasLen, len(want))
+	for i := range got {
+		c.Check(got[i].Equal(want[i]), jc.IsTrue)
+	}
+}
+
+func (pkcs12Suite) TestRoundTrip(c *gc.C) {
+	for _, keyType := range []cert.KeyType{cert.RSA, cert.ECDSA, cert.Ed25519} {
+		for _, legacy := range []bool{false, true} {
+			c.Logf("key type %s, legacy %v", keyType, legacy)
+			issued := newTestIssued(c, keyType)
+			data, err := issued.PKCS12(cert.PKCS12Options{
+				Password: "secret",
+				Legacy:   legacy,
+			})
+			c.Assert(err, jc.ErrorIsNil)
+
+			key, certs, err := cert.DecodePKCS12(data, "secret")
+			c.Assert(err, jc.ErrorIsNil)
+			checkSameKey(c, key, issued.Key)
+			checkSameCerts(c, certs, issuedCerts(issued))
+		}
+	}
+}
+
+func (pkcs12Suite) TestLegacyReadableByOthers(c *gc.C) {
+	issued := newTestIssued(c, cert.RSA)
+	data, err := issued.PKCS12(cert.PKCS12Options{
+		Password: "secret",
+		Legacy:   true,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	blocks, err := pkcs12.ToPEM(data, "secret")
+	c.Assert(err, jc.ErrorIsNil)
+	var certs []*x509.Certificate
+	var key crypto.Signer
+	for _, block := range blocks {
+		switch block.Type {
+		case "CERTIFICATE":
+			xcert, err := x509.ParseCertificate(block.Bytes)
+			c.Assert(err, jc.ErrorIsNil)
+			certs = append(certs, xcert)
+		case "PRIVATE KEY":
+			// ToPEM converts RSA keys to PKCS #1.
+			key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+			c.Assert(err, jc.ErrorIsNil)
+		}
+	}
+	checkSameKey(c, key, issued.Key)
+	checkSameCerts(c, certs, issuedCerts(issued))
+}
+
+func (pkcs12Suite) TestEmptyPassword(c *gc.C) {
+	issued := newTestIssued(c, cert.ECDSA)
+	data, err := issued.PKCS12(cert.PKCS12Options{})
+	c.Assert(err, jc.ErrorIsNil)
+
+	key, certs, err := cert.DecodePKCS12(data, "")
+	c.Assert(err, jc.ErrorIsNil)
+	checkSameKey(c, key, issued.Key)
+	checkSameCerts(c, certs, issuedCerts(issued))
+}
+
+func (pkcs12Suite) TestIncorrectPassword(c *gc.C) {
+	issued := newTestIssued(c, cert.ECDSA)
+	for _, legacy := range []bool{false, true} {
+		data, err := issued.PKCS12(cert.PKCS12Options{
+			Password: "secret",
+			Legacy:   legacy,
+		})
+		c.Assert(err, jc.ErrorIsNil)
+
+		_, _, err = cert.DecodePKCS12(data, "wrong")
+		c.Check(errors.Cause(err), gc.Equals, cert.ErrIncorrectPassword)
+	}
+}
+
+func (pkcs12Suite) TestCertificatesOnly(c *gc.C) {
+	ca := newTestRootCA(c)
+	data, err := cert.EncodePKCS12(nil, []*x509.Certificate{ca.Cert}, cert.PKCS12Options{
+		Password: "secret",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	key, certs, err := cert.DecodePKCS12(data, "secret")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(key, gc.IsNil)
+	checkSameCerts(c, certs, []*x509.Certificate{ca.Cert})
+}
+
+func (pkcs12Suite) TestKeyWithoutCertificate(c *gc.C) {
+	issued := newTestIssued(c, cert.ECDSA)
+	_, err := cert.EncodePKCS12(issued.Key, nil, cert.PKCS12Options{})
+	c.Assert(err, gc.ErrorMatches, "key without certificate not valid")
+}
+
+func (pkcs12Suite) TestFriendlyNameAndIterations(c *gc.C) {
+	issued := newTestIssued(c, cert.RSA)
+	data, err := issued.PKCS12(cert.PKCS12Options{
+		Password:     "secret",
+		FriendlyName: "my server",
+		Iterations:   1,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	key, certs, err := cert.DecodePKCS12(data, "secret")
+	c.Assert(err, jc.ErrorIsNil)
+	checkSameKey(c, key, issued.Key)
+	checkSameCerts(c, certs, issuedCerts(issued))
+}
+
+func (pkcs12Suite) TestDecodeInvalid(c *gc.C) {
+	_, _, err := cert.DecodePKCS12([]byte("not a bundle"), "")
+	c.Assert(err, gc.ErrorMatches, "cannot parse PKCS #12 bundle: .*")
+}
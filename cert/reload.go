@@ -0,0 +1,297 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package cert
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/juju/clock"
+	"github.com/juju/errors"
+)
+
+// DefaultReloadInterval holds the default minimum interval between
+// checks for changed certificates made by a Reloader.
+const DefaultReloadInterval = 10 * time.Second
+
+// ReloaderParams holds the parameters for NewReloader.
+type ReloaderParams struct {
+	// CertFile and KeyFile hold the paths of the PEM-encoded
+	// certificate and private key. CertFile may also hold the
+	// certificates of any intermediate CAs, following the leaf.
+	CertFile string
+	KeyFile  string
+
+	// ClientCAFile optionally holds the path of a file of PEM-encoded
+	// CA certificates used to verify client certificates.
+	ClientCAFile string
+
+	// LoadCertificate, if set, is called to obtain the certificate
+	// instead of reading CertFile and KeyFile. It is called at most
+	// once every Interval.
+	LoadCertificate func() (*tls.Certificate, error)
+
+	// LoadClientCAs, if set, is called to obtain the client CA pool
+	// instead of reading ClientCAFile. It is called at most once
+	// every Interval.
+	LoadClientCAs func() (*x509.CertPool, error)
+
+	// Interval holds the minimum time between checks for a change of
+	// certificate. If it is zero, DefaultReloadInterval is used.
+	Interval time.Duration
+
+	// Clock is used to time checks. If it is nil,
+	// clock.WallClock is used.
+	Clock clock.Clock
+}
+
+// Reloader provides a TLS certificate and client CA pool that are
+// reloaded when they change, so that long-running servers and clients
+// pick up rotated certificates without being restarted.
+//
+// Changes are checked for lazily, when a certificate is needed for a
+// handshake, and files are only reread when their size or modification
+// time has changed. If reloading fails, the previous certificate
+// continues to be used and the error is returned by Err.
+type Reloader struct {
+	params ReloaderParams
+
+	mu        sync.Mutex
+	lastCheck time.Time
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	certStamp []fileStamp
+	caStamp   fileStamp
+	err       error
+}
+
+// NewReloader returns a Reloader that loads certificates as described
+// by the given parameters. The certificate, and the client CA pool if
+// configured, are loaded immediately, and an error is returned if that
+// fails.
+func NewReloader(p ReloaderParams) (*Reloader, error) {
+	if p.LoadCertificate == nil && (p.CertFile == "" || p.KeyFile == "") {
+		return nil, errors.NotValidf("reloader without certificate source")
+	}
+	if p.Interval == 0 {
+		p.Interval = DefaultReloadInterval
+	}
+	if p.Clock == nil {
+		p.Clock = clock.WallClock
+	}
+	r := &Reloader{params: p}
+	if err := r.Reload(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return r, nil
+}
+
+// Reload unconditionally reloads the certificate and client CA pool.
+// If this fails, the previously loaded values are retained.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastCheck = r.params.Clock.Now()
+	r.err = r.reload(true)
+	return r.err
+}
+
+// Err returns the error from the most recent attempt
+// to reload, or nil if it succeeded.
+func (r *Reloader) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Certificate returns the current certificate,
+// first reloading it if it has changed.
+func (r *Reloader) Certificate() *tls.Certificate {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.maybeReload()
+	return r.cert
+}
+
+// ClientCAs returns the current client CA pool, first
+// reloading it if it has changed. It returns nil if no
+// client CAs are configured.
+func (r *Reloader) ClientCAs() *x509.CertPool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.maybeReload()
+	return r.clientCAs
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.Certificate(), nil
+}
+
+// GetClientCertificate implements tls.Config.GetClientCertificate.
+func (r *Reloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.Certificate(), nil
+}
+
+// ServerConfig returns a copy of base, or of an empty config if base
+// is nil, that serves the reloaded certificate and, if client CAs are
+// configured, verifies client certificates against the reloaded pool.
+// Listeners using the config need not be restarted when certificates
+// are rotated.
+func (r *Reloader) ServerConfig(base *tls.Config) *tls.Config {
+	cfg := cloneConfig(base)
+	cfg.Certificates = nil
+	cfg.GetCertificate = r.GetCertificate
+	if !r.hasClientCAs() {
+		return cfg
+	}
+	if cfg.ClientAuth == tls.NoClientCert {
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		c := cfg.Clone()
+		c.GetConfigForClient = nil
+		c.ClientCAs = r.ClientCAs()
+		return c, nil
+	}
+	return cfg
+}
+
+// ClientConfig returns a copy of base, or of an empty config if base
+// is nil, that presents the reloaded certificate when the server asks
+// for one.
+func (r *Reloader) ClientConfig(base *tls.Config) *tls.Config {
+	cfg := cloneConfig(base)
+	cfg.Certificates = nil
+	cfg.GetClientCertificate = r.GetClientCertificate
+	return cfg
+}
+
+func cloneConfig(cfg *tls.Config) *tls.Config {
+	if cfg == nil {
+		return &tls.Config{}
+	}
+	return cfg.Clone()
+}
+
+func (r *Reloader) hasClientCAs() bool {
+	return r.params.ClientCAFile != "" || r.params.LoadClientCAs != nil
+}
+
+// maybeReload reloads the certificates if the check
+// interval has passed. It is called with r.mu held.
+func (r *Reloader) maybeReload() {
+	now := r.params.Clock.Now()
+	if now.Sub(r.lastCheck) < r.params.Interval {
+		return
+	}
+	r.lastCheck = now
+	r.err = r.reload(false)
+}
+
+// reload loads the certificate and client CAs. Unless force is true,
+// files are only read when they have changed since they were last
+// loaded. It is called with r.mu held.
+func (r *Reloader) reload(force bool) error {
+	var cert *tls.Certificate
+	var certStamp []fileStamp
+	if r.params.LoadCertificate != nil {
+		c, err := r.params.LoadCertificate()
+		if err != nil {
+			return errors.Annotate(err, "cannot load certificate")
+		}
+		cert = c
+	} else {
+		stamps, err := statFiles(r.params.CertFile, r.params.KeyFile)
+		if err != nil {
+			return errors.Annotate(err, "cannot load certificate")
+		}
+		if force || !sameStamps(stamps, r.certStamp) {
+			c, err := tls.LoadX509KeyPair(r.params.CertFile, r.params.KeyFile)
+			if err != nil {
+				return errors.Annotate(err, "cannot load certificate")
+			}
+			cert, certStamp = &c, stamps
+		}
+	}
+
+	var clientCAs *x509.CertPool
+	var caStamp fileStamp
+	switch {
+	case r.params.LoadClientCAs != nil:
+		pool, err := r.params.LoadClientCAs()
+		if err != nil {
+			return errors.Annotate(err, "cannot load client CAs")
+		}
+		clientCAs = pool
+	case r.params.ClientCAFile != "":
+		stamps, err := statFiles(r.params.ClientCAFile)
+		if err != nil {
+			return errors.Annotate(err, "cannot load client CAs")
+		}
+		if force || !stamps[0].equal(r.caStamp) {
+			data, err := ioutil.ReadFile(r.params.ClientCAFile)
+			if err != nil {
+				return errors.Annotate(err, "cannot load client CAs")
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(data) {
+				return errors.Errorf("cannot load client CAs: no certificates found in %q", r.params.ClientCAFile)
+			}
+			clientCAs, caStamp = pool, stamps[0]
+		}
+	}
+
+	// Only update once everything has loaded successfully,
+	// so that a half-rotated pair is never used.
+	if cert != nil {
+		r.cert = cert
+		if certStamp != nil {
+			r.certStamp = certStamp
+		}
+	}
+	if clientCAs != nil {
+		r.clientCAs = clientCAs
+		r.caStamp = caStamp
+	}
+	return nil
+}
+
+// fileStamp records enough about a file to tell when it has changed.
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+func (s fileStamp) equal(t fileStamp) bool {
+	return s.size == t.size && s.modTime.Equal(t.modTime)
+}
+
+func statFiles(paths ...string) ([]fileStamp, error) {
+	stamps := make([]fileStamp, len(paths))
+	for i, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		stamps[i] = fileStamp{size: info.Size(), modTime: info.ModTime()}
+	}
+	return stamps, nil
+}
+
+func sameStamps(a, b []fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,212 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package cert_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/juju/clock/testclock"
+	"github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/cert"
+)
+
+type reloadSuite struct {
+	root     *cert.CA
+	dir      string
+	certFile string
+	keyFile  string
+	caFile   string
+}
+
+var _ = gc.Suite(&reloadSuite{})
+
+func (s *reloadSuite) SetUpTest(c *gc.C) {
+	s.root = newTestRootCA(c)
+	s.dir = c.MkDir()
+	s.certFile = filepath.Join(s.dir, "cert.pem")
+	s.keyFile = filepath.Join(s.dir, "key.pem")
+	s.caFile = filepath.Join(s.dir, "ca.pem")
+	s.writeCA(c, s.root, time.Now())
+}
+
+// writeIssued issues a new certificate, writes it to the certificate
+// and key files with the given modification time, and returns it.
+func (s *reloadSuite) writeIssued(c *gc.C, commonName string, mtime time.Time) *cert.Issued {
+	issued, err := s.root.Issue(cert.LeafParams{
+		CommonName: commonName,
+		DNSNames:   []string{"localhost"},
+		Server:     true,
+		Expiry:     time.Now().AddDate(1, 0, 0),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	keyPEM, err := issued.KeyPEM()
+	c.Assert(err, jc.ErrorIsNil)
+	writeFile(c, s.certFile, issued.CertPEM(), mtime)
+	writeFile(c, s.keyFile, keyPEM, mtime)
+	return issued
+}
+
+func (s *reloadSuite) writeCA(c *gc.C, ca *cert.CA, mtime time.Time) {
+	writeFile(c, s.caFile, ca.CertPEM(), mtime)
+}
+
+func writeFile(c *gc.C, path, data string, mtime time.Time) {
+	err := ioutil.WriteFile(path, []byte(data), 0600)
+	c.Assert(err, jc.ErrorIsNil)
+	err = os.Chtimes(path, mtime, mtime)
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *reloadSuite) TestReloadFromFiles(c *gc.C) {
+	now := time.Now()
+	first := s.writeIssued(c, "first", now)
+	clock := testclock.NewClock(now)
+	r, err := cert.NewReloader(cert.ReloaderParams{
+		CertFile: s.certFile,
+		KeyFile:  s.keyFile,
+		Interval: time.Minute,
+		Clock:    clock,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(r.Certificate().Certificate[0], jc.DeepEquals, first.Cert.Raw)
+
+	second := s.writeIssued(c, "second", now.Add(time.Second))
+
+	// The files aren't checked again until the interval has passed.
+	c.Check(r.Certificate().Certificate[0], jc.DeepEquals, first.Cert.Raw)
+	clock.Advance(time.Minute)
+	c.Check(r.Certificate().Certificate[0], jc.DeepEquals, second.Cert.Raw)
+	c.Check(r.Err(), jc.ErrorIsNil)
+
+	// A broken key file leaves the previous certificate in place.
+	writeFile(c, s.keyFile, "rubbish", now.Add(2*time.Second))
+	clock.Advance(time.Minute)
+	c.Check(r.Certificate().Certificate[0], jc.DeepEquals, second.Cert.Raw)
+	c.Check(r.Err(), gc.ErrorMatches, "cannot load certificate: .*")
+
+	c.Check(r.Reload(), gc.ErrorMatches, "cannot load certificate: .*")
+}
+
+func (s *reloadSuite) TestReloadFromCallback(c *gc.C) {
+	clock := testclock.NewClock(time.Now())
+	var loaded *tls.Certificate
+	var loadErr error
+	calls := 0
+	r, err := cert.NewReloader(cert.ReloaderParams{
+		LoadCertificate: func() (*tls.Certificate, error) {
+			calls++
+			return loaded, loadErr
+		},
+		Interval: time.Minute,
+		Clock:    clock,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(calls, gc.Equals, 1)
+
+	loaded = &tls.Certificate{Certificate: [][]byte{[]byte("new")}}
+	r.Certificate()
+	c.Check(calls, gc.Equals, 1)
+	clock.Advance(time.Minute)
+	c.Check(r.Certificate(), gc.Equals, loaded)
+	c.Check(calls, gc.Equals, 2)
+
+	loadErr = errors.New("boom")
+	clock.Advance(time.Minute)
+	c.Check(r.Certificate(), gc.Equals, loaded)
+	c.Check(r.Err(), gc.ErrorMatches, "cannot load certificate: boom")
+}
+
+func (s *reloadSuite) TestNewReloaderErrors(c *gc.C) {
+	_, err := cert.NewReloader(cert.ReloaderParams{CertFile: s.certFile})
+	c.Check(err, gc.ErrorMatches, "reloader without certificate source not valid")
+
+	_, err = cert.NewReloader(cert.ReloaderParams{
+		CertFile: s.certFile,
+		KeyFile:  s.keyFile,
+	})
+	c.Check(err, gc.ErrorMatches, "cannot load certificate: .*")
+
+	s.writeIssued(c, "server", time.Now())
+	writeFile(c, s.caFile, "rubbish", time.Now())
+	_, err = cert.NewReloader(cert.ReloaderParams{
+		CertFile:     s.certFile,
+		KeyFile:      s.keyFile,
+		ClientCAFile: s.caFile,
+	})
+	c.Check(err, gc.ErrorMatches, `cannot load client CAs: no certificates found in ".*"`)
+}
+
+func (s *reloadSuite) TestServerConfigClientCAs(c *gc.C) {
+	now := time.Now()
+	s.writeIssued(c, "server", now)
+	clock := testclock.NewClock(now)
+	r, err := cert.NewReloader(cert.ReloaderParams{
+		CertFile:     s.certFile,
+		KeyFile:      s.keyFile,
+		ClientCAFile: s.caFile,
+		Interval:     time.Minute,
+		Clock:        clock,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(s.root.Cert)
+	clientCert, err := s.root.Issue(cert.LeafParams{
+		CommonName: "client",
+		Client:     true,
+		Expiry:     now.AddDate(1, 0, 0),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	c.Check(handshake(c, r.ServerConfig(nil), clientCert, roots), jc.ErrorIsNil)
+
+	// Replace the client CA with a different one, after which
+	// the client certificate is no longer accepted.
+	s.writeCA(c, newTestRootCA(c), now.Add(time.Second))
+	clock.Advance(time.Minute)
+	c.Check(handshake(c, r.ServerConfig(nil), clientCert, roots), gc.NotNil)
+}
+
+// handshake runs a TLS handshake over a pipe between a server using
+// serverConfig and a client presenting clientCert, returning the
+// server's error.
+func handshake(c *gc.C, serverConfig *tls.Config, clientCert *cert.Issued, roots *x509.CertPool) error {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+	done := make(chan error, 1)
+	go func() {
+		tlsCert := clientCert.TLSCertificate()
+		client := tls.Client(clientConn, &tls.Config{
+			ServerName:   "localhost",
+			RootCAs:      roots,
+			Certificates: []tls.Certificate{tlsCert},
+		})
+		err := client.Handshake()
+		if err == nil {
+			// Read so that the server's verdict on the client
+			// certificate is received under TLS 1.3.
+			_, err = client.Read(make([]byte, 1))
+		}
+		done <- err
+		clientConn.Close()
+	}()
+	server := tls.Server(serverConn, serverConfig)
+	err := server.Handshake()
+	if err == nil {
+		_, err = server.Write([]byte("x"))
+	}
+	serverConn.Close()
+	<-done
+	return err
+}
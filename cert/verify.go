@@ -0,0 +1,393 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package cert
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/juju/clock"
+	"github.com/juju/errors"
+)
+
+// VerifyParams holds the parameters for VerifyChain.
+type VerifyParams struct {
+	// Roots holds the trusted root CAs. If it is nil,
+	// the system roots are used.
+	Roots *x509.CertPool
+
+	// Intermediates holds any intermediate CA certificates
+	// available in addition to those in the chain.
+	Intermediates []*x509.Certificate
+
+	// DNSName, if not empty, holds the host name or IP address
+	// that the leaf certificate must be valid for.
+	DNSName string
+
+	// KeyUsages holds the extended key usages the leaf certificate
+	// must allow. If it is empty, server authentication is required.
+	KeyUsages []x509.ExtKeyUsage
+
+	// Clock is used to check certificate validity periods.
+	// If it is nil, clock.WallClock is used.
+	Clock clock.Clock
+}
+
+// ChainProblemReason identifies the kind of problem found with
+// a certificate in a chain.
+type ChainProblemReason string
+
+const (
+	// Expired means the certificate's validity period has ended.
+	Expired ChainProblemReason = "expired"
+
+	// NotYetValid means the certificate's validity period
+	// has not yet started.
+	NotYetValid ChainProblemReason = "not yet valid"
+
+	// NameMismatch means the leaf certificate is not valid
+	// for the requested name.
+	NameMismatch ChainProblemReason = "name mismatch"
+
+	// IncompatibleUsage means the leaf certificate may not be
+	// used for the requested purpose.
+	IncompatibleUsage ChainProblemReason = "incompatible usage"
+
+	// NotCA means a certificate that issued another
+	// is not marked as a CA.
+	NotCA ChainProblemReason = "not a CA"
+
+	// WeakSignature means the certificate is signed with an
+	// algorithm that is no longer accepted, such as SHA-1.
+	WeakSignature ChainProblemReason = "weak signature"
+
+	// BadSignature means the certificate's signature was not made
+	// by the certificate above it in the chain.
+	BadSignature ChainProblemReason = "bad signature"
+
+	// UnknownAuthority means the chain does not lead
+	// to a trusted root.
+	UnknownAuthority ChainProblemReason = "unknown authority"
+
+	// OtherProblem is used for any other reason
+	// that verification failed.
+	OtherProblem ChainProblemReason = "other"
+)
+
+// ChainProblem describes a problem with one link of a
+// certificate chain.
+type ChainProblem struct {
+	// Index holds the position of the certificate in the chain,
+	// starting at zero for the leaf.
+	Index int
+
+	// Cert holds the certificate with the problem.
+	Cert *x509.Certificate
+
+	// Reason identifies the kind of problem.
+	Reason ChainProblemReason
+
+	// Detail describes the problem.
+	Detail string
+}
+
+// String implements fmt.Stringer.
+func (p ChainProblem) String() string {
+	return fmt.Sprintf("certificate %d (%s): %s: %s", p.Index, certName(p.Cert), p.Reason, p.Detail)
+}
+
+// VerifyError is returned by VerifyChain when a chain cannot be
+// verified. It describes what is wrong with each link of the chain.
+type VerifyError struct {
+	// Chain holds the chain as far as it could be built,
+	// starting with the leaf.
+	Chain []*x509.Certificate
+
+	// Problems holds the problems found, in chain order.
+	Problems []ChainProblem
+
+	// Err holds the error returned by crypto/x509.
+	Err error
+}
+
+// Error implements error by describing the first problem found.
+func (e *VerifyError) Error() string {
+	msg := "certificate verification failed: " + e.Problems[0].String()
+	if n := len(e.Problems) - 1; n == 1 {
+		msg += " (and 1 more problem)"
+	} else if n > 1 {
+		msg += fmt.Sprintf(" (and %d more problems)", n)
+	}
+	return msg
+}
+
+// Unwrap returns the error returned by crypto/x509.
+func (e *VerifyError) Unwrap() error {
+	return e.Err
+}
+
+// Diagnosis returns a human-readable report of the chain, listing
+// each certificate with its issuer, validity period and problems.
+func (e *VerifyError) Diagnosis() string {
+	var buf strings.Builder
+	buf.WriteString("certificate chain verification failed:\n")
+	for i, cert := range e.Chain {
+		issuer := "self-signed"
+		if !isSelfIssued(cert) {
+			issuer = "issued by " + cert.Issuer.String()
+		}
+		fmt.Fprintf(&buf, "  [%d] %s (%s)\n", i, certName(cert), issuer)
+		fmt.Fprintf(&buf, "      valid from %s until %s\n",
+			cert.NotBefore.UTC().Format(time.RFC3339),
+			cert.NotAfter.UTC().Format(time.RFC3339),
+		)
+		for _, p := range e.Problems {
+			if p.Index == i {
+				fmt.Fprintf(&buf, "      %s: %s\n", p.Reason, p.Detail)
+			}
+		}
+	}
+	return buf.String()
+}
+
+// VerifyChain verifies a certificate chain, starting with the leaf and
+// followed by any intermediate CAs, returning the chains that lead
+// from it to a trusted root. If verification fails, the error is a
+// *VerifyError describing which certificates are at fault and why.
+func VerifyChain(certs []*x509.Certificate, p VerifyParams) ([][]*x509.Certificate, error) {
+	if len(certs) == 0 {
+		return nil, errors.NotValidf("empty certificate chain")
+	}
+	if p.Clock == nil {
+		p.Clock = clock.WallClock
+	}
+	if len(p.KeyUsages) == 0 {
+		p.KeyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	}
+	candidates := append(append([]*x509.Certificate(nil), certs[1:]...), p.Intermediates...)
+	intermediates := x509.NewCertPool()
+	for _, cert := range candidates {
+		intermediates.AddCert(cert)
+	}
+	now := p.Clock.Now()
+	chains, err := certs[0].Verify(x509.VerifyOptions{
+		DNSName:       p.DNSName,
+		Intermediates: intermediates,
+		Roots:         p.Roots,
+		CurrentTime:   now,
+		KeyUsages:     p.KeyUsages,
+	})
+	if err == nil {
+		return chains, nil
+	}
+	return nil, diagnoseChain(buildChain(certs[0], candidates), p, now, err)
+}
+
+// buildChain returns the chain from leaf formed by following issuers
+// among the candidates, stopping at a self-issued certificate or when
+// no issuer can be found.
+func buildChain(leaf *x509.Certificate, candidates []*x509.Certificate) []*x509.Certificate {
+	chain := []*x509.Certificate{leaf}
+	for cert := leaf; !isSelfIssued(cert) && len(chain) <= len(candidates); {
+		var issuer *x509.Certificate
+		for _, candidate := range candidates {
+			if !bytes.Equal(cert.RawIssuer, candidate.RawSubject) {
+				continue
+			}
+			// Prefer a candidate whose key made the signature,
+			// as several certificates may share a subject.
+			if issuer == nil || checkSignature(cert, candidate) == nil {
+				issuer = candidate
+			}
+		}
+		if issuer == nil {
+			break
+		}
+		chain = append(chain, issuer)
+		cert = issuer
+	}
+	return chain
+}
+
+// diagnoseChain returns a *VerifyError describing the problems found
+// with each link of chain, given the error returned by crypto/x509.
+func diagnoseChain(chain []*x509.Certificate, p VerifyParams, now time.Time, verifyErr error) error {
+	// The signature of a weakly signed certificate cannot be
+	// checked, so whether its issuer is trusted is unknown.
+	top := chain[len(chain)-1]
+	isTrusted := true
+	if isSelfIssued(top) || !isWeakSignatureAlgorithm(top.SignatureAlgorithm) {
+		var rest []*x509.Certificate
+		rest, isTrusted = trustedChain(top, p.Roots, now)
+		chain = append(chain, rest...)
+	}
+	e := &VerifyError{
+		Chain: chain,
+		Err:   verifyErr,
+	}
+	add := func(i int, reason ChainProblemReason, format string, args ...interface{}) {
+		e.Problems = append(e.Problems, ChainProblem{
+			Index:  i,
+			Cert:   chain[i],
+			Reason: reason,
+			Detail: fmt.Sprintf(format, args...),
+		})
+	}
+	for i, cert := range chain {
+		switch {
+		case now.After(cert.NotAfter):
+			add(i, Expired, "expired at %s (%s ago)",
+				cert.NotAfter.UTC().Format(time.RFC3339), now.Sub(cert.NotAfter).Round(time.Second))
+		case now.Before(cert.NotBefore):
+			add(i, NotYetValid, "not valid until %s (in %s)",
+				cert.NotBefore.UTC().Format(time.RFC3339), cert.NotBefore.Sub(now).Round(time.Second))
+		}
+		if i == 0 {
+			if p.DNSName != "" && cert.VerifyHostname(p.DNSName) != nil {
+				add(i, NameMismatch, "%s", nameMismatch(cert, p.DNSName))
+			}
+			if !allowsUsage(cert, p.KeyUsages) {
+				add(i, IncompatibleUsage, "extended key usage does not allow %s", usageNames(p.KeyUsages))
+			}
+		} else if !cert.BasicConstraintsValid || !cert.IsCA {
+			add(i, NotCA, "certificate is not marked as a CA but issued %q", certName(chain[i-1]))
+		}
+		selfSigned := isSelfIssued(cert) && i == len(chain)-1
+		if !selfSigned && isWeakSignatureAlgorithm(cert.SignatureAlgorithm) {
+			add(i, WeakSignature, "signed with %v, which is insecure", cert.SignatureAlgorithm)
+		} else if i+1 < len(chain) {
+			if err := checkSignature(cert, chain[i+1]); err != nil {
+				add(i, BadSignature, "signature not made by the key of %q: %v", certName(chain[i+1]), err)
+			}
+		}
+	}
+	if !isTrusted {
+		i := len(chain) - 1
+		switch {
+		case isSelfIssued(chain[i]):
+			add(i, UnknownAuthority, "self-signed certificate is not trusted")
+		case i == 0:
+			add(i, UnknownAuthority, "issuer %q not found among intermediates or trusted roots", chain[i].Issuer.String())
+		default:
+			add(i, UnknownAuthority, "issuer %q of the last certificate in the chain is not trusted", chain[i].Issuer.String())
+		}
+	}
+	if len(e.Problems) == 0 {
+		add(0, OtherProblem, "%v", verifyErr)
+	}
+	return e
+}
+
+// trustedChain reports whether cert is, or was issued by, one of the
+// given roots, ignoring validity periods, which are checked
+// separately. If cert was issued by a root, the root is returned.
+func trustedChain(cert *x509.Certificate, roots *x509.CertPool, now time.Time) ([]*x509.Certificate, bool) {
+	if now.After(cert.NotAfter) {
+		now = cert.NotAfter
+	} else if now.Before(cert.NotBefore) {
+		now = cert.NotBefore
+	}
+	chains, err := cert.Verify(x509.VerifyOptions{
+		Roots:       roots,
+		CurrentTime: now,
+		KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err == nil {
+		return chains[0][1:], true
+	}
+	_, unknown := err.(x509.UnknownAuthorityError)
+	return nil, !unknown
+}
+
+// checkSignature checks that cert was signed by the key of issuer.
+func checkSignature(cert, issuer *x509.Certificate) error {
+	return issuer.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature)
+}
+
+// nameMismatch describes why cert is not valid for name,
+// listing the names it is valid for.
+func nameMismatch(cert *x509.Certificate, name string) string {
+	var valid []string
+	valid = append(valid, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		valid = append(valid, ip.String())
+	}
+	if len(valid) == 0 {
+		msg := fmt.Sprintf("not valid for %q: certificate has no subject alternative names", name)
+		if cert.Subject.CommonName != "" {
+			msg += fmt.Sprintf(" and its common name %q is ignored", cert.Subject.CommonName)
+		}
+		return msg
+	}
+	kind := "name"
+	if net.ParseIP(name) != nil {
+		kind = "IP address"
+	}
+	return fmt.Sprintf("not valid for %s %q: certificate is valid for %s", kind, name, strings.Join(valid, ", "))
+}
+
+// allowsUsage reports whether cert allows any of the given
+// extended key usages.
+func allowsUsage(cert *x509.Certificate, usages []x509.ExtKeyUsage) bool {
+	if len(cert.ExtKeyUsage) == 0 && len(cert.UnknownExtKeyUsage) == 0 {
+		return true
+	}
+	for _, want := range usages {
+		if want == x509.ExtKeyUsageAny {
+			return true
+		}
+		for _, have := range cert.ExtKeyUsage {
+			if have == want || have == x509.ExtKeyUsageAny {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// usageNames describes the given extended key usages.
+func usageNames(usages []x509.ExtKeyUsage) string {
+	names := make([]string, len(usages))
+	for i, usage := range usages {
+		switch usage {
+		case x509.ExtKeyUsageServerAuth:
+			names[i] = "server authentication"
+		case x509.ExtKeyUsageClientAuth:
+			names[i] = "client authentication"
+		case x509.ExtKeyUsageCodeSigning:
+			names[i] = "code signing"
+		case x509.ExtKeyUsageEmailProtection:
+			names[i] = "email protection"
+		default:
+			names[i] = fmt.Sprintf("usage %d", usage)
+		}
+	}
+	return strings.Join(names, " or ")
+}
+
+// isWeakSignatureAlgorithm reports whether crypto/x509
+// rejects signatures made with alg.
+func isWeakSignatureAlgorithm(alg x509.SignatureAlgorithm) bool {
+	switch alg {
+	case x509.MD2WithRSA, x509.MD5WithRSA, x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1:
+		return true
+	}
+	return false
+}
+
+func isSelfIssued(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject)
+}
+
+// certName returns a short name for cert.
+func certName(cert *x509.Certificate) string {
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+	return cert.Subject.String()
+}
@@ -0,0 +1,301 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package cert_test
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/juju/clock/testclock"
+	"github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/cert"
+)
+
+type verifySuite struct{}
+
+var _ = gc.Suite(verifySuite{})
+
+// verifyFixture holds a root CA, an intermediate CA
+// and a leaf certificate issued by the intermediate.
+type verifyFixture struct {
+	root         *cert.CA
+	intermediate *cert.CA
+	leaf         *cert.Issued
+	roots        *x509.CertPool
+}
+
+func newVerifyFixture(c *gc.C) verifyFixture {
+	root := newTestRootCA(c)
+	intermediate, err := root.NewIntermediate(cert.CAParams{
+		CommonName: "test intermediate",
+		KeyType:    cert.ECDSA,
+		Expiry:     time.Now().AddDate(5, 0, 0),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	leaf, err := intermediate.Issue(cert.LeafParams{
+		CommonName:  "test leaf",
+		DNSNames:    []string{"example.com", "*.example.com"},
+		IPAddresses: []net.IP{net.ParseIP("10.0.0.1")},
+		Server:      true,
+		KeyType:     cert.ECDSA,
+		Expiry:      time.Now().AddDate(1, 0, 0),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	roots := x509.NewCertPool()
+	roots.AddCert(root.Cert)
+	return verifyFixture{
+		root:         root,
+		intermediate: intermediate,
+		leaf:         leaf,
+		roots:        roots,
+	}
+}
+
+func (f verifyFixture) chain() []*x509.Certificate {
+	return []*x509.Certificate{f.leaf.Cert, f.intermediate.Cert}
+}
+
+// signCert creates a certificate from template, issued by parent.
+func signCert(c *gc.C, template, parent *x509.Certificate, pub crypto.PublicKey, key crypto.Signer) *x509.Certificate {
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, key)
+	c.Assert(err, jc.ErrorIsNil)
+	xcert, err := x509.ParseCertificate(der)
+	c.Assert(err, jc.ErrorIsNil)
+	return xcert
+}
+
+func checkProblems(c *gc.C, err error, want []cert.ChainProblemReason) *cert.VerifyError {
+	verifyErr, ok := err.(*cert.VerifyError)
+	c.Assert(ok, jc.IsTrue, gc.Commentf("unexpected error %#v", err))
+	var reasons []cert.ChainProblemReason
+	for _, p := range verifyErr.Problems {
+		reasons = append(reasons, p.Reason)
+	}
+	c.Check(reasons, jc.DeepEquals, want)
+	return verifyErr
+}
+
+func (verifySuite) TestValid(c *gc.C) {
+	f := newVerifyFixture(c)
+	chains, err := cert.VerifyChain(f.chain(), cert.VerifyParams{
+		Roots:   f.roots,
+		DNSName: "www.example.com",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(chains, gc.HasLen, 1)
+	checkSameCerts(c, chains[0], []*x509.Certificate{f.leaf.Cert, f.intermediate.Cert, f.root.Cert})
+}
+
+func (verifySuite) TestIntermediatesFromParams(c *gc.C) {
+	f := newVerifyFixture(c)
+	_, err := cert.VerifyChain([]*x509.Certificate{f.leaf.Cert}, cert.VerifyParams{
+		Roots:         f.roots,
+		Intermediates: []*x509.Certificate{f.intermediate.Cert},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (verifySuite) TestEmptyChain(c *gc.C) {
+	_, err := cert.VerifyChain(nil, cert.VerifyParams{})
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+}
+
+func (verifySuite) TestExpired(c *gc.C) {
+	f := newVerifyFixture(c)
+	clock := testclock.NewClock(time.Now().AddDate(2, 0, 0))
+	_, err := cert.VerifyChain(f.chain(), cert.VerifyParams{
+		Roots: f.roots,
+		Clock: clock,
+	})
+	verifyErr := checkProblems(c, err, []cert.ChainProblemReason{cert.Expired})
+	c.Check(verifyErr.Problems[0].Index, gc.Equals, 0)
+	c.Check(verifyErr.Problems[0].Cert, gc.Equals, f.leaf.Cert)
+	c.Check(err, gc.ErrorMatches, `certificate verification failed: certificate 0 \(test leaf\): expired: expired at .* ago\)`)
+	c.Check(verifyErr.Err, gc.FitsTypeOf, x509.CertificateInvalidError{})
+}
+
+func (verifySuite) TestNotYetValid(c *gc.C) {
+	f := newVerifyFixture(c)
+	clock := testclock.NewClock(time.Now().AddDate(0, 0, -30))
+	_, err := cert.VerifyChain(f.chain(), cert.VerifyParams{
+		Roots: f.roots,
+		Clock: clock,
+	})
+	verifyErr := checkProblems(c, err, []cert.ChainProblemReason{cert.NotYetValid, cert.NotYetValid, cert.NotYetValid})
+	c.Check(err, gc.ErrorMatches, `.*: not yet valid: not valid until .* \(and 2 more problems\)`)
+	c.Check(verifyErr.Problems[2].Cert, gc.Equals, f.root.Cert)
+}
+
+func (verifySuite) TestNameMismatch(c *gc.C) {
+	f := newVerifyFixture(c)
+	_, err := cert.VerifyChain(f.chain(), cert.VerifyParams{
+		Roots:   f.roots,
+		DNSName: "example.org",
+	})
+	verifyErr := checkProblems(c, err, []cert.ChainProblemReason{cert.NameMismatch})
+	c.Check(verifyErr.Problems[0].Detail, gc.Equals,
+		`not valid for name "example.org": certificate is valid for example.com, *.example.com, 10.0.0.1`)
+
+	_, err = cert.VerifyChain(f.chain(), cert.VerifyParams{
+		Roots:   f.roots,
+		DNSName: "10.0.0.2",
+	})
+	verifyErr = checkProblems(c, err, []cert.ChainProblemReason{cert.NameMismatch})
+	c.Check(verifyErr.Problems[0].Detail, gc.Matches, `not valid for IP address "10.0.0.2": .*`)
+}
+
+func (verifySuite) TestNoSubjectAltNames(c *gc.C) {
+	root := newTestRootCA(c)
+	leaf, err := root.Issue(cert.LeafParams{
+		CommonName: "example.com",
+		Server:     true,
+		Expiry:     time.Now().AddDate(1, 0, 0),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	roots := x509.NewCertPool()
+	roots.AddCert(root.Cert)
+	_, err = cert.VerifyChain([]*x509.Certificate{leaf.Cert}, cert.VerifyParams{
+		Roots:   roots,
+		DNSName: "example.com",
+	})
+	verifyErr := checkProblems(c, err, []cert.ChainProblemReason{cert.NameMismatch})
+	c.Check(verifyErr.Problems[0].Detail, gc.Equals,
+		`not valid for "example.com": certificate has no subject alternative names and its common name "example.com" is ignored`)
+}
+
+func (verifySuite) TestIncompatibleUsage(c *gc.C) {
+	f := newVerifyFixture(c)
+	_, err := cert.VerifyChain(f.chain(), cert.VerifyParams{
+		Roots:     f.roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	verifyErr := checkProblems(c, err, []cert.ChainProblemReason{cert.IncompatibleUsage})
+	c.Check(verifyErr.Problems[0].Detail, gc.Equals, "extended key usage does not allow client authentication")
+}
+
+func (verifySuite) TestUnknownAuthority(c *gc.C) {
+	f := newVerifyFixture(c)
+	other := x509.NewCertPool()
+	other.AddCert(newTestRootCA(c).Cert)
+
+	// Without the intermediate, its issuer cannot be found.
+	_, err := cert.VerifyChain([]*x509.Certificate{f.leaf.Cert}, cert.VerifyParams{
+		Roots: other,
+	})
+	verifyErr := checkProblems(c, err, []cert.ChainProblemReason{cert.UnknownAuthority})
+	c.Check(verifyErr.Problems[0].Detail, gc.Equals, `issuer "CN=test intermediate" not found among intermediates or trusted roots`)
+
+	// The intermediate is not issued by a trusted root.
+	_, err = cert.VerifyChain(f.chain(), cert.VerifyParams{
+		Roots: other,
+	})
+	verifyErr = checkProblems(c, err, []cert.ChainProblemReason{cert.UnknownAuthority})
+	c.Check(verifyErr.Problems[0].Index, gc.Equals, 1)
+	c.Check(verifyErr.Problems[0].Detail, gc.Equals, `issuer "CN=test root,O=juju" of the last certificate in the chain is not trusted`)
+
+	// The root is included in the chain but is not trusted.
+	_, err = cert.VerifyChain(append(f.chain(), f.root.Cert), cert.VerifyParams{
+		Roots: other,
+	})
+	verifyErr = checkProblems(c, err, []cert.ChainProblemReason{cert.UnknownAuthority})
+	c.Check(verifyErr.Problems[0].Index, gc.Equals, 2)
+	c.Check(verifyErr.Problems[0].Detail, gc.Equals, "self-signed certificate is not trusted")
+}
+
+func (verifySuite) TestNotCA(c *gc.C) {
+	f := newVerifyFixture(c)
+	key, err := cert.NewPrivateKey(cert.ECDSA, 0)
+	c.Assert(err, jc.ErrorIsNil)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "issued by leaf"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"example.net"},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	xcert := signCert(c, template, f.leaf.Cert, key.Public(), f.leaf.Key)
+	_, err = cert.VerifyChain(append([]*x509.Certificate{xcert}, f.chain()...), cert.VerifyParams{
+		Roots: f.roots,
+	})
+	verifyErr := checkProblems(c, err, []cert.ChainProblemReason{cert.NotCA})
+	c.Check(verifyErr.Problems[0].Index, gc.Equals, 1)
+	c.Check(verifyErr.Problems[0].Detail, gc.Equals, `certificate is not marked as a CA but issued "issued by leaf"`)
+}
+
+func (verifySuite) TestBadSignature(c *gc.C) {
+	f := newVerifyFixture(c)
+	// Make a CA with the same name as the intermediate but a
+	// different key, and present it in place of the real one.
+	impostor, err := f.root.NewIntermediate(cert.CAParams{
+		CommonName: "test intermediate",
+		KeyType:    cert.ECDSA,
+		Expiry:     time.Now().AddDate(5, 0, 0),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = cert.VerifyChain([]*x509.Certificate{f.leaf.Cert, impostor.Cert}, cert.VerifyParams{
+		Roots: f.roots,
+	})
+	verifyErr := checkProblems(c, err, []cert.ChainProblemReason{cert.BadSignature})
+	c.Check(verifyErr.Problems[0].Index, gc.Equals, 0)
+	c.Check(verifyErr.Problems[0].Detail, gc.Matches, `signature not made by the key of "test intermediate": .*`)
+}
+
+func (verifySuite) TestWeakSignature(c *gc.C) {
+	root, err := cert.NewRootCA(cert.CAParams{
+		CommonName: "test root",
+		KeyType:    cert.RSA,
+		KeyBits:    1024,
+		Expiry:     time.Now().AddDate(1, 0, 0),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	key, err := cert.NewPrivateKey(cert.ECDSA, 0)
+	c.Assert(err, jc.ErrorIsNil)
+	template := &x509.Certificate{
+		SerialNumber:       big.NewInt(1),
+		Subject:            pkix.Name{CommonName: "sha1 leaf"},
+		NotBefore:          time.Now().Add(-time.Hour),
+		NotAfter:           time.Now().Add(time.Hour),
+		ExtKeyUsage:        []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		SignatureAlgorithm: x509.SHA1WithRSA,
+	}
+	xcert := signCert(c, template, root.Cert, key.Public(), root.Key)
+	roots := x509.NewCertPool()
+	roots.AddCert(root.Cert)
+	_, err = cert.VerifyChain([]*x509.Certificate{xcert}, cert.VerifyParams{
+		Roots: roots,
+	})
+	verifyErr := checkProblems(c, err, []cert.ChainProblemReason{cert.WeakSignature})
+	c.Check(verifyErr.Problems[0].Detail, gc.Equals, "signed with SHA1-RSA, which is insecure")
+}
+
+func (verifySuite) TestDiagnosis(c *gc.C) {
+	f := newVerifyFixture(c)
+	clock := testclock.NewClock(f.leaf.Cert.NotAfter.Add(time.Hour))
+	_, err := cert.VerifyChain(f.chain(), cert.VerifyParams{
+		Roots:   f.roots,
+		DNSName: "example.org",
+		Clock:   clock,
+	})
+	c.Assert(err, gc.FitsTypeOf, (*cert.VerifyError)(nil))
+	diagnosis := err.(*cert.VerifyError).Diagnosis()
+	c.Check(diagnosis, gc.Matches, `certificate chain verification failed:
+  \[0\] test leaf \(issued by CN=test intermediate\)
+      valid from .* until .*
+      expired: expired at .* \(1h0m0s ago\)
+      name mismatch: not valid for name "example.org": .*
+  \[1\] test intermediate \(issued by CN=test root,O=juju\)
+      valid from .* until .*
+  \[2\] test root \(self-signed\)
+      valid from .* until .*
+`)
+}
@@ -0,0 +1,206 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package compression detects the compression format of data from its
+// leading bytes and decompresses it transparently, so that code that
+// downloads or unpacks files can accept them compressed or not:
+//
+//	r, format, err := compression.NewReader(resp.Body)
+//	if err != nil {
+//		return errors.Trace(err)
+//	}
+//	defer r.Close()
+//	logger.Debugf("reading %s data", format)
+//
+// Gzip and bzip2 are decompressed natively. Xz and zstd are
+// decompressed by running the xz and zstd commands, unless other
+// decompressors are registered for them with Register.
+package compression
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/juju/errors"
+)
+
+// Format identifies a compression format.
+type Format string
+
+// The formats that are detected.
+const (
+	None  Format = "none"
+	Gzip  Format = "gzip"
+	Bzip2 Format = "bzip2"
+	Xz    Format = "xz"
+	Zstd  Format = "zstd"
+)
+
+// magic holds the leading bytes that identify each format.
+var magic = []struct {
+	format Format
+	prefix []byte
+}{
+	{Gzip, []byte{0x1f, 0x8b}},
+	{Bzip2, []byte("BZh")},
+	{Xz, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+	{Zstd, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+}
+
+// maxMagicLen holds the length of the longest magic prefix.
+const maxMagicLen = 6
+
+// Detect returns the format of data that starts with the given
+// bytes, or None if it is not compressed in a known format. Six
+// bytes are enough to detect any format.
+func Detect(header []byte) Format {
+	for _, m := range magic {
+		if !bytes.HasPrefix(header, m.prefix) {
+			continue
+		}
+		if m.format == Bzip2 && (len(header) < 4 || header[3] < '1' || header[3] > '9') {
+			// The block size must follow the magic.
+			continue
+		}
+		return m.format
+	}
+	return None
+}
+
+// Decompressor returns a reader that decompresses the data read from r.
+type Decompressor func(r io.Reader) (io.ReadCloser, error)
+
+var (
+	decompressorsMu sync.Mutex
+	decompressors   = map[Format]Decompressor{
+		Gzip: func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+		Bzip2: func(r io.Reader) (io.ReadCloser, error) {
+			return ioutil.NopCloser(bzip2.NewReader(r)), nil
+		},
+		Xz: func(r io.Reader) (io.ReadCloser, error) {
+			return commandReader(r, "xz", "--decompress", "--stdout")
+		},
+		Zstd: func(r io.Reader) (io.ReadCloser, error) {
+			return commandReader(r, "zstd", "--decompress", "--stdout", "--quiet")
+		},
+	}
+)
+
+// Register sets the decompressor used for the given format, replacing
+// the default one. It may be used to decompress xz or zstd data without
+// running a command.
+func Register(format Format, d Decompressor) {
+	decompressorsMu.Lock()
+	defer decompressorsMu.Unlock()
+	decompressors[format] = d
+}
+
+// NewReader detects the compression format of the data read from r,
+// and returns a reader that reads the data decompressed, along with the
+// format detected. If the data is not compressed in a known format, the
+// returned reader reads it unchanged and the format is None. The reader
+// must be closed after use.
+//
+// If the format is detected but cannot be decompressed, because the
+// command needed is not installed, the error satisfies
+// errors.IsNotSupported.
+func NewReader(r io.Reader) (io.ReadCloser, Format, error) {
+	br := bufio.NewReader(r)
+	// A short read just means the data is short.
+	header, _ := br.Peek(maxMagicLen)
+	format := Detect(header)
+	if format == None {
+		return ioutil.NopCloser(br), None, nil
+	}
+	decompressorsMu.Lock()
+	d := decompressors[format]
+	decompressorsMu.Unlock()
+	rc, err := d(br)
+	if err != nil {
+		return nil, format, errors.Annotatef(err, "cannot decompress %s data", format)
+	}
+	return rc, format, nil
+}
+
+// lookPath is used to find the commands that decompress data.
+// It is a variable so that tests can replace it.
+var lookPath = exec.LookPath
+
+// commandReader returns a reader that reads the output of a
+// command that is given the data read from r as its input.
+func commandReader(r io.Reader, name string, args ...string) (io.ReadCloser, error) {
+	path, err := lookPath(name)
+	if err != nil {
+		return nil, errors.NotSupportedf("decompression without %q command", name)
+	}
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = r
+	cr := &cmdReader{cmd: cmd}
+	cmd.Stderr = &cr.stderr
+	if cr.stdout, err = cmd.StdoutPipe(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return cr, nil
+}
+
+// cmdReader reads the output of a command.
+type cmdReader struct {
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	stderr bytes.Buffer
+	done   bool
+	err    error
+}
+
+// Read implements io.Reader. When the output ends, it waits for the
+// command to exit and returns any error it failed with.
+func (r *cmdReader) Read(p []byte) (int, error) {
+	if r.done {
+		return 0, r.err
+	}
+	n, err := r.stdout.Read(p)
+	if err == io.EOF {
+		r.wait()
+		err = r.err
+	}
+	return n, err
+}
+
+// wait waits for the command to exit and records the result.
+func (r *cmdReader) wait() {
+	r.done = true
+	r.err = io.EOF
+	if err := r.cmd.Wait(); err != nil {
+		msg := strings.TrimSpace(r.stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		r.err = errors.Errorf("%s: %s", r.cmd.Args[0], msg)
+	}
+}
+
+// Close implements io.Closer, killing the command
+// if all of its output has not been read.
+func (r *cmdReader) Close() error {
+	if r.done {
+		return nil
+	}
+	r.done = true
+	r.err = errors.New("read from closed reader")
+	r.stdout.Close()
+	r.cmd.Process.Kill()
+	r.cmd.Wait()
+	return nil
+}
@@ -0,0 +1,178 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package compression_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/compression"
+)
+
+type compressionSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&compressionSuite{})
+
+// path holds the PATH the tests were run with, which the
+// isolation suite clears, so that the xz and zstd commands
+// can be found.
+var path = os.Getenv("PATH")
+
+func (s *compressionSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.PatchEnvironment("PATH", path)
+}
+
+// bzip2Hello holds "hello, world\n" compressed with bzip2.
+var bzip2Hello = []byte{
+	0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0x54, 0xa4, 0x97, 0x84, 0x00, 0x00,
+	0x02, 0xd1, 0x80, 0x00, 0x10, 0x40, 0x04, 0x06, 0x44, 0x90, 0x80, 0x20, 0x00, 0x31, 0x00, 0x30,
+	0x20, 0x68, 0x62, 0x00, 0x49, 0xd4, 0xb2, 0x1f, 0x3f, 0x17, 0x72, 0x45, 0x38, 0x50, 0x90, 0x54,
+	0xa4, 0x97, 0x84,
+}
+
+func gzipData(c *gc.C, data string) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := io.WriteString(w, data)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(w.Close(), jc.ErrorIsNil)
+	return buf.Bytes()
+}
+
+// compressWith compresses data by running the named command,
+// skipping the test if it is not installed.
+func compressWith(c *gc.C, name, data string) []byte {
+	if _, err := exec.LookPath(name); err != nil {
+		c.Skip(name + " not installed")
+	}
+	cmd := exec.Command(name, "--compress", "--stdout")
+	cmd.Stdin = strings.NewReader(data)
+	out, err := cmd.Output()
+	c.Assert(err, jc.ErrorIsNil)
+	return out
+}
+
+func readAll(c *gc.C, data []byte) (string, compression.Format) {
+	r, format, err := compression.NewReader(bytes.NewReader(data))
+	c.Assert(err, jc.ErrorIsNil)
+	defer r.Close()
+	out, err := ioutil.ReadAll(r)
+	c.Assert(err, jc.ErrorIsNil)
+	return string(out), format
+}
+
+func (*compressionSuite) TestDetect(c *gc.C) {
+	tests := []struct {
+		header []byte
+		expect compression.Format
+	}{
+		{nil, compression.None},
+		{[]byte("hello"), compression.None},
+		{[]byte{0x1f}, compression.None},
+		{[]byte{0x1f, 0x8b, 0x08}, compression.Gzip},
+		{[]byte("BZh9"), compression.Bzip2},
+		{[]byte("BZh"), compression.None},
+		{[]byte("BZhello"), compression.None},
+		{[]byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, compression.Xz},
+		{[]byte{0xfd, '7', 'z', 'X', 'Z'}, compression.None},
+		{[]byte{0x28, 0xb5, 0x2f, 0xfd, 0x04}, compression.Zstd},
+	}
+	for i, test := range tests {
+		c.Logf("test %d: %x", i, test.header)
+		c.Check(compression.Detect(test.header), gc.Equals, test.expect)
+	}
+}
+
+func (*compressionSuite) TestNewReaderUncompressed(c *gc.C) {
+	for _, data := range []string{"", "h", "hello, world\n"} {
+		out, format := readAll(c, []byte(data))
+		c.Check(format, gc.Equals, compression.None)
+		c.Check(out, gc.Equals, data)
+	}
+}
+
+func (*compressionSuite) TestNewReaderGzip(c *gc.C) {
+	out, format := readAll(c, gzipData(c, "hello, world\n"))
+	c.Assert(format, gc.Equals, compression.Gzip)
+	c.Assert(out, gc.Equals, "hello, world\n")
+}
+
+func (*compressionSuite) TestNewReaderBzip2(c *gc.C) {
+	out, format := readAll(c, bzip2Hello)
+	c.Assert(format, gc.Equals, compression.Bzip2)
+	c.Assert(out, gc.Equals, "hello, world\n")
+}
+
+func (*compressionSuite) TestNewReaderXz(c *gc.C) {
+	data := strings.Repeat("hello, world\n", 10000)
+	out, format := readAll(c, compressWith(c, "xz", data))
+	c.Assert(format, gc.Equals, compression.Xz)
+	c.Assert(out, gc.Equals, data)
+}
+
+func (*compressionSuite) TestNewReaderZstd(c *gc.C) {
+	data := strings.Repeat("hello, world\n", 10000)
+	out, format := readAll(c, compressWith(c, "zstd", data))
+	c.Assert(format, gc.Equals, compression.Zstd)
+	c.Assert(out, gc.Equals, data)
+}
+
+func (*compressionSuite) TestNewReaderCorrupt(c *gc.C) {
+	data := compressWith(c, "xz", "hello, world\n")
+	data = data[:len(data)-8]
+	r, format, err := compression.NewReader(bytes.NewReader(data))
+	c.Assert(err, jc.ErrorIsNil)
+	defer r.Close()
+	c.Assert(format, gc.Equals, compression.Xz)
+	_, err = ioutil.ReadAll(r)
+	c.Assert(err, gc.ErrorMatches, `.*xz: .*`)
+}
+
+func (*compressionSuite) TestCloseBeforeEnd(c *gc.C) {
+	data := compressWith(c, "zstd", strings.Repeat("hello, world\n", 100000))
+	r, _, err := compression.NewReader(bytes.NewReader(data))
+	c.Assert(err, jc.ErrorIsNil)
+	buf := make([]byte, 10)
+	_, err = io.ReadFull(r, buf)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(buf), gc.Equals, "hello, wor")
+	c.Assert(r.Close(), jc.ErrorIsNil)
+	_, err = r.Read(buf)
+	c.Assert(err, gc.ErrorMatches, "read from closed reader")
+}
+
+func (s *compressionSuite) TestCommandNotFound(c *gc.C) {
+	s.PatchValue(compression.LookPath, func(name string) (string, error) {
+		return "", exec.ErrNotFound
+	})
+	data := []byte{0xfd, '7', 'z', 'X', 'Z', 0x00, 0x00}
+	_, format, err := compression.NewReader(bytes.NewReader(data))
+	c.Assert(err, jc.Satisfies, errors.IsNotSupported)
+	c.Assert(err, gc.ErrorMatches, `cannot decompress xz data: decompression without "xz" command not supported`)
+	c.Assert(format, gc.Equals, compression.Xz)
+}
+
+func (s *compressionSuite) TestRegister(c *gc.C) {
+	orig := compression.CurrentDecompressor(compression.Zstd)
+	defer compression.Register(compression.Zstd, orig)
+	compression.Register(compression.Zstd, func(r io.Reader) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader("decompressed")), nil
+	})
+	out, format := readAll(c, []byte{0x28, 0xb5, 0x2f, 0xfd})
+	c.Assert(format, gc.Equals, compression.Zstd)
+	c.Assert(out, gc.Equals, "decompressed")
+}
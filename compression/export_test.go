@@ -0,0 +1,12 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package compression
+
+var LookPath = &lookPath
+
+func CurrentDecompressor(format Format) Decompressor {
+	decompressorsMu.Lock()
+	defer decompressorsMu.Unlock()
+	return decompressors[format]
+}
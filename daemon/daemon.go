@@ -0,0 +1,185 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package daemon helps small helper programs run in the background:
+// Acquire ensures that only one instance of a named program runs on
+// a machine, and Detach puts a program into the background on Unix.
+//
+// A typical daemon starts like this:
+//
+//	child, err := daemon.Detach(daemon.DetachConfig{})
+//	if err != nil {
+//		return err
+//	}
+//	if child != nil {
+//		// The daemon is running in the background.
+//		return nil
+//	}
+//	lock, err := daemon.Acquire("myhelper")
+//	if daemon.IsAlreadyRunning(err) {
+//		return nil
+//	}
+//	if err != nil {
+//		return err
+//	}
+//	defer lock.Release()
+package daemon
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+
+	"github.com/juju/utils/v3/process"
+)
+
+// AlreadyRunningError is returned by Acquire when another
+// instance of the program holds the lock.
+type AlreadyRunningError struct {
+	// Path holds the path of the lock file.
+	Path string
+
+	// PID holds the ID of the process holding the lock, or
+	// zero if it cannot be determined.
+	PID int
+}
+
+// Error implements error.
+func (e *AlreadyRunningError) Error() string {
+	if e.PID == 0 {
+		return fmt.Sprintf("already running (lock %s held)", e.Path)
+	}
+	return fmt.Sprintf("already running with pid %d", e.PID)
+}
+
+// IsAlreadyRunning reports whether the cause of err
+// is an *AlreadyRunningError.
+func IsAlreadyRunning(err error) bool {
+	_, ok := errors.Cause(err).(*AlreadyRunningError)
+	return ok
+}
+
+// errLocked is returned by lockFile when
+// another process holds the lock.
+var errLocked = errors.New("file locked")
+
+// Lock is held by the only running instance of a program.
+type Lock struct {
+	path string
+	file *os.File
+}
+
+// runtimeDir returns the directory holding the lock files
+// used by Acquire. It is a variable so that tests can replace it.
+var runtimeDir = defaultRuntimeDir
+
+// Acquire acquires the lock for the program with the given name,
+// using a lock file in the runtime directory: /run for root on Unix,
+// otherwise $XDG_RUNTIME_DIR if it is set to a directory owned by the
+// current user, falling back to the system's temporary directory. On
+// Windows, the temporary directory belongs to the current user, so
+// only one instance runs per user. See AcquireFile.
+func Acquire(name string) (*Lock, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return nil, errors.NotValidf("program name %q", name)
+	}
+	return AcquireFile(filepath.Join(runtimeDir(), name+".pid"))
+}
+
+// AcquireFile acquires the lock held in the file at path, which it
+// creates if needed, and writes the current process ID to it. The
+// lock is held until Release is called or the process exits, so a
+// program that dies cannot leave a stale lock behind. If another
+// process holds the lock, AcquireFile returns an
+// *AlreadyRunningError holding the ID of that process, if it is
+// still alive.
+//
+// The lock file must be a regular file owned by the current user; in
+// particular, a symbolic link is never followed, so that a lock file
+// in a shared directory cannot be used to overwrite another file.
+func AcquireFile(path string) (*Lock, error) {
+	for {
+		f, err := openLockFile(path)
+		if err != nil {
+			return nil, errors.Annotatef(err, "cannot open %q", path)
+		}
+		err = lockFile(f)
+		if err == errLocked {
+			f.Close()
+			return nil, &AlreadyRunningError{Path: path, PID: livePID(path)}
+		}
+		if err != nil {
+			f.Close()
+			return nil, errors.Annotatef(err, "cannot lock %q", path)
+		}
+		// The file may have been removed by the previous holder
+		// of the lock after it was opened, in which case locking
+		// it achieves nothing.
+		if !stillAt(f, path) {
+			f.Close()
+			continue
+		}
+		if err := writePID(f); err != nil {
+			f.Close()
+			return nil, errors.Annotatef(err, "cannot write %q", path)
+		}
+		return &Lock{path: path, file: f}, nil
+	}
+}
+
+// Path returns the path of the lock file.
+func (l *Lock) Path() string {
+	return l.path
+}
+
+// Release releases the lock.
+func (l *Lock) Release() error {
+	if err := releaseFile(l.file, l.path); err != nil {
+		return errors.Annotatef(err, "cannot release %q", l.path)
+	}
+	return nil
+}
+
+// stillAt reports whether f is the file at path.
+func stillAt(f *os.File, path string) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	pathInfo, err := os.Lstat(path)
+	return err == nil && os.SameFile(fi, pathInfo)
+}
+
+func writePID(f *os.File) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// livePID returns the process ID in the lock file at path if that
+// process is still running, or zero otherwise. The lock may be held
+// by some other process, such as one to which the lock file was
+// passed while starting, so the ID may be stale.
+func livePID(path string) int {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0
+	}
+	if _, err := process.Find(pid); err != nil {
+		return 0
+	}
+	return pid
+}
@@ -0,0 +1,136 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package daemon_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/daemon"
+)
+
+type lockSuite struct {
+	testing.IsolationSuite
+	path string
+}
+
+var _ = gc.Suite(&lockSuite{})
+
+func (s *lockSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.path = filepath.Join(c.MkDir(), "helper.pid")
+}
+
+func (s *lockSuite) TestAcquireFile(c *gc.C) {
+	lock, err := daemon.AcquireFile(s.path)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(lock.Path(), gc.Equals, s.path)
+	data, err := ioutil.ReadFile(s.path)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(data), gc.Equals, fmt.Sprintf("%d\n", os.Getpid()))
+
+	err = lock.Release()
+	c.Assert(err, jc.ErrorIsNil)
+	if runtime.GOOS != "windows" {
+		_, err = os.Stat(s.path)
+		c.Assert(err, jc.Satisfies, os.IsNotExist)
+	}
+}
+
+func (s *lockSuite) TestAlreadyRunning(c *gc.C) {
+	lock, err := daemon.AcquireFile(s.path)
+	c.Assert(err, jc.ErrorIsNil)
+	defer lock.Release()
+
+	_, err = daemon.AcquireFile(s.path)
+	c.Assert(err, jc.Satisfies, daemon.IsAlreadyRunning)
+	c.Assert(err, gc.ErrorMatches, fmt.Sprintf("already running with pid %d", os.Getpid()))
+	c.Assert(errors.Cause(err).(*daemon.AlreadyRunningError).PID, gc.Equals, os.Getpid())
+}
+
+func (s *lockSuite) TestAlreadyRunningStalePID(c *gc.C) {
+	lock, err := daemon.AcquireFile(s.path)
+	c.Assert(err, jc.ErrorIsNil)
+	defer lock.Release()
+	// Record a process that is not running.
+	err = ioutil.WriteFile(s.path, []byte("999999999\n"), 0644)
+	c.Assert(err, jc.ErrorIsNil)
+
+	_, err = daemon.AcquireFile(s.path)
+	c.Assert(err, jc.Satisfies, daemon.IsAlreadyRunning)
+	c.Assert(err, gc.ErrorMatches, `already running \(lock .* held\)`)
+	c.Assert(errors.Cause(err).(*daemon.AlreadyRunningError).PID, gc.Equals, 0)
+}
+
+func (s *lockSuite) TestAcquireAfterRelease(c *gc.C) {
+	lock, err := daemon.AcquireFile(s.path)
+	c.Assert(err, jc.ErrorIsNil)
+	err = lock.Release()
+	c.Assert(err, jc.ErrorIsNil)
+	lock, err = daemon.AcquireFile(s.path)
+	c.Assert(err, jc.ErrorIsNil)
+	err = lock.Release()
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *lockSuite) TestAcquireStaleFile(c *gc.C) {
+	// A lock file left by a process that died without
+	// releasing its lock does not stop another starting.
+	err := ioutil.WriteFile(s.path, []byte("999999999\n"), 0644)
+	c.Assert(err, jc.ErrorIsNil)
+	lock, err := daemon.AcquireFile(s.path)
+	c.Assert(err, jc.ErrorIsNil)
+	defer lock.Release()
+	data, err := ioutil.ReadFile(s.path)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(data), gc.Equals, fmt.Sprintf("%d\n", os.Getpid()))
+}
+
+func (s *lockSuite) TestAcquireFileSymlink(c *gc.C) {
+	if runtime.GOOS == "windows" {
+		c.Skip("symlinks need privileges on windows")
+	}
+	target := filepath.Join(c.MkDir(), "precious")
+	err := ioutil.WriteFile(target, []byte("precious data"), 0644)
+	c.Assert(err, jc.ErrorIsNil)
+	err = os.Symlink(target, s.path)
+	c.Assert(err, jc.ErrorIsNil)
+
+	_, err = daemon.AcquireFile(s.path)
+	c.Assert(err, gc.ErrorMatches, `cannot open ".*": lock file is a symbolic link`)
+	data, err := ioutil.ReadFile(target)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(data), gc.Equals, "precious data")
+}
+
+func (s *lockSuite) TestAcquireFileNotRegular(c *gc.C) {
+	err := os.Mkdir(s.path, 0755)
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = daemon.AcquireFile(s.path)
+	c.Assert(err, gc.ErrorMatches, `cannot open ".*": .*`)
+}
+
+func (s *lockSuite) TestAcquire(c *gc.C) {
+	dir := c.MkDir()
+	s.PatchValue(daemon.RuntimeDir, func() string { return dir })
+	lock, err := daemon.Acquire("utils-daemon-test")
+	c.Assert(err, jc.ErrorIsNil)
+	defer lock.Release()
+	c.Assert(lock.Path(), gc.Equals, filepath.Join(dir, "utils-daemon-test.pid"))
+}
+
+func (s *lockSuite) TestAcquireInvalidName(c *gc.C) {
+	for _, name := range []string{"", "a/b", `a\b`} {
+		_, err := daemon.Acquire(name)
+		c.Check(err, jc.Satisfies, errors.IsNotValid)
+	}
+}
@@ -0,0 +1,26 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package daemon
+
+// detachedEnv is set in the environment of a program
+// started by Detach, so that it knows not to detach again.
+const detachedEnv = "JUJU_DAEMON_DETACHED"
+
+// DetachConfig holds the configuration for Detach.
+type DetachConfig struct {
+	// Args holds the arguments with which the program is started
+	// in the background, not including the program name. If it
+	// is nil, the arguments of the current process are used.
+	Args []string
+
+	// Dir holds the working directory of the background
+	// program. If it is empty, the root directory is used, so
+	// that the daemon does not hold any file system busy.
+	Dir string
+
+	// LogFile holds the path of a file to which the output of
+	// the background program is appended. If it is empty, the
+	// output is discarded.
+	LogFile string
+}
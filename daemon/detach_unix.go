@@ -0,0 +1,64 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/juju/errors"
+)
+
+// Detach puts the program into the background by starting it again,
+// with the same executable and environment, in a new session with no
+// controlling terminal and with its standard input closed. In the
+// original program, it returns the new process, and the program
+// should then exit. In the new process, it returns nil, and the
+// program should carry on.
+func Detach(config DetachConfig) (*os.Process, error) {
+	if os.Getenv(detachedEnv) != "" {
+		os.Unsetenv(detachedEnv)
+		return nil, nil
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot find executable")
+	}
+	args := config.Args
+	if args == nil {
+		args = os.Args[1:]
+	}
+	dir := config.Dir
+	if dir == "" {
+		dir = "/"
+	}
+	devNull, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer devNull.Close()
+	output := devNull
+	if config.LogFile != "" {
+		output, err = os.OpenFile(config.LogFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, errors.Annotate(err, "cannot open log file")
+		}
+		defer output.Close()
+	}
+	cmd := exec.Command(exe, args...)
+	cmd.Env = append(os.Environ(), detachedEnv+"=1")
+	cmd.Dir = dir
+	cmd.Stdin = devNull
+	cmd.Stdout = output
+	cmd.Stderr = output
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return nil, errors.Annotate(err, "cannot start background process")
+	}
+	return cmd.Process, nil
+}
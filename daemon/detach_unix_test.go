@@ -0,0 +1,83 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+//go:build !windows
+// +build !windows
+
+package daemon_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	jujutesting "github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	"golang.org/x/sys/unix"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/daemon"
+)
+
+// reportEnv holds the name of a file to which the
+// detached test process writes what it finds.
+const reportEnv = "DAEMON_TEST_REPORT"
+
+// TestDetachedProcess is run by the test binary started
+// by Detach in TestDetach, and does nothing otherwise.
+func TestDetachedProcess(t *testing.T) {
+	report := os.Getenv(reportEnv)
+	if report == "" {
+		return
+	}
+	child, err := daemon.Detach(daemon.DetachConfig{})
+	if err != nil || child != nil {
+		t.Fatalf("Detach returned %v, %v in detached process", child, err)
+	}
+	sid, _ := unix.Getsid(0)
+	wd, _ := os.Getwd()
+	fmt.Println("output from detached process")
+	data := fmt.Sprintf("sid-is-pid=%v wd=%s", sid == os.Getpid(), wd)
+	ioutil.WriteFile(report+".tmp", []byte(data), 0644)
+	os.Rename(report+".tmp", report)
+}
+
+type detachSuite struct {
+	jujutesting.IsolationSuite
+}
+
+var _ = gc.Suite(&detachSuite{})
+
+func (s *detachSuite) TestDetach(c *gc.C) {
+	dir := c.MkDir()
+	report := filepath.Join(dir, "report")
+	logFile := filepath.Join(dir, "log")
+	s.PatchEnvironment(reportEnv, report)
+
+	child, err := daemon.Detach(daemon.DetachConfig{
+		Args:    []string{"-test.run", "^TestDetachedProcess$"},
+		LogFile: logFile,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(child, gc.NotNil)
+	defer child.Release()
+
+	var data []byte
+	for deadline := time.Now().Add(jujutesting.LongWait); time.Now().Before(deadline); {
+		if data, err = ioutil.ReadFile(report); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(data), gc.Equals, "sid-is-pid=true wd=/")
+	// Wait for the process to exit so that its output is complete.
+	child.Wait()
+	output, err := ioutil.ReadFile(logFile)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(strings.Contains(string(output), "output from detached process\n"), jc.IsTrue)
+}
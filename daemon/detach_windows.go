@@ -0,0 +1,16 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package daemon
+
+import (
+	"os"
+
+	"github.com/juju/errors"
+)
+
+// Detach is not supported on Windows, where
+// background programs run as services.
+func Detach(config DetachConfig) (*os.Process, error) {
+	return nil, errors.NotSupportedf("detaching on windows")
+}
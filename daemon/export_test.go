@@ -0,0 +1,6 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package daemon
+
+var RuntimeDir = &runtimeDir
@@ -0,0 +1,90 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+//go:build !windows
+// +build !windows
+
+package daemon
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/juju/errors"
+	"golang.org/x/sys/unix"
+)
+
+// defaultRuntimeDir returns /run for root, or $XDG_RUNTIME_DIR if it
+// names a directory owned by the current user, so that lock files are
+// not kept in a world-writable directory if that can be avoided.
+func defaultRuntimeDir() string {
+	uid := os.Geteuid()
+	if uid == 0 && ownedDir("/run", 0) {
+		return "/run"
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" && ownedDir(dir, uid) {
+		return dir
+	}
+	return os.TempDir()
+}
+
+// ownedDir reports whether path is a directory owned by uid.
+func ownedDir(path string, uid int) bool {
+	fi, err := os.Lstat(path)
+	if err != nil || !fi.IsDir() {
+		return false
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	return ok && int(st.Uid) == uid
+}
+
+// openLockFile opens the lock file at path, creating it if needed,
+// without following a symbolic link, and checks that it is a regular
+// file owned by the current user.
+func openLockFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|unix.O_NOFOLLOW, 0644)
+	if err != nil {
+		if isSymlink(path) {
+			return nil, errors.Errorf("lock file is a symbolic link")
+		}
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		f.Close()
+		return nil, errors.Errorf("lock file is not a regular file")
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); !ok || int(st.Uid) != os.Geteuid() {
+		f.Close()
+		return nil, errors.Errorf("lock file is not owned by the current user")
+	}
+	return f, nil
+}
+
+func isSymlink(path string) bool {
+	fi, err := os.Lstat(path)
+	return err == nil && fi.Mode()&os.ModeSymlink != 0
+}
+
+func lockFile(f *os.File) error {
+	err := unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+	if err == unix.EWOULDBLOCK {
+		return errLocked
+	}
+	return err
+}
+
+// releaseFile removes the lock file before closing it, which
+// releases the lock, so that no other process can lock the
+// file and then have it removed.
+func releaseFile(f *os.File, path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,54 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package daemon
+
+import (
+	"os"
+
+	"github.com/juju/errors"
+	"golang.org/x/sys/windows"
+)
+
+// defaultRuntimeDir returns the temporary
+// directory, which belongs to the current user.
+func defaultRuntimeDir() string {
+	return os.TempDir()
+}
+
+// openLockFile opens the lock file at path, creating it if
+// needed, and checks that it is a regular file.
+func openLockFile(path string) (*os.File, error) {
+	if fi, err := os.Lstat(path); err == nil && !fi.Mode().IsRegular() {
+		return nil, errors.Errorf("lock file is not a regular file")
+	}
+	return os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+}
+
+// lockFile locks a byte far beyond the end of the file, as Windows
+// locks are mandatory and locking the contents would stop other
+// processes reading the process ID.
+func lockFile(f *os.File) error {
+	ol := windows.Overlapped{Offset: 0xffffffff, OffsetHigh: 0x7fffffff}
+	err := windows.LockFileEx(
+		windows.Handle(f.Fd()),
+		windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY,
+		0, 1, 0, &ol,
+	)
+	if err == windows.ERROR_LOCK_VIOLATION {
+		return errLocked
+	}
+	return err
+}
+
+// releaseFile empties the lock file and closes it, which releases
+// the lock. An open file cannot be removed on Windows, and removing
+// it after closing it could remove a file locked by another
+// process, so the file is left behind.
+func releaseFile(f *os.File, path string) error {
+	if err := f.Truncate(0); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,230 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package utils
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/juju/errors"
+)
+
+// MergeStrategy specifies how DeepMerge combines two values
+// found at the same key.
+type MergeStrategy int
+
+const (
+	// MergeOverride replaces the destination value with the
+	// source value. Nested maps are merged key by key.
+	MergeOverride MergeStrategy = iota
+
+	// MergeAppend appends a source slice to a destination
+	// slice, and otherwise behaves like MergeOverride.
+	MergeAppend
+
+	// MergeErrorOnConflict returns an error if the source
+	// and destination values differ. Nested maps are merged
+	// key by key.
+	MergeErrorOnConflict
+)
+
+// MergeOptions holds options for DeepMerge.
+type MergeOptions struct {
+	// Default holds the strategy used for keys with no entry
+	// in Strategies.
+	Default MergeStrategy
+
+	// Strategies maps the path of a key to the strategy used for
+	// it and for everything beneath it. Paths are made by joining
+	// keys with ".", for example "logging.targets".
+	Strategies map[string]MergeStrategy
+}
+
+// DeepMerge returns the result of merging src on top of dst. Neither
+// map is modified. Nested maps may be map[string]interface{} or, as
+// produced by YAML decoding, map[interface{}]interface{}; in the
+// result they are all map[string]interface{}.
+func DeepMerge(dst, src map[string]interface{}, options *MergeOptions) (map[string]interface{}, error) {
+	if options == nil {
+		options = &MergeOptions{}
+	}
+	dstValue, err := YAMLToJSON(dst)
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot merge")
+	}
+	srcValue, err := YAMLToJSON(src)
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot merge")
+	}
+	result := dstValue.(map[string]interface{})
+	if err := mergeMaps(result, srcValue.(map[string]interface{}), "", options.Default, options); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return result, nil
+}
+
+// mergeMaps merges src into dst, which are found at path.
+func mergeMaps(dst, src map[string]interface{}, path string, strategy MergeStrategy, options *MergeOptions) error {
+	for key, srcValue := range src {
+		keyPath := joinPath(path, key)
+		keyStrategy := strategy
+		if s, ok := options.Strategies[keyPath]; ok {
+			keyStrategy = s
+		}
+		dstValue, ok := dst[key]
+		if !ok {
+			dst[key] = srcValue
+			continue
+		}
+		dstMap, dstIsMap := dstValue.(map[string]interface{})
+		srcMap, srcIsMap := srcValue.(map[string]interface{})
+		if dstIsMap && srcIsMap {
+			if err := mergeMaps(dstMap, srcMap, keyPath, keyStrategy, options); err != nil {
+				return err
+			}
+			continue
+		}
+		switch keyStrategy {
+		case MergeAppend:
+			dstSlice, dstIsSlice := dstValue.([]interface{})
+			srcSlice, srcIsSlice := srcValue.([]interface{})
+			if dstIsSlice && srcIsSlice {
+				dst[key] = append(dstSlice[:len(dstSlice):len(dstSlice)], srcSlice...)
+				continue
+			}
+		case MergeErrorOnConflict:
+			if !reflect.DeepEqual(dstValue, srcValue) {
+				return errors.Errorf("conflicting values for %q: %v and %v", keyPath, dstValue, srcValue)
+			}
+		}
+		dst[key] = srcValue
+	}
+	return nil
+}
+
+// ChangeType describes how a value differs.
+type ChangeType string
+
+const (
+	// Added indicates a value present only in the new map.
+	Added ChangeType = "added"
+
+	// Removed indicates a value present only in the old map.
+	Removed ChangeType = "removed"
+
+	// Modified indicates a value that differs between maps.
+	Modified ChangeType = "modified"
+)
+
+// Change describes a single difference found by DeepDiff.
+type Change struct {
+	// Path holds the location of the value. It is made by joining
+	// map keys with "." and appending "[i]" for slice elements,
+	// for example "logging.targets[1].level".
+	Path string
+
+	// Type holds the kind of change.
+	Type ChangeType
+
+	// Old holds the old value. It is nil if the value was added.
+	Old interface{}
+
+	// New holds the new value. It is nil if the value was removed.
+	New interface{}
+}
+
+// String returns a one line description of the change.
+func (c Change) String() string {
+	switch c.Type {
+	case Added:
+		return fmt.Sprintf("+ %s: %v", c.Path, c.New)
+	case Removed:
+		return fmt.Sprintf("- %s: %v", c.Path, c.Old)
+	}
+	return fmt.Sprintf("~ %s: %v -> %v", c.Path, c.Old, c.New)
+}
+
+// DeepDiff returns the changes needed to turn old into new, ordered
+// by path. Nested maps and slices are compared element by element;
+// any other values are compared with reflect.DeepEqual. Nested maps
+// may be map[string]interface{} or map[interface{}]interface{}.
+func DeepDiff(old, new map[string]interface{}) ([]Change, error) {
+	oldValue, err := YAMLToJSON(old)
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot diff")
+	}
+	newValue, err := YAMLToJSON(new)
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot diff")
+	}
+	var changes []Change
+	diffValues(&changes, "", oldValue, newValue)
+	return changes, nil
+}
+
+func diffValues(changes *[]Change, path string, old, new interface{}) {
+	switch old := old.(type) {
+	case map[string]interface{}:
+		if new, ok := new.(map[string]interface{}); ok {
+			diffMaps(changes, path, old, new)
+			return
+		}
+	case []interface{}:
+		if new, ok := new.([]interface{}); ok {
+			diffSlices(changes, path, old, new)
+			return
+		}
+	}
+	if !reflect.DeepEqual(old, new) {
+		*changes = append(*changes, Change{Path: path, Type: Modified, Old: old, New: new})
+	}
+}
+
+func diffMaps(changes *[]Change, path string, old, new map[string]interface{}) {
+	keys := make([]string, 0, len(old)+len(new))
+	for key := range old {
+		keys = append(keys, key)
+	}
+	for key := range new {
+		if _, ok := old[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		keyPath := joinPath(path, key)
+		oldValue, inOld := old[key]
+		newValue, inNew := new[key]
+		switch {
+		case !inOld:
+			*changes = append(*changes, Change{Path: keyPath, Type: Added, New: newValue})
+		case !inNew:
+			*changes = append(*changes, Change{Path: keyPath, Type: Removed, Old: oldValue})
+		default:
+			diffValues(changes, keyPath, oldValue, newValue)
+		}
+	}
+}
+
+func diffSlices(changes *[]Change, path string, old, new []interface{}) {
+	for i := 0; i < len(old) || i < len(new); i++ {
+		elemPath := fmt.Sprintf("%s[%d]", path, i)
+		switch {
+		case i >= len(old):
+			*changes = append(*changes, Change{Path: elemPath, Type: Added, New: new[i]})
+		case i >= len(new):
+			*changes = append(*changes, Change{Path: elemPath, Type: Removed, Old: old[i]})
+		default:
+			diffValues(changes, elemPath, old[i], new[i])
+		}
+	}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,176 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package utils_test
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3"
+)
+
+type deepMergeSuite struct{}
+
+var _ = gc.Suite(&deepMergeSuite{})
+
+func baseConfig() map[string]interface{} {
+	return map[string]interface{}{
+		"name": "app",
+		"logging": map[interface{}]interface{}{
+			"level":   "info",
+			"targets": []interface{}{"stderr"},
+		},
+		"ports": []interface{}{80},
+	}
+}
+
+func (*deepMergeSuite) TestMergeOverride(c *gc.C) {
+	dst := baseConfig()
+	src := map[string]interface{}{
+		"logging": map[string]interface{}{
+			"level":   "debug",
+			"targets": []interface{}{"syslog"},
+		},
+		"ports": []interface{}{443},
+		"extra": true,
+	}
+	result, err := utils.DeepMerge(dst, src, nil)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(result, jc.DeepEquals, map[string]interface{}{
+		"name": "app",
+		"logging": map[string]interface{}{
+			"level":   "debug",
+			"targets": []interface{}{"syslog"},
+		},
+		"ports": []interface{}{443},
+		"extra": true,
+	})
+	// The inputs are left alone.
+	c.Check(dst, jc.DeepEquals, baseConfig())
+}
+
+func (*deepMergeSuite) TestMergeStrategies(c *gc.C) {
+	src := map[string]interface{}{
+		"logging": map[string]interface{}{
+			"level":   "info",
+			"targets": []interface{}{"syslog"},
+		},
+		"ports": []interface{}{443},
+	}
+	result, err := utils.DeepMerge(baseConfig(), src, &utils.MergeOptions{
+		Default: utils.MergeErrorOnConflict,
+		Strategies: map[string]utils.MergeStrategy{
+			"logging.targets": utils.MergeAppend,
+			"ports":           utils.MergeOverride,
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(result, jc.DeepEquals, map[string]interface{}{
+		"name": "app",
+		"logging": map[string]interface{}{
+			"level":   "info",
+			"targets": []interface{}{"stderr", "syslog"},
+		},
+		"ports": []interface{}{443},
+	})
+}
+
+func (*deepMergeSuite) TestMergeStrategyInherited(c *gc.C) {
+	dst := map[string]interface{}{
+		"a": map[string]interface{}{"b": map[string]interface{}{"c": []interface{}{1}}},
+	}
+	src := map[string]interface{}{
+		"a": map[string]interface{}{"b": map[string]interface{}{"c": []interface{}{2}}},
+	}
+	result, err := utils.DeepMerge(dst, src, &utils.MergeOptions{
+		Strategies: map[string]utils.MergeStrategy{"a": utils.MergeAppend},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(result, jc.DeepEquals, map[string]interface{}{
+		"a": map[string]interface{}{"b": map[string]interface{}{"c": []interface{}{1, 2}}},
+	})
+}
+
+func (*deepMergeSuite) TestMergeAppendMismatchedTypes(c *gc.C) {
+	result, err := utils.DeepMerge(
+		map[string]interface{}{"a": []interface{}{1}},
+		map[string]interface{}{"a": "x"},
+		&utils.MergeOptions{Default: utils.MergeAppend},
+	)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(result, jc.DeepEquals, map[string]interface{}{"a": "x"})
+}
+
+func (*deepMergeSuite) TestMergeConflict(c *gc.C) {
+	src := map[string]interface{}{
+		"logging": map[string]interface{}{"level": "debug"},
+	}
+	_, err := utils.DeepMerge(baseConfig(), src, &utils.MergeOptions{Default: utils.MergeErrorOnConflict})
+	c.Check(err, gc.ErrorMatches, `conflicting values for "logging.level": info and debug`)
+}
+
+func (*deepMergeSuite) TestMergeInvalidKey(c *gc.C) {
+	src := map[string]interface{}{
+		"a": map[interface{}]interface{}{1: "x"},
+	}
+	_, err := utils.DeepMerge(baseConfig(), src, nil)
+	c.Check(err, gc.ErrorMatches, `cannot merge: map key 1 \(int\) at "a" is not a string`)
+}
+
+func (*deepMergeSuite) TestDiff(c *gc.C) {
+	new := map[string]interface{}{
+		"name": "app",
+		"logging": map[string]interface{}{
+			"level":   "debug",
+			"targets": []interface{}{"stderr", "syslog"},
+		},
+		"extra": map[string]interface{}{"x": 1},
+	}
+	changes, err := utils.DeepDiff(baseConfig(), new)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(changes, jc.DeepEquals, []utils.Change{
+		{Path: "extra", Type: utils.Added, New: map[string]interface{}{"x": 1}},
+		{Path: "logging.level", Type: utils.Modified, Old: "info", New: "debug"},
+		{Path: "logging.targets[1]", Type: utils.Added, New: "syslog"},
+		{Path: "ports", Type: utils.Removed, Old: []interface{}{80}},
+	})
+	var lines []string
+	for _, change := range changes {
+		lines = append(lines, change.String())
+	}
+	c.Check(lines, jc.DeepEquals, []string{
+		"+ extra: map[x:1]",
+		"~ logging.level: info -> debug",
+		"+ logging.targets[1]: syslog",
+		"- ports: [80]",
+	})
+}
+
+func (*deepMergeSuite) TestDiffNestedSlices(c *gc.C) {
+	old := map[string]interface{}{
+		"units": []interface{}{
+			map[string]interface{}{"name": "a", "ready": true},
+			map[string]interface{}{"name": "b", "ready": false},
+		},
+		"kind": map[string]interface{}{"x": 1},
+	}
+	new := map[string]interface{}{
+		"units": []interface{}{
+			map[interface{}]interface{}{"name": "a", "ready": true},
+		},
+		"kind": "plain",
+	}
+	changes, err := utils.DeepDiff(old, new)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(changes, jc.DeepEquals, []utils.Change{
+		{Path: "kind", Type: utils.Modified, Old: map[string]interface{}{"x": 1}, New: "plain"},
+		{Path: "units[1]", Type: utils.Removed, Old: map[string]interface{}{"name": "b", "ready": false}},
+	})
+}
+
+func (*deepMergeSuite) TestDiffEqual(c *gc.C) {
+	changes, err := utils.DeepDiff(baseConfig(), baseConfig())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(changes, gc.HasLen, 0)
+}
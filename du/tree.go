@@ -0,0 +1,243 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package du
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// TreeOptions holds the options for Tree.
+type TreeOptions struct {
+	// Exclude holds glob patterns, in the syntax of filepath.Match,
+	// for files and directories that should not be counted. A pattern
+	// is matched against both the base name of each path and the path
+	// relative to the root, using forward slashes. Excluded directories
+	// are not descended into.
+	Exclude []string
+
+	// SameFilesystem, if true, restricts the walk to the filesystem
+	// containing the root, in the manner of du -x. Mount points are
+	// not descended into. It has no effect on Windows, where
+	// mounted volumes are only reachable through reparse points,
+	// which are never followed.
+	SameFilesystem bool
+
+	// Parallelism holds the maximum number of directories read
+	// concurrently. If it is zero, runtime.NumCPU is used.
+	Parallelism int
+
+	// Progress, if not nil, is called with the running totals
+	// each time a directory has been read. Calls are serialized.
+	Progress func(TreeUsage)
+}
+
+// TreeUsage holds the disk usage of a directory tree.
+type TreeUsage struct {
+	// Files holds the number of non-directory entries counted.
+	Files uint64
+
+	// Dirs holds the number of directories counted,
+	// including the root.
+	Dirs uint64
+
+	// ApparentSize holds the sum of the sizes of the entries,
+	// in bytes, as reported by du --apparent-size.
+	ApparentSize uint64
+
+	// AllocatedSize holds the space allocated on disk for the
+	// entries, in bytes, which may be smaller than the apparent size
+	// for sparse files or larger because of block rounding. On
+	// Windows the apparent size is used.
+	AllocatedSize uint64
+}
+
+// Tree walks the directory tree rooted at root and returns its disk
+// usage. Symbolic links are counted but not followed. Files with
+// several hard links inside the tree are only counted once.
+// Directories are read concurrently.
+//
+// The walk stops at the first error, which is returned.
+func Tree(root string, opts TreeOptions) (TreeUsage, error) {
+	for _, pattern := range opts.Exclude {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return TreeUsage{}, fmt.Errorf("invalid exclude pattern %q: %v", pattern, err)
+		}
+	}
+	info, err := os.Lstat(root)
+	if err != nil {
+		return TreeUsage{}, err
+	}
+	parallelism := opts.Parallelism
+	if parallelism <= 0 {
+		parallelism = runtime.NumCPU()
+	}
+	w := &treeWalker{
+		opts:  opts,
+		root:  root,
+		slots: make(chan struct{}, parallelism-1),
+		seen:  make(map[fileID]bool),
+	}
+	w.rootDev, _, _, _ = statInfo(info)
+	w.add(info)
+	if info.IsDir() {
+		w.walk(root)
+		w.wg.Wait()
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.usage, w.err
+}
+
+// treeWalker holds the state of a Tree call.
+type treeWalker struct {
+	opts    TreeOptions
+	root    string
+	rootDev uint64
+
+	// slots limits the number of extra goroutines
+	// reading directories.
+	slots chan struct{}
+	wg    sync.WaitGroup
+
+	// mu guards the fields below it.
+	mu    sync.Mutex
+	usage TreeUsage
+	seen  map[fileID]bool
+	err   error
+}
+
+// walk reads the directory at dir and counts its contents, starting
+// a new goroutine for each subdirectory if there is a free slot, or
+// walking it directly otherwise.
+func (w *treeWalker) walk(dir string) {
+	if w.failed() {
+		return
+	}
+	var subdirs []string
+	err := w.readDir(dir, func(path string, info os.FileInfo) {
+		if w.excluded(path, info) {
+			return
+		}
+		if info.IsDir() && w.opts.SameFilesystem {
+			if dev, _, _, _ := statInfo(info); dev != w.rootDev {
+				return
+			}
+		}
+		w.add(info)
+		if info.IsDir() {
+			subdirs = append(subdirs, path)
+		}
+	})
+	if err != nil {
+		w.fail(err)
+		return
+	}
+	w.progress()
+	for _, subdir := range subdirs {
+		select {
+		case w.slots <- struct{}{}:
+			w.wg.Add(1)
+			go func(subdir string) {
+				defer w.wg.Done()
+				defer func() { <-w.slots }()
+				w.walk(subdir)
+			}(subdir)
+		default:
+			w.walk(subdir)
+		}
+	}
+}
+
+// readDir calls f for each entry in the directory at dir.
+func (w *treeWalker) readDir(dir string, f func(path string, info os.FileInfo)) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	for {
+		infos, err := d.Readdir(100)
+		for _, info := range infos {
+			f(filepath.Join(dir, info.Name()), info)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("cannot read directory %q: %v", dir, err)
+		}
+	}
+}
+
+// excluded reports whether the given path matches
+// any of the exclude patterns.
+func (w *treeWalker) excluded(path string, info os.FileInfo) bool {
+	if len(w.opts.Exclude) == 0 {
+		return false
+	}
+	rel, err := filepath.Rel(w.root, path)
+	if err != nil {
+		rel = path
+	}
+	rel = filepath.ToSlash(rel)
+	for _, pattern := range w.opts.Exclude {
+		if ok, _ := filepath.Match(pattern, info.Name()); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, rel); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// add counts the entry with the given info.
+func (w *treeWalker) add(info os.FileInfo) {
+	_, id, nlink, allocated := statInfo(info)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if info.IsDir() {
+		w.usage.Dirs++
+	} else {
+		if nlink > 1 {
+			if w.seen[id] {
+				return
+			}
+			w.seen[id] = true
+		}
+		w.usage.Files++
+	}
+	w.usage.ApparentSize += uint64(info.Size())
+	w.usage.AllocatedSize += allocated
+}
+
+func (w *treeWalker) progress() {
+	if w.opts.Progress == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err == nil {
+		w.opts.Progress(w.usage)
+	}
+}
+
+func (w *treeWalker) fail(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+func (w *treeWalker) failed() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err != nil
+}
@@ -0,0 +1,126 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package du_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/du"
+)
+
+type treeSuite struct{}
+
+var _ = gc.Suite(&treeSuite{})
+
+// makeTree creates a tree with 3 levels of 4 directories, each
+// holding a 10 byte file and a 100 byte log file.
+func makeTree(c *gc.C) (root string, dirs, files int) {
+	root = c.MkDir()
+	var mk func(dir string, depth int)
+	mk = func(dir string, depth int) {
+		dirs++
+		c.Assert(ioutil.WriteFile(filepath.Join(dir, "data"), make([]byte, 10), 0644), jc.ErrorIsNil)
+		c.Assert(ioutil.WriteFile(filepath.Join(dir, "out.log"), make([]byte, 100), 0644), jc.ErrorIsNil)
+		files += 2
+		if depth == 0 {
+			return
+		}
+		for i := 0; i < 4; i++ {
+			sub := filepath.Join(dir, fmt.Sprintf("d%d", i))
+			c.Assert(os.Mkdir(sub, 0755), jc.ErrorIsNil)
+			mk(sub, depth-1)
+		}
+	}
+	mk(root, 2)
+	return root, dirs, files
+}
+
+func (*treeSuite) TestTree(c *gc.C) {
+	root, dirs, files := makeTree(c)
+	var size uint64
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		size += uint64(info.Size())
+		return err
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	for _, parallelism := range []int{0, 1, 3} {
+		c.Logf("parallelism %d", parallelism)
+		usage, err := du.Tree(root, du.TreeOptions{Parallelism: parallelism})
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(usage.Dirs, gc.Equals, uint64(dirs))
+		c.Check(usage.Files, gc.Equals, uint64(files))
+		c.Check(usage.ApparentSize, gc.Equals, size)
+		c.Check(usage.AllocatedSize > 0, jc.IsTrue)
+	}
+}
+
+func (*treeSuite) TestTreeExclude(c *gc.C) {
+	root, dirs, files := makeTree(c)
+
+	usage, err := du.Tree(root, du.TreeOptions{
+		Exclude: []string{"*.log", "d1/d2"},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(usage.Dirs, gc.Equals, uint64(dirs-1))
+	c.Check(usage.Files, gc.Equals, uint64(files/2-1))
+
+	usage, err = du.Tree(root, du.TreeOptions{
+		Exclude: []string{"d[0-2]"},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	// Only the root, d3 and d3/d3 remain.
+	c.Check(usage.Dirs, gc.Equals, uint64(3))
+	c.Check(usage.Files, gc.Equals, uint64(2*3))
+}
+
+func (*treeSuite) TestTreeBadExclude(c *gc.C) {
+	_, err := du.Tree(c.MkDir(), du.TreeOptions{Exclude: []string{"["}})
+	c.Assert(err, gc.ErrorMatches, `invalid exclude pattern "\[": syntax error in pattern`)
+}
+
+func (*treeSuite) TestTreeHardLinks(c *gc.C) {
+	if runtime.GOOS == "windows" {
+		c.Skip("hard links are not detected on windows")
+	}
+	root := c.MkDir()
+	c.Assert(ioutil.WriteFile(filepath.Join(root, "file"), make([]byte, 1000), 0644), jc.ErrorIsNil)
+	c.Assert(os.Link(filepath.Join(root, "file"), filepath.Join(root, "link")), jc.ErrorIsNil)
+	rootInfo, err := os.Lstat(root)
+	c.Assert(err, jc.ErrorIsNil)
+
+	usage, err := du.Tree(root, du.TreeOptions{})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(usage.Files, gc.Equals, uint64(1))
+	c.Check(usage.ApparentSize, gc.Equals, uint64(rootInfo.Size())+1000)
+}
+
+func (*treeSuite) TestTreeProgress(c *gc.C) {
+	root, dirs, files := makeTree(c)
+
+	var calls []du.TreeUsage
+	usage, err := du.Tree(root, du.TreeOptions{
+		Progress: func(u du.TreeUsage) {
+			calls = append(calls, u)
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(calls, gc.HasLen, dirs)
+	for i := 1; i < len(calls); i++ {
+		c.Check(calls[i].Files >= calls[i-1].Files, jc.IsTrue)
+	}
+	c.Check(usage.Files, gc.Equals, uint64(files))
+}
+
+func (*treeSuite) TestTreeNotFound(c *gc.C) {
+	_, err := du.Tree(filepath.Join(c.MkDir(), "missing"), du.TreeOptions{})
+	c.Assert(err, jc.Satisfies, os.IsNotExist)
+}
@@ -0,0 +1,28 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+//go:build !windows
+// +build !windows
+
+package du
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileID identifies a file within a system.
+type fileID struct {
+	dev, ino uint64
+}
+
+// statInfo returns the device holding the file described by info, its
+// identity, its number of hard links, and the space allocated for it.
+func statInfo(info os.FileInfo) (dev uint64, id fileID, nlink, allocated uint64) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, fileID{}, 1, uint64(info.Size())
+	}
+	dev = uint64(st.Dev)
+	return dev, fileID{dev: dev, ino: uint64(st.Ino)}, uint64(st.Nlink), uint64(st.Blocks) * 512
+}
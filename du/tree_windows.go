@@ -0,0 +1,19 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package du
+
+import (
+	"os"
+)
+
+// fileID identifies a file within a system. Hard links are
+// not detected on Windows, so it is never used.
+type fileID struct{}
+
+// statInfo returns the device holding the file described by info, its
+// identity, its number of hard links, and the space allocated for it.
+// Only the size is available without opening the file on Windows.
+func statInfo(info os.FileInfo) (dev uint64, id fileID, nlink, allocated uint64) {
+	return 0, fileID{}, 1, uint64(info.Size())
+}
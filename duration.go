@@ -0,0 +1,223 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package utils
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+const (
+	// Day is the length of a day, ignoring daylight saving changes.
+	Day = 24 * time.Hour
+
+	// Week is the length of a week of seven days.
+	Week = 7 * Day
+)
+
+// durationUnits maps the units accepted by ParseDuration, beyond
+// those understood by time.ParseDuration, to their lengths.
+var durationUnits = map[string]time.Duration{
+	"w": Week,
+	"d": Day,
+}
+
+// ParseDuration parses a duration string. As well as the formats
+// accepted by time.ParseDuration, it accepts days and weeks, as in
+// "2d12h" or "1w", and ISO 8601 durations such as "P1DT12H" or "P2W".
+// As years and months do not have a fixed length, they are not
+// accepted in either form.
+func ParseDuration(s string) (time.Duration, error) {
+	str := strings.TrimSpace(s)
+	neg := false
+	if str != "" && (str[0] == '-' || str[0] == '+') {
+		neg = str[0] == '-'
+		str = str[1:]
+	}
+	var (
+		d   time.Duration
+		err error
+	)
+	if strings.HasPrefix(str, "P") {
+		d, err = parseISO8601Duration(str)
+	} else {
+		d, err = parseDuration(str)
+	}
+	if err != nil {
+		return 0, errors.Annotatef(err, "invalid duration %q", s)
+	}
+	if neg {
+		d = -d
+	}
+	return d, nil
+}
+
+// parseDuration parses an unsigned duration made up of
+// numbers, which may be fractional, each followed by a unit.
+func parseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, errors.New("empty duration")
+	}
+	if s == "0" {
+		return 0, nil
+	}
+	var total time.Duration
+	for s != "" {
+		i := strings.IndexFunc(s, func(r rune) bool {
+			return r != '.' && (r < '0' || r > '9')
+		})
+		if i < 0 {
+			return 0, errors.Errorf("missing unit after %q", s)
+		}
+		if i == 0 {
+			return 0, errors.New("expected a number followed by a unit")
+		}
+		j := i + strings.IndexFunc(s[i:], func(r rune) bool {
+			return r == '.' || (r >= '0' && r <= '9')
+		})
+		if j < i {
+			j = len(s)
+		}
+		num, unit := s[:i], s[i:j]
+		s = s[j:]
+		var d time.Duration
+		if length, ok := durationUnits[unit]; ok {
+			f, err := strconv.ParseFloat(num, 64)
+			if err != nil {
+				return 0, errors.Errorf("invalid number %q", num)
+			}
+			if f*float64(length) > math.MaxInt64 {
+				return 0, errors.New("duration too large")
+			}
+			d = time.Duration(f * float64(length))
+		} else {
+			var err error
+			if d, err = time.ParseDuration(num + unit); err != nil {
+				return 0, errors.Errorf("unknown unit %q", unit)
+			}
+		}
+		if total+d < total {
+			return 0, errors.New("duration too large")
+		}
+		total += d
+	}
+	return total, nil
+}
+
+// parseISO8601Duration parses an unsigned ISO 8601 duration,
+// such as "P1DT2H30M" or "P3W".
+func parseISO8601Duration(s string) (time.Duration, error) {
+	if s == "P" || strings.HasSuffix(s, "T") {
+		return 0, errors.New("incomplete ISO 8601 duration")
+	}
+	datePart, timePart := s[1:], ""
+	if i := strings.Index(datePart, "T"); i >= 0 {
+		datePart, timePart = datePart[:i], datePart[i+1:]
+	}
+	units := map[byte]time.Duration{'W': Week, 'D': Day}
+	var total time.Duration
+	for _, part := range []string{datePart, timePart} {
+		for part != "" {
+			i := strings.IndexFunc(part, func(r rune) bool {
+				return r != '.' && r != ',' && (r < '0' || r > '9')
+			})
+			if i <= 0 {
+				return 0, errors.New("malformed ISO 8601 duration")
+			}
+			unit := part[i]
+			length, ok := units[unit]
+			if !ok {
+				if unit == 'Y' || unit == 'M' {
+					return 0, errors.New("years and months are not supported")
+				}
+				return 0, errors.Errorf("unknown unit %q", string(unit))
+			}
+			f, err := strconv.ParseFloat(strings.Replace(part[:i], ",", ".", 1), 64)
+			if err != nil {
+				return 0, errors.Errorf("invalid number %q", part[:i])
+			}
+			if f*float64(length) > math.MaxInt64-float64(total) {
+				return 0, errors.New("duration too large")
+			}
+			total += time.Duration(f * float64(length))
+			part = part[i+1:]
+		}
+		// Units in the time part differ from those in the date part.
+		units = map[byte]time.Duration{'H': time.Hour, 'M': time.Minute, 'S': time.Second}
+	}
+	return total, nil
+}
+
+// FormatDuration formats d in the form accepted by ParseDuration,
+// using weeks and days where appropriate; for example "1w2d3h".
+// Durations of less than a second are formatted as by
+// time.Duration.String.
+func FormatDuration(d time.Duration) string {
+	if d < 0 {
+		return "-" + FormatDuration(-d)
+	}
+	if d < time.Second {
+		return d.String()
+	}
+	var buf strings.Builder
+	for _, u := range []struct {
+		unit   string
+		length time.Duration
+	}{
+		{"w", Week}, {"d", Day}, {"h", time.Hour}, {"m", time.Minute},
+	} {
+		if n := d / u.length; n > 0 {
+			fmt.Fprintf(&buf, "%d%s", n, u.unit)
+			d -= n * u.length
+		}
+	}
+	if d > 0 {
+		buf.WriteString(strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s")
+	}
+	return buf.String()
+}
+
+// HumanizeDuration returns an approximate, friendly description of the
+// length of d, such as "about 3 hours" or "2 days", suitable for status
+// output. The sign of d is ignored.
+func HumanizeDuration(d time.Duration) string {
+	if d < 0 {
+		d = -d
+	}
+	if d < time.Second {
+		return "less than a second"
+	}
+	units := []struct {
+		name   string
+		length time.Duration
+	}{
+		{"week", Week}, {"day", Day}, {"hour", time.Hour}, {"minute", time.Minute}, {"second", time.Second},
+	}
+	for i, u := range units {
+		if d < u.length {
+			continue
+		}
+		n := (d + u.length/2) / u.length
+		if i > 0 && n*u.length >= units[i-1].length {
+			// Rounding has reached the next larger
+			// unit, as in 59m45s, so use that instead.
+			u = units[i-1]
+			n = (d + u.length/2) / u.length
+		}
+		s := fmt.Sprintf("%d %s", n, u.name)
+		if n != 1 {
+			s += "s"
+		}
+		if d%u.length != 0 {
+			s = "about " + s
+		}
+		return s
+	}
+	panic("unreachable")
+}
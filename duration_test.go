@@ -0,0 +1,149 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package utils_test
+
+import (
+	"time"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3"
+)
+
+var _ = gc.Suite(&durationSuite{})
+
+type durationSuite struct {
+	testing.IsolationSuite
+}
+
+var parseDurationTests = []struct {
+	in  string
+	out time.Duration
+	err string
+}{{
+	in:  "0",
+	out: 0,
+}, {
+	in:  "90s",
+	out: 90 * time.Second,
+}, {
+	in:  "1h30m",
+	out: 90 * time.Minute,
+}, {
+	in:  "250ms",
+	out: 250 * time.Millisecond,
+}, {
+	in:  "2d12h",
+	out: 60 * time.Hour,
+}, {
+	in:  "1w",
+	out: 7 * 24 * time.Hour,
+}, {
+	in:  "1.5d",
+	out: 36 * time.Hour,
+}, {
+	in:  "-1d",
+	out: -24 * time.Hour,
+}, {
+	in:  "P1DT12H",
+	out: 36 * time.Hour,
+}, {
+	in:  "P2W",
+	out: 14 * 24 * time.Hour,
+}, {
+	in:  "PT1M30.5S",
+	out: 90*time.Second + 500*time.Millisecond,
+}, {
+	in:  "PT0,5H",
+	out: 30 * time.Minute,
+}, {
+	in:  "-PT10M",
+	out: -10 * time.Minute,
+}, {
+	in:  "",
+	err: `invalid duration "": empty duration`,
+}, {
+	in:  "10",
+	err: `invalid duration "10": missing unit after "10"`,
+}, {
+	in:  "1y",
+	err: `invalid duration "1y": unknown unit "y"`,
+}, {
+	in:  "d",
+	err: `invalid duration "d": expected a number followed by a unit`,
+}, {
+	in:  "100000000w",
+	err: `invalid duration "100000000w": duration too large`,
+}, {
+	in:  "P1Y",
+	err: `invalid duration "P1Y": years and months are not supported`,
+}, {
+	in:  "P1DT",
+	err: `invalid duration "P1DT": incomplete ISO 8601 duration`,
+}, {
+	in:  "PT1D",
+	err: `invalid duration "PT1D": unknown unit "D"`,
+}, {
+	in:  "PXD",
+	err: `invalid duration "PXD": malformed ISO 8601 duration`,
+}}
+
+func (*durationSuite) TestParseDuration(c *gc.C) {
+	for i, test := range parseDurationTests {
+		c.Logf("test %d: %q", i, test.in)
+		d, err := utils.ParseDuration(test.in)
+		if test.err != "" {
+			c.Check(err, gc.ErrorMatches, test.err)
+			continue
+		}
+		c.Check(err, jc.ErrorIsNil)
+		c.Check(d, gc.Equals, test.out)
+	}
+}
+
+func (*durationSuite) TestFormatDuration(c *gc.C) {
+	tests := []struct {
+		d   time.Duration
+		out string
+	}{
+		{0, "0s"},
+		{500 * time.Millisecond, "500ms"},
+		{90 * time.Second, "1m30s"},
+		{60 * time.Hour, "2d12h"},
+		{utils.Week + time.Hour + 1500*time.Millisecond, "1w1h1.5s"},
+		{-36 * time.Hour, "-1d12h"},
+	}
+	for i, test := range tests {
+		c.Logf("test %d: %v", i, test.d)
+		s := utils.FormatDuration(test.d)
+		c.Check(s, gc.Equals, test.out)
+		d, err := utils.ParseDuration(s)
+		c.Check(err, jc.ErrorIsNil)
+		c.Check(d, gc.Equals, test.d)
+	}
+}
+
+func (*durationSuite) TestHumanizeDuration(c *gc.C) {
+	tests := []struct {
+		d   time.Duration
+		out string
+	}{
+		{0, "less than a second"},
+		{time.Second, "1 second"},
+		{45 * time.Second, "45 seconds"},
+		{3 * time.Hour, "3 hours"},
+		{3*time.Hour + 10*time.Minute, "about 3 hours"},
+		{2*time.Hour + 40*time.Minute, "about 3 hours"},
+		{59*time.Minute + 45*time.Second, "about 1 hour"},
+		{-2 * utils.Day, "2 days"},
+		{6*utils.Day + 20*time.Hour, "about 1 week"},
+		{3 * utils.Week, "3 weeks"},
+	}
+	for i, test := range tests {
+		c.Logf("test %d: %v", i, test.d)
+		c.Check(utils.HumanizeDuration(test.d), gc.Equals, test.out)
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package errcode classifies the errors returned by the packages in
+// this module with machine-readable codes, so that callers can tell
+// why an operation failed without matching on error messages.
+//
+// Each code is itself an error, for use as the target of errors.Is:
+//
+//	if errors.Is(err, errcode.ErrHostKeyMismatch) {
+//		...
+//	}
+//
+// The version of github.com/juju/errors used by this module does not
+// support errors.Is, so an error wrapped by errors.Trace or
+// errors.Annotate from that package loses its code as far as
+// errors.Is is concerned. Is and Of follow juju/errors causes as well
+// as wrapped errors, and so work on such errors too. They also
+// recognise the typed errors of juju/errors, such as those made by
+// errors.NotFoundf, and some common standard library errors.
+package errcode
+
+import (
+	"context"
+	stderrors "errors"
+	"os"
+	"syscall"
+
+	"github.com/juju/errors"
+)
+
+// Code identifies a class of error.
+type Code string
+
+// Error implements error, returning the code itself.
+func (c Code) Error() string {
+	return string(c)
+}
+
+const (
+	// ErrHostKeyMismatch means a host presented a key other than
+	// the one known for it.
+	ErrHostKeyMismatch Code = "host-key-mismatch"
+
+	// ErrHostKeyUnknown means a host presented a key that is not
+	// known and that could not be trusted.
+	ErrHostKeyUnknown Code = "host-key-unknown"
+
+	// ErrAuthFailed means the client could not authenticate.
+	ErrAuthFailed Code = "auth-failed"
+
+	// ErrConnectionFailed means a connection could not be made.
+	ErrConnectionFailed Code = "connection-failed"
+
+	// ErrTimeout means an operation did not complete in time.
+	ErrTimeout Code = "timeout"
+
+	// ErrCancelled means an operation was cancelled.
+	ErrCancelled Code = "cancelled"
+
+	// ErrQuotaExceeded means a limit on a resource, such as
+	// disk space, was reached.
+	ErrQuotaExceeded Code = "quota-exceeded"
+
+	// ErrNotFound means something does not exist.
+	ErrNotFound Code = "not-found"
+
+	// ErrAlreadyExists means something exists that should not.
+	ErrAlreadyExists Code = "already-exists"
+
+	// ErrNotValid means a value or argument is not valid.
+	ErrNotValid Code = "not-valid"
+
+	// ErrForbidden means an operation is not allowed.
+	ErrForbidden Code = "forbidden"
+
+	// ErrUnsafePath means a path, such as that of an archive
+	// entry, leads out of the directory that should hold it.
+	ErrUnsafePath Code = "unsafe-path"
+
+	// ErrCorrupt means data is truncated or malformed.
+	ErrCorrupt Code = "corrupt"
+)
+
+// Error is an error with a code.
+type Error struct {
+	Code Code
+	Err  error
+}
+
+// New returns an error with the given code and message.
+func New(code Code, message string) error {
+	return &Error{Code: code, Err: stderrors.New(message)}
+}
+
+// Errorf returns an error with the given code and a message
+// formatted as by fmt.Errorf.
+func Errorf(code Code, format string, args ...interface{}) error {
+	return &Error{Code: code, Err: errors.Errorf(format, args...)}
+}
+
+// Wrap returns err with the given code. It returns nil
+// if err is nil.
+func Wrap(code Code, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Code: code, Err: err}
+}
+
+// Error implements error, returning the message of the wrapped error.
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the error's code, so that
+// errors.Is(err, code) reports whether err has the code.
+func (e *Error) Is(target error) bool {
+	code, ok := target.(Code)
+	return ok && code == e.Code
+}
+
+// Cause implements the causer interface of juju/errors. If the
+// wrapped error has a juju/errors type, such as one made by
+// errors.NotFoundf, that is its cause, so that predicates such as
+// errors.IsNotFound see through the code. Otherwise the error is its
+// own cause, so that the code survives errors.Trace and
+// errors.Annotate.
+func (e *Error) Cause() error {
+	if cause := errors.Cause(e.Err); jujuCode(cause) != "" {
+		return cause
+	}
+	return e
+}
+
+// Of returns the code of err, or the empty code if err is nil or
+// has no code.
+func Of(err error) Code {
+	for err != nil {
+		var e *Error
+		if stderrors.As(err, &e) {
+			return e.Code
+		}
+		var code Code
+		if stderrors.As(err, &code) {
+			return code
+		}
+		if code := jujuCode(err); code != "" {
+			return code
+		}
+		if code := stdlibCode(err); code != "" {
+			return code
+		}
+		cause := errors.Cause(err)
+		if cause == err {
+			break
+		}
+		err = cause
+	}
+	return ""
+}
+
+// Is reports whether err has the given code. Unlike errors.Is, it
+// sees through errors wrapped by juju/errors.
+func Is(err error, code Code) bool {
+	return err != nil && Of(err) == code
+}
+
+// jujuCode returns the code for the juju/errors type of err,
+// if it has one.
+func jujuCode(err error) Code {
+	switch {
+	case errors.IsNotFound(err):
+		return ErrNotFound
+	case errors.IsAlreadyExists(err):
+		return ErrAlreadyExists
+	case errors.IsNotValid(err):
+		return ErrNotValid
+	case errors.IsForbidden(err):
+		return ErrForbidden
+	case errors.IsUnauthorized(err):
+		return ErrAuthFailed
+	case errors.IsTimeout(err):
+		return ErrTimeout
+	case errors.IsQuotaLimitExceeded(err):
+		return ErrQuotaExceeded
+	}
+	return ""
+}
+
+// stdlibCode returns the code for some common errors
+// from the standard library.
+func stdlibCode(err error) Code {
+	var timeout interface{ Timeout() bool }
+	switch {
+	case stderrors.Is(err, context.Canceled):
+		return ErrCancelled
+	case stderrors.Is(err, context.DeadlineExceeded):
+		return ErrTimeout
+	case stderrors.Is(err, os.ErrNotExist):
+		return ErrNotFound
+	case stderrors.Is(err, os.ErrExist):
+		return ErrAlreadyExists
+	case stderrors.Is(err, os.ErrPermission):
+		return ErrForbidden
+	case stderrors.Is(err, syscall.ENOSPC):
+		return ErrQuotaExceeded
+	case stderrors.As(err, &timeout) && timeout.Timeout():
+		return ErrTimeout
+	}
+	return ""
+}
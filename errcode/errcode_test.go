@@ -0,0 +1,108 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package errcode_test
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/errcode"
+)
+
+type ErrcodeSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&ErrcodeSuite{})
+
+func (*ErrcodeSuite) TestNew(c *gc.C) {
+	err := errcode.New(errcode.ErrAuthFailed, "no keys")
+	c.Check(err, gc.ErrorMatches, "no keys")
+	c.Check(stderrors.Is(err, errcode.ErrAuthFailed), jc.IsTrue)
+	c.Check(stderrors.Is(err, errcode.ErrTimeout), jc.IsFalse)
+
+	var e *errcode.Error
+	c.Assert(stderrors.As(err, &e), jc.IsTrue)
+	c.Check(e.Code, gc.Equals, errcode.ErrAuthFailed)
+
+	err = errcode.Errorf(errcode.ErrCorrupt, "file %q truncated", "x")
+	c.Check(err, gc.ErrorMatches, `file "x" truncated`)
+	c.Check(errcode.Of(err), gc.Equals, errcode.ErrCorrupt)
+}
+
+func (*ErrcodeSuite) TestWrap(c *gc.C) {
+	c.Check(errcode.Wrap(errcode.ErrTimeout, nil), jc.ErrorIsNil)
+
+	underlying := stderrors.New("boom")
+	err := errcode.Wrap(errcode.ErrConnectionFailed, underlying)
+	c.Check(err, gc.ErrorMatches, "boom")
+	c.Check(stderrors.Is(err, underlying), jc.IsTrue)
+	c.Check(stderrors.Is(err, errcode.ErrConnectionFailed), jc.IsTrue)
+
+	// Wrapped in fmt.Errorf, the code is still visible.
+	err = fmt.Errorf("dialling: %w", err)
+	c.Check(stderrors.Is(err, errcode.ErrConnectionFailed), jc.IsTrue)
+	c.Check(errcode.Of(err), gc.Equals, errcode.ErrConnectionFailed)
+}
+
+func (*ErrcodeSuite) TestJujuErrors(c *gc.C) {
+	err := errcode.New(errcode.ErrHostKeyMismatch, "mismatch")
+	err = errors.Annotate(errors.Trace(err), "connecting")
+	c.Check(err, gc.ErrorMatches, "connecting: mismatch")
+	c.Check(errcode.Of(err), gc.Equals, errcode.ErrHostKeyMismatch)
+	c.Check(errcode.Is(err, errcode.ErrHostKeyMismatch), jc.IsTrue)
+
+	// A juju/errors type is still visible through a code.
+	err = errcode.Wrap(errcode.ErrNotFound, errors.NotFoundf("file %q", "x"))
+	c.Check(stderrors.Is(err, errcode.ErrNotFound), jc.IsTrue)
+	c.Check(err, jc.Satisfies, errors.IsNotFound)
+	err = errors.Trace(err)
+	c.Check(err, jc.Satisfies, errors.IsNotFound)
+	c.Check(errcode.Of(err), gc.Equals, errcode.ErrNotFound)
+}
+
+func (*ErrcodeSuite) TestOf(c *gc.C) {
+	for i, test := range []struct {
+		err  error
+		code errcode.Code
+	}{
+		{nil, ""},
+		{stderrors.New("unknown"), ""},
+		{errors.NotFoundf("x"), errcode.ErrNotFound},
+		{errors.AlreadyExistsf("x"), errcode.ErrAlreadyExists},
+		{errors.NotValidf("x"), errcode.ErrNotValid},
+		{errors.Forbiddenf("x"), errcode.ErrForbidden},
+		{errors.Unauthorizedf("x"), errcode.ErrAuthFailed},
+		{errors.Timeoutf("x"), errcode.ErrTimeout},
+		{errors.QuotaLimitExceededf("x"), errcode.ErrQuotaExceeded},
+		{errors.Annotate(errors.NotFoundf("x"), "y"), errcode.ErrNotFound},
+		{context.Canceled, errcode.ErrCancelled},
+		{context.DeadlineExceeded, errcode.ErrTimeout},
+		{&os.PathError{Op: "open", Path: "x", Err: syscall.ENOENT}, errcode.ErrNotFound},
+		{&os.PathError{Op: "mkdir", Path: "x", Err: syscall.EEXIST}, errcode.ErrAlreadyExists},
+		{&os.PathError{Op: "open", Path: "x", Err: syscall.EACCES}, errcode.ErrForbidden},
+		{&os.PathError{Op: "write", Path: "x", Err: syscall.ENOSPC}, errcode.ErrQuotaExceeded},
+		{errors.Annotate(syscall.ETIMEDOUT, "dial"), errcode.ErrTimeout},
+	} {
+		c.Logf("test %d: %v", i, test.err)
+		c.Check(errcode.Of(test.err), gc.Equals, test.code)
+		if test.code != "" {
+			c.Check(errcode.Is(test.err, test.code), jc.IsTrue)
+		}
+	}
+}
+
+func (*ErrcodeSuite) TestCodeError(c *gc.C) {
+	c.Check(errcode.ErrQuotaExceeded.Error(), gc.Equals, "quota-exceeded")
+	c.Check(errcode.Of(errcode.ErrQuotaExceeded), gc.Equals, errcode.ErrQuotaExceeded)
+	c.Check(errcode.Of(errors.Trace(errcode.ErrQuotaExceeded)), gc.Equals, errcode.ErrQuotaExceeded)
+}
@@ -6,7 +6,9 @@ package exec
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -19,6 +21,10 @@ import (
 	"github.com/juju/clock"
 	"github.com/juju/errors"
 	"github.com/juju/loggo"
+
+	"github.com/juju/utils/v3/errcode"
+	"github.com/juju/utils/v3/ringbuffer"
+	"github.com/juju/utils/v3/tracing"
 )
 
 var logger = loggo.GetLogger("juju.util.exec")
@@ -37,10 +43,26 @@ type RunParams struct {
 	KillProcess func(*os.Process) error
 	User        string
 
+	// Tracer, if set, reports each run of the commands as an
+	// "exec.run" span, from Run until Wait returns.
+	Tracer tracing.Tracer
+
+	// MergeOutput, if set, causes the lines written to stdout and
+	// stderr to be returned in ExecResponse.Output, interleaved
+	// in the order in which they were received and timestamped
+	// with Clock.
+	MergeOutput bool
+
+	// Tail, if set, receives everything written to stdout and
+	// stderr, so that the end of the output is retained in it.
+	Tail *ringbuffer.Buffer
+
 	tempDir string
 	stdout  *bytes.Buffer
 	stderr  *bytes.Buffer
+	merger  *outputMerger
 	ps      *exec.Cmd
+	span    tracing.Span
 }
 
 // ExecResponse contains the return code and output generated by executing a
@@ -49,6 +71,56 @@ type ExecResponse struct {
 	Code   int
 	Stdout []byte
 	Stderr []byte
+
+	// Output holds the lines written to stdout and stderr in the
+	// order in which they were received, if RunParams.MergeOutput
+	// was set. Lines written at almost the same time to different
+	// streams may be out of order, as the streams are read
+	// separately.
+	Output []OutputLine
+
+	// Usage holds the resources used by the command, including those
+	// used by any processes it waited for. It is nil if they are not
+	// known.
+	Usage *ResourceUsage
+}
+
+// ResourceUsage holds the resources used by a completed command.
+// Fields that are not available on the current platform are zero.
+type ResourceUsage struct {
+	// UserTime and SystemTime hold the CPU time spent
+	// in user and kernel mode.
+	UserTime   time.Duration
+	SystemTime time.Duration
+
+	// MaxRSS holds the largest resident set size, in bytes.
+	// It is not available on Windows.
+	MaxRSS int64
+
+	// InBlocks and OutBlocks hold the number of block input and
+	// output operations made by the file system. They are not
+	// available on Windows.
+	InBlocks  int64
+	OutBlocks int64
+}
+
+// CPUTime returns the total CPU time used.
+func (u ResourceUsage) CPUTime() time.Duration {
+	return u.UserTime + u.SystemTime
+}
+
+// resourceUsage returns the resources used by
+// the process described by state.
+func resourceUsage(state *os.ProcessState) *ResourceUsage {
+	if state == nil {
+		return nil
+	}
+	usage := &ResourceUsage{
+		UserTime:   state.UserTime(),
+		SystemTime: state.SystemTime(),
+	}
+	populateSysUsage(state, usage)
+	return usage
 }
 
 // mergeEnvironment takes in a string array representing the desired environment
@@ -127,6 +199,40 @@ func shellAndArgs(tempDir, script, user string) (string, []string, error) {
 // and starts the process. The commands are passed into bash on Linux machines
 // and to powershell on Windows machines.
 func (r *RunParams) Run() error {
+	attrs := []tracing.Attribute{tracing.String("exec.working_dir", r.WorkingDir)}
+	if r.User != "" {
+		attrs = append(attrs, tracing.String("exec.user", r.User))
+	}
+	_, r.span = tracing.Start(r.Tracer, context.Background(), "exec.run", attrs...)
+	if err := r.start(); err != nil {
+		r.endSpan(nil, err)
+		return err
+	}
+	r.span.SetAttributes(tracing.Int("exec.pid", int64(r.ps.Process.Pid)))
+	return nil
+}
+
+// endSpan ends the span of the run, if it has not already ended,
+// with its result.
+func (r *RunParams) endSpan(result *ExecResponse, err error) {
+	if r.span == nil {
+		return
+	}
+	if result != nil {
+		r.span.SetAttributes(tracing.Int("exec.exit_code", int64(result.Code)))
+		if u := result.Usage; u != nil {
+			r.span.SetAttributes(
+				tracing.Int("exec.user_time_ms", u.UserTime.Milliseconds()),
+				tracing.Int("exec.system_time_ms", u.SystemTime.Milliseconds()),
+				tracing.Int("exec.max_rss", u.MaxRSS),
+			)
+		}
+	}
+	r.span.End(err)
+	r.span = nil
+}
+
+func (r *RunParams) start() error {
 	if runtime.GOOS == "windows" {
 		r.Environment = mergeEnvironment(r.Environment)
 	}
@@ -166,6 +272,19 @@ func (r *RunParams) Run() error {
 
 	r.ps.Stdout = r.stdout
 	r.ps.Stderr = r.stderr
+	if r.MergeOutput {
+		_clock := r.Clock
+		if _clock == nil {
+			_clock = clock.WallClock
+		}
+		r.merger = newOutputMerger(_clock)
+		r.ps.Stdout = io.MultiWriter(r.stdout, r.merger.writer(Stdout))
+		r.ps.Stderr = io.MultiWriter(r.stderr, r.merger.writer(Stderr))
+	}
+	if r.Tail != nil {
+		r.ps.Stdout = io.MultiWriter(r.ps.Stdout, r.Tail)
+		r.ps.Stderr = io.MultiWriter(r.ps.Stderr, r.Tail)
+	}
 
 	return r.ps.Start()
 }
@@ -197,6 +316,10 @@ func (r *RunParams) Wait() (*ExecResponse, error) {
 	result := &ExecResponse{
 		Stdout: r.stdout.Bytes(),
 		Stderr: r.stderr.Bytes(),
+		Usage:  resourceUsage(r.ps.ProcessState),
+	}
+	if r.merger != nil {
+		result.Output = r.merger.finish()
 	}
 
 	if ee, ok := err.(*exec.ExitError); ok && err != nil {
@@ -208,12 +331,13 @@ func (r *RunParams) Wait() (*ExecResponse, error) {
 		}
 		logger.Infof("run result: %v", ee)
 	}
+	r.endSpan(result, err)
 	return result, err
 }
 
 // ErrCancelled is returned by WaitWithCancel in case it successfully manages to kill
-// the running process.
-var ErrCancelled = errors.New("command cancelled")
+// the running process. It has the code errcode.ErrCancelled.
+var ErrCancelled = errcode.New(errcode.ErrCancelled, "command cancelled")
 
 // timeWaitForKill reperesent the time we wait after attempting to kill a
 // process before bailing out and returning.
@@ -258,7 +382,7 @@ func (r *RunParams) WaitWithCancel(cancel <-chan struct{}) (*ExecResponse, error
 		case resWithError := <-done:
 			return resWithError.execResult, ErrCancelled
 		case <-_clock.After(timeWaitForKill):
-			return nil, errors.Errorf("tried to kill process %v, but timed out", r.ps.Process.Pid)
+			return nil, errcode.Errorf(errcode.ErrTimeout, "tried to kill process %v, but timed out", r.ps.Process.Pid)
 		}
 	}
 }
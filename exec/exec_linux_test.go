@@ -8,6 +8,8 @@ import (
 	gc "gopkg.in/check.v1"
 
 	"github.com/juju/utils/v3/exec"
+	"github.com/juju/utils/v3/ringbuffer"
+	"github.com/juju/utils/v3/tracing"
 )
 
 // 0 is thrown by linux because RunParams.Wait
@@ -88,6 +90,70 @@ func (*execSuite) TestRunCommands(c *gc.C) {
 	}
 }
 
+func (*execSuite) TestRunCommandsTracing(c *gc.C) {
+	var rec tracing.Recorder
+	dir := c.MkDir()
+	result, err := exec.RunCommands(exec.RunParams{
+		Commands:   "exit 3",
+		WorkingDir: dir,
+		Tracer:     &rec,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(result.Code, gc.Equals, 3)
+
+	spans := rec.Spans()
+	c.Assert(rec.Names(), jc.DeepEquals, []string{"exec.run"})
+	c.Check(spans[0].Attribute("exec.working_dir"), gc.Equals, dir)
+	c.Check(spans[0].Attribute("exec.pid"), gc.NotNil)
+	c.Check(spans[0].Attribute("exec.exit_code"), gc.Equals, int64(3))
+	c.Check(spans[0].Attribute("exec.max_rss"), gc.Equals, result.Usage.MaxRSS)
+	c.Check(spans[0].Ended, jc.IsTrue)
+	c.Check(spans[0].Err, jc.ErrorIsNil)
+}
+
+func (*execSuite) TestRunCommandsResourceUsage(c *gc.C) {
+	result, err := exec.RunCommands(exec.RunParams{
+		Commands: "i=0; while [ $i -lt 20000 ]; do i=$((i+1)); done",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(result.Usage, gc.NotNil)
+	c.Check(result.Usage.CPUTime() > 0, jc.IsTrue)
+	c.Check(result.Usage.CPUTime(), gc.Equals, result.Usage.UserTime+result.Usage.SystemTime)
+	// Bash alone needs more than a megabyte.
+	c.Check(result.Usage.MaxRSS > 1<<20, jc.IsTrue)
+}
+
+func (*execSuite) TestRunCommandsMergeOutput(c *gc.C) {
+	result, err := exec.RunCommands(exec.RunParams{
+		Commands:    "echo one; sleep 0.1; echo two >&2; sleep 0.1; echo three; sleep 0.1; printf four >&2",
+		MergeOutput: true,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(result.Stdout), gc.Equals, "one\nthree\n")
+	c.Check(string(result.Stderr), gc.Equals, "two\nfour")
+	var got []string
+	for i, line := range result.Output {
+		got = append(got, string(line.Source)+": "+line.Text)
+		if i > 0 {
+			c.Check(line.Time.Before(result.Output[i-1].Time), jc.IsFalse)
+		}
+	}
+	c.Check(got, jc.DeepEquals, []string{
+		"stdout: one",
+		"stderr: two",
+		"stdout: three",
+		"stderr: four",
+	})
+}
+
+func (*execSuite) TestRunCommandsWithoutMergeOutput(c *gc.C) {
+	result, err := exec.RunCommands(exec.RunParams{
+		Commands: "echo one",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(result.Output, gc.IsNil)
+}
+
 func (*execSuite) TestExecUnknownCommand(c *gc.C) {
 	result, err := exec.RunCommands(
 		exec.RunParams{
@@ -100,3 +166,14 @@ func (*execSuite) TestExecUnknownCommand(c *gc.C) {
 	// 127 is a special bash return code meaning command not found.
 	c.Assert(result.Code, gc.Equals, 127)
 }
+
+func (*execSuite) TestRunCommandsTail(c *gc.C) {
+	tail := ringbuffer.NewLines(2, 1024)
+	result, err := exec.RunCommands(exec.RunParams{
+		Commands: "echo one; echo two; sleep 0.1; echo three >&2",
+		Tail:     tail,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(result.Stdout), gc.Equals, "one\ntwo\n")
+	c.Check(tail.Snapshot().Lines(), jc.DeepEquals, []string{"two", "three"})
+}
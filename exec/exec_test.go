@@ -5,6 +5,7 @@
 package exec_test
 
 import (
+	stderrors "errors"
 	"fmt"
 	"os"
 	"time"
@@ -14,6 +15,7 @@ import (
 	gc "gopkg.in/check.v1"
 
 	"github.com/juju/clock"
+	"github.com/juju/utils/v3/errcode"
 	"github.com/juju/utils/v3/exec"
 )
 
@@ -38,6 +40,7 @@ func (*execSuite) TestWaitWithCancel(c *gc.C) {
 	cancelChan <- struct{}{}
 	result, err := params.WaitWithCancel(cancelChan)
 	c.Assert(err, gc.Equals, exec.ErrCancelled)
+	c.Check(stderrors.Is(err, errcode.ErrCancelled), jc.IsTrue)
 	c.Assert(string(result.Stdout), gc.Equals, "")
 	c.Assert(string(result.Stderr), gc.Equals, "")
 	c.Assert(result.Code, gc.Equals, cancelErrCode)
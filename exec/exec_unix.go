@@ -9,6 +9,7 @@ package exec
 
 import (
 	"os"
+	"runtime"
 	"syscall"
 )
 
@@ -30,3 +31,19 @@ func KillProcess(proc *os.Process) error {
 func (r *RunParams) populateSysProcAttr() {
 	r.ps.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 }
+
+// populateSysUsage sets the fields of usage that are
+// reported by wait4.
+func populateSysUsage(state *os.ProcessState, usage *ResourceUsage) {
+	rusage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok || rusage == nil {
+		return
+	}
+	// ru_maxrss is in bytes on Darwin and kilobytes elsewhere.
+	usage.MaxRSS = int64(rusage.Maxrss)
+	if runtime.GOOS != "darwin" && runtime.GOOS != "ios" {
+		usage.MaxRSS *= 1024
+	}
+	usage.InBlocks = int64(rusage.Inblock)
+	usage.OutBlocks = int64(rusage.Oublock)
+}
@@ -18,3 +18,7 @@ func KillProcess(proc *os.Process) error {
 
 // populateSysProcAttr is a noop on windows
 func (r *RunParams) populateSysProcAttr() {}
+
+// populateSysUsage does nothing on windows, where only the CPU times
+// reported by GetProcessTimes are available.
+func populateSysUsage(state *os.ProcessState, usage *ResourceUsage) {}
@@ -0,0 +1,106 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"github.com/juju/clock"
+)
+
+// OutputSource identifies the stream that a line of output was
+// written to.
+type OutputSource string
+
+// The sources of output.
+const (
+	Stdout OutputSource = "stdout"
+	Stderr OutputSource = "stderr"
+)
+
+// OutputLine holds a line of output written by a command.
+type OutputLine struct {
+	// Source holds the stream the line was written to.
+	Source OutputSource
+
+	// Time holds the time at which the end of the line was received.
+	Time time.Time
+
+	// Text holds the line, without its trailing newline.
+	Text string
+}
+
+// outputMerger collects the lines written to stdout and stderr into a
+// single sequence, in the order in which they are received.
+type outputMerger struct {
+	clock clock.Clock
+
+	mu      sync.Mutex
+	partial map[OutputSource][]byte
+	lines   []OutputLine
+}
+
+func newOutputMerger(clock clock.Clock) *outputMerger {
+	return &outputMerger{
+		clock:   clock,
+		partial: make(map[OutputSource][]byte),
+	}
+}
+
+// writer returns a writer that adds the lines written
+// to it as coming from source.
+func (m *outputMerger) writer(source OutputSource) *sourceWriter {
+	return &sourceWriter{merger: m, source: source}
+}
+
+func (m *outputMerger) write(source OutputSource, data []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	buf := append(m.partial[source], data...)
+	for {
+		i := bytes.IndexByte(buf, '\n')
+		if i < 0 {
+			break
+		}
+		m.add(source, buf[:i])
+		buf = buf[i+1:]
+	}
+	m.partial[source] = append([]byte(nil), buf...)
+}
+
+func (m *outputMerger) add(source OutputSource, line []byte) {
+	m.lines = append(m.lines, OutputLine{
+		Source: source,
+		Time:   m.clock.Now(),
+		Text:   string(bytes.TrimSuffix(line, []byte("\r"))),
+	})
+}
+
+// finish adds any unterminated lines, stdout first,
+// and returns all the lines.
+func (m *outputMerger) finish() []OutputLine {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, source := range []OutputSource{Stdout, Stderr} {
+		if len(m.partial[source]) > 0 {
+			m.add(source, m.partial[source])
+			m.partial[source] = nil
+		}
+	}
+	return m.lines
+}
+
+// sourceWriter is an io.Writer that passes
+// what is written to an outputMerger.
+type sourceWriter struct {
+	merger *outputMerger
+	source OutputSource
+}
+
+func (w *sourceWriter) Write(data []byte) (int, error) {
+	w.merger.write(w.source, data)
+	return len(data), nil
+}
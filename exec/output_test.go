@@ -0,0 +1,38 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"time"
+
+	"github.com/juju/clock/testclock"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type outputSuite struct{}
+
+var _ = gc.Suite(&outputSuite{})
+
+func (*outputSuite) TestOutputMerger(c *gc.C) {
+	t0 := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := testclock.NewClock(t0)
+	m := newOutputMerger(clock)
+	stdout, stderr := m.writer(Stdout), m.writer(Stderr)
+
+	stdout.Write([]byte("one\ntw"))
+	clock.Advance(time.Second)
+	stderr.Write([]byte("error\r\n"))
+	clock.Advance(time.Second)
+	stdout.Write([]byte("o\nthree"))
+	stderr.Write([]byte("unterminated"))
+
+	c.Assert(m.finish(), jc.DeepEquals, []OutputLine{
+		{Source: Stdout, Time: t0, Text: "one"},
+		{Source: Stderr, Time: t0.Add(time.Second), Text: "error"},
+		{Source: Stdout, Time: t0.Add(2 * time.Second), Text: "two"},
+		{Source: Stdout, Time: t0.Add(2 * time.Second), Text: "three"},
+		{Source: Stderr, Time: t0.Add(2 * time.Second), Text: "unterminated"},
+	})
+}
@@ -0,0 +1,222 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// Expander expands references to variables in strings, using the
+// parameter expansion syntax of POSIX shells:
+//
+//	$NAME, ${NAME}   the value of NAME, or "" if it is unset
+//	${NAME:-word}    word if NAME is unset or empty
+//	${NAME-word}     word if NAME is unset
+//	${NAME:+word}    word if NAME is set and not empty, otherwise ""
+//	${NAME+word}     word if NAME is set, otherwise ""
+//	${NAME:?message} an error if NAME is unset or empty
+//	${NAME?message}  an error if NAME is unset
+//	$$               a literal "$"
+//
+// Each word is expanded in turn, so defaults may refer to other
+// variables, as in ${HOST:-${DEFAULT_HOST}}. A "$" that does not
+// start a reference is left alone.
+type Expander struct {
+	// Lookup returns the value of the named variable and whether
+	// it is set. If it is nil, os.LookupEnv is used.
+	Lookup func(name string) (string, bool)
+
+	// Recursive specifies that the values of variables are
+	// expanded too. Variables whose values refer back to
+	// themselves cause an error.
+	Recursive bool
+}
+
+// ExpandEnv expands references to environment variables in s
+// as described for Expander.
+func ExpandEnv(s string) (string, error) {
+	return Expander{}.Expand(s)
+}
+
+// ExpandMap expands references to variables in s as described
+// for Expander, taking their values from vars and expanding
+// those values recursively.
+func ExpandMap(s string, vars map[string]string) (string, error) {
+	e := Expander{
+		Lookup: func(name string) (string, bool) {
+			v, ok := vars[name]
+			return v, ok
+		},
+		Recursive: true,
+	}
+	return e.Expand(s)
+}
+
+// Expand returns s with all variable references expanded. If a
+// required variable is not set, the error satisfies
+// errors.IsNotFound.
+func (e Expander) Expand(s string) (string, error) {
+	if e.Lookup == nil {
+		e.Lookup = os.LookupEnv
+	}
+	return e.expand(s, nil)
+}
+
+// expand expands s. The stack holds the names of the variables
+// whose values are currently being expanded.
+func (e Expander) expand(s string, stack []string) (string, error) {
+	var buf strings.Builder
+	for {
+		i := strings.IndexByte(s, '$')
+		if i < 0 || i == len(s)-1 {
+			buf.WriteString(s)
+			return buf.String(), nil
+		}
+		buf.WriteString(s[:i])
+		s = s[i+1:]
+		switch {
+		case s[0] == '$':
+			buf.WriteByte('$')
+			s = s[1:]
+		case s[0] == '{':
+			end := closingBrace(s)
+			if end < 0 {
+				return "", errors.Errorf("unterminated variable reference %q", "$"+s)
+			}
+			v, err := e.expandBraced(s[1:end], stack)
+			if err != nil {
+				return "", err
+			}
+			buf.WriteString(v)
+			s = s[end+1:]
+		case isNameStart(s[0]):
+			n := nameLen(s)
+			v, _, err := e.value(s[:n], stack)
+			if err != nil {
+				return "", err
+			}
+			buf.WriteString(v)
+			s = s[n:]
+		default:
+			buf.WriteByte('$')
+		}
+	}
+}
+
+// expandBraced expands the contents of a ${...} reference.
+func (e Expander) expandBraced(ref string, stack []string) (string, error) {
+	n := nameLen(ref)
+	if n == 0 {
+		return "", errors.Errorf("invalid variable reference %q", "${"+ref+"}")
+	}
+	name, op := ref[:n], ref[n:]
+	v, set, err := e.value(name, stack)
+	if err != nil {
+		return "", err
+	}
+	if op == "" {
+		return v, nil
+	}
+	checkEmpty := op[0] == ':'
+	if checkEmpty {
+		op = op[1:]
+	}
+	if op == "" {
+		return "", errors.Errorf("invalid variable reference %q", "${"+ref+"}")
+	}
+	word := op[1:]
+	present := set && (!checkEmpty || v != "")
+	switch op[0] {
+	case '-':
+		if present {
+			return v, nil
+		}
+		return e.expand(word, stack)
+	case '+':
+		if present {
+			return e.expand(word, stack)
+		}
+		return "", nil
+	case '?':
+		if present {
+			return v, nil
+		}
+		msg, err := e.expand(word, stack)
+		if err != nil {
+			return "", err
+		}
+		if msg == "" {
+			msg = "parameter null or not set"
+			if !checkEmpty {
+				msg = "parameter not set"
+			}
+		}
+		return "", errors.NewNotFound(nil, fmt.Sprintf("%s: %s", name, msg))
+	}
+	return "", errors.Errorf("invalid variable reference %q", "${"+ref+"}")
+}
+
+// value returns the value of the named variable, expanded if the
+// expander is recursive, and whether it is set.
+func (e Expander) value(name string, stack []string) (string, bool, error) {
+	v, ok := e.Lookup(name)
+	if !ok || !e.Recursive {
+		return v, ok, nil
+	}
+	for i, parent := range stack {
+		if parent == name {
+			loop := append(stack[i:len(stack):len(stack)], name)
+			return "", false, errors.Errorf("variable loop: %s", strings.Join(loop, " -> "))
+		}
+	}
+	v, err := e.expand(v, append(stack[:len(stack):len(stack)], name))
+	return v, true, err
+}
+
+// closingBrace returns the index of the brace closing the reference
+// that s starts with, allowing for nested references, or -1 if
+// there is none.
+func closingBrace(s string) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '$':
+			if i+1 < len(s) && (s[i+1] == '$' || s[i+1] == '{') {
+				if s[i+1] == '{' {
+					depth++
+				}
+				i++
+			}
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// nameLen returns the length of the variable name at the
+// start of s.
+func nameLen(s string) int {
+	if s == "" || !isNameStart(s[0]) {
+		return 0
+	}
+	i := 1
+	for i < len(s) && (isNameStart(s[i]) || '0' <= s[i] && s[i] <= '9') {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,118 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package utils_test
+
+import (
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3"
+)
+
+type expandSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&expandSuite{})
+
+var expandVars = map[string]string{
+	"HOME":  "/home/user",
+	"EMPTY": "",
+	"PORT":  "8080",
+}
+
+var expandTests = []struct {
+	input  string
+	expect string
+	err    string
+}{
+	{"no references", "no references", ""},
+	{"$HOME/bin", "/home/user/bin", ""},
+	{"${HOME}bin", "/home/userbin", ""},
+	{"$UNSET|${UNSET}", "|", ""},
+	{"$$HOME costs $5 or $", "$HOME costs $5 or $", ""},
+	{"${PORT:-80} ${UNSET:-80} ${EMPTY:-80}", "8080 80 80", ""},
+	{"${PORT-80} ${UNSET-80} ${EMPTY-80}", "8080 80 ", ""},
+	{"${PORT:+set} ${UNSET:+set} ${EMPTY:+set}", "set  ", ""},
+	{"${PORT+set} ${UNSET+set} ${EMPTY+set}", "set  set", ""},
+	{"${PORT:?} ${EMPTY?}", "8080 ", ""},
+	{"${UNSET:-${HOME}/x}", "/home/user/x", ""},
+	{"${UNSET:-${ALSO_UNSET:-deep}}", "deep", ""},
+	{"${UNSET:-$$}", "$", ""},
+	{"${EMPTY:?}", "", "EMPTY: parameter null or not set"},
+	{"${UNSET?}", "", "UNSET: parameter not set"},
+	{"${UNSET:?please set $HOME}", "", "UNSET: please set /home/user"},
+	{"${HOME", "", `unterminated variable reference "\${HOME"`},
+	{"${}", "", `invalid variable reference "\${}"`},
+	{"${1}", "", `invalid variable reference "\$\{1\}"`},
+	{"${HOME:}", "", `invalid variable reference "\${HOME:}"`},
+	{"${HOME/x}", "", `invalid variable reference "\${HOME/x}"`},
+}
+
+func (*expandSuite) TestExpand(c *gc.C) {
+	e := utils.Expander{
+		Lookup: func(name string) (string, bool) {
+			v, ok := expandVars[name]
+			return v, ok
+		},
+	}
+	for i, test := range expandTests {
+		c.Logf("test %d: %q", i, test.input)
+		got, err := e.Expand(test.input)
+		if test.err != "" {
+			c.Check(err, gc.ErrorMatches, test.err)
+			continue
+		}
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(got, gc.Equals, test.expect)
+	}
+}
+
+func (*expandSuite) TestRequiredIsNotFound(c *gc.C) {
+	_, err := utils.ExpandMap("${NAME:?}", nil)
+	c.Check(err, jc.Satisfies, errors.IsNotFound)
+}
+
+func (*expandSuite) TestNonRecursive(c *gc.C) {
+	e := utils.Expander{
+		Lookup: func(name string) (string, bool) { return "$" + name, true },
+	}
+	got, err := e.Expand("$A ${B}")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(got, gc.Equals, "$A $B")
+}
+
+func (*expandSuite) TestExpandMapRecursive(c *gc.C) {
+	vars := map[string]string{
+		"DATA":  "${BASE}/data",
+		"BASE":  "${ROOT:-/var}/lib/${APP}",
+		"APP":   "juju",
+		"EMPTY": "",
+		"OPT":   "${EMPTY:-$APP}",
+	}
+	got, err := utils.ExpandMap("$DATA $OPT $APP$APP", vars)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(got, gc.Equals, "/var/lib/juju/data juju jujujuju")
+}
+
+func (*expandSuite) TestExpandMapLoop(c *gc.C) {
+	vars := map[string]string{
+		"A": "x${B}",
+		"B": "${C:-$A}",
+		"D": "$D",
+	}
+	_, err := utils.ExpandMap("start $A", vars)
+	c.Check(err, gc.ErrorMatches, "variable loop: A -> B -> A")
+	_, err = utils.ExpandMap("${D:-x}", vars)
+	c.Check(err, gc.ErrorMatches, "variable loop: D -> D")
+}
+
+func (s *expandSuite) TestExpandEnv(c *gc.C) {
+	s.PatchEnvironment("JUJU_EXPAND_TEST", "value")
+	got, err := utils.ExpandEnv("${JUJU_EXPAND_TEST}:${JUJU_EXPAND_UNSET:-default}")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(got, gc.Equals, "value:default")
+}
@@ -11,6 +11,14 @@ var (
 	GOMAXPROCS        = &gomaxprocs
 	NumCPU            = &numCPU
 	ResolveSudoByFunc = resolveSudo
+	UUIDNow           = &uuidNow
+
+	OSHostname         = &osHostname
+	LookupCNAME        = &lookupCNAME
+	LookupHost         = &lookupHost
+	LookupAddr         = &lookupAddr
+	PlatformMachineID  = &platformMachineID
+	InterfaceAddresses = interfaceAddresses
 )
 
 func ExposeBackoffTimerDuration(bot *BackoffTimer) time.Duration {
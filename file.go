@@ -13,6 +13,8 @@ import (
 	"regexp"
 
 	"github.com/juju/errors"
+
+	"github.com/juju/utils/v3/vfs"
 )
 
 // UserHomeDir returns the home directory for the specified user, or the
@@ -118,6 +120,10 @@ func CopyFile(dest, source string) error {
 // given contents and calls the given function after the contents were
 // written, but before the file is renamed.
 func AtomicWriteFileAndChange(filename string, contents []byte, change func(string) error) (err error) {
+	return atomicWriteFile(filename, contents, change, ReplaceFile, false)
+}
+
+func atomicWriteFile(filename string, contents []byte, change func(string) error, replace func(string, string) error, syncDir bool) (err error) {
 	dir, file := filepath.Split(filename)
 	f, err := ioutil.TempFile(dir, file)
 	if err != nil {
@@ -145,9 +151,14 @@ func AtomicWriteFileAndChange(filename string, contents []byte, change func(stri
 	if err := change(f.Name()); err != nil {
 		return err
 	}
-	if err := ReplaceFile(f.Name(), filename); err != nil {
+	if err := replace(f.Name(), filename); err != nil {
 		return fmt.Errorf("cannot replace %q with %q: %v", f.Name(), filename, err)
 	}
+	if syncDir {
+		if err := syncDirectory(filepath.Dir(filename)); err != nil {
+			return fmt.Errorf("cannot sync directory of %q: %v", filename, err)
+		}
+	}
 	return nil
 }
 
@@ -163,3 +174,130 @@ func AtomicWriteFile(filename string, contents []byte, perms os.FileMode) (err e
 		return nil
 	})
 }
+
+// AtomicWriteFileFS is like AtomicWriteFile but writes the file in
+// fsys. The new contents are written to a temporary file in the same
+// directory, which is then renamed over filename.
+func AtomicWriteFileFS(fsys vfs.FS, filename string, contents []byte, perms os.FileMode) (err error) {
+	if fsys == vfs.OS {
+		return AtomicWriteFile(filename, contents, perms)
+	}
+	dir, file := filepath.Split(filename)
+	var f vfs.File
+	for i := 0; ; i++ {
+		name := filepath.Join(dir, fmt.Sprintf("%s.%s", file, RandomString(8, LowerAlpha)))
+		f, err = fsys.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) || i >= 10000 {
+			return fmt.Errorf("cannot create temp file: %v", err)
+		}
+	}
+	defer func() {
+		if err != nil {
+			// Don't leave the temp file lying around on error.
+			f.Close()
+			fsys.Remove(f.Name())
+		}
+	}()
+	if _, err := f.Write(contents); err != nil {
+		return fmt.Errorf("cannot write %q contents: %v", filename, err)
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := fsys.Chmod(f.Name(), perms); err != nil {
+		return fmt.Errorf("cannot set permissions: %v", err)
+	}
+	if err := fsys.Rename(f.Name(), filename); err != nil {
+		return fmt.Errorf("cannot replace %q with %q: %v", f.Name(), filename, err)
+	}
+	return nil
+}
+
+// FileOwner holds the numeric user and group ids that own a file.
+type FileOwner struct {
+	UID int
+	GID int
+}
+
+// AtomicWriteOptions holds options for AtomicWriteFileWithOptions.
+type AtomicWriteOptions struct {
+	// Perms holds the permissions of the new file.
+	Perms os.FileMode
+
+	// Owner, if not nil, holds the owner to give the new file.
+	// Ownership is not changed on Windows.
+	Owner *FileOwner
+
+	// PreserveOwner, if true, gives the new file the same owner as
+	// the file it replaces, if any. It is ignored if Owner is set.
+	// Only root may give files to other users.
+	PreserveOwner bool
+
+	// PreserveAttributes, if true, gives the new file the extended
+	// attributes of the file it replaces, if any. On Linux this
+	// includes the SELinux security context. On Windows the file is
+	// replaced with ReplaceFile, which keeps the attributes, access
+	// control lists and alternate data streams of the replaced file.
+	PreserveAttributes bool
+
+	// SyncDir, if true, causes the directory containing the file to
+	// be synced after the file has been renamed into place, so that
+	// the rename itself is durable. It has no effect on Windows,
+	// where the rename is always written through.
+	SyncDir bool
+
+	// Change, if not nil, is called with the name of the temporary
+	// file once all the above have been applied, before it is
+	// renamed into place.
+	Change func(string) error
+}
+
+// AtomicWriteFileWithOptions atomically writes the filename with the
+// given contents, replacing any existing file at the same path. The
+// contents are always synced to disk before the file is renamed into
+// place; the options determine how the metadata of the new file is set
+// and whether the rename is synced too.
+func AtomicWriteFileWithOptions(filename string, contents []byte, opts AtomicWriteOptions) error {
+	var existing os.FileInfo
+	if opts.PreserveOwner || opts.PreserveAttributes {
+		info, err := os.Stat(filename)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		existing = info
+	}
+	replace := ReplaceFile
+	if opts.PreserveAttributes && existing != nil {
+		replace = replacePreservingAttributes
+	}
+	return atomicWriteFile(filename, contents, func(f string) error {
+		if err := os.Chmod(f, opts.Perms); err != nil {
+			return fmt.Errorf("cannot set permissions: %v", err)
+		}
+		switch {
+		case opts.Owner != nil:
+			if err := chownFile(f, *opts.Owner); err != nil {
+				return fmt.Errorf("cannot set owner: %v", err)
+			}
+		case opts.PreserveOwner && existing != nil:
+			if err := copyFileOwner(f, existing); err != nil {
+				return fmt.Errorf("cannot set owner: %v", err)
+			}
+		}
+		if opts.PreserveAttributes && existing != nil {
+			if err := copyFileAttributes(f, filename); err != nil {
+				return fmt.Errorf("cannot copy extended attributes: %v", err)
+			}
+		}
+		if opts.Change != nil {
+			return opts.Change(f)
+		}
+		return nil
+	}, replace, opts.SyncDir)
+}
@@ -9,12 +9,14 @@ import (
 	"os"
 	"os/user"
 	"path/filepath"
+	"runtime"
 
 	"github.com/juju/testing"
 	jc "github.com/juju/testing/checkers"
 	gc "gopkg.in/check.v1"
 
 	"github.com/juju/utils/v3"
+	"github.com/juju/utils/v3/vfs"
 )
 
 type fileSuite struct {
@@ -245,6 +247,74 @@ func (*fileSuite) TestAtomicWriteFile(c *gc.C) {
 	}
 }
 
+func (*fileSuite) TestAtomicWriteFileFS(c *gc.C) {
+	fsys := vfs.NewMemFS()
+	c.Assert(fsys.MkdirAll("/etc", 0755), jc.ErrorIsNil)
+
+	err := utils.AtomicWriteFileFS(fsys, "/etc/test.file", []byte("some\ncontents"), 0640)
+	c.Assert(err, jc.ErrorIsNil)
+	err = utils.AtomicWriteFileFS(fsys, "/etc/test.file", []byte("new\ncontents"), 0600)
+	c.Assert(err, jc.ErrorIsNil)
+
+	data, err := vfs.ReadFile(fsys, "/etc/test.file")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(data), gc.Equals, "new\ncontents")
+	infos, err := fsys.ReadDir("/etc")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(infos, gc.HasLen, 1)
+	c.Check(infos[0].Name(), gc.Equals, "test.file")
+	c.Check(infos[0].Mode().Perm(), gc.Equals, os.FileMode(0600))
+}
+
+func (*fileSuite) TestAtomicWriteFileFSNoDirectory(c *gc.C) {
+	fsys := vfs.NewMemFS()
+	err := utils.AtomicWriteFileFS(fsys, "/etc/test.file", []byte("contents"), 0640)
+	c.Assert(err, gc.ErrorMatches, "cannot create temp file: .*")
+}
+
+func (*fileSuite) TestAtomicWriteFileWithOptions(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "test.file")
+	var changed string
+	opts := utils.AtomicWriteOptions{
+		Perms:   0600,
+		SyncDir: true,
+		Change: func(name string) error {
+			changed = name
+			return nil
+		},
+	}
+	for _, contents := range []string{"first", "second"} {
+		err := utils.AtomicWriteFileWithOptions(path, []byte(contents), opts)
+		c.Assert(err, jc.ErrorIsNil)
+		data, err := ioutil.ReadFile(path)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(string(data), gc.Equals, contents)
+		c.Check(filepath.Dir(changed), gc.Equals, filepath.Dir(path))
+		_, err = os.Stat(changed)
+		c.Check(err, jc.Satisfies, os.IsNotExist)
+	}
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(info.Mode().Perm(), gc.Equals, os.FileMode(0600))
+	}
+}
+
+func (*fileSuite) TestAtomicWriteFileWithOptionsChangeError(c *gc.C) {
+	dir := c.MkDir()
+	path := filepath.Join(dir, "test.file")
+	err := utils.AtomicWriteFileWithOptions(path, []byte("contents"), utils.AtomicWriteOptions{
+		Perms: 0644,
+		Change: func(string) error {
+			return fmt.Errorf("pow!")
+		},
+	})
+	c.Assert(err, gc.ErrorMatches, "pow!")
+	fis, err := ioutil.ReadDir(dir)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(fis, gc.HasLen, 0)
+}
+
 func (*fileSuite) TestMoveFile(c *gc.C) {
 	d := c.MkDir()
 	dest := filepath.Join(d, "foo")
@@ -50,6 +50,42 @@ func ReplaceFile(source, destination string) error {
 	return os.Rename(source, destination)
 }
 
+// replacePreservingAttributes replaces the destination file with the
+// source. The attributes of the destination have already been copied
+// to the source, so this is the same as ReplaceFile.
+func replacePreservingAttributes(source, destination string) error {
+	return ReplaceFile(source, destination)
+}
+
+// syncDirectory flushes the directory entries of dir to disk.
+func syncDirectory(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// chownFile sets the owner of path.
+func chownFile(path string, owner FileOwner) error {
+	return os.Chown(path, owner.UID, owner.GID)
+}
+
+// copyFileOwner gives path the owner of the file described by info.
+// Only root can give files away, so it does nothing if the owner
+// already matches.
+func copyFileOwner(path string, info os.FileInfo) error {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	if int(st.Uid) == os.Geteuid() && int(st.Gid) == os.Getegid() {
+		return nil
+	}
+	return os.Chown(path, int(st.Uid), int(st.Gid))
+}
+
 // MakeFileURL returns a file URL if a directory is passed in else it does nothing
 func MakeFileURL(in string) string {
 	if strings.HasPrefix(in, "/") {
@@ -10,8 +10,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"syscall"
 	"time"
 
+	jc "github.com/juju/testing/checkers"
 	gc "gopkg.in/check.v1"
 
 	"github.com/juju/errors"
@@ -71,3 +73,51 @@ func (s *unixFileSuite) TestFileOwnerWithInvalidUsername(c *gc.C) {
 	c.Assert(errors.Cause(err), gc.ErrorMatches, "user: unknown user invalid")
 	c.Assert(ok, gc.Equals, false)
 }
+
+func (s *unixFileSuite) TestAtomicWriteFileWithOptionsOwner(c *gc.C) {
+	if os.Geteuid() != 0 {
+		c.Skip("only root can change file ownership")
+	}
+	path := filepath.Join(c.MkDir(), "test.file")
+	owner := &utils.FileOwner{UID: 1234, GID: 5678}
+	err := utils.AtomicWriteFileWithOptions(path, []byte("first"), utils.AtomicWriteOptions{
+		Perms: 0644,
+		Owner: owner,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	s.checkOwner(c, path, 1234, 5678)
+
+	// The owner is kept when the file is replaced.
+	err = utils.AtomicWriteFileWithOptions(path, []byte("second"), utils.AtomicWriteOptions{
+		Perms:         0644,
+		PreserveOwner: true,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	s.checkOwner(c, path, 1234, 5678)
+
+	// But not by default.
+	err = utils.AtomicWriteFileWithOptions(path, []byte("third"), utils.AtomicWriteOptions{
+		Perms: 0644,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	s.checkOwner(c, path, os.Geteuid(), os.Getegid())
+}
+
+func (s *unixFileSuite) TestAtomicWriteFileWithOptionsPreserveOwnerNewFile(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "test.file")
+	err := utils.AtomicWriteFileWithOptions(path, []byte("first"), utils.AtomicWriteOptions{
+		Perms:              0644,
+		PreserveOwner:      true,
+		PreserveAttributes: true,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	s.checkOwner(c, path, os.Geteuid(), os.Getegid())
+}
+
+func (*unixFileSuite) checkOwner(c *gc.C, path string, uid, gid int) {
+	info, err := os.Stat(path)
+	c.Assert(err, jc.ErrorIsNil)
+	st := info.Sys().(*syscall.Stat_t)
+	c.Check(int(st.Uid), gc.Equals, uid)
+	c.Check(int(st.Gid), gc.Equals, gid)
+}
@@ -22,6 +22,7 @@ const (
 )
 
 //sys moveFileEx(lpExistingFileName *uint16, lpNewFileName *uint16, dwFlags uint32) (err error) = MoveFileExW
+//sys replaceFileW(lpReplacedFileName *uint16, lpReplacementFileName *uint16, lpBackupFileName *uint16, dwReplaceFlags uint32, lpExclude uintptr, lpReserved uintptr) (err error) = ReplaceFileW
 
 // MoveFile atomically moves the source file to the destination, returning
 // whether the file was moved successfully. If the destination already exists,
@@ -63,6 +64,49 @@ func ReplaceFile(source, destination string) error {
 	return nil
 }
 
+// replacePreservingAttributes replaces the existing destination file
+// with the source using ReplaceFile, which keeps the attributes, access
+// control lists and alternate data streams of the destination.
+func replacePreservingAttributes(source, destination string) error {
+	src, err := syscall.UTF16PtrFromString(source)
+	if err != nil {
+		return &os.LinkError{Op: "replace", Old: source, New: destination, Err: err}
+	}
+	dest, err := syscall.UTF16PtrFromString(destination)
+	if err != nil {
+		return &os.LinkError{Op: "replace", Old: source, New: destination, Err: err}
+	}
+
+	// see https://docs.microsoft.com/en-us/windows/win32/api/winbase/nf-winbase-replacefilew
+	if err := replaceFileW(dest, src, nil, 0, 0, 0); err != nil {
+		return &os.LinkError{Op: "replace", Old: source, New: destination, Err: err}
+	}
+	return nil
+}
+
+// syncDirectory does nothing on Windows, where directories cannot be
+// synced, and renames are written through.
+func syncDirectory(dir string) error {
+	return nil
+}
+
+// chownFile does nothing on Windows. See ChownPath.
+func chownFile(path string, owner FileOwner) error {
+	return nil
+}
+
+// copyFileOwner does nothing on Windows. See ChownPath.
+func copyFileOwner(path string, info os.FileInfo) error {
+	return nil
+}
+
+// copyFileAttributes does nothing on Windows, where
+// replacePreservingAttributes keeps the attributes of the
+// replaced file.
+func copyFileAttributes(path, from string) error {
+	return nil
+}
+
 // MakeFileURL returns a proper file URL for the given path/directory
 func MakeFileURL(in string) string {
 	in = filepath.ToSlash(in)
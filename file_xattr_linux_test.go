@@ -0,0 +1,48 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package utils_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	"golang.org/x/sys/unix"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3"
+)
+
+type xattrSuite struct{}
+
+var _ = gc.Suite(&xattrSuite{})
+
+func (*xattrSuite) TestAtomicWriteFileWithOptionsPreserveAttributes(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "test.file")
+	err := ioutil.WriteFile(path, []byte("first"), 0644)
+	c.Assert(err, jc.ErrorIsNil)
+	err = unix.Setxattr(path, "user.juju-test", []byte("value"), 0)
+	if err == unix.ENOTSUP {
+		c.Skip("extended attributes not supported")
+	}
+	c.Assert(err, jc.ErrorIsNil)
+
+	err = utils.AtomicWriteFileWithOptions(path, []byte("second"), utils.AtomicWriteOptions{
+		Perms:              0644,
+		PreserveAttributes: true,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	buf := make([]byte, 100)
+	n, err := unix.Getxattr(path, "user.juju-test", buf)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(buf[:n]), gc.Equals, "value")
+
+	// Without the option, the attributes are lost.
+	err = utils.AtomicWriteFileWithOptions(path, []byte("third"), utils.AtomicWriteOptions{
+		Perms: 0644,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = unix.Getxattr(path, "user.juju-test", buf)
+	c.Check(err, gc.Equals, unix.ENODATA)
+}
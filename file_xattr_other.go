@@ -0,0 +1,13 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package utils
+
+// copyFileAttributes does nothing on this platform,
+// where extended attributes are not supported.
+func copyFileAttributes(path, from string) error {
+	return nil
+}
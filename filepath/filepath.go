@@ -13,11 +13,12 @@ import (
 
 // Renderer provides methods for the different functions in
 // the stdlib path/filepath package that don't relate to a concrete
-// filesystem. So Abs, EvalSymlinks, Glob, Rel, and Walk are not
-// included. Also, while the functions in path/filepath relate to the
-// current host, the PathRenderer methods relate to the renderer's
-// target platform. So for example, a windows-oriented implementation
-// will give windows-specific results even when used on linux.
+// filesystem. So Abs, EvalSymlinks, and Walk are not included, and
+// Glob reads directories through a caller-supplied function. Also,
+// while the functions in path/filepath relate to the current host, the
+// PathRenderer methods relate to the renderer's target platform. So for
+// example, a windows-oriented implementation will give windows-specific
+// results even when used on linux.
 type Renderer interface {
 	// Base mimics path/filepath.
 	Base(path string) string
@@ -34,6 +35,12 @@ type Renderer interface {
 	// FromSlash mimics path/filepath.
 	FromSlash(path string) string
 
+	// Glob mimics path/filepath, except that directories are listed
+	// using the given readDir function rather than read from the local
+	// filesystem. This allows the pattern to be matched against a
+	// filesystem on a remote machine.
+	Glob(pattern string, readDir func(dir string) ([]string, error)) (matches []string, err error)
+
 	// IsAbs mimics path/filepath.
 	IsAbs(path string) bool
 
@@ -48,6 +55,10 @@ type Renderer interface {
 	// it converts the path to lowercase.
 	NormCase(path string) string
 
+	// Rel mimics path/filepath. It is purely lexical, so on Windows
+	// path elements are compared case-insensitively.
+	Rel(basepath, targpath string) (string, error)
+
 	// Split mimics path/filepath.
 	Split(path string) (dir, file string)
 
@@ -7,25 +7,32 @@
 package filepath
 
 import (
+	"errors"
 	"strings"
 )
 
 // The following functions are adapted from the GO stdlib source.
 
+// isSeparator reports whether c is a path separator for a platform
+// whose primary separator is sep. Windows also accepts '/'.
+func isSeparator(sep, c uint8) bool {
+	return c == sep || sep == WindowsSeparator && c == '/'
+}
+
 // Base mimics path/filepath for the given path separator.
 func Base(sep uint8, volumeName func(string) string, path string) string {
 	if path == "" {
 		return "."
 	}
 	// Strip trailing slashes.
-	for len(path) > 0 && path[len(path)-1] == sep {
+	for len(path) > 0 && isSeparator(sep, path[len(path)-1]) {
 		path = path[0 : len(path)-1]
 	}
 	// Throw away volume name
 	path = path[len(volumeName(path)):]
 	// Find the last element
 	i := len(path) - 1
-	for i >= 0 && path[i] != sep {
+	for i >= 0 && !isSeparator(sep, path[i]) {
 		i--
 	}
 	if i >= 0 {
@@ -89,7 +96,7 @@ func Clean(sep uint8, volumeName func(string) string, path string) string {
 		}
 		return originalPath + "."
 	}
-	rooted := (path[0] == sep)
+	rooted := isSeparator(sep, path[0])
 
 	// Invariants:
 	//  reading from path; r is index of next byte to process.
@@ -106,13 +113,13 @@ func Clean(sep uint8, volumeName func(string) string, path string) string {
 
 	for r < n {
 		switch {
-		case path[r] == sep:
+		case isSeparator(sep, path[r]):
 			// empty path element
 			r++
-		case path[r] == '.' && (r+1 == n || path[r+1] == sep):
+		case path[r] == '.' && (r+1 == n || isSeparator(sep, path[r+1])):
 			// . element
 			r++
-		case path[r] == '.' && path[r+1] == '.' && (r+2 == n || path[r+2] == sep):
+		case path[r] == '.' && path[r+1] == '.' && (r+2 == n || isSeparator(sep, path[r+2])):
 			// .. element: remove to last separator
 			r += 2
 			switch {
@@ -138,7 +145,7 @@ func Clean(sep uint8, volumeName func(string) string, path string) string {
 				out.append(sep)
 			}
 			// copy element
-			for ; r < n && path[r] != sep; r++ {
+			for ; r < n && !isSeparator(sep, path[r]); r++ {
 				out.append(path[r])
 			}
 		}
@@ -156,7 +163,7 @@ func Clean(sep uint8, volumeName func(string) string, path string) string {
 func Dir(sep uint8, volumeName func(string) string, path string) string {
 	vol := volumeName(path)
 	i := len(path) - 1
-	for i >= len(vol) && path[i] != sep {
+	for i >= len(vol) && !isSeparator(sep, path[i]) {
 		i--
 	}
 	dir := Clean(sep, volumeName, path[len(vol):i+1])
@@ -165,7 +172,7 @@ func Dir(sep uint8, volumeName func(string) string, path string) string {
 
 // Ext mimics path/filepath for the given path separator.
 func Ext(sep uint8, path string) string {
-	for i := len(path) - 1; i >= 0 && path[i] != sep; i-- {
+	for i := len(path) - 1; i >= 0 && !isSeparator(sep, path[i]); i-- {
 		if path[i] == '.' {
 			return path[i:]
 		}
@@ -195,7 +202,7 @@ func Join(sep uint8, volumeName func(string) string, elem ...string) string {
 func Split(sep uint8, volumeName func(string) string, path string) (dir, file string) {
 	vol := volumeName(path)
 	i := len(path) - 1
-	for i >= len(vol) && path[i] != sep {
+	for i >= len(vol) && !isSeparator(sep, path[i]) {
 		i--
 	}
 	return path[:i+1], path[i+1:]
@@ -208,3 +215,82 @@ func ToSlash(sep uint8, path string) string {
 	}
 	return strings.Replace(path, string(sep), "/", -1)
 }
+
+// Rel mimics path/filepath for the given path separator. Path elements
+// are compared case-insensitively on Windows.
+func Rel(sep uint8, volumeName func(string) string, basepath, targpath string) (string, error) {
+	base := Clean(sep, volumeName, basepath)
+	targ := Clean(sep, volumeName, targpath)
+	sameWord := func(a, b string) bool {
+		if sep == WindowsSeparator {
+			return strings.EqualFold(a, b)
+		}
+		return a == b
+	}
+	if sameWord(targ, base) {
+		return ".", nil
+	}
+	baseVol := volumeName(base)
+	targVol := volumeName(targ)
+	base = base[len(baseVol):]
+	targ = targ[len(targVol):]
+	if base == "." {
+		base = ""
+	} else if base == "" && len(baseVol) > 2 {
+		// Treat any targetpath matching `\\host\share` basepath as absolute path.
+		base = string(sep)
+	}
+	// Can't use IsAbs - `\a` and `a` are both relative in Windows.
+	baseSlashed := len(base) > 0 && base[0] == sep
+	targSlashed := len(targ) > 0 && targ[0] == sep
+	if baseSlashed != targSlashed || !sameWord(baseVol, targVol) {
+		return "", errors.New("Rel: can't make " + targpath + " relative to " + basepath)
+	}
+	// Position base[b0:bi] and targ[t0:ti] at the first differing elements.
+	bl := len(base)
+	tl := len(targ)
+	var b0, bi, t0, ti int
+	for {
+		for bi < bl && base[bi] != sep {
+			bi++
+		}
+		for ti < tl && targ[ti] != sep {
+			ti++
+		}
+		if !sameWord(targ[t0:ti], base[b0:bi]) {
+			break
+		}
+		if bi < bl {
+			bi++
+		}
+		if ti < tl {
+			ti++
+		}
+		b0 = bi
+		t0 = ti
+	}
+	if base[b0:bi] == ".." {
+		return "", errors.New("Rel: can't make " + targpath + " relative to " + basepath)
+	}
+	if b0 != bl {
+		// Base elements left. Must go up before going down.
+		seps := strings.Count(base[b0:bl], string(sep))
+		size := 2 + seps*3
+		if tl != t0 {
+			size += 1 + tl - t0
+		}
+		buf := make([]byte, size)
+		n := copy(buf, "..")
+		for i := 0; i < seps; i++ {
+			buf[n] = sep
+			copy(buf[n+1:], "..")
+			n += 3
+		}
+		if t0 != tl {
+			buf[n] = sep
+			copy(buf[n+1:], targ[t0:])
+		}
+		return string(buf), nil
+	}
+	return targ[t0:], nil
+}
@@ -8,6 +8,7 @@ package filepath
 
 import (
 	"path/filepath"
+	"sort"
 	"strings"
 	"unicode/utf8"
 )
@@ -220,3 +221,121 @@ func getEsc(sep uint8, chunk string) (r rune, nchunk string, err error) {
 	}
 	return
 }
+
+// Glob returns the names of all files matching pattern or nil if there
+// is no matching file. The syntax of patterns is the same as in Match.
+// The pattern may describe hierarchical names such as /usr/*/bin/ed.
+//
+// Rather than reading the local filesystem, Glob lists directories with
+// the given readDir function, which must return the names of the entries
+// in the directory it is passed. Glob ignores errors from readDir, such
+// as the directory not existing. The only possible returned error is
+// ErrBadPattern, when pattern is malformed.
+func Glob(sep uint8, volumeName func(string) string, pattern string, readDir func(dir string) ([]string, error)) (matches []string, err error) {
+	// Check pattern is well-formed.
+	if _, err := Match(sep, pattern, ""); err != nil {
+		return nil, err
+	}
+	if !hasMeta(sep, pattern) {
+		if !globExists(sep, volumeName, pattern, readDir) {
+			return nil, nil
+		}
+		return []string{pattern}, nil
+	}
+
+	dir, file := Split(sep, volumeName, pattern)
+	volumeLen, dir := cleanGlobPath(sep, volumeName, dir)
+
+	if !hasMeta(sep, dir[volumeLen:]) {
+		return glob(sep, volumeName, dir, file, nil, readDir)
+	}
+
+	// Prevent infinite recursion.
+	if dir == pattern {
+		return nil, filepath.ErrBadPattern
+	}
+
+	var m []string
+	m, err = Glob(sep, volumeName, dir, readDir)
+	if err != nil {
+		return
+	}
+	for _, d := range m {
+		matches, err = glob(sep, volumeName, d, file, matches, readDir)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// cleanGlobPath prepares path for glob matching.
+func cleanGlobPath(sep uint8, volumeName func(string) string, path string) (prefixLen int, cleaned string) {
+	vollen := len(volumeName(path))
+	switch {
+	case path == "":
+		return 0, "."
+	case vollen+1 == len(path) && isSeparator(sep, path[len(path)-1]): // /, \, C:\ and C:/
+		return vollen + 1, path // do nothing
+	case vollen == len(path) && len(path) == 2: // C:
+		return vollen, path + "." // convert C: into C:.
+	default:
+		if vollen >= len(path) {
+			vollen = len(path) - 1
+		}
+		return vollen, path[0 : len(path)-1] // chop off trailing separator
+	}
+}
+
+// glob searches for files matching pattern in the directory dir
+// and appends them to matches.
+func glob(sep uint8, volumeName func(string) string, dir, pattern string, matches []string, readDir func(string) ([]string, error)) (m []string, e error) {
+	m = matches
+	names, err := readDir(dir)
+	if err != nil {
+		return
+	}
+	sort.Strings(names)
+
+	for _, n := range names {
+		matched, err := Match(sep, pattern, n)
+		if err != nil {
+			return m, err
+		}
+		if matched {
+			m = append(m, Join(sep, volumeName, dir, n))
+		}
+	}
+	return
+}
+
+// globExists reports whether the file at path exists, by looking
+// for it in the listing of its parent directory.
+func globExists(sep uint8, volumeName func(string) string, path string, readDir func(string) ([]string, error)) bool {
+	dir, file := Split(sep, volumeName, path)
+	if file == "" {
+		_, err := readDir(path)
+		return err == nil
+	}
+	_, dir = cleanGlobPath(sep, volumeName, dir)
+	names, err := readDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, n := range names {
+		if n == file || sep == WindowsSeparator && strings.EqualFold(n, file) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasMeta reports whether path contains any of the magic characters
+// recognized by Match.
+func hasMeta(sep uint8, path string) bool {
+	magicChars := `*?[`
+	if sep != WindowsSeparator {
+		magicChars = `*?[\`
+	}
+	return strings.ContainsAny(path, magicChars)
+}
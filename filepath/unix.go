@@ -47,6 +47,11 @@ func (UnixRenderer) IsAbs(path string) bool {
 	return strings.HasPrefix(path, string(UnixSeparator))
 }
 
+// Glob implements Renderer.
+func (ur UnixRenderer) Glob(pattern string, readDir func(dir string) ([]string, error)) (matches []string, err error) {
+	return Glob(UnixSeparator, ur.VolumeName, pattern, readDir)
+}
+
 // Join implements Renderer.
 func (ur UnixRenderer) Join(path ...string) string {
 	return Join(UnixSeparator, ur.VolumeName, path...)
@@ -57,6 +62,11 @@ func (UnixRenderer) Match(pattern, name string) (matched bool, err error) {
 	return Match(UnixSeparator, pattern, name)
 }
 
+// Rel implements Renderer.
+func (ur UnixRenderer) Rel(basepath, targpath string) (string, error) {
+	return Rel(UnixSeparator, ur.VolumeName, basepath, targpath)
+}
+
 // Split implements Renderer.
 func (ur UnixRenderer) Split(path string) (dir, file string) {
 	return Split(UnixSeparator, ur.VolumeName, path)
@@ -6,6 +6,7 @@ package filepath_test
 import (
 	gofilepath "path/filepath"
 
+	"github.com/juju/errors"
 	"github.com/juju/testing"
 	jc "github.com/juju/testing/checkers"
 	gc "gopkg.in/check.v1"
@@ -102,6 +103,90 @@ func (s unixSuite) TestSplitSuffix(c *gc.C) {
 	c.Check(suffix, gc.Equals, ".ext")
 }
 
+func (s unixSuite) TestCleanBackslashes(c *gc.C) {
+	// Backslashes are not separators on unix.
+	path := s.renderer.Clean(`a\b/../c\d`)
+
+	c.Check(path, gc.Equals, `c\d`)
+}
+
+func (s unixSuite) TestRel(c *gc.C) {
+	tests := []struct {
+		base, targ, expected string
+	}{
+		{"/a/b", "/a/b/c", "c"},
+		{"/a/b", "/a/x/y", "../x/y"},
+		{"/a/b", "/a/b", "."},
+		{"a/b", "a/c", "../c"},
+		{"/", "/a", "a"},
+		{".", "a/b", "a/b"},
+	}
+	for _, test := range tests {
+		c.Logf("checking %q relative to %q", test.targ, test.base)
+		rel, err := s.renderer.Rel(test.base, test.targ)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(rel, gc.Equals, test.expected)
+		if s.matchesRuntime() {
+			gorel, err := gofilepath.Rel(test.base, test.targ)
+			c.Assert(err, jc.ErrorIsNil)
+			c.Check(rel, gc.Equals, gorel)
+		}
+	}
+}
+
+func (s unixSuite) TestRelError(c *gc.C) {
+	// Unix paths are case-sensitive, so /A is unrelated to /a.
+	rel, err := s.renderer.Rel("/a/b", "/A/B")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(rel, gc.Equals, "../../A/B")
+
+	_, err = s.renderer.Rel("/a", "a")
+	c.Check(err, gc.ErrorMatches, "Rel: can't make a relative to /a")
+	_, err = s.renderer.Rel("../a", "a")
+	c.Check(err, gc.ErrorMatches, `Rel: can't make a relative to \.\./a`)
+}
+
+func (s unixSuite) TestGlob(c *gc.C) {
+	dirs := map[string][]string{
+		"/":           {"etc", "home"},
+		"/etc":        {"hosts", "passwd", "ssh"},
+		"/etc/ssh":    {"ssh_config", "sshd_config"},
+		"/home":       {"bob", "alice"},
+		"/home/bob":   {"notes.txt"},
+		"/home/alice": {"Notes.txt"},
+	}
+	readDir := func(dir string) ([]string, error) {
+		names, ok := dirs[dir]
+		if !ok {
+			return nil, errors.NotFoundf("directory %q", dir)
+		}
+		return names, nil
+	}
+
+	matches, err := s.renderer.Glob("/home/*/notes.txt", readDir)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(matches, jc.DeepEquals, []string{"/home/bob/notes.txt"})
+
+	matches, err = s.renderer.Glob("/etc/ssh/*_config", readDir)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(matches, jc.DeepEquals, []string{"/etc/ssh/ssh_config", "/etc/ssh/sshd_config"})
+
+	matches, err = s.renderer.Glob("/etc/hosts", readDir)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(matches, jc.DeepEquals, []string{"/etc/hosts"})
+
+	matches, err = s.renderer.Glob("/etc/missing", readDir)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(matches, gc.HasLen, 0)
+
+	matches, err = s.renderer.Glob("/[eh]*", readDir)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(matches, jc.DeepEquals, []string{"/etc", "/home"})
+
+	_, err = s.renderer.Glob("/etc/[", readDir)
+	c.Check(err, gc.Equals, gofilepath.ErrBadPattern)
+}
+
 // unixThinWrapperSuite contains test methods for UnixRenderer methods
 // that are just thin wrappers around the corresponding helpers in the
 // filepath package. As such the test coverage is minimal (more of a
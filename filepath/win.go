@@ -55,6 +55,11 @@ func (WindowsRenderer) IsAbs(path string) bool {
 	return isSlash(path[0])
 }
 
+// Glob implements Renderer.
+func (ur WindowsRenderer) Glob(pattern string, readDir func(dir string) ([]string, error)) (matches []string, err error) {
+	return Glob(WindowsSeparator, ur.VolumeName, pattern, readDir)
+}
+
 // Join implements Renderer.
 func (ur WindowsRenderer) Join(path ...string) string {
 	return Join(WindowsSeparator, ur.VolumeName, path...)
@@ -65,6 +70,11 @@ func (WindowsRenderer) Match(pattern, name string) (matched bool, err error) {
 	return Match(WindowsSeparator, pattern, name)
 }
 
+// Rel implements Renderer.
+func (ur WindowsRenderer) Rel(basepath, targpath string) (string, error) {
+	return Rel(WindowsSeparator, ur.VolumeName, basepath, targpath)
+}
+
 // Split implements Renderer.
 func (ur WindowsRenderer) Split(path string) (dir, file string) {
 	return Split(WindowsSeparator, ur.VolumeName, path)
@@ -136,6 +146,19 @@ func volumeNameLen(path string) int {
 	if path[1] == ':' && ('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z') {
 		return 2
 	}
+	// is it a DOS device path, such as \\.\C: or \\?\UNC\server\share
+	if l := len(path); l >= 4 && isSlash(path[0]) && isSlash(path[1]) &&
+		(path[2] == '.' || path[2] == '?') && isSlash(path[3]) {
+		if l >= 8 && strings.EqualFold(path[4:7], "UNC") && isSlash(path[7]) {
+			// the volume is the server and share following the prefix.
+			return 8 + uncShareLen(path[8:])
+		}
+		n := 4
+		for n < l && !isSlash(path[n]) {
+			n++
+		}
+		return n
+	}
 	// is it UNC
 	if l := len(path); l >= 5 && isSlash(path[0]) && isSlash(path[1]) &&
 		!isSlash(path[2]) && path[2] != '.' {
@@ -162,3 +185,18 @@ func volumeNameLen(path string) int {
 	}
 	return 0
 }
+
+// uncShareLen returns the length of the leading server\share
+// element pair of path, or 0 if path does not start with one.
+func uncShareLen(path string) int {
+	n := 0
+	for n < len(path) && !isSlash(path[n]) {
+		n++
+	}
+	if n == 0 || n+1 >= len(path) || isSlash(path[n+1]) {
+		return 0
+	}
+	for n++; n < len(path) && !isSlash(path[n]); n++ {
+	}
+	return n
+}
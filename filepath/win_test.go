@@ -6,6 +6,7 @@ package filepath_test
 import (
 	gofilepath "path/filepath"
 
+	"github.com/juju/errors"
 	"github.com/juju/testing"
 	jc "github.com/juju/testing/checkers"
 	gc "gopkg.in/check.v1"
@@ -106,6 +107,117 @@ func (s windowsSuite) TestSplitSuffix(c *gc.C) {
 	c.Check(suffix, gc.Equals, ".ext")
 }
 
+func (s windowsSuite) TestVolumeNameForms(c *gc.C) {
+	tests := map[string]string{
+		`c:`:                     `c:`,
+		`C:/a/b`:                 `C:`,
+		`\\server\share\a`:       `\\server\share`,
+		`//server/share/a`:       `//server/share`,
+		`\\.\C:\a`:               `\\.\C:`,
+		`\\?\C:\a`:               `\\?\C:`,
+		`\\?\UNC\server\share\a`: `\\?\UNC\server\share`,
+		`\a\b`:                   "",
+		`a\b`:                    "",
+	}
+	for path, expected := range tests {
+		c.Logf("checking %q", path)
+		c.Check(s.renderer.VolumeName(path), gc.Equals, expected)
+	}
+}
+
+func (s windowsSuite) TestCleanForwardSlashes(c *gc.C) {
+	tests := map[string]string{
+		`c:/a/b/../c`:           `c:\a\c`,
+		`c:\a/./b\`:             `c:\a\b`,
+		`/a//b`:                 `\a\b`,
+		`//server/share/a/../b`: `\\server\share\b`,
+		`\\?\C:\a\..\..\b`:      `\\?\C:\b`,
+		`a/../../b`:             `..\b`,
+	}
+	for path, expected := range tests {
+		c.Logf("checking %q", path)
+		c.Check(s.renderer.Clean(path), gc.Equals, expected)
+	}
+}
+
+func (s windowsSuite) TestBaseDirForwardSlashes(c *gc.C) {
+	c.Check(s.renderer.Base(`c:/a/b/c.xyz`), gc.Equals, "c.xyz")
+	c.Check(s.renderer.Dir(`c:/a/b/c.xyz`), gc.Equals, `c:\a\b`)
+	c.Check(s.renderer.Ext(`c:/a.b/c`), gc.Equals, "")
+}
+
+func (s windowsSuite) TestRel(c *gc.C) {
+	tests := []struct {
+		base, targ, expected string
+	}{
+		{`c:\a\b`, `c:\a\b\c`, `c`},
+		{`c:\a\b`, `C:\A\B\c`, `c`},
+		{`c:\a\b`, `c:/a/x/y`, `..\x\y`},
+		{`c:\a\b`, `c:\a\b`, `.`},
+		{`a\b`, `a\c`, `..\c`},
+		{`\\host\share`, `\\host\share\foo`, `foo`},
+	}
+	for _, test := range tests {
+		c.Logf("checking %q relative to %q", test.targ, test.base)
+		rel, err := s.renderer.Rel(test.base, test.targ)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(rel, gc.Equals, test.expected)
+	}
+}
+
+func (s windowsSuite) TestRelError(c *gc.C) {
+	tests := []struct {
+		base, targ string
+	}{
+		{`c:\a`, `d:\a`},
+		{`c:\a`, `a`},
+		{`\a`, `a`},
+		{`..`, `a`},
+	}
+	for _, test := range tests {
+		c.Logf("checking %q relative to %q", test.targ, test.base)
+		_, err := s.renderer.Rel(test.base, test.targ)
+		c.Check(err, gc.ErrorMatches, "Rel: can't make .* relative to .*")
+	}
+}
+
+func (s windowsSuite) TestGlob(c *gc.C) {
+	dirs := map[string][]string{
+		`c:\`:             {"Users", "Windows"},
+		`c:\Users`:        {"bob", "alice", "Public"},
+		`c:\Users\alice`:  {"a.txt", "b.log"},
+		`c:\Users\bob`:    {"c.txt"},
+		`c:\Users\Public`: {},
+		`c:\Windows`:      {"System32"},
+	}
+	readDir := func(dir string) ([]string, error) {
+		names, ok := dirs[dir]
+		if !ok {
+			return nil, errors.NotFoundf("directory %q", dir)
+		}
+		return names, nil
+	}
+
+	matches, err := s.renderer.Glob(`c:\Users\*\*.txt`, readDir)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(matches, jc.DeepEquals, []string{`c:\Users\alice\a.txt`, `c:\Users\bob\c.txt`})
+
+	matches, err = s.renderer.Glob(`c:\*`, readDir)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(matches, jc.DeepEquals, []string{`c:\Users`, `c:\Windows`})
+
+	matches, err = s.renderer.Glob(`c:\users\BOB\c.txt`, readDir)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(matches, gc.HasLen, 0)
+
+	matches, err = s.renderer.Glob(`c:\Users\bob\C.TXT`, readDir)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(matches, jc.DeepEquals, []string{`c:\Users\bob\C.TXT`})
+
+	_, err = s.renderer.Glob(`c:\Users\[`, readDir)
+	c.Check(err, gc.Equals, gofilepath.ErrBadPattern)
+}
+
 // windowsThinWrapperSuite contains test methods for WindowsRenderer methods
 // that are just thin wrappers around the corresponding helpers in the
 // filepath package. As such the test coverage is minimal (more of a
@@ -33,5 +33,9 @@ The doc storage is responsible to generating the unique IDs.  The raw
 file storage defers to the doc storage for any information about the
 file, including the ID.
 
+Files that are no longer wanted can be removed with CollectGarbage,
+which applies a RetentionPolicy to the stored files and removes any
+raw files that have no metadata.
+
 */
 package filestorage
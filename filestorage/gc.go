@@ -0,0 +1,228 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package filestorage
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/juju/clock"
+	"github.com/juju/errors"
+)
+
+// FileLister is implemented by RawFileStorage systems that can list
+// the IDs of the files they hold.  Garbage collection uses it to find
+// files that have no corresponding metadata.
+type FileLister interface {
+	// ListFiles returns the IDs of all the stored files.
+	ListFiles() ([]string, error)
+}
+
+// RetentionPolicy describes which stored files are kept when garbage
+// is collected.  A file is kept if any of the rules retains it.  If
+// neither KeepLast nor KeepNewerThan is set, every file is kept.
+//
+// Only metadata with a stored file is subject to the policy; metadata
+// still waiting for its file is always kept.
+type RetentionPolicy struct {
+	// KeepLast, if positive, retains that many of the most
+	// recently stored files.
+	KeepLast int
+
+	// KeepNewerThan, if positive, retains files stored less than
+	// that long ago.
+	KeepNewerThan time.Duration
+
+	// Pinned holds the IDs of files that are always retained.
+	Pinned []string
+}
+
+// Validate checks that the policy makes sense.
+func (p RetentionPolicy) Validate() error {
+	if p.KeepLast < 0 {
+		return errors.NotValidf("negative KeepLast %d", p.KeepLast)
+	}
+	if p.KeepNewerThan < 0 {
+		return errors.NotValidf("negative KeepNewerThan %v", p.KeepNewerThan)
+	}
+	return nil
+}
+
+// GCConfig holds the parameters for CollectGarbage.
+type GCConfig struct {
+	// Metadata holds the metadata of the stored files.
+	Metadata MetadataStorage
+
+	// Files holds the stored files.  If it implements FileLister,
+	// files without metadata are removed too.
+	Files RawFileStorage
+
+	// Policy determines which files are kept.
+	Policy RetentionPolicy
+
+	// DryRun specifies that nothing is removed; the report
+	// describes what would have been.
+	DryRun bool
+
+	// Clock is used to determine the age of files.  If it is nil,
+	// clock.WallClock is used.
+	Clock clock.Clock
+
+	// Lock is held while garbage is collected.  Code that adds
+	// files to the same storage should share it, so that files are
+	// not removed while their metadata is being added.  If it is
+	// nil, a lock shared by all collections in the process is used.
+	Lock sync.Locker
+}
+
+// Validate checks that the config is usable.
+func (config GCConfig) Validate() error {
+	if config.Metadata == nil {
+		return errors.NotValidf("nil Metadata")
+	}
+	if config.Files == nil {
+		return errors.NotValidf("nil Files")
+	}
+	return errors.Trace(config.Policy.Validate())
+}
+
+// GCReport describes the outcome of a garbage collection.
+type GCReport struct {
+	// DryRun records whether the collection was a dry run, in which
+	// case nothing listed in the report was actually removed.
+	DryRun bool
+
+	// Removed holds the metadata of the files removed because the
+	// retention policy did not keep them, oldest first.
+	Removed []Metadata
+
+	// Orphans holds the IDs of the files removed because they had
+	// no metadata.
+	Orphans []string
+}
+
+// gcLock is used when GCConfig.Lock is nil.
+var gcLock sync.Mutex
+
+// CollectGarbage removes the files (and their metadata) that are not
+// retained by the configured policy, followed by any files that have
+// no metadata.  If a removal fails, the returned report describes
+// what was removed before the failure.
+func CollectGarbage(config GCConfig) (*GCReport, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if config.Clock == nil {
+		config.Clock = clock.WallClock
+	}
+	lock := config.Lock
+	if lock == nil {
+		lock = &gcLock
+	}
+	lock.Lock()
+	defer lock.Unlock()
+
+	metaList, err := config.Metadata.ListMetadata()
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot list metadata")
+	}
+	var orphans []string
+	if lister, ok := config.Files.(FileLister); ok {
+		ids, err := lister.ListFiles()
+		if err != nil {
+			return nil, errors.Annotate(err, "cannot list files")
+		}
+		orphans = findOrphans(ids, metaList)
+	}
+
+	report := &GCReport{
+		DryRun:  config.DryRun,
+		Removed: config.Policy.expired(metaList, config.Clock.Now()),
+		Orphans: orphans,
+	}
+	if config.DryRun {
+		return report, nil
+	}
+
+	stor := &fileStorage{
+		metaStorage: config.Metadata,
+		rawStorage:  config.Files,
+	}
+	for i, meta := range report.Removed {
+		if err := stor.Remove(meta.ID()); err != nil {
+			report.Removed = report.Removed[:i]
+			report.Orphans = nil
+			return report, errors.Annotatef(err, "cannot remove %q", meta.ID())
+		}
+	}
+	for i, id := range report.Orphans {
+		err := config.Files.RemoveFile(id)
+		if err != nil && !errors.IsNotFound(err) {
+			report.Orphans = report.Orphans[:i]
+			return report, errors.Annotatef(err, "cannot remove orphaned file %q", id)
+		}
+	}
+	return report, nil
+}
+
+// expired returns the stored metadata in metaList that the policy
+// does not retain, oldest first.
+func (p RetentionPolicy) expired(metaList []Metadata, now time.Time) []Metadata {
+	if p.KeepLast == 0 && p.KeepNewerThan == 0 {
+		return nil
+	}
+	var stored []Metadata
+	for _, meta := range metaList {
+		if meta.Stored() != nil {
+			stored = append(stored, meta)
+		}
+	}
+	// Sort newest first, so that the first KeepLast are retained.
+	// A zero timestamp sorts as the oldest.
+	sort.SliceStable(stored, func(i, j int) bool {
+		ti, tj := stored[i].Stored(), stored[j].Stored()
+		if !ti.Equal(*tj) {
+			return ti.After(*tj)
+		}
+		return stored[i].ID() < stored[j].ID()
+	})
+
+	pinned := make(map[string]bool)
+	for _, id := range p.Pinned {
+		pinned[id] = true
+	}
+	var expired []Metadata
+	for i, meta := range stored {
+		switch {
+		case pinned[meta.ID()]:
+		case i < p.KeepLast:
+		case p.KeepNewerThan > 0 && now.Sub(*meta.Stored()) < p.KeepNewerThan:
+		default:
+			expired = append(expired, meta)
+		}
+	}
+	// Report the oldest first.
+	for i, j := 0, len(expired)-1; i < j; i, j = i+1, j-1 {
+		expired[i], expired[j] = expired[j], expired[i]
+	}
+	return expired
+}
+
+// findOrphans returns the file IDs in ids that have no
+// metadata in metaList, sorted.
+func findOrphans(ids []string, metaList []Metadata) []string {
+	known := make(map[string]bool)
+	for _, meta := range metaList {
+		known[meta.ID()] = true
+	}
+	var orphans []string
+	for _, id := range ids {
+		if !known[id] {
+			orphans = append(orphans, id)
+		}
+	}
+	sort.Strings(orphans)
+	return orphans
+}
@@ -0,0 +1,297 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package filestorage_test
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/juju/clock/testclock"
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/filestorage"
+	"github.com/juju/utils/v3/vfs"
+)
+
+var _ = gc.Suite(&GCSuite{})
+
+type GCSuite struct {
+	testing.IsolationSuite
+	clock *testclock.Clock
+	meta  *memMetadataStorage
+	files filestorage.RawFileStorage
+}
+
+var gcEpoch = time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func (s *GCSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.clock = testclock.NewClock(gcEpoch)
+	s.meta = &memMetadataStorage{docs: make(map[string]filestorage.Metadata)}
+	files, err := filestorage.NewDirStorage(vfs.NewMemFS(), "/files")
+	c.Assert(err, jc.ErrorIsNil)
+	s.files = files
+}
+
+// add stores a file and its metadata, stored the given time ago.
+func (s *GCSuite) add(c *gc.C, id string, age time.Duration) {
+	meta := filestorage.NewMetadata()
+	meta.SetID(id)
+	stored := gcEpoch.Add(-age)
+	meta.SetStored(&stored)
+	_, err := s.meta.AddMetadata(meta)
+	c.Assert(err, jc.ErrorIsNil)
+	err = s.files.AddFile(id, bytes.NewBufferString(id), -1)
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *GCSuite) config(policy filestorage.RetentionPolicy) filestorage.GCConfig {
+	return filestorage.GCConfig{
+		Metadata: s.meta,
+		Files:    s.files,
+		Policy:   policy,
+		Clock:    s.clock,
+	}
+}
+
+func (s *GCSuite) checkFiles(c *gc.C, ids ...string) {
+	listed, err := s.files.(filestorage.FileLister).ListFiles()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(listed, jc.SameContents, ids)
+}
+
+func reportIDs(metaList []filestorage.Metadata) []string {
+	var ids []string
+	for _, meta := range metaList {
+		ids = append(ids, meta.ID())
+	}
+	return ids
+}
+
+func (s *GCSuite) TestKeepLast(c *gc.C) {
+	for i := 1; i <= 5; i++ {
+		s.add(c, fmt.Sprintf("f%d", i), time.Duration(i)*time.Hour)
+	}
+	report, err := filestorage.CollectGarbage(s.config(filestorage.RetentionPolicy{KeepLast: 2}))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(report.DryRun, jc.IsFalse)
+	c.Check(reportIDs(report.Removed), jc.DeepEquals, []string{"f5", "f4", "f3"})
+	c.Check(report.Orphans, gc.HasLen, 0)
+	c.Check(s.meta.ids(), jc.DeepEquals, []string{"f1", "f2"})
+	s.checkFiles(c, "f1", "f2")
+}
+
+func (s *GCSuite) TestKeepNewerThan(c *gc.C) {
+	s.add(c, "new", time.Minute)
+	s.add(c, "recent", 59*time.Minute)
+	s.add(c, "old", time.Hour)
+	report, err := filestorage.CollectGarbage(s.config(filestorage.RetentionPolicy{KeepNewerThan: time.Hour}))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(reportIDs(report.Removed), jc.DeepEquals, []string{"old"})
+	c.Check(s.meta.ids(), jc.DeepEquals, []string{"new", "recent"})
+	s.checkFiles(c, "new", "recent")
+}
+
+func (s *GCSuite) TestRulesCombine(c *gc.C) {
+	s.add(c, "a", time.Minute)
+	s.add(c, "b", 2*time.Hour)
+	s.add(c, "c", 3*time.Hour)
+	s.add(c, "d", 4*time.Hour)
+	report, err := filestorage.CollectGarbage(s.config(filestorage.RetentionPolicy{
+		KeepLast:      2,
+		KeepNewerThan: time.Hour,
+		Pinned:        []string{"d"},
+	}))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(reportIDs(report.Removed), jc.DeepEquals, []string{"c"})
+	c.Check(s.meta.ids(), jc.DeepEquals, []string{"a", "b", "d"})
+}
+
+func (s *GCSuite) TestPinned(c *gc.C) {
+	s.add(c, "a", time.Hour)
+	s.add(c, "b", 2*time.Hour)
+	report, err := filestorage.CollectGarbage(s.config(filestorage.RetentionPolicy{
+		KeepNewerThan: time.Minute,
+		Pinned:        []string{"b"},
+	}))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(reportIDs(report.Removed), jc.DeepEquals, []string{"a"})
+	s.checkFiles(c, "b")
+}
+
+func (s *GCSuite) TestEmptyPolicyKeepsEverything(c *gc.C) {
+	s.add(c, "a", 1000*time.Hour)
+	report, err := filestorage.CollectGarbage(s.config(filestorage.RetentionPolicy{}))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(report.Removed, gc.HasLen, 0)
+	s.checkFiles(c, "a")
+}
+
+func (s *GCSuite) TestMetadataWithoutFileKept(c *gc.C) {
+	s.add(c, "a", time.Hour)
+	meta := filestorage.NewMetadata()
+	meta.SetID("pending")
+	_, err := s.meta.AddMetadata(meta)
+	c.Assert(err, jc.ErrorIsNil)
+
+	report, err := filestorage.CollectGarbage(s.config(filestorage.RetentionPolicy{KeepNewerThan: time.Minute}))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(reportIDs(report.Removed), jc.DeepEquals, []string{"a"})
+	c.Check(s.meta.ids(), jc.DeepEquals, []string{"pending"})
+}
+
+func (s *GCSuite) TestOrphans(c *gc.C) {
+	s.add(c, "a", time.Hour)
+	err := s.files.AddFile("orphan", bytes.NewBufferString("x"), -1)
+	c.Assert(err, jc.ErrorIsNil)
+
+	report, err := filestorage.CollectGarbage(s.config(filestorage.RetentionPolicy{}))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(report.Removed, gc.HasLen, 0)
+	c.Check(report.Orphans, jc.DeepEquals, []string{"orphan"})
+	s.checkFiles(c, "a")
+}
+
+func (s *GCSuite) TestDryRun(c *gc.C) {
+	s.add(c, "a", time.Minute)
+	s.add(c, "b", 2*time.Hour)
+	err := s.files.AddFile("orphan", bytes.NewBufferString("x"), -1)
+	c.Assert(err, jc.ErrorIsNil)
+
+	config := s.config(filestorage.RetentionPolicy{KeepLast: 1})
+	config.DryRun = true
+	report, err := filestorage.CollectGarbage(config)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(report.DryRun, jc.IsTrue)
+	c.Check(reportIDs(report.Removed), jc.DeepEquals, []string{"b"})
+	c.Check(report.Orphans, jc.DeepEquals, []string{"orphan"})
+	c.Check(s.meta.ids(), jc.DeepEquals, []string{"a", "b"})
+	s.checkFiles(c, "a", "b", "orphan")
+}
+
+func (s *GCSuite) TestFilesWithoutLister(c *gc.C) {
+	s.add(c, "a", time.Hour)
+	config := s.config(filestorage.RetentionPolicy{KeepNewerThan: time.Minute})
+	raw := &FakeRawFileStorage{}
+	config.Files = raw
+	report, err := filestorage.CollectGarbage(config)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(reportIDs(report.Removed), jc.DeepEquals, []string{"a"})
+	c.Check(report.Orphans, gc.HasLen, 0)
+	raw.Check(c, "a", nil, 0, "RemoveFile")
+}
+
+func (s *GCSuite) TestRemoveError(c *gc.C) {
+	s.add(c, "a", 2*time.Hour)
+	s.add(c, "b", time.Hour)
+	s.meta.removeErr = errors.New("boom")
+	report, err := filestorage.CollectGarbage(s.config(filestorage.RetentionPolicy{KeepNewerThan: time.Minute}))
+	c.Check(err, gc.ErrorMatches, `cannot remove "a": boom`)
+	c.Check(report.Removed, gc.HasLen, 0)
+}
+
+func (s *GCSuite) TestUsesLock(c *gc.C) {
+	s.add(c, "a", time.Hour)
+	var lock sync.Mutex
+	config := s.config(filestorage.RetentionPolicy{KeepNewerThan: time.Minute})
+	config.Lock = &lock
+
+	lock.Lock()
+	done := make(chan error)
+	go func() {
+		_, err := filestorage.CollectGarbage(config)
+		done <- err
+	}()
+	select {
+	case <-done:
+		c.Fatalf("garbage collected without holding the lock")
+	case <-time.After(testing.ShortWait):
+	}
+	lock.Unlock()
+	select {
+	case err := <-done:
+		c.Assert(err, jc.ErrorIsNil)
+	case <-time.After(testing.LongWait):
+		c.Fatalf("timed out waiting for garbage collection")
+	}
+	s.checkFiles(c)
+}
+
+func (s *GCSuite) TestValidate(c *gc.C) {
+	config := s.config(filestorage.RetentionPolicy{KeepLast: -1})
+	_, err := filestorage.CollectGarbage(config)
+	c.Check(err, gc.ErrorMatches, `negative KeepLast -1 not valid`)
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+
+	config = s.config(filestorage.RetentionPolicy{})
+	config.Files = nil
+	_, err = filestorage.CollectGarbage(config)
+	c.Check(err, gc.ErrorMatches, `nil Files not valid`)
+}
+
+// memMetadataStorage is a simple in-memory MetadataStorage.
+type memMetadataStorage struct {
+	docs      map[string]filestorage.Metadata
+	removeErr error
+}
+
+func (s *memMetadataStorage) ids() []string {
+	var ids []string
+	for id := range s.docs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (s *memMetadataStorage) Metadata(id string) (filestorage.Metadata, error) {
+	meta, ok := s.docs[id]
+	if !ok {
+		return nil, errors.NotFoundf("metadata %q", id)
+	}
+	return meta, nil
+}
+
+func (s *memMetadataStorage) ListMetadata() ([]filestorage.Metadata, error) {
+	var metaList []filestorage.Metadata
+	for _, meta := range s.docs {
+		metaList = append(metaList, meta)
+	}
+	return metaList, nil
+}
+
+func (s *memMetadataStorage) AddMetadata(meta filestorage.Metadata) (string, error) {
+	s.docs[meta.ID()] = meta
+	return meta.ID(), nil
+}
+
+func (s *memMetadataStorage) RemoveMetadata(id string) error {
+	if s.removeErr != nil {
+		return s.removeErr
+	}
+	if _, ok := s.docs[id]; !ok {
+		return errors.NotFoundf("metadata %q", id)
+	}
+	delete(s.docs, id)
+	return nil
+}
+
+func (s *memMetadataStorage) SetStored(id string) error {
+	meta, err := s.Metadata(id)
+	if err != nil {
+		return err
+	}
+	meta.SetStored(nil)
+	return nil
+}
+
+func (s *memMetadataStorage) Close() error {
+	return nil
+}
@@ -0,0 +1,142 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package filestorage
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/juju/errors"
+
+	"github.com/juju/utils/v3"
+	"github.com/juju/utils/v3/errcode"
+	"github.com/juju/utils/v3/vfs"
+)
+
+// Ensure dirStorage implements RawFileStorage and FileLister.
+var (
+	_ = RawFileStorage((*dirStorage)(nil))
+	_ = FileLister((*dirStorage)(nil))
+)
+
+type dirStorage struct {
+	fs  vfs.FS
+	dir string
+}
+
+// NewDirStorage returns a RawFileStorage that keeps each file, named
+// by its ID, in the given directory of fsys. If fsys is nil, vfs.OS
+// is used. The directory is created if it does not exist.
+func NewDirStorage(fsys vfs.FS, dir string) (RawFileStorage, error) {
+	if fsys == nil {
+		fsys = vfs.OS
+	}
+	if err := fsys.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &dirStorage{
+		fs:  fsys,
+		dir: dir,
+	}, nil
+}
+
+func (s *dirStorage) path(id string) (string, error) {
+	if id == "" || id != filepath.Base(id) || id == "." || id == ".." {
+		return "", errcode.Wrap(errcode.ErrNotValid, errors.NotValidf("file ID %q", id))
+	}
+	return filepath.Join(s.dir, id), nil
+}
+
+// File implements RawFileStorage.File.
+func (s *dirStorage) File(id string) (io.ReadCloser, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	f, err := s.fs.Open(path)
+	if os.IsNotExist(err) {
+		return nil, errcode.Wrap(errcode.ErrNotFound, errors.NotFoundf("file %q", id))
+	}
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return f, nil
+}
+
+// AddFile implements RawFileStorage.AddFile. If size is not negative,
+// it fails if the file does not hold exactly that many bytes.
+func (s *dirStorage) AddFile(id string, file io.Reader, size int64) (err error) {
+	path, err := s.path(id)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	f, err := s.fs.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		return errcode.Wrap(errcode.ErrAlreadyExists, errors.AlreadyExistsf("file %q", id))
+	}
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer func() {
+		if err != nil {
+			// Don't leave a partial file behind.
+			f.Close()
+			s.fs.Remove(path)
+		}
+	}()
+	var w io.Writer = f
+	if size >= 0 {
+		// Fail as soon as the file proves too long,
+		// rather than when it has all been written.
+		w = utils.NewLimitedWriter(f, size)
+	}
+	n, err := io.Copy(w, file)
+	if utils.IsLimitExceeded(err) {
+		return errcode.Errorf(errcode.ErrCorrupt, "file %q: expected %d bytes, got more", id, size)
+	}
+	if err != nil {
+		return errors.Annotatef(err, "cannot write file %q", id)
+	}
+	if size >= 0 && n != size {
+		return errcode.Errorf(errcode.ErrCorrupt, "file %q: expected %d bytes, got %d", id, size, n)
+	}
+	if err := f.Sync(); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(f.Close())
+}
+
+// RemoveFile implements RawFileStorage.RemoveFile.
+func (s *dirStorage) RemoveFile(id string) error {
+	path, err := s.path(id)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	err = s.fs.Remove(path)
+	if os.IsNotExist(err) {
+		return errcode.Wrap(errcode.ErrNotFound, errors.NotFoundf("file %q", id))
+	}
+	return errors.Trace(err)
+}
+
+// ListFiles implements FileLister.ListFiles.
+func (s *dirStorage) ListFiles() ([]string, error) {
+	infos, err := s.fs.ReadDir(s.dir)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var ids []string
+	for _, info := range infos {
+		if info.Mode().IsRegular() {
+			ids = append(ids, info.Name())
+		}
+	}
+	return ids, nil
+}
+
+// Close implements io.Closer.Close.
+func (s *dirStorage) Close() error {
+	return nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package filestorage_test
+
+import (
+	"bytes"
+	stderrors "errors"
+	"io/ioutil"
+	"os"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/errcode"
+	"github.com/juju/utils/v3/filestorage"
+	"github.com/juju/utils/v3/vfs"
+)
+
+var _ = gc.Suite(&DirStorageSuite{})
+
+type DirStorageSuite struct {
+	testing.IsolationSuite
+	fs   *vfs.MemFS
+	stor filestorage.RawFileStorage
+}
+
+func (s *DirStorageSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.fs = vfs.NewMemFS()
+	stor, err := filestorage.NewDirStorage(s.fs, "/var/files")
+	c.Assert(err, jc.ErrorIsNil)
+	s.stor = stor
+}
+
+func (s *DirStorageSuite) TestAddFile(c *gc.C) {
+	err := s.stor.AddFile("spam", bytes.NewBufferString("eggs"), 4)
+	c.Assert(err, jc.ErrorIsNil)
+
+	data, err := vfs.ReadFile(s.fs, "/var/files/spam")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(data), gc.Equals, "eggs")
+
+	f, err := s.stor.File("spam")
+	c.Assert(err, jc.ErrorIsNil)
+	defer f.Close()
+	data, err = ioutil.ReadAll(f)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(data), gc.Equals, "eggs")
+}
+
+func (s *DirStorageSuite) TestAddFileAlreadyExists(c *gc.C) {
+	err := s.stor.AddFile("spam", bytes.NewBufferString("eggs"), 4)
+	c.Assert(err, jc.ErrorIsNil)
+	err = s.stor.AddFile("spam", bytes.NewBufferString("ham"), 3)
+	c.Check(err, jc.Satisfies, errors.IsAlreadyExists)
+	c.Check(stderrors.Is(err, errcode.ErrAlreadyExists), jc.IsTrue)
+}
+
+func (s *DirStorageSuite) TestAddFileWrongSize(c *gc.C) {
+	err := s.stor.AddFile("spam", bytes.NewBufferString("eggs"), 10)
+	c.Check(err, gc.ErrorMatches, `file "spam": expected 10 bytes, got 4`)
+	c.Check(stderrors.Is(err, errcode.ErrCorrupt), jc.IsTrue)
+	_, err = s.fs.Stat("/var/files/spam")
+	c.Check(err, jc.Satisfies, os.IsNotExist)
+}
+
+func (s *DirStorageSuite) TestAddFileTooLong(c *gc.C) {
+	err := s.stor.AddFile("spam", bytes.NewBufferString("eggs and ham"), 4)
+	c.Check(err, gc.ErrorMatches, `file "spam": expected 4 bytes, got more`)
+	c.Check(stderrors.Is(err, errcode.ErrCorrupt), jc.IsTrue)
+	_, err = s.fs.Stat("/var/files/spam")
+	c.Check(err, jc.Satisfies, os.IsNotExist)
+}
+
+func (s *DirStorageSuite) TestAddFileInvalidID(c *gc.C) {
+	err := s.stor.AddFile("../spam", bytes.NewBufferString("eggs"), 4)
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+}
+
+func (s *DirStorageSuite) TestFileNotFound(c *gc.C) {
+	_, err := s.stor.File("spam")
+	c.Check(err, jc.Satisfies, errors.IsNotFound)
+	c.Check(stderrors.Is(err, errcode.ErrNotFound), jc.IsTrue)
+}
+
+func (s *DirStorageSuite) TestRemoveFile(c *gc.C) {
+	err := s.stor.AddFile("spam", bytes.NewBufferString("eggs"), 4)
+	c.Assert(err, jc.ErrorIsNil)
+	err = s.stor.RemoveFile("spam")
+	c.Assert(err, jc.ErrorIsNil)
+	err = s.stor.RemoveFile("spam")
+	c.Check(err, jc.Satisfies, errors.IsNotFound)
+}
+
+func (s *DirStorageSuite) TestListFiles(c *gc.C) {
+	for _, id := range []string{"spam", "eggs"} {
+		err := s.stor.AddFile(id, bytes.NewBufferString(id), -1)
+		c.Assert(err, jc.ErrorIsNil)
+	}
+	err := s.fs.MkdirAll("/var/files/subdir", 0700)
+	c.Assert(err, jc.ErrorIsNil)
+
+	ids, err := s.stor.(filestorage.FileLister).ListFiles()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(ids, jc.SameContents, []string{"spam", "eggs"})
+}
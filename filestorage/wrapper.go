@@ -7,6 +7,8 @@ import (
 	"io"
 
 	"github.com/juju/errors"
+
+	"github.com/juju/utils/v3/errcode"
 )
 
 // Ensure fileStorage implements FileStorage.
@@ -52,7 +54,7 @@ func (s *fileStorage) Get(id string) (Metadata, io.ReadCloser, error) {
 		return nil, nil, errors.Trace(err)
 	}
 	if meta.Stored() == nil {
-		return nil, nil, errors.NotFoundf("no file stored for %q", id)
+		return nil, nil, errcode.Wrap(errcode.ErrNotFound, errors.NotFoundf("no file stored for %q", id))
 	}
 	file, err := s.rawStorage.File(id)
 	if err != nil {
@@ -0,0 +1,210 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package fs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// rename is used to move files when possible.
+// It is a variable so that it can be replaced in tests.
+var rename = os.Rename
+
+// MoveFile moves the file or symbolic link at src to dst. The
+// destination must not exist. See MoveTree for details of how moves
+// between filesystems are handled.
+func MoveFile(src, dst string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("cannot move %q: is a directory", src)
+	}
+	return move(src, dst)
+}
+
+// MoveTree moves the file, directory or symbolic link at src, with all
+// of its contents, to dst. The destination must not exist.
+//
+// A rename is used when possible. If src and dst are on different
+// filesystems, the tree is instead copied next to dst, preserving
+// permissions, modification times and, when running as root,
+// ownership; the copy is then verified against the original and
+// renamed into place before src is removed. If copying or verification
+// fails, the partial copy is removed and src is left untouched. If src
+// cannot be removed once the copy is in place, an error is returned
+// but dst remains complete.
+func MoveTree(src, dst string) error {
+	if _, err := os.Lstat(src); err != nil {
+		return err
+	}
+	return move(src, dst)
+}
+
+func move(src, dst string) error {
+	if _, err := os.Lstat(dst); err == nil {
+		return fmt.Errorf("will not overwrite %q", dst)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	err := rename(src, dst)
+	if err == nil || !isCrossDevice(err) {
+		return err
+	}
+	if err := copyAcross(src, dst); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(src); err != nil {
+		return fmt.Errorf("moved %q to %q but cannot remove original: %v", src, dst, err)
+	}
+	return nil
+}
+
+// copyAcross copies src to dst by way of a temporary
+// directory alongside dst, which is always removed.
+func copyAcross(src, dst string) error {
+	tmpDir, err := ioutil.TempDir(filepath.Dir(dst), "."+filepath.Base(dst)+".move")
+	if err != nil {
+		return fmt.Errorf("cannot create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	tmp := filepath.Join(tmpDir, filepath.Base(dst))
+	if err := Copy(src, tmp); err != nil {
+		return fmt.Errorf("cannot copy %q to %q: %v", src, dst, err)
+	}
+	if err := copyMetadata(src, tmp); err != nil {
+		return fmt.Errorf("cannot copy metadata from %q to %q: %v", src, dst, err)
+	}
+	if err := verifyTree(src, tmp); err != nil {
+		return fmt.Errorf("cannot verify copy of %q: %v", src, err)
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		return err
+	}
+	return nil
+}
+
+// isCrossDevice reports whether err was caused by an
+// attempt to rename a file across filesystems.
+func isCrossDevice(err error) bool {
+	var linkErr *os.LinkError
+	if !errors.As(err, &linkErr) {
+		return false
+	}
+	return isCrossDeviceErrno(linkErr.Err)
+}
+
+// copyMetadata makes the ownership and modification times of the
+// entries in the tree at dst match those at src. Permissions have
+// already been copied by Copy.
+func copyMetadata(src, dst string) error {
+	// Walk the tree depth first, so that setting the times on a
+	// directory happens after its contents have been changed.
+	var entries []string
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, rel)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		info, err := os.Lstat(filepath.Join(src, entries[i]))
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, entries[i])
+		if err := copyOwner(target, info); err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			// Times cannot portably be set on a symbolic link.
+			continue
+		}
+		if err := os.Chtimes(target, info.ModTime(), info.ModTime()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyTree checks that the tree at dst holds the
+// same entries, with the same contents, as src.
+func verifyTree(src, dst string) error {
+	return filepath.Walk(src, func(path string, srcInfo os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		dstInfo, err := os.Lstat(target)
+		if err != nil {
+			return err
+		}
+		if srcInfo.Mode() != dstInfo.Mode() {
+			return fmt.Errorf("%q has mode %v, want %v", target, dstInfo.Mode(), srcInfo.Mode())
+		}
+		switch srcInfo.Mode() & os.ModeType {
+		case os.ModeSymlink:
+			srcLink, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			dstLink, err := os.Readlink(target)
+			if err != nil {
+				return err
+			}
+			if srcLink != dstLink {
+				return fmt.Errorf("%q links to %q, want %q", target, dstLink, srcLink)
+			}
+		case 0:
+			if srcInfo.Size() != dstInfo.Size() {
+				return fmt.Errorf("%q has size %d, want %d", target, dstInfo.Size(), srcInfo.Size())
+			}
+			srcHash, err := fileHash(path)
+			if err != nil {
+				return err
+			}
+			dstHash, err := fileHash(target)
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(srcHash, dstHash) {
+				return fmt.Errorf("%q has different contents", target)
+			}
+		}
+		return nil
+	})
+}
+
+func fileHash(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
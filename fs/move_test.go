@@ -0,0 +1,173 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+//go:build !windows
+// +build !windows
+
+package fs_test
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/juju/testing"
+	ft "github.com/juju/testing/filetesting"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/fs"
+)
+
+type moveSuite struct{}
+
+var _ = gc.Suite(&moveSuite{})
+
+var moveTests = []struct {
+	about string
+	src   ft.Entries
+	dst   ft.Entries
+	err   string
+}{{
+	about: "one file",
+	src: []ft.Entry{
+		ft.File{Path: "file", Data: "data", Perm: 0756},
+	},
+}, {
+	about: "one symlink",
+	src: []ft.Entry{
+		ft.Symlink{Path: "link", Link: "/foo"},
+	},
+}, {
+	about: "several entries",
+	src: []ft.Entry{
+		ft.Dir{Path: "top", Perm: 0755},
+		ft.File{Path: "top/foo", Data: "foodata", Perm: 0644},
+		ft.File{Path: "top/bar", Data: "bardata", Perm: 0633},
+		ft.Dir{Path: "top/next", Perm: 0721},
+		ft.Symlink{Path: "top/next/link", Link: "../foo"},
+		ft.File{Path: "top/next/another", Data: "anotherdata", Perm: 0644},
+	},
+}, {
+	about: "destination already exists",
+	src: []ft.Entry{
+		ft.Dir{Path: "dir", Perm: 0777},
+	},
+	dst: []ft.Entry{
+		ft.Dir{Path: "dir", Perm: 0777},
+	},
+	err: `will not overwrite ".+dir"`,
+}}
+
+func crossDeviceRename(oldpath, newpath string) error {
+	return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EXDEV}
+}
+
+func (*moveSuite) TestMoveTree(c *gc.C) {
+	for _, crossDevice := range []bool{false, true} {
+		for i, test := range moveTests {
+			c.Logf("test %d: %v (cross device %v)", i, test.about, crossDevice)
+			restore := func() {}
+			if crossDevice {
+				restore = testing.PatchValue(fs.Rename, crossDeviceRename)
+			}
+			src, dst := c.MkDir(), c.MkDir()
+			test.src.Create(c, src)
+			test.dst.Create(c, dst)
+			path := test.src[0].GetPath()
+			err := fs.MoveTree(
+				filepath.Join(src, path),
+				filepath.Join(dst, path),
+			)
+			restore()
+			if test.err != "" {
+				c.Check(err, gc.ErrorMatches, test.err)
+				continue
+			}
+			c.Assert(err, gc.IsNil)
+			test.src.Check(c, dst)
+			_, err = os.Lstat(filepath.Join(src, path))
+			c.Check(os.IsNotExist(err), gc.Equals, true)
+			// No temporary files should be left behind.
+			names, err := readDirNames(dst)
+			c.Assert(err, gc.IsNil)
+			c.Check(names, gc.DeepEquals, []string{path})
+		}
+	}
+}
+
+func (*moveSuite) TestMoveTreeCrossDevicePreservesTimes(c *gc.C) {
+	defer testing.PatchValue(fs.Rename, crossDeviceRename).Restore()
+	src, dst := c.MkDir(), c.MkDir()
+	ft.Entries{
+		ft.Dir{Path: "top", Perm: 0755},
+		ft.File{Path: "top/file", Data: "data", Perm: 0644},
+	}.Create(c, src)
+	mtime := time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)
+	c.Assert(os.Chtimes(filepath.Join(src, "top/file"), mtime, mtime), gc.IsNil)
+	c.Assert(os.Chtimes(filepath.Join(src, "top"), mtime, mtime), gc.IsNil)
+
+	err := fs.MoveTree(filepath.Join(src, "top"), filepath.Join(dst, "top"))
+	c.Assert(err, gc.IsNil)
+	for _, path := range []string{"top", "top/file"} {
+		info, err := os.Stat(filepath.Join(dst, path))
+		c.Assert(err, gc.IsNil)
+		c.Check(info.ModTime().Equal(mtime), gc.Equals, true, gc.Commentf("%s: %v", path, info.ModTime()))
+	}
+}
+
+func (*moveSuite) TestMoveTreeCrossDeviceCleansUpOnFailure(c *gc.C) {
+	defer testing.PatchValue(fs.Rename, crossDeviceRename).Restore()
+	src, dst := c.MkDir(), c.MkDir()
+	ft.Entries{
+		ft.Dir{Path: "top", Perm: 0755},
+		ft.File{Path: "top/file", Data: "data", Perm: 0644},
+		ft.File{Path: "top/unreadable", Data: "secret", Perm: 0000},
+	}.Create(c, src)
+	if os.Geteuid() == 0 {
+		// Root can read anything, so use a file type that
+		// Copy does not support instead.
+		c.Assert(os.Remove(filepath.Join(src, "top/unreadable")), gc.IsNil)
+		c.Assert(syscall.Mkfifo(filepath.Join(src, "top/unreadable"), 0644), gc.IsNil)
+	}
+
+	err := fs.MoveTree(filepath.Join(src, "top"), filepath.Join(dst, "top"))
+	c.Assert(err, gc.ErrorMatches, `cannot copy ".*top" to ".*top": .*`)
+
+	// The source is untouched and nothing is left at the destination.
+	_, err = os.Lstat(filepath.Join(src, "top/file"))
+	c.Assert(err, gc.IsNil)
+	names, err := readDirNames(dst)
+	c.Assert(err, gc.IsNil)
+	c.Assert(names, gc.HasLen, 0)
+}
+
+func (*moveSuite) TestMoveFileRejectsDirectory(c *gc.C) {
+	src := c.MkDir()
+	err := fs.MoveFile(src, filepath.Join(c.MkDir(), "dst"))
+	c.Assert(err, gc.ErrorMatches, `cannot move ".*": is a directory`)
+}
+
+func (*moveSuite) TestMoveFileCrossDevice(c *gc.C) {
+	defer testing.PatchValue(fs.Rename, crossDeviceRename).Restore()
+	src, dst := c.MkDir(), c.MkDir()
+	ft.Entries{ft.File{Path: "file", Data: "data", Perm: 0600}}.Create(c, src)
+	err := fs.MoveFile(filepath.Join(src, "file"), filepath.Join(dst, "moved"))
+	c.Assert(err, gc.IsNil)
+	ft.Entries{ft.File{Path: "moved", Data: "data", Perm: 0600}}.Check(c, dst)
+}
+
+func (*moveSuite) TestMoveOtherRenameError(c *gc.C) {
+	src := c.MkDir()
+	err := fs.MoveTree(src, filepath.Join(c.MkDir(), "missing", "dst"))
+	c.Assert(err, gc.ErrorMatches, `rename .*: no such file or directory`)
+}
+
+func readDirNames(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Readdirnames(-1)
+}
@@ -0,0 +1,26 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+//go:build !windows
+// +build !windows
+
+package fs
+
+import (
+	"os"
+	"syscall"
+)
+
+func isCrossDeviceErrno(err error) bool {
+	return err == syscall.EXDEV
+}
+
+// copyOwner sets the ownership of dst to match info. Only root
+// may give files away, so it does nothing for other users.
+func copyOwner(dst string, info os.FileInfo) error {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || os.Geteuid() != 0 {
+		return nil
+	}
+	return os.Lchown(dst, int(st.Uid), int(st.Gid))
+}
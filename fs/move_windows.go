@@ -0,0 +1,22 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package fs
+
+import (
+	"os"
+	"syscall"
+)
+
+// errorNotSameDevice is the Windows ERROR_NOT_SAME_DEVICE error code.
+const errorNotSameDevice syscall.Errno = 17
+
+func isCrossDeviceErrno(err error) bool {
+	return err == errorNotSameDevice
+}
+
+// copyOwner does nothing on Windows, where files
+// are owned by the user that creates them.
+func copyOwner(dst string, info os.FileInfo) error {
+	return nil
+}
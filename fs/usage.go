@@ -0,0 +1,38 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package fs
+
+// DiskUsage holds the capacity and free space
+// of the filesystem containing a path.
+type DiskUsage struct {
+	// TotalBytes holds the size of the filesystem.
+	TotalBytes uint64
+
+	// FreeBytes holds the number of bytes free on the filesystem,
+	// including any space reserved for the superuser.
+	FreeBytes uint64
+
+	// AvailableBytes holds the number of bytes free
+	// on the filesystem that can be used by the caller.
+	AvailableBytes uint64
+
+	// TotalInodes holds the number of inodes in the filesystem.
+	// It is zero on platforms, such as Windows, where the
+	// number of files is not limited in this way.
+	TotalInodes uint64
+
+	// FreeInodes holds the number of free inodes.
+	FreeInodes uint64
+}
+
+// UsedBytes returns the number of bytes in use on the filesystem.
+func (u DiskUsage) UsedBytes() uint64 {
+	return u.TotalBytes - u.FreeBytes
+}
+
+// Usage returns the capacity and free space of the filesystem
+// containing path, which must exist.
+func Usage(path string) (DiskUsage, error) {
+	return usage(path)
+}
@@ -0,0 +1,16 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+//go:build !linux && !darwin && !freebsd && !windows
+// +build !linux,!darwin,!freebsd,!windows
+
+package fs
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func usage(path string) (DiskUsage, error) {
+	return DiskUsage{}, fmt.Errorf("disk usage not supported on %s", runtime.GOOS)
+}
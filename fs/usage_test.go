@@ -0,0 +1,34 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package fs_test
+
+import (
+	"os"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/fs"
+)
+
+type usageSuite struct{}
+
+var _ = gc.Suite(&usageSuite{})
+
+func (*usageSuite) TestUsage(c *gc.C) {
+	u, err := fs.Usage(c.MkDir())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(u.TotalBytes > 0, jc.IsTrue)
+	c.Check(u.FreeBytes <= u.TotalBytes, jc.IsTrue)
+	c.Check(u.AvailableBytes <= u.FreeBytes, jc.IsTrue)
+	c.Check(u.UsedBytes(), gc.Equals, u.TotalBytes-u.FreeBytes)
+	c.Check(u.FreeInodes <= u.TotalInodes, jc.IsTrue)
+}
+
+func (*usageSuite) TestUsageNotFound(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "missing")
+	_, err := fs.Usage(path)
+	c.Assert(err, jc.Satisfies, os.IsNotExist)
+}
@@ -0,0 +1,32 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package fs
+
+import (
+	"os"
+	"syscall"
+)
+
+func usage(path string) (DiskUsage, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return DiskUsage{}, &os.PathError{Op: "statfs", Path: path, Err: err}
+	}
+	bsize := uint64(st.Bsize)
+	u := DiskUsage{
+		TotalBytes:  uint64(st.Blocks) * bsize,
+		FreeBytes:   uint64(st.Bfree) * bsize,
+		TotalInodes: uint64(st.Files),
+		FreeInodes:  uint64(st.Ffree),
+	}
+	// Bavail is signed on some systems, and can be
+	// negative when the reserved space is in use.
+	if avail := int64(st.Bavail); avail > 0 {
+		u.AvailableBytes = uint64(avail) * bsize
+	}
+	return u, nil
+}
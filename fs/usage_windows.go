@@ -0,0 +1,22 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package fs
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+func usage(path string) (DiskUsage, error) {
+	pathp, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return DiskUsage{}, &os.PathError{Op: "GetDiskFreeSpaceEx", Path: path, Err: err}
+	}
+	var u DiskUsage
+	if err := windows.GetDiskFreeSpaceEx(pathp, &u.AvailableBytes, &u.TotalBytes, &u.FreeBytes); err != nil {
+		return DiskUsage{}, &os.PathError{Op: "GetDiskFreeSpaceEx", Path: path, Err: err}
+	}
+	return u, nil
+}
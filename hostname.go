@@ -0,0 +1,58 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package utils
+
+import (
+	"net"
+	"os"
+	"strings"
+)
+
+// These are overridden in tests.
+var (
+	osHostname  = os.Hostname
+	lookupCNAME = net.LookupCNAME
+	lookupHost  = net.LookupHost
+	lookupAddr  = net.LookupAddr
+)
+
+// FQDN returns the fully qualified domain name of the machine. If the
+// host name is not already qualified, it is resolved, first by its
+// canonical name and then by reverse lookups of its addresses, and
+// the first qualified name found is returned. If no qualified name
+// can be found, the unqualified host name is returned.
+func FQDN() (string, error) {
+	hostname, err := osHostname()
+	if err != nil {
+		return "", err
+	}
+	if strings.Contains(hostname, ".") {
+		return strings.TrimSuffix(hostname, "."), nil
+	}
+	if cname, err := lookupCNAME(hostname); err == nil {
+		if name := strings.TrimSuffix(cname, "."); strings.Contains(name, ".") {
+			return name, nil
+		}
+	}
+	addrs, err := lookupHost(hostname)
+	if err != nil {
+		logger.Debugf("cannot resolve host name %q: %v", hostname, err)
+		return hostname, nil
+	}
+	for _, addr := range addrs {
+		names, err := lookupAddr(addr)
+		if err != nil {
+			continue
+		}
+		for _, name := range names {
+			name = strings.TrimSuffix(name, ".")
+			// Only accept names for this host, rather
+			// than, say, "localhost.localdomain".
+			if strings.HasPrefix(name, hostname+".") {
+				return name, nil
+			}
+		}
+	}
+	return hostname, nil
+}
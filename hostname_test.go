@@ -0,0 +1,76 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package utils_test
+
+import (
+	"errors"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3"
+)
+
+type hostnameSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&hostnameSuite{})
+
+func (s *hostnameSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.PatchValue(utils.OSHostname, func() (string, error) { return "node1", nil })
+	s.PatchValue(utils.LookupCNAME, func(string) (string, error) { return "", errors.New("no cname") })
+	s.PatchValue(utils.LookupHost, func(string) ([]string, error) { return nil, errors.New("no host") })
+	s.PatchValue(utils.LookupAddr, func(string) ([]string, error) { return nil, errors.New("no addr") })
+}
+
+func (s *hostnameSuite) TestQualifiedHostname(c *gc.C) {
+	s.PatchValue(utils.OSHostname, func() (string, error) { return "node1.example.com", nil })
+	fqdn, err := utils.FQDN()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(fqdn, gc.Equals, "node1.example.com")
+}
+
+func (s *hostnameSuite) TestCNAME(c *gc.C) {
+	s.PatchValue(utils.LookupCNAME, func(host string) (string, error) {
+		c.Check(host, gc.Equals, "node1")
+		return "node1.example.com.", nil
+	})
+	fqdn, err := utils.FQDN()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(fqdn, gc.Equals, "node1.example.com")
+}
+
+func (s *hostnameSuite) TestReverseLookup(c *gc.C) {
+	s.PatchValue(utils.LookupCNAME, func(host string) (string, error) { return "node1.", nil })
+	s.PatchValue(utils.LookupHost, func(string) ([]string, error) {
+		return []string{"127.0.1.1", "10.0.0.5"}, nil
+	})
+	s.PatchValue(utils.LookupAddr, func(addr string) ([]string, error) {
+		switch addr {
+		case "127.0.1.1":
+			return []string{"localhost.localdomain."}, nil
+		case "10.0.0.5":
+			return []string{"node1.lan.example.com."}, nil
+		}
+		return nil, errors.New("unknown")
+	})
+	fqdn, err := utils.FQDN()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(fqdn, gc.Equals, "node1.lan.example.com")
+}
+
+func (s *hostnameSuite) TestUnresolvable(c *gc.C) {
+	fqdn, err := utils.FQDN()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(fqdn, gc.Equals, "node1")
+}
+
+func (s *hostnameSuite) TestHostnameError(c *gc.C) {
+	s.PatchValue(utils.OSHostname, func() (string, error) { return "", errors.New("boom") })
+	_, err := utils.FQDN()
+	c.Assert(err, gc.ErrorMatches, "boom")
+}
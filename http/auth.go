@@ -0,0 +1,438 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package http
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/juju/errors"
+)
+
+// BasicAuth is an http.RoundTripper that adds HTTP Basic
+// authentication to each request to its host.
+type BasicAuth struct {
+	Username string
+	Password string
+
+	// Host, if set, holds the host, including any port, to which
+	// credentials are sent. Otherwise it is the host of the first
+	// request. Requests to other hosts, such as those following a
+	// redirect, are sent without credentials, as are requests using
+	// a different scheme from the first request to the host, so that
+	// credentials are not sent in cleartext after a redirect from
+	// https to http.
+	Host string
+
+	// Transport holds the transport used to make requests.
+	// If it is nil, http.DefaultTransport is used.
+	Transport http.RoundTripper
+
+	authHost authHost
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *BasicAuth) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.authHost.allows(t.Host, req) {
+		return transport(t.Transport).RoundTrip(req)
+	}
+	req = cloneRequest(req)
+	req.SetBasicAuth(t.Username, t.Password)
+	return transport(t.Transport).RoundTrip(req)
+}
+
+// BearerAuth is an http.RoundTripper that adds a bearer token to the
+// Authorization header of each request to its host. If the server rejects the
+// token with a 401 status, a new one is obtained with Refresh and
+// the request is retried once.
+type BearerAuth struct {
+	// Token holds the initial token. If it is empty,
+	// Refresh is called before the first request.
+	Token string
+
+	// Refresh, if set, is called to obtain a new token when
+	// there is none or the current one has been rejected.
+	Refresh func(ctx context.Context) (string, error)
+
+	// Host, if set, holds the host, including any port, to which
+	// credentials are sent. Otherwise it is the host of the first
+	// request. Requests to other hosts, such as those following a
+	// redirect, are sent without credentials, as are requests using
+	// a different scheme from the first request to the host, so that
+	// credentials are not sent in cleartext after a redirect from
+	// https to http.
+	Host string
+
+	// Transport holds the transport used to make requests.
+	// If it is nil, http.DefaultTransport is used.
+	Transport http.RoundTripper
+
+	authHost authHost
+
+	mu    sync.Mutex
+	token string
+	init  bool
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *BearerAuth) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.authHost.allows(t.Host, req) {
+		return transport(t.Transport).RoundTrip(req)
+	}
+	token, err := t.currentToken(req.Context(), "")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	resp, err := t.send(req, token)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || t.Refresh == nil || !canResend(req) {
+		return resp, err
+	}
+	discardBody(resp)
+	token, err = t.currentToken(req.Context(), token)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	retry, err := rewindRequest(req)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return t.send(retry, token)
+}
+
+func (t *BearerAuth) send(req *http.Request, token string) (*http.Response, error) {
+	req = cloneRequest(req)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return transport(t.Transport).RoundTrip(req)
+}
+
+// currentToken returns the token to use. If rejected is not empty, it
+// holds a token that the server refused, and a new one is obtained
+// unless another request has already replaced it.
+func (t *BearerAuth) currentToken(ctx context.Context, rejected string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.init {
+		t.token, t.init = t.Token, true
+	}
+	if (t.token == "" || t.token == rejected) && t.Refresh != nil {
+		token, err := t.Refresh(ctx)
+		if err != nil {
+			return "", errors.Annotate(err, "cannot refresh token")
+		}
+		t.token = token
+	}
+	return t.token, nil
+}
+
+// DigestAuth is an http.RoundTripper that authenticates requests with
+// HTTP Digest authentication (RFC 7616), using the MD5, MD5-sess,
+// SHA-256 or SHA-256-sess algorithms with the "auth" quality of
+// protection. The server's challenge is remembered, so that only the
+// first request to a server needs to be sent twice.
+type DigestAuth struct {
+	Username string
+	Password string
+
+	// Host, if set, holds the host, including any port, to which
+	// credentials are sent. Otherwise it is the host of the first
+	// request. Requests to other hosts, such as those following a
+	// redirect, are sent without credentials, as are requests using
+	// a different scheme from the first request to the host, so that
+	// credentials are not sent in cleartext after a redirect from
+	// https to http.
+	Host string
+
+	// Transport holds the transport used to make requests.
+	// If it is nil, http.DefaultTransport is used.
+	Transport http.RoundTripper
+
+	authHost authHost
+
+	mu        sync.Mutex
+	challenge *digestChallenge
+	count     int
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *DigestAuth) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.authHost.allows(t.Host, req) {
+		return transport(t.Transport).RoundTrip(req)
+	}
+	t.mu.Lock()
+	challenge := t.challenge
+	t.mu.Unlock()
+
+	var resp *http.Response
+	var err error
+	if challenge != nil {
+		resp, err = t.send(req, challenge)
+	} else {
+		resp, err = transport(t.Transport).RoundTrip(req)
+	}
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || !canResend(req) {
+		return resp, err
+	}
+	newChallenge, ok := parseDigestChallenge(resp.Header.Values("WWW-Authenticate"))
+	if !ok || (challenge != nil && !newChallenge.stale && newChallenge.nonce == challenge.nonce) {
+		// Either the server doesn't want digest authentication,
+		// or it has rejected our credentials.
+		return resp, nil
+	}
+	discardBody(resp)
+	t.mu.Lock()
+	t.challenge, t.count = newChallenge, 0
+	t.mu.Unlock()
+	retry, err := rewindRequest(req)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return t.send(retry, newChallenge)
+}
+
+func (t *DigestAuth) send(req *http.Request, c *digestChallenge) (*http.Response, error) {
+	t.mu.Lock()
+	t.count++
+	count := t.count
+	t.mu.Unlock()
+	cnonce, err := newCNonce()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	req = cloneRequest(req)
+	req.Header.Set("Authorization", c.authorization(t.Username, t.Password, req.Method, req.URL.RequestURI(), cnonce, count))
+	return transport(t.Transport).RoundTrip(req)
+}
+
+// digestChallenge holds the parameters of
+// a WWW-Authenticate: Digest header.
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+	stale     bool
+}
+
+func (c *digestChallenge) newHash() hash.Hash {
+	if strings.HasPrefix(strings.ToUpper(c.algorithm), "SHA-256") {
+		return sha256.New()
+	}
+	return md5.New()
+}
+
+func (c *digestChallenge) hash(parts ...string) string {
+	h := c.newHash()
+	io.WriteString(h, strings.Join(parts, ":"))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *digestChallenge) authorization(username, password, method, uri, cnonce string, count int) string {
+	ha1 := c.hash(username, c.realm, password)
+	if strings.HasSuffix(strings.ToLower(c.algorithm), "-sess") {
+		ha1 = c.hash(ha1, c.nonce, cnonce)
+	}
+	ha2 := c.hash(method, uri)
+	nc := fmt.Sprintf("%08x", count)
+
+	params := []string{
+		fmt.Sprintf("username=%q", username),
+		fmt.Sprintf("realm=%q", c.realm),
+		fmt.Sprintf("nonce=%q", c.nonce),
+		fmt.Sprintf("uri=%q", uri),
+	}
+	if c.qop != "" {
+		params = append(params,
+			"qop="+c.qop,
+			"nc="+nc,
+			fmt.Sprintf("cnonce=%q", cnonce),
+			fmt.Sprintf("response=%q", c.hash(ha1, c.nonce, nc, cnonce, c.qop, ha2)),
+		)
+	} else {
+		params = append(params, fmt.Sprintf("response=%q", c.hash(ha1, c.nonce, ha2)))
+	}
+	if c.algorithm != "" {
+		params = append(params, "algorithm="+c.algorithm)
+	}
+	if c.opaque != "" {
+		params = append(params, fmt.Sprintf("opaque=%q", c.opaque))
+	}
+	return "Digest " + strings.Join(params, ", ")
+}
+
+// parseDigestChallenge returns the first supported digest
+// challenge found in the given WWW-Authenticate headers.
+func parseDigestChallenge(headers []string) (*digestChallenge, bool) {
+	for _, h := range headers {
+		if len(h) < len("Digest ") || !strings.EqualFold(h[:len("Digest ")], "Digest ") {
+			continue
+		}
+		params := parseAuthParams(h[len("Digest "):])
+		c := &digestChallenge{
+			realm:     params["realm"],
+			nonce:     params["nonce"],
+			opaque:    params["opaque"],
+			algorithm: params["algorithm"],
+			stale:     strings.EqualFold(params["stale"], "true"),
+		}
+		switch strings.ToUpper(c.algorithm) {
+		case "", "MD5", "MD5-SESS", "SHA-256", "SHA-256-SESS":
+		default:
+			continue
+		}
+		if qop, ok := params["qop"]; ok {
+			for _, q := range strings.Split(qop, ",") {
+				if strings.TrimSpace(q) == "auth" {
+					c.qop = "auth"
+				}
+			}
+			if c.qop == "" {
+				// Only auth-int is offered, which we don't support.
+				continue
+			}
+		}
+		if c.nonce == "" {
+			continue
+		}
+		return c, true
+	}
+	return nil, false
+}
+
+// parseAuthParams parses a comma-separated list of
+// key=value or key="quoted value" pairs.
+func parseAuthParams(s string) map[string]string {
+	params := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return params
+		}
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			return params
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = strings.TrimLeft(s[eq+1:], " \t")
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			var b strings.Builder
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				b.WriteByte(s[i])
+			}
+			value = b.String()
+			if i < len(s) {
+				i++
+			}
+			s = s[i:]
+		} else {
+			end := strings.IndexByte(s, ',')
+			if end < 0 {
+				end = len(s)
+			}
+			value = strings.TrimSpace(s[:end])
+			s = s[end:]
+		}
+		params[key] = value
+	}
+}
+
+func newCNonce() (string, error) {
+	var b [16]byte
+	if _, err := io.ReadFull(rand.Reader, b[:]); err != nil {
+		return "", errors.Annotate(err, "cannot generate cnonce")
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+// authHost records the host and scheme with which
+// an authenticating transport sends credentials.
+type authHost struct {
+	mu     sync.Mutex
+	host   string
+	scheme string
+}
+
+// allows reports whether credentials may be sent with req. They are
+// sent only to the given host or, if that is empty, to the host of
+// the first request checked, and only with the scheme of the first
+// request to that host, so that they do not leak to other hosts, or
+// in cleartext after a downgrade to http, when a redirect is followed.
+func (h *authHost) allows(host string, req *http.Request) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if host == "" {
+		if h.host == "" {
+			h.host = req.URL.Host
+		}
+		host = h.host
+	}
+	if !strings.EqualFold(req.URL.Host, host) {
+		return false
+	}
+	if h.scheme == "" {
+		h.scheme = req.URL.Scheme
+	}
+	return strings.EqualFold(req.URL.Scheme, h.scheme)
+}
+
+func transport(rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		return http.DefaultTransport
+	}
+	return rt
+}
+
+// cloneRequest returns a shallow copy of req with its own headers,
+// as a RoundTripper must not modify the request it is given.
+func cloneRequest(req *http.Request) *http.Request {
+	r := new(http.Request)
+	*r = *req
+	r.Header = req.Header.Clone()
+	if r.Header == nil {
+		r.Header = make(http.Header)
+	}
+	return r
+}
+
+// canResend reports whether req can be sent a second time.
+func canResend(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// rewindRequest returns a copy of req with a fresh body,
+// so that it can be sent again.
+func rewindRequest(req *http.Request) (*http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot recreate request body")
+	}
+	r := cloneRequest(req)
+	r.Body = body
+	return r, nil
+}
+
+func discardBody(resp *http.Response) {
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+}
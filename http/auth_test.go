@@ -0,0 +1,270 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package http_test
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	jujuhttp "github.com/juju/utils/v3/http"
+)
+
+type authSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&authSuite{})
+
+func get(c *gc.C, rt http.RoundTripper, url string) *http.Response {
+	client := &http.Client{Transport: rt}
+	resp, err := client.Get(url)
+	c.Assert(err, jc.ErrorIsNil)
+	resp.Body.Close()
+	return resp
+}
+
+func (s *authSuite) TestBasicAuth(c *gc.C) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		user, password, ok := req.BasicAuth()
+		if !ok || user != "bob" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	resp := get(c, &jujuhttp.BasicAuth{Username: "bob", Password: "secret"}, srv.URL)
+	c.Check(resp.StatusCode, gc.Equals, http.StatusOK)
+	resp = get(c, &jujuhttp.BasicAuth{Username: "bob", Password: "wrong"}, srv.URL)
+	c.Check(resp.StatusCode, gc.Equals, http.StatusUnauthorized)
+}
+
+func (s *authSuite) TestCredentialsNotSentCrossHost(c *gc.C) {
+	var leaked []string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if auth := req.Header.Get("Authorization"); auth != "" {
+			leaked = append(leaked, auth)
+		}
+	}))
+	defer other.Close()
+	var authorized []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		authorized = append(authorized, req.Header.Get("Authorization"))
+		http.Redirect(w, req, other.URL+"/elsewhere", http.StatusFound)
+	}))
+	defer srv.Close()
+
+	for _, rt := range []http.RoundTripper{
+		&jujuhttp.BasicAuth{Username: "bob", Password: "secret"},
+		&jujuhttp.BearerAuth{Token: "token"},
+		&jujuhttp.BasicAuth{Username: "bob", Password: "secret", Host: strings.TrimPrefix(srv.URL, "http://")},
+	} {
+		resp := get(c, rt, srv.URL)
+		c.Check(resp.StatusCode, gc.Equals, http.StatusOK)
+	}
+	c.Check(authorized, jc.DeepEquals, []string{"Basic Ym9iOnNlY3JldA==", "Bearer token", "Basic Ym9iOnNlY3JldA=="})
+	c.Check(leaked, gc.HasLen, 0)
+
+	// A transport that is given a host only authenticates requests to it.
+	resp := get(c, &jujuhttp.BasicAuth{Username: "bob", Password: "secret", Host: "example.com"}, other.URL)
+	c.Check(resp.StatusCode, gc.Equals, http.StatusOK)
+	c.Check(leaked, gc.HasLen, 0)
+}
+
+// downgradeTransport redirects https requests to the same URL with
+// the http scheme, and records the Authorization header of each
+// request.
+type downgradeTransport struct {
+	auth []string
+}
+
+func (t *downgradeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.auth = append(t.auth, req.Header.Get("Authorization"))
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     make(http.Header),
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+		Request:    req,
+	}
+	if req.URL.Scheme == "https" {
+		u := *req.URL
+		u.Scheme = "http"
+		resp.StatusCode = http.StatusFound
+		resp.Header.Set("Location", u.String())
+	}
+	return resp, nil
+}
+
+func (s *authSuite) TestCredentialsNotSentAfterDowngrade(c *gc.C) {
+	for _, newTransport := range []func(http.RoundTripper) http.RoundTripper{
+		func(rt http.RoundTripper) http.RoundTripper {
+			return &jujuhttp.BasicAuth{Username: "bob", Password: "secret", Transport: rt}
+		},
+		func(rt http.RoundTripper) http.RoundTripper {
+			return &jujuhttp.BearerAuth{Token: "token", Transport: rt}
+		},
+		func(rt http.RoundTripper) http.RoundTripper {
+			return &jujuhttp.BasicAuth{Username: "bob", Password: "secret", Host: "example.com", Transport: rt}
+		},
+	} {
+		var downgrade downgradeTransport
+		resp := get(c, newTransport(&downgrade), "https://example.com/path")
+		c.Check(resp.StatusCode, gc.Equals, http.StatusOK)
+		c.Assert(downgrade.auth, gc.HasLen, 2)
+		c.Check(downgrade.auth[0], gc.Not(gc.Equals), "")
+		c.Check(downgrade.auth[1], gc.Equals, "")
+	}
+}
+
+func (s *authSuite) TestBearerAuthRefresh(c *gc.C) {
+	valid := "token-1"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		if req.Header.Get("Authorization") != "Bearer "+valid {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	refreshes := 0
+	auth := &jujuhttp.BearerAuth{
+		Refresh: func(ctx context.Context) (string, error) {
+			refreshes++
+			return fmt.Sprintf("token-%d", refreshes), nil
+		},
+	}
+	resp := get(c, auth, srv.URL)
+	c.Check(resp.StatusCode, gc.Equals, http.StatusOK)
+	c.Check(refreshes, gc.Equals, 1)
+	resp = get(c, auth, srv.URL)
+	c.Check(resp.StatusCode, gc.Equals, http.StatusOK)
+	c.Check(refreshes, gc.Equals, 1)
+
+	// When the token expires, a new one is obtained and the request,
+	// including its body, is sent again.
+	valid = "token-2"
+	client := &http.Client{Transport: auth}
+	resp, err := client.Post(srv.URL, "text/plain", strings.NewReader("hello"))
+	c.Assert(err, jc.ErrorIsNil)
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(resp.StatusCode, gc.Equals, http.StatusOK)
+	c.Check(string(body), gc.Equals, "hello")
+	c.Check(refreshes, gc.Equals, 2)
+
+	// A token that is rejected even after refreshing is reported.
+	valid = "never"
+	resp = get(c, auth, srv.URL)
+	c.Check(resp.StatusCode, gc.Equals, http.StatusUnauthorized)
+	c.Check(refreshes, gc.Equals, 3)
+}
+
+func (s *authSuite) TestBearerAuthRefreshError(c *gc.C) {
+	auth := &jujuhttp.BearerAuth{
+		Refresh: func(ctx context.Context) (string, error) {
+			return "", errors.New("no token for you")
+		},
+	}
+	client := &http.Client{Transport: auth}
+	_, err := client.Get("http://0.1.2.3/")
+	c.Check(err, gc.ErrorMatches, `.*cannot refresh token: no token for you`)
+}
+
+var digestParamRE = regexp.MustCompile(`(\w+)=("([^"]*)"|[^,]*)`)
+
+// digestServer returns a server that requires digest authentication
+// with the given algorithm, and a count of the challenges it has issued.
+func digestServer(c *gc.C, algorithm, username, password string) (*httptest.Server, *int) {
+	const realm, nonce = "testrealm@host.com", "dcd98b7102dd2f0e8b11d0f600bfb0c093"
+	challenges := 0
+	hashOf := func(parts ...string) string {
+		var h hash.Hash = md5.New()
+		if strings.HasPrefix(algorithm, "SHA-256") {
+			h = sha256.New()
+		}
+		h.Write([]byte(strings.Join(parts, ":")))
+		return hex.EncodeToString(h.Sum(nil))
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		authz := req.Header.Get("Authorization")
+		if strings.HasPrefix(authz, "Digest ") {
+			params := make(map[string]string)
+			for _, m := range digestParamRE.FindAllStringSubmatch(authz[len("Digest "):], -1) {
+				if m[3] != "" {
+					params[m[1]] = m[3]
+				} else {
+					params[m[1]] = strings.Trim(m[2], `"`)
+				}
+			}
+			ha1 := hashOf(username, realm, password)
+			if strings.HasSuffix(algorithm, "-sess") {
+				ha1 = hashOf(ha1, nonce, params["cnonce"])
+			}
+			ha2 := hashOf(req.Method, params["uri"])
+			want := hashOf(ha1, nonce, params["nc"], params["cnonce"], "auth", ha2)
+			if params["username"] == username && params["response"] == want && params["opaque"] == "opaque" {
+				return
+			}
+		}
+		challenges++
+		w.Header().Add("WWW-Authenticate", `Basic realm="other"`)
+		w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Digest realm=%q, qop="auth,auth-int", nonce=%q, opaque="opaque", algorithm=%s`, realm, nonce, algorithm))
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	return srv, &challenges
+}
+
+func (s *authSuite) TestDigestAuth(c *gc.C) {
+	for _, algorithm := range []string{"MD5", "MD5-sess", "SHA-256", "SHA-256-sess"} {
+		c.Logf("algorithm %s", algorithm)
+		srv, challenges := digestServer(c, algorithm, "Mufasa", "Circle Of Life")
+
+		auth := &jujuhttp.DigestAuth{Username: "Mufasa", Password: "Circle Of Life"}
+		resp := get(c, auth, srv.URL+"/dir/index.html?x=1")
+		c.Check(resp.StatusCode, gc.Equals, http.StatusOK)
+		c.Check(*challenges, gc.Equals, 1)
+
+		// The challenge is remembered for later requests.
+		resp = get(c, auth, srv.URL+"/other")
+		c.Check(resp.StatusCode, gc.Equals, http.StatusOK)
+		c.Check(*challenges, gc.Equals, 1)
+
+		// Wrong credentials produce a 401 without looping.
+		resp = get(c, &jujuhttp.DigestAuth{Username: "Mufasa", Password: "wrong"}, srv.URL)
+		c.Check(resp.StatusCode, gc.Equals, http.StatusUnauthorized)
+		c.Check(*challenges, gc.Equals, 3)
+		srv.Close()
+	}
+}
+
+func (s *authSuite) TestComposed(c *gc.C) {
+	srv, _ := digestServer(c, "MD5", "bob", "secret")
+	defer srv.Close()
+
+	client, err := jujuhttp.NewClient(jujuhttp.ClientConfig{})
+	c.Assert(err, jc.ErrorIsNil)
+	auth := &jujuhttp.DigestAuth{
+		Username:  "bob",
+		Password:  "secret",
+		Transport: client.Transport,
+	}
+	resp := get(c, auth, srv.URL)
+	c.Check(resp.StatusCode, gc.Equals, http.StatusOK)
+}
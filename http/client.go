@@ -0,0 +1,204 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package http provides a constructor for HTTP clients with sensible
+// defaults for timeouts, proxies, TLS and retries.
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/juju/clock"
+	"github.com/juju/errors"
+	"github.com/juju/loggo"
+	"golang.org/x/net/http/httpproxy"
+
+	"github.com/juju/utils/v3/proxy"
+)
+
+var logger = loggo.GetLogger("juju.utils.http")
+
+// Default timeouts used by NewClient when none are specified.
+const (
+	DefaultDialTimeout           = 30 * time.Second
+	DefaultKeepAlive             = 30 * time.Second
+	DefaultTLSHandshakeTimeout   = 10 * time.Second
+	DefaultResponseHeaderTimeout = time.Minute
+	DefaultIdleConnTimeout       = 90 * time.Second
+)
+
+// ClientConfig holds the configuration for NewClient. The zero value
+// gives a client with the default timeouts, proxies taken from the
+// environment, the system CA pool and no retries.
+type ClientConfig struct {
+	// Timeout holds the overall time limit for a request, including
+	// any retries and reading the response body. Zero means no limit.
+	Timeout time.Duration
+
+	// DialTimeout, TLSHandshakeTimeout, ResponseHeaderTimeout and
+	// IdleConnTimeout hold the corresponding transport timeouts. If
+	// zero, the Default values above are used.
+	DialTimeout           time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	IdleConnTimeout       time.Duration
+
+	// Proxy holds the proxy settings to use. If it is nil, the proxies
+	// are taken from the environment when each request is made.
+	Proxy *proxy.Settings
+
+	// RootCAs holds the CAs used to verify servers. If it is nil,
+	// the system CA pool is used.
+	RootCAs *x509.CertPool
+
+	// CACertificates holds PEM-encoded CA certificates to trust in
+	// addition to RootCAs, or to the system CA pool.
+	CACertificates []string
+
+	// TLSConfig, if set, is used as the basis of the transport's TLS
+	// configuration. RootCAs and CACertificates override its RootCAs.
+	TLSConfig *tls.Config
+
+	// SkipHostnameVerification disables verification of the server's
+	// certificate. It should only be used in tests.
+	SkipHostnameVerification bool
+
+	// Retry, if set, causes idempotent requests that fail with
+	// a transient error to be retried.
+	Retry *RetryPolicy
+
+	// OnRequest, if set, is called before each attempt at a request,
+	// including retries.
+	OnRequest func(req *http.Request, attempt int)
+
+	// OnResponse, if set, is called after each attempt at a request
+	// with the response or error and the time the attempt took.
+	OnResponse func(req *http.Request, resp *http.Response, err error, elapsed time.Duration)
+
+	// Clock is used to time retries and attempts. If it is nil,
+	// clock.WallClock is used.
+	Clock clock.Clock
+}
+
+// NewClient returns a new HTTP client configured as described
+// by config.
+func NewClient(config ClientConfig) (*http.Client, error) {
+	transport, err := NewTransport(config)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var rt http.RoundTripper = transport
+	if config.Retry != nil || config.OnRequest != nil || config.OnResponse != nil {
+		rt = &instrumentedTransport{
+			transport:  transport,
+			retry:      config.Retry,
+			onRequest:  config.OnRequest,
+			onResponse: config.OnResponse,
+			clock:      config.Clock,
+		}
+		if config.Clock == nil {
+			rt.(*instrumentedTransport).clock = clock.WallClock
+		}
+	}
+	return &http.Client{
+		Transport: rt,
+		Timeout:   config.Timeout,
+	}, nil
+}
+
+// NewTransport returns the *http.Transport that NewClient would use
+// for the given config, without retries or hooks.
+func NewTransport(config ClientConfig) (*http.Transport, error) {
+	tlsConfig, err := clientTLSConfig(config)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	dialer := &net.Dialer{
+		Timeout:   durationOr(config.DialTimeout, DefaultDialTimeout),
+		KeepAlive: DefaultKeepAlive,
+	}
+	proxyFunc := http.ProxyFromEnvironment
+	if config.Proxy != nil {
+		proxyFunc = ProxyFunc(*config.Proxy)
+	}
+	return &http.Transport{
+		Proxy:                 proxyFunc,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   durationOr(config.TLSHandshakeTimeout, DefaultTLSHandshakeTimeout),
+		ResponseHeaderTimeout: durationOr(config.ResponseHeaderTimeout, DefaultResponseHeaderTimeout),
+		IdleConnTimeout:       durationOr(config.IdleConnTimeout, DefaultIdleConnTimeout),
+		ExpectContinueTimeout: time.Second,
+		MaxIdleConns:          100,
+		ForceAttemptHTTP2:     true,
+	}, nil
+}
+
+// ProxyFunc returns a function, suitable for use as
+// http.Transport.Proxy, that chooses proxies according to
+// the given settings, including their AutoNoProxy values.
+func ProxyFunc(settings proxy.Settings) func(*http.Request) (*url.URL, error) {
+	proxyForURL := (&httpproxy.Config{
+		HTTPProxy:  settings.Http,
+		HTTPSProxy: settings.Https,
+		NoProxy:    settings.FullNoProxy(),
+	}).ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxyForURL(req.URL)
+	}
+}
+
+func clientTLSConfig(config ClientConfig) (*tls.Config, error) {
+	var tlsConfig *tls.Config
+	if config.TLSConfig != nil {
+		tlsConfig = config.TLSConfig.Clone()
+	} else {
+		tlsConfig = &tls.Config{}
+	}
+	if config.RootCAs != nil {
+		tlsConfig.RootCAs = config.RootCAs
+	}
+	if len(config.CACertificates) > 0 {
+		pool := tlsConfig.RootCAs
+		if pool != nil {
+			pool = pool.Clone()
+		} else {
+			systemPool, err := x509.SystemCertPool()
+			if err != nil {
+				logger.Debugf("cannot load system CA pool: %v", err)
+				systemPool = x509.NewCertPool()
+			}
+			pool = systemPool
+		}
+		for _, caPEM := range config.CACertificates {
+			if !pool.AppendCertsFromPEM([]byte(caPEM)) {
+				return nil, errors.NotValidf("CA certificate %q", abbreviate(caPEM))
+			}
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if config.SkipHostnameVerification {
+		tlsConfig.InsecureSkipVerify = true
+	}
+	return tlsConfig, nil
+}
+
+func durationOr(d, dflt time.Duration) time.Duration {
+	if d == 0 {
+		return dflt
+	}
+	return d
+}
+
+func abbreviate(s string) string {
+	const max = 20
+	if len(s) <= max {
+		return s
+	}
+	return s[:max] + "..."
+}
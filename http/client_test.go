@@ -0,0 +1,202 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package http_test
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	jujuhttp "github.com/juju/utils/v3/http"
+	"github.com/juju/utils/v3/proxy"
+)
+
+type clientSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&clientSuite{})
+
+var fastRetry = &jujuhttp.RetryPolicy{
+	Attempts: 3,
+	Delay:    time.Millisecond,
+}
+
+// flakyServer returns a server that fails with the given status
+// until it has been called failures times.
+func flakyServer(failures int32, status int) (*httptest.Server, *int32) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		if atomic.AddInt32(&calls, 1) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte("ok " + string(body)))
+	}))
+	return srv, &calls
+}
+
+func (s *clientSuite) TestDefaults(c *gc.C) {
+	transport, err := jujuhttp.NewTransport(jujuhttp.ClientConfig{})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(transport.TLSHandshakeTimeout, gc.Equals, jujuhttp.DefaultTLSHandshakeTimeout)
+	c.Check(transport.ResponseHeaderTimeout, gc.Equals, jujuhttp.DefaultResponseHeaderTimeout)
+	c.Check(transport.IdleConnTimeout, gc.Equals, jujuhttp.DefaultIdleConnTimeout)
+	c.Check(transport.TLSClientConfig.InsecureSkipVerify, jc.IsFalse)
+
+	client, err := jujuhttp.NewClient(jujuhttp.ClientConfig{Timeout: time.Minute})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(client.Timeout, gc.Equals, time.Minute)
+	_, ok := client.Transport.(*http.Transport)
+	c.Check(ok, jc.IsTrue)
+}
+
+func (s *clientSuite) TestRetryIdempotent(c *gc.C) {
+	srv, calls := flakyServer(2, http.StatusServiceUnavailable)
+	defer srv.Close()
+
+	client, err := jujuhttp.NewClient(jujuhttp.ClientConfig{Retry: fastRetry})
+	c.Assert(err, jc.ErrorIsNil)
+	req, err := http.NewRequest("PUT", srv.URL, strings.NewReader("body"))
+	c.Assert(err, jc.ErrorIsNil)
+	resp, err := client.Do(req)
+	c.Assert(err, jc.ErrorIsNil)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(body), gc.Equals, "ok body")
+	c.Check(atomic.LoadInt32(calls), gc.Equals, int32(3))
+}
+
+func (s *clientSuite) TestRetryGivesUp(c *gc.C) {
+	srv, calls := flakyServer(5, http.StatusBadGateway)
+	defer srv.Close()
+
+	client, err := jujuhttp.NewClient(jujuhttp.ClientConfig{Retry: fastRetry})
+	c.Assert(err, jc.ErrorIsNil)
+	resp, err := client.Get(srv.URL)
+	c.Assert(err, jc.ErrorIsNil)
+	resp.Body.Close()
+	c.Check(resp.StatusCode, gc.Equals, http.StatusBadGateway)
+	c.Check(atomic.LoadInt32(calls), gc.Equals, int32(3))
+}
+
+func (s *clientSuite) TestNoRetryNonIdempotent(c *gc.C) {
+	srv, calls := flakyServer(1, http.StatusServiceUnavailable)
+	defer srv.Close()
+
+	client, err := jujuhttp.NewClient(jujuhttp.ClientConfig{Retry: fastRetry})
+	c.Assert(err, jc.ErrorIsNil)
+	resp, err := client.Post(srv.URL, "text/plain", strings.NewReader("body"))
+	c.Assert(err, jc.ErrorIsNil)
+	resp.Body.Close()
+	c.Check(resp.StatusCode, gc.Equals, http.StatusServiceUnavailable)
+	c.Check(atomic.LoadInt32(calls), gc.Equals, int32(1))
+
+	// An Idempotency-Key header makes a POST safe to retry.
+	req, err := http.NewRequest("POST", srv.URL, strings.NewReader("body"))
+	c.Assert(err, jc.ErrorIsNil)
+	req.Header.Set("Idempotency-Key", "1234")
+	atomic.StoreInt32(calls, 0)
+	resp, err = client.Do(req)
+	c.Assert(err, jc.ErrorIsNil)
+	resp.Body.Close()
+	c.Check(resp.StatusCode, gc.Equals, http.StatusOK)
+	c.Check(atomic.LoadInt32(calls), gc.Equals, int32(2))
+}
+
+func (s *clientSuite) TestHooks(c *gc.C) {
+	srv, _ := flakyServer(1, http.StatusTooManyRequests)
+	defer srv.Close()
+
+	var attempts []int
+	var statuses []int
+	client, err := jujuhttp.NewClient(jujuhttp.ClientConfig{
+		Retry: fastRetry,
+		OnRequest: func(req *http.Request, attempt int) {
+			attempts = append(attempts, attempt)
+		},
+		OnResponse: func(req *http.Request, resp *http.Response, err error, elapsed time.Duration) {
+			c.Check(err, jc.ErrorIsNil)
+			c.Check(elapsed >= 0, jc.IsTrue)
+			statuses = append(statuses, resp.StatusCode)
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	resp, err := client.Get(srv.URL)
+	c.Assert(err, jc.ErrorIsNil)
+	resp.Body.Close()
+	c.Check(attempts, jc.DeepEquals, []int{1, 2})
+	c.Check(statuses, jc.DeepEquals, []int{http.StatusTooManyRequests, http.StatusOK})
+}
+
+func (s *clientSuite) TestCACertificates(c *gc.C) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer srv.Close()
+
+	client, err := jujuhttp.NewClient(jujuhttp.ClientConfig{})
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = client.Get(srv.URL)
+	c.Check(err, gc.ErrorMatches, ".*certificate.*")
+
+	caPEM := string(pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: srv.Certificate().Raw,
+	}))
+	client, err = jujuhttp.NewClient(jujuhttp.ClientConfig{
+		CACertificates: []string{caPEM},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	resp, err := client.Get(srv.URL)
+	c.Assert(err, jc.ErrorIsNil)
+	resp.Body.Close()
+
+	_, err = jujuhttp.NewClient(jujuhttp.ClientConfig{
+		CACertificates: []string{"not a certificate at all"},
+	})
+	c.Check(err, gc.ErrorMatches, `CA certificate "not a certificate at..." not valid`)
+}
+
+func (s *clientSuite) TestProxyFunc(c *gc.C) {
+	proxyFunc := jujuhttp.ProxyFunc(proxy.Settings{
+		Http:        "http://proxy.example.com:3128",
+		Https:       "http://secure-proxy.example.com:3128",
+		NoProxy:     "internal.example.com",
+		AutoNoProxy: "10.0.0.1",
+	})
+	for _, test := range []struct {
+		url   string
+		proxy string
+	}{{
+		url:   "http://www.example.com/",
+		proxy: "http://proxy.example.com:3128",
+	}, {
+		url:   "https://www.example.com/",
+		proxy: "http://secure-proxy.example.com:3128",
+	}, {
+		url: "http://internal.example.com/",
+	}, {
+		url: "https://10.0.0.1:17070/",
+	}} {
+		u, err := url.Parse(test.url)
+		c.Assert(err, jc.ErrorIsNil)
+		proxyURL, err := proxyFunc(&http.Request{URL: u})
+		c.Assert(err, jc.ErrorIsNil)
+		if test.proxy == "" {
+			c.Check(proxyURL, gc.IsNil, gc.Commentf("url %q", test.url))
+			continue
+		}
+		c.Check(proxyURL.String(), gc.Equals, test.proxy, gc.Commentf("url %q", test.url))
+	}
+}
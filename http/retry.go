@@ -0,0 +1,167 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/juju/clock"
+	"github.com/juju/errors"
+)
+
+// RetryPolicy describes how failed requests are retried. Only
+// idempotent requests are retried: those with the GET, HEAD, OPTIONS,
+// TRACE, PUT or DELETE methods, or with an Idempotency-Key header,
+// whose body (if any) can be recreated with Request.GetBody.
+type RetryPolicy struct {
+	// Attempts holds the maximum number of attempts made,
+	// including the first.
+	Attempts int
+
+	// Delay holds the time waited before the first retry. The delay
+	// doubles after each subsequent attempt.
+	Delay time.Duration
+
+	// MaxDelay, if non-zero, holds the maximum time
+	// waited between attempts.
+	MaxDelay time.Duration
+
+	// Retryable reports whether an attempt that returned the given
+	// response or error should be retried. If it is nil,
+	// IsRetryable is used.
+	Retryable func(resp *http.Response, err error) bool
+}
+
+// DefaultRetryPolicy holds a retry policy suitable
+// for most clients.
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts: 3,
+	Delay:    500 * time.Millisecond,
+	MaxDelay: 10 * time.Second,
+}
+
+// IsRetryable reports whether an attempt that returned the given
+// response or error is worth retrying: that is, whether it failed with
+// a transport error or with a 429, 502, 503 or 504 status. Requests
+// whose context is done are never retried, whatever this returns.
+func IsRetryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// instrumentedTransport wraps a transport to retry requests
+// and call the request and response hooks.
+type instrumentedTransport struct {
+	transport  http.RoundTripper
+	retry      *RetryPolicy
+	onRequest  func(req *http.Request, attempt int)
+	onResponse func(req *http.Request, resp *http.Response, err error, elapsed time.Duration)
+	clock      clock.Clock
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	attempts := 1
+	if t.retry != nil && t.retry.Attempts > 1 && canRetry(req) {
+		attempts = t.retry.Attempts
+	}
+	delay := time.Duration(0)
+	if t.retry != nil {
+		delay = t.retry.Delay
+	}
+	for attempt := 1; ; attempt++ {
+		r := req
+		if attempt > 1 {
+			var err error
+			if r, err = rewindRequest(req); err != nil {
+				return nil, errors.Trace(err)
+			}
+		}
+		resp, err := t.attempt(r, attempt)
+		if attempt >= attempts || req.Context().Err() != nil || !t.retryable(resp, err) {
+			return resp, err
+		}
+		wait := delay
+		if after, ok := retryAfter(resp); ok && after > wait {
+			wait = after
+		}
+		if t.retry.MaxDelay > 0 && wait > t.retry.MaxDelay {
+			wait = t.retry.MaxDelay
+		}
+		if resp != nil {
+			// Drain the body so that the connection can be reused.
+			discardBody(resp)
+		}
+		logger.Debugf("retrying %s %s in %v (attempt %d)", req.Method, req.URL.Redacted(), wait, attempt)
+		select {
+		case <-t.clock.After(wait):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		delay *= 2
+	}
+}
+
+func (t *instrumentedTransport) attempt(req *http.Request, attempt int) (*http.Response, error) {
+	if t.onRequest != nil {
+		t.onRequest(req, attempt)
+	}
+	start := t.clock.Now()
+	resp, err := t.transport.RoundTrip(req)
+	if t.onResponse != nil {
+		t.onResponse(req, resp, err, t.clock.Now().Sub(start))
+	}
+	return resp, err
+}
+
+func (t *instrumentedTransport) retryable(resp *http.Response, err error) bool {
+	if t.retry.Retryable != nil {
+		return t.retry.Retryable(resp, err)
+	}
+	return IsRetryable(resp, err)
+}
+
+// canRetry reports whether req is idempotent
+// and may safely be sent again.
+func canRetry(req *http.Request) bool {
+	if !canResend(req) {
+		return false
+	}
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	_, ok := req.Header["Idempotency-Key"]
+	return ok
+}
+
+// retryAfter returns the delay requested by
+// a response's Retry-After header, if any.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t), true
+	}
+	return 0, false
+}
@@ -0,0 +1,142 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package humantime formats times relative to the present
+// in a human-friendly way, such as "3 minutes ago" or "in 2 days".
+package humantime
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/juju/clock"
+)
+
+// Unit describes a unit of time used when formatting.
+type Unit struct {
+	// Length holds the length of the unit.
+	Length time.Duration
+
+	// One holds the text used for a single unit,
+	// for example "1 minute" or "a minute".
+	One string
+
+	// Other holds the format used for any other number
+	// of units. It is passed the count, for example
+	// "%d minutes".
+	Other string
+}
+
+// Locale holds the text and rules used to format times.
+type Locale struct {
+	// Now is used for times closer to the present
+	// than the shortest unit.
+	Now string
+
+	// Past is the format used for times in the past.
+	// It is passed the formatted duration, for example
+	// "%s ago".
+	Past string
+
+	// Future is the format used for times in the future.
+	// It is passed the formatted duration, for example
+	// "in %s".
+	Future string
+
+	// Units holds the units to use, in increasing order
+	// of length. The longest unit not longer than the
+	// distance from the present is used.
+	Units []Unit
+
+	// IsOne, if not nil, reports whether the count n takes the
+	// One form of a unit. By default only 1 does.
+	IsOne func(n int64) bool
+}
+
+// English is the default Locale.
+var English = &Locale{
+	Now:    "just now",
+	Past:   "%s ago",
+	Future: "in %s",
+	Units: []Unit{
+		{time.Second, "1 second", "%d seconds"},
+		{time.Minute, "1 minute", "%d minutes"},
+		{time.Hour, "1 hour", "%d hours"},
+		{24 * time.Hour, "1 day", "%d days"},
+		{7 * 24 * time.Hour, "1 week", "%d weeks"},
+		{30 * 24 * time.Hour, "1 month", "%d months"},
+		{365 * 24 * time.Hour, "1 year", "%d years"},
+	},
+}
+
+// Formatter formats times relative to the current time.
+type Formatter struct {
+	// Locale holds the locale to format with.
+	// If it is nil, English is used.
+	Locale *Locale
+
+	// Clock is used to find the current time.
+	// If it is nil, the wall clock is used.
+	Clock clock.Clock
+}
+
+// Format returns t described relative to the current time.
+func (f *Formatter) Format(t time.Time) string {
+	clk := f.Clock
+	if clk == nil {
+		clk = clock.WallClock
+	}
+	return f.Relative(t, clk.Now())
+}
+
+// Relative returns t described relative to now.
+func (f *Formatter) Relative(t, now time.Time) string {
+	loc := f.Locale
+	if loc == nil {
+		loc = English
+	}
+	d := t.Sub(now)
+	format := loc.Future
+	if d < 0 {
+		d, format = -d, loc.Past
+	}
+	s := loc.duration(d)
+	if s == "" {
+		return loc.Now
+	}
+	return fmt.Sprintf(format, s)
+}
+
+// duration returns the formatted non-negative duration d, or the
+// empty string if it is shorter than all the units in the locale.
+func (loc *Locale) duration(d time.Duration) string {
+	for i := len(loc.Units) - 1; i >= 0; i-- {
+		u := loc.Units[i]
+		if d < u.Length {
+			continue
+		}
+		n := int64(d / u.Length)
+		isOne := loc.IsOne
+		if isOne == nil {
+			isOne = func(n int64) bool { return n == 1 }
+		}
+		if isOne(n) {
+			return u.One
+		}
+		return fmt.Sprintf(u.Other, n)
+	}
+	return ""
+}
+
+var defaultFormatter Formatter
+
+// Format returns t described relative to the current
+// time in English, as in "3 minutes ago" or "in 2 days".
+func Format(t time.Time) string {
+	return defaultFormatter.Format(t)
+}
+
+// Relative returns t described relative to now in English.
+func Relative(t, now time.Time) string {
+	return defaultFormatter.Relative(t, now)
+}
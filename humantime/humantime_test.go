@@ -0,0 +1,68 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package humantime_test
+
+import (
+	"time"
+
+	"github.com/juju/clock/testclock"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/humantime"
+)
+
+type humantimeSuite struct{}
+
+var _ = gc.Suite(&humantimeSuite{})
+
+var now = time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+
+var relativeTests = []struct {
+	offset time.Duration
+	expect string
+}{
+	{0, "just now"},
+	{-500 * time.Millisecond, "just now"},
+	{-time.Second, "1 second ago"},
+	{-45 * time.Second, "45 seconds ago"},
+	{-3*time.Minute - 10*time.Second, "3 minutes ago"},
+	{-time.Hour, "1 hour ago"},
+	{-25 * time.Hour, "1 day ago"},
+	{2*24*time.Hour + time.Minute, "in 2 days"},
+	{15 * 24 * time.Hour, "in 2 weeks"},
+	{-65 * 24 * time.Hour, "2 months ago"},
+	{-800 * 24 * time.Hour, "2 years ago"},
+}
+
+func (*humantimeSuite) TestRelative(c *gc.C) {
+	for i, test := range relativeTests {
+		c.Logf("test %d: %v", i, test.offset)
+		c.Check(humantime.Relative(now.Add(test.offset), now), gc.Equals, test.expect)
+	}
+}
+
+func (*humantimeSuite) TestFormatUsesClock(c *gc.C) {
+	f := humantime.Formatter{Clock: testclock.NewClock(now)}
+	c.Check(f.Format(now.Add(-10*time.Minute)), gc.Equals, "10 minutes ago")
+}
+
+func (*humantimeSuite) TestLocale(c *gc.C) {
+	f := humantime.Formatter{
+		Locale: &humantime.Locale{
+			Now:    "à l'instant",
+			Past:   "il y a %s",
+			Future: "dans %s",
+			Units: []humantime.Unit{
+				{time.Minute, "1 minute", "%d minutes"},
+				{time.Hour, "1 heure", "%d heures"},
+			},
+			// In French, zero and one are both singular.
+			IsOne: func(n int64) bool { return n <= 1 },
+		},
+	}
+	c.Check(f.Relative(now.Add(-30*time.Second), now), gc.Equals, "à l'instant")
+	c.Check(f.Relative(now.Add(-2*time.Minute), now), gc.Equals, "il y a 2 minutes")
+	c.Check(f.Relative(now.Add(90*time.Minute), now), gc.Equals, "dans 1 heure")
+	c.Check(f.Relative(now.Add(-50*time.Hour), now), gc.Equals, "il y a 50 heures")
+}
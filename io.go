@@ -0,0 +1,185 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+
+	"github.com/juju/errors"
+)
+
+// CountingReader is an io.Reader that counts the bytes read through it.
+// Count may be called while another goroutine reads.
+type CountingReader struct {
+	r io.Reader
+	n int64
+}
+
+// NewCountingReader returns a CountingReader that reads from r.
+func NewCountingReader(r io.Reader) *CountingReader {
+	return &CountingReader{r: r}
+}
+
+// Read implements io.Reader.
+func (r *CountingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	atomic.AddInt64(&r.n, int64(n))
+	return n, err
+}
+
+// Count returns the number of bytes read.
+func (r *CountingReader) Count() int64 {
+	return atomic.LoadInt64(&r.n)
+}
+
+// CountingWriter is an io.Writer that counts the bytes written through
+// it. Count may be called while another goroutine writes.
+type CountingWriter struct {
+	w io.Writer
+	n int64
+}
+
+// NewCountingWriter returns a CountingWriter that writes to w.
+func NewCountingWriter(w io.Writer) *CountingWriter {
+	return &CountingWriter{w: w}
+}
+
+// Write implements io.Writer.
+func (w *CountingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	atomic.AddInt64(&w.n, int64(n))
+	return n, err
+}
+
+// Count returns the number of bytes written.
+func (w *CountingWriter) Count() int64 {
+	return atomic.LoadInt64(&w.n)
+}
+
+// TeeReadCloser is like io.TeeReader, for an io.ReadCloser: it returns
+// a reader that writes to w what it reads from rc, and which closes rc
+// when it is closed.
+func TeeReadCloser(rc io.ReadCloser, w io.Writer) io.ReadCloser {
+	return teeReadCloser{
+		Reader: io.TeeReader(rc, w),
+		Closer: rc,
+	}
+}
+
+type teeReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// LimitExceededError is returned by a LimitedWriter when more
+// is written to it than its limit allows.
+type LimitExceededError struct {
+	// Limit holds the number of bytes that may be written.
+	Limit int64
+}
+
+// Error implements error.
+func (e *LimitExceededError) Error() string {
+	return fmt.Sprintf("write limit of %d bytes exceeded", e.Limit)
+}
+
+// IsLimitExceeded reports whether the cause of err
+// is a *LimitExceededError.
+func IsLimitExceeded(err error) bool {
+	_, ok := errors.Cause(err).(*LimitExceededError)
+	return ok
+}
+
+// LimitedWriter is an io.Writer that passes at most a given
+// number of bytes to another writer.
+type LimitedWriter struct {
+	w         io.Writer
+	limit     int64
+	remaining int64
+}
+
+// NewLimitedWriter returns a LimitedWriter that writes at most
+// limit bytes to w.
+func NewLimitedWriter(w io.Writer, limit int64) *LimitedWriter {
+	return &LimitedWriter{w: w, limit: limit, remaining: limit}
+}
+
+// Write implements io.Writer. If p does not fit within the limit, as
+// much of it as fits is written, and a *LimitExceededError is returned.
+func (w *LimitedWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) <= w.remaining {
+		n, err := w.w.Write(p)
+		w.remaining -= int64(n)
+		return n, err
+	}
+	var n int
+	var err error
+	if w.remaining > 0 {
+		n, err = w.w.Write(p[:w.remaining])
+		w.remaining -= int64(n)
+	}
+	if err == nil {
+		err = &LimitExceededError{Limit: w.limit}
+	}
+	return n, err
+}
+
+// Remaining returns the number of bytes that may still be written.
+func (w *LimitedWriter) Remaining() int64 {
+	return w.remaining
+}
+
+// SpongeWriter is an io.WriteCloser that holds everything written to it
+// until it is closed, and then commits it all at once, so that nothing
+// is committed if the writer is abandoned part way through.
+type SpongeWriter struct {
+	buf    bytes.Buffer
+	commit func(data []byte) error
+	done   bool
+}
+
+// NewSpongeWriter returns a SpongeWriter that passes
+// the data written to it to commit when it is closed.
+func NewSpongeWriter(commit func(data []byte) error) *SpongeWriter {
+	return &SpongeWriter{commit: commit}
+}
+
+// NewFileSpongeWriter returns a SpongeWriter that atomically
+// replaces the file at path with the data written to it, with the
+// given permissions, when it is closed. See AtomicWriteFile.
+func NewFileSpongeWriter(path string, perm os.FileMode) *SpongeWriter {
+	return NewSpongeWriter(func(data []byte) error {
+		return AtomicWriteFile(path, data, perm)
+	})
+}
+
+// Write implements io.Writer.
+func (w *SpongeWriter) Write(p []byte) (int, error) {
+	if w.done {
+		return 0, errors.New("write to closed sponge writer")
+	}
+	return w.buf.Write(p)
+}
+
+// Close commits the data written. It does nothing if the
+// writer has already been closed or aborted.
+func (w *SpongeWriter) Close() error {
+	if w.done {
+		return nil
+	}
+	w.done = true
+	data := w.buf.Bytes()
+	w.buf = bytes.Buffer{}
+	return w.commit(data)
+}
+
+// Abort discards the data written, so that it is never committed.
+func (w *SpongeWriter) Abort() {
+	w.done = true
+	w.buf = bytes.Buffer{}
+}
@@ -0,0 +1,173 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package utils_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing/iotest"
+
+	jujuerrors "github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3"
+)
+
+type ioSuite struct{}
+
+var _ = gc.Suite(&ioSuite{})
+
+func (*ioSuite) TestCountingReader(c *gc.C) {
+	r := utils.NewCountingReader(iotest.OneByteReader(strings.NewReader("hello")))
+	buf := make([]byte, 3)
+	n, err := r.Read(buf)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(n, gc.Equals, 1)
+	c.Assert(r.Count(), gc.Equals, int64(1))
+	data, err := ioutil.ReadAll(r)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(data), gc.Equals, "ello")
+	c.Assert(r.Count(), gc.Equals, int64(5))
+}
+
+func (*ioSuite) TestCountingWriter(c *gc.C) {
+	var buf bytes.Buffer
+	w := utils.NewCountingWriter(&buf)
+	_, err := io.WriteString(w, "hello ")
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = io.WriteString(w, "world")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(w.Count(), gc.Equals, int64(11))
+	c.Assert(buf.String(), gc.Equals, "hello world")
+}
+
+func (*ioSuite) TestCountingWriterError(c *gc.C) {
+	w := utils.NewCountingWriter(utils.NewLimitedWriter(ioutil.Discard, 3))
+	n, err := io.WriteString(w, "hello")
+	c.Assert(err, gc.ErrorMatches, "write limit of 3 bytes exceeded")
+	c.Assert(n, gc.Equals, 3)
+	c.Assert(w.Count(), gc.Equals, int64(3))
+}
+
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (r *closeRecorder) Close() error {
+	r.closed = true
+	return nil
+}
+
+func (*ioSuite) TestTeeReadCloser(c *gc.C) {
+	src := &closeRecorder{Reader: strings.NewReader("hello")}
+	var copied bytes.Buffer
+	rc := utils.TeeReadCloser(src, &copied)
+	data, err := ioutil.ReadAll(rc)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(data), gc.Equals, "hello")
+	c.Assert(copied.String(), gc.Equals, "hello")
+	c.Assert(src.closed, jc.IsFalse)
+	c.Assert(rc.Close(), jc.ErrorIsNil)
+	c.Assert(src.closed, jc.IsTrue)
+}
+
+func (*ioSuite) TestLimitedWriter(c *gc.C) {
+	var buf bytes.Buffer
+	w := utils.NewLimitedWriter(&buf, 8)
+	n, err := io.WriteString(w, "hello")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(n, gc.Equals, 5)
+	c.Assert(w.Remaining(), gc.Equals, int64(3))
+
+	n, err = io.WriteString(w, " world")
+	c.Assert(err, gc.ErrorMatches, "write limit of 8 bytes exceeded")
+	c.Assert(err, jc.Satisfies, utils.IsLimitExceeded)
+	c.Assert(err.(*utils.LimitExceededError).Limit, gc.Equals, int64(8))
+	c.Assert(n, gc.Equals, 3)
+	c.Assert(buf.String(), gc.Equals, "hello wo")
+	c.Assert(w.Remaining(), gc.Equals, int64(0))
+
+	n, err = io.WriteString(w, "!")
+	c.Assert(err, jc.Satisfies, utils.IsLimitExceeded)
+	c.Assert(n, gc.Equals, 0)
+
+	// Writing nothing never exceeds the limit.
+	n, err = w.Write(nil)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(n, gc.Equals, 0)
+}
+
+func (*ioSuite) TestIsLimitExceeded(c *gc.C) {
+	err := jujuerrors.Annotate(&utils.LimitExceededError{Limit: 1}, "copying")
+	c.Assert(utils.IsLimitExceeded(err), jc.IsTrue)
+	c.Assert(utils.IsLimitExceeded(errors.New("other")), jc.IsFalse)
+	c.Assert(utils.IsLimitExceeded(nil), jc.IsFalse)
+}
+
+func (*ioSuite) TestSpongeWriter(c *gc.C) {
+	var committed []string
+	w := utils.NewSpongeWriter(func(data []byte) error {
+		committed = append(committed, string(data))
+		return nil
+	})
+	_, err := io.WriteString(w, "hello ")
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = io.WriteString(w, "world")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(committed, gc.HasLen, 0)
+
+	c.Assert(w.Close(), jc.ErrorIsNil)
+	c.Assert(committed, jc.DeepEquals, []string{"hello world"})
+
+	// Closing again does nothing.
+	c.Assert(w.Close(), jc.ErrorIsNil)
+	c.Assert(committed, gc.HasLen, 1)
+
+	_, err = io.WriteString(w, "more")
+	c.Assert(err, gc.ErrorMatches, "write to closed sponge writer")
+}
+
+func (*ioSuite) TestSpongeWriterCommitError(c *gc.C) {
+	w := utils.NewSpongeWriter(func(data []byte) error {
+		return errors.New("no space")
+	})
+	_, err := io.WriteString(w, "hello")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(w.Close(), gc.ErrorMatches, "no space")
+}
+
+func (*ioSuite) TestSpongeWriterAbort(c *gc.C) {
+	w := utils.NewSpongeWriter(func(data []byte) error {
+		c.Fatalf("unexpected commit")
+		return nil
+	})
+	_, err := io.WriteString(w, "hello")
+	c.Assert(err, jc.ErrorIsNil)
+	w.Abort()
+	c.Assert(w.Close(), jc.ErrorIsNil)
+}
+
+func (*ioSuite) TestFileSpongeWriter(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "file")
+	err := ioutil.WriteFile(path, []byte("old"), 0644)
+	c.Assert(err, jc.ErrorIsNil)
+
+	w := utils.NewFileSpongeWriter(path, 0600)
+	_, err = io.WriteString(w, "new contents")
+	c.Assert(err, jc.ErrorIsNil)
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(data), gc.Equals, "old")
+
+	c.Assert(w.Close(), jc.ErrorIsNil)
+	data, err = ioutil.ReadFile(path)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(data), gc.Equals, "new contents")
+}
@@ -0,0 +1,500 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package jsonhttp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/clock"
+	"gopkg.in/errgo.v1"
+)
+
+// StreamFormat identifies the format of a streaming response
+// by its content type.
+type StreamFormat string
+
+const (
+	// NDJSON streams values as newline delimited JSON,
+	// one value per line.
+	NDJSON StreamFormat = "application/x-ndjson"
+
+	// SSE streams values as server-sent events, as described at
+	// https://html.spec.whatwg.org/multipage/server-sent-events.html.
+	SSE StreamFormat = "text/event-stream"
+)
+
+// Event holds a single server-sent event. Values streamed as NDJSON
+// are read as events holding only Data.
+type Event struct {
+	// ID, if not empty, sets the ID sent in the Last-Event-ID
+	// header when a client reconnects.
+	ID string
+
+	// Event holds the event type. A client treats an
+	// empty type as "message".
+	Event string
+
+	// Data holds the event data.
+	Data []byte
+
+	// Retry, if positive, tells a client how long to wait
+	// before reconnecting. It is truncated to milliseconds.
+	Retry time.Duration
+}
+
+// Decode unmarshals the event data as JSON into v.
+func (e Event) Decode(v interface{}) error {
+	if err := json.Unmarshal(e.Data, v); err != nil {
+		return errgo.Notef(err, "cannot decode event data")
+	}
+	return nil
+}
+
+// StreamConfig holds the configuration of a Stream.
+type StreamConfig struct {
+	// Format holds the format of the stream.
+	// If it is empty, NDJSON is used.
+	Format StreamFormat
+
+	// Heartbeat, if positive, is the interval after which a
+	// heartbeat is written if nothing else has been, so that
+	// proxies do not close an idle connection and clients can
+	// detect one that has been lost. Heartbeats are empty lines
+	// in NDJSON and comments in SSE, and are ignored by clients.
+	Heartbeat time.Duration
+
+	// Clock is used to time heartbeats. If it is nil,
+	// clock.WallClock is used.
+	Clock clock.Clock
+}
+
+// Stream writes a streaming JSON response. It is safe
+// to call its methods concurrently.
+type Stream struct {
+	format StreamFormat
+
+	mu      sync.Mutex
+	w       http.ResponseWriter
+	flusher http.Flusher
+	err     error
+	written chan struct{}
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewStream writes the header of a streaming response to w and
+// returns a Stream with which to write its values. The response
+// writer must implement http.Flusher. The stream must be closed
+// with Close when the response is complete.
+func NewStream(w http.ResponseWriter, config StreamConfig) (*Stream, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, errgo.Newf("response writer %T does not support flushing", w)
+	}
+	if config.Format == "" {
+		config.Format = NDJSON
+	}
+	if config.Format != NDJSON && config.Format != SSE {
+		return nil, errgo.Newf("unknown stream format %q", config.Format)
+	}
+	if config.Clock == nil {
+		config.Clock = clock.WallClock
+	}
+	w.Header().Set("content-type", string(config.Format))
+	w.Header().Set("cache-control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	s := &Stream{
+		format:  config.Format,
+		w:       w,
+		flusher: flusher,
+		written: make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if config.Heartbeat > 0 {
+		go s.heartbeat(config.Heartbeat, config.Clock)
+	} else {
+		close(s.done)
+	}
+	return s, nil
+}
+
+// Send writes val as JSON. In SSE it is written
+// as the data of an event with no type or ID.
+func (s *Stream) Send(val interface{}) error {
+	data, err := json.Marshal(val)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if s.format == SSE {
+		return s.SendEvent(Event{Data: data})
+	}
+	return s.write(append(data, '\n'))
+}
+
+// SendEvent writes the given event. It may only
+// be used with SSE.
+func (s *Stream) SendEvent(e Event) error {
+	if s.format != SSE {
+		return errgo.Newf("cannot send event in %s stream", s.format)
+	}
+	if strings.ContainsAny(e.ID+e.Event, "\r\n") {
+		return errgo.Newf("event ID or type contains a newline")
+	}
+	var buf bytes.Buffer
+	if e.ID != "" {
+		fmt.Fprintf(&buf, "id: %s\n", e.ID)
+	}
+	if e.Event != "" {
+		fmt.Fprintf(&buf, "event: %s\n", e.Event)
+	}
+	if e.Retry > 0 {
+		fmt.Fprintf(&buf, "retry: %d\n", e.Retry/time.Millisecond)
+	}
+	for _, line := range bytes.Split(e.Data, []byte("\n")) {
+		fmt.Fprintf(&buf, "data: %s\n", line)
+	}
+	buf.WriteByte('\n')
+	return s.write(buf.Bytes())
+}
+
+// Close stops the heartbeat. It does not close the
+// underlying connection, which is done when the HTTP
+// handler returns.
+func (s *Stream) Close() {
+	s.mu.Lock()
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+	s.mu.Unlock()
+	<-s.done
+}
+
+// write writes data and flushes it to the client. Once a write
+// fails, all later ones return the same error.
+func (s *Stream) write(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	if _, err := s.w.Write(data); err != nil {
+		s.err = errgo.Notef(err, "cannot write to stream")
+		return s.err
+	}
+	s.flusher.Flush()
+	select {
+	case s.written <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (s *Stream) heartbeat(interval time.Duration, clk clock.Clock) {
+	defer close(s.done)
+	beat := []byte("\n")
+	if s.format == SSE {
+		beat = []byte(":\n\n")
+	}
+	timer := clk.NewTimer(interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-s.written:
+			// Something has been written, so no
+			// heartbeat is needed until later.
+			if !timer.Stop() {
+				<-timer.Chan()
+			}
+			timer.Reset(interval)
+		case <-timer.Chan():
+			if err := s.write(beat); err != nil {
+				return
+			}
+			// Drain the notification of the heartbeat itself.
+			<-s.written
+			timer.Reset(interval)
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// SubscribeConfig holds the configuration for Subscribe.
+type SubscribeConfig struct {
+	// NewRequest returns the request with which to open the
+	// stream. It is called for each connection, with the ID of the
+	// last event received, which is also sent in the Last-Event-ID
+	// header if it is not empty.
+	NewRequest func(lastEventID string) (*http.Request, error)
+
+	// Client is used to send requests. If it is nil,
+	// http.DefaultClient is used.
+	Client *http.Client
+
+	// RetryDelay holds the time to wait before reconnecting after
+	// a stream ends or a connection fails. If it is zero, 3s is
+	// used. It is replaced by any retry time sent in an SSE stream,
+	// limited to between 100ms and 10m.
+	RetryDelay time.Duration
+
+	// IdleTimeout, if positive, is the time after which a
+	// connection on which nothing, not even a heartbeat, has been
+	// received is treated as lost and the stream is reconnected.
+	IdleTimeout time.Duration
+
+	// Clock is used to time retries and idle connections.
+	// If it is nil, clock.WallClock is used.
+	Clock clock.Clock
+}
+
+// ErrStreamEnded is returned by Subscribe when the server
+// responds with 204 No Content, telling the client
+// not to reconnect.
+var ErrStreamEnded = errgo.New("stream ended")
+
+// Subscribe reads a streaming response, in either NDJSON or SSE as
+// given by its content type, calling handle with each event. When the
+// stream ends or the connection fails it reconnects, until ctx is
+// done, handle returns an error, or the server responds with a status
+// other than 200 OK. It returns the error from handle, ctx.Err(), or
+// an error describing the response.
+func Subscribe(ctx context.Context, config SubscribeConfig, handle func(Event) error) error {
+	if config.NewRequest == nil {
+		return errgo.New("no NewRequest function")
+	}
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	if config.RetryDelay <= 0 {
+		config.RetryDelay = 3 * time.Second
+	}
+	if config.Clock == nil {
+		config.Clock = clock.WallClock
+	}
+	sub := &subscription{
+		config: config,
+		handle: handle,
+	}
+	for {
+		if err := sub.connect(ctx); err != nil {
+			return err
+		}
+		select {
+		case <-config.Clock.After(sub.config.RetryDelay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+type subscription struct {
+	config      SubscribeConfig
+	handle      func(Event) error
+	lastEventID string
+}
+
+// handlerError wraps an error returned by the handler
+// so that it is not mistaken for a connection failure.
+type handlerError struct {
+	err error
+}
+
+func (e *handlerError) Error() string {
+	return e.err.Error()
+}
+
+// connect reads the stream on a single connection. It returns
+// nil if the stream should be reconnected.
+func (sub *subscription) connect(ctx context.Context) error {
+	req, err := sub.config.NewRequest(sub.lastEventID)
+	if err != nil {
+		return errgo.Notef(err, "cannot make request")
+	}
+	// The connection has a context of its own so that
+	// it can be closed when it has been idle too long.
+	connCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	req = req.WithContext(connCtx)
+	if sub.lastEventID != "" {
+		req.Header.Set("Last-Event-ID", sub.lastEventID)
+	}
+	req.Header.Set("Accept", string(SSE)+", "+string(NDJSON))
+	resp, err := sub.config.Client.Do(req)
+	if err != nil {
+		return ctx.Err()
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNoContent:
+		return ErrStreamEnded
+	default:
+		return errgo.Newf("unexpected response status %q", resp.Status)
+	}
+	var body io.Reader = resp.Body
+	if sub.config.IdleTimeout > 0 {
+		body = sub.watchIdle(connCtx, cancel, body)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("content-type"))
+	switch StreamFormat(mediaType) {
+	case SSE:
+		err = sub.readSSE(body)
+	case NDJSON:
+		err = sub.readNDJSON(body)
+	default:
+		return errgo.Newf("unexpected content type %q", mediaType)
+	}
+	if herr, ok := err.(*handlerError); ok {
+		return herr.err
+	}
+	return ctx.Err()
+}
+
+// watchIdle returns a reader reading from r that calls cancel if
+// nothing is read for the configured idle timeout.
+func (sub *subscription) watchIdle(ctx context.Context, cancel func(), r io.Reader) io.Reader {
+	active := make(chan struct{}, 1)
+	go func() {
+		timer := sub.config.Clock.NewTimer(sub.config.IdleTimeout)
+		defer timer.Stop()
+		for {
+			select {
+			case <-active:
+				if !timer.Stop() {
+					<-timer.Chan()
+				}
+				timer.Reset(sub.config.IdleTimeout)
+			case <-timer.Chan():
+				cancel()
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return &activityReader{r: r, active: active}
+}
+
+// activityReader notifies active whenever it reads anything.
+type activityReader struct {
+	r      io.Reader
+	active chan struct{}
+}
+
+func (r *activityReader) Read(buf []byte) (int, error) {
+	n, err := r.r.Read(buf)
+	if n > 0 {
+		select {
+		case r.active <- struct{}{}:
+		default:
+		}
+	}
+	return n, err
+}
+
+func (sub *subscription) readNDJSON(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxLineSize)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			// Heartbeat.
+			continue
+		}
+		data := append([]byte(nil), line...)
+		if err := sub.handle(Event{Data: data}); err != nil {
+			return &handlerError{err}
+		}
+	}
+	return scanner.Err()
+}
+
+// The bounds on retry times sent in SSE streams, so that a server
+// cannot make a client reconnect in a tight loop or never again.
+const (
+	minSSERetry = 100 * time.Millisecond
+	maxSSERetry = 10 * time.Minute
+)
+
+// clampRetry returns the retry time given
+// in milliseconds, clamped to those bounds.
+func clampRetry(ms uint64) time.Duration {
+	switch {
+	case ms < uint64(minSSERetry/time.Millisecond):
+		return minSSERetry
+	case ms > uint64(maxSSERetry/time.Millisecond):
+		return maxSSERetry
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// maxLineSize holds the size of the longest line that
+// can be read from a stream.
+const maxLineSize = 1 << 20
+
+func (sub *subscription) readSSE(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxLineSize)
+	var e Event
+	var data bytes.Buffer
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			// A blank line dispatches the event,
+			// if it has any data.
+			if data.Len() > 0 {
+				e.ID = sub.lastEventID
+				e.Data = bytes.TrimSuffix(data.Bytes(), []byte("\n"))
+				e.Data = append([]byte(nil), e.Data...)
+				if err := sub.handle(e); err != nil {
+					return &handlerError{err}
+				}
+			}
+			e = Event{}
+			data.Reset()
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			// Comment, used for heartbeats.
+			continue
+		}
+		field, value := line, ""
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+		switch field {
+		case "event":
+			e.Event = value
+		case "data":
+			data.WriteString(value)
+			data.WriteByte('\n')
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				sub.lastEventID = value
+			}
+		case "retry":
+			if ms, err := strconv.ParseUint(value, 10, 63); err == nil {
+				e.Retry = clampRetry(ms)
+				sub.config.RetryDelay = e.Retry
+			}
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,286 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package jsonhttp_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/juju/clock/testclock"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/jsonhttp"
+)
+
+type streamSuite struct{}
+
+var _ = gc.Suite(&streamSuite{})
+
+func (*streamSuite) TestStreamNDJSON(c *gc.C) {
+	rec := httptest.NewRecorder()
+	s, err := jsonhttp.NewStream(rec, jsonhttp.StreamConfig{})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s.Send(map[string]int{"a": 1}), jc.ErrorIsNil)
+	c.Assert(s.Send("b"), jc.ErrorIsNil)
+	s.Close()
+	c.Assert(rec.Code, gc.Equals, http.StatusOK)
+	c.Assert(rec.Header().Get("content-type"), gc.Equals, "application/x-ndjson")
+	c.Assert(rec.Header().Get("cache-control"), gc.Equals, "no-cache")
+	c.Assert(rec.Flushed, jc.IsTrue)
+	c.Assert(rec.Body.String(), gc.Equals, "{\"a\":1}\n\"b\"\n")
+
+	err = s.SendEvent(jsonhttp.Event{Data: []byte("x")})
+	c.Assert(err, gc.ErrorMatches, "cannot send event in application/x-ndjson stream")
+}
+
+func (*streamSuite) TestStreamSSE(c *gc.C) {
+	rec := httptest.NewRecorder()
+	s, err := jsonhttp.NewStream(rec, jsonhttp.StreamConfig{Format: jsonhttp.SSE})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s.Send([]int{1, 2}), jc.ErrorIsNil)
+	err = s.SendEvent(jsonhttp.Event{
+		ID:    "42",
+		Event: "update",
+		Data:  []byte("line one\nline two"),
+		Retry: 1500 * time.Millisecond,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	err = s.SendEvent(jsonhttp.Event{Event: "bad\nevent"})
+	c.Assert(err, gc.ErrorMatches, "event ID or type contains a newline")
+	s.Close()
+	c.Assert(rec.Header().Get("content-type"), gc.Equals, "text/event-stream")
+	c.Assert(rec.Body.String(), gc.Equals, ""+
+		"data: [1,2]\n\n"+
+		"id: 42\nevent: update\nretry: 1500\ndata: line one\ndata: line two\n\n")
+}
+
+func (*streamSuite) TestNewStreamErrors(c *gc.C) {
+	_, err := jsonhttp.NewStream(nonFlusher{httptest.NewRecorder()}, jsonhttp.StreamConfig{})
+	c.Assert(err, gc.ErrorMatches, `response writer jsonhttp_test.nonFlusher does not support flushing`)
+	_, err = jsonhttp.NewStream(httptest.NewRecorder(), jsonhttp.StreamConfig{Format: "text/plain"})
+	c.Assert(err, gc.ErrorMatches, `unknown stream format "text/plain"`)
+}
+
+type nonFlusher struct {
+	http.ResponseWriter
+}
+
+func (*streamSuite) TestStreamHeartbeat(c *gc.C) {
+	for _, format := range []jsonhttp.StreamFormat{jsonhttp.NDJSON, jsonhttp.SSE} {
+		c.Logf("format %s", format)
+		clk := testclock.NewClock(time.Time{})
+		rec := httptest.NewRecorder()
+		s, err := jsonhttp.NewStream(rec, jsonhttp.StreamConfig{
+			Format:    format,
+			Heartbeat: time.Second,
+			Clock:     clk,
+		})
+		c.Assert(err, jc.ErrorIsNil)
+		err = clk.WaitAdvance(time.Second, testing.LongWait, 1)
+		c.Assert(err, jc.ErrorIsNil)
+		// Wait for the timer to be reset after the heartbeat.
+		err = clk.WaitAdvance(0, testing.LongWait, 1)
+		c.Assert(err, jc.ErrorIsNil)
+		s.Close()
+		if format == jsonhttp.SSE {
+			c.Check(rec.Body.String(), gc.Equals, ":\n\n")
+		} else {
+			c.Check(rec.Body.String(), gc.Equals, "\n")
+		}
+	}
+}
+
+// streamServer returns a server that calls the given handlers
+// for successive requests, recording the Last-Event-ID header of
+// each, and responds with 204 No Content once they have all
+// been called.
+func streamServer(c *gc.C, handlers ...func(http.ResponseWriter, *http.Request)) (*httptest.Server, *[]string) {
+	var mu sync.Mutex
+	var lastIDs []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		n := len(lastIDs)
+		lastIDs = append(lastIDs, req.Header.Get("Last-Event-ID"))
+		mu.Unlock()
+		if n >= len(handlers) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		handlers[n](w, req)
+	}))
+	return srv, &lastIDs
+}
+
+func subscribeConfig(url string) jsonhttp.SubscribeConfig {
+	return jsonhttp.SubscribeConfig{
+		NewRequest: func(string) (*http.Request, error) {
+			return http.NewRequest("GET", url, nil)
+		},
+		RetryDelay: time.Millisecond,
+	}
+}
+
+func (*streamSuite) TestSubscribeSSE(c *gc.C) {
+	srv, lastIDs := streamServer(c, func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("content-type", "text/event-stream; charset=utf-8")
+		io.WriteString(w, ""+
+			": comment\n"+
+			"id: 1\nevent: add\ndata: {\"n\":1}\n\n"+
+			"retry: 2\n\n"+
+			"data:first\r\ndata: second\r\n\r\n"+
+			"id: 2\ndata\n\n")
+	}, func(w http.ResponseWriter, req *http.Request) {
+		s, err := jsonhttp.NewStream(w, jsonhttp.StreamConfig{Format: jsonhttp.SSE})
+		c.Check(err, jc.ErrorIsNil)
+		c.Check(s.SendEvent(jsonhttp.Event{ID: "3", Data: []byte("last")}), jc.ErrorIsNil)
+		s.Close()
+	})
+	defer srv.Close()
+
+	var events []jsonhttp.Event
+	err := jsonhttp.Subscribe(context.Background(), subscribeConfig(srv.URL), func(e jsonhttp.Event) error {
+		events = append(events, e)
+		return nil
+	})
+	c.Assert(err, gc.Equals, jsonhttp.ErrStreamEnded)
+	c.Assert(events, jc.DeepEquals, []jsonhttp.Event{
+		{ID: "1", Event: "add", Data: []byte(`{"n":1}`)},
+		{ID: "1", Data: []byte("first\nsecond")},
+		{ID: "2", Data: []byte("")},
+		{ID: "3", Data: []byte("last")},
+	})
+	c.Assert(*lastIDs, jc.DeepEquals, []string{"", "2", "3"})
+
+	var v struct{ N int }
+	c.Assert(events[0].Decode(&v), jc.ErrorIsNil)
+	c.Assert(v.N, gc.Equals, 1)
+	c.Assert(events[1].Decode(&v), gc.ErrorMatches, "cannot decode event data: .*")
+}
+
+func (*streamSuite) TestSubscribeSSERetryClamped(c *gc.C) {
+	srv, _ := streamServer(c, func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("content-type", "text/event-stream")
+		io.WriteString(w, ""+
+			"retry: 0\ndata: a\n\n"+
+			"retry: 99999999999999999\ndata: b\n\n"+
+			"retry: 1500\ndata: c\n\n")
+	})
+	defer srv.Close()
+
+	var retries []time.Duration
+	errStop := errors.New("stop")
+	err := jsonhttp.Subscribe(context.Background(), subscribeConfig(srv.URL), func(e jsonhttp.Event) error {
+		retries = append(retries, e.Retry)
+		if len(retries) == 3 {
+			return errStop
+		}
+		return nil
+	})
+	c.Assert(err, gc.Equals, errStop)
+	c.Assert(retries, jc.DeepEquals, []time.Duration{100 * time.Millisecond, 10 * time.Minute, 1500 * time.Millisecond})
+}
+
+func (*streamSuite) TestSubscribeNDJSON(c *gc.C) {
+	srv, _ := streamServer(c, func(w http.ResponseWriter, req *http.Request) {
+		s, err := jsonhttp.NewStream(w, jsonhttp.StreamConfig{})
+		c.Check(err, jc.ErrorIsNil)
+		for i := 0; i < 5; i++ {
+			if s.Send(i) != nil {
+				break
+			}
+			io.WriteString(w, "\n")
+		}
+		s.Close()
+	})
+	defer srv.Close()
+
+	var got []string
+	errStop := errors.New("stop")
+	err := jsonhttp.Subscribe(context.Background(), subscribeConfig(srv.URL), func(e jsonhttp.Event) error {
+		got = append(got, string(e.Data))
+		if len(got) == 3 {
+			return errStop
+		}
+		return nil
+	})
+	c.Assert(err, gc.Equals, errStop)
+	c.Assert(got, jc.DeepEquals, []string{"0", "1", "2"})
+}
+
+func (*streamSuite) TestSubscribeBadResponse(c *gc.C) {
+	srv, _ := streamServer(c, func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "no", http.StatusForbidden)
+	})
+	defer srv.Close()
+	err := jsonhttp.Subscribe(context.Background(), subscribeConfig(srv.URL), func(jsonhttp.Event) error {
+		return nil
+	})
+	c.Assert(err, gc.ErrorMatches, `unexpected response status "403 Forbidden"`)
+
+	srv, _ = streamServer(c, func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("content-type", "text/plain")
+	})
+	defer srv.Close()
+	err = jsonhttp.Subscribe(context.Background(), subscribeConfig(srv.URL), func(jsonhttp.Event) error {
+		return nil
+	})
+	c.Assert(err, gc.ErrorMatches, `unexpected content type "text/plain"`)
+}
+
+func (*streamSuite) TestSubscribeIdleTimeout(c *gc.C) {
+	srv, _ := streamServer(c, func(w http.ResponseWriter, req *http.Request) {
+		s, err := jsonhttp.NewStream(w, jsonhttp.StreamConfig{})
+		c.Check(err, jc.ErrorIsNil)
+		c.Check(s.Send("hello"), jc.ErrorIsNil)
+		s.Close()
+		// Hang until the client gives up.
+		<-req.Context().Done()
+	})
+	defer srv.Close()
+
+	config := subscribeConfig(srv.URL)
+	config.IdleTimeout = 50 * time.Millisecond
+	var got []string
+	err := jsonhttp.Subscribe(context.Background(), config, func(e jsonhttp.Event) error {
+		got = append(got, string(e.Data))
+		return nil
+	})
+	c.Assert(err, gc.Equals, jsonhttp.ErrStreamEnded)
+	c.Assert(got, jc.DeepEquals, []string{`"hello"`})
+}
+
+func (*streamSuite) TestSubscribeContextDone(c *gc.C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	srv, _ := streamServer(c, func(w http.ResponseWriter, req *http.Request) {
+		s, err := jsonhttp.NewStream(w, jsonhttp.StreamConfig{})
+		c.Check(err, jc.ErrorIsNil)
+		c.Check(s.Send("hello"), jc.ErrorIsNil)
+		s.Close()
+		<-req.Context().Done()
+	})
+	defer srv.Close()
+	err := jsonhttp.Subscribe(ctx, subscribeConfig(srv.URL), func(e jsonhttp.Event) error {
+		cancel()
+		return nil
+	})
+	c.Assert(err, gc.Equals, context.Canceled)
+}
+
+func (*streamSuite) TestSubscribeRequestError(c *gc.C) {
+	config := jsonhttp.SubscribeConfig{
+		NewRequest: func(string) (*http.Request, error) {
+			return nil, fmt.Errorf("bad url")
+		},
+	}
+	err := jsonhttp.Subscribe(context.Background(), config, nil)
+	c.Assert(err, gc.ErrorMatches, "cannot make request: bad url")
+}
@@ -0,0 +1,240 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package keyvalues
+
+import (
+	"encoding"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/utils/v3"
+)
+
+// Loader populates structs from Values and environment variables.
+//
+// Struct fields are described with tags:
+//
+//	key:"name"        the key of the field in Values
+//	env:"NAME"        the environment variable for the field
+//	default:"value"   the value used when neither is set
+//	required:"true"   the field must be set
+//
+// A field tagged with env is set from the environment variable in
+// preference to Values, so that the environment can override
+// configuration files. Fields of struct type are loaded recursively;
+// if such a field has a key tag, it is used as a prefix for the keys
+// of the nested fields, as in "db.host". Fields with neither a key
+// nor an env tag are left alone.
+//
+// Supported field types are strings, bools, integers, floats,
+// time.Duration (parsed with utils.ParseDuration), []string (parsed
+// as a comma separated list), any type implementing
+// encoding.TextUnmarshaler, such as utils.ByteSize, and pointers to
+// any of these, which are left nil when no value is found.
+type Loader struct {
+	// Values holds the values to load.
+	Values Values
+
+	// LookupEnv looks up environment variables. If it is nil,
+	// os.LookupEnv is used.
+	LookupEnv func(name string) (string, bool)
+
+	// EnvPrefix is prepended to the name of every
+	// environment variable looked up.
+	EnvPrefix string
+}
+
+// Load populates the struct pointed to by dst. All the values are
+// checked before returning; if any are missing or invalid, the
+// error is an Errors describing every problem.
+func (l Loader) Load(dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("cannot load into %T: expected pointer to struct", dst)
+	}
+	if l.LookupEnv == nil {
+		l.LookupEnv = os.LookupEnv
+	}
+	var errs Errors
+	if err := l.loadStruct(v.Elem(), "", &errs); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Load populates the struct pointed to by dst from v and the
+// environment, as described for Loader.
+func (v Values) Load(dst interface{}) error {
+	return Loader{Values: v}.Load(dst)
+}
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// loadStruct loads the fields of v, prefixing their keys with prefix.
+// Problems with values are added to errs; an error is returned only
+// for fields that cannot be loaded at all.
+func (l Loader) loadStruct(v reflect.Value, prefix string, errs *Errors) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		key, hasKey := field.Tag.Lookup("key")
+		env, hasEnv := field.Tag.Lookup("env")
+		if hasKey {
+			key = prefix + key
+		}
+		fv := v.Field(i)
+		if field.Type.Kind() == reflect.Struct && !implementsTextUnmarshaler(field.Type) {
+			nested := prefix
+			if hasKey {
+				nested = key + "."
+			}
+			if err := l.loadStruct(fv, nested, errs); err != nil {
+				return err
+			}
+			continue
+		}
+		if !hasKey && !hasEnv {
+			continue
+		}
+		name, val, ok := l.lookup(key, hasKey, env, hasEnv)
+		if !ok {
+			// Report problems under the key if there is one,
+			// as that is how the field is usually documented.
+			name = key
+			if !hasKey {
+				name = l.EnvPrefix + env
+			}
+			dflt, hasDefault := field.Tag.Lookup("default")
+			if !hasDefault {
+				if field.Tag.Get("required") == "true" {
+					*errs = append(*errs, fmt.Errorf("missing required key %q", name))
+				}
+				continue
+			}
+			val = dflt
+		}
+		if err := setValue(fv, name, val); err != nil {
+			if _, ok := err.(invalidValueError); !ok {
+				return fmt.Errorf("cannot load field %s: %v", field.Name, err)
+			}
+			*errs = append(*errs, err)
+		}
+	}
+	return nil
+}
+
+// lookup returns the value for a field from the environment or from
+// the loader's Values, along with the name it was found under.
+func (l Loader) lookup(key string, hasKey bool, env string, hasEnv bool) (string, string, bool) {
+	if hasEnv {
+		name := l.EnvPrefix + env
+		if val, ok := l.LookupEnv(name); ok {
+			return name, val, true
+		}
+	}
+	if hasKey {
+		if val, ok := l.Values[key]; ok {
+			return key, val, true
+		}
+	}
+	return "", "", false
+}
+
+func implementsTextUnmarshaler(t reflect.Type) bool {
+	return reflect.PtrTo(t).Implements(textUnmarshalerType)
+}
+
+// invalidValueError is returned by setValue when a value
+// cannot be parsed.
+type invalidValueError struct {
+	error
+}
+
+// setValue parses val, found under the given name, into v.
+func setValue(v reflect.Value, name, val string) error {
+	invalid := func(expected string) error {
+		return invalidValueError{invalidValue(name, val, expected)}
+	}
+	if v.Kind() == reflect.Ptr {
+		elem := reflect.New(v.Type().Elem())
+		if err := setValue(elem.Elem(), name, val); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	}
+	if implementsTextUnmarshaler(v.Type()) {
+		if err := v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(val)); err != nil {
+			return invalid(fmt.Sprintf("a valid %s", v.Type()))
+		}
+		return nil
+	}
+	if v.Type() == durationType {
+		d, err := utils.ParseDuration(val)
+		if err != nil {
+			return invalid("a duration")
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(val)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return invalid("a boolean")
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(val, 0, v.Type().Bits())
+		if err != nil {
+			return invalid("an integer")
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(val, 0, v.Type().Bits())
+		if err != nil {
+			return invalid("a non-negative integer")
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(val, v.Type().Bits())
+		if err != nil {
+			return invalid("a number")
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", v.Type())
+		}
+		var items []string
+		for _, item := range strings.Split(val, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		s := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			s.Index(i).SetString(item)
+		}
+		v.Set(s)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
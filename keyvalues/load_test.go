@@ -0,0 +1,157 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package keyvalues_test
+
+import (
+	"time"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3"
+	"github.com/juju/utils/v3/keyvalues"
+)
+
+type loadSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&loadSuite{})
+
+type dbConfig struct {
+	Host string `key:"host" env:"DB_HOST" default:"localhost"`
+	Port int    `key:"port" default:"5432"`
+}
+
+type agentConfig struct {
+	Name     string           `key:"name" required:"true"`
+	Debug    bool             `key:"debug" env:"DEBUG"`
+	Interval time.Duration    `key:"interval" default:"1m"`
+	MaxLog   utils.ByteSize   `key:"max-log" default:"10MiB"`
+	Ratio    float64          `key:"ratio"`
+	Workers  uint8            `key:"workers" default:"4"`
+	Tags     []string         `key:"tags"`
+	Timeout  *time.Duration   `key:"timeout"`
+	Token    string           `env:"TOKEN"`
+	DB       dbConfig         `key:"db"`
+	Extra    struct{ A bool } `key:"extra"`
+	Ignored  string
+	unused   string
+}
+
+func (s *loadSuite) TestLoad(c *gc.C) {
+	env := map[string]string{
+		"AGENT_DB_HOST": "db.internal",
+		"AGENT_TOKEN":   "secret",
+		"AGENT_DEBUG":   "true",
+	}
+	loader := keyvalues.Loader{
+		Values: keyvalues.Values{
+			"name":    "machine-0",
+			"debug":   "false",
+			"ratio":   "0.5",
+			"tags":    "a, b,,c",
+			"timeout": "2d",
+			"db.host": "ignored",
+			"db.port": "6000",
+		},
+		LookupEnv: func(name string) (string, bool) {
+			v, ok := env[name]
+			return v, ok
+		},
+		EnvPrefix: "AGENT_",
+	}
+	var cfg agentConfig
+	cfg.Ignored = "left alone"
+	err := loader.Load(&cfg)
+	c.Assert(err, jc.ErrorIsNil)
+	timeout := 48 * time.Hour
+	c.Check(cfg, jc.DeepEquals, agentConfig{
+		Name:     "machine-0",
+		Debug:    true,
+		Interval: time.Minute,
+		MaxLog:   10 * utils.MiB,
+		Ratio:    0.5,
+		Workers:  4,
+		Tags:     []string{"a", "b", "c"},
+		Timeout:  &timeout,
+		Token:    "secret",
+		DB:       dbConfig{Host: "db.internal", Port: 6000},
+		Ignored:  "left alone",
+	})
+}
+
+func (s *loadSuite) TestLoadPointerUnset(c *gc.C) {
+	var cfg agentConfig
+	err := keyvalues.Loader{
+		Values:    keyvalues.Values{"name": "x"},
+		LookupEnv: func(string) (string, bool) { return "", false },
+	}.Load(&cfg)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(cfg.Timeout, gc.IsNil)
+	c.Check(cfg.DB, gc.Equals, dbConfig{Host: "localhost", Port: 5432})
+}
+
+func (s *loadSuite) TestLoadErrorsAggregated(c *gc.C) {
+	var cfg agentConfig
+	err := keyvalues.Loader{
+		Values: keyvalues.Values{
+			"debug":    "maybe",
+			"interval": "soon",
+			"max-log":  "lots",
+			"workers":  "300",
+			"db.port":  "x",
+		},
+		LookupEnv: func(name string) (string, bool) { return "", false },
+	}.Load(&cfg)
+	c.Assert(err, gc.FitsTypeOf, keyvalues.Errors{})
+	c.Check(err.(keyvalues.Errors), gc.HasLen, 6)
+	c.Check(err, gc.ErrorMatches, ``+
+		`missing required key "name"; `+
+		`invalid value "maybe" for "debug": expected a boolean; `+
+		`invalid value "soon" for "interval": expected a duration; `+
+		`invalid value "lots" for "max-log": expected a valid utils.ByteSize; `+
+		`invalid value "300" for "workers": expected a non-negative integer; `+
+		`invalid value "x" for "db.port": expected an integer`)
+}
+
+func (s *loadSuite) TestLoadInvalidEnvNamesVariable(c *gc.C) {
+	var cfg struct {
+		Debug bool `key:"debug" env:"DEBUG"`
+	}
+	err := keyvalues.Loader{
+		LookupEnv: func(name string) (string, bool) { return "yes please", true },
+		EnvPrefix: "JUJU_",
+	}.Load(&cfg)
+	c.Check(err, gc.ErrorMatches, `invalid value "yes please" for "JUJU_DEBUG": expected a boolean`)
+}
+
+func (s *loadSuite) TestValuesLoadUsesEnvironment(c *gc.C) {
+	s.PatchEnvironment("JUJU_LOAD_TEST", "from-env")
+	var cfg struct {
+		A string `key:"a" env:"JUJU_LOAD_TEST"`
+		B string `key:"b"`
+	}
+	err := keyvalues.Values{"a": "x", "b": "y"}.Load(&cfg)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(cfg.A, gc.Equals, "from-env")
+	c.Check(cfg.B, gc.Equals, "y")
+}
+
+func (s *loadSuite) TestLoadUnsupportedType(c *gc.C) {
+	var cfg struct {
+		M map[string]string `key:"m"`
+	}
+	err := keyvalues.Values{"m": "x"}.Load(&cfg)
+	c.Check(err, gc.ErrorMatches, `cannot load field M: unsupported type map\[string\]string`)
+}
+
+func (s *loadSuite) TestLoadNotStructPointer(c *gc.C) {
+	var n int
+	err := keyvalues.Values{}.Load(&n)
+	c.Check(err, gc.ErrorMatches, `cannot load into \*int: expected pointer to struct`)
+	err = keyvalues.Values{}.Load(agentConfig{})
+	c.Check(err, gc.ErrorMatches, `cannot load into keyvalues_test.agentConfig: expected pointer to struct`)
+}
@@ -0,0 +1,258 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package keyvalues
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/utils/v3"
+)
+
+// Values holds parsed key=value pairs. Keys may be dotted, as in
+// "db.host=localhost", to represent nested values.
+type Values map[string]string
+
+// ParseValues is like Parse but returns the result as Values.
+func ParseValues(src []string, allowEmptyValues bool) (Values, error) {
+	m, err := Parse(src, allowEmptyValues)
+	if err != nil {
+		return nil, err
+	}
+	return Values(m), nil
+}
+
+// Lookup returns the value for key and whether it was set.
+func (v Values) Lookup(key string) (string, bool) {
+	val, ok := v[key]
+	return val, ok
+}
+
+// String returns the value for key, or dflt if it is not set.
+func (v Values) String(key, dflt string) string {
+	if val, ok := v[key]; ok {
+		return val
+	}
+	return dflt
+}
+
+// Int returns the value for key as an int, or dflt if it is not set.
+func (v Values) Int(key string, dflt int) (int, error) {
+	val, ok := v[key]
+	if !ok {
+		return dflt, nil
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, invalidValue(key, val, "an integer")
+	}
+	return n, nil
+}
+
+// Bool returns the value for key as a bool, or dflt if it is not set.
+// Values are parsed with strconv.ParseBool.
+func (v Values) Bool(key string, dflt bool) (bool, error) {
+	val, ok := v[key]
+	if !ok {
+		return dflt, nil
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		return false, invalidValue(key, val, "a boolean")
+	}
+	return b, nil
+}
+
+// Duration returns the value for key as a duration, or dflt if it
+// is not set. Values are parsed with utils.ParseDuration.
+func (v Values) Duration(key string, dflt time.Duration) (time.Duration, error) {
+	val, ok := v[key]
+	if !ok {
+		return dflt, nil
+	}
+	d, err := utils.ParseDuration(val)
+	if err != nil {
+		return 0, invalidValue(key, val, "a duration")
+	}
+	return d, nil
+}
+
+// Size returns the value for key as a size, or dflt if it is not
+// set. Values are parsed with utils.ParseByteSize.
+func (v Values) Size(key string, dflt utils.ByteSize) (utils.ByteSize, error) {
+	val, ok := v[key]
+	if !ok {
+		return dflt, nil
+	}
+	size, err := utils.ParseByteSize(val)
+	if err != nil {
+		return 0, invalidValue(key, val, "a size")
+	}
+	return size, nil
+}
+
+func invalidValue(key, val, expected string) error {
+	return fmt.Errorf("invalid value %q for %q: expected %s", val, key, expected)
+}
+
+// Require returns an error naming all of the given keys that are not
+// set, or nil if they are all set.
+func (v Values) Require(keys ...string) error {
+	var missing []string
+	for _, key := range keys {
+		if _, ok := v[key]; !ok {
+			missing = append(missing, fmt.Sprintf("%q", key))
+		}
+	}
+	switch len(missing) {
+	case 0:
+		return nil
+	case 1:
+		return fmt.Errorf("missing required key %s", missing[0])
+	}
+	return fmt.Errorf("missing required keys %s", strings.Join(missing, ", "))
+}
+
+// Sub returns the values nested under the given dotted prefix, with
+// the prefix removed from their keys. For example, if v holds
+// "db.host" and "db.port", v.Sub("db") holds "host" and "port".
+func (v Values) Sub(prefix string) Values {
+	prefix += "."
+	sub := make(Values)
+	for key, val := range v {
+		if strings.HasPrefix(key, prefix) {
+			sub[key[len(prefix):]] = val
+		}
+	}
+	return sub
+}
+
+// Nested returns the values as a tree, splitting dotted keys into
+// nested maps. Each value in the result is either a string or a
+// map[string]interface{}. It returns an error if a key is used both
+// for a value and as the prefix of other keys.
+func (v Values) Nested() (map[string]interface{}, error) {
+	keys := make([]string, 0, len(v))
+	for key := range v {
+		keys = append(keys, key)
+	}
+	// Sorting ensures that a conflicting key is reported consistently.
+	sort.Strings(keys)
+	result := make(map[string]interface{})
+	for _, key := range keys {
+		parts := strings.Split(key, ".")
+		m := result
+		for i, part := range parts[:len(parts)-1] {
+			switch child := m[part].(type) {
+			case nil:
+				next := make(map[string]interface{})
+				m[part] = next
+				m = next
+			case map[string]interface{}:
+				m = child
+			default:
+				return nil, fmt.Errorf("key %q conflicts with %q", key, strings.Join(parts[:i+1], "."))
+			}
+		}
+		last := parts[len(parts)-1]
+		if _, ok := m[last]; ok {
+			return nil, fmt.Errorf("key %q conflicts with nested keys", key)
+		}
+		m[last] = v[key]
+	}
+	return result, nil
+}
+
+// Checker retrieves typed values from Values, accumulating any errors
+// so that they may all be reported together. Getters return the
+// default value when an error occurs.
+type Checker struct {
+	values Values
+	errs   []error
+}
+
+// Checker returns a new Checker that retrieves values from v.
+func (v Values) Checker() *Checker {
+	return &Checker{values: v}
+}
+
+func (c *Checker) check(err error) {
+	if err != nil {
+		c.errs = append(c.errs, err)
+	}
+}
+
+// String returns the value for key, or dflt if it is not set.
+func (c *Checker) String(key, dflt string) string {
+	return c.values.String(key, dflt)
+}
+
+// Int is like Values.Int but records any error.
+func (c *Checker) Int(key string, dflt int) int {
+	n, err := c.values.Int(key, dflt)
+	if err != nil {
+		c.check(err)
+		return dflt
+	}
+	return n
+}
+
+// Bool is like Values.Bool but records any error.
+func (c *Checker) Bool(key string, dflt bool) bool {
+	b, err := c.values.Bool(key, dflt)
+	if err != nil {
+		c.check(err)
+		return dflt
+	}
+	return b
+}
+
+// Duration is like Values.Duration but records any error.
+func (c *Checker) Duration(key string, dflt time.Duration) time.Duration {
+	d, err := c.values.Duration(key, dflt)
+	if err != nil {
+		c.check(err)
+		return dflt
+	}
+	return d
+}
+
+// Size is like Values.Size but records any error.
+func (c *Checker) Size(key string, dflt utils.ByteSize) utils.ByteSize {
+	size, err := c.values.Size(key, dflt)
+	if err != nil {
+		c.check(err)
+		return dflt
+	}
+	return size
+}
+
+// Require is like Values.Require but records any error.
+func (c *Checker) Require(keys ...string) {
+	c.check(c.values.Require(keys...))
+}
+
+// Err returns nil if no errors have been recorded. Otherwise it
+// returns an Errors holding all the recorded errors.
+func (c *Checker) Err() error {
+	if len(c.errs) == 0 {
+		return nil
+	}
+	return Errors(append([]error(nil), c.errs...))
+}
+
+// Errors holds several errors found when checking values.
+type Errors []error
+
+// Error implements the error interface.
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
@@ -0,0 +1,136 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package keyvalues_test
+
+import (
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3"
+	"github.com/juju/utils/v3/keyvalues"
+)
+
+type valuesSuite struct{}
+
+var _ = gc.Suite(&valuesSuite{})
+
+func (valuesSuite) parse(c *gc.C, src ...string) keyvalues.Values {
+	v, err := keyvalues.ParseValues(src, true)
+	c.Assert(err, jc.ErrorIsNil)
+	return v
+}
+
+func (s valuesSuite) TestTypedGetters(c *gc.C) {
+	v := s.parse(c, "name=foo", "port=8080", "debug=true", "timeout=2d", "limit=1.5GiB")
+
+	c.Check(v.String("name", "bar"), gc.Equals, "foo")
+	c.Check(v.String("other", "bar"), gc.Equals, "bar")
+
+	n, err := v.Int("port", 80)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(n, gc.Equals, 8080)
+	n, err = v.Int("other", 80)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(n, gc.Equals, 80)
+
+	b, err := v.Bool("debug", false)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(b, jc.IsTrue)
+
+	d, err := v.Duration("timeout", time.Minute)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(d, gc.Equals, 48*time.Hour)
+
+	size, err := v.Size("limit", utils.GiB)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(size, gc.Equals, 3*512*utils.MiB)
+	size, err = v.Size("other", utils.GiB)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(size, gc.Equals, utils.GiB)
+}
+
+func (s valuesSuite) TestTypedGettersInvalid(c *gc.C) {
+	v := s.parse(c, "x=foo")
+	_, err := v.Int("x", 0)
+	c.Check(err, gc.ErrorMatches, `invalid value "foo" for "x": expected an integer`)
+	_, err = v.Bool("x", false)
+	c.Check(err, gc.ErrorMatches, `invalid value "foo" for "x": expected a boolean`)
+	_, err = v.Duration("x", 0)
+	c.Check(err, gc.ErrorMatches, `invalid value "foo" for "x": expected a duration`)
+	_, err = v.Size("x", 0)
+	c.Check(err, gc.ErrorMatches, `invalid value "foo" for "x": expected a size`)
+}
+
+func (s valuesSuite) TestRequire(c *gc.C) {
+	v := s.parse(c, "a=1")
+	c.Check(v.Require("a"), jc.ErrorIsNil)
+	c.Check(v.Require("a", "b"), gc.ErrorMatches, `missing required key "b"`)
+	c.Check(v.Require("c", "a", "b"), gc.ErrorMatches, `missing required keys "c", "b"`)
+}
+
+func (s valuesSuite) TestSub(c *gc.C) {
+	v := s.parse(c, "db.host=localhost", "db.port=5432", "dbx=1", "name=foo")
+	c.Check(v.Sub("db"), jc.DeepEquals, keyvalues.Values{
+		"host": "localhost",
+		"port": "5432",
+	})
+	c.Check(v.Sub("none"), gc.HasLen, 0)
+}
+
+func (s valuesSuite) TestNested(c *gc.C) {
+	v := s.parse(c, "db.host=localhost", "db.auth.user=admin", "name=foo")
+	tree, err := v.Nested()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(tree, jc.DeepEquals, map[string]interface{}{
+		"name": "foo",
+		"db": map[string]interface{}{
+			"host": "localhost",
+			"auth": map[string]interface{}{
+				"user": "admin",
+			},
+		},
+	})
+}
+
+func (s valuesSuite) TestNestedConflict(c *gc.C) {
+	v := s.parse(c, "db=x", "db.host=localhost")
+	_, err := v.Nested()
+	c.Check(err, gc.ErrorMatches, `key "db.host" conflicts with "db"`)
+
+	v = s.parse(c, "db.host=localhost", "db.host.name=x")
+	_, err = v.Nested()
+	c.Check(err, gc.ErrorMatches, `key "db.host.name" conflicts with "db.host"`)
+}
+
+func (s valuesSuite) TestChecker(c *gc.C) {
+	v := s.parse(c, "port=http", "debug=yes", "timeout=5m")
+	check := v.Checker()
+	port := check.Int("port", 80)
+	debug := check.Bool("debug", false)
+	timeout := check.Duration("timeout", time.Minute)
+	limit := check.Size("limit", utils.MiB)
+	check.Require("name", "port")
+
+	c.Check(port, gc.Equals, 80)
+	c.Check(debug, jc.IsFalse)
+	c.Check(timeout, gc.Equals, 5*time.Minute)
+	c.Check(limit, gc.Equals, utils.MiB)
+
+	err := check.Err()
+	c.Assert(err, gc.FitsTypeOf, keyvalues.Errors{})
+	c.Check(err.(keyvalues.Errors), gc.HasLen, 3)
+	c.Check(err, gc.ErrorMatches, `invalid value "http" for "port": expected an integer; `+
+		`invalid value "yes" for "debug": expected a boolean; `+
+		`missing required key "name"`)
+}
+
+func (s valuesSuite) TestCheckerNoErrors(c *gc.C) {
+	v := s.parse(c, "port=8080")
+	check := v.Checker()
+	c.Check(check.Int("port", 80), gc.Equals, 8080)
+	check.Require("port")
+	c.Check(check.Err(), jc.ErrorIsNil)
+}
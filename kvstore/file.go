@@ -0,0 +1,314 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package kvstore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/juju/errors"
+	"github.com/juju/loggo"
+
+	"github.com/juju/utils/v3"
+	"github.com/juju/utils/v3/daemon"
+)
+
+var logger = loggo.GetLogger("juju.utils.kvstore")
+
+// A store file starts with fileMagic, followed by a record for each
+// committed transaction. A record is a four byte length and a four
+// byte CRC-32C checksum of its payload, both big-endian, followed by
+// the payload, which holds a sequence of operations. Each operation
+// is a byte holding opPut or opDelete, followed by the length of the
+// key as a uvarint, the key, and for opPut the length of the value as
+// a uvarint and the value.
+const fileMagic = "jujukv1\n"
+
+const (
+	opPut    = 1
+	opDelete = 2
+)
+
+const recordHeaderSize = 8
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// compactMinSize holds the size that a store file must reach
+// before it is compacted.
+var compactMinSize int64 = 1 << 20
+
+// OpenFile opens the store held in the file at path, creating it if it
+// does not exist. Only one store may have the file open at a time,
+// which is ensured with a lock file next to it.
+//
+// Each transaction is appended to the file, and synced to disk before
+// Update returns. If the last transaction was not completely written,
+// because the system crashed while writing it, it is discarded. The
+// file is rewritten, dropping superseded values, whenever it has
+// doubled in size since it was last written in full.
+func OpenFile(path string) (Store, error) {
+	lock, err := daemon.AcquireFile(path + ".lock")
+	if err != nil {
+		return nil, errors.Annotatef(err, "cannot lock store %q", path)
+	}
+	log := &fileLog{
+		path: path,
+		lock: lock,
+	}
+	s := newStore(log)
+	if err := log.open(s.data); err != nil {
+		log.close()
+		return nil, errors.Trace(err)
+	}
+	return s, nil
+}
+
+// fileLog implements committer by appending
+// changes to a file.
+type fileLog struct {
+	path string
+	lock *daemon.Lock
+	file *os.File
+
+	// size holds the size of the file.
+	size int64
+
+	// fullSize holds the size of the file when
+	// it was last written in full.
+	fullSize int64
+}
+
+// open opens the file and reads its contents into data.
+func (l *fileLog) open(data map[string][]byte) error {
+	f, err := os.OpenFile(l.path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	l.file = f
+	contents, err := ioutil.ReadAll(f)
+	if err != nil {
+		return errors.Annotatef(err, "cannot read store %q", l.path)
+	}
+	if len(contents) == 0 {
+		if _, err := f.Write([]byte(fileMagic)); err != nil {
+			return errors.Annotatef(err, "cannot write store %q", l.path)
+		}
+		if err := f.Sync(); err != nil {
+			return errors.Trace(err)
+		}
+		l.size = int64(len(fileMagic))
+		l.fullSize = l.size
+		return nil
+	}
+	good, err := decodeFile(contents, data)
+	if err != nil {
+		return errors.Annotatef(err, "cannot read store %q", l.path)
+	}
+	if good < len(contents) {
+		logger.Warningf("discarding incomplete transaction at end of store %q", l.path)
+		if err := f.Truncate(int64(good)); err != nil {
+			return errors.Trace(err)
+		}
+		if err := f.Sync(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if _, err := f.Seek(int64(good), io.SeekStart); err != nil {
+		return errors.Trace(err)
+	}
+	l.size = int64(good)
+	l.fullSize = l.size
+	return nil
+}
+
+// commit implements committer.
+func (l *fileLog) commit(changes []change, data map[string][]byte) error {
+	if l.file == nil {
+		return errors.Errorf("store %q is unusable after an earlier error", l.path)
+	}
+	record := encodeRecord(changes)
+	if _, err := l.file.Write(record); err != nil {
+		// Remove any partial record so that
+		// later records can still be read.
+		l.truncate()
+		return errors.Annotatef(err, "cannot write store %q", l.path)
+	}
+	if err := l.file.Sync(); err != nil {
+		l.truncate()
+		return errors.Annotatef(err, "cannot sync store %q", l.path)
+	}
+	l.size += int64(len(record))
+	if l.size >= compactMinSize && l.size >= 2*l.fullSize {
+		// The transaction has been committed,
+		// so a failure here is not fatal.
+		if err := l.compact(data); err != nil {
+			logger.Warningf("cannot compact store %q: %v", l.path, err)
+		}
+	}
+	return nil
+}
+
+// truncate truncates the file to its recorded size.
+func (l *fileLog) truncate() {
+	if err := l.file.Truncate(l.size); err != nil {
+		logger.Errorf("cannot truncate store %q: %v", l.path, err)
+		return
+	}
+	if _, err := l.file.Seek(l.size, io.SeekStart); err != nil {
+		logger.Errorf("cannot seek in store %q: %v", l.path, err)
+	}
+}
+
+// compact replaces the file with one holding only data.
+func (l *fileLog) compact(data map[string][]byte) error {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	changes := make([]change, len(keys))
+	for i, key := range keys {
+		changes[i] = change{key: key, value: data[key]}
+	}
+	contents := append([]byte(fileMagic), encodeRecord(changes)...)
+
+	// Windows does not allow an open file to be replaced.
+	if err := l.file.Close(); err != nil {
+		return errors.Trace(err)
+	}
+	l.file = nil
+	writeErr := utils.AtomicWriteFileWithOptions(l.path, contents, utils.AtomicWriteOptions{
+		Perms:   0600,
+		SyncDir: true,
+	})
+	f, err := os.OpenFile(l.path, os.O_RDWR, 0)
+	if err != nil {
+		return errors.Annotatef(err, "cannot reopen store %q", l.path)
+	}
+	l.file = f
+	if writeErr != nil {
+		if _, err := f.Seek(l.size, io.SeekStart); err != nil {
+			return errors.Trace(err)
+		}
+		return errors.Trace(writeErr)
+	}
+	l.size = int64(len(contents))
+	l.fullSize = l.size
+	_, err = f.Seek(l.size, io.SeekStart)
+	return errors.Trace(err)
+}
+
+// close implements committer.
+func (l *fileLog) close() error {
+	var err error
+	if l.file != nil {
+		err = l.file.Close()
+		l.file = nil
+	}
+	if releaseErr := l.lock.Release(); err == nil {
+		err = releaseErr
+	}
+	return errors.Trace(err)
+}
+
+// encodeRecord returns the record holding the given changes.
+func encodeRecord(changes []change) []byte {
+	var buf bytes.Buffer
+	buf.Write(make([]byte, recordHeaderSize))
+	var n [binary.MaxVarintLen64]byte
+	writeBytes := func(b []byte) {
+		buf.Write(n[:binary.PutUvarint(n[:], uint64(len(b)))])
+		buf.Write(b)
+	}
+	for _, c := range changes {
+		if c.deleted {
+			buf.WriteByte(opDelete)
+			writeBytes([]byte(c.key))
+		} else {
+			buf.WriteByte(opPut)
+			writeBytes([]byte(c.key))
+			writeBytes(c.value)
+		}
+	}
+	record := buf.Bytes()
+	payload := record[recordHeaderSize:]
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.Checksum(payload, crcTable))
+	return record
+}
+
+// decodeFile applies the records in the contents of a store file to
+// data. It returns the length of the contents that holds complete
+// records, which is less than their length if the last record is
+// incomplete.
+func decodeFile(contents []byte, data map[string][]byte) (int, error) {
+	if !bytes.HasPrefix(contents, []byte(fileMagic)) {
+		return 0, errors.NotValidf("store file header")
+	}
+	offset := len(fileMagic)
+	for offset < len(contents) {
+		rest := contents[offset:]
+		if len(rest) < recordHeaderSize {
+			break
+		}
+		size := binary.BigEndian.Uint32(rest[0:4])
+		if uint64(len(rest)-recordHeaderSize) < uint64(size) {
+			break
+		}
+		payload := rest[recordHeaderSize : recordHeaderSize+int(size)]
+		if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(rest[4:8]) {
+			// The record may have been partly written, so only
+			// treat it as corrupt if there are more records after it.
+			if offset+recordHeaderSize+int(size) < len(contents) {
+				return 0, errors.NotValidf("record at offset %d", offset)
+			}
+			break
+		}
+		if err := decodeRecord(payload, data); err != nil {
+			return 0, errors.Annotatef(err, "record at offset %d", offset)
+		}
+		offset += recordHeaderSize + int(size)
+	}
+	return offset, nil
+}
+
+// decodeRecord applies the operations in the
+// payload of a record to data.
+func decodeRecord(payload []byte, data map[string][]byte) error {
+	readBytes := func() ([]byte, error) {
+		n, size := binary.Uvarint(payload)
+		if size <= 0 || uint64(len(payload)-size) < n {
+			return nil, errors.NotValidf("length")
+		}
+		b := payload[size : size+int(n)]
+		payload = payload[size+int(n):]
+		return b, nil
+	}
+	for len(payload) > 0 {
+		op := payload[0]
+		payload = payload[1:]
+		key, err := readBytes()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		switch op {
+		case opPut:
+			value, err := readBytes()
+			if err != nil {
+				return errors.Trace(err)
+			}
+			data[string(key)] = copyBytes(value)
+		case opDelete:
+			delete(data, string(key))
+		default:
+			return errors.NotValidf("operation %d", op)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package kvstore_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/kvstore"
+)
+
+type fileSuite struct {
+	testing.IsolationSuite
+
+	path string
+}
+
+var _ = gc.Suite(&fileSuite{})
+
+func (s *fileSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.path = filepath.Join(c.MkDir(), "store")
+}
+
+func (s *fileSuite) open(c *gc.C) kvstore.Store {
+	store, err := kvstore.OpenFile(s.path)
+	c.Assert(err, jc.ErrorIsNil)
+	return store
+}
+
+func (s *fileSuite) fileSize(c *gc.C) int64 {
+	info, err := os.Stat(s.path)
+	c.Assert(err, jc.ErrorIsNil)
+	return info.Size()
+}
+
+func (s *fileSuite) TestPersists(c *gc.C) {
+	store := s.open(c)
+	c.Assert(store.Put("a", []byte("1")), jc.ErrorIsNil)
+	c.Assert(store.Put("b", []byte("2")), jc.ErrorIsNil)
+	err := store.Update(func(tx kvstore.Tx) error {
+		c.Check(tx.Delete("a"), jc.ErrorIsNil)
+		return tx.Put("c", []byte("3"))
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(store.Close(), jc.ErrorIsNil)
+
+	store = s.open(c)
+	defer store.Close()
+	c.Assert(contents(c, store, ""), jc.DeepEquals, map[string]string{
+		"b": "2",
+		"c": "3",
+	})
+}
+
+func (s *fileSuite) TestPermissions(c *gc.C) {
+	if runtime.GOOS == "windows" {
+		c.Skip("file permissions are not supported on windows")
+	}
+	store := s.open(c)
+	defer store.Close()
+	info, err := os.Stat(s.path)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(info.Mode().Perm(), gc.Equals, os.FileMode(0600))
+}
+
+func (s *fileSuite) TestLocked(c *gc.C) {
+	store := s.open(c)
+	_, err := kvstore.OpenFile(s.path)
+	c.Assert(err, gc.ErrorMatches, `cannot lock store ".*": already running.*`)
+	c.Assert(store.Close(), jc.ErrorIsNil)
+
+	store = s.open(c)
+	c.Assert(store.Close(), jc.ErrorIsNil)
+}
+
+func (s *fileSuite) TestIncompleteTransactionDiscarded(c *gc.C) {
+	store := s.open(c)
+	c.Assert(store.Put("a", []byte("1")), jc.ErrorIsNil)
+	size := s.fileSize(c)
+	c.Assert(store.Put("b", []byte("2")), jc.ErrorIsNil)
+	c.Assert(store.Close(), jc.ErrorIsNil)
+
+	// Simulate a crash while the last transaction was written.
+	for _, cut := range []int64{1, 5} {
+		c.Logf("cut %d", cut)
+		data, err := ioutil.ReadFile(s.path)
+		c.Assert(err, jc.ErrorIsNil)
+		err = ioutil.WriteFile(s.path, data[:int64(len(data))-cut], 0600)
+		c.Assert(err, jc.ErrorIsNil)
+
+		store = s.open(c)
+		c.Assert(contents(c, store, ""), jc.DeepEquals, map[string]string{"a": "1"})
+		c.Assert(s.fileSize(c), gc.Equals, size)
+
+		// The store can be written to after recovery.
+		c.Assert(store.Put("b", []byte("2")), jc.ErrorIsNil)
+		c.Assert(store.Close(), jc.ErrorIsNil)
+	}
+	store = s.open(c)
+	defer store.Close()
+	c.Assert(contents(c, store, ""), jc.DeepEquals, map[string]string{"a": "1", "b": "2"})
+}
+
+func (s *fileSuite) TestCorrupt(c *gc.C) {
+	store := s.open(c)
+	c.Assert(store.Put("a", []byte("1")), jc.ErrorIsNil)
+	c.Assert(store.Put("b", []byte("2")), jc.ErrorIsNil)
+	c.Assert(store.Close(), jc.ErrorIsNil)
+
+	data, err := ioutil.ReadFile(s.path)
+	c.Assert(err, jc.ErrorIsNil)
+	// Change the value of the first record.
+	data[len(data)/2-2] ^= 0xff
+	err = ioutil.WriteFile(s.path, data, 0600)
+	c.Assert(err, jc.ErrorIsNil)
+
+	_, err = kvstore.OpenFile(s.path)
+	c.Assert(err, gc.ErrorMatches, `cannot read store ".*": record at offset 8 not valid`)
+}
+
+func (s *fileSuite) TestNotStoreFile(c *gc.C) {
+	err := ioutil.WriteFile(s.path, []byte("hello world"), 0600)
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = kvstore.OpenFile(s.path)
+	c.Assert(err, gc.ErrorMatches, `cannot read store ".*": store file header not valid`)
+
+	// The lock is released on failure.
+	c.Assert(ioutil.WriteFile(s.path, nil, 0600), jc.ErrorIsNil)
+	store := s.open(c)
+	c.Assert(store.Close(), jc.ErrorIsNil)
+}
+
+func (s *fileSuite) TestCompaction(c *gc.C) {
+	s.PatchValue(kvstore.CompactMinSize, int64(1000))
+	store := s.open(c)
+	value := make([]byte, 100)
+	for i := 0; i < 100; i++ {
+		err := store.Put(fmt.Sprintf("key%d", i%3), value)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Assert(s.fileSize(c) < 1000, jc.IsTrue)
+	}
+	c.Assert(store.Close(), jc.ErrorIsNil)
+
+	store = s.open(c)
+	defer store.Close()
+	c.Assert(contents(c, store, ""), gc.HasLen, 3)
+}
@@ -0,0 +1,337 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package kvstore provides a small key-value store with transactions,
+// held either in memory or persistently in a single file.
+//
+// Keys are strings and values are byte slices. Values passed to and
+// returned from a store are copied, so callers may modify them freely.
+// Changes made in a transaction are applied atomically, and a store
+// allows one writer at a time alongside any number of readers:
+//
+//	err := store.Update(func(tx kvstore.Tx) error {
+//		old, err := tx.Get("counter")
+//		if err != nil && !errors.IsNotFound(err) {
+//			return err
+//		}
+//		return tx.Put("counter", increment(old))
+//	})
+package kvstore
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/juju/errors"
+)
+
+// ErrClosed is returned when a store is used after it has been closed.
+var ErrClosed = errors.New("store closed")
+
+// Reader reads from a store.
+type Reader interface {
+	// Get returns the value of the given key. If the key is not
+	// present, it returns an error satisfying errors.IsNotFound.
+	Get(key string) ([]byte, error)
+
+	// Iterate calls f for each key with the given prefix, in
+	// lexical order, with its value. If f returns an error,
+	// iteration stops and Iterate returns that error.
+	Iterate(prefix string, f func(key string, value []byte) error) error
+}
+
+// Tx reads from and writes to a store.
+type Tx interface {
+	Reader
+
+	// Put sets the value of the given key.
+	Put(key string, value []byte) error
+
+	// Delete removes the given key. It does nothing
+	// if the key is not present.
+	Delete(key string) error
+}
+
+// Store is a key-value store. Its methods may be called concurrently.
+//
+// The Tx methods of a Store run in a transaction of their own.
+type Store interface {
+	Tx
+
+	// View calls f with a read-only view of the store, which does not
+	// change while f runs. The view must not be used once f returns.
+	View(f func(Reader) error) error
+
+	// Update calls f with a transaction, whose changes are visible to
+	// later reads in the transaction and are applied to the store,
+	// all together, if f returns nil. Only one transaction updates the
+	// store at a time. The transaction must not be used once f returns.
+	Update(f func(Tx) error) error
+
+	// Close closes the store.
+	Close() error
+}
+
+// NewMemory returns a Store held in memory.
+func NewMemory() Store {
+	return newStore(nil)
+}
+
+// change holds a change to a key made in a transaction.
+type change struct {
+	key     string
+	value   []byte
+	deleted bool
+}
+
+// committer persists the changes made by a transaction.
+type committer interface {
+	// commit persists the given changes, given the contents of
+	// the store once they have been applied.
+	commit(changes []change, data map[string][]byte) error
+
+	// close releases the resources held by the committer.
+	close() error
+}
+
+// store implements Store.
+type store struct {
+	mu     sync.RWMutex
+	data   map[string][]byte
+	closed bool
+
+	// persist, if not nil, persists the
+	// changes made by transactions.
+	persist committer
+}
+
+func newStore(persist committer) *store {
+	return &store{
+		data:    make(map[string][]byte),
+		persist: persist,
+	}
+}
+
+// Get implements Reader.
+func (s *store) Get(key string) (value []byte, err error) {
+	err = s.View(func(r Reader) error {
+		value, err = r.Get(key)
+		return err
+	})
+	return value, err
+}
+
+// Iterate implements Reader.
+func (s *store) Iterate(prefix string, f func(key string, value []byte) error) error {
+	return s.View(func(r Reader) error {
+		return r.Iterate(prefix, f)
+	})
+}
+
+// Put implements Tx.
+func (s *store) Put(key string, value []byte) error {
+	return s.Update(func(tx Tx) error {
+		return tx.Put(key, value)
+	})
+}
+
+// Delete implements Tx.
+func (s *store) Delete(key string) error {
+	return s.Update(func(tx Tx) error {
+		return tx.Delete(key)
+	})
+}
+
+// View implements Store.
+func (s *store) View(f func(Reader) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return ErrClosed
+	}
+	t := &tx{store: s}
+	defer t.finish()
+	return f(t)
+}
+
+// Update implements Store.
+func (s *store) Update(f func(Tx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	t := &tx{
+		store:    s,
+		writable: true,
+		changes:  make(map[string]*change),
+	}
+	err := f(t)
+	t.finish()
+	if err != nil {
+		return err
+	}
+	return errors.Trace(s.commit(t.changes))
+}
+
+// commit applies the given changes. It is called with s.mu held.
+func (s *store) commit(changes map[string]*change) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	ordered := make([]change, 0, len(changes))
+	for _, c := range changes {
+		ordered = append(ordered, *c)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		return ordered[i].key < ordered[j].key
+	})
+	// Keep the old values so that the changes can be
+	// undone if they cannot be persisted.
+	old := make(map[string][]byte)
+	for _, c := range ordered {
+		if value, ok := s.data[c.key]; ok {
+			old[c.key] = value
+		}
+		if c.deleted {
+			delete(s.data, c.key)
+		} else {
+			s.data[c.key] = c.value
+		}
+	}
+	if s.persist == nil {
+		return nil
+	}
+	if err := s.persist.commit(ordered, s.data); err != nil {
+		for _, c := range ordered {
+			if value, ok := old[c.key]; ok {
+				s.data[c.key] = value
+			} else {
+				delete(s.data, c.key)
+			}
+		}
+		return errors.Trace(err)
+	}
+	return nil
+}
+
+// Close implements Store.
+func (s *store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	s.data = nil
+	if s.persist != nil {
+		return errors.Trace(s.persist.close())
+	}
+	return nil
+}
+
+// tx implements Tx.
+type tx struct {
+	store    *store
+	writable bool
+	done     bool
+
+	// changes holds the changes made in the
+	// transaction, by key.
+	changes map[string]*change
+}
+
+func (t *tx) finish() {
+	t.done = true
+}
+
+func (t *tx) check(write bool) error {
+	if t.done {
+		return errors.New("transaction used after completion")
+	}
+	if write && !t.writable {
+		return errors.New("cannot write in a read-only transaction")
+	}
+	return nil
+}
+
+// Get implements Reader.
+func (t *tx) Get(key string) ([]byte, error) {
+	if err := t.check(false); err != nil {
+		return nil, err
+	}
+	value, ok := t.get(key)
+	if !ok {
+		return nil, errors.NotFoundf("key %q", key)
+	}
+	return copyBytes(value), nil
+}
+
+// get returns the value of key as seen by the transaction.
+func (t *tx) get(key string) ([]byte, bool) {
+	if c, ok := t.changes[key]; ok {
+		return c.value, !c.deleted
+	}
+	value, ok := t.store.data[key]
+	return value, ok
+}
+
+// Iterate implements Reader.
+func (t *tx) Iterate(prefix string, f func(key string, value []byte) error) error {
+	if err := t.check(false); err != nil {
+		return err
+	}
+	var keys []string
+	for key := range t.store.data {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	for key, c := range t.changes {
+		if _, ok := t.store.data[key]; !ok && !c.deleted && strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		// The key may have been deleted by f.
+		value, ok := t.get(key)
+		if !ok {
+			continue
+		}
+		if err := f(key, copyBytes(value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Put implements Tx.
+func (t *tx) Put(key string, value []byte) error {
+	if err := t.check(true); err != nil {
+		return err
+	}
+	t.changes[key] = &change{key: key, value: copyBytes(value)}
+	return nil
+}
+
+// Delete implements Tx.
+func (t *tx) Delete(key string) error {
+	if err := t.check(true); err != nil {
+		return err
+	}
+	if _, ok := t.store.data[key]; !ok {
+		// There is nothing to delete
+		// unless it was put in t.
+		delete(t.changes, key)
+		return nil
+	}
+	t.changes[key] = &change{key: key, deleted: true}
+	return nil
+}
+
+// copyBytes returns a copy of b that is never nil.
+func copyBytes(b []byte) []byte {
+	return append([]byte{}, b...)
+}
@@ -0,0 +1,258 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package kvstore_test
+
+import (
+	"path/filepath"
+	"sync"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/kvstore"
+)
+
+// storeSuite holds tests that apply to every kind of store.
+type storeSuite struct {
+	testing.IsolationSuite
+
+	open  func(c *gc.C) kvstore.Store
+	store kvstore.Store
+}
+
+var _ = gc.Suite(&storeSuite{
+	open: func(c *gc.C) kvstore.Store {
+		return kvstore.NewMemory()
+	},
+})
+
+var _ = gc.Suite(&storeSuite{
+	open: func(c *gc.C) kvstore.Store {
+		store, err := kvstore.OpenFile(filepath.Join(c.MkDir(), "store"))
+		c.Assert(err, jc.ErrorIsNil)
+		return store
+	},
+})
+
+func (s *storeSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.store = s.open(c)
+}
+
+func (s *storeSuite) TearDownTest(c *gc.C) {
+	c.Check(s.store.Close(), jc.ErrorIsNil)
+	s.IsolationSuite.TearDownTest(c)
+}
+
+// contents returns the contents of the store.
+func contents(c *gc.C, r kvstore.Reader, prefix string) map[string]string {
+	m := make(map[string]string)
+	err := r.Iterate(prefix, func(key string, value []byte) error {
+		m[key] = string(value)
+		return nil
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	return m
+}
+
+func (s *storeSuite) TestPutGetDelete(c *gc.C) {
+	_, err := s.store.Get("a")
+	c.Assert(err, gc.ErrorMatches, `key "a" not found`)
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+
+	err = s.store.Put("a", []byte("one"))
+	c.Assert(err, jc.ErrorIsNil)
+	value, err := s.store.Get("a")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(value), gc.Equals, "one")
+
+	err = s.store.Put("a", []byte("two"))
+	c.Assert(err, jc.ErrorIsNil)
+	value, err = s.store.Get("a")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(value), gc.Equals, "two")
+
+	err = s.store.Delete("a")
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = s.store.Get("a")
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+
+	err = s.store.Delete("a")
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *storeSuite) TestEmptyValue(c *gc.C) {
+	err := s.store.Put("a", nil)
+	c.Assert(err, jc.ErrorIsNil)
+	value, err := s.store.Get("a")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(value, gc.NotNil)
+	c.Assert(value, gc.HasLen, 0)
+}
+
+func (s *storeSuite) TestValuesCopied(c *gc.C) {
+	value := []byte("one")
+	err := s.store.Put("a", value)
+	c.Assert(err, jc.ErrorIsNil)
+	value[0] = 'X'
+	got, err := s.store.Get("a")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(got), gc.Equals, "one")
+	got[0] = 'X'
+	got, err = s.store.Get("a")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(got), gc.Equals, "one")
+}
+
+func (s *storeSuite) TestIterate(c *gc.C) {
+	for _, key := range []string{"host/b", "host/a", "hosts", "other", "host/c"} {
+		err := s.store.Put(key, []byte(key))
+		c.Assert(err, jc.ErrorIsNil)
+	}
+	var keys []string
+	err := s.store.Iterate("host/", func(key string, value []byte) error {
+		c.Check(string(value), gc.Equals, key)
+		keys = append(keys, key)
+		return nil
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(keys, jc.DeepEquals, []string{"host/a", "host/b", "host/c"})
+
+	c.Assert(contents(c, s.store, ""), gc.HasLen, 5)
+	c.Assert(contents(c, s.store, "none"), gc.HasLen, 0)
+}
+
+func (s *storeSuite) TestIterateStops(c *gc.C) {
+	for _, key := range []string{"a", "b", "c"} {
+		err := s.store.Put(key, nil)
+		c.Assert(err, jc.ErrorIsNil)
+	}
+	var keys []string
+	err := s.store.Iterate("", func(key string, value []byte) error {
+		keys = append(keys, key)
+		if key == "b" {
+			return errors.New("stop")
+		}
+		return nil
+	})
+	c.Assert(err, gc.ErrorMatches, "stop")
+	c.Assert(keys, jc.DeepEquals, []string{"a", "b"})
+}
+
+func (s *storeSuite) TestUpdate(c *gc.C) {
+	err := s.store.Put("a", []byte("1"))
+	c.Assert(err, jc.ErrorIsNil)
+	err = s.store.Put("b", []byte("2"))
+	c.Assert(err, jc.ErrorIsNil)
+
+	err = s.store.Update(func(tx kvstore.Tx) error {
+		c.Check(tx.Put("c", []byte("3")), jc.ErrorIsNil)
+		c.Check(tx.Delete("a"), jc.ErrorIsNil)
+		c.Check(tx.Put("b", []byte("two")), jc.ErrorIsNil)
+
+		// The transaction sees its own changes.
+		_, err := tx.Get("a")
+		c.Check(err, jc.Satisfies, errors.IsNotFound)
+		c.Check(contents(c, tx, ""), jc.DeepEquals, map[string]string{
+			"b": "two",
+			"c": "3",
+		})
+		return nil
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(contents(c, s.store, ""), jc.DeepEquals, map[string]string{
+		"b": "two",
+		"c": "3",
+	})
+}
+
+func (s *storeSuite) TestUpdateRollback(c *gc.C) {
+	err := s.store.Put("a", []byte("1"))
+	c.Assert(err, jc.ErrorIsNil)
+	err = s.store.Update(func(tx kvstore.Tx) error {
+		c.Check(tx.Put("a", []byte("2")), jc.ErrorIsNil)
+		c.Check(tx.Put("b", []byte("3")), jc.ErrorIsNil)
+		return errors.New("rollback")
+	})
+	c.Assert(err, gc.ErrorMatches, "rollback")
+	c.Assert(contents(c, s.store, ""), jc.DeepEquals, map[string]string{"a": "1"})
+}
+
+func (s *storeSuite) TestPutThenDeleteInUpdate(c *gc.C) {
+	err := s.store.Update(func(tx kvstore.Tx) error {
+		c.Check(tx.Put("a", []byte("1")), jc.ErrorIsNil)
+		return tx.Delete("a")
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(contents(c, s.store, ""), gc.HasLen, 0)
+}
+
+func (s *storeSuite) TestDeleteWhileIterating(c *gc.C) {
+	for _, key := range []string{"a", "b", "c"} {
+		err := s.store.Put(key, nil)
+		c.Assert(err, jc.ErrorIsNil)
+	}
+	var keys []string
+	err := s.store.Update(func(tx kvstore.Tx) error {
+		return tx.Iterate("", func(key string, value []byte) error {
+			keys = append(keys, key)
+			return tx.Delete("b")
+		})
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(keys, jc.DeepEquals, []string{"a", "c"})
+	c.Assert(contents(c, s.store, ""), jc.DeepEquals, map[string]string{"a": "", "c": ""})
+}
+
+func (s *storeSuite) TestViewReadOnly(c *gc.C) {
+	err := s.store.View(func(r kvstore.Reader) error {
+		return r.(kvstore.Tx).Put("a", nil)
+	})
+	c.Assert(err, gc.ErrorMatches, "cannot write in a read-only transaction")
+}
+
+func (s *storeSuite) TestTxUsedAfterCompletion(c *gc.C) {
+	var saved kvstore.Tx
+	err := s.store.Update(func(tx kvstore.Tx) error {
+		saved = tx
+		return nil
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	err = saved.Put("a", nil)
+	c.Assert(err, gc.ErrorMatches, "transaction used after completion")
+}
+
+func (s *storeSuite) TestConcurrentUpdates(c *gc.C) {
+	const n = 20
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := s.store.Update(func(tx kvstore.Tx) error {
+				value, err := tx.Get("count")
+				if err != nil && !errors.IsNotFound(err) {
+					return err
+				}
+				return tx.Put("count", append(value, 'x'))
+			})
+			c.Check(err, jc.ErrorIsNil)
+		}()
+	}
+	wg.Wait()
+	value, err := s.store.Get("count")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(value, gc.HasLen, n)
+}
+
+func (s *storeSuite) TestClosed(c *gc.C) {
+	err := s.store.Close()
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = s.store.Get("a")
+	c.Assert(err, gc.Equals, kvstore.ErrClosed)
+	err = s.store.Put("a", nil)
+	c.Assert(err, gc.Equals, kvstore.ErrClosed)
+}
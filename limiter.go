@@ -6,17 +6,57 @@ package utils
 import (
 	"fmt"
 	"math/rand"
+	"sync"
 	"time"
 
 	"github.com/juju/clock"
 )
 
-type empty struct{}
 type limiter struct {
-	wait     chan empty
 	minPause time.Duration
 	maxPause time.Duration
 	clock    clock.Clock
+	metrics  LimiterMetrics
+
+	// mu guards the fields below it.
+	mu sync.Mutex
+
+	// capacity holds the maximum number of units
+	// that may be acquired at once.
+	capacity int
+
+	// inFlight holds the number of units currently acquired.
+	// This may exceed capacity after the limiter has been shrunk.
+	inFlight int
+
+	// acquired holds the total number of units ever acquired.
+	acquired uint64
+
+	// waiting holds the number of blocked calls to AcquireWait.
+	waiting int
+
+	// keys holds the state for each key that has units acquired
+	// or callers waiting. Calls made through the Limiter interface
+	// use the empty key.
+	keys map[string]*limiterKey
+
+	// queue holds, in round-robin order, the keys
+	// that have at least one blocked waiter.
+	queue []string
+}
+
+// limiterKey holds the state of a limiter for a single key.
+type limiterKey struct {
+	stats LimiterKeyStats
+
+	// waiters holds the blocked calls to AcquireWait for
+	// the key, in the order that they started waiting.
+	waiters []*limiterWaiter
+}
+
+type limiterWaiter struct {
+	ready chan struct{}
+	since time.Time
 }
 
 // Limiter represents a limited resource (eg a semaphore).
@@ -33,6 +73,129 @@ type Limiter interface {
 	Release() error
 }
 
+// ResizableLimiter is a Limiter whose capacity may be changed
+// while it is in use.
+type ResizableLimiter interface {
+	Limiter
+
+	// Resize changes the maximum number of units that may be
+	// acquired at once. When the capacity grows, blocked calls to
+	// AcquireWait are woken to take up the new units. When it
+	// shrinks, units already acquired are unaffected, and no
+	// further units are handed out until enough have been released
+	// to bring the number in use below the new capacity.
+	Resize(maxAllowed int)
+
+	// Stats returns a snapshot of the limiter's current state.
+	Stats() LimiterStats
+}
+
+// KeyedLimiter is a ResizableLimiter whose units are requested on
+// behalf of a key, such as a tenant or a host. When callers are
+// waiting for units, they are served round-robin across keys rather
+// than in the order that they started waiting, so that one busy key
+// cannot monopolise the limiter. Within a key, waiters are served in
+// order.
+//
+// The methods of the embedded Limiter act on behalf of the empty key.
+type KeyedLimiter interface {
+	ResizableLimiter
+
+	// AcquireKey is like Acquire but acquires a unit for the given key.
+	AcquireKey(key string) bool
+
+	// AcquireWaitKey is like AcquireWait but acquires
+	// a unit for the given key.
+	AcquireWaitKey(key string)
+
+	// ReleaseKey returns a unit acquired for the given key.
+	// Calling ReleaseKey when there are no units acquired
+	// for the key is an error.
+	ReleaseKey(key string) error
+
+	// KeyStats returns a snapshot of the state of each key that
+	// has units acquired or callers waiting. A key is forgotten,
+	// along with its totals, once its last unit is released with no
+	// callers waiting, so that a limiter used with many distinct keys
+	// does not grow without bound.
+	KeyStats() map[string]LimiterKeyStats
+}
+
+// LimiterStats holds a snapshot of the state of a limiter.
+type LimiterStats struct {
+	// Capacity holds the maximum number of units that
+	// may be acquired at once.
+	Capacity int
+
+	// InFlight holds the number of units currently acquired.
+	InFlight int
+
+	// Waiting holds the number of callers blocked in AcquireWait.
+	Waiting int
+
+	// TotalAcquired holds the number of units acquired
+	// over the lifetime of the limiter.
+	TotalAcquired uint64
+}
+
+// LimiterKeyStats holds a snapshot of the state of a single
+// key in a KeyedLimiter.
+type LimiterKeyStats struct {
+	// InFlight holds the number of units currently
+	// acquired for the key.
+	InFlight int
+
+	// Waiting holds the number of callers blocked
+	// waiting for a unit for the key.
+	Waiting int
+
+	// TotalAcquired holds the number of units acquired for
+	// the key since it last had none acquired or waiting.
+	TotalAcquired uint64
+
+	// TotalWait holds the total time spent blocked by
+	// callers that have since acquired a unit for the key.
+	TotalWait time.Duration
+
+	// MaxWait holds the longest time that any caller
+	// was blocked before acquiring a unit for the key.
+	MaxWait time.Duration
+
+	// OldestWaiting holds how long the longest-waiting caller
+	// still blocked on the key has been waiting. A value that
+	// keeps growing indicates that the key is being starved.
+	OldestWaiting time.Duration
+}
+
+// LimiterMetrics is implemented by callers that want to feed
+// a limiter's activity into a metrics system. The methods are
+// called synchronously while the limiter's internal lock is held,
+// so they should be fast and must not call back into the limiter.
+type LimiterMetrics interface {
+	// SetCapacity is called with the new capacity
+	// whenever the limiter is resized.
+	SetCapacity(n int)
+
+	// SetInFlight is called with the number of
+	// units acquired whenever it changes.
+	SetInFlight(n int)
+
+	// SetWaiting is called with the number of blocked
+	// callers whenever it changes.
+	SetWaiting(n int)
+
+	// IncAcquired is called each time a unit is acquired.
+	IncAcquired()
+}
+
+// LimiterWaitMetrics may be implemented by a LimiterMetrics
+// value to observe how long callers wait for units.
+type LimiterWaitMetrics interface {
+	// ObserveWait is called when a blocked caller acquires a
+	// unit for the given key, with the time that it waited.
+	ObserveWait(key string, wait time.Duration)
+}
+
 // NewLimiter creates a limiter.
 func NewLimiter(maxAllowed int) Limiter {
 	return NewLimiterWithPause(maxAllowed, 0, 0, nil)
@@ -45,11 +208,40 @@ func NewLimiterWithPause(maxAllowed int, minPause, maxPause time.Duration, clk c
 	if clk == nil {
 		clk = clock.WallClock
 	}
-	return limiter{
-		wait:     make(chan empty, maxAllowed),
-		minPause: minPause,
-		maxPause: maxPause,
+	l := newLimiter(maxAllowed, nil, clk)
+	l.minPause = minPause
+	l.maxPause = maxPause
+	return l
+}
+
+// NewResizableLimiter creates a limiter whose capacity may be
+// changed at runtime. If metrics is non-nil, it will be
+// informed of changes to the limiter's state.
+func NewResizableLimiter(maxAllowed int, metrics LimiterMetrics) ResizableLimiter {
+	return newLimiter(maxAllowed, metrics, clock.WallClock)
+}
+
+// NewKeyedLimiter creates a limiter that shares its units fairly
+// between keys. If metrics is non-nil, it will be informed of changes
+// to the limiter's state; if it also implements LimiterWaitMetrics,
+// it will be told how long each blocked caller waited. If clk is nil,
+// the wall clock is used to measure waits.
+func NewKeyedLimiter(maxAllowed int, metrics LimiterMetrics, clk clock.Clock) KeyedLimiter {
+	if clk == nil {
+		clk = clock.WallClock
+	}
+	return newLimiter(maxAllowed, metrics, clk)
+}
+
+func newLimiter(maxAllowed int, metrics LimiterMetrics, clk clock.Clock) *limiter {
+	if metrics != nil {
+		metrics.SetCapacity(maxAllowed)
+	}
+	return &limiter{
+		capacity: maxAllowed,
 		clock:    clk,
+		metrics:  metrics,
+		keys:     make(map[string]*limiterKey),
 	}
 }
 
@@ -57,38 +249,192 @@ func NewLimiterWithPause(maxAllowed int, minPause, maxPause time.Duration, clk c
 // It returns 'true' if there are resources available, but false if they are
 // not. Callers are responsible for calling Release if this returns true, but
 // should not release if this returns false.
-func (l limiter) Acquire() bool {
+func (l *limiter) Acquire() bool {
+	return l.AcquireKey("")
+}
+
+// AcquireKey implements KeyedLimiter.AcquireKey.
+func (l *limiter) AcquireKey(key string) bool {
 	// Pause before attempting to grab a slot.
 	// This is optional depending on what was used to
 	// construct this limiter, and is used to throttle
 	// incoming connections.
 	l.pause()
-	e := empty{}
-	select {
-	case l.wait <- e:
-		return true
-	default:
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.waiting > 0 || l.inFlight >= l.capacity {
 		return false
 	}
+	l.take(l.key(key))
+	return true
 }
 
 // AcquireWait waits for the resource to become available before returning.
-func (l limiter) AcquireWait() {
-	e := empty{}
-	l.wait <- e
+func (l *limiter) AcquireWait() {
+	l.AcquireWaitKey("")
+}
+
+// AcquireWaitKey implements KeyedLimiter.AcquireWaitKey.
+func (l *limiter) AcquireWaitKey(key string) {
+	l.mu.Lock()
+	k := l.key(key)
+	if l.waiting == 0 && l.inFlight < l.capacity {
+		l.take(k)
+		l.mu.Unlock()
+		return
+	}
+	w := &limiterWaiter{
+		ready: make(chan struct{}),
+		since: l.clock.Now(),
+	}
+	if len(k.waiters) == 0 {
+		l.queue = append(l.queue, key)
+	}
+	k.waiters = append(k.waiters, w)
+	k.stats.Waiting++
+	l.waiting++
+	l.setWaiting()
+	l.mu.Unlock()
+	// The unit is handed over to us by whoever closes ready.
+	<-w.ready
 }
 
 // Release returns the resource to the available pool.
-func (l limiter) Release() error {
-	select {
-	case <-l.wait:
-		return nil
-	default:
+func (l *limiter) Release() error {
+	return l.ReleaseKey("")
+}
+
+// ReleaseKey implements KeyedLimiter.ReleaseKey.
+func (l *limiter) ReleaseKey(key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	k, ok := l.keys[key]
+	if !ok || k.stats.InFlight == 0 {
 		return fmt.Errorf("Release without an associated Acquire")
 	}
+	k.stats.InFlight--
+	l.inFlight--
+	l.setInFlight()
+	l.wake()
+	if k.stats.InFlight == 0 && len(k.waiters) == 0 {
+		// A key without waiters is not in the queue,
+		// so it can be forgotten.
+		delete(l.keys, key)
+	}
+	return nil
+}
+
+// Resize implements ResizableLimiter.Resize.
+func (l *limiter) Resize(maxAllowed int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.capacity = maxAllowed
+	if l.metrics != nil {
+		l.metrics.SetCapacity(maxAllowed)
+	}
+	l.wake()
+}
+
+// Stats implements ResizableLimiter.Stats.
+func (l *limiter) Stats() LimiterStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return LimiterStats{
+		Capacity:      l.capacity,
+		InFlight:      l.inFlight,
+		Waiting:       l.waiting,
+		TotalAcquired: l.acquired,
+	}
+}
+
+// KeyStats implements KeyedLimiter.KeyStats.
+func (l *limiter) KeyStats() map[string]LimiterKeyStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.clock.Now()
+	stats := make(map[string]LimiterKeyStats, len(l.keys))
+	for key, k := range l.keys {
+		s := k.stats
+		if len(k.waiters) > 0 {
+			s.OldestWaiting = now.Sub(k.waiters[0].since)
+		}
+		stats[key] = s
+	}
+	return stats
+}
+
+// key returns the state for the given key, creating it if necessary.
+// It must be called with l.mu held.
+func (l *limiter) key(key string) *limiterKey {
+	k, ok := l.keys[key]
+	if !ok {
+		k = &limiterKey{}
+		l.keys[key] = k
+	}
+	return k
+}
+
+// wake hands units to waiters for as long as there is spare capacity,
+// taking the oldest waiter from each waiting key in turn. It must be
+// called with l.mu held.
+func (l *limiter) wake() {
+	woken := false
+	for len(l.queue) > 0 && l.inFlight < l.capacity {
+		key := l.queue[0]
+		l.queue = l.queue[1:]
+		k := l.keys[key]
+		w := k.waiters[0]
+		k.waiters = k.waiters[1:]
+		if len(k.waiters) > 0 {
+			// Move the key to the back of the queue.
+			l.queue = append(l.queue, key)
+		}
+		k.stats.Waiting--
+		l.waiting--
+
+		wait := l.clock.Now().Sub(w.since)
+		k.stats.TotalWait += wait
+		if wait > k.stats.MaxWait {
+			k.stats.MaxWait = wait
+		}
+		if m, ok := l.metrics.(LimiterWaitMetrics); ok {
+			m.ObserveWait(key, wait)
+		}
+		l.take(k)
+		close(w.ready)
+		woken = true
+	}
+	if woken {
+		l.setWaiting()
+	}
+}
+
+// take records the acquisition of a unit for the given key state.
+// It must be called with l.mu held.
+func (l *limiter) take(k *limiterKey) {
+	k.stats.InFlight++
+	k.stats.TotalAcquired++
+	l.inFlight++
+	l.acquired++
+	if l.metrics != nil {
+		l.metrics.IncAcquired()
+	}
+	l.setInFlight()
+}
+
+func (l *limiter) setInFlight() {
+	if l.metrics != nil {
+		l.metrics.SetInFlight(l.inFlight)
+	}
+}
+
+func (l *limiter) setWaiting() {
+	if l.metrics != nil {
+		l.metrics.SetWaiting(l.waiting)
+	}
 }
 
-func (l limiter) pause() {
+func (l *limiter) pause() {
 	if l.minPause <= 0 || l.maxPause <= 0 {
 		return
 	}
@@ -108,3 +108,225 @@ func (*limiterSuite) TestAcquirePauses(c *gc.C) {
 		c.Fatal("acquire failed")
 	}
 }
+
+type fakeLimiterMetrics struct {
+	capacity, inFlight, waiting int
+	acquired                    int
+}
+
+func (m *fakeLimiterMetrics) SetCapacity(n int) { m.capacity = n }
+func (m *fakeLimiterMetrics) SetInFlight(n int) { m.inFlight = n }
+func (m *fakeLimiterMetrics) SetWaiting(n int)  { m.waiting = n }
+func (m *fakeLimiterMetrics) IncAcquired()      { m.acquired++ }
+
+func (*limiterSuite) TestResizeGrowWakesWaiters(c *gc.C) {
+	l := utils.NewResizableLimiter(1, nil)
+	c.Assert(l.Acquire(), jc.IsTrue)
+
+	done := make(chan bool, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			l.AcquireWait()
+			done <- true
+		}()
+	}
+	waitForLimiterWaiting(c, l, 2)
+
+	l.Resize(3)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-done:
+		case <-time.After(longWait):
+			c.Fatalf("timed out waiting for AcquireWait")
+		}
+	}
+	c.Assert(l.Stats(), gc.Equals, utils.LimiterStats{
+		Capacity:      3,
+		InFlight:      3,
+		TotalAcquired: 3,
+	})
+}
+
+func (*limiterSuite) TestResizeShrinkDrains(c *gc.C) {
+	l := utils.NewResizableLimiter(3, nil)
+	c.Assert(l.Acquire(), jc.IsTrue)
+	c.Assert(l.Acquire(), jc.IsTrue)
+	c.Assert(l.Acquire(), jc.IsTrue)
+
+	l.Resize(1)
+	c.Assert(l.Stats().InFlight, gc.Equals, 3)
+
+	// No new units are handed out until the number
+	// in use drops below the new capacity.
+	c.Check(l.Release(), gc.IsNil)
+	c.Check(l.Acquire(), jc.IsFalse)
+	c.Check(l.Release(), gc.IsNil)
+	c.Check(l.Acquire(), jc.IsFalse)
+	c.Check(l.Release(), gc.IsNil)
+	c.Check(l.Acquire(), jc.IsTrue)
+	c.Check(l.Acquire(), jc.IsFalse)
+}
+
+func (*limiterSuite) TestMetrics(c *gc.C) {
+	var m fakeLimiterMetrics
+	l := utils.NewResizableLimiter(2, &m)
+	c.Assert(m.capacity, gc.Equals, 2)
+
+	c.Assert(l.Acquire(), jc.IsTrue)
+	c.Assert(l.Acquire(), jc.IsTrue)
+	c.Assert(m.inFlight, gc.Equals, 2)
+	c.Assert(m.acquired, gc.Equals, 2)
+
+	c.Assert(l.Release(), gc.IsNil)
+	c.Assert(m.inFlight, gc.Equals, 1)
+	c.Assert(m.acquired, gc.Equals, 2)
+
+	l.Resize(5)
+	c.Assert(m.capacity, gc.Equals, 5)
+}
+
+func waitForLimiterWaiting(c *gc.C, l utils.ResizableLimiter, n int) {
+	timeout := time.After(longWait)
+	for l.Stats().Waiting != n {
+		select {
+		case <-timeout:
+			c.Fatalf("timed out waiting for %d waiters", n)
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+type fakeWaitMetrics struct {
+	fakeLimiterMetrics
+	waits map[string][]time.Duration
+}
+
+func (m *fakeWaitMetrics) ObserveWait(key string, wait time.Duration) {
+	if m.waits == nil {
+		m.waits = make(map[string][]time.Duration)
+	}
+	m.waits[key] = append(m.waits[key], wait)
+}
+
+func (*limiterSuite) TestKeyedRoundRobin(c *gc.C) {
+	l := utils.NewKeyedLimiter(1, nil, nil)
+	c.Assert(l.AcquireKey("noisy"), jc.IsTrue)
+
+	// Queue up several waiters for the noisy key before a
+	// single waiter for the quiet key.
+	order := make(chan string, 4)
+	for i := 0; i < 3; i++ {
+		go func() {
+			l.AcquireWaitKey("noisy")
+			order <- "noisy"
+		}()
+		waitForLimiterWaiting(c, l, i+1)
+	}
+	go func() {
+		l.AcquireWaitKey("quiet")
+		order <- "quiet"
+	}()
+	waitForLimiterWaiting(c, l, 4)
+
+	var got []string
+	release := "noisy"
+	for i := 0; i < 4; i++ {
+		c.Assert(l.ReleaseKey(release), jc.ErrorIsNil)
+		select {
+		case release = <-order:
+			got = append(got, release)
+		case <-time.After(longWait):
+			c.Fatalf("timed out waiting for AcquireWaitKey")
+		}
+	}
+	// The quiet key is served as soon as the first noisy
+	// waiter has had its turn, rather than after all of them.
+	c.Assert(got, jc.DeepEquals, []string{"noisy", "quiet", "noisy", "noisy"})
+}
+
+func (*limiterSuite) TestKeyedReleaseWrongKey(c *gc.C) {
+	l := utils.NewKeyedLimiter(2, nil, nil)
+	c.Assert(l.AcquireKey("a"), jc.IsTrue)
+	c.Check(l.ReleaseKey("b"), gc.ErrorMatches, "Release without an associated Acquire")
+	c.Check(l.Release(), gc.ErrorMatches, "Release without an associated Acquire")
+	c.Check(l.ReleaseKey("a"), jc.ErrorIsNil)
+}
+
+func (*limiterSuite) TestKeyedForgetsIdleKeys(c *gc.C) {
+	l := utils.NewKeyedLimiter(4, nil, nil)
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("host-%d", i)
+		c.Assert(l.AcquireKey(key), jc.IsTrue)
+		c.Assert(l.AcquireKey(key), jc.IsTrue)
+		c.Assert(l.ReleaseKey(key), jc.ErrorIsNil)
+		c.Assert(l.KeyStats(), gc.HasLen, 1)
+		c.Assert(l.ReleaseKey(key), jc.ErrorIsNil)
+	}
+	c.Assert(l.KeyStats(), gc.HasLen, 0)
+
+	// A key with a waiter is kept until the waiter has
+	// acquired and released its unit.
+	c.Assert(l.AcquireKey("a"), jc.IsTrue)
+	c.Assert(l.AcquireKey("b"), jc.IsTrue)
+	c.Assert(l.AcquireKey("b"), jc.IsTrue)
+	c.Assert(l.AcquireKey("c"), jc.IsTrue)
+	done := make(chan bool)
+	go func() {
+		l.AcquireWaitKey("a")
+		done <- true
+	}()
+	waitForLimiterWaiting(c, l, 1)
+	c.Assert(l.ReleaseKey("a"), jc.ErrorIsNil)
+	select {
+	case <-done:
+	case <-time.After(longWait):
+		c.Fatalf("timed out waiting for AcquireWaitKey")
+	}
+	c.Assert(l.KeyStats()["a"].InFlight, gc.Equals, 1)
+	for _, key := range []string{"a", "b", "b", "c"} {
+		c.Assert(l.ReleaseKey(key), jc.ErrorIsNil)
+	}
+	c.Assert(l.KeyStats(), gc.HasLen, 0)
+	c.Assert(l.Stats().InFlight, gc.Equals, 0)
+}
+
+func (*limiterSuite) TestKeyedWaitStats(c *gc.C) {
+	clk := testclock.NewClock(time.Now())
+	var m fakeWaitMetrics
+	l := utils.NewKeyedLimiter(1, &m, clk)
+	c.Assert(l.AcquireKey("a"), jc.IsTrue)
+
+	done := make(chan bool)
+	go func() {
+		l.AcquireWaitKey("b")
+		done <- true
+	}()
+	waitForLimiterWaiting(c, l, 1)
+
+	clk.Advance(3 * time.Second)
+	stats := l.KeyStats()
+	c.Assert(stats["b"], gc.Equals, utils.LimiterKeyStats{
+		Waiting:       1,
+		OldestWaiting: 3 * time.Second,
+	})
+
+	clk.Advance(2 * time.Second)
+	c.Assert(l.ReleaseKey("a"), jc.ErrorIsNil)
+	select {
+	case <-done:
+	case <-time.After(longWait):
+		c.Fatalf("timed out waiting for AcquireWaitKey")
+	}
+	stats = l.KeyStats()
+	c.Assert(stats, jc.DeepEquals, map[string]utils.LimiterKeyStats{
+		"b": {
+			InFlight:      1,
+			TotalAcquired: 1,
+			TotalWait:     5 * time.Second,
+			MaxWait:       5 * time.Second,
+		},
+	})
+	c.Assert(m.waits, jc.DeepEquals, map[string][]time.Duration{
+		"b": {5 * time.Second},
+	})
+}
@@ -0,0 +1,81 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// platformMachineID is overridden in tests.
+var platformMachineID = machineID
+
+// MachineID returns a stable identifier for the machine. On Linux it
+// is read from /etc/machine-id, /var/lib/dbus/machine-id or the SMBIOS
+// product UUID; on Windows from the MachineGuid registry value; and
+// on macOS from the IOPlatformUUID. The identifier is lower-cased,
+// but otherwise returned in the platform's format.
+//
+// If no identifier is available from the platform and fallbackFile is
+// not empty, an identifier is read from that file, or, if the file
+// does not exist, generated as a random UUID and saved there so that
+// later calls return the same identifier.
+func MachineID(fallbackFile string) (string, error) {
+	id, err := platformMachineID()
+	if err == nil && id != "" {
+		return strings.ToLower(id), nil
+	}
+	if fallbackFile == "" {
+		if err == nil {
+			err = fmt.Errorf("no machine ID found")
+		}
+		return "", fmt.Errorf("cannot get machine ID: %v", err)
+	}
+	logger.Debugf("no platform machine ID (%v), using %s", err, fallbackFile)
+	return persistedMachineID(fallbackFile)
+}
+
+func persistedMachineID(file string) (string, error) {
+	data, err := ioutil.ReadFile(file)
+	if err == nil {
+		if id := strings.TrimSpace(string(data)); id != "" {
+			return strings.ToLower(id), nil
+		}
+	} else if !os.IsNotExist(err) {
+		return "", fmt.Errorf("cannot read machine ID: %v", err)
+	}
+	uuid, err := NewUUID()
+	if err != nil {
+		return "", fmt.Errorf("cannot generate machine ID: %v", err)
+	}
+	id := uuid.String()
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return "", fmt.Errorf("cannot save machine ID: %v", err)
+	}
+	if err := AtomicWriteFile(file, []byte(id+"\n"), 0644); err != nil {
+		return "", fmt.Errorf("cannot save machine ID: %v", err)
+	}
+	return id, nil
+}
+
+// readMachineIDFile returns the trimmed contents of the first of the
+// given files that exists and is not empty.
+func readMachineIDFile(files []string) (string, error) {
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if os.IsNotExist(err) || os.IsPermission(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if id := strings.TrimSpace(string(data)); id != "" {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("no machine ID found")
+}
@@ -0,0 +1,24 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package utils
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+)
+
+var platformUUIDRE = regexp.MustCompile(`"IOPlatformUUID" = "([^"]+)"`)
+
+func machineID() (string, error) {
+	out, err := exec.Command("ioreg", "-rd1", "-c", "IOPlatformExpertDevice").Output()
+	if err != nil {
+		return "", err
+	}
+	m := platformUUIDRE.FindSubmatch(out)
+	if m == nil {
+		return "", fmt.Errorf("no IOPlatformUUID found")
+	}
+	return string(m[1]), nil
+}
@@ -0,0 +1,17 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package utils
+
+// machineIDFiles holds the files consulted for the machine ID,
+// in order of preference. The SMBIOS product UUID is only
+// readable by root.
+var machineIDFiles = []string{
+	"/etc/machine-id",
+	"/var/lib/dbus/machine-id",
+	"/sys/class/dmi/id/product_uuid",
+}
+
+func machineID() (string, error) {
+	return readMachineIDFile(machineIDFiles)
+}
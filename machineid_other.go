@@ -0,0 +1,18 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+//go:build !linux && !darwin && !windows
+// +build !linux,!darwin,!windows
+
+package utils
+
+// machineIDFiles holds the files consulted for the machine ID,
+// in order of preference.
+var machineIDFiles = []string{
+	"/etc/machine-id",
+	"/etc/hostid",
+}
+
+func machineID() (string, error) {
+	return readMachineIDFile(machineIDFiles)
+}
@@ -0,0 +1,63 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package utils_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3"
+)
+
+type machineIDSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&machineIDSuite{})
+
+func (s *machineIDSuite) TestPlatformID(c *gc.C) {
+	s.PatchValue(utils.PlatformMachineID, func() (string, error) {
+		return "4C4C4544-0042-4810", nil
+	})
+	id, err := utils.MachineID(filepath.Join(c.MkDir(), "machine-id"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(id, gc.Equals, "4c4c4544-0042-4810")
+}
+
+func (s *machineIDSuite) TestFallbackGeneratedAndPersisted(c *gc.C) {
+	s.PatchValue(utils.PlatformMachineID, func() (string, error) {
+		return "", errors.New("no machine ID")
+	})
+	file := filepath.Join(c.MkDir(), "state", "machine-id")
+	id, err := utils.MachineID(file)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(utils.IsValidUUIDString(id), jc.IsTrue)
+
+	data, err := ioutil.ReadFile(file)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(data), gc.Equals, id+"\n")
+
+	id2, err := utils.MachineID(file)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(id2, gc.Equals, id)
+}
+
+func (s *machineIDSuite) TestNoFallback(c *gc.C) {
+	s.PatchValue(utils.PlatformMachineID, func() (string, error) {
+		return "", errors.New("no machine ID")
+	})
+	_, err := utils.MachineID("")
+	c.Assert(err, gc.ErrorMatches, "cannot get machine ID: no machine ID")
+}
+
+func (s *machineIDSuite) TestHost(c *gc.C) {
+	id, err := utils.MachineID(filepath.Join(c.MkDir(), "machine-id"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(id, gc.Not(gc.Equals), "")
+}
@@ -0,0 +1,92 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package memory reports the physical memory of the system and the
+// amount of it that the current process may actually use, taking into
+// account cgroup limits, resource limits and Windows job objects, so
+// that callers can size caches and reject oversized operations.
+package memory
+
+// Source identifies what imposes a memory limit.
+type Source string
+
+const (
+	// SourceSystem means the process is limited only
+	// by the physical memory of the system.
+	SourceSystem Source = "system"
+
+	// SourceCgroupV1 means the limit is set by the memory
+	// controller of a version 1 cgroup hierarchy.
+	SourceCgroupV1 Source = "cgroup-v1"
+
+	// SourceCgroupV2 means the limit is set by the memory.max
+	// value of a version 2 (unified) cgroup hierarchy.
+	SourceCgroupV2 Source = "cgroup-v2"
+
+	// SourceRlimit means the limit is set by the
+	// RLIMIT_AS resource limit of the process.
+	SourceRlimit Source = "rlimit"
+
+	// SourceJobObject means the limit is set by
+	// the Windows job object containing the process.
+	SourceJobObject Source = "job-object"
+)
+
+// Info describes the memory available to the current process.
+type Info struct {
+	// Total holds the physical memory of the system in bytes.
+	Total uint64
+
+	// Limit holds the number of bytes the process may use. It is
+	// never more than Total.
+	Limit uint64
+
+	// Source identifies what imposes Limit.
+	Source Source
+}
+
+// Detect returns the physical memory of the system and the
+// effective memory limit of the current process.
+func Detect() (Info, error) {
+	total, err := Total()
+	if err != nil {
+		return Info{}, err
+	}
+	info := Info{
+		Total:  total,
+		Limit:  total,
+		Source: SourceSystem,
+	}
+	limits, err := limits()
+	if err != nil {
+		return Info{}, err
+	}
+	for _, l := range limits {
+		if l.bytes < info.Limit {
+			info.Limit = l.bytes
+			info.Source = l.source
+		}
+	}
+	return info, nil
+}
+
+// Total returns the physical memory of the system in bytes.
+func Total() (uint64, error) {
+	return total()
+}
+
+// Limit returns the number of bytes the current process may use,
+// as reported in Info.Limit by Detect.
+func Limit() (uint64, error) {
+	info, err := Detect()
+	if err != nil {
+		return 0, err
+	}
+	return info.Limit, nil
+}
+
+// limit holds a limit imposed by a single source.
+type limit struct {
+	bytes  uint64
+	source Source
+}
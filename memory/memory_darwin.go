@@ -0,0 +1,29 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package memory
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+func total() (uint64, error) {
+	n, err := unix.SysctlUint64("hw.memsize")
+	if err != nil {
+		return 0, fmt.Errorf("cannot get system memory: %v", err)
+	}
+	return n, nil
+}
+
+func limits() ([]limit, error) {
+	var rlim unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_AS, &rlim); err != nil {
+		return nil, fmt.Errorf("cannot get address space limit: %v", err)
+	}
+	if rlim.Cur == unix.RLIM_INFINITY {
+		return nil, nil
+	}
+	return []limit{{bytes: rlim.Cur, source: SourceRlimit}}, nil
+}
@@ -0,0 +1,164 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package memory
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/juju/utils/v3/vfs"
+)
+
+const (
+	procSelfCgroup = "/proc/self/cgroup"
+	cgroupRoot     = "/sys/fs/cgroup"
+)
+
+func total() (uint64, error) {
+	var info unix.Sysinfo_t
+	if err := unix.Sysinfo(&info); err != nil {
+		return 0, fmt.Errorf("cannot get system memory: %v", err)
+	}
+	return uint64(info.Totalram) * uint64(info.Unit), nil
+}
+
+func limits() ([]limit, error) {
+	ls, err := cgroupLimits(vfs.OS, procSelfCgroup, cgroupRoot)
+	if err != nil {
+		return nil, err
+	}
+	var rlim unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_AS, &rlim); err != nil {
+		return nil, fmt.Errorf("cannot get address space limit: %v", err)
+	}
+	if rlim.Cur != unix.RLIM_INFINITY {
+		ls = append(ls, limit{bytes: rlim.Cur, source: SourceRlimit})
+	}
+	return ls, nil
+}
+
+// cgroupLimits returns the memory limits imposed on the process by
+// the cgroups listed in the given cgroup file, in the form of
+// /proc/self/cgroup, with cgroup filesystems mounted under root.
+// Both version 1 and version 2 hierarchies are consulted, as either
+// or both may be in use.
+func cgroupLimits(fsys vfs.FS, cgroupFile, root string) ([]limit, error) {
+	data, err := vfs.ReadFile(fsys, cgroupFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read cgroups: %v", err)
+	}
+	var ls []limit
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		// Each line has the form hierarchy-ID:controller-list:cgroup-path.
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		var (
+			dir, file string
+			source    Source
+		)
+		switch {
+		case fields[0] == "0" && fields[1] == "":
+			// The unified hierarchy is mounted at the root, or
+			// under "unified" on hybrid systems.
+			dir = root
+			if _, err := fsys.Stat(path.Join(root, "cgroup.controllers")); err != nil {
+				dir = path.Join(root, "unified")
+			}
+			file, source = "memory.max", SourceCgroupV2
+		case hasController(fields[1], "memory"):
+			dir = path.Join(root, "memory")
+			file, source = "memory.limit_in_bytes", SourceCgroupV1
+		default:
+			continue
+		}
+		n, ok, err := hierarchyLimit(fsys, dir, fields[2], file)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			ls = append(ls, limit{bytes: n, source: source})
+		}
+	}
+	return ls, nil
+}
+
+func hasController(list, name string) bool {
+	for _, c := range strings.Split(list, ",") {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// hierarchyLimit returns the lowest limit held in the named file of
+// the cgroup at cgroupPath and all its ancestors, in the hierarchy
+// mounted at dir. If the cgroup is not visible under dir, as happens
+// inside a container with its own cgroup namespace, only the file at
+// the root of the hierarchy is read.
+func hierarchyLimit(fsys vfs.FS, dir, cgroupPath, file string) (uint64, bool, error) {
+	p := path.Clean("/" + cgroupPath)
+	if _, err := fsys.Stat(path.Join(dir, p)); err != nil {
+		p = "/"
+	}
+	var (
+		min   uint64
+		found bool
+	)
+	for {
+		n, ok, err := readLimit(fsys, path.Join(dir, p, file))
+		if err != nil {
+			return 0, false, err
+		}
+		if ok && (!found || n < min) {
+			min, found = n, true
+		}
+		if p == "/" {
+			return min, found, nil
+		}
+		p = path.Dir(p)
+	}
+}
+
+// maxV1Limit holds the smallest value of memory.limit_in_bytes that is
+// treated as unlimited. The kernel reports "no limit" as the largest
+// page-aligned int64, whose exact value depends on the page size.
+const maxV1Limit = 1 << 62
+
+// readLimit reads a limit from a cgroup file. It reports false if the
+// file does not exist or holds no limit.
+func readLimit(fsys vfs.FS, name string) (uint64, bool, error) {
+	data, err := vfs.ReadFile(fsys, name)
+	if os.IsNotExist(err) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("cannot read memory limit: %v", err)
+	}
+	s := strings.TrimSpace(string(data))
+	if s == "max" {
+		return 0, false, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("cannot parse memory limit in %q: %v", name, err)
+	}
+	if n >= maxV1Limit {
+		return 0, false, nil
+	}
+	return n, true, nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package memory
+
+import (
+	"path"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/vfs"
+)
+
+type cgroupSuite struct {
+	fs *vfs.MemFS
+}
+
+var _ = gc.Suite(&cgroupSuite{})
+
+func (s *cgroupSuite) SetUpTest(c *gc.C) {
+	s.fs = vfs.NewMemFS()
+}
+
+func (s *cgroupSuite) writeFile(c *gc.C, name, contents string) {
+	err := s.fs.MkdirAll(path.Dir(name), 0755)
+	c.Assert(err, jc.ErrorIsNil)
+	err = vfs.WriteFile(s.fs, name, []byte(contents), 0644)
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *cgroupSuite) limits(c *gc.C) []limit {
+	ls, err := cgroupLimits(s.fs, "/proc/self/cgroup", "/sys/fs/cgroup")
+	c.Assert(err, jc.ErrorIsNil)
+	return ls
+}
+
+func (s *cgroupSuite) TestV2(c *gc.C) {
+	s.writeFile(c, "/proc/self/cgroup", "0::/system.slice/app.service\n")
+	s.writeFile(c, "/sys/fs/cgroup/cgroup.controllers", "memory pids\n")
+	s.writeFile(c, "/sys/fs/cgroup/system.slice/memory.max", "2147483648\n")
+	s.writeFile(c, "/sys/fs/cgroup/system.slice/app.service/memory.max", "max\n")
+	c.Assert(s.limits(c), jc.DeepEquals, []limit{{bytes: 2147483648, source: SourceCgroupV2}})
+}
+
+func (s *cgroupSuite) TestV2Unlimited(c *gc.C) {
+	s.writeFile(c, "/proc/self/cgroup", "0::/user.slice\n")
+	s.writeFile(c, "/sys/fs/cgroup/cgroup.controllers", "memory\n")
+	s.writeFile(c, "/sys/fs/cgroup/user.slice/memory.max", "max\n")
+	c.Assert(s.limits(c), gc.HasLen, 0)
+}
+
+func (s *cgroupSuite) TestV2Namespaced(c *gc.C) {
+	// Inside a cgroup namespace, the path in /proc/self/cgroup
+	// does not exist in the mounted hierarchy.
+	s.writeFile(c, "/proc/self/cgroup", "0::/../../lxc/c1\n")
+	s.writeFile(c, "/sys/fs/cgroup/cgroup.controllers", "memory\n")
+	s.writeFile(c, "/sys/fs/cgroup/memory.max", "1073741824\n")
+	c.Assert(s.limits(c), jc.DeepEquals, []limit{{bytes: 1073741824, source: SourceCgroupV2}})
+}
+
+func (s *cgroupSuite) TestV1(c *gc.C) {
+	s.writeFile(c, "/proc/self/cgroup", "5:cpu,cpuacct:/\n4:memory:/docker/abc\n0::/\n")
+	s.writeFile(c, "/sys/fs/cgroup/memory/memory.limit_in_bytes", "9223372036854771712\n")
+	s.writeFile(c, "/sys/fs/cgroup/memory/docker/memory.limit_in_bytes", "9223372036854771712\n")
+	s.writeFile(c, "/sys/fs/cgroup/memory/docker/abc/memory.limit_in_bytes", "536870912\n")
+	// The unified hierarchy of a hybrid system has no memory limits.
+	s.writeFile(c, "/sys/fs/cgroup/unified/cgroup.procs", "1\n")
+	c.Assert(s.limits(c), jc.DeepEquals, []limit{{bytes: 536870912, source: SourceCgroupV1}})
+}
+
+func (s *cgroupSuite) TestNoCgroups(c *gc.C) {
+	c.Assert(s.limits(c), gc.HasLen, 0)
+}
+
+func (s *cgroupSuite) TestInvalidLimit(c *gc.C) {
+	s.writeFile(c, "/proc/self/cgroup", "4:memory:/\n")
+	s.writeFile(c, "/sys/fs/cgroup/memory/memory.limit_in_bytes", "lots\n")
+	_, err := cgroupLimits(s.fs, "/proc/self/cgroup", "/sys/fs/cgroup")
+	c.Assert(err, gc.ErrorMatches, `cannot parse memory limit in "/sys/fs/cgroup/memory/memory.limit_in_bytes": .*`)
+}
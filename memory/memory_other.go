@@ -0,0 +1,20 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+//go:build !linux && !darwin && !windows
+// +build !linux,!darwin,!windows
+
+package memory
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func total() (uint64, error) {
+	return 0, fmt.Errorf("system memory not supported on %s", runtime.GOOS)
+}
+
+func limits() ([]limit, error) {
+	return nil, nil
+}
@@ -0,0 +1,40 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package memory_test
+
+import (
+	"runtime"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/memory"
+)
+
+type memorySuite struct{}
+
+var _ = gc.Suite(&memorySuite{})
+
+func (*memorySuite) TestDetect(c *gc.C) {
+	switch runtime.GOOS {
+	case "linux", "darwin", "windows":
+	default:
+		c.Skip("memory detection not supported on " + runtime.GOOS)
+	}
+	info, err := memory.Detect()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(info.Total, jc.GreaterThan, uint64(0))
+	c.Assert(info.Limit, jc.GreaterThan, uint64(0))
+	c.Assert(info.Limit <= info.Total, jc.IsTrue)
+	if info.Limit == info.Total {
+		c.Assert(info.Source, gc.Equals, memory.SourceSystem)
+	}
+
+	total, err := memory.Total()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(total, gc.Equals, info.Total)
+	limit, err := memory.Limit()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(limit, gc.Equals, info.Limit)
+}
@@ -0,0 +1,64 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package memory
+
+import (
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	modkernel32              = windows.NewLazySystemDLL("kernel32.dll")
+	procGlobalMemoryStatusEx = modkernel32.NewProc("GlobalMemoryStatusEx")
+)
+
+// memoryStatusEx mirrors the Win32 MEMORYSTATUSEX structure.
+type memoryStatusEx struct {
+	length               uint32
+	memoryLoad           uint32
+	totalPhys            uint64
+	availPhys            uint64
+	totalPageFile        uint64
+	availPageFile        uint64
+	totalVirtual         uint64
+	availVirtual         uint64
+	availExtendedVirtual uint64
+}
+
+func total() (uint64, error) {
+	status := memoryStatusEx{length: uint32(unsafe.Sizeof(memoryStatusEx{}))}
+	r1, _, err := procGlobalMemoryStatusEx.Call(uintptr(unsafe.Pointer(&status)))
+	if r1 == 0 {
+		return 0, fmt.Errorf("cannot get system memory: %v", err)
+	}
+	return status.totalPhys, nil
+}
+
+func limits() ([]limit, error) {
+	var info windows.JOBOBJECT_EXTENDED_LIMIT_INFORMATION
+	// A zero handle queries the job object containing the
+	// current process, if any.
+	err := windows.QueryInformationJobObject(
+		0,
+		windows.JobObjectExtendedLimitInformation,
+		uintptr(unsafe.Pointer(&info)),
+		uint32(unsafe.Sizeof(info)),
+		nil,
+	)
+	if err != nil {
+		// The process is not in a job.
+		return nil, nil
+	}
+	var ls []limit
+	flags := info.BasicLimitInformation.LimitFlags
+	if flags&windows.JOB_OBJECT_LIMIT_JOB_MEMORY != 0 {
+		ls = append(ls, limit{bytes: uint64(info.JobMemoryLimit), source: SourceJobObject})
+	}
+	if flags&windows.JOB_OBJECT_LIMIT_PROCESS_MEMORY != 0 {
+		ls = append(ls, limit{bytes: uint64(info.ProcessMemoryLimit), source: SourceJobObject})
+	}
+	return ls, nil
+}
@@ -0,0 +1,196 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package multierror provides an error that aggregates several others,
+// for operations that carry on after a failure, such as running tasks in
+// parallel, running a command on several hosts or removing a batch of
+// files:
+//
+//	var errs multierror.Collector
+//	for _, host := range hosts {
+//		host := host
+//		run.Do(func() error {
+//			errs.Addf(runOn(host), "host %s", host)
+//			return nil
+//		})
+//	}
+//	run.Wait()
+//	if err := errs.Err(); err != nil {
+//		logger.Errorf("%s", err.(multierror.Errors).Summary())
+//	}
+package multierror
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Errors holds several errors. errors.Is and errors.As
+// report a match if any of them matches.
+type Errors []error
+
+// Error implements error, describing the first error only. Use
+// Summary to describe them all.
+func (errs Errors) Error() string {
+	switch len(errs) {
+	case 0:
+		return "no error"
+	case 1:
+		return errs[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more)", errs[0].Error(), len(errs)-1)
+}
+
+// Unwrap returns the errors held.
+func (errs Errors) Unwrap() []error {
+	return errs
+}
+
+// Is reports whether any of the errors held matches target.
+func (errs Errors) Is(target error) bool {
+	for _, err := range errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first of the errors held that matches target,
+// and if one is found, sets target to it and returns true.
+func (errs Errors) As(target interface{}) bool {
+	for _, err := range errs {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Summary describes all of the errors held, one per line, with errors
+// that have the same message grouped together and listed with the
+// contexts they occurred in. For example:
+//
+//	3 errors:
+//	  host a, host b: connection refused
+//	  host c: permission denied
+func (errs Errors) Summary() string {
+	switch len(errs) {
+	case 0:
+		return "no error"
+	case 1:
+		return errs[0].Error()
+	}
+	// Errors without a context are grouped separately,
+	// and counted rather than listed.
+	type key struct {
+		msg        string
+		hasContext bool
+	}
+	type group struct {
+		key
+		contexts []string
+		count    int
+	}
+	var groups []*group
+	byKey := make(map[key]*group)
+	for _, err := range errs {
+		k, context := key{msg: err.Error()}, ""
+		if cerr, ok := err.(*ContextError); ok {
+			k, context = key{cerr.Err.Error(), true}, cerr.Context
+		}
+		g := byKey[k]
+		if g == nil {
+			g = &group{key: k}
+			byKey[k] = g
+			groups = append(groups, g)
+		}
+		g.count++
+		g.contexts = append(g.contexts, context)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d errors:", len(errs))
+	for _, g := range groups {
+		b.WriteString("\n  ")
+		switch {
+		case g.hasContext:
+			fmt.Fprintf(&b, "%s: %s", strings.Join(g.contexts, ", "), g.msg)
+		case g.count > 1:
+			fmt.Fprintf(&b, "%s (%d times)", g.msg, g.count)
+		default:
+			b.WriteString(g.msg)
+		}
+	}
+	return b.String()
+}
+
+// ContextError is an error along with a description of the context
+// it occurred in, such as the host or file it relates to.
+type ContextError struct {
+	Context string
+	Err     error
+}
+
+// WithContext returns err with the given context, or nil if err is nil.
+func WithContext(err error, context string) error {
+	if err == nil {
+		return nil
+	}
+	return &ContextError{Context: context, Err: err}
+}
+
+// Error implements error.
+func (e *ContextError) Error() string {
+	return e.Context + ": " + e.Err.Error()
+}
+
+// Unwrap returns the error without its context.
+func (e *ContextError) Unwrap() error {
+	return e.Err
+}
+
+// Collector collects errors. Its methods may be called concurrently.
+// The zero value is ready to use.
+type Collector struct {
+	mu   sync.Mutex
+	errs Errors
+}
+
+// Add adds err to the errors collected. It does nothing if err is nil.
+func (c *Collector) Add(err error) {
+	if err == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.errs = append(c.errs, err)
+}
+
+// Addf adds err to the errors collected, with the context described by
+// the given format and arguments. It does nothing if err is nil.
+func (c *Collector) Addf(err error, format string, args ...interface{}) {
+	if err == nil {
+		return
+	}
+	c.Add(WithContext(err, fmt.Sprintf(format, args...)))
+}
+
+// Len returns the number of errors collected.
+func (c *Collector) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.errs)
+}
+
+// Err returns an Errors value holding the errors collected in the
+// order they were added, or nil if there were none.
+func (c *Collector) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.errs) == 0 {
+		return nil
+	}
+	return append(Errors(nil), c.errs...)
+}
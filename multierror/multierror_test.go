@@ -0,0 +1,147 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package multierror_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/multierror"
+)
+
+type multierrorSuite struct{}
+
+var _ = gc.Suite(&multierrorSuite{})
+
+var (
+	errRefused = errors.New("connection refused")
+	errDenied  = errors.New("permission denied")
+)
+
+func (*multierrorSuite) TestError(c *gc.C) {
+	c.Check(multierror.Errors{}.Error(), gc.Equals, "no error")
+	c.Check(multierror.Errors{errRefused}.Error(), gc.Equals, "connection refused")
+	c.Check(multierror.Errors{errRefused, errDenied, errDenied}.Error(), gc.Equals, "connection refused (and 2 more)")
+}
+
+func (*multierrorSuite) TestWithContext(c *gc.C) {
+	c.Assert(multierror.WithContext(nil, "host a"), jc.ErrorIsNil)
+	err := multierror.WithContext(errRefused, "host a")
+	c.Assert(err, gc.ErrorMatches, "host a: connection refused")
+	c.Assert(errors.Is(err, errRefused), jc.IsTrue)
+}
+
+func (*multierrorSuite) TestIs(c *gc.C) {
+	errs := multierror.Errors{
+		multierror.WithContext(errRefused, "host a"),
+		fmt.Errorf("removing: %w", os.ErrNotExist),
+	}
+	c.Check(errors.Is(errs, errRefused), jc.IsTrue)
+	c.Check(errors.Is(errs, os.ErrNotExist), jc.IsTrue)
+	c.Check(errors.Is(errs, errDenied), jc.IsFalse)
+
+	// Errors found inside a wrapper are still matched.
+	wrapped := fmt.Errorf("batch failed: %w", errs)
+	c.Check(errors.Is(wrapped, os.ErrNotExist), jc.IsTrue)
+}
+
+func (*multierrorSuite) TestAs(c *gc.C) {
+	pathErr := &os.PathError{Op: "remove", Path: "/a", Err: os.ErrPermission}
+	errs := multierror.Errors{
+		errRefused,
+		multierror.WithContext(pathErr, "file a"),
+	}
+	var target *os.PathError
+	c.Assert(errors.As(errs, &target), jc.IsTrue)
+	c.Assert(target, gc.Equals, pathErr)
+
+	var cerr *multierror.ContextError
+	c.Assert(errors.As(errs, &cerr), jc.IsTrue)
+	c.Assert(cerr.Context, gc.Equals, "file a")
+
+	var errno *os.SyscallError
+	c.Assert(errors.As(errs, &errno), jc.IsFalse)
+}
+
+func (*multierrorSuite) TestSummary(c *gc.C) {
+	tests := []struct {
+		errs   multierror.Errors
+		expect string
+	}{{
+		errs:   nil,
+		expect: "no error",
+	}, {
+		errs:   multierror.Errors{multierror.WithContext(errRefused, "host a")},
+		expect: "host a: connection refused",
+	}, {
+		errs: multierror.Errors{
+			multierror.WithContext(errRefused, "host a"),
+			multierror.WithContext(errDenied, "host c"),
+			multierror.WithContext(errRefused, "host b"),
+		},
+		expect: `
+3 errors:
+  host a, host b: connection refused
+  host c: permission denied`[1:],
+	}, {
+		errs: multierror.Errors{
+			errDenied,
+			multierror.WithContext(errDenied, "file a"),
+			errRefused,
+			errDenied,
+		},
+		expect: `
+4 errors:
+  permission denied (2 times)
+  file a: permission denied
+  connection refused`[1:],
+	}}
+	for i, test := range tests {
+		c.Logf("test %d", i)
+		c.Check(test.errs.Summary(), gc.Equals, test.expect)
+	}
+}
+
+func (*multierrorSuite) TestCollector(c *gc.C) {
+	var errs multierror.Collector
+	c.Assert(errs.Err(), jc.ErrorIsNil)
+	errs.Add(nil)
+	errs.Addf(nil, "host %s", "a")
+	c.Assert(errs.Len(), gc.Equals, 0)
+	c.Assert(errs.Err(), jc.ErrorIsNil)
+
+	errs.Add(errDenied)
+	errs.Addf(errRefused, "host %s", "b")
+	c.Assert(errs.Len(), gc.Equals, 2)
+	err := errs.Err()
+	c.Assert(err, jc.DeepEquals, multierror.Errors{
+		errDenied,
+		&multierror.ContextError{Context: "host b", Err: errRefused},
+	})
+
+	// The errors returned are not changed by later additions.
+	errs.Add(errDenied)
+	c.Assert(err, gc.HasLen, 2)
+}
+
+func (*multierrorSuite) TestCollectorConcurrent(c *gc.C) {
+	var errs multierror.Collector
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs.Addf(errRefused, "host %d", i)
+		}(i)
+	}
+	wg.Wait()
+	err := errs.Err()
+	c.Assert(err, gc.HasLen, 10)
+	c.Assert(errors.Is(err, errRefused), jc.IsTrue)
+}
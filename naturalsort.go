@@ -7,7 +7,15 @@ import (
 	"fmt"
 	"sort"
 	"strconv"
+	"strings"
 	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
 )
 
 // SortStringsNaturally sorts strings according to their natural sort order.
@@ -29,32 +37,263 @@ func (n naturally) Swap(a, b int) {
 // Less sorts by non-numeric prefix and numeric suffix
 // when one exists.
 func (n naturally) Less(a, b int) bool {
-	aVal := n[a]
-	bVal := n[b]
+	return naturalOrder.Compare(n[a], n[b]) < 0
+}
+
+// naturalOrder compares strings by their plain natural sort order.
+// Having no options, it is safe for concurrent use.
+var naturalOrder = NewNaturalComparator(NaturalSortOptions{})
+
+// NaturalSortOptions holds options for NewNaturalComparator
+// and SortStringsNaturallyWithOptions.
+type NaturalSortOptions struct {
+	// Versions, if true, compares dotted numbers such as 1.2.3 as
+	// semantic versions. A version followed by a pre-release suffix,
+	// as in 1.2.3-rc.1, sorts before the same version without one,
+	// and pre-release suffixes are compared identifier by
+	// identifier. Build metadata after a "+" is ignored. Suffixes
+	// are only recognised after numbers with at least one dot, so
+	// that names such as "x1-g0" sort as before.
+	Versions bool
+
+	// IgnoreCase, if true, compares text without regard to case.
+	IgnoreCase bool
+
+	// IgnoreDiacritics, if true, compares text without regard
+	// to accents and other diacritical marks, so that "é"
+	// compares equal to "e".
+	IgnoreDiacritics bool
+
+	// Locale, if not language.Und, compares text by the collation
+	// rules of that language, rather than byte by byte. Numbers
+	// are still compared by value.
+	Locale language.Tag
+}
+
+// NaturalComparator compares strings by their natural sort order, as
+// SortStringsNaturally sorts them, as modified by its options. Unless
+// its options are all zero, it must not be used concurrently.
+type NaturalComparator struct {
+	versions bool
+	collator *collate.Collator
+	fold     transform.Transformer
+}
+
+// NewNaturalComparator returns a comparator with the given options.
+func NewNaturalComparator(options NaturalSortOptions) *NaturalComparator {
+	c := &NaturalComparator{versions: options.Versions}
+	if options.Locale != language.Und {
+		var opts []collate.Option
+		if options.IgnoreCase {
+			opts = append(opts, collate.IgnoreCase)
+		}
+		if options.IgnoreDiacritics {
+			opts = append(opts, collate.IgnoreDiacritics)
+		}
+		c.collator = collate.New(options.Locale, opts...)
+		return c
+	}
+	var folds []transform.Transformer
+	if options.IgnoreDiacritics {
+		folds = append(folds, norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	}
+	if options.IgnoreCase {
+		folds = append(folds, cases.Fold())
+	}
+	if len(folds) > 0 {
+		c.fold = transform.Chain(folds...)
+	}
+	return c
+}
 
+// SortStringsNaturallyWithOptions is like SortStringsNaturally but
+// compares the strings as set by options. Strings that compare equal
+// keep their original order.
+func SortStringsNaturallyWithOptions(s []string, options NaturalSortOptions) []string {
+	c := NewNaturalComparator(options)
+	sort.SliceStable(s, func(i, j int) bool {
+		return c.Compare(s[i], s[j]) < 0
+	})
+	return s
+}
+
+// Compare returns -1, 0 or 1 as a sorts before, with or after b.
+func (c *NaturalComparator) Compare(a, b string) int {
 	for {
-		// If bVal is empty, then aVal can't be less than it.
-		if bVal == "" {
-			return false
+		switch {
+		case a == "" && b == "":
+			return 0
+		case b == "":
+			return 1
+		case a == "":
+			return -1
+		}
+
+		aPrefix, aNumber, aRemainder := splitAtNumber(a)
+		bPrefix, bNumber, bRemainder := splitAtNumber(b)
+		if r := c.compareText(aPrefix, bPrefix); r != 0 {
+			return r
+		}
+		if c.versions && aNumber >= 0 && bNumber >= 0 {
+			var aVersion, bVersion version
+			aVersion, aRemainder = parseVersion(aNumber, aRemainder)
+			bVersion, bRemainder = parseVersion(bNumber, bRemainder)
+			if r := aVersion.compare(bVersion); r != 0 {
+				return r
+			}
+		} else if r := compareInts(aNumber, bNumber); r != 0 {
+			return r
+		}
+
+		// Everything is the same so far, try again with the remainder.
+		a = aRemainder
+		b = bRemainder
+	}
+}
+
+// compareText compares text between numbers.
+func (c *NaturalComparator) compareText(a, b string) int {
+	if a == b {
+		return 0
+	}
+	if c.collator != nil {
+		return c.collator.CompareString(a, b)
+	}
+	if c.fold != nil {
+		a, b = c.foldText(a), c.foldText(b)
+	}
+	return strings.Compare(a, b)
+}
+
+func (c *NaturalComparator) foldText(s string) string {
+	folded, _, err := transform.String(c.fold, s)
+	if err != nil {
+		return s
+	}
+	return folded
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// version holds a version number parsed by parseVersion.
+type version struct {
+	numbers    []int
+	preRelease []string
+}
+
+// parseVersion parses the version number that starts with the given
+// number and continues with rest, returning the version and whatever
+// of rest follows it.
+func parseVersion(first int, rest string) (version, string) {
+	v := version{numbers: []int{first}}
+	for len(rest) > 1 && rest[0] == '.' && isASCIIDigit(rest[1]) {
+		_, n, remainder := splitAtNumber(rest[1:])
+		v.numbers = append(v.numbers, n)
+		rest = remainder
+	}
+	if len(v.numbers) == 1 {
+		return v, rest
+	}
+	if len(rest) > 1 && rest[0] == '-' {
+		if n := versionIdentifiersLen(rest[1:]); n > 0 {
+			v.preRelease = strings.Split(rest[1:1+n], ".")
+			rest = rest[1+n:]
 		}
-		// If aVal is empty here, then is must be less than bVal.
-		if aVal == "" {
-			return true
+	}
+	if len(rest) > 1 && rest[0] == '+' {
+		if n := versionIdentifiersLen(rest[1:]); n > 0 {
+			rest = rest[1+n:]
 		}
+	}
+	return v, rest
+}
+
+// versionIdentifiersLen returns the length of the dot-separated
+// identifiers at the start of s, as allowed in pre-release versions
+// and build metadata.
+func versionIdentifiersLen(s string) int {
+	n := 0
+	for n < len(s) && isVersionIdentifierChar(s[n]) {
+		n++
+	}
+	// A trailing dot or hyphen is punctuation, not part
+	// of an identifier.
+	for n > 0 && (s[n-1] == '.' || s[n-1] == '-') {
+		n--
+	}
+	return n
+}
 
-		aPrefix, aNumber, aRemainder := splitAtNumber(aVal)
-		bPrefix, bNumber, bRemainder := splitAtNumber(bVal)
-		if aPrefix != bPrefix {
-			return aPrefix < bPrefix
+func isVersionIdentifierChar(c byte) bool {
+	return isASCIIDigit(c) || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '-' || c == '.'
+}
+
+func isASCIIDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// compare compares versions as semantic versioning orders them.
+func (v version) compare(other version) int {
+	for i := 0; i < len(v.numbers) && i < len(other.numbers); i++ {
+		if r := compareInts(v.numbers[i], other.numbers[i]); r != 0 {
+			return r
 		}
-		if aNumber != bNumber {
-			return aNumber < bNumber
+	}
+	if r := compareInts(len(v.numbers), len(other.numbers)); r != 0 {
+		return r
+	}
+	switch {
+	case len(v.preRelease) == 0 && len(other.preRelease) == 0:
+		return 0
+	case len(v.preRelease) == 0:
+		return 1
+	case len(other.preRelease) == 0:
+		return -1
+	}
+	for i := 0; i < len(v.preRelease) && i < len(other.preRelease); i++ {
+		if r := comparePreRelease(v.preRelease[i], other.preRelease[i]); r != 0 {
+			return r
 		}
+	}
+	return compareInts(len(v.preRelease), len(other.preRelease))
+}
+
+// comparePreRelease compares pre-release identifiers. Numeric
+// identifiers are compared by value and sort before the others,
+// which are compared byte by byte.
+func comparePreRelease(a, b string) int {
+	aNumeric, bNumeric := isNumeric(a), isNumeric(b)
+	switch {
+	case aNumeric && bNumeric:
+		// Compare by length first, as the
+		// numbers may not fit in an int.
+		a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+		if r := compareInts(len(a), len(b)); r != 0 {
+			return r
+		}
+	case aNumeric:
+		return -1
+	case bNumeric:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
 
-		// Everything is the same so far, try again with the remainer.
-		aVal = aRemainder
-		bVal = bRemainder
+func isNumeric(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isASCIIDigit(s[i]) {
+			return false
+		}
 	}
+	return s != ""
 }
 
 // splitAtNumber splits given string at the first digit, returning the
@@ -6,6 +6,8 @@ package utils_test
 import (
 	"math/rand"
 
+	jc "github.com/juju/testing/checkers"
+	"golang.org/x/text/language"
 	gc "gopkg.in/check.v1"
 
 	"github.com/juju/testing"
@@ -109,21 +111,132 @@ func (s *naturalSortSuite) TestIPs(c *gc.C) {
 	})
 }
 
-func checkCorrectSort(c *gc.C, expected []string) {
-	checkSort(c, expected, reverse)
+func (s *naturalSortSuite) TestVersions(c *gc.C) {
+	checkCorrectSortWithOptions(c, utils.NaturalSortOptions{Versions: true}, []string{
+		"juju-1.9.0",
+		"juju-1.10.0-alpha",
+		"juju-1.10.0-alpha.1",
+		"juju-1.10.0-alpha.beta",
+		"juju-1.10.0-beta",
+		"juju-1.10.0-beta.2",
+		"juju-1.10.0-beta.11",
+		"juju-1.10.0-rc.1",
+		"juju-1.10.0",
+		"juju-1.10.1",
+		"juju-2.0",
+		"juju-2.0.0",
+		"juju-10.0.0",
+	})
+}
+
+func (s *naturalSortSuite) TestVersionsUndotted(c *gc.C) {
+	// Without a dot, a hyphen does not start a pre-release suffix.
+	checkCorrectSortWithOptions(c, utils.NaturalSortOptions{Versions: true}, []string{
+		"x1",
+		"x1-g0",
+		"x1-g10",
+		"x2",
+	})
+}
+
+func (s *naturalSortSuite) TestVersionsBuildMetadata(c *gc.C) {
+	cmp := utils.NewNaturalComparator(utils.NaturalSortOptions{Versions: true})
+	c.Check(cmp.Compare("1.2.3+build.5", "1.2.3+build.7"), gc.Equals, 0)
+	c.Check(cmp.Compare("1.2.3-rc.1+build", "1.2.3"), gc.Equals, -1)
+	c.Check(cmp.Compare("1.2.3+build.tar", "1.2.3+build.gz"), gc.Equals, 0)
+	c.Check(cmp.Compare("v1.2.", "v1.2"), gc.Equals, 1)
+
+	// Without the option, pre-releases sort after releases.
+	cmp = utils.NewNaturalComparator(utils.NaturalSortOptions{})
+	c.Check(cmp.Compare("1.2.3-rc.1", "1.2.3"), gc.Equals, 1)
+}
+
+func (s *naturalSortSuite) TestIgnoreCase(c *gc.C) {
+	checkCorrectSortWithOptions(c, utils.NaturalSortOptions{IgnoreCase: true}, []string{
+		"apache2/0",
+		"Apache2/1",
+		"apache2/10",
+		"MySQL/2",
+		"mysql/3",
+	})
+	cmp := utils.NewNaturalComparator(utils.NaturalSortOptions{IgnoreCase: true})
+	c.Check(cmp.Compare("Unit/1", "unit/01"), gc.Equals, 0)
+}
+
+func (s *naturalSortSuite) TestIgnoreDiacritics(c *gc.C) {
+	checkCorrectSortWithOptions(c, utils.NaturalSortOptions{IgnoreDiacritics: true}, []string{
+		"cafe1",
+		"café2",
+		"cafe10",
+		"crème",
+		"cz",
+	})
+	cmp := utils.NewNaturalComparator(utils.NaturalSortOptions{IgnoreDiacritics: true})
+	c.Check(cmp.Compare("Café", "Cafe"), gc.Equals, 0)
+	c.Check(cmp.Compare("Café", "cafe"), gc.Equals, -1)
+	cmp = utils.NewNaturalComparator(utils.NaturalSortOptions{IgnoreDiacritics: true, IgnoreCase: true})
+	c.Check(cmp.Compare("Café", "cafe"), gc.Equals, 0)
+}
+
+func (s *naturalSortSuite) TestLocale(c *gc.C) {
+	// Swedish sorts "ä" after "z"; German sorts it with "a".
+	checkCorrectSortWithOptions(c, utils.NaturalSortOptions{Locale: language.Swedish}, []string{
+		"host-a2",
+		"host-z1",
+		"host-ä1",
+		"host-ä10",
+	})
+	checkCorrectSortWithOptions(c, utils.NaturalSortOptions{Locale: language.German}, []string{
+		"host-a2",
+		"host-ä1",
+		"host-ä10",
+		"host-z1",
+	})
+	cmp := utils.NewNaturalComparator(utils.NaturalSortOptions{
+		Locale:           language.German,
+		IgnoreCase:       true,
+		IgnoreDiacritics: true,
+	})
+	c.Check(cmp.Compare("Äpfel/2", "apfel/02"), gc.Equals, 0)
+}
+
+func (s *naturalSortSuite) TestStable(c *gc.C) {
+	input := []string{"b", "A", "a", "B"}
+	utils.SortStringsNaturallyWithOptions(input, utils.NaturalSortOptions{IgnoreCase: true})
+	c.Check(input, jc.DeepEquals, []string{"A", "a", "b", "B"})
+}
+
+func checkCorrectSortWithOptions(c *gc.C, options utils.NaturalSortOptions, expected []string) {
+	sortWithOptions := func(s []string) {
+		utils.SortStringsNaturallyWithOptions(s, options)
+	}
+	checkSortWith(c, expected, reverse, sortWithOptions)
 	for i := 0; i < 5; i++ {
-		checkSort(c, expected, shuffle)
+		checkSortWith(c, expected, shuffle, sortWithOptions)
 	}
 }
 
-func checkSort(c *gc.C, expected []string, xform func([]string)) {
+func checkSortWith(c *gc.C, expected []string, xform func([]string), sortStrings func([]string)) {
 	input := copyStrSlice(expected)
 	xform(input)
 	origInput := copyStrSlice(input)
-	utils.SortStringsNaturally(input)
+	sortStrings(input)
 	c.Check(input, gc.DeepEquals, expected, gc.Commentf("input was: %#v", origInput))
 }
 
+func checkCorrectSort(c *gc.C, expected []string) {
+	checkSort(c, expected, reverse)
+	for i := 0; i < 5; i++ {
+		checkSort(c, expected, shuffle)
+	}
+}
+
+func checkSort(c *gc.C, expected []string, xform func([]string)) {
+	checkSortWith(c, expected, xform, func(s []string) {
+		utils.SortStringsNaturally(s)
+	})
+}
+
 func copyStrSlice(in []string) []string {
 	out := make([]string, len(in))
 	copy(out, in)
@@ -81,3 +81,133 @@ func GetV4OrV6AddressForInterface(interfaceName string) (string, error) {
 	}
 	return GetIPv6Address(addrs)
 }
+
+// AddressScope classifies an IP address by how
+// widely it can be reached.
+type AddressScope string
+
+const (
+	// ScopePublic is the scope of globally routable addresses.
+	ScopePublic AddressScope = "public"
+
+	// ScopePrivate is the scope of addresses reserved for private
+	// networks (RFC 1918, RFC 6598 shared address space and IPv6
+	// unique local addresses).
+	ScopePrivate AddressScope = "private"
+
+	// ScopeLinkLocal is the scope of addresses that are only
+	// valid on the local network link.
+	ScopeLinkLocal AddressScope = "link-local"
+
+	// ScopeLoopback is the scope of loopback addresses.
+	ScopeLoopback AddressScope = "loopback"
+
+	// ScopeUnknown is the scope of addresses that cannot be
+	// classified, such as unspecified and multicast addresses.
+	ScopeUnknown AddressScope = "unknown"
+)
+
+var privateNets = mustParseCIDRs(
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"100.64.0.0/10",
+	"fc00::/7",
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets[i] = ipNet
+	}
+	return nets
+}
+
+// ClassifyIP returns the scope of the given IP address.
+func ClassifyIP(ip net.IP) AddressScope {
+	switch {
+	case ip == nil || ip.IsUnspecified() || ip.IsMulticast():
+		return ScopeUnknown
+	case ip.IsLoopback():
+		return ScopeLoopback
+	case ip.IsLinkLocalUnicast():
+		return ScopeLinkLocal
+	}
+	for _, ipNet := range privateNets {
+		if ipNet.Contains(ip) {
+			return ScopePrivate
+		}
+	}
+	if ip.IsGlobalUnicast() {
+		return ScopePublic
+	}
+	return ScopeUnknown
+}
+
+// HostAddress holds an address of a network interface of the machine.
+type HostAddress struct {
+	// Interface holds the name of the network interface.
+	Interface string
+
+	// IP holds the address.
+	IP net.IP
+
+	// Scope holds the scope of the address.
+	Scope AddressScope
+}
+
+// HostAddresses returns the addresses of all the network interfaces
+// of the machine that are up, excluding loopback addresses, in the
+// order the interfaces are reported by the operating system.
+func HostAddresses() ([]HostAddress, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	var result []HostAddress
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("cannot get addresses for network interface %q: %v", iface.Name, err)
+		}
+		result = append(result, interfaceAddresses(iface.Name, addrs)...)
+	}
+	return result, nil
+}
+
+// interfaceAddresses returns the non-loopback addresses in
+// addrs, as returned by net.Interface.Addrs.
+func interfaceAddresses(name string, addrs []net.Addr) []HostAddress {
+	var result []HostAddress
+	for _, addr := range addrs {
+		var ip net.IP
+		switch addr := addr.(type) {
+		case *net.IPNet:
+			ip = addr.IP
+		case *net.IPAddr:
+			ip = addr.IP
+		default:
+			var err error
+			if ip, _, err = net.ParseCIDR(addr.String()); err != nil {
+				continue
+			}
+		}
+		scope := ClassifyIP(ip)
+		if scope == ScopeLoopback {
+			continue
+		}
+		result = append(result, HostAddress{
+			Interface: name,
+			IP:        ip,
+			Scope:     scope,
+		})
+	}
+	return result
+}
@@ -125,3 +125,52 @@ func (*networkSuite) TestGetIPv6Address(c *gc.C) {
 		}
 	}
 }
+
+func (*networkSuite) TestClassifyIP(c *gc.C) {
+	for addr, scope := range map[string]utils.AddressScope{
+		"8.8.8.8":         utils.ScopePublic,
+		"2001:db8::1":     utils.ScopePublic,
+		"10.1.2.3":        utils.ScopePrivate,
+		"172.20.0.1":      utils.ScopePrivate,
+		"192.168.1.1":     utils.ScopePrivate,
+		"100.64.0.1":      utils.ScopePrivate,
+		"fd00::1":         utils.ScopePrivate,
+		"169.254.1.1":     utils.ScopeLinkLocal,
+		"fe80::1":         utils.ScopeLinkLocal,
+		"127.0.0.1":       utils.ScopeLoopback,
+		"::1":             utils.ScopeLoopback,
+		"0.0.0.0":         utils.ScopeUnknown,
+		"224.0.0.1":       utils.ScopeUnknown,
+		"255.255.255.255": utils.ScopeUnknown,
+	} {
+		c.Check(utils.ClassifyIP(net.ParseIP(addr)), gc.Equals, scope, gc.Commentf("%s", addr))
+	}
+	c.Check(utils.ClassifyIP(nil), gc.Equals, utils.ScopeUnknown)
+}
+
+func (*networkSuite) TestInterfaceAddresses(c *gc.C) {
+	addrs := []net.Addr{
+		&net.IPNet{IP: net.ParseIP("127.0.0.1"), Mask: net.CIDRMask(8, 32)},
+		&net.IPNet{IP: net.ParseIP("10.0.0.2"), Mask: net.CIDRMask(24, 32)},
+		&net.IPAddr{IP: net.ParseIP("fe80::1")},
+		&fakeAddress{"203.0.113.5/24"},
+		&fakeAddress{"bogus"},
+	}
+	result := utils.InterfaceAddresses("eth0", addrs)
+	c.Assert(result, gc.HasLen, 3)
+	c.Check(result[0].Interface, gc.Equals, "eth0")
+	c.Check(result[0].IP.String(), gc.Equals, "10.0.0.2")
+	c.Check(result[0].Scope, gc.Equals, utils.ScopePrivate)
+	c.Check(result[1].IP.String(), gc.Equals, "fe80::1")
+	c.Check(result[1].Scope, gc.Equals, utils.ScopeLinkLocal)
+	c.Check(result[2].IP.String(), gc.Equals, "203.0.113.5")
+	c.Check(result[2].Scope, gc.Equals, utils.ScopePublic)
+}
+
+func (*networkSuite) TestHostAddresses(c *gc.C) {
+	addrs, err := utils.HostAddresses()
+	c.Assert(err, gc.IsNil)
+	for _, addr := range addrs {
+		c.Check(addr.Scope, gc.Not(gc.Equals), utils.ScopeLoopback)
+	}
+}
@@ -0,0 +1,272 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package notify provides helpers that shape bursts of notifications
+// arriving on a channel. Each helper reads from an input channel and
+// writes to a new output channel, which is closed when the input
+// channel is closed or the context is done.
+package notify
+
+import (
+	"context"
+	"time"
+
+	"github.com/juju/clock"
+)
+
+// Debounce returns a channel that receives the most recent value from
+// in once no further values have arrived for the given delay. A burst
+// of values, each closer than delay to the last, therefore produces a
+// single value. If in is closed while a value is pending, the value
+// is sent before the output is closed. If clk is nil, the wall clock
+// is used.
+func Debounce[T any](ctx context.Context, in <-chan T, delay time.Duration, clk clock.Clock) <-chan T {
+	if clk == nil {
+		clk = clock.WallClock
+	}
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		var (
+			timer   clock.Timer
+			fire    <-chan time.Time
+			pending bool
+			last    T
+		)
+		defer func() {
+			if timer != nil {
+				timer.Stop()
+			}
+		}()
+		for {
+			select {
+			case v, ok := <-in:
+				if !ok {
+					if pending {
+						send(ctx, out, last)
+					}
+					return
+				}
+				last, pending = v, true
+				if timer == nil {
+					timer = clk.NewTimer(delay)
+				} else {
+					resetTimer(timer, delay)
+				}
+				fire = timer.Chan()
+			case <-fire:
+				fire, pending = nil, false
+				if !send(ctx, out, last) {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// Throttle returns a channel that receives values from in at most once
+// per interval. The first value is sent immediately; values arriving
+// within the following interval are held back and only the most recent
+// of them is sent when the interval ends. If clk is nil, the wall clock
+// is used.
+func Throttle[T any](ctx context.Context, in <-chan T, interval time.Duration, clk clock.Clock) <-chan T {
+	if clk == nil {
+		clk = clock.WallClock
+	}
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		var (
+			timer   clock.Timer
+			fire    <-chan time.Time
+			pending bool
+			last    T
+		)
+		defer func() {
+			if timer != nil {
+				timer.Stop()
+			}
+		}()
+		// startInterval begins an interval during
+		// which values are held back.
+		startInterval := func() {
+			if timer == nil {
+				timer = clk.NewTimer(interval)
+			} else {
+				resetTimer(timer, interval)
+			}
+			fire = timer.Chan()
+		}
+		for {
+			select {
+			case v, ok := <-in:
+				if !ok {
+					if pending {
+						send(ctx, out, last)
+					}
+					return
+				}
+				if fire != nil {
+					last, pending = v, true
+					continue
+				}
+				if !send(ctx, out, v) {
+					return
+				}
+				startInterval()
+			case <-fire:
+				fire = nil
+				if !pending {
+					continue
+				}
+				pending = false
+				if !send(ctx, out, last) {
+					return
+				}
+				startInterval()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// Coalesce returns a channel that receives values from in without ever
+// blocking the sender. While the receiver is not ready, values arriving
+// on in replace any value still waiting to be received, so only the
+// most recent is delivered. If in is closed while a value is pending,
+// the value is sent before the output is closed.
+func Coalesce[T any](ctx context.Context, in <-chan T) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		var (
+			pending bool
+			last    T
+		)
+		for {
+			// Only offer the value to the receiver when there is one.
+			var sendc chan<- T
+			if pending {
+				sendc = out
+			}
+			select {
+			case v, ok := <-in:
+				if !ok {
+					if pending {
+						send(ctx, out, last)
+					}
+					return
+				}
+				last, pending = v, true
+			case sendc <- last:
+				pending = false
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// Batch returns a channel that receives the values from in gathered
+// into slices. A batch is sent when it holds maxSize values or when
+// maxDelay has passed since its first value arrived, whichever comes
+// first; a maxSize or maxDelay of zero or less imposes no such limit.
+// While the receiver is not ready, values go on being added to the
+// batch waiting to be sent, so that a slow receiver gets fewer, larger
+// batches, none larger than maxSize. If in is closed while a batch is
+// pending, the batch is sent before the output is closed. If clk is
+// nil, the wall clock is used.
+func Batch[T any](ctx context.Context, in <-chan T, maxSize int, maxDelay time.Duration, clk clock.Clock) <-chan []T {
+	if clk == nil {
+		clk = clock.WallClock
+	}
+	out := make(chan []T)
+	go func() {
+		defer close(out)
+		var (
+			timer clock.Timer
+			fire  <-chan time.Time
+			// ready records whether batch is due to be sent.
+			ready bool
+			batch []T
+		)
+		defer func() {
+			if timer != nil {
+				timer.Stop()
+			}
+		}()
+		for {
+			// Only read more values while there is room in the
+			// batch, and only offer the batch once it is due.
+			inc := in
+			if maxSize > 0 && len(batch) >= maxSize {
+				inc = nil
+			}
+			var sendc chan<- []T
+			if ready {
+				sendc = out
+			}
+			select {
+			case v, ok := <-inc:
+				if !ok {
+					if len(batch) > 0 {
+						send(ctx, out, batch)
+					}
+					return
+				}
+				batch = append(batch, v)
+				if len(batch) == 1 && maxDelay > 0 {
+					if timer == nil {
+						timer = clk.NewTimer(maxDelay)
+					} else {
+						resetTimer(timer, maxDelay)
+					}
+					fire = timer.Chan()
+				}
+				if maxSize > 0 && len(batch) >= maxSize {
+					ready = true
+				}
+			case <-fire:
+				fire, ready = nil, true
+			case sendc <- batch:
+				if fire != nil {
+					timer.Stop()
+					fire = nil
+				}
+				batch, ready = nil, false
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// send sends v on out, reporting whether it
+// was sent before the context was done.
+func send[T any](ctx context.Context, out chan<- T, v T) bool {
+	select {
+	case out <- v:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// resetTimer resets t to fire after d, discarding
+// any expiry that has not yet been received.
+func resetTimer(t clock.Timer, d time.Duration) {
+	if !t.Stop() {
+		select {
+		case <-t.Chan():
+		default:
+		}
+	}
+	t.Reset(d)
+}
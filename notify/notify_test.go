@@ -0,0 +1,210 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package notify_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/juju/clock/testclock"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/notify"
+)
+
+type notifySuite struct {
+	testing.IsolationSuite
+	clock *testclock.Clock
+}
+
+var _ = gc.Suite(&notifySuite{})
+
+func (s *notifySuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.clock = testclock.NewClock(time.Now())
+}
+
+// waitAlarm waits until a timer has been set or reset.
+func (s *notifySuite) waitAlarm(c *gc.C) {
+	select {
+	case <-s.clock.Alarms():
+	case <-time.After(testing.LongWait):
+		c.Fatalf("timed out waiting for timer")
+	}
+}
+
+func assertReceive(c *gc.C, out <-chan int, expect int) {
+	select {
+	case v, ok := <-out:
+		c.Assert(ok, gc.Equals, true)
+		c.Assert(v, gc.Equals, expect)
+	case <-time.After(testing.LongWait):
+		c.Fatalf("timed out waiting for %d", expect)
+	}
+}
+
+func assertNoReceive(c *gc.C, out <-chan int) {
+	select {
+	case v, ok := <-out:
+		c.Fatalf("unexpected receive %v (ok %v)", v, ok)
+	case <-time.After(testing.ShortWait):
+	}
+}
+
+func assertClosed[T any](c *gc.C, out <-chan T) {
+	select {
+	case v, ok := <-out:
+		c.Assert(ok, gc.Equals, false, gc.Commentf("received %v", v))
+	case <-time.After(testing.LongWait):
+		c.Fatalf("timed out waiting for close")
+	}
+}
+
+func assertReceiveBatch(c *gc.C, out <-chan []int, expect ...int) {
+	select {
+	case v, ok := <-out:
+		c.Assert(ok, gc.Equals, true)
+		c.Assert(v, jc.DeepEquals, expect)
+	case <-time.After(testing.LongWait):
+		c.Fatalf("timed out waiting for %v", expect)
+	}
+}
+
+func (s *notifySuite) TestDebounce(c *gc.C) {
+	in := make(chan int)
+	out := notify.Debounce(context.Background(), in, time.Second, s.clock)
+
+	in <- 1
+	s.waitAlarm(c)
+	s.clock.Advance(600 * time.Millisecond)
+	in <- 2
+	s.waitAlarm(c)
+	// The delay was restarted by the second value.
+	s.clock.Advance(600 * time.Millisecond)
+	assertNoReceive(c, out)
+	s.clock.Advance(400 * time.Millisecond)
+	assertReceive(c, out, 2)
+
+	in <- 3
+	s.waitAlarm(c)
+	close(in)
+	assertReceive(c, out, 3)
+	assertClosed(c, out)
+}
+
+func (s *notifySuite) TestThrottle(c *gc.C) {
+	in := make(chan int)
+	out := notify.Throttle(context.Background(), in, time.Second, s.clock)
+
+	in <- 1
+	assertReceive(c, out, 1)
+	s.waitAlarm(c)
+	in <- 2
+	in <- 3
+	assertNoReceive(c, out)
+	s.clock.Advance(time.Second)
+	assertReceive(c, out, 3)
+	s.waitAlarm(c)
+
+	// Nothing arrives during this interval, so the next
+	// value after it is sent straight away.
+	s.clock.Advance(time.Second)
+	in <- 4
+	assertReceive(c, out, 4)
+	s.waitAlarm(c)
+	close(in)
+	assertClosed(c, out)
+}
+
+func (s *notifySuite) TestCoalesce(c *gc.C) {
+	in := make(chan int)
+	out := notify.Coalesce(context.Background(), in)
+
+	// Sending never blocks, even though nothing is receiving.
+	for i := 1; i <= 3; i++ {
+		select {
+		case in <- i:
+		case <-time.After(testing.LongWait):
+			c.Fatalf("send blocked")
+		}
+	}
+	assertReceive(c, out, 3)
+	assertNoReceive(c, out)
+
+	in <- 4
+	close(in)
+	assertReceive(c, out, 4)
+	assertClosed(c, out)
+}
+
+func (s *notifySuite) TestBatchMaxSize(c *gc.C) {
+	in := make(chan int)
+	out := notify.Batch(context.Background(), in, 3, time.Second, s.clock)
+
+	in <- 1
+	s.waitAlarm(c)
+	in <- 2
+	in <- 3
+	assertReceiveBatch(c, out, 1, 2, 3)
+
+	// The delay starts again with the next batch.
+	in <- 4
+	s.waitAlarm(c)
+	close(in)
+	assertReceiveBatch(c, out, 4)
+	assertClosed(c, out)
+}
+
+func (s *notifySuite) TestBatchMaxDelay(c *gc.C) {
+	in := make(chan int)
+	out := notify.Batch(context.Background(), in, 10, time.Second, s.clock)
+
+	in <- 1
+	s.waitAlarm(c)
+	s.clock.Advance(600 * time.Millisecond)
+	in <- 2
+	// Unlike Debounce, later values do not restart the delay.
+	s.clock.Advance(400 * time.Millisecond)
+	assertReceiveBatch(c, out, 1, 2)
+
+	in <- 3
+	s.waitAlarm(c)
+	s.clock.Advance(time.Second)
+	assertReceiveBatch(c, out, 3)
+}
+
+func (s *notifySuite) TestBatchSlowReceiver(c *gc.C) {
+	in := make(chan int)
+	out := notify.Batch(context.Background(), in, 3, time.Second, s.clock)
+
+	in <- 1
+	s.waitAlarm(c)
+	s.clock.Advance(time.Second)
+	// The batch is due, but values are still added
+	// to it until it is received or full.
+	in <- 2
+	in <- 3
+	select {
+	case in <- 4:
+		c.Fatalf("value accepted into full batch")
+	case <-time.After(testing.ShortWait):
+	}
+	assertReceiveBatch(c, out, 1, 2, 3)
+}
+
+func (s *notifySuite) TestContextDone(c *gc.C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan int)
+	debounced := notify.Debounce(ctx, in, time.Second, s.clock)
+	throttled := notify.Throttle(ctx, in, time.Second, s.clock)
+	coalesced := notify.Coalesce(ctx, in)
+	batched := notify.Batch(ctx, in, 10, time.Second, s.clock)
+	cancel()
+	assertClosed(c, debounced)
+	assertClosed(c, throttled)
+	assertClosed(c, coalesced)
+	assertClosed(c, batched)
+}
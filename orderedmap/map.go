@@ -0,0 +1,208 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package orderedmap provides map types that remember the order in
+// which keys were inserted, so that iteration and serialisation are
+// deterministic.
+package orderedmap
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// entry holds a key and value in a Map. Entries form a doubly
+// linked list in insertion order.
+type entry[K comparable, V any] struct {
+	key        K
+	value      V
+	prev, next *entry[K, V]
+}
+
+// Map is a map that iterates over its keys in the order in which they
+// were first inserted. The zero value is an empty map ready to use.
+//
+// A Map is not safe for concurrent use.
+type Map[K comparable, V any] struct {
+	entries     map[K]*entry[K, V]
+	first, last *entry[K, V]
+}
+
+// New returns a new, empty, Map.
+func New[K comparable, V any]() *Map[K, V] {
+	return &Map[K, V]{}
+}
+
+// Len returns the number of keys in the map.
+func (m *Map[K, V]) Len() int {
+	return len(m.entries)
+}
+
+// Get returns the value for key and whether it was found.
+func (m *Map[K, V]) Get(key K) (V, bool) {
+	if e, ok := m.entries[key]; ok {
+		return e.value, true
+	}
+	var zero V
+	return zero, false
+}
+
+// Set sets the value for key. If the key is already present,
+// it keeps its position; otherwise it is added at the end.
+func (m *Map[K, V]) Set(key K, value V) {
+	if e, ok := m.entries[key]; ok {
+		e.value = value
+		return
+	}
+	if m.entries == nil {
+		m.entries = make(map[K]*entry[K, V])
+	}
+	e := &entry[K, V]{key: key, value: value, prev: m.last}
+	if m.last != nil {
+		m.last.next = e
+	} else {
+		m.first = e
+	}
+	m.last = e
+	m.entries[key] = e
+}
+
+// Delete removes key from the map, reporting whether it was present.
+func (m *Map[K, V]) Delete(key K) bool {
+	e, ok := m.entries[key]
+	if !ok {
+		return false
+	}
+	if e.prev != nil {
+		e.prev.next = e.next
+	} else {
+		m.first = e.next
+	}
+	if e.next != nil {
+		e.next.prev = e.prev
+	} else {
+		m.last = e.prev
+	}
+	delete(m.entries, key)
+	return true
+}
+
+// Keys returns the keys in insertion order.
+func (m *Map[K, V]) Keys() []K {
+	keys := make([]K, 0, len(m.entries))
+	for e := m.first; e != nil; e = e.next {
+		keys = append(keys, e.key)
+	}
+	return keys
+}
+
+// Values returns the values in the insertion order of their keys.
+func (m *Map[K, V]) Values() []V {
+	values := make([]V, 0, len(m.entries))
+	for e := m.first; e != nil; e = e.next {
+		values = append(values, e.value)
+	}
+	return values
+}
+
+// Range calls f for each key and value in insertion order,
+// stopping if f returns false. The map must not be modified
+// during the iteration.
+func (m *Map[K, V]) Range(f func(key K, value V) bool) {
+	for e := m.first; e != nil; e = e.next {
+		if !f(e.key, e.value) {
+			return
+		}
+	}
+}
+
+// MarshalJSON implements json.Marshaler. The map is marshalled as a
+// JSON object with its keys in insertion order. Keys are marshalled as
+// strings if they marshal to JSON strings, and otherwise as the
+// string form of their JSON encoding, so integer keys are supported.
+// It has a value receiver so that a Map held by value is marshalled
+// correctly.
+func (m Map[K, V]) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for e := m.first; e != nil; e = e.next {
+		if e != m.first {
+			buf.WriteByte(',')
+		}
+		key, err := marshalKey(e.key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		value, err := json.Marshal(e.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func marshalKey(key interface{}) ([]byte, error) {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > 0 && data[0] == '"' {
+		return data, nil
+	}
+	if len(data) > 0 && (data[0] == '{' || data[0] == '[') {
+		return nil, fmt.Errorf("cannot use %s as a JSON object key", data)
+	}
+	return json.Marshal(string(data))
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It accepts a JSON object
+// and adds its members to the map in the order in which they appear.
+func (m *Map[K, V]) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		return nil
+	}
+	if tok != json.Delim('{') {
+		return fmt.Errorf("cannot unmarshal %v into ordered map", tok)
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		var key K
+		if err := unmarshalKey(tok.(string), &key); err != nil {
+			return err
+		}
+		var value V
+		if err := dec.Decode(&value); err != nil {
+			return err
+		}
+		m.Set(key, value)
+	}
+	_, err = dec.Token()
+	return err
+}
+
+func unmarshalKey(s string, key interface{}) error {
+	quoted, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(quoted, key); err == nil {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(s), key); err != nil {
+		return fmt.Errorf("cannot unmarshal object key %q: %v", s, err)
+	}
+	return nil
+}
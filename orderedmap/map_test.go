@@ -0,0 +1,144 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package orderedmap_test
+
+import (
+	"encoding/json"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/orderedmap"
+)
+
+type mapSuite struct{}
+
+var _ = gc.Suite(&mapSuite{})
+
+func (mapSuite) TestSetGetDelete(c *gc.C) {
+	m := orderedmap.New[string, int]()
+	m.Set("c", 1)
+	m.Set("a", 2)
+	m.Set("b", 3)
+	m.Set("a", 4)
+	c.Check(m.Len(), gc.Equals, 3)
+	c.Check(m.Keys(), jc.DeepEquals, []string{"c", "a", "b"})
+	c.Check(m.Values(), jc.DeepEquals, []int{1, 4, 3})
+
+	v, ok := m.Get("a")
+	c.Check(ok, jc.IsTrue)
+	c.Check(v, gc.Equals, 4)
+	_, ok = m.Get("z")
+	c.Check(ok, jc.IsFalse)
+
+	c.Check(m.Delete("c"), jc.IsTrue)
+	c.Check(m.Delete("c"), jc.IsFalse)
+	c.Check(m.Delete("b"), jc.IsTrue)
+	m.Set("c", 5)
+	c.Check(m.Keys(), jc.DeepEquals, []string{"a", "c"})
+}
+
+func (mapSuite) TestZeroValue(c *gc.C) {
+	var m orderedmap.Map[int, string]
+	c.Check(m.Len(), gc.Equals, 0)
+	c.Check(m.Delete(1), jc.IsFalse)
+	m.Set(1, "one")
+	c.Check(m.Keys(), jc.DeepEquals, []int{1})
+}
+
+func (mapSuite) TestRange(c *gc.C) {
+	m := orderedmap.New[string, int]()
+	for i, k := range []string{"x", "y", "z"} {
+		m.Set(k, i)
+	}
+	var keys []string
+	m.Range(func(k string, v int) bool {
+		keys = append(keys, k)
+		return v < 1
+	})
+	c.Check(keys, jc.DeepEquals, []string{"x", "y"})
+}
+
+func (mapSuite) TestJSON(c *gc.C) {
+	m := orderedmap.New[string, int]()
+	m.Set("zebra", 1)
+	m.Set("apple", 2)
+	data, err := json.Marshal(m)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(data), gc.Equals, `{"zebra":1,"apple":2}`)
+
+	var doc struct {
+		M orderedmap.Map[string, int] `json:"m"`
+	}
+	err = json.Unmarshal([]byte(`{"m":{"b":1,"a":2,"c":3}}`), &doc)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(doc.M.Keys(), jc.DeepEquals, []string{"b", "a", "c"})
+
+	// Maps held by value are marshalled in order too.
+	data, err = json.Marshal(doc)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(data), gc.Equals, `{"m":{"b":1,"a":2,"c":3}}`)
+}
+
+func (mapSuite) TestJSONIntKeys(c *gc.C) {
+	m := orderedmap.New[int, string]()
+	m.Set(10, "ten")
+	m.Set(2, "two")
+	data, err := json.Marshal(m)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(data), gc.Equals, `{"10":"ten","2":"two"}`)
+
+	m2 := orderedmap.New[int, string]()
+	err = json.Unmarshal(data, m2)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(m2.Keys(), jc.DeepEquals, []int{10, 2})
+
+	err = json.Unmarshal([]byte(`{"x":"y"}`), m2)
+	c.Check(err, gc.ErrorMatches, `cannot unmarshal object key "x": .*`)
+}
+
+func (mapSuite) TestJSONNotObject(c *gc.C) {
+	m := orderedmap.New[string, int]()
+	err := json.Unmarshal([]byte(`[1]`), m)
+	c.Check(err, gc.ErrorMatches, `cannot unmarshal \[ into ordered map`)
+	err = json.Unmarshal([]byte(`null`), m)
+	c.Check(err, jc.ErrorIsNil)
+}
+
+type multiMapSuite struct{}
+
+var _ = gc.Suite(&multiMapSuite{})
+
+func (multiMapSuite) TestAddGet(c *gc.C) {
+	m := orderedmap.NewMultiMap[string, string]()
+	m.Add("b", "1")
+	m.Add("a", "2", "3")
+	m.Add("b", "4")
+	c.Check(m.Len(), gc.Equals, 2)
+	c.Check(m.Keys(), jc.DeepEquals, []string{"b", "a"})
+	c.Check(m.Get("b"), jc.DeepEquals, []string{"1", "4"})
+	c.Check(m.Get("z"), gc.IsNil)
+
+	m.Set("a", "5")
+	c.Check(m.Get("a"), jc.DeepEquals, []string{"5"})
+	m.Set("a")
+	c.Check(m.Keys(), jc.DeepEquals, []string{"b"})
+	c.Check(m.Delete("b"), jc.IsTrue)
+	c.Check(m.Len(), gc.Equals, 0)
+}
+
+func (multiMapSuite) TestJSON(c *gc.C) {
+	var m orderedmap.MultiMap[string, int]
+	m.Add("y", 1, 2)
+	m.Add("x", 3)
+	data, err := json.Marshal(m)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(data), gc.Equals, `{"y":[1,2],"x":[3]}`)
+
+	m2 := orderedmap.NewMultiMap[string, int]()
+	err = json.Unmarshal(data, m2)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(m2.Keys(), jc.DeepEquals, []string{"y", "x"})
+	c.Check(m2.Get("y"), jc.DeepEquals, []int{1, 2})
+}
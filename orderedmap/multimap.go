@@ -0,0 +1,86 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package orderedmap
+
+// MultiMap is a map from each key to any number of values. Keys are
+// iterated in the order in which they were first added, and each key's
+// values in the order in which they were added. The zero value is an
+// empty MultiMap ready to use.
+//
+// A MultiMap is not safe for concurrent use.
+type MultiMap[K comparable, V any] struct {
+	m Map[K, []V]
+}
+
+// NewMultiMap returns a new, empty, MultiMap.
+func NewMultiMap[K comparable, V any]() *MultiMap[K, V] {
+	return &MultiMap[K, V]{}
+}
+
+// Len returns the number of keys in the map.
+func (m *MultiMap[K, V]) Len() int {
+	return m.m.Len()
+}
+
+// Add appends the given values to those held for key.
+func (m *MultiMap[K, V]) Add(key K, values ...V) {
+	old, _ := m.m.Get(key)
+	m.m.Set(key, append(old, values...))
+}
+
+// Get returns the values held for key,
+// or nil if there are none.
+func (m *MultiMap[K, V]) Get(key K) []V {
+	values, _ := m.m.Get(key)
+	return values
+}
+
+// Set replaces the values held for key. If values is empty,
+// the key is removed.
+func (m *MultiMap[K, V]) Set(key K, values ...V) {
+	if len(values) == 0 {
+		m.m.Delete(key)
+		return
+	}
+	m.m.Set(key, append([]V(nil), values...))
+}
+
+// Delete removes key and all its values from the map,
+// reporting whether it was present.
+func (m *MultiMap[K, V]) Delete(key K) bool {
+	return m.m.Delete(key)
+}
+
+// Keys returns the keys in insertion order.
+func (m *MultiMap[K, V]) Keys() []K {
+	return m.m.Keys()
+}
+
+// Range calls f for each key and its values in insertion order,
+// stopping if f returns false. The map must not be modified
+// during the iteration.
+func (m *MultiMap[K, V]) Range(f func(key K, values []V) bool) {
+	m.m.Range(f)
+}
+
+// MarshalJSON implements json.Marshaler. The map is marshalled
+// as a JSON object holding an array of values for each key,
+// with the keys in insertion order.
+func (m MultiMap[K, V]) MarshalJSON() ([]byte, error) {
+	return m.m.MarshalJSON()
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It accepts
+// a JSON object holding an array of values for each key.
+func (m *MultiMap[K, V]) UnmarshalJSON(data []byte) error {
+	var mm Map[K, []V]
+	if err := mm.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	mm.Range(func(key K, values []V) bool {
+		m.Add(key, values...)
+		return true
+	})
+	return nil
+}
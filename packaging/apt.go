@@ -0,0 +1,87 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package packaging
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/juju/errors"
+
+	"github.com/juju/utils/v3"
+	"github.com/juju/utils/v3/shell"
+)
+
+const (
+	aptGet      = "DEBIAN_FRONTEND=noninteractive apt-get --assume-yes --quiet --option=Dpkg::Options::=--force-confold"
+	aptKeyrings = "/etc/apt/keyrings"
+	aptSources  = "/etc/apt/sources.list.d"
+)
+
+// Apt renders commands for the apt package manager
+// used by Debian and Ubuntu.
+type Apt struct{}
+
+// Name implements PackageManager.
+func (*Apt) Name() string {
+	return "apt"
+}
+
+// Update implements PackageManager.
+func (*Apt) Update() []string {
+	return []string{aptGet + " update"}
+}
+
+// Install implements PackageManager.
+func (*Apt) Install(packages ...string) []string {
+	return []string{aptGet + " install " + quoteAll(packages)}
+}
+
+// Remove implements PackageManager.
+func (*Apt) Remove(packages ...string) []string {
+	return []string{aptGet + " remove " + quoteAll(packages)}
+}
+
+// IsInstalled implements PackageManager.
+func (*Apt) IsInstalled(pkg string) string {
+	return fmt.Sprintf("dpkg-query --show --showformat='${Status}' %s 2>/dev/null | grep -q 'install ok installed'", utils.ShQuote(pkg))
+}
+
+// AddRepository implements PackageManager. The repository's Suite
+// must be set. Its key, if any, is stored in its own keyring under
+// /etc/apt/keyrings and trusted for that repository only.
+func (*Apt) AddRepository(repo Repository) ([]string, error) {
+	if err := repo.validate(); err != nil {
+		return nil, err
+	}
+	if repo.Suite == "" {
+		return nil, errors.NotValidf("apt repository %q without suite", repo.Name)
+	}
+	var cmds []string
+	line := "deb "
+	if repo.hasKey() {
+		keyring := fmt.Sprintf("%s/%s.gpg", aptKeyrings, repo.Name)
+		cmds = append(cmds, "mkdir -p "+aptKeyrings)
+		if repo.Key != "" {
+			cmds = append(cmds, fmt.Sprintf("printf '%%s\\n' %s | gpg --batch --yes --dearmor -o %s", utils.ShQuote(repo.Key), utils.ShQuote(keyring)))
+		} else {
+			cmds = append(cmds, fmt.Sprintf("curl -fsSL %s | gpg --batch --yes --dearmor -o %s", utils.ShQuote(repo.KeyURL), utils.ShQuote(keyring)))
+		}
+		line += fmt.Sprintf("[signed-by=%s] ", keyring)
+	}
+	line += strings.Join(append([]string{repo.URL, repo.Suite}, repo.Components...), " ")
+	var bash shell.BashRenderer
+	cmds = append(cmds, bash.WriteFile(fmt.Sprintf("%s/%s.list", aptSources, repo.Name), []byte(line))...)
+	return cmds, nil
+}
+
+// quoteAll returns the given strings, quoted
+// for bash and separated by spaces.
+func quoteAll(ss []string) string {
+	quoted := make([]string, len(ss))
+	for i, s := range ss {
+		quoted[i] = utils.ShQuote(s)
+	}
+	return strings.Join(quoted, " ")
+}
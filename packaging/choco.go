@@ -0,0 +1,68 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package packaging
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/juju/errors"
+
+	"github.com/juju/utils/v3"
+)
+
+// Choco renders PowerShell commands for the Chocolatey
+// package manager used on Windows.
+type Choco struct{}
+
+// Name implements PackageManager.
+func (*Choco) Name() string {
+	return "choco"
+}
+
+// Update implements PackageManager. Chocolatey has no
+// local package index, so no commands are returned.
+func (*Choco) Update() []string {
+	return nil
+}
+
+// Install implements PackageManager.
+func (*Choco) Install(packages ...string) []string {
+	return []string{"choco install --yes --no-progress " + psQuoteAll(packages)}
+}
+
+// Remove implements PackageManager.
+func (*Choco) Remove(packages ...string) []string {
+	return []string{"choco uninstall --yes " + psQuoteAll(packages)}
+}
+
+// IsInstalled implements PackageManager.
+func (*Choco) IsInstalled(pkg string) string {
+	return fmt.Sprintf("if (-not (choco list --local-only --exact --limit-output %s)) { exit 1 }", utils.WinPSQuote(pkg))
+}
+
+// AddRepository implements PackageManager. Chocolatey verifies
+// packages by checksum rather than by key, so repositories with
+// keys are not supported.
+func (*Choco) AddRepository(repo Repository) ([]string, error) {
+	if err := repo.validate(); err != nil {
+		return nil, err
+	}
+	if repo.hasKey() {
+		return nil, errors.NotSupportedf("chocolatey repository keys")
+	}
+	return []string{
+		fmt.Sprintf("choco source add --name=%s --source=%s", utils.WinPSQuote(repo.Name), utils.WinPSQuote(repo.URL)),
+	}, nil
+}
+
+// psQuoteAll returns the given strings, quoted
+// for PowerShell and separated by spaces.
+func psQuoteAll(ss []string) string {
+	quoted := make([]string, len(ss))
+	for i, s := range ss {
+		quoted[i] = utils.WinPSQuote(s)
+	}
+	return strings.Join(quoted, " ")
+}
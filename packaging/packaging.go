@@ -0,0 +1,165 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package packaging renders the shell commands that drive the package
+// managers of various platforms, so that script generators can install
+// software without knowing which package manager a machine uses.
+package packaging
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/juju/errors"
+
+	"github.com/juju/utils/v3/series"
+)
+
+// PackageManager renders commands for a package manager. Each method
+// returns commands to be run in order, in the shell used by the
+// platform of the package manager (bash, or PowerShell for Chocolatey).
+type PackageManager interface {
+	// Name returns the name of the package manager,
+	// such as "apt" or "dnf".
+	Name() string
+
+	// Update returns commands that refresh the package manager's
+	// index of available packages. It returns no commands if the
+	// package manager has no such index.
+	Update() []string
+
+	// Install returns commands that install the given packages.
+	Install(packages ...string) []string
+
+	// Remove returns commands that remove the given packages.
+	Remove(packages ...string) []string
+
+	// IsInstalled returns a command that succeeds if
+	// the given package is installed and fails otherwise.
+	IsInstalled(pkg string) string
+
+	// AddRepository returns commands that add the given repository,
+	// and import its signing key if it has one. It returns an error
+	// satisfying errors.IsNotValid if the repository lacks details
+	// required by the package manager, or errors.IsNotSupported if
+	// the package manager does not support the repository's options.
+	AddRepository(repo Repository) ([]string, error)
+}
+
+// Repository describes a package repository.
+type Repository struct {
+	// Name identifies the repository. It is used to name the files
+	// that describe the repository and hold its key, so it must be
+	// a simple name such as "docker", made of letters, digits, dots,
+	// underscores and hyphens.
+	Name string
+
+	// URL holds the location of the repository.
+	URL string
+
+	// Suite holds the distribution suite of an apt
+	// repository, such as "jammy" or "stable".
+	Suite string
+
+	// Components holds the components of an apt
+	// repository, such as "main".
+	Components []string
+
+	// Key holds the ASCII-armored public key used to
+	// verify the repository's packages, if any.
+	Key string
+
+	// KeyURL holds the location of the key used to verify the
+	// repository's packages, if any. It is ignored if Key is set.
+	KeyURL string
+}
+
+var validRepositoryName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// validate checks that the repository's details can be written into
+// commands and configuration files without changing their meaning.
+func (r Repository) validate() error {
+	if r.Name == "" {
+		return errors.NotValidf("repository without name")
+	}
+	if !validRepositoryName.MatchString(r.Name) {
+		return errors.NotValidf("repository name %q", r.Name)
+	}
+	if r.URL == "" {
+		return errors.NotValidf("repository %q without URL", r.Name)
+	}
+	type field struct {
+		name, value string
+	}
+	fields := []field{
+		{"URL", r.URL},
+		{"suite", r.Suite},
+		{"key URL", r.KeyURL},
+	}
+	for _, c := range r.Components {
+		fields = append(fields, field{"component", c})
+	}
+	for _, f := range fields {
+		if strings.IndexFunc(f.value, isSpaceOrControl) >= 0 {
+			return errors.NotValidf("repository %q %s %q", r.Name, f.name, f.value)
+		}
+	}
+	return nil
+}
+
+func isSpaceOrControl(r rune) bool {
+	return unicode.IsSpace(r) || unicode.IsControl(r)
+}
+
+func (r Repository) hasKey() bool {
+	return r.Key != "" || r.KeyURL != ""
+}
+
+// New returns the package manager with the given name: one of "apt",
+// "dnf", "yum", "zypper", "snap" or "choco".
+func New(name string) (PackageManager, error) {
+	switch strings.ToLower(name) {
+	case "apt", "apt-get":
+		return &Apt{}, nil
+	case "dnf":
+		return &Yum{Command: "dnf"}, nil
+	case "yum":
+		return &Yum{Command: "yum"}, nil
+	case "zypper":
+		return &Zypper{}, nil
+	case "snap":
+		return &Snap{}, nil
+	case "choco", "chocolatey":
+		return &Choco{}, nil
+	}
+	return nil, errors.NotFoundf("package manager %q", name)
+}
+
+// ForBase returns the native package manager for the given base.
+func ForBase(b series.Base) (PackageManager, error) {
+	switch b.OS {
+	case series.Ubuntu, "debian":
+		return &Apt{}, nil
+	case series.CentOS, "rhel":
+		if major(b.Channel) < 8 {
+			return &Yum{Command: "yum"}, nil
+		}
+		return &Yum{Command: "dnf"}, nil
+	case "fedora", "rocky", "almalinux":
+		return &Yum{Command: "dnf"}, nil
+	case "opensuse", "opensuse-leap", "opensuse-tumbleweed", "sles":
+		return &Zypper{}, nil
+	case series.Windows:
+		return &Choco{}, nil
+	}
+	return nil, errors.NotFoundf("package manager for %s", b)
+}
+
+// major returns the major version of a channel,
+// or zero if it has none.
+func major(channel string) int {
+	n, _ := strconv.Atoi(strings.SplitN(channel, ".", 2)[0])
+	return n
+}
@@ -0,0 +1,254 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package packaging_test
+
+import (
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/packaging"
+	"github.com/juju/utils/v3/series"
+)
+
+type packagingSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&packagingSuite{})
+
+var forBaseTests = []struct {
+	base   series.Base
+	expect string
+}{
+	{series.Base{OS: "ubuntu", Channel: "22.04"}, "apt"},
+	{series.Base{OS: "debian", Channel: "11"}, "apt"},
+	{series.Base{OS: "centos", Channel: "7"}, "yum"},
+	{series.Base{OS: "centos", Channel: "8"}, "dnf"},
+	{series.Base{OS: "rhel", Channel: "9.1"}, "dnf"},
+	{series.Base{OS: "fedora", Channel: "37"}, "dnf"},
+	{series.Base{OS: "opensuse-leap", Channel: "15.4"}, "zypper"},
+	{series.Base{OS: "windows", Channel: "10"}, "choco"},
+}
+
+func (s *packagingSuite) TestForBase(c *gc.C) {
+	for i, test := range forBaseTests {
+		c.Logf("test %d: %s", i, test.base)
+		pm, err := packaging.ForBase(test.base)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(pm.Name(), gc.Equals, test.expect)
+	}
+}
+
+func (s *packagingSuite) TestForBaseUnknown(c *gc.C) {
+	_, err := packaging.ForBase(series.Base{OS: "plan9", Channel: "4"})
+	c.Check(err, jc.Satisfies, errors.IsNotFound)
+}
+
+func (s *packagingSuite) TestNew(c *gc.C) {
+	for _, name := range []string{"apt", "dnf", "yum", "zypper", "snap", "choco"} {
+		pm, err := packaging.New(name)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(pm.Name(), gc.Equals, name)
+	}
+	_, err := packaging.New("pacman")
+	c.Check(err, jc.Satisfies, errors.IsNotFound)
+}
+
+var commandTests = []struct {
+	pm          packaging.PackageManager
+	update      []string
+	install     []string
+	remove      []string
+	isInstalled string
+}{{
+	pm:          &packaging.Apt{},
+	update:      []string{"DEBIAN_FRONTEND=noninteractive apt-get --assume-yes --quiet --option=Dpkg::Options::=--force-confold update"},
+	install:     []string{"DEBIAN_FRONTEND=noninteractive apt-get --assume-yes --quiet --option=Dpkg::Options::=--force-confold install 'curl' 'lxd client'"},
+	remove:      []string{"DEBIAN_FRONTEND=noninteractive apt-get --assume-yes --quiet --option=Dpkg::Options::=--force-confold remove 'curl' 'lxd client'"},
+	isInstalled: "dpkg-query --show --showformat='${Status}' 'curl' 2>/dev/null | grep -q 'install ok installed'",
+}, {
+	pm:          &packaging.Yum{Command: "yum"},
+	update:      []string{"yum --assumeyes makecache"},
+	install:     []string{"yum --assumeyes install 'curl' 'lxd client'"},
+	remove:      []string{"yum --assumeyes remove 'curl' 'lxd client'"},
+	isInstalled: "rpm --query --quiet 'curl'",
+}, {
+	pm:          &packaging.Yum{},
+	update:      []string{"dnf --assumeyes makecache"},
+	install:     []string{"dnf --assumeyes install 'curl' 'lxd client'"},
+	remove:      []string{"dnf --assumeyes remove 'curl' 'lxd client'"},
+	isInstalled: "rpm --query --quiet 'curl'",
+}, {
+	pm:          &packaging.Zypper{},
+	update:      []string{"zypper --non-interactive refresh"},
+	install:     []string{"zypper --non-interactive install 'curl' 'lxd client'"},
+	remove:      []string{"zypper --non-interactive remove 'curl' 'lxd client'"},
+	isInstalled: "rpm --query --quiet 'curl'",
+}, {
+	pm:          &packaging.Snap{},
+	install:     []string{"snap install 'curl' 'lxd client'"},
+	remove:      []string{"snap remove 'curl' 'lxd client'"},
+	isInstalled: "snap list 'curl' >/dev/null 2>&1",
+}, {
+	pm: &packaging.Snap{Channel: "latest/edge", Classic: true},
+	install: []string{
+		"snap install --channel='latest/edge' --classic 'curl'",
+		"snap install --channel='latest/edge' --classic 'lxd client'",
+	},
+	remove:      []string{"snap remove 'curl' 'lxd client'"},
+	isInstalled: "snap list 'curl' >/dev/null 2>&1",
+}, {
+	pm:          &packaging.Choco{},
+	install:     []string{"choco install --yes --no-progress 'curl' 'lxd client'"},
+	remove:      []string{"choco uninstall --yes 'curl' 'lxd client'"},
+	isInstalled: "if (-not (choco list --local-only --exact --limit-output 'curl')) { exit 1 }",
+}}
+
+func (s *packagingSuite) TestCommands(c *gc.C) {
+	for i, test := range commandTests {
+		c.Logf("test %d: %s", i, test.pm.Name())
+		c.Check(test.pm.Update(), jc.DeepEquals, test.update)
+		c.Check(test.pm.Install("curl", "lxd client"), jc.DeepEquals, test.install)
+		c.Check(test.pm.Remove("curl", "lxd client"), jc.DeepEquals, test.remove)
+		c.Check(test.pm.IsInstalled("curl"), gc.Equals, test.isInstalled)
+	}
+}
+
+func (s *packagingSuite) TestAptAddRepository(c *gc.C) {
+	cmds, err := (&packaging.Apt{}).AddRepository(packaging.Repository{
+		Name:       "docker",
+		URL:        "https://download.docker.com/linux/ubuntu",
+		Suite:      "jammy",
+		Components: []string{"stable"},
+		KeyURL:     "https://download.docker.com/linux/ubuntu/gpg",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(cmds, jc.DeepEquals, []string{
+		"mkdir -p /etc/apt/keyrings",
+		"curl -fsSL 'https://download.docker.com/linux/ubuntu/gpg' | gpg --batch --yes --dearmor -o '/etc/apt/keyrings/docker.gpg'",
+		"cat > '/etc/apt/sources.list.d/docker.list' << 'EOF'\n" +
+			"deb [signed-by=/etc/apt/keyrings/docker.gpg] https://download.docker.com/linux/ubuntu jammy stable\n" +
+			"EOF",
+	})
+}
+
+func (s *packagingSuite) TestAptAddRepositoryInlineKey(c *gc.C) {
+	cmds, err := (&packaging.Apt{}).AddRepository(packaging.Repository{
+		Name:  "local",
+		URL:   "http://archive.internal/ubuntu",
+		Suite: "./",
+		Key:   "-----BEGIN PGP PUBLIC KEY BLOCK-----",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(cmds, jc.DeepEquals, []string{
+		"mkdir -p /etc/apt/keyrings",
+		"printf '%s\\n' '-----BEGIN PGP PUBLIC KEY BLOCK-----' | gpg --batch --yes --dearmor -o '/etc/apt/keyrings/local.gpg'",
+		"cat > '/etc/apt/sources.list.d/local.list' << 'EOF'\n" +
+			"deb [signed-by=/etc/apt/keyrings/local.gpg] http://archive.internal/ubuntu ./\n" +
+			"EOF",
+	})
+}
+
+func (s *packagingSuite) TestAptAddRepositoryWithoutSuite(c *gc.C) {
+	_, err := (&packaging.Apt{}).AddRepository(packaging.Repository{
+		Name: "docker",
+		URL:  "https://download.docker.com/linux/ubuntu",
+	})
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+}
+
+func (s *packagingSuite) TestYumAddRepository(c *gc.C) {
+	cmds, err := (&packaging.Yum{}).AddRepository(packaging.Repository{
+		Name:   "docker",
+		URL:    "https://download.docker.com/linux/centos/$releasever/$basearch/stable",
+		KeyURL: "https://download.docker.com/linux/centos/gpg",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(cmds, jc.DeepEquals, []string{
+		"rpm --import 'https://download.docker.com/linux/centos/gpg'",
+		"cat > '/etc/yum.repos.d/docker.repo' << 'EOF'\n" +
+			"[docker]\n" +
+			"name=docker\n" +
+			"baseurl=https://download.docker.com/linux/centos/$releasever/$basearch/stable\n" +
+			"enabled=1\n" +
+			"gpgcheck=1\n" +
+			"gpgkey=https://download.docker.com/linux/centos/gpg\n" +
+			"EOF",
+	})
+}
+
+func (s *packagingSuite) TestYumAddRepositoryInlineKey(c *gc.C) {
+	cmds, err := (&packaging.Yum{}).AddRepository(packaging.Repository{
+		Name: "local",
+		URL:  "http://archive.internal/el9",
+		Key:  "KEY",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(cmds, jc.DeepEquals, []string{
+		"mkdir -p /etc/pki/rpm-gpg",
+		"cat > '/etc/pki/rpm-gpg/RPM-GPG-KEY-local' << 'EOF'\nKEY\nEOF",
+		"rpm --import '/etc/pki/rpm-gpg/RPM-GPG-KEY-local'",
+		"cat > '/etc/yum.repos.d/local.repo' << 'EOF'\n" +
+			"[local]\n" +
+			"name=local\n" +
+			"baseurl=http://archive.internal/el9\n" +
+			"enabled=1\n" +
+			"gpgcheck=1\n" +
+			"gpgkey=file:///etc/pki/rpm-gpg/RPM-GPG-KEY-local\n" +
+			"EOF",
+	})
+}
+
+func (s *packagingSuite) TestZypperAddRepository(c *gc.C) {
+	cmds, err := (&packaging.Zypper{}).AddRepository(packaging.Repository{
+		Name: "local",
+		URL:  "http://archive.internal/leap",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(cmds, jc.DeepEquals, []string{
+		"zypper --non-interactive addrepo --refresh --no-gpgcheck 'http://archive.internal/leap' 'local'",
+	})
+}
+
+func (s *packagingSuite) TestChocoAddRepository(c *gc.C) {
+	cmds, err := (&packaging.Choco{}).AddRepository(packaging.Repository{
+		Name: "internal",
+		URL:  "https://choco.internal/api/v2",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(cmds, jc.DeepEquals, []string{
+		"choco source add --name='internal' --source='https://choco.internal/api/v2'",
+	})
+
+	_, err = (&packaging.Choco{}).AddRepository(packaging.Repository{
+		Name:   "internal",
+		URL:    "https://choco.internal/api/v2",
+		KeyURL: "https://choco.internal/key",
+	})
+	c.Check(err, jc.Satisfies, errors.IsNotSupported)
+}
+
+func (s *packagingSuite) TestSnapAddRepository(c *gc.C) {
+	_, err := (&packaging.Snap{}).AddRepository(packaging.Repository{Name: "x", URL: "y"})
+	c.Check(err, jc.Satisfies, errors.IsNotSupported)
+}
+
+func (s *packagingSuite) TestAddRepositoryInvalid(c *gc.C) {
+	for _, repo := range []packaging.Repository{
+		{URL: "http://example.com"},
+		{Name: "../evil", URL: "http://example.com"},
+		{Name: "x;reboot;", URL: "http://example.com"},
+		{Name: ".hidden", URL: "http://example.com"},
+		{Name: "nourl"},
+		{Name: "x", URL: "http://e.com\ndeb http://evil.example stable main"},
+		{Name: "x", URL: "http://e.com", Suite: "stable main"},
+		{Name: "x", URL: "http://e.com", Suite: "stable", Components: []string{"main\x00"}},
+		{Name: "x", URL: "http://e.com", KeyURL: "http://e.com/key\rgpgkey=x"},
+	} {
+		_, err := (&packaging.Yum{}).AddRepository(repo)
+		c.Check(err, jc.Satisfies, errors.IsNotValid)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package packaging
+
+import (
+	"fmt"
+
+	"github.com/juju/errors"
+
+	"github.com/juju/utils/v3"
+)
+
+// Snap renders commands for snapd.
+type Snap struct {
+	// Channel, if set, holds the channel from which
+	// snaps are installed, such as "latest/stable".
+	Channel string
+
+	// Classic, if true, installs snaps with classic confinement.
+	Classic bool
+}
+
+// Name implements PackageManager.
+func (*Snap) Name() string {
+	return "snap"
+}
+
+// Update implements PackageManager. Snapd keeps its
+// own index up to date, so no commands are returned.
+func (*Snap) Update() []string {
+	return nil
+}
+
+// Install implements PackageManager.
+func (s *Snap) Install(packages ...string) []string {
+	cmd := "snap install"
+	if s.Channel != "" {
+		cmd += " --channel=" + utils.ShQuote(s.Channel)
+	}
+	if s.Classic {
+		cmd += " --classic"
+	}
+	if s.Channel == "" && !s.Classic {
+		// Snaps may all be installed in one go only when
+		// no options are given.
+		return []string{cmd + " " + quoteAll(packages)}
+	}
+	cmds := make([]string, len(packages))
+	for i, pkg := range packages {
+		cmds[i] = cmd + " " + utils.ShQuote(pkg)
+	}
+	return cmds
+}
+
+// Remove implements PackageManager.
+func (*Snap) Remove(packages ...string) []string {
+	return []string{"snap remove " + quoteAll(packages)}
+}
+
+// IsInstalled implements PackageManager.
+func (*Snap) IsInstalled(pkg string) string {
+	return fmt.Sprintf("snap list %s >/dev/null 2>&1", utils.ShQuote(pkg))
+}
+
+// AddRepository implements PackageManager. Snapd
+// does not support additional repositories.
+func (*Snap) AddRepository(repo Repository) ([]string, error) {
+	return nil, errors.NotSupportedf("snap repositories")
+}
@@ -0,0 +1,141 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package packaging
+
+import (
+	"fmt"
+
+	"github.com/juju/utils/v3"
+	"github.com/juju/utils/v3/shell"
+)
+
+const (
+	rpmKeys   = "/etc/pki/rpm-gpg"
+	yumRepos  = "/etc/yum.repos.d"
+	zypperCmd = "zypper --non-interactive"
+)
+
+// Yum renders commands for the yum package manager and its
+// successor dnf, used by CentOS, Fedora and related distributions.
+type Yum struct {
+	// Command holds the command to run: "yum" or "dnf".
+	// If it is empty, "dnf" is used.
+	Command string
+}
+
+func (y *Yum) command() string {
+	if y.Command == "" {
+		return "dnf"
+	}
+	return y.Command
+}
+
+// Name implements PackageManager.
+func (y *Yum) Name() string {
+	return y.command()
+}
+
+// Update implements PackageManager.
+func (y *Yum) Update() []string {
+	return []string{y.command() + " --assumeyes makecache"}
+}
+
+// Install implements PackageManager.
+func (y *Yum) Install(packages ...string) []string {
+	return []string{y.command() + " --assumeyes install " + quoteAll(packages)}
+}
+
+// Remove implements PackageManager.
+func (y *Yum) Remove(packages ...string) []string {
+	return []string{y.command() + " --assumeyes remove " + quoteAll(packages)}
+}
+
+// IsInstalled implements PackageManager.
+func (*Yum) IsInstalled(pkg string) string {
+	return rpmIsInstalled(pkg)
+}
+
+// AddRepository implements PackageManager. The repository is
+// described by a file in /etc/yum.repos.d, and its key, if any,
+// is imported into the RPM database.
+func (y *Yum) AddRepository(repo Repository) ([]string, error) {
+	if err := repo.validate(); err != nil {
+		return nil, err
+	}
+	var cmds []string
+	gpg := "gpgcheck=0"
+	if repo.hasKey() {
+		key, keyCmds := rpmImportKey(repo)
+		cmds = append(cmds, keyCmds...)
+		gpg = fmt.Sprintf("gpgcheck=1\ngpgkey=%s", key)
+	}
+	conf := fmt.Sprintf("[%s]\nname=%s\nbaseurl=%s\nenabled=1\n%s", repo.Name, repo.Name, repo.URL, gpg)
+	var bash shell.BashRenderer
+	cmds = append(cmds, bash.WriteFile(fmt.Sprintf("%s/%s.repo", yumRepos, repo.Name), []byte(conf))...)
+	return cmds, nil
+}
+
+// Zypper renders commands for the zypper package
+// manager used by openSUSE and SLES.
+type Zypper struct{}
+
+// Name implements PackageManager.
+func (*Zypper) Name() string {
+	return "zypper"
+}
+
+// Update implements PackageManager.
+func (*Zypper) Update() []string {
+	return []string{zypperCmd + " refresh"}
+}
+
+// Install implements PackageManager.
+func (*Zypper) Install(packages ...string) []string {
+	return []string{zypperCmd + " install " + quoteAll(packages)}
+}
+
+// Remove implements PackageManager.
+func (*Zypper) Remove(packages ...string) []string {
+	return []string{zypperCmd + " remove " + quoteAll(packages)}
+}
+
+// IsInstalled implements PackageManager.
+func (*Zypper) IsInstalled(pkg string) string {
+	return rpmIsInstalled(pkg)
+}
+
+// AddRepository implements PackageManager. The repository's key,
+// if any, is imported into the RPM database.
+func (*Zypper) AddRepository(repo Repository) ([]string, error) {
+	if err := repo.validate(); err != nil {
+		return nil, err
+	}
+	var cmds []string
+	check := "--no-gpgcheck"
+	if repo.hasKey() {
+		_, keyCmds := rpmImportKey(repo)
+		cmds = append(cmds, keyCmds...)
+		check = "--gpgcheck"
+	}
+	cmds = append(cmds, fmt.Sprintf("%s addrepo --refresh %s %s %s", zypperCmd, check, utils.ShQuote(repo.URL), utils.ShQuote(repo.Name)))
+	return cmds, nil
+}
+
+func rpmIsInstalled(pkg string) string {
+	return fmt.Sprintf("rpm --query --quiet %s", utils.ShQuote(pkg))
+}
+
+// rpmImportKey returns the location of the repository's key, and
+// commands that import it into the RPM database.
+func rpmImportKey(repo Repository) (string, []string) {
+	if repo.Key == "" {
+		return repo.KeyURL, []string{"rpm --import " + utils.ShQuote(repo.KeyURL)}
+	}
+	file := fmt.Sprintf("%s/RPM-GPG-KEY-%s", rpmKeys, repo.Name)
+	var bash shell.BashRenderer
+	cmds := []string{"mkdir -p " + rpmKeys}
+	cmds = append(cmds, bash.WriteFile(file, []byte(repo.Key))...)
+	cmds = append(cmds, "rpm --import "+utils.ShQuote(file))
+	return "file://" + file, cmds
+}
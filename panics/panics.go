@@ -0,0 +1,88 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package panics converts panics in callbacks into errors, so that a
+// bad callback passed to a long-running process, such as a task run in
+// parallel or a function that populates a cache, fails only its own
+// operation rather than crashing the process:
+//
+//	err := panics.Call(task)
+//	if panics.IsPanic(err) {
+//		logger.Errorf("task panicked: %v\n%s", err, err.(*panics.Error).Stack)
+//	}
+package panics
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+
+	jujuerrors "github.com/juju/errors"
+)
+
+// Error is the error returned when a function called by Call
+// or CallValue panics.
+type Error struct {
+	// Value holds the value passed to panic.
+	Value interface{}
+
+	// Stack holds the stack trace of the goroutine
+	// at the time of the panic.
+	Stack []byte
+}
+
+// Error implements error.
+func (e *Error) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Unwrap returns the value passed to panic if it is an error,
+// so that errors.Is and errors.As can find it.
+func (e *Error) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// IsPanic reports whether err is, wraps or has
+// as its cause an *Error.
+func IsPanic(err error) bool {
+	var perr *Error
+	if errors.As(err, &perr) {
+		return true
+	}
+	_, ok := jujuerrors.Cause(err).(*Error)
+	return ok
+}
+
+// Call calls f and returns its result. If f panics,
+// Call returns an *Error describing the panic.
+func Call(f func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = newError(r)
+		}
+	}()
+	return f()
+}
+
+// CallValue calls f and returns its results. If f panics, CallValue
+// returns the zero value of T and an *Error describing the panic.
+func CallValue[T any](f func() (T, error)) (value T, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			var zero T
+			value, err = zero, newError(r)
+		}
+	}()
+	return f()
+}
+
+// newError returns an *Error describing a panic with the given value,
+// with the stack of the panicking goroutine. It must be called while
+// the panic is being recovered, so that the stack is still intact.
+func newError(value interface{}) *Error {
+	return &Error{
+		Value: value,
+		Stack: debug.Stack(),
+	}
+}
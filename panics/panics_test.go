@@ -0,0 +1,85 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package panics_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	jujuerrors "github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/panics"
+)
+
+type panicsSuite struct{}
+
+var _ = gc.Suite(&panicsSuite{})
+
+func (*panicsSuite) TestCall(c *gc.C) {
+	c.Assert(panics.Call(func() error { return nil }), jc.ErrorIsNil)
+	err := panics.Call(func() error { return io.EOF })
+	c.Assert(err, gc.Equals, io.EOF)
+	c.Assert(panics.IsPanic(err), jc.IsFalse)
+}
+
+func (*panicsSuite) TestCallPanic(c *gc.C) {
+	err := panics.Call(func() error {
+		panicHere("oops")
+		return nil
+	})
+	c.Assert(err, gc.ErrorMatches, "panic: oops")
+	c.Assert(panics.IsPanic(err), jc.IsTrue)
+	perr := err.(*panics.Error)
+	c.Assert(perr.Value, gc.Equals, "oops")
+	// The stack shows where the panic happened.
+	c.Assert(string(perr.Stack), gc.Matches, `(?s).*panics_test\.panicHere.*`)
+}
+
+func panicHere(v interface{}) {
+	panic(v)
+}
+
+func (*panicsSuite) TestCallPanicError(c *gc.C) {
+	err := panics.Call(func() error {
+		var m map[string]int
+		m["x"] = 1
+		return nil
+	})
+	c.Assert(err, gc.ErrorMatches, "panic: assignment to entry in nil map")
+
+	err = panics.Call(func() error {
+		panic(fmt.Errorf("wrapped: %w", io.ErrUnexpectedEOF))
+	})
+	c.Assert(errors.Is(err, io.ErrUnexpectedEOF), jc.IsTrue)
+}
+
+func (*panicsSuite) TestCallValue(c *gc.C) {
+	v, err := panics.CallValue(func() (int, error) { return 42, nil })
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(v, gc.Equals, 42)
+
+	v, err = panics.CallValue(func() (int, error) { return 1, io.EOF })
+	c.Assert(err, gc.Equals, io.EOF)
+	c.Assert(v, gc.Equals, 1)
+}
+
+func (*panicsSuite) TestCallValuePanic(c *gc.C) {
+	v, err := panics.CallValue(func() (*int, error) {
+		panic("oops")
+	})
+	c.Assert(err, gc.ErrorMatches, "panic: oops")
+	c.Assert(panics.IsPanic(err), jc.IsTrue)
+	c.Assert(v, gc.IsNil)
+}
+
+func (*panicsSuite) TestIsPanic(c *gc.C) {
+	err := panics.Call(func() error { panic("oops") })
+	c.Assert(panics.IsPanic(fmt.Errorf("task: %w", err)), jc.IsTrue)
+	c.Assert(panics.IsPanic(jujuerrors.Annotate(err, "task")), jc.IsTrue)
+	c.Assert(panics.IsPanic(errors.New("panic: oops")), jc.IsFalse)
+	c.Assert(panics.IsPanic(nil), jc.IsFalse)
+}
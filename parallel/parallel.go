@@ -6,8 +6,10 @@
 package parallel
 
 import (
-	"fmt"
 	"sync"
+
+	"github.com/juju/utils/v3/multierror"
+	"github.com/juju/utils/v3/panics"
 )
 
 // Run represents a number of functions running concurrently.
@@ -20,17 +22,7 @@ type Run struct {
 }
 
 // Errors holds any errors encountered during the parallel run.
-type Errors []error
-
-func (errs Errors) Error() string {
-	switch len(errs) {
-	case 0:
-		return "no error"
-	case 1:
-		return errs[0].Error()
-	}
-	return fmt.Sprintf("%s (and %d more)", errs[0].Error(), len(errs)-1)
-}
+type Errors = multierror.Errors
 
 // NewRun returns a new parallel instance. It provides a way of running
 // functions concurrently while limiting the maximum number running at
@@ -49,7 +41,8 @@ func NewRun(max int) *Run {
 // Do requests that r run f concurrently.  If there are already the maximum
 // number of functions running concurrently, it will block until one of them
 // has completed. Do may itself be called concurrently, but may not be called
-// concurrently with Wait.
+// concurrently with Wait. If f panics, the panic is reported by Wait as a
+// *panics.Error.
 func (r *Run) Do(f func() error) {
 	select {
 	case r.work <- f:
@@ -84,7 +77,7 @@ func (r *Run) Wait() error {
 func (r *Run) runner() {
 	var errs Errors
 	for f := range r.work {
-		if err := f(); err != nil {
+		if err := panics.Call(f); err != nil {
 			errs = append(errs, err)
 		}
 	}
@@ -11,8 +11,10 @@ import (
 	"time"
 
 	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
 	gc "gopkg.in/check.v1"
 
+	"github.com/juju/utils/v3/panics"
 	"github.com/juju/utils/v3/parallel"
 )
 
@@ -141,6 +143,24 @@ func (*parallelSuite) TestParallelError(c *gc.C) {
 	}
 }
 
+func (*parallelSuite) TestParallelPanic(c *gc.C) {
+	parallelRun := parallel.NewRun(2)
+	var ran int32
+	parallelRun.Do(func() error {
+		panic("oops")
+	})
+	for i := 0; i < 3; i++ {
+		parallelRun.Do(func() error {
+			atomic.AddInt32(&ran, 1)
+			return nil
+		})
+	}
+	err := parallelRun.Wait()
+	c.Assert(err, gc.ErrorMatches, "panic: oops")
+	c.Assert(err, jc.Satisfies, panics.IsPanic)
+	c.Assert(atomic.LoadInt32(&ran), gc.Equals, int32(3))
+}
+
 func (*parallelSuite) TestZeroWorkerPanics(c *gc.C) {
 	defer func() {
 		r := recover()
@@ -0,0 +1,368 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package parallel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/juju/clock"
+
+	"github.com/juju/utils/v3/multierror"
+	"github.com/juju/utils/v3/panics"
+)
+
+// ErrSupervisorStopped is returned by Supervisor.Start when the
+// supervisor has been stopped.
+var ErrSupervisorStopped = errors.New("supervisor was stopped")
+
+// RestartPolicy determines when a supervised worker is restarted
+// after its function returns.
+type RestartPolicy int
+
+const (
+	// RestartOnFailure restarts the worker only when it returns a
+	// non-nil error.
+	RestartOnFailure RestartPolicy = iota
+
+	// RestartAlways restarts the worker whenever it returns.
+	RestartAlways
+
+	// RestartNever never restarts the worker.
+	RestartNever
+)
+
+// String implements fmt.Stringer.
+func (p RestartPolicy) String() string {
+	switch p {
+	case RestartOnFailure:
+		return "on-failure"
+	case RestartAlways:
+		return "always"
+	case RestartNever:
+		return "never"
+	}
+	return fmt.Sprintf("RestartPolicy(%d)", int(p))
+}
+
+// WorkerState describes what a supervised worker is doing.
+type WorkerState int
+
+const (
+	// WorkerRunning means the worker function is running.
+	WorkerRunning WorkerState = iota
+
+	// WorkerBackoff means the worker is waiting to be restarted.
+	WorkerBackoff
+
+	// WorkerStopped means the worker has finished and will not be
+	// restarted, either because its policy did not require it or
+	// because the supervisor was stopped.
+	WorkerStopped
+
+	// WorkerFailed means the worker returned an error and will not
+	// be restarted, either because its policy forbids it or because
+	// its restart budget is exhausted.
+	WorkerFailed
+)
+
+// String implements fmt.Stringer.
+func (s WorkerState) String() string {
+	switch s {
+	case WorkerRunning:
+		return "running"
+	case WorkerBackoff:
+		return "backoff"
+	case WorkerStopped:
+		return "stopped"
+	case WorkerFailed:
+		return "failed"
+	}
+	return fmt.Sprintf("WorkerState(%d)", int(s))
+}
+
+// WorkerSpec describes a long-lived function to be run by a Supervisor.
+type WorkerSpec struct {
+	// Name identifies the worker. It must be unique within
+	// the supervisor.
+	Name string
+
+	// Run is the worker function. It should return when ctx is done.
+	// A panic in Run is treated as a *panics.Error.
+	Run func(ctx context.Context) error
+
+	// Restart holds the restart policy of the worker.
+	Restart RestartPolicy
+
+	// MinDelay is the delay before the first restart after a failure.
+	// Each consecutive failure multiplies the delay by Factor, up to
+	// MaxDelay. A worker that returns without error is restarted
+	// after MinDelay.
+	MinDelay time.Duration
+
+	// MaxDelay, if positive, caps the restart delay.
+	MaxDelay time.Duration
+
+	// Factor is the multiplier applied to the delay after each
+	// consecutive failure. If it is less than 1, 2 is used.
+	Factor float64
+
+	// Jitter, if positive, randomly adjusts each delay by up to that
+	// fraction of itself in either direction, so that workers that
+	// fail together do not restart in lock step.
+	Jitter float64
+
+	// MaxRestarts, if positive, is the number of restarts allowed
+	// within RestartWindow. A worker that needs more restarts than
+	// that is marked as failed.
+	MaxRestarts int
+
+	// RestartWindow is the period over which restarts are counted
+	// against MaxRestarts. If it is zero, all restarts over the
+	// life of the worker count.
+	RestartWindow time.Duration
+}
+
+// WorkerStatus reports the state of a supervised worker.
+type WorkerStatus struct {
+	// Name holds the name of the worker.
+	Name string
+
+	// State holds the current state of the worker.
+	State WorkerState
+
+	// Restarts holds the number of times the worker
+	// has been restarted.
+	Restarts int
+
+	// LastError holds the error most recently returned
+	// by the worker, if any.
+	LastError error
+
+	// Since holds the time the worker entered its current state.
+	Since time.Time
+}
+
+// Supervisor runs long-lived worker functions, restarting them
+// according to their restart policies. Unlike Run, which runs many
+// short functions to completion, a Supervisor is intended for
+// goroutines that should keep running for the life of a process.
+type Supervisor struct {
+	clock  clock.Clock
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	rand    *rand.Rand
+	stopped bool
+	workers map[string]*WorkerStatus
+}
+
+// NewSupervisor returns a new supervisor. Its workers are stopped when
+// ctx is done or Stop is called. If clk is nil, the wall clock is used
+// to measure restart delays.
+func NewSupervisor(ctx context.Context, clk clock.Clock) *Supervisor {
+	if clk == nil {
+		clk = clock.WallClock
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	return &Supervisor{
+		clock:   clk,
+		ctx:     ctx,
+		cancel:  cancel,
+		rand:    rand.New(rand.NewSource(clk.Now().UnixNano())),
+		workers: make(map[string]*WorkerStatus),
+	}
+}
+
+// Start starts running the given worker. It returns an error if the
+// spec is invalid, a worker with the same name has already been
+// started, or the supervisor has been stopped.
+func (s *Supervisor) Start(spec WorkerSpec) error {
+	if spec.Name == "" {
+		return errors.New("worker name is empty")
+	}
+	if spec.Run == nil {
+		return fmt.Errorf("worker %q has no run function", spec.Name)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return ErrSupervisorStopped
+	}
+	if _, ok := s.workers[spec.Name]; ok {
+		return fmt.Errorf("worker %q already started", spec.Name)
+	}
+	s.workers[spec.Name] = &WorkerStatus{
+		Name:  spec.Name,
+		State: WorkerRunning,
+		Since: s.clock.Now(),
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.supervise(spec)
+	}()
+	return nil
+}
+
+// Report returns the status of every worker, sorted by name.
+func (s *Supervisor) Report() []WorkerStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report := make([]WorkerStatus, 0, len(s.workers))
+	for _, w := range s.workers {
+		report = append(report, *w)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		return report[i].Name < report[j].Name
+	})
+	return report
+}
+
+// Stop stops all the workers and waits for them to return. It returns
+// the same error as Wait.
+func (s *Supervisor) Stop() error {
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+	s.cancel()
+	return s.Wait()
+}
+
+// Wait waits for all the workers to finish without stopping them. It
+// returns an Errors value holding the last error of each worker that
+// failed, or nil if none did.
+func (s *Supervisor) Wait() error {
+	s.wg.Wait()
+
+	var errs Errors
+	for _, w := range s.Report() {
+		if w.State == WorkerFailed {
+			errs = append(errs, multierror.WithContext(w.LastError, fmt.Sprintf("worker %q", w.Name)))
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func (s *Supervisor) supervise(spec WorkerSpec) {
+	var (
+		failures int
+		restarts []time.Time
+	)
+	for {
+		err := runWorker(s.ctx, spec.Run)
+		if s.ctx.Err() != nil {
+			s.setState(spec.Name, WorkerStopped, err)
+			return
+		}
+		if err == nil {
+			failures = 0
+		} else {
+			failures++
+		}
+		if spec.Restart == RestartNever || (err == nil && spec.Restart == RestartOnFailure) {
+			if err != nil {
+				s.setState(spec.Name, WorkerFailed, err)
+			} else {
+				s.setState(spec.Name, WorkerStopped, nil)
+			}
+			return
+		}
+
+		now := s.clock.Now()
+		if spec.MaxRestarts > 0 {
+			if spec.RestartWindow > 0 {
+				restarts = pruneBefore(restarts, now.Add(-spec.RestartWindow))
+			}
+			if len(restarts) >= spec.MaxRestarts {
+				if err == nil {
+					err = fmt.Errorf("restarted more than %d times", spec.MaxRestarts)
+				}
+				s.setState(spec.Name, WorkerFailed, err)
+				return
+			}
+			restarts = append(restarts, now)
+		}
+
+		s.setState(spec.Name, WorkerBackoff, err)
+		select {
+		case <-s.clock.After(s.delay(spec, failures)):
+		case <-s.ctx.Done():
+			s.setState(spec.Name, WorkerStopped, err)
+			return
+		}
+		s.mu.Lock()
+		w := s.workers[spec.Name]
+		w.State = WorkerRunning
+		w.Restarts++
+		w.Since = s.clock.Now()
+		s.mu.Unlock()
+	}
+}
+
+// runWorker calls run, turning a panic into an error.
+func runWorker(ctx context.Context, run func(context.Context) error) error {
+	return panics.Call(func() error {
+		return run(ctx)
+	})
+}
+
+func (s *Supervisor) setState(name string, state WorkerState, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w := s.workers[name]
+	w.State = state
+	w.Since = s.clock.Now()
+	if err != nil {
+		w.LastError = err
+	}
+}
+
+// delay returns how long to wait before restarting a worker
+// after the given number of consecutive failures.
+func (s *Supervisor) delay(spec WorkerSpec, failures int) time.Duration {
+	factor := spec.Factor
+	if factor < 1 {
+		factor = 2
+	}
+	d := float64(spec.MinDelay)
+	for i := 1; i < failures; i++ {
+		d *= factor
+		if (spec.MaxDelay > 0 && d >= float64(spec.MaxDelay)) || d >= math.MaxInt64 {
+			break
+		}
+	}
+	if spec.MaxDelay > 0 && d > float64(spec.MaxDelay) {
+		d = float64(spec.MaxDelay)
+	}
+	if d > math.MaxInt64/2 {
+		d = math.MaxInt64 / 2
+	}
+	if spec.Jitter > 0 {
+		s.mu.Lock()
+		randFactor := s.rand.Float64()*2 - 1
+		s.mu.Unlock()
+		d += d * spec.Jitter * randFactor
+	}
+	return time.Duration(d)
+}
+
+func pruneBefore(times []time.Time, t time.Time) []time.Time {
+	i := 0
+	for i < len(times) && times[i].Before(t) {
+		i++
+	}
+	return times[i:]
+}
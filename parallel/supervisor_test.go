@@ -0,0 +1,239 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package parallel_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/juju/clock/testclock"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/parallel"
+)
+
+type supervisorSuite struct {
+	testing.IsolationSuite
+	clock *testclock.Clock
+	sup   *parallel.Supervisor
+}
+
+var _ = gc.Suite(&supervisorSuite{})
+
+func (s *supervisorSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.clock = testclock.NewClock(time.Now())
+	s.sup = parallel.NewSupervisor(context.Background(), s.clock)
+}
+
+func (s *supervisorSuite) TearDownTest(c *gc.C) {
+	s.sup.Stop()
+	s.IsolationSuite.TearDownTest(c)
+}
+
+// countingWorker returns a worker function that sends on runs each
+// time it is called and then returns err.
+func countingWorker(runs chan<- struct{}, err error) func(context.Context) error {
+	return func(context.Context) error {
+		runs <- struct{}{}
+		return err
+	}
+}
+
+func waitRun(c *gc.C, runs <-chan struct{}) {
+	select {
+	case <-runs:
+	case <-time.After(longWait):
+		c.Fatalf("timed out waiting for worker to run")
+	}
+}
+
+func assertNoRun(c *gc.C, runs <-chan struct{}) {
+	select {
+	case <-runs:
+		c.Fatalf("worker ran unexpectedly")
+	case <-time.After(shortWait):
+	}
+}
+
+func (s *supervisorSuite) advance(c *gc.C, d time.Duration) {
+	err := s.clock.WaitAdvance(d, longWait, 1)
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *supervisorSuite) TestBackoff(c *gc.C) {
+	runs := make(chan struct{})
+	err := s.sup.Start(parallel.WorkerSpec{
+		Name:     "w",
+		Run:      countingWorker(runs, errors.New("boom")),
+		MinDelay: time.Second,
+		MaxDelay: 3 * time.Second,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	waitRun(c, runs)
+	for _, d := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second} {
+		s.clock.Advance(d - time.Millisecond)
+		s.advance(c, 0)
+		assertNoRun(c, runs)
+		s.advance(c, time.Millisecond)
+		waitRun(c, runs)
+	}
+	s.advance(c, 0)
+	report := s.sup.Report()
+	c.Assert(report, gc.HasLen, 1)
+	c.Check(report[0].Name, gc.Equals, "w")
+	c.Check(report[0].State, gc.Equals, parallel.WorkerBackoff)
+	c.Check(report[0].Restarts, gc.Equals, 4)
+	c.Check(report[0].LastError, gc.ErrorMatches, "boom")
+
+	c.Assert(s.sup.Stop(), jc.ErrorIsNil)
+	report = s.sup.Report()
+	c.Check(report[0].State, gc.Equals, parallel.WorkerStopped)
+}
+
+func (s *supervisorSuite) TestSuccessResetsBackoff(c *gc.C) {
+	runs := make(chan struct{})
+	results := []error{errors.New("a"), errors.New("b"), nil, errors.New("c")}
+	err := s.sup.Start(parallel.WorkerSpec{
+		Name: "w",
+		Run: func(context.Context) error {
+			runs <- struct{}{}
+			err := results[0]
+			results = results[1:]
+			return err
+		},
+		Restart:  parallel.RestartAlways,
+		MinDelay: time.Second,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	waitRun(c, runs)
+	for _, d := range []time.Duration{time.Second, 2 * time.Second, time.Second} {
+		s.advance(c, d)
+		waitRun(c, runs)
+	}
+	report := s.sup.Report()
+	c.Check(report[0].Restarts, gc.Equals, 3)
+}
+
+func (s *supervisorSuite) TestOnFailureStopsOnSuccess(c *gc.C) {
+	runs := make(chan struct{}, 1)
+	err := s.sup.Start(parallel.WorkerSpec{
+		Name: "w",
+		Run:  countingWorker(runs, nil),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	waitRun(c, runs)
+	c.Assert(s.sup.Wait(), jc.ErrorIsNil)
+	report := s.sup.Report()
+	c.Check(report[0].State, gc.Equals, parallel.WorkerStopped)
+	c.Check(report[0].Restarts, gc.Equals, 0)
+	c.Check(report[0].LastError, gc.IsNil)
+}
+
+func (s *supervisorSuite) TestNeverRestart(c *gc.C) {
+	runs := make(chan struct{}, 1)
+	err := s.sup.Start(parallel.WorkerSpec{
+		Name:    "w",
+		Run:     countingWorker(runs, errors.New("boom")),
+		Restart: parallel.RestartNever,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	waitRun(c, runs)
+	err = s.sup.Wait()
+	c.Assert(err, gc.ErrorMatches, `worker "w": boom`)
+	c.Check(s.sup.Report()[0].State, gc.Equals, parallel.WorkerFailed)
+}
+
+func (s *supervisorSuite) TestRestartBudget(c *gc.C) {
+	runs := make(chan struct{})
+	err := s.sup.Start(parallel.WorkerSpec{
+		Name:          "w",
+		Run:           countingWorker(runs, errors.New("boom")),
+		MinDelay:      time.Second,
+		Factor:        1,
+		MaxRestarts:   2,
+		RestartWindow: 10 * time.Second,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	waitRun(c, runs)
+	s.advance(c, time.Second)
+	waitRun(c, runs)
+	// Move both restarts out of the window.
+	s.advance(c, 11*time.Second)
+	waitRun(c, runs)
+	s.advance(c, time.Second)
+	waitRun(c, runs)
+	s.advance(c, time.Second)
+	waitRun(c, runs)
+
+	err = s.sup.Wait()
+	c.Assert(err, gc.ErrorMatches, `worker "w": boom`)
+	report := s.sup.Report()
+	c.Check(report[0].State, gc.Equals, parallel.WorkerFailed)
+	c.Check(report[0].Restarts, gc.Equals, 4)
+}
+
+func (s *supervisorSuite) TestPanic(c *gc.C) {
+	err := s.sup.Start(parallel.WorkerSpec{
+		Name: "w",
+		Run: func(context.Context) error {
+			panic("oops")
+		},
+		Restart: parallel.RestartNever,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	err = s.sup.Wait()
+	c.Assert(err, gc.ErrorMatches, `worker "w": panic: oops`)
+}
+
+func (s *supervisorSuite) TestStopCancelsWorkers(c *gc.C) {
+	started := make(chan struct{})
+	for _, name := range []string{"b", "a"} {
+		err := s.sup.Start(parallel.WorkerSpec{
+			Name: name,
+			Run: func(ctx context.Context) error {
+				started <- struct{}{}
+				<-ctx.Done()
+				return ctx.Err()
+			},
+			Restart: parallel.RestartAlways,
+		})
+		c.Assert(err, jc.ErrorIsNil)
+	}
+	waitRun(c, started)
+	waitRun(c, started)
+	report := s.sup.Report()
+	c.Assert(report, gc.HasLen, 2)
+	c.Check(report[0].Name, gc.Equals, "a")
+	c.Check(report[0].State, gc.Equals, parallel.WorkerRunning)
+	c.Check(report[1].Name, gc.Equals, "b")
+
+	c.Assert(s.sup.Stop(), jc.ErrorIsNil)
+	for _, w := range s.sup.Report() {
+		c.Check(w.State, gc.Equals, parallel.WorkerStopped)
+	}
+	err := s.sup.Start(parallel.WorkerSpec{
+		Name: "c",
+		Run:  countingWorker(nil, nil),
+	})
+	c.Assert(err, gc.Equals, parallel.ErrSupervisorStopped)
+}
+
+func (s *supervisorSuite) TestStartErrors(c *gc.C) {
+	runs := make(chan struct{}, 1)
+	err := s.sup.Start(parallel.WorkerSpec{Name: "w", Run: countingWorker(runs, nil)})
+	c.Assert(err, jc.ErrorIsNil)
+	err = s.sup.Start(parallel.WorkerSpec{Name: "w", Run: countingWorker(runs, nil)})
+	c.Check(err, gc.ErrorMatches, `worker "w" already started`)
+	err = s.sup.Start(parallel.WorkerSpec{Name: "x"})
+	c.Check(err, gc.ErrorMatches, `worker "x" has no run function`)
+	err = s.sup.Start(parallel.WorkerSpec{Run: countingWorker(runs, nil)})
+	c.Check(err, gc.ErrorMatches, `worker name is empty`)
+}
@@ -9,6 +9,8 @@ import (
 	"sync"
 
 	"gopkg.in/tomb.v1"
+
+	"github.com/juju/utils/v3/panics"
 )
 
 var (
@@ -116,6 +118,9 @@ func (t *Try) loop() (io.Closer, error) {
 // receives a value, though this is advisory only - the Try does not
 // wait for all started functions to return before completing.
 //
+// If the function panics, the panic is treated as a failed attempt
+// that returned a *panics.Error.
+//
 // If the function returns a nil error but some earlier try was
 // successful (that is, the returned value is being discarded),
 // its returned value will be closed by calling its Close method.
@@ -132,7 +137,9 @@ func (t *Try) Start(try func(stop <-chan struct{}) (io.Closer, error)) error {
 	}
 	dying := t.tomb.Dying()
 	f := func() {
-		val, err := try(dying)
+		val, err := panics.CallValue(func() (io.Closer, error) {
+			return try(dying)
+		})
 		if t.limiter != nil {
 			// Signal availability slot is now free.
 			t.limiter <- struct{}{}
@@ -15,6 +15,7 @@ import (
 	jc "github.com/juju/testing/checkers"
 	gc "gopkg.in/check.v1"
 
+	"github.com/juju/utils/v3/panics"
 	"github.com/juju/utils/v3/parallel"
 )
 
@@ -71,6 +72,30 @@ func (*trySuite) TestOneFailure(c *gc.C) {
 	c.Assert(err, gc.Equals, expectErr)
 }
 
+func (*trySuite) TestPanic(c *gc.C) {
+	try := parallel.NewTry(0, nil)
+	err := try.Start(func(<-chan struct{}) (io.Closer, error) {
+		panic("oops")
+	})
+	c.Assert(err, gc.IsNil)
+	try.Close()
+	val, err := try.Result()
+	c.Assert(val, gc.IsNil)
+	c.Assert(err, gc.ErrorMatches, "panic: oops")
+	c.Assert(err, jc.Satisfies, panics.IsPanic)
+}
+
+func (*trySuite) TestPanicThenSuccess(c *gc.C) {
+	try := parallel.NewTry(0, nil)
+	try.Start(func(<-chan struct{}) (io.Closer, error) {
+		panic("oops")
+	})
+	try.Start(tryFunc(shortWait, result("hello"), nil))
+	val, err := try.Result()
+	c.Assert(err, gc.IsNil)
+	c.Assert(val, gc.Equals, result("hello"))
+}
+
 func (*trySuite) TestStartReturnsErrorAfterClose(c *gc.C) {
 	try := parallel.NewTry(0, nil)
 	expectErr := errors.New("foo")
@@ -0,0 +1,331 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package utils
+
+import (
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Password hash schemes understood by HashPassword and ComparePassword.
+const (
+	// Argon2id hashes passwords with the Argon2id key derivation
+	// function. Hashes are encoded in the PHC string format, for
+	// example $argon2id$v=19$m=65536,t=1,p=4$<salt>$<key>.
+	Argon2id = "argon2id"
+
+	// Bcrypt hashes passwords with bcrypt. Hashes are encoded in
+	// the usual modular crypt format, for example $2a$10$<salt+key>.
+	Bcrypt = "bcrypt"
+
+	// PBKDF2SHA512 is the scheme used by UserPasswordHash. Passwords
+	// cannot be hashed with it by HashPassword, but hashes made with
+	// UserPasswordHash can be verified, and so upgraded, once they
+	// have been encoded with UserPasswordHashString.
+	PBKDF2SHA512 = "pbkdf2-sha512"
+)
+
+// PasswordHashParams holds the scheme and cost parameters
+// used to hash passwords.
+type PasswordHashParams struct {
+	// Scheme holds the hash scheme to use, either Argon2id or Bcrypt.
+	Scheme string
+
+	// Argon2Time holds the number of passes over memory made by Argon2id.
+	Argon2Time uint32
+
+	// Argon2Memory holds the memory used by Argon2id, in KiB.
+	Argon2Memory uint32
+
+	// Argon2Threads holds the degree of parallelism used by Argon2id.
+	Argon2Threads uint8
+
+	// Argon2KeyLen holds the length of the key derived by Argon2id.
+	Argon2KeyLen uint32
+
+	// Argon2SaltLen holds the length of the random salt used by Argon2id.
+	Argon2SaltLen int
+
+	// BcryptCost holds the bcrypt cost, between bcrypt.MinCost
+	// and bcrypt.MaxCost.
+	BcryptCost int
+}
+
+// DefaultPasswordHashParams holds the parameters recommended for
+// hashing user passwords, following the OWASP guidance for Argon2id.
+var DefaultPasswordHashParams = PasswordHashParams{
+	Scheme:        Argon2id,
+	Argon2Time:    1,
+	Argon2Memory:  64 * 1024,
+	Argon2Threads: 4,
+	Argon2KeyLen:  32,
+	Argon2SaltLen: 16,
+	BcryptCost:    bcrypt.DefaultCost,
+}
+
+// HashPassword returns a self-describing hash of the given password,
+// made with the scheme and cost parameters in params. The result
+// records the scheme, parameters and salt used, so it can later be
+// checked with ComparePassword.
+func HashPassword(password string, params PasswordHashParams) (string, error) {
+	switch params.Scheme {
+	case Argon2id:
+		p := argon2Params{
+			time:    params.Argon2Time,
+			memory:  params.Argon2Memory,
+			threads: params.Argon2Threads,
+		}
+		if err := p.validate(); err != nil {
+			return "", fmt.Errorf("cannot hash password: %v", err)
+		}
+		if params.Argon2KeyLen < minArgon2KeyLen {
+			return "", fmt.Errorf("cannot hash password: argon2 key length %d too small", params.Argon2KeyLen)
+		}
+		if params.Argon2SaltLen < 0 {
+			return "", fmt.Errorf("cannot hash password: invalid argon2 salt length %d", params.Argon2SaltLen)
+		}
+		salt, err := RandomBytes(params.Argon2SaltLen)
+		if err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, params.Argon2KeyLen)
+		return p.encode(salt, key), nil
+	case Bcrypt:
+		h, err := bcrypt.GenerateFromPassword([]byte(password), params.BcryptCost)
+		if err != nil {
+			return "", fmt.Errorf("cannot hash password: %v", err)
+		}
+		return string(h), nil
+	}
+	return "", fmt.Errorf("cannot hash password with scheme %q", params.Scheme)
+}
+
+// ComparePassword reports whether password matches the given hash, as
+// returned by HashPassword or UserPasswordHashString. An error is
+// returned only if the hash is malformed.
+func ComparePassword(hash, password string) (bool, error) {
+	scheme, err := PasswordHashScheme(hash)
+	if err != nil {
+		return false, err
+	}
+	switch scheme {
+	case Argon2id:
+		p, salt, key, err := parseArgon2Hash(hash)
+		if err != nil {
+			return false, err
+		}
+		other := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, uint32(len(key)))
+		return subtle.ConstantTimeCompare(key, other) == 1, nil
+	case Bcrypt:
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		switch err {
+		case nil:
+			return true, nil
+		case bcrypt.ErrMismatchedHashAndPassword:
+			return false, nil
+		}
+		return false, fmt.Errorf("invalid bcrypt password hash: %v", err)
+	case PBKDF2SHA512:
+		iter, salt, key, err := parsePBKDF2Hash(hash)
+		if err != nil {
+			return false, err
+		}
+		other := base64.StdEncoding.EncodeToString(pbkdf2.Key([]byte(password), []byte(salt), iter, 18, sha512.New))
+		return subtle.ConstantTimeCompare([]byte(key), []byte(other)) == 1, nil
+	}
+	return false, fmt.Errorf("unknown password hash scheme %q", scheme)
+}
+
+// CompareAndUpgradePassword checks password against hash, like
+// ComparePassword. If the password matches but the hash was not made
+// with the scheme and cost parameters in params, the password is
+// hashed again with params and the new hash is returned, so that the
+// caller can store it in place of the old one. Otherwise the returned
+// hash is empty.
+//
+// This allows stored hashes to be migrated transparently to a new
+// scheme or to stronger parameters as users log in.
+func CompareAndUpgradePassword(hash, password string, params PasswordHashParams) (ok bool, newHash string, err error) {
+	ok, err = ComparePassword(hash, password)
+	if err != nil || !ok {
+		return false, "", err
+	}
+	upgrade, err := PasswordHashNeedsUpgrade(hash, params)
+	if err != nil || !upgrade {
+		return true, "", err
+	}
+	newHash, err = HashPassword(password, params)
+	if err != nil {
+		return true, "", err
+	}
+	return true, newHash, nil
+}
+
+// PasswordHashNeedsUpgrade reports whether the given hash was made
+// with a different scheme or different cost parameters to those in
+// params.
+func PasswordHashNeedsUpgrade(hash string, params PasswordHashParams) (bool, error) {
+	scheme, err := PasswordHashScheme(hash)
+	if err != nil {
+		return false, err
+	}
+	if scheme != params.Scheme {
+		return true, nil
+	}
+	switch scheme {
+	case Argon2id:
+		p, _, key, err := parseArgon2Hash(hash)
+		if err != nil {
+			return false, err
+		}
+		return p.time != params.Argon2Time ||
+			p.memory != params.Argon2Memory ||
+			p.threads != params.Argon2Threads ||
+			uint32(len(key)) != params.Argon2KeyLen, nil
+	case Bcrypt:
+		cost, err := bcrypt.Cost([]byte(hash))
+		if err != nil {
+			return false, fmt.Errorf("invalid bcrypt password hash: %v", err)
+		}
+		return cost != params.BcryptCost, nil
+	}
+	return true, nil
+}
+
+// PasswordHashScheme returns the scheme used to make the given
+// self-describing password hash.
+func PasswordHashScheme(hash string) (string, error) {
+	if !strings.HasPrefix(hash, "$") {
+		return "", fmt.Errorf("invalid password hash: no scheme")
+	}
+	id := hash[1:]
+	if i := strings.IndexByte(id, '$'); i >= 0 {
+		id = id[:i]
+	}
+	switch id {
+	case "2a", "2b", "2y":
+		return Bcrypt, nil
+	case Argon2id, PBKDF2SHA512:
+		return id, nil
+	}
+	return "", fmt.Errorf("unknown password hash scheme %q", id)
+}
+
+// UserPasswordHashString returns the self-describing form of a hash
+// returned by UserPasswordHash for the given salt, so that it can be
+// checked with ComparePassword and upgraded with
+// CompareAndUpgradePassword.
+func UserPasswordHashString(hash, salt string) string {
+	iter := 8192
+	if FastInsecureHash {
+		iter = 1
+	}
+	return fmt.Sprintf("$%s$i=%d$%s$%s", PBKDF2SHA512, iter, base64.RawStdEncoding.EncodeToString([]byte(salt)), hash)
+}
+
+// argon2Params holds the parameters recorded in an Argon2id hash.
+type argon2Params struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+}
+
+// Limits on the Argon2id parameters, so that a corrupt or malicious
+// hash cannot make argon2 panic or use excessive time or memory.
+const (
+	maxArgon2Time   = 64
+	maxArgon2Memory = 4 * 1024 * 1024 // KiB
+	minArgon2KeyLen = 4
+)
+
+// validate checks that the parameters are within
+// the range accepted by argon2, and within our limits.
+func (p argon2Params) validate() error {
+	switch {
+	case p.threads < 1:
+		return fmt.Errorf("argon2 parallelism %d too small", p.threads)
+	case p.time < 1:
+		return fmt.Errorf("argon2 time %d too small", p.time)
+	case p.time > maxArgon2Time:
+		return fmt.Errorf("argon2 time %d too large", p.time)
+	case p.memory < 8*uint32(p.threads):
+		return fmt.Errorf("argon2 memory %d too small for parallelism %d", p.memory, p.threads)
+	case p.memory > maxArgon2Memory:
+		return fmt.Errorf("argon2 memory %d too large", p.memory)
+	}
+	return nil
+}
+
+func (p argon2Params) encode(salt, key []byte) string {
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		Argon2id, argon2.Version, p.memory, p.time, p.threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+}
+
+func parseArgon2Hash(hash string) (p argon2Params, salt, key []byte, err error) {
+	invalid := func() (argon2Params, []byte, []byte, error) {
+		return argon2Params{}, nil, nil, fmt.Errorf("invalid argon2id password hash")
+	}
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return invalid()
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return invalid()
+	}
+	if version != argon2.Version {
+		return argon2Params{}, nil, nil, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return invalid()
+	}
+	if err := p.validate(); err != nil {
+		return argon2Params{}, nil, nil, fmt.Errorf("invalid argon2id password hash: %v", err)
+	}
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return invalid()
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return invalid()
+	}
+	if len(key) < minArgon2KeyLen {
+		return argon2Params{}, nil, nil, fmt.Errorf("invalid argon2id password hash: argon2 key length %d too small", len(key))
+	}
+	return p, salt, key, nil
+}
+
+// maxPBKDF2Iter limits the iteration count in a PBKDF2 hash, so that a
+// corrupt or malicious hash cannot use excessive time. It is a small
+// multiple of the count used by UserPasswordHash.
+const maxPBKDF2Iter = 4 * 8192
+
+func parsePBKDF2Hash(hash string) (iter int, salt, key string, err error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 5 || !strings.HasPrefix(parts[2], "i=") {
+		return 0, "", "", fmt.Errorf("invalid %s password hash", PBKDF2SHA512)
+	}
+	iter, err = strconv.Atoi(parts[2][len("i="):])
+	if err != nil || iter < 1 {
+		return 0, "", "", fmt.Errorf("invalid %s password hash", PBKDF2SHA512)
+	}
+	if iter > maxPBKDF2Iter {
+		return 0, "", "", fmt.Errorf("invalid %s password hash: iteration count %d too large", PBKDF2SHA512, iter)
+	}
+	rawSalt, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return 0, "", "", fmt.Errorf("invalid %s password hash", PBKDF2SHA512)
+	}
+	return iter, string(rawSalt), parts[4], nil
+}
@@ -0,0 +1,221 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package utils_test
+
+import (
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	"golang.org/x/crypto/bcrypt"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3"
+)
+
+type passwordHashSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&passwordHashSuite{})
+
+// cheapParams holds inexpensive hash parameters so the tests run quickly.
+var cheapParams = utils.PasswordHashParams{
+	Scheme:        utils.Argon2id,
+	Argon2Time:    1,
+	Argon2Memory:  64,
+	Argon2Threads: 1,
+	Argon2KeyLen:  16,
+	Argon2SaltLen: 8,
+	BcryptCost:    bcrypt.MinCost,
+}
+
+func (*passwordHashSuite) TestArgon2id(c *gc.C) {
+	hash, err := utils.HashPassword("secret", cheapParams)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(hash, gc.Matches, `\$argon2id\$v=19\$m=64,t=1,p=1\$[A-Za-z0-9+/]{11}\$[A-Za-z0-9+/]{22}`)
+
+	other, err := utils.HashPassword("secret", cheapParams)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(other, gc.Not(gc.Equals), hash)
+
+	ok, err := utils.ComparePassword(hash, "secret")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(ok, jc.IsTrue)
+	ok, err = utils.ComparePassword(hash, "wrong")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(ok, jc.IsFalse)
+}
+
+func (*passwordHashSuite) TestBcrypt(c *gc.C) {
+	params := cheapParams
+	params.Scheme = utils.Bcrypt
+	hash, err := utils.HashPassword("secret", params)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(hash, gc.Matches, `\$2a\$04\$.{53}`)
+
+	scheme, err := utils.PasswordHashScheme(hash)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(scheme, gc.Equals, utils.Bcrypt)
+
+	ok, err := utils.ComparePassword(hash, "secret")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(ok, jc.IsTrue)
+	ok, err = utils.ComparePassword(hash, "wrong")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(ok, jc.IsFalse)
+}
+
+func (s *passwordHashSuite) TestUserPasswordHashString(c *gc.C) {
+	s.PatchValue(&utils.FastInsecureHash, true)
+	salt, err := utils.RandomSalt()
+	c.Assert(err, jc.ErrorIsNil)
+	hash := utils.UserPasswordHashString(utils.UserPasswordHash("secret", salt), salt)
+	c.Check(hash, gc.Matches, `\$pbkdf2-sha512\$i=1\$.*\$.*`)
+
+	ok, err := utils.ComparePassword(hash, "secret")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(ok, jc.IsTrue)
+	ok, err = utils.ComparePassword(hash, "wrong")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(ok, jc.IsFalse)
+
+	_, err = utils.HashPassword("secret", utils.PasswordHashParams{Scheme: utils.PBKDF2SHA512})
+	c.Check(err, gc.ErrorMatches, `cannot hash password with scheme "pbkdf2-sha512"`)
+}
+
+func (s *passwordHashSuite) TestCompareAndUpgradePassword(c *gc.C) {
+	s.PatchValue(&utils.FastInsecureHash, true)
+	legacy := utils.UserPasswordHashString(utils.UserPasswordHash("secret", "salt"), "salt")
+
+	// A wrong password is not upgraded.
+	ok, newHash, err := utils.CompareAndUpgradePassword(legacy, "wrong", cheapParams)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(ok, jc.IsFalse)
+	c.Check(newHash, gc.Equals, "")
+
+	// The right password upgrades the legacy hash to argon2id.
+	ok, newHash, err = utils.CompareAndUpgradePassword(legacy, "secret", cheapParams)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(ok, jc.IsTrue)
+	scheme, err := utils.PasswordHashScheme(newHash)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(scheme, gc.Equals, utils.Argon2id)
+
+	// A hash made with the current parameters is left alone.
+	hash := newHash
+	ok, newHash, err = utils.CompareAndUpgradePassword(hash, "secret", cheapParams)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(ok, jc.IsTrue)
+	c.Check(newHash, gc.Equals, "")
+
+	// Changing the cost parameters causes an upgrade.
+	stronger := cheapParams
+	stronger.Argon2Time = 2
+	ok, newHash, err = utils.CompareAndUpgradePassword(hash, "secret", stronger)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(ok, jc.IsTrue)
+	c.Check(newHash, gc.Matches, `\$argon2id\$v=19\$m=64,t=2,p=1\$.*`)
+}
+
+func (*passwordHashSuite) TestPasswordHashNeedsUpgradeBcryptCost(c *gc.C) {
+	params := cheapParams
+	params.Scheme = utils.Bcrypt
+	hash, err := utils.HashPassword("secret", params)
+	c.Assert(err, jc.ErrorIsNil)
+
+	upgrade, err := utils.PasswordHashNeedsUpgrade(hash, params)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(upgrade, jc.IsFalse)
+
+	params.BcryptCost++
+	upgrade, err = utils.PasswordHashNeedsUpgrade(hash, params)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(upgrade, jc.IsTrue)
+}
+
+func (*passwordHashSuite) TestHashPasswordInvalidParams(c *gc.C) {
+	for _, test := range []struct {
+		about  string
+		modify func(p *utils.PasswordHashParams)
+		err    string
+	}{{
+		about:  "zero params",
+		modify: func(p *utils.PasswordHashParams) { *p = utils.PasswordHashParams{Scheme: utils.Argon2id} },
+		err:    "cannot hash password: argon2 parallelism 0 too small",
+	}, {
+		about:  "zero time",
+		modify: func(p *utils.PasswordHashParams) { p.Argon2Time = 0 },
+		err:    "cannot hash password: argon2 time 0 too small",
+	}, {
+		about:  "too little memory",
+		modify: func(p *utils.PasswordHashParams) { p.Argon2Threads = 16 },
+		err:    "cannot hash password: argon2 memory 64 too small for parallelism 16",
+	}, {
+		about:  "too much memory",
+		modify: func(p *utils.PasswordHashParams) { p.Argon2Memory = 1 << 30 },
+		err:    "cannot hash password: argon2 memory 1073741824 too large",
+	}, {
+		about:  "zero key length",
+		modify: func(p *utils.PasswordHashParams) { p.Argon2KeyLen = 0 },
+		err:    "cannot hash password: argon2 key length 0 too small",
+	}, {
+		about:  "negative salt length",
+		modify: func(p *utils.PasswordHashParams) { p.Argon2SaltLen = -1 },
+		err:    "cannot hash password: invalid argon2 salt length -1",
+	}} {
+		c.Logf("test: %s", test.about)
+		params := cheapParams
+		test.modify(&params)
+		_, err := utils.HashPassword("secret", params)
+		c.Check(err, gc.ErrorMatches, test.err)
+	}
+}
+
+func (*passwordHashSuite) TestComparePasswordInvalidHash(c *gc.C) {
+	for _, test := range []struct {
+		hash string
+		err  string
+	}{{
+		hash: "plain",
+		err:  "invalid password hash: no scheme",
+	}, {
+		hash: "$md5$abc",
+		err:  `unknown password hash scheme "md5"`,
+	}, {
+		hash: "$argon2id$v=19$m=64,t=1,p=1$salt",
+		err:  "invalid argon2id password hash",
+	}, {
+		hash: "$argon2id$v=16$m=64,t=1,p=1$c2FsdA$a2V5",
+		err:  "unsupported argon2 version 16",
+	}, {
+		hash: "$argon2id$v=19$m=65536,t=0,p=4$c2FsdA$a2V5",
+		err:  "invalid argon2id password hash: argon2 time 0 too small",
+	}, {
+		hash: "$argon2id$v=19$m=65536,t=1,p=0$c2FsdA$a2V5",
+		err:  "invalid argon2id password hash: argon2 parallelism 0 too small",
+	}, {
+		hash: "$argon2id$v=19$m=0,t=1,p=4$c2FsdA$a2V5",
+		err:  "invalid argon2id password hash: argon2 memory 0 too small for parallelism 4",
+	}, {
+		hash: "$argon2id$v=19$m=4294967295,t=1,p=4$c2FsdA$a2V5",
+		err:  "invalid argon2id password hash: argon2 memory 4294967295 too large",
+	}, {
+		hash: "$argon2id$v=19$m=64,t=100000,p=1$c2FsdA$a2V5",
+		err:  "invalid argon2id password hash: argon2 time 100000 too large",
+	}, {
+		hash: "$argon2id$v=19$m=65536,t=1,p=4$c2FsdA$a2V5",
+		err:  "invalid argon2id password hash: argon2 key length 3 too small",
+	}, {
+		hash: "$pbkdf2-sha512$i=0$c2FsdA$key",
+		err:  "invalid pbkdf2-sha512 password hash",
+	}, {
+		hash: "$pbkdf2-sha512$i=2000000000$c2FsdA$key",
+		err:  "invalid pbkdf2-sha512 password hash: iteration count 2000000000 too large",
+	}, {
+		hash: "$2a$04$short",
+		err:  "invalid bcrypt password hash: .*",
+	}} {
+		_, err := utils.ComparePassword(test.hash, "secret")
+		c.Check(err, gc.ErrorMatches, test.err, gc.Commentf("hash %q", test.hash))
+	}
+}
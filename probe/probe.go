@@ -0,0 +1,196 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package probe waits for network services to become reachable,
+// such as a TCP port opening, an HTTP endpoint responding or an SSH
+// server presenting its banner, as is common when provisioning
+// machines.
+package probe
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/juju/clock"
+
+	"github.com/juju/utils/v3/retry"
+)
+
+// Probe checks whether a service is reachable.
+type Probe struct {
+	// Name describes the service in errors, such as "tcp://host:22".
+	Name string
+
+	// Check makes a single attempt to reach the service,
+	// returning an error if it could not.
+	Check func(ctx context.Context) error
+}
+
+// TCP returns a probe that succeeds when a TCP connection
+// can be made to the given address.
+func TCP(addr string) Probe {
+	return Probe{
+		Name: "tcp://" + addr,
+		Check: func(ctx context.Context) error {
+			var d net.Dialer
+			conn, err := d.DialContext(ctx, "tcp", addr)
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		},
+	}
+}
+
+// HTTP returns a probe that succeeds when a GET request for the given
+// URL returns a status below 400. If client is nil,
+// http.DefaultClient is used.
+func HTTP(client *http.Client, url string) Probe {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return Probe{
+		Name: url,
+		Check: func(ctx context.Context) error {
+			req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+			if err != nil {
+				return retry.Permanent(err)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+			if resp.StatusCode >= 400 {
+				return fmt.Errorf("unexpected status %s", resp.Status)
+			}
+			return nil
+		},
+	}
+}
+
+// SSH returns a probe that succeeds when the server at the given
+// address presents an SSH protocol banner (see RFC 4253 section 4.2).
+// The server may send other lines of text before the banner.
+func SSH(addr string) Probe {
+	return Probe{
+		Name: "ssh://" + addr,
+		Check: func(ctx context.Context) error {
+			var d net.Dialer
+			conn, err := d.DialContext(ctx, "tcp", addr)
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+			// Close the connection if ctx is done
+			// while waiting for the banner.
+			stop := make(chan struct{})
+			defer close(stop)
+			go func() {
+				select {
+				case <-ctx.Done():
+					conn.Close()
+				case <-stop:
+				}
+			}()
+			r := bufio.NewReader(conn)
+			for {
+				line, err := r.ReadString('\n')
+				if strings.HasPrefix(line, "SSH-") {
+					return nil
+				}
+				if err != nil {
+					if ctx.Err() != nil {
+						return ctx.Err()
+					}
+					return fmt.Errorf("no SSH banner received: %v", err)
+				}
+			}
+		},
+	}
+}
+
+// Options holds options for Wait.
+type Options struct {
+	// Policy determines how often and for how long the probe is
+	// retried. If Policy.Backoff is nil, DefaultBackoff is used.
+	Policy retry.Policy
+
+	// AttemptTimeout, if positive, limits the
+	// time taken by each attempt.
+	AttemptTimeout time.Duration
+}
+
+// DefaultBackoff holds the backoff strategy used by Wait
+// when none is given.
+var DefaultBackoff = retry.Exponential(100*time.Millisecond, 2, 5*time.Second)
+
+// Wait checks the probe until it succeeds, the retry policy is
+// exhausted or ctx is done. If the probe does not succeed, the
+// returned error is a *WaitError describing the last failure.
+func Wait(ctx context.Context, p Probe, opts Options) error {
+	policy := opts.Policy
+	if policy.Backoff == nil {
+		policy.Backoff = DefaultBackoff
+	}
+	if policy.Clock == nil {
+		policy.Clock = clock.WallClock
+	}
+	start := policy.Clock.Now()
+	err := retry.Do(ctx, policy, func(ctx context.Context) error {
+		if opts.AttemptTimeout <= 0 {
+			return p.Check(ctx)
+		}
+		attemptCtx, cancel := context.WithTimeout(ctx, opts.AttemptTimeout)
+		defer cancel()
+		err := p.Check(attemptCtx)
+		if err != nil && ctx.Err() == nil && attemptCtx.Err() != nil {
+			// Only the attempt timed out, rather than the
+			// whole wait, so it may be retried.
+			err = fmt.Errorf("attempt timed out after %v", opts.AttemptTimeout)
+		}
+		return err
+	})
+	if err == nil {
+		return nil
+	}
+	werr := &WaitError{
+		Probe:   p.Name,
+		Elapsed: policy.Clock.Now().Sub(start),
+		Err:     retry.LastError(err),
+	}
+	if rerr, ok := err.(*retry.Error); ok {
+		werr.Attempts = rerr.Attempts
+	}
+	return werr
+}
+
+// WaitError is returned by Wait when a probe does not succeed.
+type WaitError struct {
+	// Probe holds the name of the probe.
+	Probe string
+
+	// Attempts holds the number of attempts made.
+	Attempts int
+
+	// Elapsed holds the time spent waiting.
+	Elapsed time.Duration
+
+	// Err holds the error from the last attempt.
+	Err error
+}
+
+// Error implements error.
+func (e *WaitError) Error() string {
+	return fmt.Sprintf("%s not reachable after %d attempts in %v: %v", e.Probe, e.Attempts, e.Elapsed.Round(time.Millisecond), e.Err)
+}
+
+// Unwrap returns the error from the last attempt.
+func (e *WaitError) Unwrap() error {
+	return e.Err
+}
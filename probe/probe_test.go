@@ -0,0 +1,185 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package probe_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/probe"
+	"github.com/juju/utils/v3/retry"
+)
+
+type probeSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&probeSuite{})
+
+// fastOptions returns options that retry quickly,
+// making at most the given number of attempts.
+func fastOptions(attempts int) probe.Options {
+	return probe.Options{
+		Policy: retry.Policy{
+			Attempts: attempts,
+			Backoff:  retry.Constant(time.Millisecond),
+		},
+	}
+}
+
+// closedAddr returns the address of a TCP port with nothing listening.
+func closedAddr(c *gc.C) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, jc.ErrorIsNil)
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+// serve accepts connections on l, writing data
+// to each and then closing it.
+func serve(l net.Listener, data string) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		conn.Write([]byte(data))
+		conn.Close()
+	}
+}
+
+func (*probeSuite) TestTCP(c *gc.C) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, jc.ErrorIsNil)
+	defer l.Close()
+	go serve(l, "")
+
+	err = probe.Wait(context.Background(), probe.TCP(l.Addr().String()), fastOptions(3))
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (*probeSuite) TestTCPBecomesReachable(c *gc.C) {
+	addr := closedAddr(c)
+	attempts := 0
+	opts := fastOptions(0)
+	opts.Policy.OnRetry = func(int, error, time.Duration) {
+		attempts++
+		if attempts == 2 {
+			l, err := net.Listen("tcp", addr)
+			c.Assert(err, jc.ErrorIsNil)
+			go serve(l, "")
+			go func() {
+				time.Sleep(testing.LongWait)
+				l.Close()
+			}()
+		}
+	}
+	err := probe.Wait(context.Background(), probe.TCP(addr), opts)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(attempts, gc.Equals, 2)
+}
+
+func (*probeSuite) TestTCPUnreachable(c *gc.C) {
+	addr := closedAddr(c)
+	err := probe.Wait(context.Background(), probe.TCP(addr), fastOptions(3))
+	c.Assert(err, gc.ErrorMatches, `tcp://`+addr+` not reachable after 3 attempts in .*: dial tcp .*: connection refused`)
+	var werr *probe.WaitError
+	c.Assert(errors.As(err, &werr), jc.IsTrue)
+	c.Assert(werr.Probe, gc.Equals, "tcp://"+addr)
+	c.Assert(werr.Attempts, gc.Equals, 3)
+	c.Assert(werr.Elapsed > 0, jc.IsTrue)
+}
+
+func (*probeSuite) TestContextCancelled(c *gc.C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	opts := fastOptions(0)
+	opts.Policy.OnRetry = func(attempt int, _ error, _ time.Duration) {
+		if attempt == 2 {
+			cancel()
+		}
+	}
+	err := probe.Wait(ctx, probe.TCP(closedAddr(c)), opts)
+	c.Assert(err, gc.ErrorMatches, `.* not reachable after 2 attempts in .*: .*connection refused`)
+}
+
+func (*probeSuite) TestHTTP(c *gc.C) {
+	status := http.StatusServiceUnavailable
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	err := probe.Wait(context.Background(), probe.HTTP(nil, srv.URL), fastOptions(2))
+	c.Assert(err, gc.ErrorMatches, `http://.* not reachable after 2 attempts in .*: unexpected status 503 Service Unavailable`)
+
+	status = http.StatusOK
+	err = probe.Wait(context.Background(), probe.HTTP(srv.Client(), srv.URL), fastOptions(2))
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (*probeSuite) TestHTTPInvalidURL(c *gc.C) {
+	err := probe.Wait(context.Background(), probe.HTTP(nil, "http://[::1"), fastOptions(5))
+	c.Assert(err, gc.ErrorMatches, `.* not reachable after 1 attempts in .*: .*missing ']' in host`)
+}
+
+func (*probeSuite) TestSSH(c *gc.C) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, jc.ErrorIsNil)
+	defer l.Close()
+	go serve(l, "Welcome\r\nSSH-2.0-OpenSSH_8.9p1\r\n")
+
+	err = probe.Wait(context.Background(), probe.SSH(l.Addr().String()), fastOptions(2))
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (*probeSuite) TestSSHNoBanner(c *gc.C) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, jc.ErrorIsNil)
+	defer l.Close()
+	go serve(l, "HTTP/1.1 400 Bad Request\r\n")
+
+	err = probe.Wait(context.Background(), probe.SSH(l.Addr().String()), fastOptions(2))
+	c.Assert(err, gc.ErrorMatches, `ssh://.* not reachable after 2 attempts in .*: no SSH banner received: EOF`)
+}
+
+func (*probeSuite) TestAttemptTimeout(c *gc.C) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, jc.ErrorIsNil)
+	defer l.Close()
+	// Accept connections but never send a banner.
+	conns := make(chan net.Conn, 10)
+	done := make(chan struct{})
+	defer func() {
+		l.Close()
+		<-done
+		close(conns)
+		for conn := range conns {
+			conn.Close()
+		}
+	}()
+	go func() {
+		defer close(done)
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+		}
+	}()
+
+	opts := fastOptions(2)
+	opts.AttemptTimeout = 50 * time.Millisecond
+	err = probe.Wait(context.Background(), probe.SSH(l.Addr().String()), opts)
+	c.Assert(err, gc.ErrorMatches, `ssh://.* not reachable after 2 attempts in .*: attempt timed out after 50ms`)
+}
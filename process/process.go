@@ -0,0 +1,162 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package process lists the processes running on the system, finds
+// the children of a process, and signals or kills processes along
+// with everything they have started. To kill a command and all its
+// descendants reliably, start it with StartGroup, which puts it in a
+// process group on Unix and a job object on Windows.
+package process
+
+import (
+	"os"
+
+	"github.com/juju/errors"
+)
+
+// Process describes a running process.
+type Process struct {
+	// PID holds the process ID.
+	PID int
+
+	// PPID holds the ID of the parent process.
+	PPID int
+
+	// Name holds the name of the executable, which may be
+	// truncated on some systems, as to 15 bytes on Linux.
+	Name string
+
+	// Cmdline holds the command line of the process. It is nil
+	// if the command line cannot be read, as for processes
+	// owned by other users on some systems, and for kernel
+	// threads.
+	Cmdline []string
+}
+
+// List returns the processes running on the system.
+func List() ([]Process, error) {
+	procs, err := list()
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot list processes")
+	}
+	return procs, nil
+}
+
+// Find returns the process with the given ID. It returns an error
+// satisfying errors.IsNotFound if there is none.
+func Find(pid int) (Process, error) {
+	procs, err := List()
+	if err != nil {
+		return Process{}, errors.Trace(err)
+	}
+	for _, p := range procs {
+		if p.PID == pid {
+			return p, nil
+		}
+	}
+	return Process{}, errors.NotFoundf("process %d", pid)
+}
+
+// FindByName returns the processes with the given name.
+func FindByName(name string) ([]Process, error) {
+	procs, err := List()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var found []Process
+	for _, p := range procs {
+		if p.Name == name {
+			found = append(found, p)
+		}
+	}
+	return found, nil
+}
+
+// Children returns the processes whose parent
+// is the process with the given ID.
+func Children(pid int) ([]Process, error) {
+	procs, err := List()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var children []Process
+	for _, p := range procs {
+		if p.PPID == pid && p.PID != pid {
+			children = append(children, p)
+		}
+	}
+	return children, nil
+}
+
+// Descendants returns the children of the process with the given
+// ID, their children and so on, parents before their children.
+func Descendants(pid int) ([]Process, error) {
+	procs, err := List()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return descendants(procs, pid), nil
+}
+
+// descendants returns the descendants of pid among procs,
+// in breadth-first order.
+func descendants(procs []Process, pid int) []Process {
+	children := make(map[int][]Process)
+	for _, p := range procs {
+		// On some systems, process 0 is its own parent.
+		if p.PID != p.PPID {
+			children[p.PPID] = append(children[p.PPID], p)
+		}
+	}
+	var found []Process
+	queue := []int{pid}
+	seen := map[int]bool{pid: true}
+	for len(queue) > 0 {
+		for _, child := range children[queue[0]] {
+			// Process IDs may be reused while the list is being
+			// made, so guard against cycles.
+			if seen[child.PID] {
+				continue
+			}
+			seen[child.PID] = true
+			found = append(found, child)
+			queue = append(queue, child.PID)
+		}
+		queue = queue[1:]
+	}
+	return found
+}
+
+// Signal sends sig to the process with the given ID. On Windows,
+// only os.Kill is supported. It returns os.ErrProcessDone if the
+// process has already exited.
+func Signal(pid int, sig os.Signal) error {
+	return signal(pid, sig)
+}
+
+// KillTree kills the process with the given ID and all its
+// descendants, returning the first error encountered. Processes
+// that have already exited are ignored. A process that has been
+// orphaned by the death of its parent is no longer a descendant,
+// so a process that may exit while its children run is better
+// started with StartGroup and killed with Group.Kill.
+func KillTree(pid int) error {
+	procs, err := List()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	// Kill the parent first, so that it
+	// cannot start any more children.
+	var firstErr error
+	pids := []int{pid}
+	for _, p := range descendants(procs, pid) {
+		pids = append(pids, p.PID)
+	}
+	for _, pid := range pids {
+		err := Signal(pid, os.Kill)
+		if err != nil && err != os.ErrProcessDone && firstErr == nil {
+			firstErr = errors.Annotatef(err, "cannot kill process %d", pid)
+		}
+	}
+	return firstErr
+}
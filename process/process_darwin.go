@@ -0,0 +1,77 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package process
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/juju/errors"
+	"golang.org/x/sys/unix"
+)
+
+func list() ([]Process, error) {
+	kprocs, err := unix.SysctlKinfoProcSlice("kern.proc.all")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	procs := make([]Process, 0, len(kprocs))
+	for _, kp := range kprocs {
+		var name []byte
+		for _, c := range kp.Proc.P_comm {
+			if c == 0 {
+				break
+			}
+			name = append(name, byte(c))
+		}
+		pid := int(kp.Proc.P_pid)
+		procs = append(procs, Process{
+			PID:     pid,
+			PPID:    int(kp.Eproc.Ppid),
+			Name:    string(name),
+			Cmdline: cmdline(pid),
+		})
+	}
+	return procs, nil
+}
+
+// cmdline returns the command line of the process with the given
+// ID, or nil if it cannot be read.
+func cmdline(pid int) []string {
+	data, err := unix.SysctlRaw("kern.procargs2", pid)
+	if err != nil || len(data) < 4 {
+		return nil
+	}
+	return parseProcArgs(data)
+}
+
+// parseProcArgs parses the result of the kern.procargs2 sysctl: the
+// argument count, the path of the executable and the arguments, all
+// separated by one or more NUL bytes.
+func parseProcArgs(data []byte) []string {
+	argc := int(binary.LittleEndian.Uint32(data))
+	data = data[4:]
+	// Skip the executable path and the padding after it.
+	i := bytes.IndexByte(data, 0)
+	if i < 0 {
+		return nil
+	}
+	data = bytes.TrimLeft(data[i:], "\x00")
+	args := make([]string, 0, argc)
+	for len(args) < argc && len(data) > 0 {
+		i := bytes.IndexByte(data, 0)
+		if i < 0 {
+			i = len(data)
+		}
+		args = append(args, string(data[:i]))
+		data = data[i:]
+		if len(data) > 0 {
+			data = data[1:]
+		}
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	return args
+}
@@ -0,0 +1,48 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package process
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type descendantsSuite struct{}
+
+var _ = gc.Suite(&descendantsSuite{})
+
+func pids(procs []Process) []int {
+	var pids []int
+	for _, p := range procs {
+		pids = append(pids, p.PID)
+	}
+	return pids
+}
+
+func (*descendantsSuite) TestDescendants(c *gc.C) {
+	procs := []Process{
+		{PID: 0, PPID: 0},
+		{PID: 1, PPID: 0},
+		{PID: 10, PPID: 1},
+		{PID: 11, PPID: 10},
+		{PID: 12, PPID: 1},
+		{PID: 13, PPID: 11},
+		{PID: 14, PPID: 12},
+		{PID: 20, PPID: 1},
+	}
+	c.Assert(pids(descendants(procs, 10)), jc.DeepEquals, []int{11, 13})
+	c.Assert(pids(descendants(procs, 1)), jc.DeepEquals, []int{10, 12, 20, 11, 14, 13})
+	c.Assert(descendants(procs, 20), gc.HasLen, 0)
+	c.Assert(pids(descendants(procs, 0)), jc.DeepEquals, []int{1, 10, 12, 20, 11, 14, 13})
+}
+
+func (*descendantsSuite) TestDescendantsCycle(c *gc.C) {
+	// A reused process ID can make a process
+	// appear to be its own ancestor.
+	procs := []Process{
+		{PID: 10, PPID: 11},
+		{PID: 11, PPID: 10},
+	}
+	c.Assert(pids(descendants(procs, 10)), jc.DeepEquals, []int{11})
+}
@@ -0,0 +1,83 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package process
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+
+	"github.com/juju/utils/v3/vfs"
+)
+
+const procRoot = "/proc"
+
+func list() ([]Process, error) {
+	return listProc(vfs.OS, procRoot)
+}
+
+// listProc lists the processes described in the proc
+// filesystem mounted at root in fsys.
+func listProc(fsys vfs.FS, root string) ([]Process, error) {
+	entries, err := fsys.ReadDir(root)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var procs []Process
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		p, err := readProc(fsys, path.Join(root, entry.Name()))
+		if os.IsNotExist(err) {
+			// The process has exited.
+			continue
+		}
+		if err != nil {
+			return nil, errors.Annotatef(err, "process %d", pid)
+		}
+		p.PID = pid
+		procs = append(procs, p)
+	}
+	return procs, nil
+}
+
+// readProc reads the name and parent of a process from its stat file,
+// and its command line, if it can be read, from its cmdline file.
+func readProc(fsys vfs.FS, dir string) (Process, error) {
+	data, err := vfs.ReadFile(fsys, path.Join(dir, "stat"))
+	if err != nil {
+		return Process{}, err
+	}
+	// The stat file starts "pid (name) state ppid", where the
+	// name may itself contain spaces and parentheses.
+	stat := string(data)
+	open, close := strings.IndexByte(stat, '('), strings.LastIndexByte(stat, ')')
+	if open < 0 || close < open {
+		return Process{}, errors.Errorf("malformed stat %q", stat)
+	}
+	fields := strings.Fields(stat[close+1:])
+	if len(fields) < 2 {
+		return Process{}, errors.Errorf("malformed stat %q", stat)
+	}
+	ppid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return Process{}, errors.Errorf("malformed stat %q", stat)
+	}
+	p := Process{
+		PPID: ppid,
+		Name: stat[open+1 : close],
+	}
+	data, err = vfs.ReadFile(fsys, path.Join(dir, "cmdline"))
+	if err == nil && len(data) > 0 {
+		data = bytes.TrimSuffix(data, []byte{0})
+		p.Cmdline = strings.Split(string(data), "\x00")
+	}
+	return p, nil
+}
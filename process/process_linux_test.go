@@ -0,0 +1,71 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package process
+
+import (
+	"path"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/vfs"
+)
+
+type procSuite struct {
+	fs *vfs.MemFS
+}
+
+var _ = gc.Suite(&procSuite{})
+
+func (s *procSuite) SetUpTest(c *gc.C) {
+	s.fs = vfs.NewMemFS()
+	err := s.fs.MkdirAll("/proc", 0755)
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *procSuite) writeFile(c *gc.C, name, contents string) {
+	err := s.fs.MkdirAll(path.Dir(name), 0755)
+	c.Assert(err, jc.ErrorIsNil)
+	err = vfs.WriteFile(s.fs, name, []byte(contents), 0644)
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *procSuite) TestList(c *gc.C) {
+	s.writeFile(c, "/proc/1/stat", "1 (systemd) S 0 1 1 0 -1 4194560\n")
+	s.writeFile(c, "/proc/1/cmdline", "/sbin/init\x00splash\x00")
+	s.writeFile(c, "/proc/2/stat", "2 (kthreadd) S 0 0 0 0 -1 2129984\n")
+	s.writeFile(c, "/proc/2/cmdline", "")
+	s.writeFile(c, "/proc/42/stat", "42 (a (b) c) R 1 42 42 0 -1 4194304\n")
+	s.writeFile(c, "/proc/42/cmdline", "a (b) c\x00--flag\x00\x00")
+	// Entries that are not processes are ignored.
+	s.writeFile(c, "/proc/self/stat", "42 (a (b) c) R 1 42 42 0 -1 4194304\n")
+	s.writeFile(c, "/proc/meminfo", "MemTotal: 1 kB\n")
+	// A process that exits while being listed is left out.
+	err := s.fs.MkdirAll("/proc/43", 0755)
+	c.Assert(err, jc.ErrorIsNil)
+
+	procs, err := listProc(s.fs, "/proc")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(procs, jc.DeepEquals, []Process{{
+		PID:     1,
+		PPID:    0,
+		Name:    "systemd",
+		Cmdline: []string{"/sbin/init", "splash"},
+	}, {
+		PID:  2,
+		PPID: 0,
+		Name: "kthreadd",
+	}, {
+		PID:     42,
+		PPID:    1,
+		Name:    "a (b) c",
+		Cmdline: []string{"a (b) c", "--flag", ""},
+	}})
+}
+
+func (s *procSuite) TestListMalformedStat(c *gc.C) {
+	s.writeFile(c, "/proc/1/stat", "1 systemd S 0\n")
+	_, err := listProc(s.fs, "/proc")
+	c.Assert(err, gc.ErrorMatches, `process 1: malformed stat "1 systemd S 0\\n"`)
+}
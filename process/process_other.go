@@ -0,0 +1,17 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+//go:build !linux && !darwin && !windows
+// +build !linux,!darwin,!windows
+
+package process
+
+import (
+	"runtime"
+
+	"github.com/juju/errors"
+)
+
+func list() ([]Process, error) {
+	return nil, errors.NotSupportedf("listing processes on %s", runtime.GOOS)
+}
@@ -0,0 +1,70 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package process_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/process"
+)
+
+type processSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&processSuite{})
+
+func (s *processSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	switch runtime.GOOS {
+	case "linux", "darwin", "windows":
+	default:
+		c.Skip("listing processes not supported on " + runtime.GOOS)
+	}
+}
+
+func (*processSuite) TestFindSelf(c *gc.C) {
+	p, err := process.Find(os.Getpid())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(p.PID, gc.Equals, os.Getpid())
+	c.Assert(p.PPID, gc.Equals, os.Getppid())
+	c.Assert(p.Cmdline, gc.Not(gc.HasLen), 0)
+	c.Assert(filepath.Base(p.Cmdline[0]), gc.Equals, filepath.Base(os.Args[0]))
+}
+
+func (*processSuite) TestFindByName(c *gc.C) {
+	self, err := process.Find(os.Getpid())
+	c.Assert(err, jc.ErrorIsNil)
+	procs, err := process.FindByName(self.Name)
+	c.Assert(err, jc.ErrorIsNil)
+	var found bool
+	for _, p := range procs {
+		c.Check(p.Name, gc.Equals, self.Name)
+		found = found || p.PID == self.PID
+	}
+	c.Assert(found, jc.IsTrue)
+}
+
+func (*processSuite) TestChildren(c *gc.C) {
+	children, err := process.Children(os.Getppid())
+	c.Assert(err, jc.ErrorIsNil)
+	var found bool
+	for _, p := range children {
+		c.Check(p.PPID, gc.Equals, os.Getppid())
+		found = found || p.PID == os.Getpid()
+	}
+	c.Assert(found, jc.IsTrue)
+}
+
+func (*processSuite) TestFindNotFound(c *gc.C) {
+	_, err := process.Find(-1)
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+}
@@ -0,0 +1,74 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+//go:build !windows
+// +build !windows
+
+package process
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/juju/errors"
+)
+
+func signal(pid int, sig os.Signal) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	defer p.Release()
+	return p.Signal(sig)
+}
+
+// Group holds a command and the processes it starts, so that they
+// can be signalled together. On Unix, it is a process group.
+type Group struct {
+	pgid int
+}
+
+// StartGroup starts cmd as the leader of a new process group, which
+// the processes it starts join unless they start groups of their own.
+func StartGroup(cmd *exec.Cmd) (*Group, error) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+	cmd.SysProcAttr.Pgid = 0
+	if err := cmd.Start(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &Group{pgid: cmd.Process.Pid}, nil
+}
+
+// Signal sends sig to every process in the group. It returns
+// os.ErrProcessDone if none remain.
+func (g *Group) Signal(sig os.Signal) error {
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return errors.NotSupportedf("signal %v", sig)
+	}
+	// A negative process ID signals the process group.
+	err := syscall.Kill(-g.pgid, s)
+	if err == syscall.ESRCH {
+		return os.ErrProcessDone
+	}
+	return errors.Trace(err)
+}
+
+// Kill kills every process in the group. It is not an
+// error if none remain.
+func (g *Group) Kill() error {
+	if err := g.Signal(os.Kill); err != nil && err != os.ErrProcessDone {
+		return errors.Trace(err)
+	}
+	return nil
+}
+
+// Close releases the resources held by the group. It does not
+// kill the processes in it.
+func (g *Group) Close() error {
+	return nil
+}
@@ -0,0 +1,130 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+//go:build !windows
+// +build !windows
+
+package process_test
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/process"
+)
+
+type unixSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&unixSuite{})
+
+// startTree starts a shell that starts a subshell that starts a
+// sleep, returning the command and the ID of the sleep process.
+func startTree(c *gc.C, start func(*exec.Cmd) error) (*exec.Cmd, int) {
+	cmd := exec.Command("/bin/sh", "-c", `(sleep 60 & echo $!; wait) & wait`)
+	stdout, err := cmd.StdoutPipe()
+	c.Assert(err, jc.ErrorIsNil)
+	err = start(cmd)
+	c.Assert(err, jc.ErrorIsNil)
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	c.Assert(err, jc.ErrorIsNil)
+	pid, err := strconv.Atoi(strings.TrimSpace(line))
+	c.Assert(err, jc.ErrorIsNil)
+	return cmd, pid
+}
+
+// waitGone waits until the process with the given ID has gone.
+func waitGone(c *gc.C, pid int) {
+	deadline := time.Now().Add(testing.LongWait)
+	for time.Now().Before(deadline) {
+		if err := syscall.Kill(pid, 0); err == syscall.ESRCH || isZombie(pid) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Fatalf("process %d still running", pid)
+}
+
+// isZombie reports whether the process with the given ID has exited
+// but not yet been reaped, as may take some time for an orphan. It
+// always returns false where there is no proc filesystem.
+func isZombie(pid int) bool {
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return false
+	}
+	stat := string(data)
+	fields := strings.Fields(stat[strings.LastIndexByte(stat, ')')+1:])
+	return len(fields) > 0 && fields[0] == "Z"
+}
+
+func (*unixSuite) TestDescendants(c *gc.C) {
+	cmd, sleepPID := startTree(c, (*exec.Cmd).Start)
+	defer process.KillTree(cmd.Process.Pid)
+	procs, err := process.Descendants(cmd.Process.Pid)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(procs, gc.HasLen, 2)
+	c.Assert(procs[0].PPID, gc.Equals, cmd.Process.Pid)
+	c.Assert(procs[1].PID, gc.Equals, sleepPID)
+	c.Assert(procs[1].PPID, gc.Equals, procs[0].PID)
+	c.Assert(procs[1].Cmdline, jc.DeepEquals, []string{"sleep", "60"})
+}
+
+func (*unixSuite) TestKillTree(c *gc.C) {
+	cmd, sleepPID := startTree(c, (*exec.Cmd).Start)
+	err := process.KillTree(cmd.Process.Pid)
+	c.Assert(err, jc.ErrorIsNil)
+	err = cmd.Wait()
+	c.Assert(err, gc.ErrorMatches, "signal: killed")
+	waitGone(c, sleepPID)
+}
+
+func (*unixSuite) TestSignal(c *gc.C) {
+	cmd := exec.Command("/bin/sh", "-c", "exec sleep 60")
+	err := cmd.Start()
+	c.Assert(err, jc.ErrorIsNil)
+	err = process.Signal(cmd.Process.Pid, syscall.SIGTERM)
+	c.Assert(err, jc.ErrorIsNil)
+	err = cmd.Wait()
+	c.Assert(err, gc.ErrorMatches, "signal: terminated")
+	err = process.Signal(cmd.Process.Pid, syscall.SIGTERM)
+	c.Assert(err, gc.Equals, os.ErrProcessDone)
+}
+
+func (*unixSuite) TestGroupKill(c *gc.C) {
+	var group *process.Group
+	cmd, sleepPID := startTree(c, func(cmd *exec.Cmd) (err error) {
+		group, err = process.StartGroup(cmd)
+		return err
+	})
+	defer group.Close()
+
+	// Kill the shell on its own first, leaving its
+	// children orphaned but still in the group.
+	err := cmd.Process.Kill()
+	c.Assert(err, jc.ErrorIsNil)
+	cmd.Wait()
+	time.Sleep(testing.ShortWait)
+	err = syscall.Kill(sleepPID, 0)
+	c.Assert(err, jc.ErrorIsNil)
+
+	err = group.Kill()
+	c.Assert(err, jc.ErrorIsNil)
+	waitGone(c, sleepPID)
+
+	// Killing the group again is not an error.
+	err = group.Kill()
+	c.Assert(err, jc.ErrorIsNil)
+}
@@ -0,0 +1,139 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package process
+
+import (
+	"os"
+	"os/exec"
+	"unsafe"
+
+	"github.com/juju/errors"
+	"golang.org/x/sys/windows"
+)
+
+func list() ([]Process, error) {
+	snapshot, err := windows.CreateToolhelp32Snapshot(windows.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer windows.CloseHandle(snapshot)
+	var procs []Process
+	entry := windows.ProcessEntry32{Size: uint32(unsafe.Sizeof(windows.ProcessEntry32{}))}
+	for err = windows.Process32First(snapshot, &entry); err == nil; err = windows.Process32Next(snapshot, &entry) {
+		pid := int(entry.ProcessID)
+		procs = append(procs, Process{
+			PID:     pid,
+			PPID:    int(entry.ParentProcessID),
+			Name:    windows.UTF16ToString(entry.ExeFile[:]),
+			Cmdline: cmdline(pid),
+		})
+	}
+	if err != windows.ERROR_NO_MORE_FILES {
+		return nil, errors.Trace(err)
+	}
+	return procs, nil
+}
+
+// cmdline returns the command line of the process with the given
+// ID, or nil if it cannot be read.
+func cmdline(pid int) []string {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return nil
+	}
+	defer windows.CloseHandle(h)
+	// The information is a UNICODE_STRING followed by
+	// the buffer to which it points.
+	buf := make([]byte, 4096)
+	for {
+		var n uint32
+		err = windows.NtQueryInformationProcess(h, windows.ProcessCommandLineInformation, unsafe.Pointer(&buf[0]), uint32(len(buf)), &n)
+		if err == nil {
+			break
+		}
+		if err != windows.STATUS_INFO_LENGTH_MISMATCH || int(n) <= len(buf) {
+			return nil
+		}
+		buf = make([]byte, n)
+	}
+	s := (*windows.NTUnicodeString)(unsafe.Pointer(&buf[0]))
+	args, err := windows.DecomposeCommandLine(s.String())
+	if err != nil || len(args) == 0 {
+		return nil
+	}
+	return args
+}
+
+func signal(pid int, sig os.Signal) error {
+	if sig != os.Kill {
+		return errors.NotSupportedf("signal %v", sig)
+	}
+	h, err := windows.OpenProcess(windows.PROCESS_TERMINATE, false, uint32(pid))
+	if err == windows.ERROR_INVALID_PARAMETER {
+		// There is no process with the ID.
+		return os.ErrProcessDone
+	}
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer windows.CloseHandle(h)
+	return errors.Trace(windows.TerminateProcess(h, 1))
+}
+
+// Group holds a command and the processes it starts, so that they
+// can be killed together. On Windows, it is a job object.
+type Group struct {
+	job windows.Handle
+}
+
+// StartGroup starts cmd in a new job object, to which the processes
+// it starts belong unless they break away from it. Processes started
+// by cmd before it is assigned to the job, immediately after it
+// starts, do not belong to the job.
+func StartGroup(cmd *exec.Cmd) (*Group, error) {
+	job, err := windows.CreateJobObject(nil, nil)
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot create job object")
+	}
+	if err := cmd.Start(); err != nil {
+		windows.CloseHandle(job)
+		return nil, errors.Trace(err)
+	}
+	if err := assignProcess(job, cmd.Process.Pid); err != nil {
+		cmd.Process.Kill()
+		windows.CloseHandle(job)
+		return nil, errors.Annotate(err, "cannot assign process to job object")
+	}
+	return &Group{job: job}, nil
+}
+
+func assignProcess(job windows.Handle, pid int) error {
+	h, err := windows.OpenProcess(windows.PROCESS_SET_QUOTA|windows.PROCESS_TERMINATE, false, uint32(pid))
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(h)
+	return windows.AssignProcessToJobObject(job, h)
+}
+
+// Signal sends sig to every process in the group. Only
+// os.Kill is supported.
+func (g *Group) Signal(sig os.Signal) error {
+	if sig != os.Kill {
+		return errors.NotSupportedf("signal %v", sig)
+	}
+	return g.Kill()
+}
+
+// Kill kills every process in the group. It is not an
+// error if none remain.
+func (g *Group) Kill() error {
+	return errors.Trace(windows.TerminateJobObject(g.job, 1))
+}
+
+// Close releases the resources held by the group. It does not
+// kill the processes in it.
+func (g *Group) Close() error {
+	return errors.Trace(windows.CloseHandle(g.job))
+}
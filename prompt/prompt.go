@@ -0,0 +1,201 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package prompt asks the user questions at a terminal: yes/no
+// questions, choices from a list and free text checked by a
+// validator, with default answers and timeouts. Answers can be
+// scripted in tests with Script.
+package prompt
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/juju/clock"
+	"github.com/juju/errors"
+)
+
+// ReadLineWriter is the terminal through which questions are asked.
+// It is implemented by *terminal.Terminal from
+// golang.org/x/crypto/ssh/terminal.
+type ReadLineWriter interface {
+	io.Writer
+
+	// ReadLine reads a line of input, without its line ending.
+	ReadLine() (string, error)
+}
+
+// Prompt describes a question.
+type Prompt struct {
+	// Question is written before the answer is read. It should
+	// end with any punctuation and space wanted before the answer.
+	Question string
+
+	// Default, if not empty, is the answer used when an empty line
+	// is entered or when Timeout expires.
+	Default string
+
+	// Retry is written before the answer is read again when an
+	// answer is not valid. If it is empty, the reason the answer
+	// is not valid is written, followed by the question.
+	Retry string
+
+	// Timeout, if positive, limits the time allowed for a valid
+	// answer. When it expires, the default answer is used, or the
+	// error satisfies errors.IsTimeout if there is none.
+	Timeout time.Duration
+}
+
+// Prompter asks questions through a terminal, one at a time.
+type Prompter struct {
+	rw    ReadLineWriter
+	clock clock.Clock
+
+	// pending receives the result of a read that was still
+	// in progress when a timeout expired, so that the answer
+	// goes to the next question rather than being lost.
+	pending chan readResult
+}
+
+type readResult struct {
+	line string
+	err  error
+}
+
+// New returns a Prompter that asks questions through rw. If clk is
+// nil, the wall clock is used to time out questions.
+func New(rw ReadLineWriter, clk clock.Clock) *Prompter {
+	if clk == nil {
+		clk = clock.WallClock
+	}
+	return &Prompter{
+		rw:    rw,
+		clock: clk,
+	}
+}
+
+// Text asks for free text. If validate is not nil, it is called with
+// each answer, and the question is asked again while it returns an
+// error.
+func (p *Prompter) Text(prompt Prompt, validate func(string) error) (string, error) {
+	return p.ask(prompt, func(answer string) (string, error) {
+		if validate != nil {
+			if err := validate(answer); err != nil {
+				return "", err
+			}
+		}
+		return answer, nil
+	})
+}
+
+// Confirm asks a yes/no question, accepting "yes", "y", "no" or "n"
+// in any case. The default answer, if any, must be one of those.
+func (p *Prompter) Confirm(prompt Prompt) (bool, error) {
+	if prompt.Retry == "" {
+		prompt.Retry = "Please type 'yes' or 'no': "
+	}
+	answer, err := p.ask(prompt, func(answer string) (string, error) {
+		switch strings.ToLower(answer) {
+		case "yes", "y":
+			return "yes", nil
+		case "no", "n":
+			return "no", nil
+		}
+		return "", errors.NotValidf("answer %q", answer)
+	})
+	return answer == "yes", err
+}
+
+// Choice asks for one of the given choices, which are matched
+// without regard to case, and returns the choice as given.
+func (p *Prompter) Choice(prompt Prompt, choices []string) (string, error) {
+	if len(choices) == 0 {
+		return "", errors.NotValidf("empty choices")
+	}
+	if prompt.Retry == "" {
+		prompt.Retry = "Please type " + quoteList(choices) + ": "
+	}
+	return p.ask(prompt, func(answer string) (string, error) {
+		for _, choice := range choices {
+			if strings.EqualFold(answer, choice) {
+				return choice, nil
+			}
+		}
+		return "", errors.NotValidf("answer %q", answer)
+	})
+}
+
+// quoteList returns the given words quoted,
+// as in "'a', 'b' or 'c'".
+func quoteList(words []string) string {
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		quoted[i] = "'" + word + "'"
+	}
+	if len(quoted) == 1 {
+		return quoted[0]
+	}
+	return strings.Join(quoted[:len(quoted)-1], ", ") + " or " + quoted[len(quoted)-1]
+}
+
+// ask asks a question until parse accepts the answer.
+func (p *Prompter) ask(prompt Prompt, parse func(string) (string, error)) (string, error) {
+	var timeout <-chan time.Time
+	if prompt.Timeout > 0 {
+		timer := p.clock.NewTimer(prompt.Timeout)
+		defer timer.Stop()
+		timeout = timer.Chan()
+	}
+	if _, err := io.WriteString(p.rw, prompt.Question); err != nil {
+		return "", errors.Trace(err)
+	}
+	for {
+		answer, err := p.readLine(timeout)
+		if errors.IsTimeout(err) && prompt.Default != "" {
+			// End the unanswered line.
+			fmt.Fprintln(p.rw)
+			return parse(prompt.Default)
+		}
+		if err != nil {
+			return "", errors.Trace(err)
+		}
+		answer = strings.TrimSpace(answer)
+		if answer == "" && prompt.Default != "" {
+			answer = prompt.Default
+		}
+		result, err := parse(answer)
+		if err == nil {
+			return result, nil
+		}
+		retry := prompt.Retry
+		if retry == "" {
+			retry = err.Error() + "\n" + prompt.Question
+		}
+		if _, err := io.WriteString(p.rw, retry); err != nil {
+			return "", errors.Trace(err)
+		}
+	}
+}
+
+// readLine reads a line, giving up when timeout fires.
+func (p *Prompter) readLine(timeout <-chan time.Time) (string, error) {
+	if timeout == nil && p.pending == nil {
+		return p.rw.ReadLine()
+	}
+	if p.pending == nil {
+		p.pending = make(chan readResult, 1)
+		go func(pending chan<- readResult) {
+			line, err := p.rw.ReadLine()
+			pending <- readResult{line, err}
+		}(p.pending)
+	}
+	select {
+	case r := <-p.pending:
+		p.pending = nil
+		return r.line, r.err
+	case <-timeout:
+		return "", errors.Timeoutf("waiting for answer")
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package prompt_test
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/juju/clock/testclock"
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/prompt"
+)
+
+type promptSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&promptSuite{})
+
+func (*promptSuite) TestText(c *gc.C) {
+	script := prompt.NewScript("  bob ")
+	name, err := prompt.New(script, nil).Text(prompt.Prompt{Question: "Name: "}, nil)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(name, gc.Equals, "bob")
+	c.Assert(script.Written(), gc.Equals, "Name: ")
+}
+
+func (*promptSuite) TestTextValidate(c *gc.C) {
+	script := prompt.NewScript("", "x", "bob")
+	validate := func(s string) error {
+		if len(s) < 2 {
+			return errors.Errorf("name %q too short", s)
+		}
+		return nil
+	}
+	name, err := prompt.New(script, nil).Text(prompt.Prompt{Question: "Name: "}, validate)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(name, gc.Equals, "bob")
+	c.Assert(script.Written(), gc.Equals, ""+
+		"Name: "+
+		"name \"\" too short\nName: "+
+		"name \"x\" too short\nName: ")
+}
+
+func (*promptSuite) TestTextDefault(c *gc.C) {
+	script := prompt.NewScript("")
+	name, err := prompt.New(script, nil).Text(prompt.Prompt{
+		Question: "Name [bob]: ",
+		Default:  "bob",
+	}, nil)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(name, gc.Equals, "bob")
+}
+
+func (*promptSuite) TestConfirm(c *gc.C) {
+	for i, test := range []struct {
+		answers []string
+		expect  bool
+		written string
+	}{{
+		answers: []string{"yes"},
+		expect:  true,
+		written: "Continue? ",
+	}, {
+		answers: []string{"N"},
+		written: "Continue? ",
+	}, {
+		answers: []string{"maybe", "", "Y"},
+		expect:  true,
+		written: "Continue? Please type 'yes' or 'no': Please type 'yes' or 'no': ",
+	}} {
+		c.Logf("test %d: %q", i, test.answers)
+		script := prompt.NewScript(test.answers...)
+		ok, err := prompt.New(script, nil).Confirm(prompt.Prompt{Question: "Continue? "})
+		c.Check(err, jc.ErrorIsNil)
+		c.Check(ok, gc.Equals, test.expect)
+		c.Check(script.Written(), gc.Equals, test.written)
+		c.Check(script.Remaining(), gc.Equals, 0)
+	}
+}
+
+func (*promptSuite) TestConfirmDefault(c *gc.C) {
+	script := prompt.NewScript("")
+	ok, err := prompt.New(script, nil).Confirm(prompt.Prompt{
+		Question: "Continue? [Y/n] ",
+		Default:  "y",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(ok, jc.IsTrue)
+}
+
+func (*promptSuite) TestChoice(c *gc.C) {
+	script := prompt.NewScript("purple", "GREEN")
+	choice, err := prompt.New(script, nil).Choice(prompt.Prompt{
+		Question: "Colour? ",
+	}, []string{"red", "green", "blue"})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(choice, gc.Equals, "green")
+	c.Assert(script.Written(), gc.Equals, "Colour? Please type 'red', 'green' or 'blue': ")
+}
+
+func (*promptSuite) TestChoiceRetry(c *gc.C) {
+	script := prompt.NewScript("purple", "red")
+	choice, err := prompt.New(script, nil).Choice(prompt.Prompt{
+		Question: "Colour? ",
+		Retry:    "Try again: ",
+	}, []string{"red"})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(choice, gc.Equals, "red")
+	c.Assert(script.Written(), gc.Equals, "Colour? Try again: ")
+}
+
+func (*promptSuite) TestChoiceEmpty(c *gc.C) {
+	_, err := prompt.New(prompt.NewScript(), nil).Choice(prompt.Prompt{}, nil)
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+}
+
+func (*promptSuite) TestEOF(c *gc.C) {
+	_, err := prompt.New(prompt.NewScript(), nil).Confirm(prompt.Prompt{Question: "Continue? "})
+	c.Assert(errors.Cause(err), gc.Equals, io.EOF)
+}
+
+// slowTerminal is a ReadLineWriter whose lines
+// are sent by the test.
+type slowTerminal struct {
+	mu      sync.Mutex
+	written bytes.Buffer
+	lines   chan string
+}
+
+func (t *slowTerminal) ReadLine() (string, error) {
+	return <-t.lines, nil
+}
+
+func (t *slowTerminal) Write(data []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.written.Write(data)
+}
+
+func (*promptSuite) TestTimeout(c *gc.C) {
+	clock := testclock.NewClock(time.Now())
+	term := &slowTerminal{lines: make(chan string)}
+	p := prompt.New(term, clock)
+
+	result := make(chan error)
+	go func() {
+		_, err := p.Confirm(prompt.Prompt{
+			Question: "Continue? ",
+			Timeout:  time.Minute,
+		})
+		result <- err
+	}()
+	err := clock.WaitAdvance(time.Minute, testing.LongWait, 1)
+	c.Assert(err, jc.ErrorIsNil)
+	select {
+	case err := <-result:
+		c.Assert(err, jc.Satisfies, errors.IsTimeout)
+	case <-time.After(testing.LongWait):
+		c.Fatalf("timed out waiting for prompt")
+	}
+
+	// A line typed after the timeout answers the next question.
+	go func() {
+		term.lines <- "red"
+	}()
+	choice, err := p.Choice(prompt.Prompt{Question: "Colour? "}, []string{"red"})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(choice, gc.Equals, "red")
+}
+
+func (*promptSuite) TestTimeoutDefault(c *gc.C) {
+	clock := testclock.NewClock(time.Now())
+	term := &slowTerminal{lines: make(chan string)}
+	p := prompt.New(term, clock)
+
+	result := make(chan bool)
+	go func() {
+		ok, err := p.Confirm(prompt.Prompt{
+			Question: "Continue? [y/N] ",
+			Default:  "n",
+			Timeout:  time.Minute,
+		})
+		c.Check(err, jc.ErrorIsNil)
+		result <- ok
+	}()
+	err := clock.WaitAdvance(time.Minute, testing.LongWait, 1)
+	c.Assert(err, jc.ErrorIsNil)
+	select {
+	case ok := <-result:
+		c.Assert(ok, jc.IsFalse)
+	case <-time.After(testing.LongWait):
+		c.Fatalf("timed out waiting for prompt")
+	}
+	term.mu.Lock()
+	defer term.mu.Unlock()
+	c.Assert(term.written.String(), gc.Equals, "Continue? [y/N] \n")
+}
@@ -0,0 +1,58 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package prompt
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// Script is a ReadLineWriter that answers questions from
+// a script, for use in tests.
+type Script struct {
+	mu      sync.Mutex
+	answers []string
+	written bytes.Buffer
+}
+
+// NewScript returns a Script that gives the
+// answers in order, and then io.EOF.
+func NewScript(answers ...string) *Script {
+	return &Script{answers: answers}
+}
+
+// ReadLine implements ReadLineWriter.ReadLine.
+func (s *Script) ReadLine() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.answers) == 0 {
+		return "", io.EOF
+	}
+	answer := s.answers[0]
+	s.answers = s.answers[1:]
+	return answer, nil
+}
+
+// Write implements io.Writer.
+func (s *Script) Write(data []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.written.Write(data)
+}
+
+// Written returns everything written so far,
+// such as the questions asked.
+func (s *Script) Written() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.written.String()
+}
+
+// Remaining returns the number of answers not yet read.
+func (s *Script) Remaining() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.answers)
+}
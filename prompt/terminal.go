@@ -0,0 +1,28 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package prompt
+
+import (
+	"os"
+
+	"github.com/juju/errors"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// OpenTerminal puts standard input, if it is a terminal, into raw
+// mode and returns a ReadLineWriter for it, with a function that
+// restores the terminal's original mode. If standard input is not a
+// terminal, it returns nil and no error.
+func OpenTerminal() (ReadLineWriter, func(), error) {
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		return nil, nil, nil
+	}
+	oldState, err := terminal.MakeRaw(fd)
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	cleanup := func() { terminal.Restore(fd, oldState) }
+	return terminal.NewTerminal(os.Stdin, ""), cleanup, nil
+}
@@ -0,0 +1,14 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package proxy
+
+var (
+	PACLookupHost      = &pacLookupHost
+	PACMyIPAddress     = &pacMyIPAddress
+	GNOMEProxies       = gnomeProxies
+	ParseScutilProxies = parseScutilProxies
+	WindowsProxies     = windowsProxies
+)
+
+var MaxPACSize = &maxPACSize
@@ -0,0 +1,853 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PAC holds a parsed proxy auto-config file.
+//
+// PAC files are JavaScript programs, but in practice they use only a
+// small part of the language. Rather than embedding a full JavaScript
+// engine, PAC files are evaluated by a small interpreter that supports
+// function declarations, var, if/else, return, the usual comparison,
+// logical, arithmetic and ternary operators, string and number values,
+// the string methods and properties commonly used on hosts and URLs,
+// and the standard PAC helper functions other than the date and time
+// range functions. Anything else is reported as an error when the file
+// is parsed or evaluated.
+//
+// Only that subset is supported. Constructs found in some real-world
+// PAC files, including loops, switch statements, arrays, object and
+// regular expression literals, try/catch, compound assignment and
+// increment operators, and dateRange, timeRange and weekdayRange, are
+// not, so callers should be prepared for ParsePAC to fail and fall back
+// to other proxy settings. Deeply nested scripts are also rejected.
+//
+// A PAC may be used concurrently, but calls to FindProxyForURL
+// are serialised.
+type PAC struct {
+	// mu guards the fields below it, as scripts
+	// may assign to global variables.
+	mu sync.Mutex
+
+	globals *pacScope
+
+	// depth holds the current function call depth.
+	depth int
+}
+
+// ParsePAC parses the given proxy auto-config script. The script
+// must define a FindProxyForURL function.
+func ParsePAC(src string) (*PAC, error) {
+	p := &pacParser{lex: newPACLexer(src)}
+	p.next()
+	prog, err := p.parseProgram()
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse PAC file: %v", err)
+	}
+	globals := newPACScope(nil)
+	for name, f := range pacBuiltins {
+		globals.declare(name, f)
+	}
+	pac := &PAC{globals: globals}
+	if _, err := pac.exec(prog, globals); err != nil {
+		return nil, fmt.Errorf("cannot evaluate PAC file: %v", err)
+	}
+	if _, ok := globals.lookup("FindProxyForURL"); !ok {
+		return nil, fmt.Errorf("PAC file does not define FindProxyForURL")
+	}
+	return pac, nil
+}
+
+// pacFetchTimeout bounds the time taken
+// to fetch a PAC file over HTTP.
+const pacFetchTimeout = 30 * time.Second
+
+// maxPACSize holds the size of the largest PAC file accepted.
+var maxPACSize int64 = 1 << 20
+
+// FetchPAC retrieves and parses the proxy auto-config file at the given
+// URL. Both http(s) and file URLs are supported. Files larger than
+// 1MiB are rejected, and fetching over HTTP times out after 30
+// seconds.
+func FetchPAC(pacURL string) (*PAC, error) {
+	u, err := url.Parse(pacURL)
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	switch u.Scheme {
+	case "file":
+		var f *os.File
+		f, err = os.Open(u.Path)
+		if err != nil {
+			break
+		}
+		defer f.Close()
+		data, err = readPAC(f)
+	case "http", "https":
+		client := &http.Client{Timeout: pacFetchTimeout}
+		var resp *http.Response
+		resp, err = client.Get(pacURL)
+		if err != nil {
+			break
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("cannot fetch PAC file %q: %s", u.Redacted(), resp.Status)
+		}
+		data, err = readPAC(resp.Body)
+	default:
+		return nil, fmt.Errorf("unsupported PAC file URL scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch PAC file %q: %v", pacURL, err)
+	}
+	return ParsePAC(string(data))
+}
+
+// readPAC reads a PAC file from r,
+// failing if it is larger than maxPACSize.
+func readPAC(r io.Reader) ([]byte, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, maxPACSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxPACSize {
+		return nil, fmt.Errorf("PAC file larger than %d bytes", maxPACSize)
+	}
+	return data, nil
+}
+
+// FindProxyForURL calls the script's FindProxyForURL function for the
+// given URL and returns its result, a semicolon-separated list of
+// entries such as "PROXY 10.0.0.1:3128; DIRECT".
+func (p *PAC) FindProxyForURL(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	f, _ := p.globals.lookup("FindProxyForURL")
+	result, err := p.call(f, []pacValue{rawURL, u.Hostname()})
+	if err != nil {
+		return "", fmt.Errorf("FindProxyForURL: %v", err)
+	}
+	s, ok := result.(string)
+	if !ok {
+		return "", fmt.Errorf("FindProxyForURL returned %s, not a string", pacTypeOf(result))
+	}
+	return s, nil
+}
+
+// SettingsForURL evaluates the script for the given URL and returns
+// the resulting proxy in a Settings value. The first PROXY (or HTTP,
+// HTTPS or SOCKS) entry returned by the script is used for the field
+// corresponding to the URL's scheme; if the script returns DIRECT, or
+// the scheme is not one that Settings describes, the returned settings
+// are empty.
+func (p *PAC) SettingsForURL(rawURL string) (Settings, error) {
+	result, err := p.FindProxyForURL(rawURL)
+	if err != nil {
+		return Settings{}, err
+	}
+	proxyURL := ""
+	for _, entry := range strings.Split(result, ";") {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+		kind := strings.ToUpper(fields[0])
+		if kind == "DIRECT" {
+			break
+		}
+		if len(fields) != 2 {
+			return Settings{}, fmt.Errorf("invalid PAC result entry %q", strings.TrimSpace(entry))
+		}
+		switch kind {
+		case "PROXY", "HTTP":
+			proxyURL = "http://" + fields[1]
+		case "HTTPS":
+			proxyURL = "https://" + fields[1]
+		case "SOCKS", "SOCKS5":
+			proxyURL = "socks5://" + fields[1]
+		case "SOCKS4":
+			proxyURL = "socks4://" + fields[1]
+		default:
+			return Settings{}, fmt.Errorf("invalid PAC result entry %q", strings.TrimSpace(entry))
+		}
+		break
+	}
+	var s Settings
+	if proxyURL == "" {
+		return s, nil
+	}
+	u, _ := url.Parse(rawURL)
+	switch u.Scheme {
+	case "http":
+		s.Http = proxyURL
+	case "https":
+		s.Https = proxyURL
+	case "ftp":
+		s.Ftp = proxyURL
+	}
+	return s, nil
+}
+
+// pacValue holds a value computed by a PAC script. It is
+// one of nil (undefined or null), bool, float64, string,
+// *pacFunc or pacBuiltin.
+type pacValue interface{}
+
+// pacBuiltin is a function implemented in Go.
+type pacBuiltin func(args []pacValue) (pacValue, error)
+
+// pacFunc is a function declared in the script.
+type pacFunc struct {
+	name   string
+	params []string
+	body   []pacNode
+	scope  *pacScope
+}
+
+func pacTypeOf(v pacValue) string {
+	switch v.(type) {
+	case nil:
+		return "undefined"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	}
+	return "function"
+}
+
+func pacTruthy(v pacValue) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0 && v == v
+	case string:
+		return v != ""
+	}
+	return true
+}
+
+func pacString(v pacValue) string {
+	switch v := v.(type) {
+	case nil:
+		return "undefined"
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return v
+	}
+	return "function"
+}
+
+func pacNumber(v pacValue) float64 {
+	switch v := v.(type) {
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	case float64:
+		return v
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return nan
+		}
+		return f
+	}
+	return nan
+}
+
+var nan = func() float64 {
+	zero := 0.0
+	return zero / zero
+}()
+
+// pacLooseEquals implements the JavaScript == operator
+// for the value types supported by the interpreter.
+func pacLooseEquals(a, b pacValue) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	switch a := a.(type) {
+	case string:
+		if b, ok := b.(string); ok {
+			return a == b
+		}
+	case bool:
+		if b, ok := b.(bool); ok {
+			return a == b
+		}
+	}
+	if isPACFunc(a) || isPACFunc(b) {
+		return false
+	}
+	return pacNumber(a) == pacNumber(b)
+}
+
+func pacStrictEquals(a, b pacValue) bool {
+	if pacTypeOf(a) != pacTypeOf(b) || isPACFunc(a) {
+		return false
+	}
+	return a == b
+}
+
+func isPACFunc(v pacValue) bool {
+	switch v.(type) {
+	case *pacFunc, pacBuiltin:
+		return true
+	}
+	return false
+}
+
+// pacScope holds the variables visible to a piece of script.
+type pacScope struct {
+	parent *pacScope
+	vars   map[string]pacValue
+}
+
+func newPACScope(parent *pacScope) *pacScope {
+	return &pacScope{
+		parent: parent,
+		vars:   make(map[string]pacValue),
+	}
+}
+
+func (s *pacScope) declare(name string, v pacValue) {
+	s.vars[name] = v
+}
+
+func (s *pacScope) lookup(name string) (pacValue, bool) {
+	for ; s != nil; s = s.parent {
+		if v, ok := s.vars[name]; ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func (s *pacScope) assign(name string, v pacValue) {
+	for scope := s; scope != nil; scope = scope.parent {
+		if _, ok := scope.vars[name]; ok {
+			scope.vars[name] = v
+			return
+		}
+	}
+	// Assigning to an undeclared variable creates a global.
+	for s.parent != nil {
+		s = s.parent
+	}
+	s.vars[name] = v
+}
+
+// maxPACCallDepth bounds recursion in PAC scripts.
+const maxPACCallDepth = 100
+
+// pacReturn is used to unwind the
+// interpreter when a return statement is executed.
+type pacReturn struct {
+	value pacValue
+}
+
+// exec executes the given statements in the given scope. If a return
+// statement is executed, the returned value is non-nil.
+func (p *PAC) exec(stmts []pacNode, scope *pacScope) (*pacReturn, error) {
+	for _, stmt := range stmts {
+		ret, err := p.execStmt(stmt, scope)
+		if err != nil || ret != nil {
+			return ret, err
+		}
+	}
+	return nil, nil
+}
+
+func (p *PAC) execStmt(stmt pacNode, scope *pacScope) (*pacReturn, error) {
+	switch n := stmt.(type) {
+	case *pacFuncDecl:
+		scope.declare(n.name, &pacFunc{
+			name:   n.name,
+			params: n.params,
+			body:   n.body,
+			scope:  scope,
+		})
+	case *pacVarDecl:
+		for i, name := range n.names {
+			var v pacValue
+			if n.values[i] != nil {
+				var err error
+				if v, err = p.eval(n.values[i], scope); err != nil {
+					return nil, err
+				}
+			} else if _, ok := scope.vars[name]; ok {
+				// Redeclaring without an initialiser
+				// leaves the value unchanged.
+				continue
+			}
+			scope.declare(name, v)
+		}
+	case *pacIf:
+		cond, err := p.eval(n.cond, scope)
+		if err != nil {
+			return nil, err
+		}
+		if pacTruthy(cond) {
+			return p.execStmt(n.then, scope)
+		}
+		if n.els != nil {
+			return p.execStmt(n.els, scope)
+		}
+	case *pacBlock:
+		return p.exec(n.stmts, scope)
+	case *pacReturnStmt:
+		var v pacValue
+		if n.value != nil {
+			var err error
+			if v, err = p.eval(n.value, scope); err != nil {
+				return nil, err
+			}
+		}
+		return &pacReturn{value: v}, nil
+	case *pacExprStmt:
+		_, err := p.eval(n.expr, scope)
+		return nil, err
+	case nil:
+		// Empty statement.
+	default:
+		return nil, fmt.Errorf("unexpected statement %T", stmt)
+	}
+	return nil, nil
+}
+
+func (p *PAC) eval(expr pacNode, scope *pacScope) (pacValue, error) {
+	switch n := expr.(type) {
+	case *pacLiteral:
+		return n.value, nil
+	case *pacIdent:
+		v, ok := scope.lookup(n.name)
+		if !ok {
+			if n.name == "undefined" {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("%s is not defined", n.name)
+		}
+		return v, nil
+	case *pacAssign:
+		v, err := p.eval(n.value, scope)
+		if err != nil {
+			return nil, err
+		}
+		scope.assign(n.name, v)
+		return v, nil
+	case *pacUnary:
+		v, err := p.eval(n.operand, scope)
+		if err != nil {
+			return nil, err
+		}
+		switch n.op {
+		case "!":
+			return !pacTruthy(v), nil
+		case "-":
+			return -pacNumber(v), nil
+		case "+":
+			return pacNumber(v), nil
+		}
+	case *pacConditional:
+		cond, err := p.eval(n.cond, scope)
+		if err != nil {
+			return nil, err
+		}
+		if pacTruthy(cond) {
+			return p.eval(n.then, scope)
+		}
+		return p.eval(n.els, scope)
+	case *pacBinary:
+		return p.evalBinary(n, scope)
+	case *pacCall:
+		return p.evalCall(n, scope)
+	case *pacMember:
+		obj, err := p.eval(n.object, scope)
+		if err != nil {
+			return nil, err
+		}
+		s, ok := obj.(string)
+		if !ok || n.name != "length" {
+			return nil, fmt.Errorf("cannot get property %q of %s", n.name, pacTypeOf(obj))
+		}
+		return float64(len(s)), nil
+	}
+	return nil, fmt.Errorf("unexpected expression %T", expr)
+}
+
+func (p *PAC) evalBinary(n *pacBinary, scope *pacScope) (pacValue, error) {
+	left, err := p.eval(n.left, scope)
+	if err != nil {
+		return nil, err
+	}
+	// Logical operators short-circuit,
+	// and yield one of their operands.
+	switch n.op {
+	case "&&":
+		if !pacTruthy(left) {
+			return left, nil
+		}
+		return p.eval(n.right, scope)
+	case "||":
+		if pacTruthy(left) {
+			return left, nil
+		}
+		return p.eval(n.right, scope)
+	}
+	right, err := p.eval(n.right, scope)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return pacLooseEquals(left, right), nil
+	case "!=":
+		return !pacLooseEquals(left, right), nil
+	case "===":
+		return pacStrictEquals(left, right), nil
+	case "!==":
+		return !pacStrictEquals(left, right), nil
+	case "+":
+		_, ls := left.(string)
+		_, rs := right.(string)
+		if ls || rs {
+			return pacString(left) + pacString(right), nil
+		}
+		return pacNumber(left) + pacNumber(right), nil
+	case "-":
+		return pacNumber(left) - pacNumber(right), nil
+	case "*":
+		return pacNumber(left) * pacNumber(right), nil
+	case "/":
+		return pacNumber(left) / pacNumber(right), nil
+	case "<", ">", "<=", ">=":
+		ls, lok := left.(string)
+		rs, rok := right.(string)
+		if lok && rok {
+			return pacCompare(n.op, strings.Compare(ls, rs), 0), nil
+		}
+		l, r := pacNumber(left), pacNumber(right)
+		if l != l || r != r {
+			return false, nil
+		}
+		switch {
+		case l < r:
+			return pacCompare(n.op, -1, 0), nil
+		case l > r:
+			return pacCompare(n.op, 1, 0), nil
+		}
+		return pacCompare(n.op, 0, 0), nil
+	}
+	return nil, fmt.Errorf("unsupported operator %q", n.op)
+}
+
+func pacCompare(op string, a, b int) bool {
+	switch op {
+	case "<":
+		return a < b
+	case ">":
+		return a > b
+	case "<=":
+		return a <= b
+	}
+	return a >= b
+}
+
+func (p *PAC) evalCall(n *pacCall, scope *pacScope) (pacValue, error) {
+	args := make([]pacValue, len(n.args))
+	evalArgs := func() error {
+		for i, arg := range n.args {
+			v, err := p.eval(arg, scope)
+			if err != nil {
+				return err
+			}
+			args[i] = v
+		}
+		return nil
+	}
+	if m, ok := n.fn.(*pacMember); ok {
+		// Method call.
+		obj, err := p.eval(m.object, scope)
+		if err != nil {
+			return nil, err
+		}
+		if err := evalArgs(); err != nil {
+			return nil, err
+		}
+		s, ok := obj.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot call method %q of %s", m.name, pacTypeOf(obj))
+		}
+		return pacStringMethod(s, m.name, args)
+	}
+	f, err := p.eval(n.fn, scope)
+	if err != nil {
+		return nil, err
+	}
+	if err := evalArgs(); err != nil {
+		return nil, err
+	}
+	return p.call(f, args)
+}
+
+func (p *PAC) call(f pacValue, args []pacValue) (pacValue, error) {
+	switch f := f.(type) {
+	case pacBuiltin:
+		return f(args)
+	case *pacFunc:
+		if p.depth >= maxPACCallDepth {
+			return nil, fmt.Errorf("maximum call depth exceeded")
+		}
+		p.depth++
+		defer func() { p.depth-- }()
+		scope := newPACScope(f.scope)
+		for i, param := range f.params {
+			var v pacValue
+			if i < len(args) {
+				v = args[i]
+			}
+			scope.declare(param, v)
+		}
+		ret, err := p.exec(f.body, scope)
+		if err != nil || ret == nil {
+			return nil, err
+		}
+		return ret.value, nil
+	}
+	return nil, fmt.Errorf("%s is not a function", pacTypeOf(f))
+}
+
+func pacStringMethod(s, name string, args []pacValue) (pacValue, error) {
+	intArg := func(i int, def int) int {
+		if i >= len(args) || args[i] == nil {
+			return def
+		}
+		n := pacNumber(args[i])
+		if n != n {
+			return 0
+		}
+		return int(n)
+	}
+	clamp := func(i int) int {
+		if i < 0 {
+			return 0
+		}
+		if i > len(s) {
+			return len(s)
+		}
+		return i
+	}
+	switch name {
+	case "toLowerCase":
+		return strings.ToLower(s), nil
+	case "toUpperCase":
+		return strings.ToUpper(s), nil
+	case "indexOf":
+		if len(args) == 0 {
+			return float64(-1), nil
+		}
+		from := clamp(intArg(1, 0))
+		i := strings.Index(s[from:], pacString(args[0]))
+		if i < 0 {
+			return float64(-1), nil
+		}
+		return float64(from + i), nil
+	case "lastIndexOf":
+		if len(args) == 0 {
+			return float64(-1), nil
+		}
+		return float64(strings.LastIndex(s, pacString(args[0]))), nil
+	case "substring":
+		start, end := clamp(intArg(0, 0)), clamp(intArg(1, len(s)))
+		if start > end {
+			start, end = end, start
+		}
+		return s[start:end], nil
+	case "substr":
+		start := intArg(0, 0)
+		if start < 0 {
+			start += len(s)
+		}
+		start = clamp(start)
+		end := clamp(start + intArg(1, len(s)-start))
+		if end < start {
+			return "", nil
+		}
+		return s[start:end], nil
+	case "charAt":
+		i := intArg(0, 0)
+		if i < 0 || i >= len(s) {
+			return "", nil
+		}
+		return s[i : i+1], nil
+	case "startsWith":
+		if len(args) == 0 {
+			return false, nil
+		}
+		return strings.HasPrefix(s, pacString(args[0])), nil
+	case "endsWith":
+		if len(args) == 0 {
+			return false, nil
+		}
+		return strings.HasSuffix(s, pacString(args[0])), nil
+	}
+	return nil, fmt.Errorf("unsupported string method %q", name)
+}
+
+// pacLookupHost and pacMyIPAddress are used by the PAC DNS
+// helper functions. They are variables so that they may be
+// replaced in tests.
+var (
+	pacLookupHost  = net.LookupHost
+	pacMyIPAddress = myIPAddress
+)
+
+func myIPAddress() string {
+	// Dialing a UDP socket does not send any packets, but
+	// reveals the local address used for outgoing traffic.
+	conn, err := net.Dial("udp", "198.18.0.1:80")
+	if err != nil {
+		return "127.0.0.1"
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String()
+}
+
+func pacResolve(host string) string {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String()
+	}
+	addrs, err := pacLookupHost(host)
+	if err != nil {
+		return ""
+	}
+	// Prefer IPv4 addresses, as the PAC
+	// functions are defined in terms of them.
+	for _, addr := range addrs {
+		if ip := net.ParseIP(addr); ip != nil && ip.To4() != nil {
+			return ip.String()
+		}
+	}
+	if len(addrs) > 0 {
+		return addrs[0]
+	}
+	return ""
+}
+
+// shExpToRegexp converts a shell expression, as
+// used by shExpMatch, to a regular expression.
+func shExpToRegexp(pattern string) (*regexp.Regexp, error) {
+	var buf strings.Builder
+	buf.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			buf.WriteString(".*")
+		case '?':
+			buf.WriteString(".")
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	buf.WriteString("$")
+	return regexp.Compile(buf.String())
+}
+
+func pacArg(args []pacValue, i int) string {
+	if i >= len(args) {
+		return "undefined"
+	}
+	return pacString(args[i])
+}
+
+var pacBuiltins = map[string]pacBuiltin{
+	"isPlainHostName": func(args []pacValue) (pacValue, error) {
+		return !strings.Contains(pacArg(args, 0), "."), nil
+	},
+	"dnsDomainIs": func(args []pacValue) (pacValue, error) {
+		host, domain := strings.ToLower(pacArg(args, 0)), strings.ToLower(pacArg(args, 1))
+		return strings.HasSuffix(host, domain), nil
+	},
+	"localHostOrDomainIs": func(args []pacValue) (pacValue, error) {
+		host, hostdom := strings.ToLower(pacArg(args, 0)), strings.ToLower(pacArg(args, 1))
+		if host == hostdom {
+			return true, nil
+		}
+		return !strings.Contains(host, ".") && strings.HasPrefix(hostdom, host+"."), nil
+	},
+	"isResolvable": func(args []pacValue) (pacValue, error) {
+		return pacResolve(pacArg(args, 0)) != "", nil
+	},
+	"isInNet": func(args []pacValue) (pacValue, error) {
+		addr := net.ParseIP(pacResolve(pacArg(args, 0))).To4()
+		pattern := net.ParseIP(pacArg(args, 1)).To4()
+		mask := net.ParseIP(pacArg(args, 2)).To4()
+		if addr == nil || pattern == nil || mask == nil {
+			return false, nil
+		}
+		m := net.IPMask(mask)
+		return addr.Mask(m).Equal(pattern.Mask(m)), nil
+	},
+	"dnsResolve": func(args []pacValue) (pacValue, error) {
+		if addr := pacResolve(pacArg(args, 0)); addr != "" {
+			return addr, nil
+		}
+		return nil, nil
+	},
+	"myIpAddress": func(args []pacValue) (pacValue, error) {
+		return pacMyIPAddress(), nil
+	},
+	"dnsDomainLevels": func(args []pacValue) (pacValue, error) {
+		return float64(strings.Count(pacArg(args, 0), ".")), nil
+	},
+	"shExpMatch": func(args []pacValue) (pacValue, error) {
+		re, err := shExpToRegexp(pacArg(args, 1))
+		if err != nil {
+			return false, nil
+		}
+		return re.MatchString(pacArg(args, 0)), nil
+	},
+	"alert": func(args []pacValue) (pacValue, error) {
+		return nil, nil
+	},
+}
+
+func init() {
+	for _, name := range []string{"weekdayRange", "dateRange", "timeRange"} {
+		name := name
+		pacBuiltins[name] = func(args []pacValue) (pacValue, error) {
+			return nil, fmt.Errorf("%s is not supported", name)
+		}
+	}
+}
@@ -0,0 +1,514 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package proxy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// pacNode is a node in the syntax tree of a PAC script.
+type pacNode interface{}
+
+type (
+	pacFuncDecl struct {
+		name   string
+		params []string
+		body   []pacNode
+	}
+	pacVarDecl struct {
+		names  []string
+		values []pacNode
+	}
+	pacIf struct {
+		cond pacNode
+		then pacNode
+		els  pacNode
+	}
+	pacBlock struct {
+		stmts []pacNode
+	}
+	pacReturnStmt struct {
+		value pacNode
+	}
+	pacExprStmt struct {
+		expr pacNode
+	}
+	pacLiteral struct {
+		value pacValue
+	}
+	pacIdent struct {
+		name string
+	}
+	pacAssign struct {
+		name  string
+		value pacNode
+	}
+	pacUnary struct {
+		op      string
+		operand pacNode
+	}
+	pacBinary struct {
+		op          string
+		left, right pacNode
+	}
+	pacConditional struct {
+		cond, then, els pacNode
+	}
+	pacCall struct {
+		fn   pacNode
+		args []pacNode
+	}
+	pacMember struct {
+		object pacNode
+		name   string
+	}
+)
+
+type pacTokenKind int
+
+const (
+	pacEOF pacTokenKind = iota
+	pacIdentToken
+	pacNumberToken
+	pacStringToken
+	pacPunctToken
+)
+
+type pacToken struct {
+	kind pacTokenKind
+	text string
+	line int
+}
+
+func (t pacToken) String() string {
+	switch t.kind {
+	case pacEOF:
+		return "end of file"
+	case pacStringToken:
+		return strconv.Quote(t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// pacPuncts holds the punctuation recognised by the lexer,
+// longest first so that the longest match is taken.
+var pacPuncts = []string{
+	"===", "!==",
+	"==", "!=", "<=", ">=", "&&", "||",
+	"(", ")", "{", "}", ",", ";", ".", "?", ":",
+	"=", "!", "<", ">", "+", "-", "*", "/",
+}
+
+type pacLexer struct {
+	src  string
+	pos  int
+	line int
+}
+
+func newPACLexer(src string) *pacLexer {
+	return &pacLexer{src: src, line: 1}
+}
+
+// skipSpace skips white space and comments.
+func (l *pacLexer) skipSpace() error {
+	for l.pos < len(l.src) {
+		switch c := l.src[l.pos]; {
+		case c == '\n':
+			l.line++
+			l.pos++
+		case c == ' ' || c == '\t' || c == '\r':
+			l.pos++
+		case strings.HasPrefix(l.src[l.pos:], "//"):
+			end := strings.IndexByte(l.src[l.pos:], '\n')
+			if end < 0 {
+				l.pos = len(l.src)
+			} else {
+				l.pos += end
+			}
+		case strings.HasPrefix(l.src[l.pos:], "/*"):
+			end := strings.Index(l.src[l.pos+2:], "*/")
+			if end < 0 {
+				return fmt.Errorf("line %d: unterminated comment", l.line)
+			}
+			comment := l.src[l.pos : l.pos+2+end+2]
+			l.line += strings.Count(comment, "\n")
+			l.pos += len(comment)
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (l *pacLexer) next() (pacToken, error) {
+	if err := l.skipSpace(); err != nil {
+		return pacToken{}, err
+	}
+	if l.pos >= len(l.src) {
+		return pacToken{kind: pacEOF, line: l.line}, nil
+	}
+	start := l.pos
+	c := rune(l.src[l.pos])
+	switch {
+	case c == '_' || c == '$' || unicode.IsLetter(c):
+		for l.pos < len(l.src) {
+			c := rune(l.src[l.pos])
+			if c != '_' && c != '$' && !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+				break
+			}
+			l.pos++
+		}
+		return pacToken{kind: pacIdentToken, text: l.src[start:l.pos], line: l.line}, nil
+	case unicode.IsDigit(c):
+		for l.pos < len(l.src) && (unicode.IsDigit(rune(l.src[l.pos])) || l.src[l.pos] == '.') {
+			l.pos++
+		}
+		return pacToken{kind: pacNumberToken, text: l.src[start:l.pos], line: l.line}, nil
+	case c == '"' || c == '\'':
+		return l.lexString(byte(c))
+	}
+	for _, p := range pacPuncts {
+		if strings.HasPrefix(l.src[l.pos:], p) {
+			l.pos += len(p)
+			return pacToken{kind: pacPunctToken, text: p, line: l.line}, nil
+		}
+	}
+	return pacToken{}, fmt.Errorf("line %d: unexpected character %q", l.line, c)
+}
+
+func (l *pacLexer) lexString(quote byte) (pacToken, error) {
+	line := l.line
+	l.pos++
+	var buf strings.Builder
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		l.pos++
+		switch c {
+		case quote:
+			return pacToken{kind: pacStringToken, text: buf.String(), line: line}, nil
+		case '\n':
+			return pacToken{}, fmt.Errorf("line %d: unterminated string", line)
+		case '\\':
+			if l.pos >= len(l.src) {
+				break
+			}
+			e := l.src[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				buf.WriteByte('\n')
+			case 't':
+				buf.WriteByte('\t')
+			case 'r':
+				buf.WriteByte('\r')
+			default:
+				buf.WriteByte(e)
+			}
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return pacToken{}, fmt.Errorf("line %d: unterminated string", line)
+}
+
+// maxPACNestingDepth bounds the nesting of statements and
+// expressions in PAC scripts, so that a malicious script
+// cannot exhaust the stack while it is parsed or evaluated.
+const maxPACNestingDepth = 200
+
+// pacParser is a recursive-descent parser for
+// the subset of JavaScript supported in PAC files.
+type pacParser struct {
+	lex *pacLexer
+	tok pacToken
+	err error
+
+	// depth holds the current nesting depth.
+	depth int
+}
+
+// enter records entry into a nested statement or expression,
+// failing if the nesting is too deep. It must be matched by a
+// call to leave.
+func (p *pacParser) enter() {
+	p.depth++
+	if p.depth > maxPACNestingDepth {
+		p.fail("maximum nesting depth exceeded")
+	}
+}
+
+func (p *pacParser) leave() {
+	p.depth--
+}
+
+func (p *pacParser) next() {
+	if p.err != nil {
+		return
+	}
+	p.tok, p.err = p.lex.next()
+}
+
+func (p *pacParser) is(text string) bool {
+	return p.err == nil && (p.tok.kind == pacPunctToken || p.tok.kind == pacIdentToken) && p.tok.text == text
+}
+
+func (p *pacParser) accept(text string) bool {
+	if p.is(text) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *pacParser) expect(text string) {
+	if !p.accept(text) {
+		p.fail("expected %q, found %v", text, p.tok)
+	}
+}
+
+func (p *pacParser) fail(f string, a ...interface{}) {
+	if p.err == nil {
+		p.err = fmt.Errorf("line %d: %s", p.tok.line, fmt.Sprintf(f, a...))
+	}
+}
+
+func (p *pacParser) ident() string {
+	if p.err != nil {
+		return ""
+	}
+	if p.tok.kind != pacIdentToken || pacKeywords[p.tok.text] {
+		p.fail("expected identifier, found %v", p.tok)
+		return ""
+	}
+	name := p.tok.text
+	p.next()
+	return name
+}
+
+var pacKeywords = map[string]bool{
+	"function": true,
+	"var":      true,
+	"if":       true,
+	"else":     true,
+	"return":   true,
+	"true":     true,
+	"false":    true,
+	"null":     true,
+}
+
+func (p *pacParser) parseProgram() ([]pacNode, error) {
+	var stmts []pacNode
+	for p.err == nil && p.tok.kind != pacEOF {
+		stmts = append(stmts, p.parseStatement())
+	}
+	return stmts, p.err
+}
+
+func (p *pacParser) parseStatement() pacNode {
+	p.enter()
+	defer p.leave()
+	switch {
+	case p.accept(";"):
+		return nil
+	case p.is("{"):
+		return &pacBlock{stmts: p.parseBlock()}
+	case p.accept("function"):
+		decl := &pacFuncDecl{name: p.ident()}
+		p.expect("(")
+		for p.err == nil && !p.is(")") {
+			decl.params = append(decl.params, p.ident())
+			if !p.accept(",") {
+				break
+			}
+		}
+		p.expect(")")
+		decl.body = p.parseBlock()
+		return decl
+	case p.accept("var"):
+		decl := &pacVarDecl{}
+		for p.err == nil {
+			decl.names = append(decl.names, p.ident())
+			var value pacNode
+			if p.accept("=") {
+				value = p.parseExpr()
+			}
+			decl.values = append(decl.values, value)
+			if !p.accept(",") {
+				break
+			}
+		}
+		p.accept(";")
+		return decl
+	case p.accept("if"):
+		stmt := &pacIf{}
+		p.expect("(")
+		stmt.cond = p.parseExpr()
+		p.expect(")")
+		stmt.then = p.parseStatement()
+		if p.accept("else") {
+			stmt.els = p.parseStatement()
+		}
+		return stmt
+	case p.accept("return"):
+		stmt := &pacReturnStmt{}
+		if !p.is(";") && !p.is("}") && p.tok.kind != pacEOF {
+			stmt.value = p.parseExpr()
+		}
+		p.accept(";")
+		return stmt
+	}
+	expr := p.parseExpr()
+	p.accept(";")
+	return &pacExprStmt{expr: expr}
+}
+
+func (p *pacParser) parseBlock() []pacNode {
+	var stmts []pacNode
+	p.expect("{")
+	for p.err == nil && !p.is("}") {
+		if p.tok.kind == pacEOF {
+			p.fail("unexpected end of file")
+			break
+		}
+		stmts = append(stmts, p.parseStatement())
+	}
+	p.expect("}")
+	return stmts
+}
+
+func (p *pacParser) parseExpr() pacNode {
+	p.enter()
+	defer p.leave()
+	left := p.parseConditional()
+	if p.accept("=") {
+		ident, ok := left.(*pacIdent)
+		if !ok {
+			p.fail("invalid assignment target")
+			return nil
+		}
+		return &pacAssign{name: ident.name, value: p.parseExpr()}
+	}
+	return left
+}
+
+func (p *pacParser) parseConditional() pacNode {
+	cond := p.parseBinary(0)
+	if !p.accept("?") {
+		return cond
+	}
+	n := &pacConditional{cond: cond}
+	n.then = p.parseExpr()
+	p.expect(":")
+	n.els = p.parseExpr()
+	return n
+}
+
+// pacPrecedence holds the binary operators
+// in order of increasing precedence.
+var pacPrecedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "===", "!=="},
+	{"<", ">", "<=", ">="},
+	{"+", "-"},
+	{"*", "/"},
+}
+
+func (p *pacParser) parseBinary(level int) pacNode {
+	if level == len(pacPrecedence) {
+		return p.parseUnary()
+	}
+	left := p.parseBinary(level + 1)
+	for p.err == nil {
+		op := ""
+		for _, candidate := range pacPrecedence[level] {
+			if p.is(candidate) {
+				op = candidate
+				break
+			}
+		}
+		if op == "" {
+			break
+		}
+		p.next()
+		left = &pacBinary{op: op, left: left, right: p.parseBinary(level + 1)}
+	}
+	return left
+}
+
+func (p *pacParser) parseUnary() pacNode {
+	p.enter()
+	defer p.leave()
+	for _, op := range []string{"!", "-", "+"} {
+		if p.accept(op) {
+			return &pacUnary{op: op, operand: p.parseUnary()}
+		}
+	}
+	return p.parsePostfix()
+}
+
+func (p *pacParser) parsePostfix() pacNode {
+	n := p.parsePrimary()
+	for p.err == nil {
+		switch {
+		case p.accept("("):
+			call := &pacCall{fn: n}
+			for p.err == nil && !p.is(")") {
+				call.args = append(call.args, p.parseExpr())
+				if !p.accept(",") {
+					break
+				}
+			}
+			p.expect(")")
+			n = call
+		case p.accept("."):
+			n = &pacMember{object: n, name: p.ident()}
+		default:
+			return n
+		}
+	}
+	return n
+}
+
+func (p *pacParser) parsePrimary() pacNode {
+	if p.err != nil {
+		return nil
+	}
+	tok := p.tok
+	switch tok.kind {
+	case pacNumberToken:
+		p.next()
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			p.fail("invalid number %q", tok.text)
+		}
+		return &pacLiteral{value: f}
+	case pacStringToken:
+		p.next()
+		return &pacLiteral{value: tok.text}
+	case pacIdentToken:
+		switch tok.text {
+		case "true":
+			p.next()
+			return &pacLiteral{value: true}
+		case "false":
+			p.next()
+			return &pacLiteral{value: false}
+		case "null":
+			p.next()
+			return &pacLiteral{value: nil}
+		}
+		return &pacIdent{name: p.ident()}
+	}
+	if p.accept("(") {
+		n := p.parseExpr()
+		p.expect(")")
+		return n
+	}
+	p.fail("unexpected %v", tok)
+	return nil
+}
@@ -0,0 +1,268 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package proxy_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/proxy"
+)
+
+type pacSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&pacSuite{})
+
+const testPAC = `
+// A fairly typical corporate PAC file.
+var corpProxy = "PROXY proxy.example.com:3128";
+
+function isInternal(host) {
+	return dnsDomainIs(host, ".corp.example.com") ||
+		isInNet(dnsResolve(host), "10.0.0.0", "255.0.0.0");
+}
+
+function FindProxyForURL(url, host) {
+	host = host.toLowerCase();
+	if (isPlainHostName(host) || isInternal(host)) {
+		return "DIRECT";
+	}
+	/* Updates go via a dedicated proxy. */
+	if (shExpMatch(host, "*.ubuntu.com") && url.substring(0, 5) == "http:") {
+		return "PROXY updates.example.com:8080; DIRECT";
+	}
+	if (url.indexOf("secure") >= 0)
+		return "HTTPS secure.example.com:443";
+	else
+		return dnsDomainLevels(host) > 3 ? "SOCKS socks.example.com:1080" : corpProxy + "; DIRECT";
+}
+`
+
+func (s *pacSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.PatchValue(proxy.PACLookupHost, func(host string) ([]string, error) {
+		switch host {
+		case "internal-ip.example.com":
+			return []string{"::1", "10.1.2.3"}, nil
+		case "www.example.com":
+			return []string{"192.0.2.1"}, nil
+		}
+		return nil, fmt.Errorf("no such host")
+	})
+	s.PatchValue(proxy.PACMyIPAddress, func() string {
+		return "192.168.0.2"
+	})
+}
+
+func (s *pacSuite) TestFindProxyForURL(c *gc.C) {
+	pac, err := proxy.ParsePAC(testPAC)
+	c.Assert(err, jc.ErrorIsNil)
+	for i, test := range []struct {
+		url    string
+		expect string
+	}{{
+		url:    "http://intranet/",
+		expect: "DIRECT",
+	}, {
+		url:    "http://WIKI.corp.example.com/page",
+		expect: "DIRECT",
+	}, {
+		url:    "http://internal-ip.example.com/",
+		expect: "DIRECT",
+	}, {
+		url:    "http://archive.ubuntu.com/ubuntu",
+		expect: "PROXY updates.example.com:8080; DIRECT",
+	}, {
+		url:    "https://archive.ubuntu.com/ubuntu",
+		expect: "PROXY proxy.example.com:3128; DIRECT",
+	}, {
+		url:    "https://www.example.com/secure/login",
+		expect: "HTTPS secure.example.com:443",
+	}, {
+		url:    "http://a.b.c.d.example.com/",
+		expect: "SOCKS socks.example.com:1080",
+	}} {
+		c.Logf("test %d: %s", i, test.url)
+		result, err := pac.FindProxyForURL(test.url)
+		c.Check(err, jc.ErrorIsNil)
+		c.Check(result, gc.Equals, test.expect)
+	}
+}
+
+func (s *pacSuite) TestBuiltins(c *gc.C) {
+	for i, test := range []struct {
+		expr   string
+		expect string
+	}{
+		{`isPlainHostName("www")`, "true"},
+		{`isPlainHostName("www.example.com")`, "false"},
+		{`dnsDomainIs("www.example.com", ".example.com")`, "true"},
+		{`dnsDomainIs("www", ".example.com")`, "false"},
+		{`localHostOrDomainIs("www", "www.example.com")`, "true"},
+		{`localHostOrDomainIs("www.example.com", "www.example.com")`, "true"},
+		{`localHostOrDomainIs("www.other.com", "www.example.com")`, "false"},
+		{`isResolvable("www.example.com")`, "true"},
+		{`isResolvable("nowhere.invalid")`, "false"},
+		{`isInNet("192.0.2.1", "192.0.2.0", "255.255.255.0")`, "true"},
+		{`isInNet("www.example.com", "192.0.3.0", "255.255.255.0")`, "false"},
+		{`dnsResolve("www.example.com")`, "192.0.2.1"},
+		{`dnsResolve("nowhere.invalid")`, "undefined"},
+		{`myIpAddress()`, "192.168.0.2"},
+		{`dnsDomainLevels("a.b.c")`, "2"},
+		{`shExpMatch("http://x.example.com/a/b", "*.example.com/*")`, "true"},
+		{`shExpMatch("x.example.org", "*.example.?om")`, "false"},
+		{`"abc".length + 1`, "4"},
+		{`"Hello".toUpperCase() + "!"`, "HELLO!"},
+		{`"hello".substr(1, 3)`, "ell"},
+		{`"hello".charAt(4)`, "o"},
+		{`!"" && 1 === 1 && "1" == 1 && "1" !== 1`, "true"},
+	} {
+		c.Logf("test %d: %s", i, test.expr)
+		pac, err := proxy.ParsePAC(`function FindProxyForURL(url, host) { return "" + (` + test.expr + `); }`)
+		c.Assert(err, jc.ErrorIsNil)
+		result, err := pac.FindProxyForURL("http://example.com/")
+		c.Check(err, jc.ErrorIsNil)
+		c.Check(result, gc.Equals, test.expect)
+	}
+}
+
+func (s *pacSuite) TestParseErrors(c *gc.C) {
+	for i, test := range []struct {
+		src    string
+		expect string
+	}{{
+		src:    `function FindProxyForURL(url, host) { return "DIRECT"`,
+		expect: `cannot parse PAC file: line 1: unexpected end of file`,
+	}, {
+		src:    "function FindProxyForURL(url, host) {\n\treturn 'DIRECT;\n}",
+		expect: `cannot parse PAC file: line 2: unterminated string`,
+	}, {
+		src:    `function FindProxyForURL(url, host) { return host[0]; }`,
+		expect: `cannot parse PAC file: line 1: unexpected character '\['`,
+	}, {
+		src:    `function f() { return "DIRECT"; }`,
+		expect: `PAC file does not define FindProxyForURL`,
+	}, {
+		src:    `var x = missing(); function FindProxyForURL(url, host) { return "DIRECT"; }`,
+		expect: `cannot evaluate PAC file: missing is not defined`,
+	}} {
+		c.Logf("test %d", i)
+		_, err := proxy.ParsePAC(test.src)
+		c.Check(err, gc.ErrorMatches, test.expect)
+	}
+}
+
+func (s *pacSuite) TestEvaluationErrors(c *gc.C) {
+	pac, err := proxy.ParsePAC(`function FindProxyForURL(url, host) { return timeRange(9, 17) ? "DIRECT" : "PROXY p:1"; }`)
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = pac.FindProxyForURL("http://example.com/")
+	c.Assert(err, gc.ErrorMatches, `FindProxyForURL: timeRange is not supported`)
+
+	pac, err = proxy.ParsePAC(`function FindProxyForURL(url, host) { return FindProxyForURL(url, host); }`)
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = pac.FindProxyForURL("http://example.com/")
+	c.Assert(err, gc.ErrorMatches, `FindProxyForURL: maximum call depth exceeded`)
+
+	pac, err = proxy.ParsePAC(`function FindProxyForURL(url, host) { }`)
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = pac.FindProxyForURL("http://example.com/")
+	c.Assert(err, gc.ErrorMatches, `FindProxyForURL returned undefined, not a string`)
+}
+
+func (s *pacSuite) TestSettingsForURL(c *gc.C) {
+	pac, err := proxy.ParsePAC(testPAC)
+	c.Assert(err, jc.ErrorIsNil)
+
+	settings, err := pac.SettingsForURL("http://archive.ubuntu.com/ubuntu")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(settings, jc.DeepEquals, proxy.Settings{
+		Http: "http://updates.example.com:8080",
+	})
+
+	settings, err = pac.SettingsForURL("https://www.example.com/secure")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(settings, jc.DeepEquals, proxy.Settings{
+		Https: "https://secure.example.com:443",
+	})
+
+	settings, err = pac.SettingsForURL("ftp://a.b.c.d.example.com/")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(settings, jc.DeepEquals, proxy.Settings{
+		Ftp: "socks5://socks.example.com:1080",
+	})
+
+	settings, err = pac.SettingsForURL("http://intranet/")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(settings, jc.DeepEquals, proxy.Settings{})
+}
+
+func (s *pacSuite) TestFetchPAC(c *gc.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/wpad.dat" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, testPAC)
+	}))
+	defer server.Close()
+
+	pac, err := proxy.FetchPAC(server.URL + "/wpad.dat")
+	c.Assert(err, jc.ErrorIsNil)
+	result, err := pac.FindProxyForURL("http://intranet/")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(result, gc.Equals, "DIRECT")
+
+	_, err = proxy.FetchPAC(server.URL + "/missing")
+	c.Assert(err, gc.ErrorMatches, `cannot fetch PAC file ".*/missing": 404 Not Found`)
+
+	path := filepath.Join(c.MkDir(), "proxy.pac")
+	err = ioutil.WriteFile(path, []byte(testPAC), 0644)
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = proxy.FetchPAC("file://" + path)
+	c.Assert(err, jc.ErrorIsNil)
+
+	_, err = proxy.FetchPAC("gopher://example.com/proxy.pac")
+	c.Assert(err, gc.ErrorMatches, `unsupported PAC file URL scheme "gopher"`)
+}
+
+func (s *pacSuite) TestFetchPACTooLarge(c *gc.C) {
+	s.PatchValue(proxy.MaxPACSize, int64(len(testPAC)-1))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, testPAC)
+	}))
+	defer server.Close()
+
+	_, err := proxy.FetchPAC(server.URL + "/wpad.dat")
+	c.Assert(err, gc.ErrorMatches, `cannot .*: PAC file larger than \d+ bytes`)
+
+	path := filepath.Join(c.MkDir(), "proxy.pac")
+	err = ioutil.WriteFile(path, []byte(testPAC), 0644)
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = proxy.FetchPAC("file://" + path)
+	c.Assert(err, gc.ErrorMatches, `cannot .*: PAC file larger than \d+ bytes`)
+}
+
+func (s *pacSuite) TestParsePACNestingTooDeep(c *gc.C) {
+	deep := strings.Repeat("(", 10000) + "1" + strings.Repeat(")", 10000)
+	_, err := proxy.ParsePAC(`function FindProxyForURL(url, host) { return ` + deep + `; }`)
+	c.Assert(err, gc.ErrorMatches, `.*maximum nesting depth exceeded`)
+
+	deep = strings.Repeat("!", 10000) + "1"
+	_, err = proxy.ParsePAC(`function FindProxyForURL(url, host) { return ` + deep + `; }`)
+	c.Assert(err, gc.ErrorMatches, `.*maximum nesting depth exceeded`)
+
+	deep = strings.Repeat("if (1) { ", 10000) + strings.Repeat("}", 10000)
+	_, err = proxy.ParsePAC(`function FindProxyForURL(url, host) { ` + deep + ` }`)
+	c.Assert(err, gc.ErrorMatches, `.*maximum nesting depth exceeded`)
+}
@@ -4,7 +4,10 @@
 package proxy
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"net/url"
 	"os"
 	"strings"
 
@@ -103,6 +106,96 @@ DefaultEnvironment=`
 	return rv + "\n"
 }
 
+// AsSnapSetArgs returns the arguments to pass to "snap set system" to
+// configure snapd with the proxy settings, one "key=value" argument for
+// each non-empty value. No arguments are returned if the settings are
+// empty.
+func (s *Settings) AsSnapSetArgs() []string {
+	var args []string
+	addArg := func(key, value string) {
+		if value != "" {
+			args = append(args, fmt.Sprintf("proxy.%s=%s", key, value))
+		}
+	}
+	addArg("http", s.Http)
+	addArg("https", s.Https)
+	addArg("ftp", s.Ftp)
+	addArg("no-proxy", s.FullNoProxy())
+	return args
+}
+
+// AsDockerDaemonConfig returns the "proxies" section of a Docker daemon
+// configuration file (daemon.json) holding the proxy settings, which
+// Docker uses when pulling images. FTP proxy settings are not supported
+// by Docker and are omitted.
+func (s *Settings) AsDockerDaemonConfig() ([]byte, error) {
+	type dockerProxies struct {
+		HTTPProxy  string `json:"http-proxy,omitempty"`
+		HTTPSProxy string `json:"https-proxy,omitempty"`
+		NoProxy    string `json:"no-proxy,omitempty"`
+	}
+	return json.MarshalIndent(struct {
+		Proxies dockerProxies `json:"proxies"`
+	}{dockerProxies{
+		HTTPProxy:  s.Http,
+		HTTPSProxy: s.Https,
+		NoProxy:    s.FullNoProxy(),
+	}}, "", "    ")
+}
+
+// AsContainerdSystemdDropIn returns the contents of a systemd drop-in
+// file for the containerd service, conventionally installed as
+// /etc/systemd/system/containerd.service.d/http-proxy.conf, that sets
+// the proxy environment variables for containerd.
+func (s *Settings) AsContainerdSystemdDropIn() string {
+	var buf bytes.Buffer
+	buf.WriteString("[Service]\n")
+	for _, value := range s.AsEnvironmentValues() {
+		fmt.Fprintf(&buf, "Environment=%s\n", systemdQuote(value))
+	}
+	return buf.String()
+}
+
+// systemdQuote quotes s as a single word in a systemd unit file
+// setting, escaping the specifiers that systemd would otherwise
+// expand, such as those in percent-encoded credentials.
+func systemdQuote(s string) string {
+	r := strings.NewReplacer("%", "%%", `\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// AsYumConfig returns the lines to add to the [main] section of
+// /etc/yum.conf or /etc/dnf/dnf.conf to configure the package manager
+// with the proxy settings. Yum and dnf use a single proxy for all
+// repositories, so the HTTP proxy is used if set and the HTTPS proxy
+// otherwise. Credentials in the proxy URL are rendered as separate
+// proxy_username and proxy_password options. Yum and dnf have no
+// equivalent of no_proxy, so NoProxy is ignored.
+func (s *Settings) AsYumConfig() (string, error) {
+	proxy := s.Http
+	if proxy == "" {
+		proxy = s.Https
+	}
+	if proxy == "" {
+		return "", nil
+	}
+	u, err := url.Parse(proxy)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid proxy URL %q", proxy)
+	}
+	var lines []string
+	user := u.User
+	u.User = nil
+	lines = append(lines, "proxy="+u.String())
+	if user != nil {
+		lines = append(lines, "proxy_username="+user.Username())
+		if password, ok := user.Password(); ok {
+			lines = append(lines, "proxy_password="+password)
+		}
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
 // SetEnvironmentValues updates the process environment with the
 // proxy values stored in the settings object.  Both the lower-case
 // and upper-case variants are set.
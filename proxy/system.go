@@ -0,0 +1,270 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// SystemSettings holds the proxy configuration found in the settings of
+// the host operating system.
+type SystemSettings struct {
+	Settings
+
+	// AutoConfigURL holds the location of a proxy auto-config (PAC)
+	// file, if the system is configured to use one. The proxy for a
+	// given URL can be found by passing this to FetchPAC and calling
+	// SettingsForURL on the result.
+	AutoConfigURL string
+}
+
+// DetectSystemProxies returns the proxy settings configured in the host
+// operating system, as opposed to the environment. On Windows these are
+// read from the Internet Settings in the registry, on macOS from the
+// system configuration framework (via scutil), and elsewhere from the
+// GNOME desktop settings (via gsettings). If the system has no proxy
+// configured, or the relevant settings store is not available, the
+// returned settings are empty.
+func DetectSystemProxies() (SystemSettings, error) {
+	return detectSystemProxies()
+}
+
+// runCommand runs the given command and returns its output.
+// It is a variable so that it can be replaced in tests.
+var runCommand = func(name string, args ...string) (string, error) {
+	out, err := exec.Command(name, args...).Output()
+	return string(out), err
+}
+
+// proxyURL returns an HTTP proxy URL for the given host and port.
+func proxyURL(host, port string) string {
+	if host == "" {
+		return ""
+	}
+	if strings.Contains(host, "://") {
+		if port == "" || port == "0" {
+			return host
+		}
+		return host + ":" + port
+	}
+	if port == "" || port == "0" {
+		return "http://" + host
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// detectGNOMEProxies reads the proxy settings from
+// the org.gnome.system.proxy gsettings schemas.
+func detectGNOMEProxies() (SystemSettings, error) {
+	if _, err := exec.LookPath("gsettings"); err != nil {
+		return SystemSettings{}, nil
+	}
+	return gnomeProxies(func(schema, key string) (string, error) {
+		out, err := runCommand("gsettings", "get", schema, key)
+		if err != nil {
+			return "", fmt.Errorf("cannot get %s %s: %v", schema, key, err)
+		}
+		return strings.TrimSpace(out), nil
+	})
+}
+
+// gnomeProxies builds the system settings from GNOME proxy settings,
+// which it reads with the given function. Values are in GVariant
+// text format, as printed by gsettings.
+func gnomeProxies(get func(schema, key string) (string, error)) (SystemSettings, error) {
+	const schema = "org.gnome.system.proxy"
+	var s SystemSettings
+	mode, err := get(schema, "mode")
+	if err != nil {
+		return s, err
+	}
+	switch gvariantString(mode) {
+	case "auto":
+		url, err := get(schema, "autoconfig-url")
+		if err != nil {
+			return s, err
+		}
+		s.AutoConfigURL = gvariantString(url)
+		return s, nil
+	case "manual":
+	default:
+		return s, nil
+	}
+	hostPort := func(protocol string) (string, error) {
+		host, err := get(schema+"."+protocol, "host")
+		if err != nil {
+			return "", err
+		}
+		port, err := get(schema+"."+protocol, "port")
+		if err != nil {
+			return "", err
+		}
+		return proxyURL(gvariantString(host), gvariantString(port)), nil
+	}
+	if s.Http, err = hostPort("http"); err != nil {
+		return s, err
+	}
+	if s.Https, err = hostPort("https"); err != nil {
+		return s, err
+	}
+	if s.Ftp, err = hostPort("ftp"); err != nil {
+		return s, err
+	}
+	ignore, err := get(schema, "ignore-hosts")
+	if err != nil {
+		return s, err
+	}
+	s.NoProxy = strings.Join(gvariantStrings(ignore), ",")
+	return s, nil
+}
+
+// gvariantString parses a GVariant string or number as printed by
+// gsettings, such as 'manual' or 8080.
+func gvariantString(s string) string {
+	s = strings.TrimSpace(s)
+	// Numbers may be printed with a type prefix (e.g. "uint32 0").
+	if f := strings.Fields(s); len(f) == 2 && !strings.HasPrefix(s, "'") {
+		s = f[1]
+	}
+	if len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0] {
+		s = s[1 : len(s)-1]
+		s = strings.Replace(s, `\'`, `'`, -1)
+		s = strings.Replace(s, `\"`, `"`, -1)
+	}
+	return s
+}
+
+// gvariantStrings parses a GVariant string array
+// as printed by gsettings, such as ['localhost', '::1'].
+func gvariantStrings(s string) []string {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "@as ")
+	s = strings.TrimPrefix(s, "[")
+	s = strings.TrimSuffix(s, "]")
+	var values []string
+	for _, v := range strings.Split(s, ",") {
+		if v = gvariantString(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// detectMacOSProxies reads the proxy settings
+// from the output of "scutil --proxy".
+func detectMacOSProxies() (SystemSettings, error) {
+	out, err := runCommand("scutil", "--proxy")
+	if err != nil {
+		return SystemSettings{}, fmt.Errorf("cannot get system proxy settings: %v", err)
+	}
+	return parseScutilProxies(out), nil
+}
+
+// parseScutilProxies parses the dictionary printed
+// by "scutil --proxy" into system settings.
+func parseScutilProxies(out string) SystemSettings {
+	values := make(map[string]string)
+	var exceptions []string
+	inExceptions := false
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if inExceptions {
+			if line == "}" {
+				inExceptions = false
+				continue
+			}
+			if i := strings.Index(line, " : "); i >= 0 {
+				exceptions = append(exceptions, strings.TrimSpace(line[i+3:]))
+			}
+			continue
+		}
+		i := strings.Index(line, " : ")
+		if i < 0 {
+			continue
+		}
+		key, value := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+3:])
+		if key == "ExceptionsList" && strings.HasPrefix(value, "<array>") {
+			inExceptions = true
+			continue
+		}
+		values[key] = value
+	}
+	enabled := func(key string) bool {
+		n, _ := strconv.Atoi(values[key])
+		return n != 0
+	}
+	var s SystemSettings
+	if enabled("HTTPEnable") {
+		s.Http = proxyURL(values["HTTPProxy"], values["HTTPPort"])
+	}
+	if enabled("HTTPSEnable") {
+		s.Https = proxyURL(values["HTTPSProxy"], values["HTTPSPort"])
+	}
+	if enabled("FTPEnable") {
+		s.Ftp = proxyURL(values["FTPProxy"], values["FTPPort"])
+	}
+	if enabled("ProxyAutoConfigEnable") {
+		s.AutoConfigURL = values["ProxyAutoConfigURLString"]
+	}
+	s.NoProxy = strings.Join(exceptions, ",")
+	return s
+}
+
+// windowsProxies builds system settings from the values stored in the
+// Windows Internet Settings registry key.
+//
+// The ProxyServer value either holds a single host:port used for all
+// protocols, or a list of protocol=host:port entries separated by
+// semicolons. The ProxyOverride value holds a semicolon-separated list
+// of hosts that should not be proxied; the special "<local>" entry,
+// which bypasses the proxy for all plain host names, has no equivalent
+// in no_proxy and is omitted.
+func windowsProxies(enabled bool, server, override, autoConfigURL string) SystemSettings {
+	s := SystemSettings{AutoConfigURL: autoConfigURL}
+	if !enabled {
+		return s
+	}
+	fromHostPort := func(hostPort string) string {
+		host, port, err := net.SplitHostPort(hostPort)
+		if err != nil {
+			return proxyURL(hostPort, "")
+		}
+		return proxyURL(host, port)
+	}
+	if !strings.Contains(server, "=") {
+		p := fromHostPort(strings.TrimSpace(server))
+		s.Http, s.Https, s.Ftp = p, p, p
+	} else {
+		for _, entry := range strings.Split(server, ";") {
+			parts := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			p := fromHostPort(parts[1])
+			switch strings.ToLower(parts[0]) {
+			case "http":
+				s.Http = p
+			case "https":
+				s.Https = p
+			case "ftp":
+				s.Ftp = p
+			}
+		}
+	}
+	var noProxy []string
+	for _, host := range strings.Split(override, ";") {
+		host = strings.TrimSpace(host)
+		if host != "" && host != "<local>" {
+			noProxy = append(noProxy, host)
+		}
+	}
+	s.NoProxy = strings.Join(noProxy, ",")
+	return s
+}
@@ -0,0 +1,8 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package proxy
+
+func detectSystemProxies() (SystemSettings, error) {
+	return detectMacOSProxies()
+}
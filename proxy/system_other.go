@@ -0,0 +1,11 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+//go:build !windows && !darwin
+// +build !windows,!darwin
+
+package proxy
+
+func detectSystemProxies() (SystemSettings, error) {
+	return detectGNOMEProxies()
+}
@@ -0,0 +1,132 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package proxy_test
+
+import (
+	"fmt"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/proxy"
+)
+
+type systemSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&systemSuite{})
+
+func gsettings(values map[string]string) func(schema, key string) (string, error) {
+	return func(schema, key string) (string, error) {
+		v, ok := values[schema+" "+key]
+		if !ok {
+			return "", fmt.Errorf("no key %s %s", schema, key)
+		}
+		return v, nil
+	}
+}
+
+func (s *systemSuite) TestGNOMEManual(c *gc.C) {
+	settings, err := proxy.GNOMEProxies(gsettings(map[string]string{
+		"org.gnome.system.proxy mode":           "'manual'",
+		"org.gnome.system.proxy ignore-hosts":   "['localhost', '127.0.0.0/8', '::1']",
+		"org.gnome.system.proxy.http host":      "'proxy.example.com'",
+		"org.gnome.system.proxy.http port":      "3128",
+		"org.gnome.system.proxy.https host":     "'secure.example.com'",
+		"org.gnome.system.proxy.https port":     "uint32 8443",
+		"org.gnome.system.proxy.ftp host":       "''",
+		"org.gnome.system.proxy.ftp port":       "0",
+		"org.gnome.system.proxy autoconfig-url": "''",
+	}))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(settings, jc.DeepEquals, proxy.SystemSettings{
+		Settings: proxy.Settings{
+			Http:    "http://proxy.example.com:3128",
+			Https:   "http://secure.example.com:8443",
+			NoProxy: "localhost,127.0.0.0/8,::1",
+		},
+	})
+}
+
+func (s *systemSuite) TestGNOMEAuto(c *gc.C) {
+	settings, err := proxy.GNOMEProxies(gsettings(map[string]string{
+		"org.gnome.system.proxy mode":           "'auto'",
+		"org.gnome.system.proxy autoconfig-url": "'http://wpad.example.com/wpad.dat'",
+	}))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(settings, jc.DeepEquals, proxy.SystemSettings{
+		AutoConfigURL: "http://wpad.example.com/wpad.dat",
+	})
+}
+
+func (s *systemSuite) TestGNOMENone(c *gc.C) {
+	settings, err := proxy.GNOMEProxies(gsettings(map[string]string{
+		"org.gnome.system.proxy mode": "'none'",
+	}))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(settings, jc.DeepEquals, proxy.SystemSettings{})
+}
+
+func (s *systemSuite) TestGNOMEError(c *gc.C) {
+	_, err := proxy.GNOMEProxies(gsettings(map[string]string{
+		"org.gnome.system.proxy mode": "'manual'",
+	}))
+	c.Assert(err, gc.ErrorMatches, `no key org.gnome.system.proxy.http host`)
+}
+
+func (s *systemSuite) TestScutil(c *gc.C) {
+	settings := proxy.ParseScutilProxies(`<dictionary> {
+  ExceptionsList : <array> {
+    0 : *.local
+    1 : 169.254/16
+  }
+  FTPPassive : 1
+  HTTPEnable : 1
+  HTTPPort : 8080
+  HTTPProxy : proxy.example.com
+  HTTPSEnable : 0
+  HTTPSPort : 8443
+  HTTPSProxy : secure.example.com
+  ProxyAutoConfigEnable : 1
+  ProxyAutoConfigURLString : http://wpad/wpad.dat
+}
+`)
+	c.Assert(settings, jc.DeepEquals, proxy.SystemSettings{
+		Settings: proxy.Settings{
+			Http:    "http://proxy.example.com:8080",
+			NoProxy: "*.local,169.254/16",
+		},
+		AutoConfigURL: "http://wpad/wpad.dat",
+	})
+}
+
+func (s *systemSuite) TestWindowsSingleServer(c *gc.C) {
+	settings := proxy.WindowsProxies(true, "proxy.example.com:3128", "<local>;*.example.com;10.*", "")
+	c.Assert(settings, jc.DeepEquals, proxy.SystemSettings{
+		Settings: proxy.Settings{
+			Http:    "http://proxy.example.com:3128",
+			Https:   "http://proxy.example.com:3128",
+			Ftp:     "http://proxy.example.com:3128",
+			NoProxy: "*.example.com,10.*",
+		},
+	})
+}
+
+func (s *systemSuite) TestWindowsPerProtocol(c *gc.C) {
+	settings := proxy.WindowsProxies(true, "http=web:80;https=secure:443;socks=socks:1080", "", "http://wpad/wpad.dat")
+	c.Assert(settings, jc.DeepEquals, proxy.SystemSettings{
+		Settings: proxy.Settings{
+			Http:  "http://web:80",
+			Https: "http://secure:443",
+		},
+		AutoConfigURL: "http://wpad/wpad.dat",
+	})
+}
+
+func (s *systemSuite) TestWindowsDisabled(c *gc.C) {
+	settings := proxy.WindowsProxies(false, "proxy.example.com:3128", "", "")
+	c.Assert(settings, jc.DeepEquals, proxy.SystemSettings{})
+}
@@ -0,0 +1,33 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package proxy
+
+import (
+	"golang.org/x/sys/windows/registry"
+)
+
+const internetSettingsKey = `Software\Microsoft\Windows\CurrentVersion\Internet Settings`
+
+func detectSystemProxies() (SystemSettings, error) {
+	key, err := registry.OpenKey(registry.CURRENT_USER, internetSettingsKey, registry.QUERY_VALUE)
+	if err == registry.ErrNotExist {
+		return SystemSettings{}, nil
+	}
+	if err != nil {
+		return SystemSettings{}, err
+	}
+	defer key.Close()
+	stringValue := func(name string) string {
+		// Missing values are treated as empty.
+		value, _, _ := key.GetStringValue(name)
+		return value
+	}
+	enabled, _, _ := key.GetIntegerValue("ProxyEnable")
+	return windowsProxies(
+		enabled != 0,
+		stringValue("ProxyServer"),
+		stringValue("ProxyOverride"),
+		stringValue("AutoConfigURL"),
+	), nil
+}
@@ -0,0 +1,235 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/juju/clock"
+)
+
+// ErrRateLimitExceeded is returned by RateLimiter.Acquire when a token
+// cannot be obtained before the context's deadline.
+var ErrRateLimitExceeded = fmt.Errorf("rate limit exceeded")
+
+// RateLimiter limits the rate at which operations may be performed
+// using a token bucket. Tokens are added to the bucket at a fixed rate
+// up to a maximum burst size, and each operation consumes one token.
+type RateLimiter interface {
+	// TryAcquire takes a token if one is immediately available,
+	// and reports whether it did so.
+	TryAcquire() bool
+
+	// Acquire takes a token, blocking until one is available or the
+	// context is done. If the context has a deadline that would pass
+	// before a token becomes available, Acquire fails immediately
+	// with ErrRateLimitExceeded rather than waiting.
+	Acquire(ctx context.Context) error
+}
+
+type rateLimiter struct {
+	clock    clock.Clock
+	interval time.Duration
+	burst    int
+
+	// mu guards the fields below it.
+	mu sync.Mutex
+
+	// tokens holds the number of tokens available as of last.
+	// It may be negative when tokens have been reserved by
+	// waiting calls to Acquire.
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a RateLimiter that allows rate operations per
+// second on average, with bursts of up to burst operations. The bucket
+// starts full.
+func NewRateLimiter(rate float64, burst int) RateLimiter {
+	return NewRateLimiterWithClock(rate, burst, nil)
+}
+
+// NewRateLimiterWithClock is like NewRateLimiter except that it
+// uses the given clock to measure time. If clk is nil, the wall
+// clock is used.
+func NewRateLimiterWithClock(rate float64, burst int, clk clock.Clock) RateLimiter {
+	if rate <= 0 {
+		panic("rate must be > 0")
+	}
+	if burst < 1 {
+		panic("burst must be >= 1")
+	}
+	if clk == nil {
+		clk = clock.WallClock
+	}
+	return &rateLimiter{
+		clock:    clk,
+		interval: time.Duration(float64(time.Second) / rate),
+		burst:    burst,
+		tokens:   float64(burst),
+		last:     clk.Now(),
+	}
+}
+
+// TryAcquire implements RateLimiter.TryAcquire.
+func (l *rateLimiter) TryAcquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill(l.clock.Now())
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// Acquire implements RateLimiter.Acquire.
+func (l *rateLimiter) Acquire(ctx context.Context) error {
+	return l.acquire(ctx, 1)
+}
+
+// acquire takes n tokens, blocking until they are available
+// as described for Acquire. If n is more than the burst size,
+// it waits until the bucket would hold n tokens.
+func (l *rateLimiter) acquire(ctx context.Context, n float64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	now := l.clock.Now()
+	l.refill(now)
+	l.tokens -= n
+	if l.tokens >= 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	// Reserve the tokens and work out how long it will be
+	// before they become available.
+	wait := time.Duration(-l.tokens * float64(l.interval))
+	if deadline, ok := ctx.Deadline(); ok && now.Add(wait).After(deadline) {
+		l.tokens += n
+		l.mu.Unlock()
+		return ErrRateLimitExceeded
+	}
+	l.mu.Unlock()
+
+	timer := l.clock.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.Chan():
+		return nil
+	case <-ctx.Done():
+		// Give back the reserved tokens.
+		l.mu.Lock()
+		l.refill(l.clock.Now())
+		l.tokens += n
+		if l.tokens > float64(l.burst) {
+			l.tokens = float64(l.burst)
+		}
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// refill adds any tokens accrued since the last refill.
+// It must be called with l.mu held.
+func (l *rateLimiter) refill(now time.Time) {
+	elapsed := now.Sub(l.last)
+	if elapsed <= 0 {
+		return
+	}
+	l.last = now
+	l.tokens += float64(elapsed) / float64(l.interval)
+	if l.tokens > float64(l.burst) {
+		l.tokens = float64(l.burst)
+	}
+}
+
+// BandwidthLimiter limits the rate at which data is transferred, using
+// a token bucket in which each token allows one byte. It may be shared
+// to limit the combined rate of several transfers.
+type BandwidthLimiter struct {
+	limiter *rateLimiter
+}
+
+// NewBandwidthLimiter returns a BandwidthLimiter that allows rate bytes
+// per second on average, with bursts of up to burst bytes. It uses the
+// given clock to measure time; if clk is nil, the wall clock is used.
+func NewBandwidthLimiter(rate float64, burst int, clk clock.Clock) *BandwidthLimiter {
+	return &BandwidthLimiter{
+		limiter: NewRateLimiterWithClock(rate, burst, clk).(*rateLimiter),
+	}
+}
+
+// WaitN blocks until n bytes may be transferred or the context is
+// done. It fails with ErrRateLimitExceeded in the same circumstances
+// as RateLimiter.Acquire.
+func (b *BandwidthLimiter) WaitN(ctx context.Context, n int) error {
+	if n <= 0 {
+		return nil
+	}
+	return b.limiter.acquire(ctx, float64(n))
+}
+
+// Reader returns a reader that reads from r no faster than b allows.
+// Each read returns at most the burst size of b. If waiting fails,
+// the read returns the data read along with the error.
+func (b *BandwidthLimiter) Reader(ctx context.Context, r io.Reader) io.Reader {
+	return &bandwidthReader{ctx: ctx, r: r, b: b}
+}
+
+// Writer returns a writer that writes to w no faster than b allows,
+// passing data to w at most the burst size of b at a time.
+func (b *BandwidthLimiter) Writer(ctx context.Context, w io.Writer) io.Writer {
+	return &bandwidthWriter{ctx: ctx, w: w, b: b}
+}
+
+type bandwidthReader struct {
+	ctx context.Context
+	r   io.Reader
+	b   *BandwidthLimiter
+}
+
+// Read implements io.Reader.
+func (r *bandwidthReader) Read(p []byte) (int, error) {
+	if len(p) > r.b.limiter.burst {
+		p = p[:r.b.limiter.burst]
+	}
+	n, err := r.r.Read(p)
+	if waitErr := r.b.WaitN(r.ctx, n); waitErr != nil {
+		return n, waitErr
+	}
+	return n, err
+}
+
+type bandwidthWriter struct {
+	ctx context.Context
+	w   io.Writer
+	b   *BandwidthLimiter
+}
+
+// Write implements io.Writer.
+func (w *bandwidthWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		block := p
+		if len(block) > w.b.limiter.burst {
+			block = block[:w.b.limiter.burst]
+		}
+		if err := w.b.WaitN(w.ctx, len(block)); err != nil {
+			return written, err
+		}
+		n, err := w.w.Write(block)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
@@ -0,0 +1,221 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package utils_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"time"
+
+	"github.com/juju/clock/testclock"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3"
+)
+
+type rateLimiterSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&rateLimiterSuite{})
+
+func (*rateLimiterSuite) TestTryAcquireBurst(c *gc.C) {
+	clk := testclock.NewClock(time.Now())
+	l := utils.NewRateLimiterWithClock(10, 3, clk)
+	c.Check(l.TryAcquire(), jc.IsTrue)
+	c.Check(l.TryAcquire(), jc.IsTrue)
+	c.Check(l.TryAcquire(), jc.IsTrue)
+	c.Check(l.TryAcquire(), jc.IsFalse)
+}
+
+func (*rateLimiterSuite) TestTryAcquireRefills(c *gc.C) {
+	clk := testclock.NewClock(time.Now())
+	l := utils.NewRateLimiterWithClock(10, 2, clk)
+	c.Check(l.TryAcquire(), jc.IsTrue)
+	c.Check(l.TryAcquire(), jc.IsTrue)
+	c.Check(l.TryAcquire(), jc.IsFalse)
+
+	clk.Advance(100 * time.Millisecond)
+	c.Check(l.TryAcquire(), jc.IsTrue)
+	c.Check(l.TryAcquire(), jc.IsFalse)
+
+	// The bucket never holds more than the burst size.
+	clk.Advance(time.Hour)
+	c.Check(l.TryAcquire(), jc.IsTrue)
+	c.Check(l.TryAcquire(), jc.IsTrue)
+	c.Check(l.TryAcquire(), jc.IsFalse)
+}
+
+func (*rateLimiterSuite) TestAcquireWaits(c *gc.C) {
+	clk := testclock.NewClock(time.Now())
+	l := utils.NewRateLimiterWithClock(10, 1, clk)
+	c.Assert(l.Acquire(context.Background()), jc.ErrorIsNil)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- l.Acquire(context.Background())
+	}()
+	c.Assert(clk.WaitAdvance(99*time.Millisecond, longWait, 1), jc.ErrorIsNil)
+	select {
+	case <-done:
+		c.Fatalf("acquired too early")
+	case <-time.After(50 * time.Millisecond):
+	}
+	clk.Advance(time.Millisecond)
+	select {
+	case err := <-done:
+		c.Assert(err, jc.ErrorIsNil)
+	case <-time.After(longWait):
+		c.Fatalf("timed out waiting for acquire")
+	}
+}
+
+func (*rateLimiterSuite) TestAcquireFailsFast(c *gc.C) {
+	clk := testclock.NewClock(time.Now())
+	l := utils.NewRateLimiterWithClock(1, 1, clk)
+	c.Assert(l.TryAcquire(), jc.IsTrue)
+
+	ctx, cancel := utils.ContextWithTimeout(context.Background(), clk, 500*time.Millisecond)
+	defer cancel()
+	err := l.Acquire(ctx)
+	c.Assert(err, gc.Equals, utils.ErrRateLimitExceeded)
+
+	// The failed call must not have consumed a token.
+	clk.Advance(time.Second)
+	c.Assert(l.TryAcquire(), jc.IsTrue)
+}
+
+func (*rateLimiterSuite) TestAcquireCancelled(c *gc.C) {
+	clk := testclock.NewClock(time.Now())
+	l := utils.NewRateLimiterWithClock(1, 1, clk)
+	c.Assert(l.TryAcquire(), jc.IsTrue)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- l.Acquire(ctx)
+	}()
+	c.Assert(clk.WaitAdvance(0, longWait, 1), jc.ErrorIsNil)
+	cancel()
+	select {
+	case err := <-done:
+		c.Assert(err, gc.Equals, context.Canceled)
+	case <-time.After(longWait):
+		c.Fatalf("timed out waiting for acquire")
+	}
+
+	// The reserved token has been returned.
+	clk.Advance(time.Second)
+	c.Assert(l.TryAcquire(), jc.IsTrue)
+	c.Assert(l.TryAcquire(), jc.IsFalse)
+}
+
+type bandwidthLimiterSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&bandwidthLimiterSuite{})
+
+func (*bandwidthLimiterSuite) TestWaitN(c *gc.C) {
+	clk := testclock.NewClock(time.Now())
+	b := utils.NewBandwidthLimiter(100, 50, clk)
+	c.Assert(b.WaitN(context.Background(), 50), jc.ErrorIsNil)
+	c.Assert(b.WaitN(context.Background(), 0), jc.ErrorIsNil)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- b.WaitN(context.Background(), 20)
+	}()
+	// 20 bytes take 200ms to accrue.
+	c.Assert(clk.WaitAdvance(199*time.Millisecond, longWait, 1), jc.ErrorIsNil)
+	select {
+	case <-done:
+		c.Fatalf("waited too short a time")
+	case <-time.After(50 * time.Millisecond):
+	}
+	clk.Advance(time.Millisecond)
+	select {
+	case err := <-done:
+		c.Assert(err, jc.ErrorIsNil)
+	case <-time.After(longWait):
+		c.Fatalf("timed out waiting")
+	}
+}
+
+func (*bandwidthLimiterSuite) TestWaitNFailsFast(c *gc.C) {
+	clk := testclock.NewClock(time.Now())
+	b := utils.NewBandwidthLimiter(100, 100, clk)
+	ctx, cancel := utils.ContextWithTimeout(context.Background(), clk, time.Second)
+	defer cancel()
+	c.Assert(b.WaitN(ctx, 100), jc.ErrorIsNil)
+	c.Assert(b.WaitN(ctx, 150), gc.Equals, utils.ErrRateLimitExceeded)
+
+	// The failed call must not have consumed any bytes.
+	clk.Advance(time.Second)
+	c.Assert(b.WaitN(ctx, 100), jc.ErrorIsNil)
+}
+
+func (*bandwidthLimiterSuite) TestWriter(c *gc.C) {
+	clk := testclock.NewClock(time.Now())
+	b := utils.NewBandwidthLimiter(4, 4, clk)
+	var buf bytes.Buffer
+	w := b.Writer(context.Background(), &buf)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := w.Write([]byte("0123456789"))
+		done <- err
+	}()
+	// The first 4 bytes go at once, the next 4 a second
+	// later, and the last 2 half a second after that.
+	c.Assert(clk.WaitAdvance(time.Second, longWait, 1), jc.ErrorIsNil)
+	c.Assert(clk.WaitAdvance(500*time.Millisecond, longWait, 1), jc.ErrorIsNil)
+	select {
+	case err := <-done:
+		c.Assert(err, jc.ErrorIsNil)
+	case <-time.After(longWait):
+		c.Fatalf("write not done")
+	}
+	c.Assert(buf.String(), gc.Equals, "0123456789")
+}
+
+func (*bandwidthLimiterSuite) TestReader(c *gc.C) {
+	clk := testclock.NewClock(time.Now())
+	b := utils.NewBandwidthLimiter(4, 4, clk)
+	r := b.Reader(context.Background(), strings.NewReader("0123456789"))
+
+	// Reads return at most the burst size.
+	buf := make([]byte, 10)
+	n, err := r.Read(buf)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(buf[:n]), gc.Equals, "0123")
+
+	done := make(chan error, 1)
+	go func() {
+		n, err := r.Read(buf)
+		c.Check(string(buf[:n]), gc.Equals, "4567")
+		done <- err
+	}()
+	c.Assert(clk.WaitAdvance(time.Second, longWait, 1), jc.ErrorIsNil)
+	select {
+	case err := <-done:
+		c.Assert(err, jc.ErrorIsNil)
+	case <-time.After(longWait):
+		c.Fatalf("read not done")
+	}
+}
+
+func (*bandwidthLimiterSuite) TestReaderCancelled(c *gc.C) {
+	clk := testclock.NewClock(time.Now())
+	b := utils.NewBandwidthLimiter(1, 1, clk)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := b.Reader(ctx, strings.NewReader("0123456789"))
+	n, err := r.Read(make([]byte, 10))
+	c.Assert(err, gc.Equals, context.Canceled)
+	c.Assert(n, gc.Equals, 1)
+}
@@ -0,0 +1,10 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package readpass
+
+var (
+	IsTerminal       = &isTerminal
+	TermReadPassword = &readPassword
+	MakeRaw          = &makeRaw
+)
@@ -1,16 +1,210 @@
 // Copyright 2014 Canonical Ltd.
 // Licensed under the LGPLv3, see LICENCE file for details.
 
+// Package readpass reads passwords from a terminal without echoing
+// them, or from a file, pipe or environment variable when run
+// non-interactively. It works with Unix terminals and the Windows
+// console.
 package readpass
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"unicode/utf8"
 
 	"golang.org/x/crypto/ssh/terminal"
 )
 
+var (
+	// ErrMismatch is returned by Read when the password
+	// and its confirmation differ.
+	ErrMismatch = errors.New("passwords do not match")
+
+	// ErrInterrupted is returned by Read when
+	// Ctrl-C is typed while the password is read
+	// with a mask.
+	ErrInterrupted = errors.New("interrupted")
+)
+
+// These are variables so that they can be replaced in tests.
+var (
+	isTerminal   = terminal.IsTerminal
+	readPassword = terminal.ReadPassword
+	makeRaw      = func(fd int) (restore func(), err error) {
+		state, err := terminal.MakeRaw(fd)
+		if err != nil {
+			return nil, err
+		}
+		return func() { terminal.Restore(fd, state) }, nil
+	}
+)
+
+// Options holds the options for Read.
+type Options struct {
+	// Prompt is written before the password is read
+	// from a terminal.
+	Prompt string
+
+	// ConfirmPrompt, if not empty, makes Read read the password
+	// from a terminal a second time, after writing ConfirmPrompt,
+	// and fail with ErrMismatch if the two differ.
+	ConfirmPrompt string
+
+	// Input holds the file from which the password is read. If it
+	// is nil, os.Stdin is used. If it is not a terminal, the
+	// password is read from its first line, without prompting or
+	// confirmation, so that a password can be passed on a pipe or
+	// on a file descriptor opened with os.NewFile.
+	Input *os.File
+
+	// Output receives the prompts. If it is nil,
+	// os.Stderr is used.
+	Output io.Writer
+
+	// EnvVar, if not empty, names an environment variable
+	// holding the password. If the variable is set, its value
+	// is returned without reading Input.
+	EnvVar string
+
+	// Mask, if not zero, is echoed for each character typed
+	// at a terminal. Otherwise nothing is echoed.
+	Mask rune
+}
+
+// ReadPassword reads a password from standard input,
+// as Read does with no options.
 func ReadPassword() (string, error) {
-	fd := os.Stdin.Fd()
-	pass, err := terminal.ReadPassword(int(fd))
-	return string(pass), err
+	return Read(Options{})
+}
+
+// Read reads a password as directed by options.
+func Read(options Options) (string, error) {
+	if options.EnvVar != "" {
+		if pass, ok := os.LookupEnv(options.EnvVar); ok {
+			return pass, nil
+		}
+	}
+	input := options.Input
+	if input == nil {
+		input = os.Stdin
+	}
+	output := options.Output
+	if output == nil {
+		output = os.Stderr
+	}
+	fd := int(input.Fd())
+	if !isTerminal(fd) {
+		return readLine(input)
+	}
+	pass, err := readTerminal(fd, input, output, options.Prompt, options.Mask)
+	if err != nil || options.ConfirmPrompt == "" {
+		return pass, err
+	}
+	confirm, err := readTerminal(fd, input, output, options.ConfirmPrompt, options.Mask)
+	if err != nil {
+		return "", err
+	}
+	if confirm != pass {
+		return "", ErrMismatch
+	}
+	return pass, nil
+}
+
+// readTerminal prompts for and reads a password from the terminal
+// open as input, echoing mask for each character if it is not zero.
+func readTerminal(fd int, input io.Reader, output io.Writer, prompt string, mask rune) (string, error) {
+	fmt.Fprint(output, prompt)
+	// The newline typed is not echoed.
+	defer fmt.Fprintln(output)
+	if mask == 0 {
+		pass, err := readPassword(fd)
+		return string(pass), err
+	}
+	restore, err := makeRaw(fd)
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+	return readMasked(input, output, mask)
+}
+
+// readMasked reads a password from a terminal in raw mode, echoing
+// mask for each character and handling line editing keys.
+func readMasked(input io.Reader, output io.Writer, mask rune) (string, error) {
+	var pass []byte
+	var buf [1]byte
+	for {
+		n, err := input.Read(buf[:])
+		if n == 0 {
+			if err == nil {
+				continue
+			}
+			if err == io.EOF && len(pass) > 0 {
+				return string(pass), nil
+			}
+			return "", err
+		}
+		switch c := buf[0]; c {
+		case '\r', '\n':
+			return string(pass), nil
+		case 3: // Ctrl-C
+			return "", ErrInterrupted
+		case 4: // Ctrl-D
+			if len(pass) == 0 {
+				return "", io.EOF
+			}
+		case 8, 127: // Backspace, Delete
+			if len(pass) > 0 {
+				_, size := utf8.DecodeLastRune(pass)
+				pass = pass[:len(pass)-size]
+				fmt.Fprint(output, "\b \b")
+			}
+		case 21: // Ctrl-U
+			for len(pass) > 0 {
+				_, size := utf8.DecodeLastRune(pass)
+				pass = pass[:len(pass)-size]
+				fmt.Fprint(output, "\b \b")
+			}
+		default:
+			if c < ' ' {
+				// Ignore other control characters.
+				continue
+			}
+			pass = append(pass, c)
+			// Echo the mask once for each character,
+			// at its first byte.
+			if utf8.RuneStart(c) {
+				fmt.Fprint(output, string(mask))
+			}
+		}
+	}
+}
+
+// readLine reads a line from input, a byte at a time so
+// that nothing after the line is consumed.
+func readLine(input io.Reader) (string, error) {
+	var line []byte
+	var buf [1]byte
+	for {
+		n, err := input.Read(buf[:])
+		if n > 0 {
+			if buf[0] == '\n' {
+				break
+			}
+			line = append(line, buf[0])
+			continue
+		}
+		if err == io.EOF && len(line) > 0 {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	if n := len(line); n > 0 && line[n-1] == '\r' {
+		line = line[:n-1]
+	}
+	return string(line), nil
 }
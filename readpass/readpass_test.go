@@ -0,0 +1,175 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package readpass_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/readpass"
+)
+
+type readpassSuite struct {
+	testing.IsolationSuite
+	output bytes.Buffer
+}
+
+var _ = gc.Suite(&readpassSuite{})
+
+func (s *readpassSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.output.Reset()
+}
+
+// input returns a file from which the given data can be read.
+func (s *readpassSuite) input(c *gc.C, data string) *os.File {
+	r, w, err := os.Pipe()
+	c.Assert(err, jc.ErrorIsNil)
+	s.AddCleanup(func(*gc.C) { r.Close() })
+	go func() {
+		io.WriteString(w, data)
+		w.Close()
+	}()
+	return r
+}
+
+// patchTerminal makes every file a terminal, from which
+// unmasked reads return each of the given passwords in turn.
+func (s *readpassSuite) patchTerminal(passwords ...string) {
+	s.PatchValue(readpass.IsTerminal, func(int) bool { return true })
+	s.PatchValue(readpass.TermReadPassword, func(int) ([]byte, error) {
+		if len(passwords) == 0 {
+			return nil, io.EOF
+		}
+		pass := passwords[0]
+		passwords = passwords[1:]
+		return []byte(pass), nil
+	})
+	s.PatchValue(readpass.MakeRaw, func(int) (func(), error) {
+		return func() {}, nil
+	})
+}
+
+func (s *readpassSuite) TestReadLine(c *gc.C) {
+	input := s.input(c, "s3cret\r\nrest\n")
+	pass, err := readpass.Read(readpass.Options{
+		Prompt: "Password: ",
+		Input:  input,
+		Output: &s.output,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(pass, gc.Equals, "s3cret")
+	// Nothing is prompted for, and nothing
+	// after the line is read.
+	c.Assert(s.output.String(), gc.Equals, "")
+	rest, err := ioutil.ReadAll(input)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(rest), gc.Equals, "rest\n")
+}
+
+func (s *readpassSuite) TestReadLineNoNewline(c *gc.C) {
+	pass, err := readpass.Read(readpass.Options{Input: s.input(c, "s3cret")})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(pass, gc.Equals, "s3cret")
+}
+
+func (s *readpassSuite) TestReadLineEmptyInput(c *gc.C) {
+	_, err := readpass.Read(readpass.Options{Input: s.input(c, "")})
+	c.Assert(err, gc.Equals, io.EOF)
+}
+
+func (s *readpassSuite) TestEnvVar(c *gc.C) {
+	s.PatchEnvironment("TEST_PASSWORD", "from-env")
+	pass, err := readpass.Read(readpass.Options{
+		EnvVar: "TEST_PASSWORD",
+		Input:  s.input(c, "from-input\n"),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(pass, gc.Equals, "from-env")
+
+	// An unset variable is ignored.
+	pass, err = readpass.Read(readpass.Options{
+		EnvVar: "TEST_PASSWORD_UNSET",
+		Input:  s.input(c, "from-input\n"),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(pass, gc.Equals, "from-input")
+}
+
+func (s *readpassSuite) TestTerminal(c *gc.C) {
+	s.patchTerminal("s3cret")
+	pass, err := readpass.Read(readpass.Options{
+		Prompt: "Password: ",
+		Input:  s.input(c, ""),
+		Output: &s.output,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(pass, gc.Equals, "s3cret")
+	c.Assert(s.output.String(), gc.Equals, "Password: \n")
+}
+
+func (s *readpassSuite) TestConfirm(c *gc.C) {
+	s.patchTerminal("s3cret", "s3cret")
+	pass, err := readpass.Read(readpass.Options{
+		Prompt:        "Password: ",
+		ConfirmPrompt: "Again: ",
+		Input:         s.input(c, ""),
+		Output:        &s.output,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(pass, gc.Equals, "s3cret")
+	c.Assert(s.output.String(), gc.Equals, "Password: \nAgain: \n")
+}
+
+func (s *readpassSuite) TestConfirmMismatch(c *gc.C) {
+	s.patchTerminal("s3cret", "secret")
+	_, err := readpass.Read(readpass.Options{
+		ConfirmPrompt: "Again: ",
+		Input:         s.input(c, ""),
+		Output:        &s.output,
+	})
+	c.Assert(err, gc.Equals, readpass.ErrMismatch)
+}
+
+func (s *readpassSuite) TestMask(c *gc.C) {
+	s.patchTerminal()
+	// Typing "s3x", backspace, "creté" and enter.
+	pass, err := readpass.Read(readpass.Options{
+		Prompt: "Password: ",
+		Input:  s.input(c, "s3x\x7fcreté\x01\r"),
+		Output: &s.output,
+		Mask:   '*',
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(pass, gc.Equals, "s3creté")
+	c.Assert(s.output.String(), gc.Equals, "Password: ***\b \b*****\n")
+}
+
+func (s *readpassSuite) TestMaskClearLine(c *gc.C) {
+	s.patchTerminal()
+	pass, err := readpass.Read(readpass.Options{
+		Input:  s.input(c, "ab\x15cd\n"),
+		Output: &s.output,
+		Mask:   '*',
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(pass, gc.Equals, "cd")
+	c.Assert(s.output.String(), gc.Equals, "**\b \b\b \b**\n")
+}
+
+func (s *readpassSuite) TestMaskInterrupted(c *gc.C) {
+	s.patchTerminal()
+	_, err := readpass.Read(readpass.Options{
+		Input:  s.input(c, "ab\x03"),
+		Output: &s.output,
+		Mask:   '*',
+	})
+	c.Assert(err, gc.Equals, readpass.ErrInterrupted)
+}
@@ -0,0 +1,235 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package registry
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/juju/errors"
+
+	"github.com/juju/utils/v3/panics"
+)
+
+// DuplicatePolicy determines what happens when a name
+// is registered more than once.
+type DuplicatePolicy int
+
+const (
+	// RejectDuplicates causes registering an existing
+	// name to fail with an AlreadyExists error.
+	RejectDuplicates DuplicatePolicy = iota
+
+	// ReplaceDuplicates causes registering an existing
+	// name to replace the previous registration.
+	ReplaceDuplicates
+
+	// KeepFirst causes registering an existing name
+	// to be silently ignored.
+	KeepFirst
+)
+
+// Options holds the options for a Registry.
+type Options struct {
+	// Duplicates determines what happens when a name
+	// is registered more than once.
+	Duplicates DuplicatePolicy
+
+	// OnRegister, if not nil, is called with the name
+	// of each object after it has been registered.
+	OnRegister func(name string)
+
+	// OnUnregister, if not nil, is called with the name
+	// of each object after it has been unregistered,
+	// including by Reset.
+	OnUnregister func(name string)
+}
+
+// Registry holds named objects of type T. Objects may be registered
+// directly or through a constructor that is called the first time
+// the object is retrieved.
+//
+// It is safe to use a Registry from multiple goroutines.
+type Registry[T any] struct {
+	opts Options
+
+	mu      sync.Mutex
+	entries map[string]*lazyEntry[T]
+}
+
+// lazyEntry holds a registered object, or the constructor
+// used to create it.
+type lazyEntry[T any] struct {
+	mu    sync.Mutex
+	value T
+	ctor  func() (T, error)
+}
+
+// get returns the entry's object, calling its constructor if it has
+// not yet been created. A failed construction, including one that
+// panics, is retried on the next call.
+func (e *lazyEntry[T]) get() (T, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.ctor != nil {
+		value, err := panics.CallValue(e.ctor)
+		if err != nil {
+			return value, err
+		}
+		e.value, e.ctor = value, nil
+	}
+	return e.value, nil
+}
+
+// New returns a new, empty, Registry.
+func New[T any](opts Options) *Registry[T] {
+	return &Registry[T]{
+		opts:    opts,
+		entries: make(map[string]*lazyEntry[T]),
+	}
+}
+
+// Register registers obj with the given name.
+func (r *Registry[T]) Register(name string, obj T) error {
+	return r.add(name, &lazyEntry[T]{value: obj})
+}
+
+// RegisterLazy registers ctor to create the object with the given
+// name when it is first retrieved. If ctor returns an error, it is
+// called again on the next retrieval.
+func (r *Registry[T]) RegisterLazy(name string, ctor func() (T, error)) error {
+	if ctor == nil {
+		return errors.NotValidf("nil constructor for %q", name)
+	}
+	return r.add(name, &lazyEntry[T]{ctor: ctor})
+}
+
+func (r *Registry[T]) add(name string, e *lazyEntry[T]) error {
+	r.mu.Lock()
+	if _, ok := r.entries[name]; ok {
+		switch r.opts.Duplicates {
+		case ReplaceDuplicates:
+		case KeepFirst:
+			r.mu.Unlock()
+			return nil
+		default:
+			r.mu.Unlock()
+			return errors.AlreadyExistsf("object %q", name)
+		}
+	}
+	r.entries[name] = e
+	r.mu.Unlock()
+	if r.opts.OnRegister != nil {
+		r.opts.OnRegister(name)
+	}
+	return nil
+}
+
+// Get returns the object registered with the given name. If there is
+// none, it returns an error satisfying errors.IsNotFound.
+func (r *Registry[T]) Get(name string) (T, error) {
+	r.mu.Lock()
+	e, ok := r.entries[name]
+	r.mu.Unlock()
+	if !ok {
+		var zero T
+		return zero, errors.NotFoundf("object %q", name)
+	}
+	obj, err := e.get()
+	if err != nil {
+		var zero T
+		return zero, errors.Annotatef(err, "cannot create object %q", name)
+	}
+	return obj, nil
+}
+
+// ListNames returns the registered names in sorted order.
+func (r *Registry[T]) ListNames() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.entries))
+	for name := range r.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Unregister removes the object with the given
+// name, reporting whether it was registered.
+func (r *Registry[T]) Unregister(name string) bool {
+	r.mu.Lock()
+	_, ok := r.entries[name]
+	delete(r.entries, name)
+	r.mu.Unlock()
+	if ok && r.opts.OnUnregister != nil {
+		r.opts.OnUnregister(name)
+	}
+	return ok
+}
+
+// Reset removes all registered objects. It is
+// intended to be used to isolate tests.
+func (r *Registry[T]) Reset() {
+	for _, name := range r.ListNames() {
+		r.Unregister(name)
+	}
+}
+
+var (
+	defaultsMu sync.Mutex
+	defaults   = make(map[reflect.Type]interface{})
+)
+
+// Default returns the process-wide Registry for objects of type T,
+// which rejects duplicate registrations. It is used by the Register,
+// Get, ListNames, Unregister and Reset functions.
+func Default[T any]() *Registry[T] {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	defaultsMu.Lock()
+	defer defaultsMu.Unlock()
+	if r, ok := defaults[t]; ok {
+		return r.(*Registry[T])
+	}
+	r := New[T](Options{})
+	defaults[t] = r
+	return r
+}
+
+// Register registers obj with the given
+// name in the default registry for T.
+func Register[T any](name string, obj T) error {
+	return Default[T]().Register(name, obj)
+}
+
+// RegisterLazy registers ctor with the given
+// name in the default registry for T.
+func RegisterLazy[T any](name string, ctor func() (T, error)) error {
+	return Default[T]().RegisterLazy(name, ctor)
+}
+
+// Get returns the object with the given
+// name in the default registry for T.
+func Get[T any](name string) (T, error) {
+	return Default[T]().Get(name)
+}
+
+// ListNames returns the names registered
+// in the default registry for T.
+func ListNames[T any]() []string {
+	return Default[T]().ListNames()
+}
+
+// Unregister removes the object with the given
+// name from the default registry for T.
+func Unregister[T any](name string) bool {
+	return Default[T]().Unregister(name)
+}
+
+// Reset removes all objects from the default registry
+// for T. It is intended to be used to isolate tests.
+func Reset[T any]() {
+	Default[T]().Reset()
+}
@@ -0,0 +1,172 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package registry_test
+
+import (
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/panics"
+	"github.com/juju/utils/v3/registry"
+)
+
+type genericSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&genericSuite{})
+
+type plugin interface {
+	Name() string
+}
+
+type namedPlugin string
+
+func (p namedPlugin) Name() string {
+	return string(p)
+}
+
+func (s *genericSuite) TestRegisterGet(c *gc.C) {
+	r := registry.New[plugin](registry.Options{})
+	err := r.Register("b", namedPlugin("bee"))
+	c.Assert(err, jc.ErrorIsNil)
+	err = r.Register("a", namedPlugin("ay"))
+	c.Assert(err, jc.ErrorIsNil)
+
+	p, err := r.Get("b")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(p.Name(), gc.Equals, "bee")
+	c.Check(r.ListNames(), jc.DeepEquals, []string{"a", "b"})
+
+	_, err = r.Get("c")
+	c.Check(err, jc.Satisfies, errors.IsNotFound)
+	c.Check(err, gc.ErrorMatches, `object "c" not found`)
+}
+
+func (s *genericSuite) TestDuplicatePolicies(c *gc.C) {
+	r := registry.New[int](registry.Options{})
+	c.Assert(r.Register("x", 1), jc.ErrorIsNil)
+	err := r.Register("x", 2)
+	c.Check(err, jc.Satisfies, errors.IsAlreadyExists)
+	c.Check(err, gc.ErrorMatches, `object "x" already exists`)
+
+	r = registry.New[int](registry.Options{Duplicates: registry.ReplaceDuplicates})
+	c.Assert(r.Register("x", 1), jc.ErrorIsNil)
+	c.Assert(r.Register("x", 2), jc.ErrorIsNil)
+	v, err := r.Get("x")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(v, gc.Equals, 2)
+
+	r = registry.New[int](registry.Options{Duplicates: registry.KeepFirst})
+	c.Assert(r.Register("x", 1), jc.ErrorIsNil)
+	c.Assert(r.Register("x", 2), jc.ErrorIsNil)
+	v, err = r.Get("x")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(v, gc.Equals, 1)
+}
+
+func (s *genericSuite) TestRegisterLazy(c *gc.C) {
+	r := registry.New[plugin](registry.Options{})
+	calls := 0
+	fail := true
+	err := r.RegisterLazy("lazy", func() (plugin, error) {
+		calls++
+		if fail {
+			return nil, errors.New("not yet")
+		}
+		return namedPlugin("lazy"), nil
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(calls, gc.Equals, 0)
+
+	_, err = r.Get("lazy")
+	c.Check(err, gc.ErrorMatches, `cannot create object "lazy": not yet`)
+	fail = false
+	for i := 0; i < 2; i++ {
+		p, err := r.Get("lazy")
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(p.Name(), gc.Equals, "lazy")
+	}
+	c.Check(calls, gc.Equals, 2)
+
+	err = r.RegisterLazy("nil", nil)
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+}
+
+func (s *genericSuite) TestRegisterLazyPanic(c *gc.C) {
+	r := registry.New[plugin](registry.Options{})
+	fail := true
+	err := r.RegisterLazy("lazy", func() (plugin, error) {
+		if fail {
+			panic("bad constructor")
+		}
+		return namedPlugin("lazy"), nil
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	_, err = r.Get("lazy")
+	c.Check(err, gc.ErrorMatches, `cannot create object "lazy": panic: bad constructor`)
+	c.Check(err, jc.Satisfies, panics.IsPanic)
+
+	// The constructor is retried.
+	fail = false
+	p, err := r.Get("lazy")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(p.Name(), gc.Equals, "lazy")
+}
+
+func (s *genericSuite) TestUnregisterResetAndHooks(c *gc.C) {
+	var registered, unregistered []string
+	r := registry.New[int](registry.Options{
+		OnRegister: func(name string) {
+			registered = append(registered, name)
+		},
+		OnUnregister: func(name string) {
+			unregistered = append(unregistered, name)
+		},
+	})
+	c.Assert(r.Register("a", 1), jc.ErrorIsNil)
+	c.Assert(r.Register("b", 2), jc.ErrorIsNil)
+	c.Assert(r.Register("c", 3), jc.ErrorIsNil)
+	c.Check(r.Register("c", 3), gc.NotNil)
+
+	c.Check(r.Unregister("b"), jc.IsTrue)
+	c.Check(r.Unregister("b"), jc.IsFalse)
+	c.Check(r.ListNames(), jc.DeepEquals, []string{"a", "c"})
+	r.Reset()
+	c.Check(r.ListNames(), gc.HasLen, 0)
+
+	c.Check(registered, jc.DeepEquals, []string{"a", "b", "c"})
+	c.Check(unregistered, jc.DeepEquals, []string{"b", "a", "c"})
+}
+
+type otherPlugin interface {
+	plugin
+}
+
+func (s *genericSuite) TestDefaultRegistries(c *gc.C) {
+	defer registry.Reset[plugin]()
+	defer registry.Reset[otherPlugin]()
+
+	c.Assert(registry.Register[plugin]("p", namedPlugin("p")), jc.ErrorIsNil)
+	c.Assert(registry.RegisterLazy("q", func() (plugin, error) {
+		return namedPlugin("q"), nil
+	}), jc.ErrorIsNil)
+	c.Check(registry.Register[plugin]("p", namedPlugin("p")), jc.Satisfies, errors.IsAlreadyExists)
+
+	p, err := registry.Get[plugin]("q")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(p.Name(), gc.Equals, "q")
+	c.Check(registry.ListNames[plugin](), jc.DeepEquals, []string{"p", "q"})
+
+	// Each type has its own registry.
+	c.Check(registry.ListNames[otherPlugin](), gc.HasLen, 0)
+	_, err = registry.Get[otherPlugin]("p")
+	c.Check(err, jc.Satisfies, errors.IsNotFound)
+
+	c.Check(registry.Unregister[plugin]("p"), jc.IsTrue)
+	c.Check(registry.ListNames[plugin](), jc.DeepEquals, []string{"q"})
+}
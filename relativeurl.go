@@ -4,6 +4,8 @@
 package utils
 
 import (
+	"net/url"
+	"path"
 	"strings"
 
 	"github.com/juju/errors"
@@ -60,3 +62,65 @@ func RelativeURLPath(basePath, targPath string) (string, error) {
 	}
 	return final, nil
 }
+
+// JoinURLPath returns a copy of base with the given path elements
+// joined to its path, which is cleaned. The result keeps a trailing
+// slash on the last element. An error satisfying errors.IsNotValid is
+// returned if the elements would take the path above that of base,
+// as an element holding ".." taken from untrusted input might.
+func JoinURLPath(base *url.URL, elem ...string) (*url.URL, error) {
+	rel := path.Join(elem...)
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return nil, errors.NotValidf("path %q outside %q", rel, base.Path)
+	}
+	joined := path.Join("/", base.Path, rel)
+	if n := len(elem); n > 0 && strings.HasSuffix(elem[n-1], "/") && !strings.HasSuffix(joined, "/") {
+		joined += "/"
+	}
+	u := *base
+	u.Path = joined
+	u.RawPath = ""
+	return &u, nil
+}
+
+// MergeURLQuery returns a copy of u whose query holds its existing
+// parameters together with params, which replace any existing
+// parameters of the same names. The query is canonicalised, with the
+// parameters sorted by name, so that equal queries format equally.
+func MergeURLQuery(u *url.URL, params url.Values) *url.URL {
+	query := u.Query()
+	for name, values := range params {
+		query[name] = append([]string(nil), values...)
+	}
+	merged := *u
+	merged.RawQuery = query.Encode()
+	merged.ForceQuery = false
+	return &merged
+}
+
+// RedactURL returns rawURL with any password in it replaced by
+// "xxxxx", so that the URL can be logged. A string that cannot be
+// parsed as a URL has everything before the last "@" of its host
+// part replaced instead.
+func RedactURL(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		if _, ok := u.User.Password(); !ok {
+			return rawURL
+		}
+		return u.Redacted()
+	}
+	start := strings.Index(rawURL, "://")
+	if start < 0 {
+		return rawURL
+	}
+	start += len("://")
+	end := len(rawURL)
+	if i := strings.IndexAny(rawURL[start:], "/?#"); i >= 0 {
+		end = start + i
+	}
+	at := strings.LastIndex(rawURL[start:end], "@")
+	if at < 0 {
+		return rawURL
+	}
+	return rawURL[:start] + "xxxxx" + rawURL[start+at:]
+}
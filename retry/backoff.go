@@ -0,0 +1,153 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry
+
+import (
+	"math"
+	"time"
+)
+
+// Iterator yields the delays before successive retries.
+type Iterator interface {
+	// Next returns the delay before the next retry.
+	Next() time.Duration
+}
+
+// IteratorFunc adapts a function to the Iterator interface.
+type IteratorFunc func() time.Duration
+
+// Next implements Iterator.
+func (f IteratorFunc) Next() time.Duration {
+	return f()
+}
+
+// Backoff generates sequences of delays, which may depend on the
+// delays before them. Each call returns a new, independent Iterator.
+//
+// Backoff implements Strategy, so it may be used as Policy.Backoff;
+// Do then uses a fresh iterator for each call. Backoffs are composed
+// with methods such as Cap and Jitter:
+//
+//	retry.ExponentialBackoff(time.Second, 2).Jitter(0.2, nil).Cap(time.Minute)
+type Backoff func() Iterator
+
+// Iterator returns a new iterator over the delays.
+func (b Backoff) Iterator() Iterator {
+	return b()
+}
+
+// Delay implements Strategy by returning the delay at the given
+// position in a new sequence. Do does not use it, as it would
+// restart the sequence for each retry.
+func (b Backoff) Delay(retry int) time.Duration {
+	it := b()
+	var d time.Duration
+	for i := 0; i < retry; i++ {
+		d = it.Next()
+	}
+	return d
+}
+
+// Cap returns a backoff whose delays are never longer than max.
+func (b Backoff) Cap(max time.Duration) Backoff {
+	return func() Iterator {
+		it := b()
+		return IteratorFunc(func() time.Duration {
+			if d := it.Next(); d < max {
+				return d
+			}
+			return max
+		})
+	}
+}
+
+// Jitter returns a backoff that randomly adjusts each delay by up to
+// the given fraction of itself in either direction. The rnd function
+// returns random numbers in [0, 1); if it is nil, a shared source
+// seeded with the current time is used.
+func (b Backoff) Jitter(fraction float64, rnd func() float64) Backoff {
+	rnd = randFunc(rnd)
+	return func() Iterator {
+		it := b()
+		return IteratorFunc(func() time.Duration {
+			d := float64(it.Next())
+			return capDuration(d + d*fraction*(rnd()*2-1))
+		})
+	}
+}
+
+// ExponentialBackoff returns a backoff that waits for initial before
+// the first retry and multiplies the delay by factor after that.
+func ExponentialBackoff(initial time.Duration, factor float64) Backoff {
+	return func() Iterator {
+		d := float64(initial)
+		return IteratorFunc(func() time.Duration {
+			next := capDuration(d)
+			d *= factor
+			return next
+		})
+	}
+}
+
+// FibonacciBackoff returns a backoff whose delays are initial times
+// the successive Fibonacci numbers: 1, 1, 2, 3, 5 and so on. Delays
+// grow more gently than with a factor of two.
+func FibonacciBackoff(initial time.Duration) Backoff {
+	return func() Iterator {
+		a, b := 1.0, 1.0
+		return IteratorFunc(func() time.Duration {
+			d := capDuration(float64(initial) * a)
+			a, b = b, a+b
+			return d
+		})
+	}
+}
+
+// DecorrelatedJitterBackoff returns a backoff in which each delay is
+// chosen at random between base and three times the previous delay,
+// and is no longer than max. It spreads out retries from many clients
+// better than jittering an exponential backoff. The rnd function is
+// used as for Jitter.
+func DecorrelatedJitterBackoff(base, max time.Duration, rnd func() float64) Backoff {
+	rnd = randFunc(rnd)
+	return func() Iterator {
+		prev := base
+		return IteratorFunc(func() time.Duration {
+			upper := math.Min(float64(prev)*3, float64(max))
+			d := capDuration(float64(base) + rnd()*(upper-float64(base)))
+			if d < base {
+				d = base
+			}
+			prev = d
+			return d
+		})
+	}
+}
+
+// StrategyBackoff returns a backoff yielding the delays of s.
+func StrategyBackoff(s Strategy) Backoff {
+	if b, ok := s.(Backoff); ok {
+		return b
+	}
+	return func() Iterator {
+		retry := 0
+		return IteratorFunc(func() time.Duration {
+			retry++
+			return s.Delay(retry)
+		})
+	}
+}
+
+// randFunc returns rnd, or a function using the shared
+// random source if it is nil.
+func randFunc(rnd func() float64) func() float64 {
+	if rnd != nil {
+		return rnd
+	}
+	return func() float64 {
+		randMu.Lock()
+		defer randMu.Unlock()
+		return random.Float64()
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/juju/clock/testclock"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/retry"
+)
+
+type backoffSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&backoffSuite{})
+
+// take returns the first n delays of a new iterator from b.
+func take(b retry.Backoff, n int) []time.Duration {
+	it := b.Iterator()
+	ds := make([]time.Duration, n)
+	for i := range ds {
+		ds[i] = it.Next()
+	}
+	return ds
+}
+
+// fixedRand returns a random number function that returns
+// the given values in turn, repeating the last one.
+func fixedRand(vals ...float64) func() float64 {
+	return func() float64 {
+		v := vals[0]
+		if len(vals) > 1 {
+			vals = vals[1:]
+		}
+		return v
+	}
+}
+
+func (*backoffSuite) TestExponential(c *gc.C) {
+	c.Check(take(retry.ExponentialBackoff(time.Second, 2), 4), jc.DeepEquals, []time.Duration{
+		time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second,
+	})
+	c.Check(take(retry.ExponentialBackoff(time.Second, 1e10), 3)[2], gc.Equals, time.Duration(1<<63-1))
+}
+
+func (*backoffSuite) TestFibonacci(c *gc.C) {
+	c.Check(take(retry.FibonacciBackoff(time.Second), 6), jc.DeepEquals, []time.Duration{
+		time.Second, time.Second, 2 * time.Second, 3 * time.Second, 5 * time.Second, 8 * time.Second,
+	})
+}
+
+func (*backoffSuite) TestCap(c *gc.C) {
+	c.Check(take(retry.FibonacciBackoff(time.Second).Cap(4*time.Second), 6), jc.DeepEquals, []time.Duration{
+		time.Second, time.Second, 2 * time.Second, 3 * time.Second, 4 * time.Second, 4 * time.Second,
+	})
+}
+
+func (*backoffSuite) TestJitter(c *gc.C) {
+	b := retry.ExponentialBackoff(time.Second, 2).Jitter(0.5, fixedRand(0, 0.5, 0.75, 0.9999999999))
+	c.Check(take(b, 4), jc.DeepEquals, []time.Duration{
+		500 * time.Millisecond, 2 * time.Second, 5 * time.Second, 12*time.Second - 1,
+	})
+}
+
+func (*backoffSuite) TestJitterSharedSource(c *gc.C) {
+	for _, d := range take(retry.ExponentialBackoff(time.Second, 1).Jitter(0.1, nil), 50) {
+		c.Check(d >= 900*time.Millisecond && d <= 1100*time.Millisecond, jc.IsTrue, gc.Commentf("delay %v", d))
+	}
+}
+
+func (*backoffSuite) TestDecorrelatedJitter(c *gc.C) {
+	b := retry.DecorrelatedJitterBackoff(time.Second, 10*time.Second, fixedRand(1, 1, 0, 0.5, 1, 1))
+	c.Check(take(b, 6), jc.DeepEquals, []time.Duration{
+		// Each delay is between base and three times the
+		// previous one, but never more than the maximum.
+		3 * time.Second, 9 * time.Second, time.Second, 2 * time.Second, 6 * time.Second, 10 * time.Second,
+	})
+}
+
+func (*backoffSuite) TestIteratorsIndependent(c *gc.C) {
+	b := retry.ExponentialBackoff(time.Second, 2)
+	it1 := b.Iterator()
+	it1.Next()
+	it1.Next()
+	c.Check(b.Iterator().Next(), gc.Equals, time.Second)
+	c.Check(it1.Next(), gc.Equals, 4*time.Second)
+}
+
+func (*backoffSuite) TestDelay(c *gc.C) {
+	b := retry.FibonacciBackoff(time.Second)
+	c.Check(b.Delay(1), gc.Equals, time.Second)
+	c.Check(b.Delay(5), gc.Equals, 5*time.Second)
+}
+
+func (*backoffSuite) TestStrategyBackoff(c *gc.C) {
+	c.Check(take(retry.StrategyBackoff(retry.Linear(time.Second, time.Second)), 3), jc.DeepEquals, []time.Duration{
+		time.Second, 2 * time.Second, 3 * time.Second,
+	})
+}
+
+func (*backoffSuite) TestPolicyUsesIterator(c *gc.C) {
+	// Each call to Do starts a fresh sequence, and the sequence
+	// is not restarted for each retry.
+	policy := retry.Policy{
+		Attempts: 4,
+		Backoff:  retry.DecorrelatedJitterBackoff(time.Millisecond, time.Hour, fixedRand(1)),
+	}
+	for i := 0; i < 2; i++ {
+		var delays []time.Duration
+		policy.OnRetry = func(_ int, _ error, delay time.Duration) {
+			delays = append(delays, delay)
+		}
+		policy.Clock = testclock.NewClock(time.Now())
+		calls := 0
+		result := make(chan error, 1)
+		go func() {
+			result <- retry.Do(context.Background(), policy, failTimes(3, &calls))
+		}()
+		for _, d := range []time.Duration{3, 9, 27} {
+			err := policy.Clock.(*testclock.Clock).WaitAdvance(d*time.Millisecond, testing.LongWait, 1)
+			c.Assert(err, jc.ErrorIsNil)
+		}
+		select {
+		case err := <-result:
+			c.Assert(err, jc.ErrorIsNil)
+		case <-time.After(testing.LongWait):
+			c.Fatalf("timed out waiting for result")
+		}
+		c.Check(delays, jc.DeepEquals, []time.Duration{
+			3 * time.Millisecond, 9 * time.Millisecond, 27 * time.Millisecond,
+		})
+	}
+}
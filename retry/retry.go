@@ -0,0 +1,260 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package retry calls functions repeatedly until they succeed, with
+// configurable backoff, jitter and classification of errors.
+//
+// Retries stop as soon as the context passed to Do is done, and errors
+// caused by a cancelled context are never retried, so Do may be used
+// inside a group of goroutines sharing a context (such as an errgroup)
+// without delaying the group once one of its members has failed.
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/juju/clock"
+)
+
+// Strategy determines the delay before each retry.
+type Strategy interface {
+	// Delay returns the time to wait before the given retry. The
+	// first retry (the second attempt) is retry 1.
+	Delay(retry int) time.Duration
+}
+
+// StrategyFunc adapts a function to the Strategy interface.
+type StrategyFunc func(retry int) time.Duration
+
+// Delay implements Strategy.
+func (f StrategyFunc) Delay(retry int) time.Duration {
+	return f(retry)
+}
+
+// Constant returns a strategy that always waits for d.
+func Constant(d time.Duration) Strategy {
+	return StrategyFunc(func(int) time.Duration {
+		return d
+	})
+}
+
+// Linear returns a strategy that waits for initial before the first
+// retry and step longer before each retry after that.
+func Linear(initial, step time.Duration) Strategy {
+	return StrategyFunc(func(retry int) time.Duration {
+		return capDuration(float64(initial) + float64(step)*float64(retry-1))
+	})
+}
+
+// Exponential returns a strategy that waits for initial before the
+// first retry and multiplies the delay by factor before each retry
+// after that. If max is positive, no delay is longer than max.
+func Exponential(initial time.Duration, factor float64, max time.Duration) Strategy {
+	return StrategyFunc(func(retry int) time.Duration {
+		d := capDuration(float64(initial) * math.Pow(factor, float64(retry-1)))
+		if max > 0 && d > max {
+			d = max
+		}
+		return d
+	})
+}
+
+func capDuration(d float64) time.Duration {
+	if d >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+	if d < 0 {
+		return 0
+	}
+	return time.Duration(d)
+}
+
+// Policy describes how a function is retried.
+type Policy struct {
+	// Attempts, if positive, holds the maximum number of attempts
+	// made, including the first.
+	Attempts int
+
+	// MaxDuration, if positive, stops retries once that much time
+	// has passed since the first attempt. No retry is started if
+	// its delay would end after that time.
+	MaxDuration time.Duration
+
+	// Backoff determines the delay before each retry. If it is nil,
+	// retries are made immediately. If it is a Backoff, each call
+	// to Do uses a new iterator.
+	Backoff Strategy
+
+	// Jitter, if positive, randomly adjusts each delay by up to that
+	// fraction of itself in either direction.
+	Jitter float64
+
+	// RetryIf reports whether an attempt that failed with the given
+	// error should be retried. It is not called for permanent errors
+	// or for errors caused by the context being done, which are never
+	// retried. If it is nil, all other errors are retried.
+	RetryIf func(err error) bool
+
+	// OnRetry, if not nil, is called before waiting to make each
+	// retry, with the number of the attempt that failed, its error
+	// and the delay before the next attempt.
+	OnRetry func(attempt int, err error, delay time.Duration)
+
+	// Clock is used to measure time and to wait between attempts.
+	// If it is nil, the wall clock is used.
+	Clock clock.Clock
+}
+
+// Do calls f until it returns nil, the policy forbids another attempt
+// or ctx is done. It returns nil if f succeeded; otherwise it returns
+// an *Error holding the last error returned by f, or the context's
+// error if ctx was done before f was called.
+func Do(ctx context.Context, p Policy, f func(ctx context.Context) error) error {
+	_, err := DoValue(ctx, p, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, f(ctx)
+	})
+	return err
+}
+
+// DoValue is like Do, but returns the value returned by the successful
+// call of f.
+func DoValue[T any](ctx context.Context, p Policy, f func(ctx context.Context) (T, error)) (T, error) {
+	clk := p.Clock
+	if clk == nil {
+		clk = clock.WallClock
+	}
+	start := clk.Now()
+	delays := p.delays()
+	var zero T
+	for attempt := 1; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return zero, &Error{Attempts: attempt - 1, Err: err}
+		}
+		v, err := f(ctx)
+		if err == nil {
+			return v, nil
+		}
+		if !p.retryable(ctx, err) || (p.Attempts > 0 && attempt >= p.Attempts) {
+			return zero, failed(attempt, err)
+		}
+		delay := delays.Next()
+		if p.MaxDuration > 0 && clk.Now().Add(delay).Sub(start) > p.MaxDuration {
+			return zero, failed(attempt, err)
+		}
+		if p.OnRetry != nil {
+			p.OnRetry(attempt, err, delay)
+		}
+		if delay > 0 {
+			select {
+			case <-clk.After(delay):
+			case <-ctx.Done():
+				return zero, failed(attempt, err)
+			}
+		}
+	}
+}
+
+func (p Policy) retryable(ctx context.Context, err error) bool {
+	if IsPermanent(err) || ctx.Err() != nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if p.RetryIf != nil {
+		return p.RetryIf(err)
+	}
+	return true
+}
+
+var (
+	randMu sync.Mutex
+	random = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// delays returns an iterator over the delays before each
+// retry of a single call to Do.
+func (p Policy) delays() Iterator {
+	if p.Backoff == nil {
+		return IteratorFunc(func() time.Duration { return 0 })
+	}
+	b := StrategyBackoff(p.Backoff)
+	if p.Jitter > 0 {
+		b = b.Jitter(p.Jitter, nil)
+	}
+	return b.Iterator()
+}
+
+// Error is returned by Do when f did not succeed.
+type Error struct {
+	// Attempts holds the number of times f was called.
+	Attempts int
+
+	// Err holds the last error returned by f, or the context's
+	// error if f was never called. Permanent errors are unwrapped.
+	Err error
+}
+
+// Error implements error.
+func (e *Error) Error() string {
+	if e.Attempts == 1 {
+		return fmt.Sprintf("attempt failed: %v", e.Err)
+	}
+	return fmt.Sprintf("%d attempts failed: %v", e.Attempts, e.Err)
+}
+
+// Unwrap returns the last error returned by f.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func failed(attempts int, err error) error {
+	if e, ok := err.(*permanentError); ok {
+		err = e.err
+	}
+	return &Error{Attempts: attempts, Err: err}
+}
+
+// LastError returns the last error returned by f if err is an *Error,
+// or err otherwise.
+func LastError(err error) error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Err
+	}
+	return err
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent wraps err so that Do does not retry it. It returns nil if
+// err is nil.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err}
+}
+
+// IsPermanent reports whether err, or any error it wraps, was
+// returned by Permanent.
+func IsPermanent(err error) bool {
+	var e *permanentError
+	return errors.As(err, &e)
+}
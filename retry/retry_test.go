@@ -0,0 +1,238 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/juju/clock/testclock"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/retry"
+)
+
+type retrySuite struct {
+	testing.IsolationSuite
+	clock *testclock.Clock
+}
+
+var _ = gc.Suite(&retrySuite{})
+
+func (s *retrySuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.clock = testclock.NewClock(time.Now())
+}
+
+// failTimes returns a function that fails the first n times it is
+// called and then succeeds, counting the calls in *calls.
+func failTimes(n int, calls *int) func(context.Context) error {
+	return func(context.Context) error {
+		*calls++
+		if *calls <= n {
+			return fmt.Errorf("failure %d", *calls)
+		}
+		return nil
+	}
+}
+
+func (s *retrySuite) TestStrategies(c *gc.C) {
+	delays := func(st retry.Strategy) []time.Duration {
+		var ds []time.Duration
+		for i := 1; i <= 4; i++ {
+			ds = append(ds, st.Delay(i))
+		}
+		return ds
+	}
+	c.Check(delays(retry.Constant(time.Second)), jc.DeepEquals, []time.Duration{
+		time.Second, time.Second, time.Second, time.Second,
+	})
+	c.Check(delays(retry.Linear(time.Second, 2*time.Second)), jc.DeepEquals, []time.Duration{
+		time.Second, 3 * time.Second, 5 * time.Second, 7 * time.Second,
+	})
+	c.Check(delays(retry.Exponential(time.Second, 2, 5*time.Second)), jc.DeepEquals, []time.Duration{
+		time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second,
+	})
+	c.Check(retry.Exponential(time.Second, 10, 0).Delay(100), gc.Equals, time.Duration(1<<63-1))
+}
+
+func (s *retrySuite) TestSuccessAfterRetries(c *gc.C) {
+	var calls int
+	var retries []string
+	err := retry.Do(context.Background(), retry.Policy{
+		Attempts: 5,
+		OnRetry: func(attempt int, err error, delay time.Duration) {
+			retries = append(retries, fmt.Sprintf("%d %v %v", attempt, err, delay))
+		},
+	}, failTimes(2, &calls))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(calls, gc.Equals, 3)
+	c.Assert(retries, jc.DeepEquals, []string{"1 failure 1 0s", "2 failure 2 0s"})
+}
+
+func (s *retrySuite) TestAttemptsExhausted(c *gc.C) {
+	var calls int
+	err := retry.Do(context.Background(), retry.Policy{Attempts: 3}, failTimes(10, &calls))
+	c.Assert(err, gc.ErrorMatches, "3 attempts failed: failure 3")
+	c.Assert(calls, gc.Equals, 3)
+	var retryErr *retry.Error
+	c.Assert(errors.As(err, &retryErr), jc.IsTrue)
+	c.Assert(retryErr.Attempts, gc.Equals, 3)
+	c.Assert(retry.LastError(err), gc.ErrorMatches, "failure 3")
+}
+
+func (s *retrySuite) TestBackoffUsesClock(c *gc.C) {
+	var calls int
+	result := make(chan error, 1)
+	go func() {
+		result <- retry.Do(context.Background(), retry.Policy{
+			Attempts: 3,
+			Backoff:  retry.Exponential(time.Second, 2, 0),
+			Clock:    s.clock,
+		}, failTimes(2, &calls))
+	}()
+	for _, d := range []time.Duration{time.Second, 2 * time.Second} {
+		err := s.clock.WaitAdvance(d, testing.LongWait, 1)
+		c.Assert(err, jc.ErrorIsNil)
+	}
+	select {
+	case err := <-result:
+		c.Assert(err, jc.ErrorIsNil)
+	case <-time.After(testing.LongWait):
+		c.Fatalf("timed out waiting for result")
+	}
+	c.Assert(calls, gc.Equals, 3)
+}
+
+func (s *retrySuite) TestMaxDuration(c *gc.C) {
+	var calls int
+	result := make(chan error, 1)
+	go func() {
+		result <- retry.Do(context.Background(), retry.Policy{
+			MaxDuration: 5 * time.Second,
+			Backoff:     retry.Constant(2 * time.Second),
+			Clock:       s.clock,
+		}, failTimes(10, &calls))
+	}()
+	for i := 0; i < 2; i++ {
+		err := s.clock.WaitAdvance(2*time.Second, testing.LongWait, 1)
+		c.Assert(err, jc.ErrorIsNil)
+	}
+	select {
+	case err := <-result:
+		// A third retry would end after 6s, beyond the maximum.
+		c.Assert(err, gc.ErrorMatches, "3 attempts failed: failure 3")
+	case <-time.After(testing.LongWait):
+		c.Fatalf("timed out waiting for result")
+	}
+}
+
+func (s *retrySuite) TestRetryIf(c *gc.C) {
+	errFatal := errors.New("fatal")
+	calls := 0
+	err := retry.Do(context.Background(), retry.Policy{
+		RetryIf: func(err error) bool {
+			return !errors.Is(err, errFatal)
+		},
+	}, func(context.Context) error {
+		calls++
+		if calls == 3 {
+			return fmt.Errorf("wrapped: %w", errFatal)
+		}
+		return errors.New("transient")
+	})
+	c.Assert(err, gc.ErrorMatches, "3 attempts failed: wrapped: fatal")
+	c.Assert(errors.Is(err, errFatal), jc.IsTrue)
+}
+
+func (s *retrySuite) TestPermanent(c *gc.C) {
+	c.Assert(retry.Permanent(nil), gc.IsNil)
+	errBad := errors.New("bad")
+	calls := 0
+	err := retry.Do(context.Background(), retry.Policy{}, func(context.Context) error {
+		calls++
+		return retry.Permanent(errBad)
+	})
+	c.Assert(err, gc.ErrorMatches, "attempt failed: bad")
+	c.Assert(calls, gc.Equals, 1)
+	c.Assert(retry.LastError(err), gc.Equals, errBad)
+	c.Assert(retry.IsPermanent(fmt.Errorf("x: %w", retry.Permanent(errBad))), jc.IsTrue)
+	c.Assert(retry.IsPermanent(errBad), jc.IsFalse)
+}
+
+func (s *retrySuite) TestContextErrorsNotRetried(c *gc.C) {
+	calls := 0
+	err := retry.Do(context.Background(), retry.Policy{}, func(context.Context) error {
+		calls++
+		return fmt.Errorf("dial: %w", context.DeadlineExceeded)
+	})
+	c.Assert(err, gc.ErrorMatches, "attempt failed: dial: context deadline exceeded")
+	c.Assert(calls, gc.Equals, 1)
+}
+
+func (s *retrySuite) TestContextCancelledWhileWaiting(c *gc.C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	result := make(chan error, 1)
+	go func() {
+		result <- retry.Do(ctx, retry.Policy{
+			Backoff: retry.Constant(time.Minute),
+			Clock:   s.clock,
+		}, failTimes(10, &calls))
+	}()
+	err := s.clock.WaitAdvance(0, testing.LongWait, 1)
+	c.Assert(err, jc.ErrorIsNil)
+	cancel()
+	select {
+	case err := <-result:
+		c.Assert(err, gc.ErrorMatches, "attempt failed: failure 1")
+	case <-time.After(testing.LongWait):
+		c.Fatalf("timed out waiting for result")
+	}
+}
+
+func (s *retrySuite) TestContextDoneBeforeStart(c *gc.C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls := 0
+	err := retry.Do(ctx, retry.Policy{}, failTimes(0, &calls))
+	c.Assert(err, jc.Satisfies, func(err error) bool {
+		return errors.Is(err, context.Canceled)
+	})
+	c.Assert(calls, gc.Equals, 0)
+}
+
+func (s *retrySuite) TestDoValue(c *gc.C) {
+	calls := 0
+	v, err := retry.DoValue(context.Background(), retry.Policy{Attempts: 3}, func(context.Context) (string, error) {
+		calls++
+		if calls < 2 {
+			return "", errors.New("not yet")
+		}
+		return "done", nil
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(v, gc.Equals, "done")
+}
+
+func (s *retrySuite) TestJitter(c *gc.C) {
+	var delays []time.Duration
+	calls := 0
+	err := retry.Do(context.Background(), retry.Policy{
+		Attempts: 20,
+		Backoff:  retry.Constant(time.Nanosecond * 1000),
+		Jitter:   0.5,
+		OnRetry: func(_ int, _ error, delay time.Duration) {
+			delays = append(delays, delay)
+		},
+	}, failTimes(19, &calls))
+	c.Assert(err, jc.ErrorIsNil)
+	for _, d := range delays {
+		c.Check(d >= 500 && d <= 1500, jc.IsTrue, gc.Commentf("delay %v", d))
+	}
+}
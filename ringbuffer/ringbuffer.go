@@ -0,0 +1,167 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package ringbuffer provides a writer that keeps only the most recent
+// output written to it, so that the end of a long stream can be
+// included in an error report while the stream itself goes elsewhere:
+//
+//	tail := ringbuffer.NewLines(20, 4096)
+//	cmd.Stdout = io.MultiWriter(logFile, tail)
+//	if err := cmd.Run(); err != nil {
+//		return errors.Annotatef(err, "command failed; output ends:\n%s", tail.Snapshot())
+//	}
+package ringbuffer
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Buffer is an io.Writer that retains the last bytes written to it.
+// Its methods may be called concurrently.
+type Buffer struct {
+	maxLines int
+
+	mu   sync.Mutex
+	data []byte
+	// pos holds the index in data at which
+	// the next byte is written.
+	pos     int
+	full    bool
+	written int64
+}
+
+// New returns a Buffer that retains the last size bytes written to it.
+// It panics if size is not positive.
+func New(size int) *Buffer {
+	if size <= 0 {
+		panic(fmt.Sprintf("ringbuffer: invalid size %d", size))
+	}
+	return &Buffer{data: make([]byte, size)}
+}
+
+// NewLines returns a Buffer whose snapshots hold at most the last
+// maxLines lines written to it, up to a total of size bytes. An
+// unterminated final line counts as a line. It panics if either limit
+// is not positive.
+func NewLines(maxLines, size int) *Buffer {
+	if maxLines <= 0 {
+		panic(fmt.Sprintf("ringbuffer: invalid line limit %d", maxLines))
+	}
+	b := New(size)
+	b.maxLines = maxLines
+	return b
+}
+
+// Write implements io.Writer. It never returns an error.
+func (b *Buffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := len(p)
+	b.written += int64(n)
+	if n >= len(b.data) {
+		copy(b.data, p[n-len(b.data):])
+		b.pos = 0
+		b.full = true
+		return n, nil
+	}
+	copied := copy(b.data[b.pos:], p)
+	if copied < n {
+		copy(b.data, p[copied:])
+		b.full = true
+	}
+	b.pos += n
+	if b.pos >= len(b.data) {
+		b.pos -= len(b.data)
+		b.full = true
+	}
+	return n, nil
+}
+
+// Reset discards everything written to the buffer.
+func (b *Buffer) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pos = 0
+	b.full = false
+	b.written = 0
+}
+
+// Snapshot returns the output currently retained by the buffer.
+func (b *Buffer) Snapshot() Snapshot {
+	b.mu.Lock()
+	var data []byte
+	if b.full {
+		data = append(append(data, b.data[b.pos:]...), b.data[:b.pos]...)
+	} else {
+		data = append(data, b.data[:b.pos]...)
+	}
+	written := b.written
+	b.mu.Unlock()
+
+	if b.maxLines > 0 {
+		data = lastLines(data, b.maxLines, int64(len(data)) < written)
+	}
+	return Snapshot{Data: data, Written: written}
+}
+
+// lastLines returns the end of data holding at most n lines. If
+// partial is true, the first line in data may have lost its start,
+// so it is dropped if data holds a complete line after it.
+func lastLines(data []byte, n int, partial bool) []byte {
+	end := len(data)
+	if end > 0 && data[end-1] == '\n' {
+		// Don't count the terminator of the last line.
+		end--
+	}
+	start := 0
+	for i := 0; i < n; i++ {
+		j := bytes.LastIndexByte(data[:end], '\n')
+		if j < 0 {
+			if partial && i > 0 {
+				return data[end+1:]
+			}
+			return data
+		}
+		start = j + 1
+		end = j
+	}
+	return data[start:]
+}
+
+// Snapshot holds the output retained by a Buffer.
+type Snapshot struct {
+	// Data holds the retained output.
+	Data []byte
+
+	// Written holds the total number of bytes
+	// written to the buffer.
+	Written int64
+}
+
+// Truncated reports whether any of the output
+// written to the buffer has been discarded.
+func (s Snapshot) Truncated() bool {
+	return s.Written > int64(len(s.Data))
+}
+
+// Lines returns the retained output as lines,
+// without their terminators.
+func (s Snapshot) Lines() []string {
+	text := strings.TrimSuffix(string(s.Data), "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// String returns the retained output, preceded by a note
+// of how much output was discarded, if any.
+func (s Snapshot) String() string {
+	if !s.Truncated() {
+		return string(s.Data)
+	}
+	return fmt.Sprintf("[%d bytes omitted]\n%s", s.Written-int64(len(s.Data)), s.Data)
+}
@@ -0,0 +1,129 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package ringbuffer_test
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/ringbuffer"
+)
+
+type bufferSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&bufferSuite{})
+
+func write(c *gc.C, b *ringbuffer.Buffer, writes ...string) {
+	for _, w := range writes {
+		n, err := b.Write([]byte(w))
+		c.Assert(err, jc.ErrorIsNil)
+		c.Assert(n, gc.Equals, len(w))
+	}
+}
+
+func (*bufferSuite) TestBytes(c *gc.C) {
+	tests := []struct {
+		writes []string
+		expect string
+	}{
+		{nil, ""},
+		{[]string{"abc"}, "abc"},
+		{[]string{"abcde"}, "abcde"},
+		{[]string{"abcdefg"}, "cdefg"},
+		{[]string{"ab", "cd", "ef"}, "bcdef"},
+		{[]string{"abcd", "efgh", "ij"}, "fghij"},
+		{[]string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l"}, "hijkl"},
+		{[]string{"abc", "defghijklmnop"}, "lmnop"},
+	}
+	for i, test := range tests {
+		c.Logf("test %d: %q", i, test.writes)
+		b := ringbuffer.New(5)
+		write(c, b, test.writes...)
+		snap := b.Snapshot()
+		c.Check(string(snap.Data), gc.Equals, test.expect)
+		c.Check(snap.Written, gc.Equals, int64(len(strings.Join(test.writes, ""))))
+		c.Check(snap.Truncated(), gc.Equals, snap.Written > 5)
+	}
+}
+
+func (*bufferSuite) TestSnapshotIsCopy(c *gc.C) {
+	b := ringbuffer.New(5)
+	write(c, b, "abc")
+	snap := b.Snapshot()
+	write(c, b, "def")
+	c.Assert(string(snap.Data), gc.Equals, "abc")
+}
+
+func (*bufferSuite) TestLines(c *gc.C) {
+	tests := []struct {
+		writes []string
+		expect []string
+	}{
+		{nil, nil},
+		{[]string{"one"}, []string{"one"}},
+		{[]string{"one\ntwo\n"}, []string{"one", "two"}},
+		{[]string{"one\ntwo\nthree\nfour\n"}, []string{"two", "three", "four"}},
+		{[]string{"one\ntwo\nthree\nfo", "ur"}, []string{"two", "three", "four"}},
+		{[]string{"one\n\n\n\n"}, []string{"", "", ""}},
+		// The start of the first line is lost, so it is dropped.
+		{[]string{"a long first line\nshort\n"}, []string{"short"}},
+		// Unless it is the only line.
+		{[]string{"a very long line that is too long\n"}, []string{"ine that is too long"}},
+	}
+	for i, test := range tests {
+		c.Logf("test %d: %q", i, test.writes)
+		b := ringbuffer.NewLines(3, 21)
+		write(c, b, test.writes...)
+		c.Check(b.Snapshot().Lines(), jc.DeepEquals, test.expect)
+	}
+}
+
+func (*bufferSuite) TestString(c *gc.C) {
+	b := ringbuffer.New(6)
+	write(c, b, "hello\n")
+	c.Assert(b.Snapshot().String(), gc.Equals, "hello\n")
+	write(c, b, "world\n")
+	c.Assert(b.Snapshot().String(), gc.Equals, "[6 bytes omitted]\nworld\n")
+}
+
+func (*bufferSuite) TestReset(c *gc.C) {
+	b := ringbuffer.New(3)
+	write(c, b, "abcdef")
+	b.Reset()
+	c.Assert(b.Snapshot(), jc.DeepEquals, ringbuffer.Snapshot{Data: nil, Written: 0})
+	write(c, b, "x")
+	c.Assert(string(b.Snapshot().Data), gc.Equals, "x")
+}
+
+func (*bufferSuite) TestConcurrentWrites(c *gc.C) {
+	b := ringbuffer.NewLines(10, 1024)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				fmt.Fprintf(b, "%d-%d\n", i, j)
+			}
+		}(i)
+	}
+	wg.Wait()
+	snap := b.Snapshot()
+	c.Assert(snap.Lines(), gc.HasLen, 10)
+	for _, line := range snap.Lines() {
+		c.Check(line, gc.Matches, `\d-\d+`)
+	}
+}
+
+func (*bufferSuite) TestInvalidLimits(c *gc.C) {
+	c.Assert(func() { ringbuffer.New(0) }, gc.PanicMatches, "ringbuffer: invalid size 0")
+	c.Assert(func() { ringbuffer.NewLines(0, 10) }, gc.PanicMatches, "ringbuffer: invalid line limit 0")
+}
@@ -0,0 +1,152 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package secrets
+
+import (
+	"io"
+	"os"
+	"runtime"
+	"sync"
+
+	"github.com/juju/errors"
+)
+
+// BufferOptions holds the options for a Buffer.
+type BufferOptions struct {
+	// Lock specifies that the memory holding the buffer should be
+	// locked, so that it is not written to swap. Locking may fail,
+	// for instance when the process has reached its limit of locked
+	// memory, in which case the buffer is still usable; Buffer.Locked
+	// reports whether it succeeded.
+	Lock bool
+}
+
+// Buffer holds sensitive data, such as a private key or password,
+// in memory allocated outside the Go heap where the platform allows,
+// so that the data is not copied by the garbage collector or left in
+// memory that is reused. The memory is zeroed when the buffer is
+// closed. A buffer must be closed when it is no longer needed, as its
+// memory is not released otherwise.
+type Buffer struct {
+	mu     sync.Mutex
+	mem    []byte
+	locked bool
+	closed bool
+}
+
+// NewBuffer returns a buffer holding a copy of data. The data passed
+// is zeroed, so that only the buffer holds it.
+func NewBuffer(data []byte, options BufferOptions) (*Buffer, error) {
+	b, err := newBuffer(len(data), options)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	copy(b.mem, data)
+	Zero(data)
+	return b, nil
+}
+
+// ReadFile returns a buffer holding the contents of the named file,
+// which are read directly into the buffer.
+func ReadFile(name string, options BufferOptions) (*Buffer, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	size := info.Size()
+	if size > maxFileSize {
+		return nil, errors.Errorf("%s is too large to read into a buffer", name)
+	}
+	b, err := newBuffer(int(size), options)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	// The file may have changed size since it was examined,
+	// but a secret file that is being written is not worth
+	// reading anyway.
+	if _, err := io.ReadFull(f, b.mem); err != nil {
+		b.Close()
+		return nil, errors.Annotatef(err, "cannot read %s", name)
+	}
+	return b, nil
+}
+
+// maxFileSize holds the size of the largest
+// file that ReadFile will read.
+const maxFileSize = 1 << 20
+
+func newBuffer(size int, options BufferOptions) (*Buffer, error) {
+	mem, err := allocate(size)
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot allocate secure buffer")
+	}
+	b := &Buffer{mem: mem}
+	if options.Lock && size > 0 {
+		b.locked = lock(mem) == nil
+	}
+	// No finalizer releases the memory, as slices returned by
+	// Bytes may still refer to it after the buffer is unreachable.
+	return b, nil
+}
+
+// Bytes returns the data held in the buffer. The returned slice
+// refers to the buffer's memory, so it must not be used after the
+// buffer is closed, and should not be copied into ordinary memory.
+func (b *Buffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil
+	}
+	return b.mem
+}
+
+// Len returns the length of the data held in the buffer.
+func (b *Buffer) Len() int {
+	return len(b.Bytes())
+}
+
+// Locked reports whether the buffer's memory is locked.
+func (b *Buffer) Locked() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.locked
+}
+
+// Close zeroes the buffer and releases its memory.
+// Closing a closed buffer has no effect.
+func (b *Buffer) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	Zero(b.mem)
+	var err error
+	if b.locked {
+		err = unlock(b.mem)
+		b.locked = false
+	}
+	if err1 := release(b.mem); err == nil {
+		err = err1
+	}
+	b.mem = nil
+	return errors.Trace(err)
+}
+
+// Zero overwrites b with zeros.
+func Zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+	// Ensure that the writes are not
+	// optimised away as dead stores.
+	runtime.KeepAlive(b)
+}
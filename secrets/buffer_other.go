@@ -0,0 +1,29 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly && !windows
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly,!windows
+
+package secrets
+
+import (
+	"github.com/juju/errors"
+)
+
+// allocate returns size bytes from the Go heap, as memory
+// cannot be allocated elsewhere on this platform.
+func allocate(size int) ([]byte, error) {
+	return make([]byte, size), nil
+}
+
+func release([]byte) error {
+	return nil
+}
+
+func lock([]byte) error {
+	return errors.NotSupportedf("locking memory")
+}
+
+func unlock([]byte) error {
+	return nil
+}
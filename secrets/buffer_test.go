@@ -0,0 +1,74 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package secrets_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/secrets"
+)
+
+type bufferSuite struct{}
+
+var _ = gc.Suite(&bufferSuite{})
+
+func (*bufferSuite) TestNewBuffer(c *gc.C) {
+	data := []byte("private key")
+	b, err := secrets.NewBuffer(data, secrets.BufferOptions{})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(b.Bytes()), gc.Equals, "private key")
+	c.Assert(b.Len(), gc.Equals, 11)
+	c.Assert(b.Locked(), jc.IsFalse)
+	// The original is zeroed.
+	c.Assert(data, jc.DeepEquals, make([]byte, 11))
+
+	c.Assert(b.Close(), jc.ErrorIsNil)
+	c.Assert(b.Bytes(), gc.IsNil)
+	c.Assert(b.Len(), gc.Equals, 0)
+	// Closing again has no effect.
+	c.Assert(b.Close(), jc.ErrorIsNil)
+}
+
+func (*bufferSuite) TestNewBufferEmpty(c *gc.C) {
+	b, err := secrets.NewBuffer(nil, secrets.BufferOptions{Lock: true})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(b.Len(), gc.Equals, 0)
+	c.Assert(b.Close(), jc.ErrorIsNil)
+}
+
+func (*bufferSuite) TestLock(c *gc.C) {
+	b, err := secrets.NewBuffer([]byte("secret"), secrets.BufferOptions{Lock: true})
+	c.Assert(err, jc.ErrorIsNil)
+	// Locking may not be permitted, but the
+	// buffer is usable either way.
+	c.Logf("locked: %v", b.Locked())
+	c.Assert(string(b.Bytes()), gc.Equals, "secret")
+	c.Assert(b.Close(), jc.ErrorIsNil)
+	c.Assert(b.Locked(), jc.IsFalse)
+}
+
+func (*bufferSuite) TestReadFile(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "key")
+	err := ioutil.WriteFile(path, []byte("file secret"), 0600)
+	c.Assert(err, jc.ErrorIsNil)
+	b, err := secrets.ReadFile(path, secrets.BufferOptions{})
+	c.Assert(err, jc.ErrorIsNil)
+	defer b.Close()
+	c.Assert(string(b.Bytes()), gc.Equals, "file secret")
+}
+
+func (*bufferSuite) TestReadFileNotFound(c *gc.C) {
+	_, err := secrets.ReadFile(filepath.Join(c.MkDir(), "missing"), secrets.BufferOptions{})
+	c.Assert(err, gc.ErrorMatches, "open .*: no such file or directory")
+}
+
+func (*bufferSuite) TestZero(c *gc.C) {
+	b := []byte{1, 2, 3}
+	secrets.Zero(b)
+	c.Assert(b, jc.DeepEquals, []byte{0, 0, 0})
+}
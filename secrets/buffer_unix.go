@@ -0,0 +1,35 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package secrets
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// allocate returns size bytes of anonymous
+// memory mapped outside the Go heap.
+func allocate(size int) ([]byte, error) {
+	if size == 0 {
+		return []byte{}, nil
+	}
+	return unix.Mmap(-1, 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON|unix.MAP_PRIVATE)
+}
+
+func release(mem []byte) error {
+	if len(mem) == 0 {
+		return nil
+	}
+	return unix.Munmap(mem)
+}
+
+func lock(mem []byte) error {
+	return unix.Mlock(mem)
+}
+
+func unlock(mem []byte) error {
+	return unix.Munlock(mem)
+}
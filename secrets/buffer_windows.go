@@ -0,0 +1,40 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package secrets
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// allocate returns size bytes of memory
+// allocated outside the Go heap.
+func allocate(size int) ([]byte, error) {
+	if size == 0 {
+		return []byte{}, nil
+	}
+	addr, err := windows.VirtualAlloc(0, uintptr(size), windows.MEM_COMMIT|windows.MEM_RESERVE, windows.PAGE_READWRITE)
+	if err != nil {
+		return nil, err
+	}
+	// The memory is not managed by Go, so converting its
+	// address to a pointer is safe.
+	return unsafe.Slice(*(**byte)(unsafe.Pointer(&addr)), size), nil
+}
+
+func release(mem []byte) error {
+	if len(mem) == 0 {
+		return nil
+	}
+	return windows.VirtualFree(uintptr(unsafe.Pointer(&mem[0])), 0, windows.MEM_RELEASE)
+}
+
+func lock(mem []byte) error {
+	return windows.VirtualLock(uintptr(unsafe.Pointer(&mem[0])), uintptr(len(mem)))
+}
+
+func unlock(mem []byte) error {
+	return windows.VirtualUnlock(uintptr(unsafe.Pointer(&mem[0])), uintptr(len(mem)))
+}
@@ -0,0 +1,251 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package secrets provides functions for generating random secrets,
+// such as passwords and tokens, from a cryptographically secure source
+// of randomness, for comparing them without leaking timing
+// information, and for holding them in memory that is zeroed after
+// use.
+package secrets
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// Charset is a set of character classes that secrets may be made from.
+type Charset int
+
+const (
+	// Lower holds the lower case ASCII letters.
+	Lower Charset = 1 << iota
+
+	// Upper holds the upper case ASCII letters.
+	Upper
+
+	// Digits holds the decimal digits.
+	Digits
+
+	// Symbols holds the printable ASCII punctuation characters.
+	Symbols
+
+	// Alphanumeric holds the ASCII letters and digits.
+	Alphanumeric = Lower | Upper | Digits
+
+	// All holds all printable ASCII characters except space.
+	All = Alphanumeric | Symbols
+)
+
+var classChars = []struct {
+	class Charset
+	chars string
+}{
+	{Lower, "abcdefghijklmnopqrstuvwxyz"},
+	{Upper, "ABCDEFGHIJKLMNOPQRSTUVWXYZ"},
+	{Digits, "0123456789"},
+	{Symbols, "!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~"},
+}
+
+// Ambiguous holds the characters that are easily confused with each
+// other when read or typed, and are left out when
+// Policy.ExcludeAmbiguous is set.
+const Ambiguous = "0OoIl1|`'\""
+
+// Policy describes the secrets to generate.
+type Policy struct {
+	// Length holds the number of characters in the secret.
+	Length int
+
+	// Charset holds the character classes the secret is made from.
+	// If it is zero, Alphanumeric is used.
+	Charset Charset
+
+	// RequireEach, if true, ensures that the secret holds at least
+	// one character from each class in Charset.
+	RequireEach bool
+
+	// ExcludeAmbiguous, if true, leaves out the characters in
+	// Ambiguous.
+	ExcludeAmbiguous bool
+
+	// Exclude holds any further characters to leave out.
+	Exclude string
+
+	// MinEntropy, if non-zero, holds the minimum entropy, in bits,
+	// of secrets generated with the policy. Generate fails if the
+	// policy cannot satisfy it.
+	MinEntropy float64
+}
+
+// classes returns the characters available in each class of the
+// policy, after exclusions.
+func (p Policy) classes() []string {
+	charset := p.Charset
+	if charset == 0 {
+		charset = Alphanumeric
+	}
+	var classes []string
+	for _, c := range classChars {
+		if charset&c.class == 0 {
+			continue
+		}
+		chars := strings.Map(func(r rune) rune {
+			if p.ExcludeAmbiguous && strings.ContainsRune(Ambiguous, r) || strings.ContainsRune(p.Exclude, r) {
+				return -1
+			}
+			return r
+		}, c.chars)
+		if chars != "" {
+			classes = append(classes, chars)
+		}
+	}
+	return classes
+}
+
+// Alphabet returns the characters that secrets
+// generated with the policy are made from.
+func (p Policy) Alphabet() string {
+	return strings.Join(p.classes(), "")
+}
+
+// Entropy returns the entropy, in bits, of a secret generated with
+// the policy. When RequireEach is set the true entropy is slightly
+// lower, as secrets missing a class are never generated.
+func (p Policy) Entropy() float64 {
+	n := len(p.Alphabet())
+	if n == 0 || p.Length <= 0 {
+		return 0
+	}
+	return float64(p.Length) * math.Log2(float64(n))
+}
+
+// Validate returns an error if secrets cannot be generated with
+// the policy.
+func (p Policy) Validate() error {
+	classes := p.classes()
+	switch {
+	case p.Length <= 0:
+		return errors.NotValidf("secret length %d", p.Length)
+	case len(classes) == 0:
+		return errors.NotValidf("empty alphabet")
+	case p.RequireEach && p.Length < len(classes):
+		return errors.NotValidf("secret length %d with %d required character classes", p.Length, len(classes))
+	case p.MinEntropy > 0 && p.Entropy() < p.MinEntropy:
+		return errors.NotValidf("policy with %.1f bits of entropy (minimum %.1f)", p.Entropy(), p.MinEntropy)
+	}
+	return nil
+}
+
+// Generate returns a new random secret that satisfies the policy.
+// Each character is chosen uniformly from the policy's alphabet.
+func Generate(p Policy) (string, error) {
+	if err := p.Validate(); err != nil {
+		return "", errors.Trace(err)
+	}
+	classes := p.classes()
+	alphabet := []rune(strings.Join(classes, ""))
+	max := big.NewInt(int64(len(alphabet)))
+	secret := make([]rune, p.Length)
+	for {
+		for i := range secret {
+			n, err := rand.Int(rand.Reader, max)
+			if err != nil {
+				return "", errors.Annotate(err, "cannot generate secret")
+			}
+			secret[i] = alphabet[n.Int64()]
+		}
+		// Generating again until all classes are present keeps
+		// the choice uniform among the acceptable secrets.
+		if !p.RequireEach || hasEach(string(secret), classes) {
+			return string(secret), nil
+		}
+	}
+}
+
+func hasEach(s string, classes []string) bool {
+	for _, chars := range classes {
+		if !strings.ContainsAny(s, chars) {
+			return false
+		}
+	}
+	return true
+}
+
+// Token returns a random URL-safe token encoding n random bytes with
+// unpadded base64, suitable for use in URLs and HTTP headers.
+func Token(n int) (string, error) {
+	b, err := randomBytes(n)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HexToken returns a random token encoding n random bytes in hex.
+func HexToken(n int) (string, error) {
+	b, err := randomBytes(n)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func randomBytes(n int) ([]byte, error) {
+	if n <= 0 {
+		return nil, errors.NotValidf("token length %d", n)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return nil, errors.Annotate(err, "cannot read random bytes")
+	}
+	return b, nil
+}
+
+// EstimateEntropy returns a rough estimate of the entropy, in bits,
+// of the given secret, assuming that it was chosen uniformly from all
+// the strings of its length made of the character classes it uses.
+// This is an upper bound: it knows nothing of dictionary words or
+// patterns, so it is only useful for rejecting secrets that are
+// obviously too weak, such as short or single-class ones.
+func EstimateEntropy(secret string) float64 {
+	if secret == "" {
+		return 0
+	}
+	pool := 0
+	other := false
+	for _, c := range classChars {
+		if strings.ContainsAny(secret, c.chars) {
+			pool += len(c.chars)
+		}
+	}
+	for _, r := range secret {
+		if r > 0x7e || r < 0x21 {
+			other = true
+			break
+		}
+	}
+	if other {
+		// Allow for some set of characters outside printable ASCII.
+		pool += 100
+	}
+	return float64(len([]rune(secret))) * math.Log2(float64(pool))
+}
+
+// Equal reports whether the secrets a and b are equal, taking time
+// that depends only on their lengths, not their contents.
+func Equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// EqualBytes is like Equal, but compares byte slices.
+func EqualBytes(a, b []byte) bool {
+	return subtle.ConstantTimeCompare(a, b) == 1
+}
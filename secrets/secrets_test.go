@@ -0,0 +1,127 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package secrets_test
+
+import (
+	"math"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/secrets"
+)
+
+type secretsSuite struct{}
+
+var _ = gc.Suite(&secretsSuite{})
+
+func (*secretsSuite) TestGenerateDefault(c *gc.C) {
+	s, err := secrets.Generate(secrets.Policy{Length: 20})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(s, gc.Matches, "[a-zA-Z0-9]{20}")
+
+	other, err := secrets.Generate(secrets.Policy{Length: 20})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(other, gc.Not(gc.Equals), s)
+}
+
+func (*secretsSuite) TestGenerateCharset(c *gc.C) {
+	for i := 0; i < 20; i++ {
+		s, err := secrets.Generate(secrets.Policy{
+			Length:  8,
+			Charset: secrets.Digits | secrets.Symbols,
+		})
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(strings.IndexAny(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"), gc.Equals, -1)
+	}
+}
+
+func (*secretsSuite) TestGenerateRequireEach(c *gc.C) {
+	for i := 0; i < 50; i++ {
+		s, err := secrets.Generate(secrets.Policy{
+			Length:      4,
+			Charset:     secrets.All,
+			RequireEach: true,
+		})
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(s, gc.Matches, ".*[a-z].*")
+		c.Check(s, gc.Matches, ".*[A-Z].*")
+		c.Check(s, gc.Matches, ".*[0-9].*")
+		c.Check(s, gc.Matches, `.*[^a-zA-Z0-9].*`)
+	}
+}
+
+func (*secretsSuite) TestGenerateExclusions(c *gc.C) {
+	p := secrets.Policy{
+		Length:           100,
+		Charset:          secrets.All,
+		ExcludeAmbiguous: true,
+		Exclude:          "$\\",
+	}
+	alphabet := p.Alphabet()
+	c.Check(strings.ContainsAny(alphabet, secrets.Ambiguous+"$\\"), jc.IsFalse)
+	c.Check(alphabet, gc.HasLen, 94-len(secrets.Ambiguous)-2)
+
+	s, err := secrets.Generate(p)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(strings.ContainsAny(s, secrets.Ambiguous+"$\\"), jc.IsFalse)
+}
+
+func (*secretsSuite) TestEntropy(c *gc.C) {
+	p := secrets.Policy{Length: 10, Charset: secrets.Digits}
+	c.Check(p.Entropy(), gc.Equals, 10*math.Log2(10))
+
+	p = secrets.Policy{Length: 16, Charset: secrets.Lower | secrets.Upper}
+	c.Check(p.Entropy(), gc.Equals, 16*math.Log2(52))
+}
+
+func (*secretsSuite) TestGenerateInvalid(c *gc.C) {
+	for _, test := range []struct {
+		policy secrets.Policy
+		err    string
+	}{{
+		policy: secrets.Policy{},
+		err:    "secret length 0 not valid",
+	}, {
+		policy: secrets.Policy{Length: 4, Charset: secrets.Digits, Exclude: "0123456789"},
+		err:    "empty alphabet not valid",
+	}, {
+		policy: secrets.Policy{Length: 2, Charset: secrets.Alphanumeric, RequireEach: true},
+		err:    "secret length 2 with 3 required character classes not valid",
+	}, {
+		policy: secrets.Policy{Length: 4, Charset: secrets.Digits, MinEntropy: 64},
+		err:    `policy with 13.3 bits of entropy \(minimum 64.0\) not valid`,
+	}} {
+		_, err := secrets.Generate(test.policy)
+		c.Check(err, gc.ErrorMatches, test.err)
+	}
+}
+
+func (*secretsSuite) TestToken(c *gc.C) {
+	t, err := secrets.Token(32)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(t, gc.Matches, "[A-Za-z0-9_-]{43}")
+
+	t, err = secrets.HexToken(16)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(t, gc.Matches, "[0-9a-f]{32}")
+
+	_, err = secrets.Token(0)
+	c.Check(err, gc.ErrorMatches, "token length 0 not valid")
+}
+
+func (*secretsSuite) TestEstimateEntropy(c *gc.C) {
+	c.Check(secrets.EstimateEntropy(""), gc.Equals, 0.0)
+	c.Check(secrets.EstimateEntropy("1234"), gc.Equals, 4*math.Log2(10))
+	c.Check(secrets.EstimateEntropy("abcABC12") > secrets.EstimateEntropy("abcdefgh"), jc.IsTrue)
+}
+
+func (*secretsSuite) TestEqual(c *gc.C) {
+	c.Check(secrets.Equal("secret", "secret"), jc.IsTrue)
+	c.Check(secrets.Equal("secret", "secreT"), jc.IsFalse)
+	c.Check(secrets.Equal("secret", "secrets"), jc.IsFalse)
+	c.Check(secrets.EqualBytes([]byte("x"), []byte("x")), jc.IsTrue)
+	c.Check(secrets.EqualBytes(nil, []byte("x")), jc.IsFalse)
+}
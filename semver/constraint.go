@@ -0,0 +1,222 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package semver
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// Constraint restricts the versions accepted, as in ">=2.9 <3.0".
+type Constraint struct {
+	source string
+
+	// sets holds alternative sets of ranges. A version satisfies
+	// the constraint if it is in all the ranges of any set.
+	sets [][]versionRange
+}
+
+// ParseConstraint parses a constraint. A constraint is made of
+// comparisons separated by spaces or commas, all of which must hold;
+// alternative constraints are separated by "||". Each comparison is
+// a version, optionally preceded by an operator:
+//
+//	=, ==   the same version (the default)
+//	!=      a different version
+//	>, >=   a greater version, or a greater or equal one
+//	<, <=   a lesser version, or a lesser or equal one
+//	~       the same major and minor version, at least as great:
+//	        "~1.2.3" is ">=1.2.3 <1.3.0"
+//	^       the same leftmost non-zero number, at least as great:
+//	        "^1.2.3" is ">=1.2.3 <2.0.0" and "^0.2.3" is ">=0.2.3 <0.3.0"
+//
+// Trailing numbers may be omitted or given as wildcards, so "1.2",
+// "1.2.x" and "1.2.*" all match any 1.2 release, and "*" matches
+// any version at all. Versions are compared by precedence, so
+// pre-releases satisfy a constraint when their precedence does,
+// except that an upper bound given as a partial version, or implied
+// by a partial version, "~" or "^", excludes the pre-releases of the
+// bound: "<3.0" excludes 3.0.0-beta.1 but "<3.0.0" does not.
+func ParseConstraint(s string) (*Constraint, error) {
+	c := &Constraint{source: strings.TrimSpace(s)}
+	for _, alternative := range strings.Split(s, "||") {
+		terms := strings.FieldsFunc(alternative, func(r rune) bool {
+			return r == ' ' || r == '\t' || r == ','
+		})
+		if len(terms) == 0 {
+			return nil, invalidConstraint(s, "empty comparison")
+		}
+		var set []versionRange
+		for i := 0; i < len(terms); i++ {
+			term := terms[i]
+			// Allow a space between an operator and its version.
+			if strings.Trim(term, "=!<>~^") == "" && i+1 < len(terms) {
+				i++
+				term += terms[i]
+			}
+			r, err := parseRange(term)
+			if err != nil {
+				return nil, invalidConstraint(s, err.Error())
+			}
+			set = append(set, r)
+		}
+		c.sets = append(c.sets, set)
+	}
+	return c, nil
+}
+
+// MustParseConstraint is like ParseConstraint but panics
+// if the constraint is not valid.
+func MustParseConstraint(s string) *Constraint {
+	c, err := ParseConstraint(s)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func invalidConstraint(s, reason string) error {
+	return errors.NewNotValid(nil, fmt.Sprintf("invalid constraint %q: %s", s, reason))
+}
+
+// String returns the constraint as it was parsed.
+func (c *Constraint) String() string {
+	return c.source
+}
+
+// Check reports whether v satisfies the constraint.
+func (c *Constraint) Check(v Version) bool {
+	for _, set := range c.sets {
+		ok := true
+		for _, r := range set {
+			if !r.contains(v) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Latest returns the version of greatest precedence in versions
+// that satisfies the constraint, and whether there is one.
+func (c *Constraint) Latest(versions []Version) (Version, bool) {
+	var latest Version
+	found := false
+	for _, v := range versions {
+		if c.Check(v) && (!found || latest.LessThan(v)) {
+			latest, found = v, true
+		}
+	}
+	return latest, found
+}
+
+// versionRange holds the versions between two bounds.
+type versionRange struct {
+	// lower and upper hold the bounds of the range,
+	// if it has them.
+	lower, upper *bound
+
+	// exclude makes the range hold the versions
+	// outside the bounds instead.
+	exclude bool
+}
+
+type bound struct {
+	version   Version
+	inclusive bool
+}
+
+func (r versionRange) contains(v Version) bool {
+	in := true
+	if r.lower != nil {
+		c := v.Compare(r.lower.version)
+		in = c > 0 || c == 0 && r.lower.inclusive
+	}
+	if in && r.upper != nil {
+		c := v.Compare(r.upper.version)
+		in = c < 0 || c == 0 && r.upper.inclusive
+	}
+	return in != r.exclude
+}
+
+// parseRange parses a single comparison.
+func parseRange(term string) (versionRange, error) {
+	op := term[:len(term)-len(strings.TrimLeft(term, "=!<>~^"))]
+	p, err := parsePartial(term[len(op):])
+	if err != nil {
+		return versionRange{}, err
+	}
+	// The versions below are those at the bottom of the range
+	// matched by p, and at the bottom of the range above it.
+	// A version with the pre-release "0" precedes all the
+	// pre-releases of that version.
+	floor := &bound{version: Version{Major: p.Major, Minor: p.Minor, Patch: p.Patch}, inclusive: true}
+	var ceiling *bound
+	switch p.fields {
+	case 0:
+		floor = nil
+	case 1:
+		ceiling = &bound{version: Version{Major: p.Major + 1, PreRelease: "0"}}
+	case 2:
+		ceiling = &bound{version: Version{Major: p.Major, Minor: p.Minor + 1, PreRelease: "0"}}
+	case 3:
+		floor.version = p.Version
+		ceiling = &bound{version: p.Version, inclusive: true}
+	}
+	switch op {
+	case "", "=", "==":
+		return versionRange{lower: floor, upper: ceiling}, nil
+	case "!=":
+		return versionRange{lower: floor, upper: ceiling, exclude: true}, nil
+	case ">=":
+		return versionRange{lower: floor}, nil
+	case "<":
+		if floor == nil {
+			// Nothing is less than everything.
+			return versionRange{exclude: true}, nil
+		}
+		if p.fields < 3 {
+			floor.version.PreRelease = "0"
+		}
+		floor.inclusive = false
+		return versionRange{upper: floor}, nil
+	case ">":
+		if ceiling == nil {
+			return versionRange{exclude: true}, nil
+		}
+		ceiling.inclusive = !ceiling.inclusive
+		return versionRange{lower: ceiling}, nil
+	case "<=":
+		return versionRange{upper: ceiling}, nil
+	case "~":
+		if p.fields == 3 {
+			ceiling = &bound{version: Version{Major: p.Major, Minor: p.Minor + 1, PreRelease: "0"}}
+		}
+		return versionRange{lower: floor, upper: ceiling}, nil
+	case "^":
+		if p.fields > 0 {
+			ceiling = &bound{version: caretCeiling(p)}
+		}
+		return versionRange{lower: floor, upper: ceiling}, nil
+	}
+	return versionRange{}, errors.Errorf("unknown operator %q", op)
+}
+
+// caretCeiling returns the lowest version above the range
+// matched by "^p".
+func caretCeiling(p partial) Version {
+	switch {
+	case p.Major > 0 || p.fields == 1:
+		return Version{Major: p.Major + 1, PreRelease: "0"}
+	case p.Minor > 0 || p.fields == 2:
+		return Version{Minor: p.Minor + 1, PreRelease: "0"}
+	}
+	return Version{Patch: p.Patch + 1, PreRelease: "0"}
+}
@@ -0,0 +1,174 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package semver_test
+
+import (
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/semver"
+)
+
+type ConstraintSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&ConstraintSuite{})
+
+var constraintTests = []struct {
+	constraint string
+	match      []string
+	noMatch    []string
+}{{
+	constraint: ">=2.9 <3.0",
+	match:      []string{"2.9.0", "2.9.37", "2.10.0"},
+	noMatch:    []string{"2.8.9", "2.9.0-rc.1", "3.0.0-beta.1", "3.0.0"},
+}, {
+	constraint: ">= 2.9.0, < 3.0.0",
+	match:      []string{"2.9.0", "3.0.0-beta.1"},
+	noMatch:    []string{"3.0.0"},
+}, {
+	constraint: "1.2.3",
+	match:      []string{"1.2.3", "1.2.3+build"},
+	noMatch:    []string{"1.2.4", "1.2.3-rc.1"},
+}, {
+	constraint: "=1.2",
+	match:      []string{"1.2.0", "1.2.99"},
+	noMatch:    []string{"1.1.9", "1.3.0-alpha", "1.3.0", "1.2.0-rc.1"},
+}, {
+	constraint: "1.x",
+	match:      []string{"1.0.0", "1.99.0"},
+	noMatch:    []string{"0.9.0", "2.0.0"},
+}, {
+	constraint: "*",
+	match:      []string{"0.0.0", "99.0.0-rc.1"},
+}, {
+	constraint: "!=1.2",
+	match:      []string{"1.1.0", "1.3.0"},
+	noMatch:    []string{"1.2.0", "1.2.5"},
+}, {
+	constraint: ">1.2.3",
+	match:      []string{"1.2.4", "1.2.4-rc.1"},
+	noMatch:    []string{"1.2.3", "1.2.3-rc.1"},
+}, {
+	constraint: ">1.2",
+	match:      []string{"1.3.0", "1.3.0-alpha"},
+	noMatch:    []string{"1.2.9"},
+}, {
+	constraint: "<=1.2",
+	match:      []string{"1.2.9", "1.0.0"},
+	noMatch:    []string{"1.3.0-alpha", "1.3.0"},
+}, {
+	constraint: "<=1.2.3",
+	match:      []string{"1.2.3", "1.2.3+build"},
+	noMatch:    []string{"1.2.4"},
+}, {
+	constraint: "~1.2",
+	match:      []string{"1.2.0", "1.2.9"},
+	noMatch:    []string{"1.1.0", "1.3.0"},
+}, {
+	constraint: "~1.2.3",
+	match:      []string{"1.2.3", "1.2.9"},
+	noMatch:    []string{"1.2.2", "1.3.0-rc.1", "1.3.0"},
+}, {
+	constraint: "~1",
+	match:      []string{"1.0.0", "1.9.9"},
+	noMatch:    []string{"2.0.0"},
+}, {
+	constraint: "^1.2.3",
+	match:      []string{"1.2.3", "1.9.0"},
+	noMatch:    []string{"1.2.2", "2.0.0-rc.1", "2.0.0"},
+}, {
+	constraint: "^0.2.3",
+	match:      []string{"0.2.3", "0.2.9"},
+	noMatch:    []string{"0.3.0"},
+}, {
+	constraint: "^0.0.3",
+	match:      []string{"0.0.3"},
+	noMatch:    []string{"0.0.4"},
+}, {
+	constraint: "^0",
+	match:      []string{"0.0.0", "0.9.9"},
+	noMatch:    []string{"1.0.0"},
+}, {
+	constraint: "^0.0",
+	match:      []string{"0.0.9"},
+	noMatch:    []string{"0.1.0"},
+}, {
+	constraint: "^1.2.3-beta.2",
+	match:      []string{"1.2.3-beta.2", "1.2.3-beta.10", "1.2.3", "1.5.0"},
+	noMatch:    []string{"1.2.3-beta.1", "2.0.0"},
+}, {
+	constraint: "<1.0 || >=2.0 <2.1",
+	match:      []string{"0.9.0", "2.0.5"},
+	noMatch:    []string{"1.0.0", "2.1.0"},
+}, {
+	constraint: "<*",
+	noMatch:    []string{"0.0.0", "1.0.0"},
+}}
+
+func (*ConstraintSuite) TestCheck(c *gc.C) {
+	for i, test := range constraintTests {
+		c.Logf("test %d: %q", i, test.constraint)
+		constraint, err := semver.ParseConstraint(test.constraint)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(constraint.String(), gc.Equals, test.constraint)
+		for _, v := range test.match {
+			c.Check(constraint.Check(semver.MustParse(v)), jc.IsTrue, gc.Commentf("%s", v))
+		}
+		for _, v := range test.noMatch {
+			c.Check(constraint.Check(semver.MustParse(v)), jc.IsFalse, gc.Commentf("%s", v))
+		}
+	}
+}
+
+var invalidConstraintTests = []struct {
+	constraint string
+	err        string
+}{{
+	constraint: "",
+	err:        `invalid constraint "": empty comparison`,
+}, {
+	constraint: "1.2 ||",
+	err:        `invalid constraint "1.2 \|\|": empty comparison`,
+}, {
+	constraint: ">=",
+	err:        `invalid constraint ">=": invalid version "": invalid number ""`,
+}, {
+	constraint: "=>1.2",
+	err:        `invalid constraint "=>1.2": unknown operator "=>"`,
+}, {
+	constraint: "~1.2-beta",
+	err:        `invalid constraint "~1.2-beta": invalid version "1.2-beta": suffix on partial version`,
+}, {
+	constraint: "1.x.2",
+	err:        `invalid constraint "1.x.2": invalid version "1.x.2": number after wildcard`,
+}}
+
+func (*ConstraintSuite) TestParseInvalid(c *gc.C) {
+	for i, test := range invalidConstraintTests {
+		c.Logf("test %d: %q", i, test.constraint)
+		_, err := semver.ParseConstraint(test.constraint)
+		c.Check(err, gc.ErrorMatches, test.err)
+		c.Check(err, jc.Satisfies, errors.IsNotValid)
+	}
+	c.Check(func() { semver.MustParseConstraint("~") }, gc.PanicMatches, `invalid constraint "~": .*`)
+}
+
+func (*ConstraintSuite) TestLatest(c *gc.C) {
+	versions := []semver.Version{
+		semver.MustParse("2.9.1"),
+		semver.MustParse("3.0.0"),
+		semver.MustParse("2.9.10"),
+		semver.MustParse("2.9.2"),
+	}
+	latest, ok := semver.MustParseConstraint("~2.9").Latest(versions)
+	c.Assert(ok, jc.IsTrue)
+	c.Check(latest.String(), gc.Equals, "2.9.10")
+
+	_, ok = semver.MustParseConstraint(">=4").Latest(versions)
+	c.Check(ok, jc.IsFalse)
+}
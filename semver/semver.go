@@ -0,0 +1,261 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package semver parses, compares and sorts semantic versions, as
+// specified at https://semver.org/spec/v2.0.0.html, and checks them
+// against constraints such as ">=2.9 <3.0" or "~1.2".
+package semver
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// Version holds a semantic version.
+type Version struct {
+	Major, Minor, Patch int
+
+	// PreRelease holds the dot-separated pre-release identifiers,
+	// without the leading "-", as in "rc.1". It is empty for a
+	// release.
+	PreRelease string
+
+	// Build holds the dot-separated build metadata, without the
+	// leading "+". It is ignored when versions are compared.
+	Build string
+}
+
+// Parse parses a version of the form MAJOR.MINOR.PATCH, optionally
+// followed by a pre-release suffix, as in "-rc.1", and build
+// metadata, as in "+20220301". A leading "v" is allowed.
+func Parse(s string) (Version, error) {
+	p, err := parsePartial(s)
+	if err != nil {
+		return Version{}, err
+	}
+	if p.fields < 3 {
+		return Version{}, invalidVersion(s, "expected major.minor.patch")
+	}
+	return p.Version, nil
+}
+
+// MustParse is like Parse but panics if the version is not valid.
+func MustParse(s string) Version {
+	v, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func invalidVersion(s, reason string) error {
+	return errors.NewNotValid(nil, fmt.Sprintf("invalid version %q: %s", s, reason))
+}
+
+// String returns the version in its canonical form, without
+// a leading "v".
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.PreRelease != "" {
+		s += "-" + v.PreRelease
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 according to whether v has lower, the
+// same or higher precedence than other. A pre-release has lower
+// precedence than the release it precedes, and build metadata
+// is ignored.
+func (v Version) Compare(other Version) int {
+	if r := compareInts(v.Major, other.Major); r != 0 {
+		return r
+	}
+	if r := compareInts(v.Minor, other.Minor); r != 0 {
+		return r
+	}
+	if r := compareInts(v.Patch, other.Patch); r != 0 {
+		return r
+	}
+	switch {
+	case v.PreRelease == other.PreRelease:
+		return 0
+	case v.PreRelease == "":
+		return 1
+	case other.PreRelease == "":
+		return -1
+	}
+	a, b := strings.Split(v.PreRelease, "."), strings.Split(other.PreRelease, ".")
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if r := compareIdentifiers(a[i], b[i]); r != 0 {
+			return r
+		}
+	}
+	return compareInts(len(a), len(b))
+}
+
+// LessThan reports whether v has lower precedence than other.
+func (v Version) LessThan(other Version) bool {
+	return v.Compare(other) < 0
+}
+
+// IsPreRelease reports whether v is a pre-release.
+func (v Version) IsPreRelease() bool {
+	return v.PreRelease != ""
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v Version) MarshalText() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *Version) UnmarshalText(data []byte) error {
+	parsed, err := Parse(string(data))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	*v = parsed
+	return nil
+}
+
+// Sort sorts versions in ascending order of precedence. Versions
+// of equal precedence keep their original order.
+func Sort(versions []Version) {
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].LessThan(versions[j])
+	})
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareIdentifiers compares pre-release identifiers. Numeric
+// identifiers are compared by value and have lower precedence than
+// the others, which are compared in ASCII order.
+func compareIdentifiers(a, b string) int {
+	aNumeric, bNumeric := isNumeric(a), isNumeric(b)
+	switch {
+	case aNumeric && bNumeric:
+		// Numeric identifiers have no leading zeros, so
+		// the longer one is the larger. Comparing the lengths
+		// first avoids overflow.
+		if r := compareInts(len(a), len(b)); r != 0 {
+			return r
+		}
+	case aNumeric:
+		return -1
+	case bNumeric:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func isNumeric(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// partial holds a version in which trailing numbers may be missing
+// or wildcards, as used in constraints.
+type partial struct {
+	Version
+
+	// fields holds the number of numeric fields given.
+	fields int
+}
+
+// parsePartial parses a version, allowing the minor and patch
+// numbers to be omitted or given as wildcards ("x", "X" or "*"). A
+// partial version cannot have a pre-release suffix or build
+// metadata.
+func parsePartial(s string) (partial, error) {
+	rest := strings.TrimPrefix(s, "v")
+	var p partial
+	if i := strings.IndexByte(rest, '+'); i >= 0 {
+		p.Build = rest[i+1:]
+		if err := checkIdentifiers(p.Build, false); err != nil {
+			return partial{}, invalidVersion(s, "build metadata "+err.Error())
+		}
+		rest = rest[:i]
+	}
+	if i := strings.IndexByte(rest, '-'); i >= 0 {
+		p.PreRelease = rest[i+1:]
+		if err := checkIdentifiers(p.PreRelease, true); err != nil {
+			return partial{}, invalidVersion(s, "pre-release "+err.Error())
+		}
+		rest = rest[:i]
+	}
+	fields := strings.Split(rest, ".")
+	if len(fields) > 3 {
+		return partial{}, invalidVersion(s, "too many numbers")
+	}
+	numbers := []*int{&p.Major, &p.Minor, &p.Patch}
+	for i, field := range fields {
+		if isWildcard(field) {
+			// Anything after a wildcard must
+			// also be a wildcard.
+			for _, field := range fields[i+1:] {
+				if !isWildcard(field) {
+					return partial{}, invalidVersion(s, "number after wildcard")
+				}
+			}
+			break
+		}
+		if !isNumeric(field) || len(field) > 1 && field[0] == '0' {
+			return partial{}, invalidVersion(s, fmt.Sprintf("invalid number %q", field))
+		}
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			return partial{}, invalidVersion(s, fmt.Sprintf("invalid number %q", field))
+		}
+		*numbers[i] = n
+		p.fields++
+	}
+	if p.fields < 3 && (p.PreRelease != "" || p.Build != "") {
+		return partial{}, invalidVersion(s, "suffix on partial version")
+	}
+	return p, nil
+}
+
+func isWildcard(s string) bool {
+	return s == "x" || s == "X" || s == "*"
+}
+
+// checkIdentifiers checks dot-separated pre-release identifiers or
+// build metadata. Numeric pre-release identifiers may not have
+// leading zeros.
+func checkIdentifiers(s string, preRelease bool) error {
+	for _, id := range strings.Split(s, ".") {
+		if id == "" {
+			return errors.New("has empty identifier")
+		}
+		for i := 0; i < len(id); i++ {
+			c := id[i]
+			if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '-') {
+				return errors.Errorf("has invalid character %q", c)
+			}
+		}
+		if preRelease && isNumeric(id) && len(id) > 1 && id[0] == '0' {
+			return errors.Errorf("has leading zero in %q", id)
+		}
+	}
+	return nil
+}
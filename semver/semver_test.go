@@ -0,0 +1,167 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package semver_test
+
+import (
+	"encoding/json"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/semver"
+)
+
+type VersionSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&VersionSuite{})
+
+var parseTests = []struct {
+	s      string
+	expect semver.Version
+	str    string
+	err    string
+}{{
+	s:      "1.2.3",
+	expect: semver.Version{Major: 1, Minor: 2, Patch: 3},
+}, {
+	s:      "v0.0.0",
+	expect: semver.Version{},
+	str:    "0.0.0",
+}, {
+	s:      "2.9.0-rc.1+build.20220301",
+	expect: semver.Version{Major: 2, Minor: 9, PreRelease: "rc.1", Build: "build.20220301"},
+}, {
+	s:      "1.0.0-alpha-1.0",
+	expect: semver.Version{Major: 1, PreRelease: "alpha-1.0"},
+}, {
+	s:      "1.0.0+001",
+	expect: semver.Version{Major: 1, Build: "001"},
+}, {
+	s:   "1.2",
+	err: `invalid version "1.2": expected major.minor.patch`,
+}, {
+	s:   "1.2.x",
+	err: `invalid version "1.2.x": expected major.minor.patch`,
+}, {
+	s:   "1.2.3.4",
+	err: `invalid version "1.2.3.4": too many numbers`,
+}, {
+	s:   "01.2.3",
+	err: `invalid version "01.2.3": invalid number "01"`,
+}, {
+	s:   "1.a.3",
+	err: `invalid version "1.a.3": invalid number "a"`,
+}, {
+	s:   "1.2.3-",
+	err: `invalid version "1.2.3-": pre-release has empty identifier`,
+}, {
+	s:   "1.2.3-rc.01",
+	err: `invalid version "1.2.3-rc.01": pre-release has leading zero in "01"`,
+}, {
+	s:   "1.2.3+build_1",
+	err: `invalid version "1.2.3\+build_1": build metadata has invalid character '_'`,
+}, {
+	s:   "",
+	err: `invalid version "": invalid number ""`,
+}}
+
+func (*VersionSuite) TestParse(c *gc.C) {
+	for i, test := range parseTests {
+		c.Logf("test %d: %q", i, test.s)
+		v, err := semver.Parse(test.s)
+		if test.err != "" {
+			c.Check(err, gc.ErrorMatches, test.err)
+			c.Check(err, jc.Satisfies, errors.IsNotValid)
+			continue
+		}
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(v, jc.DeepEquals, test.expect)
+		str := test.str
+		if str == "" {
+			str = test.s
+		}
+		c.Check(v.String(), gc.Equals, str)
+	}
+}
+
+func (*VersionSuite) TestMustParse(c *gc.C) {
+	c.Check(semver.MustParse("1.2.3"), gc.Equals, semver.Version{Major: 1, Minor: 2, Patch: 3})
+	c.Check(func() { semver.MustParse("1") }, gc.PanicMatches, `invalid version "1": .*`)
+}
+
+func (*VersionSuite) TestCompare(c *gc.C) {
+	// The precedence example from the specification.
+	ordered := []string{
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0",
+		"1.9.0",
+		"1.10.0",
+		"1.10.1",
+		"2.0.0",
+		"10.0.0",
+	}
+	for i, a := range ordered {
+		for j, b := range ordered {
+			expect := 0
+			if i < j {
+				expect = -1
+			} else if i > j {
+				expect = 1
+			}
+			va, vb := semver.MustParse(a), semver.MustParse(b)
+			c.Check(va.Compare(vb), gc.Equals, expect, gc.Commentf("%s vs %s", a, b))
+			c.Check(va.LessThan(vb), gc.Equals, expect < 0)
+		}
+	}
+	c.Check(semver.MustParse("1.0.0+a").Compare(semver.MustParse("1.0.0+b")), gc.Equals, 0)
+	c.Check(semver.MustParse("1.0.0-1000000000000000000000").Compare(semver.MustParse("1.0.0-999")), gc.Equals, 1)
+}
+
+func (*VersionSuite) TestIsPreRelease(c *gc.C) {
+	c.Check(semver.MustParse("1.0.0-rc.1").IsPreRelease(), jc.IsTrue)
+	c.Check(semver.MustParse("1.0.0+build").IsPreRelease(), jc.IsFalse)
+}
+
+func (*VersionSuite) TestSort(c *gc.C) {
+	versions := []semver.Version{
+		semver.MustParse("2.9.10"),
+		semver.MustParse("2.9.2"),
+		semver.MustParse("3.0.0-beta.1"),
+		semver.MustParse("2.9.2+b"),
+		semver.MustParse("3.0.0"),
+		semver.MustParse("2.9.2+a"),
+	}
+	semver.Sort(versions)
+	var strs []string
+	for _, v := range versions {
+		strs = append(strs, v.String())
+	}
+	c.Check(strs, jc.DeepEquals, []string{
+		"2.9.2", "2.9.2+b", "2.9.2+a", "2.9.10", "3.0.0-beta.1", "3.0.0",
+	})
+}
+
+func (*VersionSuite) TestJSON(c *gc.C) {
+	data, err := json.Marshal(map[string]semver.Version{"v": semver.MustParse("1.2.3-rc.1")})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(data), gc.Equals, `{"v":"1.2.3-rc.1"}`)
+
+	var out map[string]semver.Version
+	err = json.Unmarshal(data, &out)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(out["v"], gc.Equals, semver.MustParse("1.2.3-rc.1"))
+
+	err = json.Unmarshal([]byte(`{"v":"1.2"}`), &out)
+	c.Check(err, gc.ErrorMatches, `invalid version "1.2": expected major.minor.patch`)
+}
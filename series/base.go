@@ -0,0 +1,124 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package series detects the operating system of the host and maps it
+// to a normalised representation, both as a base (an OS name and a
+// channel, such as "ubuntu@22.04") and as a series name (such as
+// "jammy"), as the arch package does for machine architectures.
+package series
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The following constants define the operating system
+// names used in bases.
+const (
+	Ubuntu  = "ubuntu"
+	CentOS  = "centos"
+	Windows = "windows"
+	MacOS   = "macos"
+)
+
+// Base holds an operating system and a channel identifying
+// a release of that operating system, such as its version.
+type Base struct {
+	OS      string
+	Channel string
+}
+
+// ParseBase parses a base of the form "os@channel".
+func ParseBase(s string) (Base, error) {
+	parts := strings.Split(s, "@")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return Base{}, fmt.Errorf("invalid base %q: expected os@channel", s)
+	}
+	return Base{
+		OS:      strings.ToLower(parts[0]),
+		Channel: strings.ToLower(parts[1]),
+	}, nil
+}
+
+// String implements fmt.Stringer.
+func (b Base) String() string {
+	return b.OS + "@" + b.Channel
+}
+
+// IsLTS reports whether b is a long term support release
+// of Ubuntu: that is, an April release in an even year.
+func (b Base) IsLTS() bool {
+	if b.OS != Ubuntu {
+		return false
+	}
+	v, err := parseChannel(b.Channel)
+	if err != nil || len(v) < 2 {
+		return false
+	}
+	return v[0]%2 == 0 && v[1] == 4
+}
+
+// Compare returns -1, 0 or 1 according to whether b is an older,
+// the same or a newer release than other. Channels are compared as
+// dot-separated numbers, so "9" is older than "10". It returns an
+// error if the two bases are for different operating systems or
+// either channel is not numeric.
+func (b Base) Compare(other Base) (int, error) {
+	if b.OS != other.OS {
+		return 0, fmt.Errorf("cannot compare %s with %s: different operating systems", b, other)
+	}
+	v0, err := parseChannel(b.Channel)
+	if err != nil {
+		return 0, err
+	}
+	v1, err := parseChannel(other.Channel)
+	if err != nil {
+		return 0, err
+	}
+	for i := 0; i < len(v0) || i < len(v1); i++ {
+		var n0, n1 int
+		if i < len(v0) {
+			n0 = v0[i]
+		}
+		if i < len(v1) {
+			n1 = v1[i]
+		}
+		switch {
+		case n0 < n1:
+			return -1, nil
+		case n0 > n1:
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+// NewerThan reports whether b is a newer release than other. It
+// returns false if the bases cannot be compared.
+func (b Base) NewerThan(other Base) bool {
+	n, err := b.Compare(other)
+	return err == nil && n > 0
+}
+
+// parseChannel parses a channel as dot-separated numbers. Any risk
+// suffix, as in "22.04/stable", and any letters following the last
+// number, as in "2012r2", are ignored.
+func parseChannel(channel string) ([]int, error) {
+	track := strings.SplitN(channel, "/", 2)[0]
+	var v []int
+	for _, part := range strings.Split(track, ".") {
+		digits := strings.IndexFunc(part, func(r rune) bool {
+			return r < '0' || r > '9'
+		})
+		if digits == -1 {
+			digits = len(part)
+		}
+		n, err := strconv.Atoi(part[:digits])
+		if err != nil {
+			return nil, fmt.Errorf("invalid channel %q", channel)
+		}
+		v = append(v, n)
+	}
+	return v, nil
+}
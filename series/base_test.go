@@ -0,0 +1,76 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package series_test
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/series"
+)
+
+type baseSuite struct{}
+
+var _ = gc.Suite(&baseSuite{})
+
+func (*baseSuite) TestParseBase(c *gc.C) {
+	b, err := series.ParseBase("Ubuntu@22.04")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(b, gc.Equals, series.Base{OS: "ubuntu", Channel: "22.04"})
+	c.Assert(b.String(), gc.Equals, "ubuntu@22.04")
+
+	for _, s := range []string{"", "ubuntu", "@22.04", "ubuntu@", "a@b@c"} {
+		_, err := series.ParseBase(s)
+		c.Check(err, gc.ErrorMatches, `invalid base ".*": expected os@channel`)
+	}
+}
+
+func (*baseSuite) TestCompare(c *gc.C) {
+	tests := []struct {
+		a, b   string
+		expect int
+	}{
+		{"ubuntu@22.04", "ubuntu@20.04", 1},
+		{"ubuntu@20.04", "ubuntu@20.10", -1},
+		{"ubuntu@22.04", "ubuntu@22.04/stable", 0},
+		{"centos@9", "centos@10", -1},
+		{"windows@2012r2", "windows@2016", -1},
+		{"macos@12.1", "macos@12", 1},
+	}
+	for i, test := range tests {
+		c.Logf("test %d: %s vs %s", i, test.a, test.b)
+		a, err := series.ParseBase(test.a)
+		c.Assert(err, jc.ErrorIsNil)
+		b, err := series.ParseBase(test.b)
+		c.Assert(err, jc.ErrorIsNil)
+		n, err := a.Compare(b)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(n, gc.Equals, test.expect)
+		c.Check(a.NewerThan(b), gc.Equals, test.expect > 0)
+	}
+}
+
+func (*baseSuite) TestCompareErrors(c *gc.C) {
+	ubuntu := series.Base{OS: "ubuntu", Channel: "22.04"}
+	_, err := ubuntu.Compare(series.Base{OS: "centos", Channel: "9"})
+	c.Assert(err, gc.ErrorMatches, "cannot compare ubuntu@22.04 with centos@9: different operating systems")
+	c.Assert(ubuntu.NewerThan(series.Base{OS: "centos", Channel: "9"}), jc.IsFalse)
+
+	_, err = ubuntu.Compare(series.Base{OS: "ubuntu", Channel: "latest"})
+	c.Assert(err, gc.ErrorMatches, `invalid channel "latest"`)
+}
+
+func (*baseSuite) TestIsLTS(c *gc.C) {
+	for s, lts := range map[string]bool{
+		"ubuntu@22.04":        true,
+		"ubuntu@20.04/stable": true,
+		"ubuntu@21.04":        false,
+		"ubuntu@22.10":        false,
+		"centos@8":            false,
+	} {
+		b, err := series.ParseBase(s)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(b.IsLTS(), gc.Equals, lts, gc.Commentf("%s", s))
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package series
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Release describes a release of an operating system, using the
+// fields of the os-release file (see os-release(5)).
+type Release struct {
+	// ID holds the lower-case name of the operating system,
+	// such as "ubuntu", "centos", "windows" or "macos".
+	ID string
+
+	// IDLike holds the IDs of operating systems this one
+	// is derived from or similar to, if any.
+	IDLike []string
+
+	// VersionID holds the version of the release, such as "22.04".
+	// For Windows it holds the channel of the release, such
+	// as "2019" or "10".
+	VersionID string
+
+	// Codename holds the code name of the release,
+	// such as "jammy", if it has one.
+	Codename string
+
+	// PrettyName holds a human-readable description
+	// of the release.
+	PrettyName string
+}
+
+// Base returns the base of the release.
+func (r Release) Base() Base {
+	return Base{
+		OS:      r.ID,
+		Channel: r.VersionID,
+	}
+}
+
+// Series returns the series of the release. If the base of the
+// release is not recognised, the codename is returned if there is
+// one; otherwise an error is returned.
+func (r Release) Series() (string, error) {
+	series, err := SeriesForBase(r.Base())
+	if err == nil {
+		return series, nil
+	}
+	if r.Codename != "" {
+		return r.Codename, nil
+	}
+	return "", err
+}
+
+// ParseOSRelease parses the contents of an os-release file.
+// Values may be quoted with single or double quotes, and
+// backslash escapes within double quotes are interpreted.
+func ParseOSRelease(r io.Reader) (Release, error) {
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.Index(line, "=")
+		if i < 1 {
+			return Release{}, fmt.Errorf("line %d: expected KEY=value", lineNum)
+		}
+		value, err := unquote(line[i+1:])
+		if err != nil {
+			return Release{}, fmt.Errorf("line %d: %v", lineNum, err)
+		}
+		values[line[:i]] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return Release{}, err
+	}
+	id := values["ID"]
+	if id == "" {
+		// os-release(5) specifies this default.
+		id = "linux"
+	}
+	release := Release{
+		ID:         strings.ToLower(id),
+		IDLike:     strings.Fields(values["ID_LIKE"]),
+		VersionID:  values["VERSION_ID"],
+		Codename:   values["VERSION_CODENAME"],
+		PrettyName: values["PRETTY_NAME"],
+	}
+	if release.Codename == "" {
+		// Older Ubuntu releases only set this.
+		release.Codename = values["UBUNTU_CODENAME"]
+	}
+	return release, nil
+}
+
+func unquote(s string) (string, error) {
+	if len(s) < 2 {
+		return s, nil
+	}
+	switch s[0] {
+	case '"':
+		if s[len(s)-1] != '"' {
+			return "", fmt.Errorf("unterminated quoted value %s", s)
+		}
+		var b strings.Builder
+		for i := 1; i < len(s)-1; i++ {
+			if s[i] == '\\' && i+1 < len(s)-1 {
+				i++
+			}
+			b.WriteByte(s[i])
+		}
+		return b.String(), nil
+	case '\'':
+		if s[len(s)-1] != '\'' {
+			return "", fmt.Errorf("unterminated quoted value %s", s)
+		}
+		return s[1 : len(s)-1], nil
+	}
+	return s, nil
+}
+
+// HostRelease returns the release of the operating system
+// on which it is run.
+func HostRelease() (Release, error) {
+	return hostRelease()
+}
+
+// HostBase returns the base of the operating
+// system on which it is run.
+func HostBase() (Base, error) {
+	r, err := HostRelease()
+	if err != nil {
+		return Base{}, err
+	}
+	return r.Base(), nil
+}
+
+// HostSeries returns the series of the operating
+// system on which it is run.
+func HostSeries() (string, error) {
+	r, err := HostRelease()
+	if err != nil {
+		return "", err
+	}
+	return r.Series()
+}
+
+// windowsRelease returns the release described by the given product
+// name and build number, as held in the Windows registry.
+func windowsRelease(productName string, build int) Release {
+	r := Release{
+		ID:         Windows,
+		PrettyName: productName,
+	}
+	fields := strings.Fields(strings.ToLower(productName))
+	for i, f := range fields {
+		if _, err := strconv.Atoi(f); err != nil {
+			continue
+		}
+		r.VersionID = f
+		if i+1 < len(fields) && fields[i+1] == "r2" {
+			r.VersionID += "r2"
+		}
+		break
+	}
+	// Windows 11 still calls itself Windows 10 in the
+	// registry, but is distinguished by its build number.
+	if r.VersionID == "10" && build >= 22000 {
+		r.VersionID = "11"
+		r.PrettyName = strings.Replace(productName, "Windows 10", "Windows 11", 1)
+	}
+	return r
+}
@@ -0,0 +1,23 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package series
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+func hostRelease() (Release, error) {
+	out, err := exec.Command("sw_vers", "-productVersion").Output()
+	if err != nil {
+		return Release{}, fmt.Errorf("cannot get macOS version: %v", err)
+	}
+	version := strings.TrimSpace(string(out))
+	return Release{
+		ID:         MacOS,
+		VersionID:  version,
+		PrettyName: "macOS " + version,
+	}, nil
+}
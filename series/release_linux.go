@@ -0,0 +1,32 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package series
+
+import (
+	"fmt"
+	"os"
+)
+
+// osReleaseFiles holds the locations of the os-release
+// file, in order of preference.
+var osReleaseFiles = []string{"/etc/os-release", "/usr/lib/os-release"}
+
+func hostRelease() (Release, error) {
+	for _, name := range osReleaseFiles {
+		f, err := os.Open(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return Release{}, err
+		}
+		defer f.Close()
+		r, err := ParseOSRelease(f)
+		if err != nil {
+			return Release{}, fmt.Errorf("cannot parse %s: %v", name, err)
+		}
+		return r, nil
+	}
+	return Release{}, fmt.Errorf("cannot find os-release file")
+}
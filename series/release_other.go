@@ -0,0 +1,16 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+//go:build !linux && !darwin && !windows
+// +build !linux,!darwin,!windows
+
+package series
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func hostRelease() (Release, error) {
+	return Release{}, fmt.Errorf("release detection not supported on %s", runtime.GOOS)
+}
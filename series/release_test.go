@@ -0,0 +1,119 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package series_test
+
+import (
+	"runtime"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/series"
+)
+
+type releaseSuite struct{}
+
+var _ = gc.Suite(&releaseSuite{})
+
+const ubuntuOSRelease = `
+PRETTY_NAME="Ubuntu 22.04.1 LTS"
+NAME="Ubuntu"
+VERSION_ID="22.04"
+VERSION="22.04.1 LTS (Jammy Jellyfish)"
+VERSION_CODENAME=jammy
+ID=ubuntu
+ID_LIKE=debian
+# A comment.
+HOME_URL="https://www.ubuntu.com/"
+UBUNTU_CODENAME=jammy
+`
+
+func (*releaseSuite) TestParseOSRelease(c *gc.C) {
+	r, err := series.ParseOSRelease(strings.NewReader(ubuntuOSRelease))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(r, jc.DeepEquals, series.Release{
+		ID:         "ubuntu",
+		IDLike:     []string{"debian"},
+		VersionID:  "22.04",
+		Codename:   "jammy",
+		PrettyName: "Ubuntu 22.04.1 LTS",
+	})
+	c.Assert(r.Base(), gc.Equals, series.Base{OS: "ubuntu", Channel: "22.04"})
+	s, err := r.Series()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s, gc.Equals, "jammy")
+}
+
+func (*releaseSuite) TestParseOSReleaseQuoting(c *gc.C) {
+	r, err := series.ParseOSRelease(strings.NewReader(`
+ID='centos'
+ID_LIKE="rhel fedora"
+VERSION_ID="7"
+PRETTY_NAME="CentOS \"Linux\" 7"
+`))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(r.ID, gc.Equals, "centos")
+	c.Assert(r.IDLike, jc.DeepEquals, []string{"rhel", "fedora"})
+	c.Assert(r.PrettyName, gc.Equals, `CentOS "Linux" 7`)
+	s, err := r.Series()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s, gc.Equals, "centos7")
+}
+
+func (*releaseSuite) TestParseOSReleaseErrors(c *gc.C) {
+	_, err := series.ParseOSRelease(strings.NewReader("ID=ubuntu\nnonsense\n"))
+	c.Assert(err, gc.ErrorMatches, "line 2: expected KEY=value")
+	_, err = series.ParseOSRelease(strings.NewReader(`NAME="Ubuntu`))
+	c.Assert(err, gc.ErrorMatches, `line 1: unterminated quoted value "Ubuntu`)
+}
+
+func (*releaseSuite) TestUnknownSeries(c *gc.C) {
+	r, err := series.ParseOSRelease(strings.NewReader("ID=debian\nVERSION_ID=12\nVERSION_CODENAME=bookworm\n"))
+	c.Assert(err, jc.ErrorIsNil)
+	s, err := r.Series()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s, gc.Equals, "bookworm")
+
+	r, err = series.ParseOSRelease(strings.NewReader(""))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(r.ID, gc.Equals, "linux")
+	_, err = r.Series()
+	c.Assert(err, gc.ErrorMatches, "no series for base linux@")
+}
+
+func (*releaseSuite) TestWindowsRelease(c *gc.C) {
+	tests := []struct {
+		productName string
+		build       int
+		expect      string
+	}{
+		{"Windows Server 2012 R2 Datacenter", 9600, "win2012r2"},
+		{"Windows Server 2019 Standard", 17763, "win2019"},
+		{"Windows 10 Pro", 19044, "win10"},
+		{"Windows 10 Pro", 22000, "win11"},
+	}
+	for i, test := range tests {
+		c.Logf("test %d: %s", i, test.productName)
+		r := series.WindowsRelease(test.productName, test.build)
+		c.Check(r.ID, gc.Equals, series.Windows)
+		s, err := r.Series()
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(s, gc.Equals, test.expect)
+	}
+}
+
+func (*releaseSuite) TestHostRelease(c *gc.C) {
+	switch runtime.GOOS {
+	case "linux", "darwin", "windows":
+	default:
+		c.Skip("release detection not supported on " + runtime.GOOS)
+	}
+	r, err := series.HostRelease()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(r.ID, gc.Not(gc.Equals), "")
+	b, err := series.HostBase()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(b, gc.Equals, r.Base())
+}
@@ -0,0 +1,30 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package series
+
+import (
+	"fmt"
+	"strconv"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+const currentVersionKey = `SOFTWARE\Microsoft\Windows NT\CurrentVersion`
+
+func hostRelease() (Release, error) {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, currentVersionKey, registry.QUERY_VALUE)
+	if err != nil {
+		return Release{}, fmt.Errorf("cannot open registry key: %v", err)
+	}
+	defer k.Close()
+	productName, _, err := k.GetStringValue("ProductName")
+	if err != nil {
+		return Release{}, fmt.Errorf("cannot get product name: %v", err)
+	}
+	// A missing or invalid build number is not fatal; it is
+	// only used to distinguish Windows 11 from Windows 10.
+	buildStr, _, _ := k.GetStringValue("CurrentBuild")
+	build, _ := strconv.Atoi(buildStr)
+	return windowsRelease(productName, build), nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package series
+
+import (
+	"fmt"
+	"strings"
+)
+
+// seriesInfo records the base corresponding to a series name.
+type seriesInfo struct {
+	series string
+	base   Base
+}
+
+// allSeries holds every series recognised by this package.
+var allSeries = []seriesInfo{
+	{"trusty", Base{Ubuntu, "14.04"}},
+	{"xenial", Base{Ubuntu, "16.04"}},
+	{"bionic", Base{Ubuntu, "18.04"}},
+	{"cosmic", Base{Ubuntu, "18.10"}},
+	{"disco", Base{Ubuntu, "19.04"}},
+	{"eoan", Base{Ubuntu, "19.10"}},
+	{"focal", Base{Ubuntu, "20.04"}},
+	{"groovy", Base{Ubuntu, "20.10"}},
+	{"hirsute", Base{Ubuntu, "21.04"}},
+	{"impish", Base{Ubuntu, "21.10"}},
+	{"jammy", Base{Ubuntu, "22.04"}},
+	{"kinetic", Base{Ubuntu, "22.10"}},
+	{"centos7", Base{CentOS, "7"}},
+	{"centos8", Base{CentOS, "8"}},
+	{"centos9", Base{CentOS, "9"}},
+	{"win2012", Base{Windows, "2012"}},
+	{"win2012r2", Base{Windows, "2012r2"}},
+	{"win2016", Base{Windows, "2016"}},
+	{"win2019", Base{Windows, "2019"}},
+	{"win2022", Base{Windows, "2022"}},
+	{"win10", Base{Windows, "10"}},
+	{"win11", Base{Windows, "11"}},
+}
+
+// AllSeries returns the names of all the series
+// recognised by this package.
+func AllSeries() []string {
+	names := make([]string, len(allSeries))
+	for i, info := range allSeries {
+		names[i] = info.series
+	}
+	return names
+}
+
+// BaseForSeries returns the base corresponding to the given series.
+func BaseForSeries(series string) (Base, error) {
+	series = strings.ToLower(strings.TrimSpace(series))
+	for _, info := range allSeries {
+		if info.series == series {
+			return info.base, nil
+		}
+	}
+	return Base{}, fmt.Errorf("unknown series %q", series)
+}
+
+// SeriesForBase returns the series corresponding to the given base.
+// Any risk in the channel, as in "ubuntu@22.04/stable", is ignored.
+func SeriesForBase(b Base) (string, error) {
+	channel := strings.SplitN(b.Channel, "/", 2)[0]
+	for _, info := range allSeries {
+		if info.base.OS == b.OS && info.base.Channel == channel {
+			return info.series, nil
+		}
+	}
+	return "", fmt.Errorf("no series for base %s", b)
+}
+
+// IsLTS reports whether the given series is a long
+// term support release of Ubuntu.
+func IsLTS(series string) bool {
+	b, err := BaseForSeries(series)
+	return err == nil && b.IsLTS()
+}
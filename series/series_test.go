@@ -0,0 +1,50 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package series_test
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/series"
+)
+
+type seriesSuite struct{}
+
+var _ = gc.Suite(&seriesSuite{})
+
+func (*seriesSuite) TestRoundTrip(c *gc.C) {
+	for _, s := range series.AllSeries() {
+		b, err := series.BaseForSeries(s)
+		c.Assert(err, jc.ErrorIsNil)
+		s1, err := series.SeriesForBase(b)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(s1, gc.Equals, s)
+	}
+}
+
+func (*seriesSuite) TestBaseForSeries(c *gc.C) {
+	b, err := series.BaseForSeries("Jammy")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(b, gc.Equals, series.Base{OS: series.Ubuntu, Channel: "22.04"})
+
+	_, err = series.BaseForSeries("warty")
+	c.Assert(err, gc.ErrorMatches, `unknown series "warty"`)
+}
+
+func (*seriesSuite) TestSeriesForBase(c *gc.C) {
+	s, err := series.SeriesForBase(series.Base{OS: series.Ubuntu, Channel: "20.04/stable"})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s, gc.Equals, "focal")
+
+	_, err = series.SeriesForBase(series.Base{OS: "debian", Channel: "12"})
+	c.Assert(err, gc.ErrorMatches, `no series for base debian@12`)
+}
+
+func (*seriesSuite) TestIsLTS(c *gc.C) {
+	c.Assert(series.IsLTS("jammy"), jc.IsTrue)
+	c.Assert(series.IsLTS("kinetic"), jc.IsFalse)
+	c.Assert(series.IsLTS("centos7"), jc.IsFalse)
+	c.Assert(series.IsLTS("unknown"), jc.IsFalse)
+}
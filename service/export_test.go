@@ -0,0 +1,14 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package service
+
+var (
+	RunCommand        = &runCommand
+	GOOS              = &goos
+	SystemdRuntimeDir = &systemdRuntimeDir
+	UpstartInitctl    = &upstartInitctl
+	SystemdDir        = &systemdDir
+	UpstartDir        = &upstartDir
+	LaunchdDir        = &launchdDir
+)
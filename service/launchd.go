@@ -0,0 +1,186 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package service
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/juju/errors"
+)
+
+// launchdDir holds the directory in which property lists are written.
+var launchdDir = "/Library/LaunchDaemons"
+
+// launchdService manages a service with launchd.
+type launchdService struct {
+	baseService
+}
+
+// InitSystem implements Service.
+func (s *launchdService) InitSystem() string {
+	return InitLaunchd
+}
+
+func (s *launchdService) plistPath() string {
+	return filepath.Join(launchdDir, s.name+".plist")
+}
+
+// Install implements Service.
+func (s *launchdService) Install() error {
+	status, err := s.Status()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if status.State != NotInstalled {
+		// Unload the old definition so that
+		// the new one is used when loaded.
+		if err := s.unload(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return errors.Trace(writeDefinition(s.plistPath(), renderLaunchdPlist(s.name, s.conf)))
+}
+
+// Start implements Service.
+func (s *launchdService) Start() error {
+	status, err := s.Status()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	switch status.State {
+	case NotInstalled:
+		return errors.NotFoundf("service %q", s.name)
+	case Running:
+		return nil
+	}
+	if _, err := runCommand("launchctl", "list", s.name); err == nil {
+		// The job is loaded but not running.
+		_, err = runCommand("launchctl", "start", s.name)
+		return errors.Trace(err)
+	}
+	_, err = runCommand("launchctl", "load", "-w", s.plistPath())
+	return errors.Trace(err)
+}
+
+// Stop implements Service.
+func (s *launchdService) Stop() error {
+	status, err := s.Status()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if status.State == NotInstalled {
+		return errors.NotFoundf("service %q", s.name)
+	}
+	return errors.Trace(s.unload())
+}
+
+// unload unloads the job if it is loaded, which stops it
+// and, unlike "launchctl stop", prevents it being restarted.
+func (s *launchdService) unload() error {
+	if _, err := runCommand("launchctl", "list", s.name); err != nil {
+		return nil
+	}
+	_, err := runCommand("launchctl", "unload", s.plistPath())
+	return errors.Trace(err)
+}
+
+var (
+	launchdPID        = regexp.MustCompile(`"PID" = (\d+);`)
+	launchdExitStatus = regexp.MustCompile(`"LastExitStatus" = (-?\d+);`)
+)
+
+// Status implements Service.
+func (s *launchdService) Status() (Status, error) {
+	exists, err := definitionExists(s.plistPath())
+	if err != nil {
+		return Status{}, errors.Trace(err)
+	}
+	if !exists {
+		return Status{State: NotInstalled}, nil
+	}
+	out, err := runCommand("launchctl", "list", s.name)
+	if err != nil {
+		if _, ok := errors.Cause(err).(*CommandError); ok {
+			return Status{State: Stopped, Detail: "not loaded"}, nil
+		}
+		return Status{}, errors.Trace(err)
+	}
+	if m := launchdPID.FindStringSubmatch(out); m != nil {
+		pid, _ := strconv.Atoi(m[1])
+		return Status{State: Running, PID: pid, Detail: "running"}, nil
+	}
+	if m := launchdExitStatus.FindStringSubmatch(out); m != nil && m[1] != "0" {
+		return Status{State: Failed, Detail: "last exit status " + m[1]}, nil
+	}
+	return Status{State: Stopped, Detail: "loaded"}, nil
+}
+
+// Remove implements Service.
+func (s *launchdService) Remove() error {
+	if err := s.unload(); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(removeDefinition(s.plistPath()))
+}
+
+// renderLaunchdPlist returns the property list for a service.
+func renderLaunchdPlist(label string, conf Conf) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	buf.WriteString(`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n")
+	buf.WriteString("<plist version=\"1.0\">\n<dict>\n")
+	writeKey := func(key string) {
+		fmt.Fprintf(&buf, "\t<key>%s</key>\n", plistEscape(key))
+	}
+	writeString := func(key, value string) {
+		writeKey(key)
+		fmt.Fprintf(&buf, "\t<string>%s</string>\n", plistEscape(value))
+	}
+	writeString("Label", label)
+	writeKey("ProgramArguments")
+	buf.WriteString("\t<array>\n")
+	for _, arg := range conf.Command {
+		fmt.Fprintf(&buf, "\t\t<string>%s</string>\n", plistEscape(arg))
+	}
+	buf.WriteString("\t</array>\n")
+	if len(conf.Env) > 0 {
+		writeKey("EnvironmentVariables")
+		buf.WriteString("\t<dict>\n")
+		for _, name := range sortedKeys(conf.Env) {
+			fmt.Fprintf(&buf, "\t\t<key>%s</key>\n", plistEscape(name))
+			fmt.Fprintf(&buf, "\t\t<string>%s</string>\n", plistEscape(conf.Env[name]))
+		}
+		buf.WriteString("\t</dict>\n")
+	}
+	if conf.WorkingDir != "" {
+		writeString("WorkingDirectory", conf.WorkingDir)
+	}
+	if conf.User != "" {
+		writeString("UserName", conf.User)
+	}
+	writeKey("RunAtLoad")
+	buf.WriteString("\t<true/>\n")
+	if conf.Restart {
+		writeKey("KeepAlive")
+		buf.WriteString("\t<dict>\n\t\t<key>SuccessfulExit</key>\n\t\t<false/>\n\t</dict>\n")
+	}
+	if conf.LogFile != "" {
+		writeString("StandardOutPath", conf.LogFile)
+		writeString("StandardErrorPath", conf.LogFile)
+	}
+	buf.WriteString("</dict>\n</plist>\n")
+	return buf.Bytes()
+}
+
+// plistEscape escapes s for use as text in a property list.
+func plistEscape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
@@ -0,0 +1,191 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package service_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/service"
+)
+
+type launchdSuite struct {
+	testing.IsolationSuite
+
+	dir    string
+	plist  string
+	runner *fakeRunner
+	svc    service.Service
+}
+
+var _ = gc.Suite(&launchdSuite{})
+
+func (s *launchdSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.dir = c.MkDir()
+	s.plist = filepath.Join(s.dir, "agent.plist")
+	s.PatchValue(service.LaunchdDir, s.dir)
+	s.runner = patchRunner(&s.IsolationSuite)
+	var err error
+	s.svc, err = service.New("agent", testConf, service.InitLaunchd)
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *launchdSuite) install(c *gc.C) {
+	s.runner.set("launchctl list agent", "Could not find service", 113)
+	err := s.svc.Install()
+	c.Assert(err, jc.ErrorIsNil)
+	s.runner.commands = nil
+}
+
+func (s *launchdSuite) TestInstall(c *gc.C) {
+	s.install(c)
+	data, err := ioutil.ReadFile(s.plist)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(data), gc.Equals, `
+<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>agent</string>
+	<key>ProgramArguments</key>
+	<array>
+		<string>/usr/bin/agent</string>
+		<string>--config</string>
+		<string>/etc/agent/my config.yaml</string>
+	</array>
+	<key>EnvironmentVariables</key>
+	<dict>
+		<key>A</key>
+		<string>1</string>
+		<key>B</key>
+		<string>two words</string>
+	</dict>
+	<key>WorkingDirectory</key>
+	<string>/var/lib/agent</string>
+	<key>UserName</key>
+	<string>agent</string>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<dict>
+		<key>SuccessfulExit</key>
+		<false/>
+	</dict>
+	<key>StandardOutPath</key>
+	<string>/var/log/agent.log</string>
+	<key>StandardErrorPath</key>
+	<string>/var/log/agent.log</string>
+</dict>
+</plist>
+`[1:])
+}
+
+func (s *launchdSuite) TestInstallEscapes(c *gc.C) {
+	svc, err := service.New("agent", service.Conf{
+		Command: []string{"/usr/bin/agent", "<a & b>"},
+	}, service.InitLaunchd)
+	c.Assert(err, jc.ErrorIsNil)
+	err = svc.Install()
+	c.Assert(err, jc.ErrorIsNil)
+	data, err := ioutil.ReadFile(s.plist)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(data), jc.Contains, "<string>&lt;a &amp; b&gt;</string>")
+	c.Assert(string(data), gc.Not(jc.Contains), "KeepAlive")
+}
+
+func (s *launchdSuite) TestReinstallUnloads(c *gc.C) {
+	s.install(c)
+	s.runner.set("launchctl list agent", "{\n\t\"PID\" = 1234;\n};\n", 0)
+	err := s.svc.Install()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s.runner.commands, jc.DeepEquals, []string{
+		"launchctl list agent",
+		"launchctl list agent",
+		"launchctl unload " + s.plist,
+	})
+}
+
+func (s *launchdSuite) TestStatus(c *gc.C) {
+	tests := []struct {
+		output   string
+		exitCode int
+		state    service.State
+		pid      int
+	}{
+		{"{\n\t\"LastExitStatus\" = 0;\n\t\"PID\" = 1234;\n};\n", 0, service.Running, 1234},
+		{"{\n\t\"LastExitStatus\" = 0;\n};\n", 0, service.Stopped, 0},
+		{"{\n\t\"LastExitStatus\" = 256;\n};\n", 0, service.Failed, 0},
+		{"Could not find service", 113, service.Stopped, 0},
+	}
+	s.install(c)
+	for i, test := range tests {
+		c.Logf("test %d: %q", i, test.output)
+		s.runner.set("launchctl list agent", test.output, test.exitCode)
+		status, err := s.svc.Status()
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(status.State, gc.Equals, test.state)
+		c.Check(status.PID, gc.Equals, test.pid)
+	}
+}
+
+func (s *launchdSuite) TestStatusNotInstalled(c *gc.C) {
+	status, err := s.svc.Status()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(status.State, gc.Equals, service.NotInstalled)
+}
+
+func (s *launchdSuite) TestStartNotLoaded(c *gc.C) {
+	s.install(c)
+	err := s.svc.Start()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s.runner.commands, jc.DeepEquals, []string{
+		"launchctl list agent",
+		"launchctl list agent",
+		"launchctl load -w " + s.plist,
+	})
+}
+
+func (s *launchdSuite) TestStartLoaded(c *gc.C) {
+	s.install(c)
+	s.runner.set("launchctl list agent", "{\n\t\"LastExitStatus\" = 0;\n};\n", 0)
+	err := s.svc.Start()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s.runner.commands, jc.DeepEquals, []string{
+		"launchctl list agent",
+		"launchctl list agent",
+		"launchctl start agent",
+	})
+}
+
+func (s *launchdSuite) TestStartNotInstalled(c *gc.C) {
+	err := s.svc.Start()
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+}
+
+func (s *launchdSuite) TestStop(c *gc.C) {
+	s.install(c)
+	s.runner.set("launchctl list agent", "{\n\t\"PID\" = 1234;\n};\n", 0)
+	err := s.svc.Stop()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s.runner.commands, jc.DeepEquals, []string{
+		"launchctl list agent",
+		"launchctl list agent",
+		"launchctl unload " + s.plist,
+	})
+}
+
+func (s *launchdSuite) TestRemove(c *gc.C) {
+	s.install(c)
+	err := s.svc.Remove()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s.plist, jc.DoesNotExist)
+	c.Assert(s.runner.commands, jc.DeepEquals, []string{"launchctl list agent"})
+}
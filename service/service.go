@@ -0,0 +1,337 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package service installs, starts, stops, queries and removes system
+// services through one interface, implemented for systemd, upstart,
+// launchd and the Windows service control manager.
+//
+// A service is described by a Conf and managed with a Service:
+//
+//	svc, err := service.New("myagent", service.Conf{
+//		Description: "My agent",
+//		Command:     []string{"/usr/local/bin/myagent", "--config", "/etc/myagent.yaml"},
+//		Restart:     true,
+//	}, "")
+//	if err != nil {
+//		return err
+//	}
+//	if err := svc.Install(); err != nil {
+//		return err
+//	}
+//	return svc.Start()
+package service
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/juju/errors"
+)
+
+// The init systems supported.
+const (
+	InitSystemd = "systemd"
+	InitUpstart = "upstart"
+	InitLaunchd = "launchd"
+	InitWindows = "windows"
+)
+
+// Conf describes a service.
+type Conf struct {
+	// Description holds a short description of the service.
+	Description string
+
+	// Command holds the absolute path of the program to run,
+	// followed by its arguments. On Windows, the program must
+	// implement the service control protocol.
+	Command []string
+
+	// Env holds environment variables to set for the service.
+	Env map[string]string
+
+	// WorkingDir, if not empty, holds the directory in which the
+	// service runs. It is ignored on Windows.
+	WorkingDir string
+
+	// User, if not empty, holds the user that the service runs as.
+	// Otherwise the service runs as root, or LocalSystem on Windows.
+	User string
+
+	// Restart specifies whether the service is restarted
+	// if it exits with a failure.
+	Restart bool
+
+	// LogFile, if not empty, holds the path of a file to which the
+	// output of the service is appended. It is ignored on Windows,
+	// and requires systemd 240 or later.
+	LogFile string
+}
+
+// Validate checks that the configuration is usable. No field may
+// hold control characters, which could change the meaning of the
+// service definition.
+func (conf Conf) Validate() error {
+	if len(conf.Command) == 0 {
+		return errors.NotValidf("empty command")
+	}
+	if !filepath.IsAbs(conf.Command[0]) {
+		return errors.NotValidf("relative command path %q", conf.Command[0])
+	}
+	for _, arg := range conf.Command {
+		if hasControl(arg) {
+			return errors.NotValidf("command argument %q", arg)
+		}
+	}
+	for name, value := range conf.Env {
+		if name == "" || strings.ContainsAny(name, "=") || hasControl(name) {
+			return errors.NotValidf("environment variable name %q", name)
+		}
+		if hasControl(value) {
+			return errors.NotValidf("environment variable %s value %q", name, value)
+		}
+	}
+	for _, f := range []struct {
+		name, value string
+	}{
+		{"description", conf.Description},
+		{"working directory", conf.WorkingDir},
+		{"user", conf.User},
+		{"log file", conf.LogFile},
+	} {
+		if hasControl(f.value) {
+			return errors.NotValidf("%s %q", f.name, f.value)
+		}
+	}
+	return nil
+}
+
+func hasControl(s string) bool {
+	return strings.IndexFunc(s, unicode.IsControl) >= 0
+}
+
+// State describes whether a service is running.
+type State string
+
+// The states of a service. A service is Failed if it is not running
+// because it exited with a failure.
+const (
+	NotInstalled State = "not installed"
+	Stopped      State = "stopped"
+	Running      State = "running"
+	Failed       State = "failed"
+	Unknown      State = "unknown"
+)
+
+// Status holds the status of a service.
+type Status struct {
+	// State holds the state of the service.
+	State State
+
+	// PID holds the process ID of the service,
+	// if it is running and the ID is known.
+	PID int
+
+	// Detail holds the status as reported by the init system.
+	Detail string
+}
+
+// Service manages a system service.
+type Service interface {
+	// Name returns the name of the service.
+	Name() string
+
+	// Conf returns the configuration of the service.
+	Conf() Conf
+
+	// InitSystem returns the name of the init system
+	// that manages the service.
+	InitSystem() string
+
+	// Install installs the service so that it starts when the
+	// system boots, replacing any existing definition. It does not
+	// start the service.
+	Install() error
+
+	// Start starts the service. It does nothing if the service
+	// is already running, and returns an error satisfying
+	// errors.IsNotFound if it is not installed.
+	Start() error
+
+	// Stop stops the service. It does nothing if the service
+	// is not running, and returns an error satisfying
+	// errors.IsNotFound if it is not installed.
+	Stop() error
+
+	// Status returns the status of the service.
+	Status() (Status, error)
+
+	// Remove stops the service if it is running and removes it.
+	// It does nothing if the service is not installed.
+	Remove() error
+}
+
+// validName matches the service names that
+// all supported init systems accept.
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.@-]*$`)
+
+// New returns a Service that manages the service with the given name
+// and configuration using the given init system. If initSystem is
+// empty, the init system running on the local machine is used.
+func New(name string, conf Conf, initSystem string) (Service, error) {
+	if !validName.MatchString(name) {
+		return nil, errors.NotValidf("service name %q", name)
+	}
+	if err := conf.Validate(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if initSystem == "" {
+		var err error
+		if initSystem, err = DiscoverInitSystem(); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	base := baseService{name: name, conf: conf}
+	switch initSystem {
+	case InitSystemd:
+		return &systemdService{base}, nil
+	case InitUpstart:
+		return &upstartService{base}, nil
+	case InitLaunchd:
+		return &launchdService{base}, nil
+	case InitWindows:
+		return newWindowsService(base)
+	}
+	return nil, errors.NotSupportedf("init system %q", initSystem)
+}
+
+// These variables are used to discover the init system,
+// and may be changed by tests.
+var (
+	goos              = runtime.GOOS
+	systemdRuntimeDir = "/run/systemd/system"
+	upstartInitctl    = "/sbin/initctl"
+)
+
+// DiscoverInitSystem returns the name of the init system
+// running on the local machine.
+func DiscoverInitSystem() (string, error) {
+	switch goos {
+	case "windows":
+		return InitWindows, nil
+	case "darwin":
+		return InitLaunchd, nil
+	case "linux":
+		// This is how systemd itself checks that it is running.
+		if info, err := os.Stat(systemdRuntimeDir); err == nil && info.IsDir() {
+			return InitSystemd, nil
+		}
+		if _, err := os.Stat(upstartInitctl); err == nil {
+			out, err := runCommand(upstartInitctl, "--version")
+			if err == nil && strings.Contains(out, "upstart") {
+				return InitUpstart, nil
+			}
+		}
+	}
+	return "", errors.NotFoundf("init system on %s", goos)
+}
+
+type baseService struct {
+	name string
+	conf Conf
+}
+
+// Name implements Service.
+func (s *baseService) Name() string {
+	return s.name
+}
+
+// Conf implements Service.
+func (s *baseService) Conf() Conf {
+	return s.conf
+}
+
+// CommandError is returned when a command run to
+// manage a service fails.
+type CommandError struct {
+	// Command holds the command that was run.
+	Command []string
+
+	// ExitCode holds the exit code of the command.
+	ExitCode int
+
+	// Output holds the combined output of the command.
+	Output string
+}
+
+// Error implements error.
+func (e *CommandError) Error() string {
+	msg := fmt.Sprintf("%s: exit status %d", strings.Join(e.Command, " "), e.ExitCode)
+	if out := strings.TrimSpace(e.Output); out != "" {
+		msg += ": " + out
+	}
+	return msg
+}
+
+// runCommand runs the given command, returning its combined output.
+// If the command fails, the error is a *CommandError. It is a variable
+// so that tests can replace it.
+var runCommand = func(name string, args ...string) (string, error) {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return string(out), &CommandError{
+			Command:  append([]string{name}, args...),
+			ExitCode: exitErr.ExitCode(),
+			Output:   string(out),
+		}
+	}
+	return string(out), errors.Trace(err)
+}
+
+// writeDefinition writes the file defining a service, creating
+// its directory if necessary.
+func writeDefinition(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.Trace(err)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return errors.Annotate(err, "cannot write service definition")
+	}
+	return nil
+}
+
+// definitionExists reports whether the file defining
+// a service exists.
+func definitionExists(path string) (bool, error) {
+	_, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, errors.Trace(err)
+}
+
+// removeDefinition removes the file defining a service,
+// if it exists.
+func removeDefinition(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return errors.Trace(err)
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
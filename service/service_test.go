@@ -0,0 +1,221 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package service_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/service"
+)
+
+// fakeRunner records the commands run and returns canned
+// results for them.
+type fakeRunner struct {
+	commands []string
+	results  map[string]fakeResult
+}
+
+type fakeResult struct {
+	output   string
+	exitCode int
+}
+
+func newFakeRunner() *fakeRunner {
+	return &fakeRunner{results: make(map[string]fakeResult)}
+}
+
+// set sets the result of running the given command.
+func (r *fakeRunner) set(command, output string, exitCode int) {
+	r.results[command] = fakeResult{output: output, exitCode: exitCode}
+}
+
+func (r *fakeRunner) run(name string, args ...string) (string, error) {
+	command := strings.Join(append([]string{name}, args...), " ")
+	r.commands = append(r.commands, command)
+	result := r.results[command]
+	if result.exitCode != 0 {
+		return result.output, &service.CommandError{
+			Command:  append([]string{name}, args...),
+			ExitCode: result.exitCode,
+			Output:   result.output,
+		}
+	}
+	return result.output, nil
+}
+
+// patchRunner replaces the command runner with a fake one.
+func patchRunner(s *testing.IsolationSuite) *fakeRunner {
+	r := newFakeRunner()
+	s.PatchValue(service.RunCommand, r.run)
+	return r
+}
+
+var testConf = service.Conf{
+	Description: "Test agent",
+	Command:     []string{"/usr/bin/agent", "--config", "/etc/agent/my config.yaml"},
+	Env:         map[string]string{"B": "two words", "A": "1"},
+	WorkingDir:  "/var/lib/agent",
+	User:        "agent",
+	Restart:     true,
+	LogFile:     "/var/log/agent.log",
+}
+
+type serviceSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&serviceSuite{})
+
+func (s *serviceSuite) TestConfValidate(c *gc.C) {
+	tests := []struct {
+		conf service.Conf
+		err  string
+	}{{
+		conf: testConf,
+	}, {
+		conf: service.Conf{},
+		err:  "empty command not valid",
+	}, {
+		conf: service.Conf{Command: []string{"agent"}},
+		err:  `relative command path "agent" not valid`,
+	}, {
+		conf: service.Conf{
+			Command: []string{"/usr/bin/agent"},
+			Env:     map[string]string{"A=B": "C"},
+		},
+		err: `environment variable name "A=B" not valid`,
+	}, {
+		conf: service.Conf{
+			Command: []string{"/usr/bin/agent"},
+			Env:     map[string]string{"A": "B\nC"},
+		},
+		err: `environment variable A value "B\\nC" not valid`,
+	}, {
+		conf: service.Conf{Command: []string{"/usr/bin/agent", "a\nb"}},
+		err:  `command argument "a\\nb" not valid`,
+	}, {
+		conf: service.Conf{
+			Command:     []string{"/usr/bin/agent"},
+			Description: "Agent\nExecStartPre=/bin/evil",
+		},
+		err: `description "Agent\\nExecStartPre=/bin/evil" not valid`,
+	}, {
+		conf: service.Conf{Command: []string{"/usr/bin/agent"}, WorkingDir: "/var\rx"},
+		err:  `working directory "/var\\rx" not valid`,
+	}, {
+		conf: service.Conf{Command: []string{"/usr/bin/agent"}, User: "agent\nsetuid root"},
+		err:  `user "agent\\nsetuid root" not valid`,
+	}, {
+		conf: service.Conf{Command: []string{"/usr/bin/agent"}, LogFile: "/var/log/a\x00"},
+		err:  `log file "/var/log/a\\x00" not valid`,
+	}}
+	for i, test := range tests {
+		c.Logf("test %d", i)
+		err := test.conf.Validate()
+		if test.err == "" {
+			c.Check(err, jc.ErrorIsNil)
+		} else {
+			c.Check(err, gc.ErrorMatches, test.err)
+			c.Check(err, jc.Satisfies, errors.IsNotValid)
+		}
+	}
+}
+
+func (s *serviceSuite) TestNew(c *gc.C) {
+	for _, initSystem := range []string{service.InitSystemd, service.InitUpstart, service.InitLaunchd} {
+		svc, err := service.New("agent", testConf, initSystem)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(svc.Name(), gc.Equals, "agent")
+		c.Check(svc.Conf(), jc.DeepEquals, testConf)
+		c.Check(svc.InitSystem(), gc.Equals, initSystem)
+	}
+}
+
+func (s *serviceSuite) TestNewInvalidName(c *gc.C) {
+	for _, name := range []string{"", "-agent", "my agent", "../agent", "agent/1"} {
+		_, err := service.New(name, testConf, service.InitSystemd)
+		c.Check(err, jc.Satisfies, errors.IsNotValid, gc.Commentf("name %q", name))
+	}
+}
+
+func (s *serviceSuite) TestNewInvalidConf(c *gc.C) {
+	_, err := service.New("agent", service.Conf{}, service.InitSystemd)
+	c.Assert(err, gc.ErrorMatches, "empty command not valid")
+}
+
+func (s *serviceSuite) TestNewUnknownInitSystem(c *gc.C) {
+	_, err := service.New("agent", testConf, "sysvinit")
+	c.Assert(err, gc.ErrorMatches, `init system "sysvinit" not supported`)
+	c.Assert(err, jc.Satisfies, errors.IsNotSupported)
+}
+
+func (s *serviceSuite) TestNewDiscoversInitSystem(c *gc.C) {
+	s.PatchValue(service.GOOS, "darwin")
+	svc, err := service.New("agent", testConf, "")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(svc.InitSystem(), gc.Equals, service.InitLaunchd)
+}
+
+func (s *serviceSuite) TestDiscoverInitSystem(c *gc.C) {
+	dir := c.MkDir()
+	runtimeDir := filepath.Join(dir, "systemd")
+	initctl := filepath.Join(dir, "initctl")
+	s.PatchValue(service.SystemdRuntimeDir, runtimeDir)
+	s.PatchValue(service.UpstartInitctl, initctl)
+	r := patchRunner(&s.IsolationSuite)
+	r.set(initctl+" --version", "initctl (upstart 1.12.1)\n", 0)
+
+	check := func(goos, expect string) {
+		s.PatchValue(service.GOOS, goos)
+		initSystem, err := service.DiscoverInitSystem()
+		if expect == "" {
+			c.Check(err, jc.Satisfies, errors.IsNotFound)
+		} else {
+			c.Check(err, jc.ErrorIsNil)
+			c.Check(initSystem, gc.Equals, expect)
+		}
+	}
+	check("windows", service.InitWindows)
+	check("darwin", service.InitLaunchd)
+	check("freebsd", "")
+	check("linux", "")
+
+	err := ioutil.WriteFile(initctl, nil, 0755)
+	c.Assert(err, jc.ErrorIsNil)
+	check("linux", service.InitUpstart)
+
+	err = os.Mkdir(runtimeDir, 0755)
+	c.Assert(err, jc.ErrorIsNil)
+	check("linux", service.InitSystemd)
+}
+
+func (s *serviceSuite) TestDiscoverInitSystemNotUpstart(c *gc.C) {
+	initctl := filepath.Join(c.MkDir(), "initctl")
+	err := ioutil.WriteFile(initctl, nil, 0755)
+	c.Assert(err, jc.ErrorIsNil)
+	s.PatchValue(service.GOOS, "linux")
+	s.PatchValue(service.SystemdRuntimeDir, filepath.Join(c.MkDir(), "systemd"))
+	s.PatchValue(service.UpstartInitctl, initctl)
+	patchRunner(&s.IsolationSuite)
+
+	_, err = service.DiscoverInitSystem()
+	c.Assert(err, gc.ErrorMatches, "init system on linux not found")
+}
+
+func (s *serviceSuite) TestCommandError(c *gc.C) {
+	err := &service.CommandError{
+		Command:  []string{"systemctl", "start", "agent.service"},
+		ExitCode: 5,
+		Output:   "Failed to start agent.service: Unit agent.service not found.\n",
+	}
+	c.Assert(err, gc.ErrorMatches, "systemctl start agent.service: exit status 5: Failed to start agent.service: Unit agent.service not found.")
+}
@@ -0,0 +1,194 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// systemdDir holds the directory in which unit files are written.
+var systemdDir = "/etc/systemd/system"
+
+// systemdService manages a service with systemd.
+type systemdService struct {
+	baseService
+}
+
+// InitSystem implements Service.
+func (s *systemdService) InitSystem() string {
+	return InitSystemd
+}
+
+func (s *systemdService) unitName() string {
+	return s.name + ".service"
+}
+
+func (s *systemdService) unitPath() string {
+	return filepath.Join(systemdDir, s.unitName())
+}
+
+// Install implements Service.
+func (s *systemdService) Install() error {
+	if err := writeDefinition(s.unitPath(), renderSystemdUnit(s.conf)); err != nil {
+		return errors.Trace(err)
+	}
+	if _, err := runCommand("systemctl", "daemon-reload"); err != nil {
+		return errors.Trace(err)
+	}
+	_, err := runCommand("systemctl", "enable", s.unitName())
+	return errors.Trace(err)
+}
+
+// Start implements Service.
+func (s *systemdService) Start() error {
+	if err := s.checkInstalled(); err != nil {
+		return errors.Trace(err)
+	}
+	_, err := runCommand("systemctl", "start", s.unitName())
+	return errors.Trace(err)
+}
+
+// Stop implements Service.
+func (s *systemdService) Stop() error {
+	if err := s.checkInstalled(); err != nil {
+		return errors.Trace(err)
+	}
+	_, err := runCommand("systemctl", "stop", s.unitName())
+	return errors.Trace(err)
+}
+
+func (s *systemdService) checkInstalled() error {
+	status, err := s.Status()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if status.State == NotInstalled {
+		return errors.NotFoundf("service %q", s.name)
+	}
+	return nil
+}
+
+// Status implements Service.
+func (s *systemdService) Status() (Status, error) {
+	out, err := runCommand("systemctl", "show", s.unitName(), "--property=LoadState,ActiveState,SubState,MainPID")
+	if err != nil {
+		return Status{}, errors.Trace(err)
+	}
+	props := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		if i := strings.Index(line, "="); i > 0 {
+			props[line[:i]] = strings.TrimSpace(line[i+1:])
+		}
+	}
+	status := Status{
+		Detail: props["ActiveState"] + " (" + props["SubState"] + ")",
+	}
+	if props["LoadState"] == "not-found" {
+		status.State = NotInstalled
+		status.Detail = "not-found"
+		return status, nil
+	}
+	switch props["ActiveState"] {
+	case "active", "activating", "reloading":
+		status.State = Running
+		status.PID, _ = strconv.Atoi(props["MainPID"])
+	case "inactive", "deactivating":
+		status.State = Stopped
+	case "failed":
+		status.State = Failed
+	default:
+		status.State = Unknown
+	}
+	return status, nil
+}
+
+// Remove implements Service.
+func (s *systemdService) Remove() error {
+	status, err := s.Status()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if status.State == NotInstalled {
+		return nil
+	}
+	for _, command := range []string{"stop", "disable"} {
+		if _, err := runCommand("systemctl", command, s.unitName()); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if err := removeDefinition(s.unitPath()); err != nil {
+		return errors.Trace(err)
+	}
+	if _, err := runCommand("systemctl", "daemon-reload"); err != nil {
+		return errors.Trace(err)
+	}
+	if status.State == Failed {
+		// Forget the failure, which would otherwise be
+		// reported for the unit until the next reboot.
+		runCommand("systemctl", "reset-failed", s.unitName())
+	}
+	return nil
+}
+
+// renderSystemdUnit returns the unit file for a service.
+func renderSystemdUnit(conf Conf) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("[Unit]\n")
+	if conf.Description != "" {
+		fmt.Fprintf(&buf, "Description=%s\n", systemdEscape(conf.Description))
+	}
+	buf.WriteString("After=network.target\n")
+	buf.WriteString("\n[Service]\n")
+	buf.WriteString("Type=simple\n")
+	args := make([]string, len(conf.Command))
+	for i, arg := range conf.Command {
+		// Unlike other settings, ExecStart
+		// expands environment variables.
+		args[i] = strings.Replace(systemdQuote(arg), "$", "$$", -1)
+	}
+	fmt.Fprintf(&buf, "ExecStart=%s\n", strings.Join(args, " "))
+	for _, name := range sortedKeys(conf.Env) {
+		fmt.Fprintf(&buf, "Environment=%s\n", systemdQuote(name+"="+conf.Env[name]))
+	}
+	if conf.WorkingDir != "" {
+		fmt.Fprintf(&buf, "WorkingDirectory=%s\n", systemdEscape(conf.WorkingDir))
+	}
+	if conf.User != "" {
+		fmt.Fprintf(&buf, "User=%s\n", systemdEscape(conf.User))
+	}
+	if conf.Restart {
+		buf.WriteString("Restart=on-failure\n")
+		buf.WriteString("RestartSec=5\n")
+	}
+	if conf.LogFile != "" {
+		fmt.Fprintf(&buf, "StandardOutput=append:%s\n", systemdEscape(conf.LogFile))
+		fmt.Fprintf(&buf, "StandardError=append:%s\n", systemdEscape(conf.LogFile))
+	}
+	buf.WriteString("\n[Install]\n")
+	buf.WriteString("WantedBy=multi-user.target\n")
+	return buf.Bytes()
+}
+
+// systemdEscape escapes the specifiers that systemd
+// expands in unit file settings.
+func systemdEscape(s string) string {
+	return strings.Replace(s, "%", "%%", -1)
+}
+
+// systemdQuote quotes s as a single word in a unit file
+// setting, if necessary.
+func systemdQuote(s string) string {
+	s = systemdEscape(s)
+	if s != "" && !strings.ContainsAny(s, " \t\n\"'\\;") {
+		return s
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`)
+	return `"` + r.Replace(s) + `"`
+}
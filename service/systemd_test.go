@@ -0,0 +1,175 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package service_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/service"
+)
+
+type systemdSuite struct {
+	testing.IsolationSuite
+
+	dir    string
+	runner *fakeRunner
+	svc    service.Service
+}
+
+var _ = gc.Suite(&systemdSuite{})
+
+const systemdShow = "systemctl show agent.service --property=LoadState,ActiveState,SubState,MainPID"
+
+func (s *systemdSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.dir = c.MkDir()
+	s.PatchValue(service.SystemdDir, s.dir)
+	s.runner = patchRunner(&s.IsolationSuite)
+	var err error
+	s.svc, err = service.New("agent", testConf, service.InitSystemd)
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *systemdSuite) setState(loadState, activeState string, pid int) {
+	out := "MainPID=0\n"
+	if pid != 0 {
+		out = "MainPID=1234\n"
+	}
+	out += "LoadState=" + loadState + "\nActiveState=" + activeState + "\nSubState=dead\n"
+	s.runner.set(systemdShow, out, 0)
+}
+
+func (s *systemdSuite) TestInstall(c *gc.C) {
+	err := s.svc.Install()
+	c.Assert(err, jc.ErrorIsNil)
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, "agent.service"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(data), gc.Equals, `
+[Unit]
+Description=Test agent
+After=network.target
+
+[Service]
+Type=simple
+ExecStart=/usr/bin/agent --config "/etc/agent/my config.yaml"
+Environment=A=1
+Environment="B=two words"
+WorkingDirectory=/var/lib/agent
+User=agent
+Restart=on-failure
+RestartSec=5
+StandardOutput=append:/var/log/agent.log
+StandardError=append:/var/log/agent.log
+
+[Install]
+WantedBy=multi-user.target
+`[1:])
+	c.Assert(s.runner.commands, jc.DeepEquals, []string{
+		"systemctl daemon-reload",
+		"systemctl enable agent.service",
+	})
+}
+
+func (s *systemdSuite) TestInstallEscapes(c *gc.C) {
+	svc, err := service.New("agent", service.Conf{
+		Description: "100% agent",
+		Command:     []string{"/usr/bin/agent", "--home", "$HOME", `say "hi"\n`, ""},
+	}, service.InitSystemd)
+	c.Assert(err, jc.ErrorIsNil)
+	err = svc.Install()
+	c.Assert(err, jc.ErrorIsNil)
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, "agent.service"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(data), jc.Contains, "Description=100%% agent\n")
+	c.Assert(string(data), jc.Contains, `ExecStart=/usr/bin/agent --home $$HOME "say \"hi\"\\n" ""`+"\n")
+	c.Assert(string(data), gc.Not(jc.Contains), "Restart=")
+	c.Assert(string(data), gc.Not(jc.Contains), "StandardOutput=")
+}
+
+func (s *systemdSuite) TestStatus(c *gc.C) {
+	tests := []struct {
+		loadState   string
+		activeState string
+		pid         int
+		expect      service.State
+	}{
+		{"not-found", "inactive", 0, service.NotInstalled},
+		{"loaded", "active", 1234, service.Running},
+		{"loaded", "inactive", 0, service.Stopped},
+		{"loaded", "failed", 0, service.Failed},
+		{"loaded", "maintenance", 0, service.Unknown},
+	}
+	for i, test := range tests {
+		c.Logf("test %d: %s %s", i, test.loadState, test.activeState)
+		s.setState(test.loadState, test.activeState, test.pid)
+		status, err := s.svc.Status()
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(status.State, gc.Equals, test.expect)
+		c.Check(status.PID, gc.Equals, test.pid)
+	}
+}
+
+func (s *systemdSuite) TestStatusError(c *gc.C) {
+	s.runner.set(systemdShow, "Failed to connect to bus", 1)
+	_, err := s.svc.Status()
+	c.Assert(err, gc.ErrorMatches, "systemctl show .*: exit status 1: Failed to connect to bus")
+}
+
+func (s *systemdSuite) TestStart(c *gc.C) {
+	s.setState("loaded", "inactive", 0)
+	err := s.svc.Start()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s.runner.commands, jc.DeepEquals, []string{
+		systemdShow,
+		"systemctl start agent.service",
+	})
+}
+
+func (s *systemdSuite) TestStartNotInstalled(c *gc.C) {
+	s.setState("not-found", "inactive", 0)
+	err := s.svc.Start()
+	c.Assert(err, gc.ErrorMatches, `service "agent" not found`)
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+}
+
+func (s *systemdSuite) TestStop(c *gc.C) {
+	s.setState("loaded", "active", 1234)
+	err := s.svc.Stop()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s.runner.commands, jc.DeepEquals, []string{
+		systemdShow,
+		"systemctl stop agent.service",
+	})
+}
+
+func (s *systemdSuite) TestRemove(c *gc.C) {
+	err := s.svc.Install()
+	c.Assert(err, jc.ErrorIsNil)
+	s.runner.commands = nil
+	s.setState("loaded", "failed", 0)
+
+	err = s.svc.Remove()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(filepath.Join(s.dir, "agent.service"), jc.DoesNotExist)
+	c.Assert(s.runner.commands, jc.DeepEquals, []string{
+		systemdShow,
+		"systemctl stop agent.service",
+		"systemctl disable agent.service",
+		"systemctl daemon-reload",
+		"systemctl reset-failed agent.service",
+	})
+}
+
+func (s *systemdSuite) TestRemoveNotInstalled(c *gc.C) {
+	s.setState("not-found", "inactive", 0)
+	err := s.svc.Remove()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s.runner.commands, jc.DeepEquals, []string{systemdShow})
+}
@@ -0,0 +1,152 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+
+	"github.com/juju/utils/v3"
+)
+
+// upstartDir holds the directory in which job files are written.
+var upstartDir = "/etc/init"
+
+// upstartService manages a service with upstart.
+type upstartService struct {
+	baseService
+}
+
+// InitSystem implements Service.
+func (s *upstartService) InitSystem() string {
+	return InitUpstart
+}
+
+func (s *upstartService) confPath() string {
+	return filepath.Join(upstartDir, s.name+".conf")
+}
+
+// Install implements Service.
+func (s *upstartService) Install() error {
+	// Upstart notices changes to job files by itself.
+	return errors.Trace(writeDefinition(s.confPath(), renderUpstartConf(s.conf)))
+}
+
+// Start implements Service.
+func (s *upstartService) Start() error {
+	status, err := s.Status()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	switch status.State {
+	case NotInstalled:
+		return errors.NotFoundf("service %q", s.name)
+	case Running:
+		return nil
+	}
+	_, err = runCommand("initctl", "start", s.name)
+	return errors.Trace(err)
+}
+
+// Stop implements Service.
+func (s *upstartService) Stop() error {
+	status, err := s.Status()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	switch status.State {
+	case NotInstalled:
+		return errors.NotFoundf("service %q", s.name)
+	case Running:
+		_, err = runCommand("initctl", "stop", s.name)
+		return errors.Trace(err)
+	}
+	return nil
+}
+
+// upstartStatus matches the output of "initctl status",
+// for example "myjob start/running, process 1234".
+var upstartStatus = regexp.MustCompile(`^\S+ (\w+)/([\w-]+)(?:, process (\d+))?`)
+
+// Status implements Service.
+func (s *upstartService) Status() (Status, error) {
+	exists, err := definitionExists(s.confPath())
+	if err != nil {
+		return Status{}, errors.Trace(err)
+	}
+	if !exists {
+		return Status{State: NotInstalled}, nil
+	}
+	out, err := runCommand("initctl", "status", s.name)
+	if err != nil {
+		if cmdErr, ok := errors.Cause(err).(*CommandError); ok && strings.Contains(cmdErr.Output, "Unknown job") {
+			// The job file has not been loaded yet.
+			return Status{State: Stopped, Detail: "unknown job"}, nil
+		}
+		return Status{}, errors.Trace(err)
+	}
+	out = strings.TrimSpace(out)
+	m := upstartStatus.FindStringSubmatch(out)
+	if m == nil {
+		return Status{State: Unknown, Detail: out}, nil
+	}
+	status := Status{Detail: m[1] + "/" + m[2]}
+	switch {
+	case m[1] == "start" && m[2] == "running":
+		status.State = Running
+		status.PID, _ = strconv.Atoi(m[3])
+	case m[1] == "stop" && m[2] == "waiting":
+		status.State = Stopped
+	default:
+		// The job is changing state.
+		status.State = Unknown
+	}
+	return status, nil
+}
+
+// Remove implements Service.
+func (s *upstartService) Remove() error {
+	if err := s.Stop(); err != nil && !errors.IsNotFound(err) {
+		return errors.Trace(err)
+	}
+	return errors.Trace(removeDefinition(s.confPath()))
+}
+
+// renderUpstartConf returns the job file for a service.
+func renderUpstartConf(conf Conf) []byte {
+	var buf bytes.Buffer
+	if conf.Description != "" {
+		fmt.Fprintf(&buf, "description %s\n", utils.ShQuote(conf.Description))
+	}
+	buf.WriteString("start on runlevel [2345]\n")
+	buf.WriteString("stop on runlevel [!2345]\n")
+	if conf.Restart {
+		buf.WriteString("respawn\n")
+	}
+	for _, name := range sortedKeys(conf.Env) {
+		fmt.Fprintf(&buf, "env %s=%s\n", name, utils.ShQuote(conf.Env[name]))
+	}
+	if conf.WorkingDir != "" {
+		fmt.Fprintf(&buf, "chdir %s\n", utils.ShQuote(conf.WorkingDir))
+	}
+	if conf.User != "" {
+		fmt.Fprintf(&buf, "setuid %s\n", utils.ShQuote(conf.User))
+	}
+	args := make([]string, len(conf.Command))
+	for i, arg := range conf.Command {
+		args[i] = utils.ShQuote(arg)
+	}
+	command := "exec " + strings.Join(args, " ")
+	if conf.LogFile != "" {
+		command += " >> " + utils.ShQuote(conf.LogFile) + " 2>&1"
+	}
+	fmt.Fprintf(&buf, "\nscript\n  %s\nend script\n", command)
+	return buf.Bytes()
+}
@@ -0,0 +1,134 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package service_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/service"
+)
+
+type upstartSuite struct {
+	testing.IsolationSuite
+
+	dir    string
+	runner *fakeRunner
+	svc    service.Service
+}
+
+var _ = gc.Suite(&upstartSuite{})
+
+func (s *upstartSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.dir = c.MkDir()
+	s.PatchValue(service.UpstartDir, s.dir)
+	s.runner = patchRunner(&s.IsolationSuite)
+	var err error
+	s.svc, err = service.New("agent", testConf, service.InitUpstart)
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *upstartSuite) install(c *gc.C) {
+	err := s.svc.Install()
+	c.Assert(err, jc.ErrorIsNil)
+	s.runner.commands = nil
+}
+
+func (s *upstartSuite) TestInstall(c *gc.C) {
+	s.install(c)
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, "agent.conf"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(data), gc.Equals, `
+description 'Test agent'
+start on runlevel [2345]
+stop on runlevel [!2345]
+respawn
+env A='1'
+env B='two words'
+chdir '/var/lib/agent'
+setuid 'agent'
+
+script
+  exec '/usr/bin/agent' '--config' '/etc/agent/my config.yaml' >> '/var/log/agent.log' 2>&1
+end script
+`[1:])
+}
+
+func (s *upstartSuite) TestStatus(c *gc.C) {
+	tests := []struct {
+		output   string
+		exitCode int
+		state    service.State
+		pid      int
+	}{
+		{"agent start/running, process 1234\n", 0, service.Running, 1234},
+		{"agent stop/waiting\n", 0, service.Stopped, 0},
+		{"agent stop/pre-stop, process 1234\n", 0, service.Unknown, 0},
+		{"initctl: Unknown job: agent\n", 1, service.Stopped, 0},
+		{"garbage\n", 0, service.Unknown, 0},
+	}
+	s.install(c)
+	for i, test := range tests {
+		c.Logf("test %d: %q", i, test.output)
+		s.runner.set("initctl status agent", test.output, test.exitCode)
+		status, err := s.svc.Status()
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(status.State, gc.Equals, test.state)
+		c.Check(status.PID, gc.Equals, test.pid)
+	}
+}
+
+func (s *upstartSuite) TestStatusNotInstalled(c *gc.C) {
+	status, err := s.svc.Status()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(status.State, gc.Equals, service.NotInstalled)
+	c.Assert(s.runner.commands, gc.HasLen, 0)
+}
+
+func (s *upstartSuite) TestStart(c *gc.C) {
+	s.install(c)
+	s.runner.set("initctl status agent", "agent stop/waiting\n", 0)
+	err := s.svc.Start()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s.runner.commands, jc.DeepEquals, []string{
+		"initctl status agent",
+		"initctl start agent",
+	})
+}
+
+func (s *upstartSuite) TestStartRunning(c *gc.C) {
+	s.install(c)
+	s.runner.set("initctl status agent", "agent start/running, process 1234\n", 0)
+	err := s.svc.Start()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s.runner.commands, jc.DeepEquals, []string{"initctl status agent"})
+}
+
+func (s *upstartSuite) TestStartNotInstalled(c *gc.C) {
+	err := s.svc.Start()
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+}
+
+func (s *upstartSuite) TestRemove(c *gc.C) {
+	s.install(c)
+	s.runner.set("initctl status agent", "agent start/running, process 1234\n", 0)
+	err := s.svc.Remove()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(filepath.Join(s.dir, "agent.conf"), jc.DoesNotExist)
+	c.Assert(s.runner.commands, jc.DeepEquals, []string{
+		"initctl status agent",
+		"initctl stop agent",
+	})
+}
+
+func (s *upstartSuite) TestRemoveNotInstalled(c *gc.C) {
+	err := s.svc.Remove()
+	c.Assert(err, jc.ErrorIsNil)
+}
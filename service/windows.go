@@ -0,0 +1,225 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+//go:build windows
+// +build windows
+
+package service
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/juju/errors"
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// windowsStopTimeout holds how long Stop waits for a service to stop.
+var windowsStopTimeout = 30 * time.Second
+
+// windowsService manages a service with the Windows
+// service control manager.
+type windowsService struct {
+	baseService
+}
+
+func newWindowsService(base baseService) (Service, error) {
+	return &windowsService{base}, nil
+}
+
+// InitSystem implements Service.
+func (s *windowsService) InitSystem() string {
+	return InitWindows
+}
+
+// withService connects to the service control manager, opens
+// the service and calls f with it. If the service does not exist,
+// it returns an error satisfying errors.IsNotFound.
+func (s *windowsService) withService(f func(*mgr.Mgr, *mgr.Service) error) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return errors.Annotate(err, "cannot connect to service control manager")
+	}
+	defer m.Disconnect()
+	service, err := m.OpenService(s.name)
+	if err == windows.ERROR_SERVICE_DOES_NOT_EXIST {
+		return errors.NotFoundf("service %q", s.name)
+	}
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer service.Close()
+	return f(m, service)
+}
+
+// Install implements Service.
+func (s *windowsService) Install() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return errors.Annotate(err, "cannot connect to service control manager")
+	}
+	defer m.Disconnect()
+
+	args := make([]string, len(s.conf.Command))
+	for i, arg := range s.conf.Command {
+		args[i] = syscall.EscapeArg(arg)
+	}
+	config := mgr.Config{
+		ServiceType:      windows.SERVICE_WIN32_OWN_PROCESS,
+		StartType:        mgr.StartAutomatic,
+		ErrorControl:     mgr.ErrorNormal,
+		BinaryPathName:   strings.Join(args, " "),
+		ServiceStartName: s.conf.User,
+		DisplayName:      s.name,
+		Description:      s.conf.Description,
+	}
+	service, err := m.OpenService(s.name)
+	switch {
+	case err == windows.ERROR_SERVICE_DOES_NOT_EXIST:
+		service, err = m.CreateService(s.name, s.conf.Command[0], config, s.conf.Command[1:]...)
+		if err != nil {
+			return errors.Annotatef(err, "cannot create service %q", s.name)
+		}
+	case err != nil:
+		return errors.Trace(err)
+	default:
+		if s.conf.User == "" {
+			// An empty name leaves the account unchanged.
+			config.ServiceStartName = "LocalSystem"
+		}
+		if err := service.UpdateConfig(config); err != nil {
+			service.Close()
+			return errors.Annotatef(err, "cannot update service %q", s.name)
+		}
+	}
+	defer service.Close()
+
+	if s.conf.Restart {
+		actions := []mgr.RecoveryAction{
+			{Type: mgr.ServiceRestart, Delay: 5 * time.Second},
+		}
+		// Reset the failure count after a day.
+		if err := service.SetRecoveryActions(actions, 86400); err != nil {
+			return errors.Annotate(err, "cannot set recovery actions")
+		}
+	} else if err := service.ResetRecoveryActions(); err != nil {
+		return errors.Annotate(err, "cannot reset recovery actions")
+	}
+	return errors.Trace(s.setEnv())
+}
+
+// setEnv records the environment of the service in the registry,
+// from where the service control manager reads it.
+func (s *windowsService) setEnv() error {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Services\`+s.name, registry.SET_VALUE)
+	if err != nil {
+		return errors.Annotate(err, "cannot open service registry key")
+	}
+	defer key.Close()
+	if len(s.conf.Env) == 0 {
+		if err := key.DeleteValue("Environment"); err != nil && err != windows.ERROR_FILE_NOT_FOUND {
+			return errors.Trace(err)
+		}
+		return nil
+	}
+	var env []string
+	for _, name := range sortedKeys(s.conf.Env) {
+		env = append(env, name+"="+s.conf.Env[name])
+	}
+	return errors.Trace(key.SetStringsValue("Environment", env))
+}
+
+// Start implements Service.
+func (s *windowsService) Start() error {
+	return s.withService(func(_ *mgr.Mgr, service *mgr.Service) error {
+		err := service.Start()
+		if err == windows.ERROR_SERVICE_ALREADY_RUNNING {
+			return nil
+		}
+		return errors.Trace(err)
+	})
+}
+
+// Stop implements Service.
+func (s *windowsService) Stop() error {
+	return s.withService(func(_ *mgr.Mgr, service *mgr.Service) error {
+		return errors.Trace(stopWindowsService(service))
+	})
+}
+
+// stopWindowsService stops the service and waits for it to stop.
+func stopWindowsService(service *mgr.Service) error {
+	status, err := service.Control(svc.Stop)
+	if err == windows.ERROR_SERVICE_NOT_ACTIVE {
+		return nil
+	}
+	if err != nil {
+		return errors.Trace(err)
+	}
+	deadline := time.Now().Add(windowsStopTimeout)
+	for status.State != svc.Stopped {
+		if time.Now().After(deadline) {
+			return errors.Timeoutf("waiting for service to stop")
+		}
+		time.Sleep(250 * time.Millisecond)
+		if status, err = service.Query(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// Status implements Service.
+func (s *windowsService) Status() (Status, error) {
+	var status Status
+	err := s.withService(func(_ *mgr.Mgr, service *mgr.Service) error {
+		st, err := service.Query()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		status = windowsStatus(st)
+		return nil
+	})
+	if errors.IsNotFound(err) {
+		return Status{State: NotInstalled}, nil
+	}
+	return status, errors.Trace(err)
+}
+
+func windowsStatus(st svc.Status) Status {
+	switch st.State {
+	case svc.Running:
+		return Status{State: Running, PID: int(st.ProcessId), Detail: "running"}
+	case svc.Stopped:
+		if st.Win32ExitCode != 0 && st.Win32ExitCode != uint32(windows.ERROR_SERVICE_NEVER_STARTED) {
+			return Status{State: Failed, Detail: fmt.Sprintf("stopped with exit code %d", st.Win32ExitCode)}
+		}
+		return Status{State: Stopped, Detail: "stopped"}
+	case svc.StartPending:
+		return Status{State: Unknown, Detail: "start pending"}
+	case svc.StopPending:
+		return Status{State: Unknown, Detail: "stop pending"}
+	case svc.Paused, svc.PausePending, svc.ContinuePending:
+		return Status{State: Unknown, Detail: "paused"}
+	}
+	return Status{State: Unknown, Detail: fmt.Sprintf("state %d", st.State)}
+}
+
+// Remove implements Service.
+func (s *windowsService) Remove() error {
+	err := s.withService(func(_ *mgr.Mgr, service *mgr.Service) error {
+		if err := stopWindowsService(service); err != nil {
+			return errors.Trace(err)
+		}
+		return errors.Trace(service.Delete())
+	})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return errors.Trace(err)
+}
@@ -0,0 +1,15 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+//go:build !windows
+// +build !windows
+
+package service
+
+import (
+	"github.com/juju/errors"
+)
+
+func newWindowsService(base baseService) (Service, error) {
+	return nil, errors.NotSupportedf("windows services on this platform")
+}
@@ -0,0 +1,222 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package set provides a generic set type.
+package set
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+)
+
+// Set represents the classic "set" data structure,
+// and contains values of type T.
+type Set[T comparable] map[T]struct{}
+
+// New creates and initializes a Set and populates it with
+// initial values as specified in the parameters.
+func New[T comparable](initial ...T) Set[T] {
+	result := make(Set[T], len(initial))
+	for _, value := range initial {
+		result.Add(value)
+	}
+	return result
+}
+
+// Size returns the number of elements in the set.
+func (s Set[T]) Size() int {
+	return len(s)
+}
+
+// IsEmpty is true for empty or uninitialized sets.
+func (s Set[T]) IsEmpty() bool {
+	return len(s) == 0
+}
+
+// Add puts a value into the set.
+func (s Set[T]) Add(value T) {
+	if s == nil {
+		panic("uninitalised set")
+	}
+	s[value] = struct{}{}
+}
+
+// Remove takes a value out of the set. If value wasn't in the set to start
+// with, this method silently succeeds.
+func (s Set[T]) Remove(value T) {
+	delete(s, value)
+}
+
+// Contains returns true if the value is in the set, and false otherwise.
+func (s Set[T]) Contains(value T) bool {
+	_, exists := s[value]
+	return exists
+}
+
+// Values returns an unordered slice containing all the values in the set.
+func (s Set[T]) Values() []T {
+	result := make([]T, 0, len(s))
+	for value := range s {
+		result = append(result, value)
+	}
+	return result
+}
+
+// Union returns a new Set representing a union of the elements in the
+// method target and the parameter.
+func (s Set[T]) Union(other Set[T]) Set[T] {
+	result := make(Set[T], len(s)+len(other))
+	for value := range s {
+		result[value] = struct{}{}
+	}
+	for value := range other {
+		result[value] = struct{}{}
+	}
+	return result
+}
+
+// Intersection returns a new Set representing an intersection of the
+// elements in the method target and the parameter.
+func (s Set[T]) Intersection(other Set[T]) Set[T] {
+	result := make(Set[T])
+	for value := range s {
+		if other.Contains(value) {
+			result[value] = struct{}{}
+		}
+	}
+	return result
+}
+
+// Difference returns a new Set representing all the values in the
+// target that are not in the parameter.
+func (s Set[T]) Difference(other Set[T]) Set[T] {
+	result := make(Set[T])
+	for value := range s {
+		if !other.Contains(value) {
+			result[value] = struct{}{}
+		}
+	}
+	return result
+}
+
+// IsSubset reports whether every value in the target
+// is also in the parameter.
+func (s Set[T]) IsSubset(other Set[T]) bool {
+	if len(s) > len(other) {
+		return false
+	}
+	for value := range s {
+		if !other.Contains(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Equal reports whether the target and the parameter
+// hold the same values.
+func (s Set[T]) Equal(other Set[T]) bool {
+	return len(s) == len(other) && s.IsSubset(other)
+}
+
+// Any reports whether f returns true for any value in the set.
+func (s Set[T]) Any(f func(T) bool) bool {
+	for value := range s {
+		if f(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// All reports whether f returns true for every value in the set.
+// It returns true for an empty set.
+func (s Set[T]) All(f func(T) bool) bool {
+	for value := range s {
+		if !f(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Filter returns a new Set holding the values
+// for which f returns true.
+func (s Set[T]) Filter(f func(T) bool) Set[T] {
+	result := make(Set[T])
+	for value := range s {
+		if f(value) {
+			result[value] = struct{}{}
+		}
+	}
+	return result
+}
+
+// Ordered is satisfied by the types whose values
+// can be ordered with the < operator.
+type Ordered interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64 | ~string
+}
+
+// Sorted returns an ordered slice containing all the values in s.
+func Sorted[T Ordered](s Set[T]) []T {
+	values := s.Values()
+	sort.Slice(values, func(i, j int) bool {
+		return values[i] < values[j]
+	})
+	return values
+}
+
+// MarshalJSON implements json.Marshaler. The set is marshalled as an
+// array. So that the output is deterministic, the elements are sorted
+// by their JSON encoding.
+func (s Set[T]) MarshalJSON() ([]byte, error) {
+	elems := make([][]byte, 0, len(s))
+	for value := range s {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, data)
+	}
+	sort.Slice(elems, func(i, j int) bool {
+		return bytes.Compare(elems[i], elems[j]) < 0
+	})
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	buf.Write(bytes.Join(elems, []byte(",")))
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It accepts an array
+// of values; duplicate values are ignored.
+func (s *Set[T]) UnmarshalJSON(data []byte) error {
+	var values []T
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	*s = New(values...)
+	return nil
+}
+
+// Strings is a Set of strings.
+type Strings = Set[string]
+
+// NewStrings creates and initializes a Strings and populates it with
+// initial values as specified in the parameters.
+func NewStrings(initial ...string) Strings {
+	return New(initial...)
+}
+
+// Ints is a Set of ints.
+type Ints = Set[int]
+
+// NewInts creates and initializes an Ints and populates it with
+// initial values as specified in the parameters.
+func NewInts(initial ...int) Ints {
+	return New(initial...)
+}
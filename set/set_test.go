@@ -0,0 +1,101 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package set_test
+
+import (
+	"encoding/json"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/set"
+)
+
+type setSuite struct{}
+
+var _ = gc.Suite(&setSuite{})
+
+func (setSuite) TestEmpty(c *gc.C) {
+	s := set.New[string]()
+	c.Check(s.Size(), gc.Equals, 0)
+	c.Check(s.IsEmpty(), jc.IsTrue)
+	c.Check(s.Values(), gc.HasLen, 0)
+
+	var zero set.Set[int]
+	c.Check(zero.IsEmpty(), jc.IsTrue)
+	c.Check(zero.Contains(1), jc.IsFalse)
+	c.Check(func() { zero.Add(1) }, gc.PanicMatches, "uninitalised set")
+}
+
+func (setSuite) TestAddRemoveContains(c *gc.C) {
+	s := set.New(1, 2, 2, 3)
+	c.Check(s.Size(), gc.Equals, 3)
+	c.Check(s.Contains(2), jc.IsTrue)
+	s.Remove(2)
+	s.Remove(42)
+	c.Check(s.Contains(2), jc.IsFalse)
+	s.Add(4)
+	c.Check(set.Sorted(s), jc.DeepEquals, []int{1, 3, 4})
+}
+
+func (setSuite) TestSetOperations(c *gc.C) {
+	a := set.NewStrings("foo", "bar", "baz")
+	b := set.NewStrings("bar", "qux")
+
+	c.Check(set.Sorted(a.Union(b)), jc.DeepEquals, []string{"bar", "baz", "foo", "qux"})
+	c.Check(set.Sorted(a.Intersection(b)), jc.DeepEquals, []string{"bar"})
+	c.Check(set.Sorted(a.Difference(b)), jc.DeepEquals, []string{"baz", "foo"})
+	// The operands are unchanged.
+	c.Check(a.Size(), gc.Equals, 3)
+	c.Check(b.Size(), gc.Equals, 2)
+}
+
+func (setSuite) TestSubsetAndEqual(c *gc.C) {
+	a := set.NewInts(1, 2)
+	b := set.NewInts(1, 2, 3)
+	c.Check(a.IsSubset(b), jc.IsTrue)
+	c.Check(b.IsSubset(a), jc.IsFalse)
+	c.Check(a.Equal(b), jc.IsFalse)
+	c.Check(a.Equal(set.NewInts(2, 1)), jc.IsTrue)
+	c.Check(set.NewInts().IsSubset(a), jc.IsTrue)
+}
+
+func (setSuite) TestPredicates(c *gc.C) {
+	s := set.NewInts(1, 2, 3, 4)
+	even := func(n int) bool { return n%2 == 0 }
+	c.Check(s.Any(even), jc.IsTrue)
+	c.Check(s.All(even), jc.IsFalse)
+	c.Check(set.NewInts().All(even), jc.IsTrue)
+	c.Check(set.Sorted(s.Filter(even)), jc.DeepEquals, []int{2, 4})
+}
+
+type point struct {
+	X, Y int
+}
+
+func (setSuite) TestStructValues(c *gc.C) {
+	s := set.New(point{1, 2}, point{3, 4}, point{1, 2})
+	c.Check(s.Size(), gc.Equals, 2)
+	c.Check(s.Contains(point{3, 4}), jc.IsTrue)
+}
+
+func (setSuite) TestJSON(c *gc.C) {
+	data, err := json.Marshal(set.NewStrings("b", "c", "a"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(data), gc.Equals, `["a","b","c"]`)
+
+	data, err = json.Marshal(set.New(point{3, 4}, point{1, 2}))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(data), gc.Equals, `[{"X":1,"Y":2},{"X":3,"Y":4}]`)
+
+	var doc struct {
+		Names set.Strings `json:"names"`
+	}
+	err = json.Unmarshal([]byte(`{"names":["x","y","x"]}`), &doc)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(doc.Names.Equal(set.NewStrings("x", "y")), jc.IsTrue)
+
+	err = json.Unmarshal([]byte(`{"names":[1]}`), &doc)
+	c.Check(err, gc.NotNil)
+}
@@ -0,0 +1,712 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package shell
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/juju/errors"
+)
+
+// LintCheck identifies the check that produced a LintWarning.
+type LintCheck string
+
+const (
+	// CheckQuotes reports quotes, substitutions and here-documents
+	// that are not terminated.
+	CheckQuotes LintCheck = "quotes"
+
+	// CheckUnquotedExpansion reports expansions in bash scripts that
+	// are subject to word splitting and globbing because they are
+	// not quoted.
+	CheckUnquotedExpansion LintCheck = "unquoted-expansion"
+
+	// CheckLineEndings reports line endings that are wrong for the
+	// shell, such as carriage returns in bash scripts.
+	CheckLineEndings LintCheck = "line-endings"
+)
+
+// LintWarning describes a likely problem found in a script.
+type LintWarning struct {
+	// Line and Column hold the position of the problem in the
+	// rendered script, starting at 1. Column counts characters.
+	Line   int
+	Column int
+
+	// Check identifies the check that found the problem.
+	Check LintCheck
+
+	// Message describes the problem.
+	Message string
+}
+
+// String implements fmt.Stringer.
+func (w LintWarning) String() string {
+	return fmt.Sprintf("%d:%d: %s: %s", w.Line, w.Column, w.Check, w.Message)
+}
+
+// LintScript renders the given commands as a script with renderer and
+// checks the result for likely problems, such as unbalanced quotes,
+// returning a warning for each one found in order of position. It
+// returns an error if scripts for the renderer's shell cannot be
+// checked.
+//
+// The checks are heuristic; a script without warnings may still be
+// wrong, and some warnings, such as for unquoted expansions, may be
+// intended.
+func LintScript(renderer ScriptRenderer, commands []string) ([]LintWarning, error) {
+	script := string(renderer.RenderScript(commands))
+	l := newLinter(script)
+	switch renderer.(type) {
+	case *BashRenderer:
+		l.checkUnixLineEndings()
+		s := &bashScanner{linter: l}
+		s.scan()
+	case *PowershellRenderer:
+		l.checkMixedLineEndings()
+		l.lintPowershell()
+	case *WinCmdRenderer:
+		l.checkMixedLineEndings()
+		l.lintWinCmd()
+	default:
+		return nil, errors.NotSupportedf("linting scripts for %T", renderer)
+	}
+	sort.SliceStable(l.warnings, func(i, j int) bool {
+		a, b := l.warnings[i], l.warnings[j]
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	return l.warnings, nil
+}
+
+// linter holds a script being checked and the warnings found.
+type linter struct {
+	src        string
+	lineStarts []int
+	warnings   []LintWarning
+}
+
+func newLinter(src string) *linter {
+	l := &linter{
+		src:        src,
+		lineStarts: []int{0},
+	}
+	for i := 0; i < len(src); i++ {
+		if src[i] == '\n' {
+			l.lineStarts = append(l.lineStarts, i+1)
+		}
+	}
+	return l
+}
+
+// warn adds a warning for the given offset in the script.
+func (l *linter) warn(offset int, check LintCheck, format string, args ...interface{}) {
+	line := sort.Search(len(l.lineStarts), func(i int) bool {
+		return l.lineStarts[i] > offset
+	})
+	col := utf8.RuneCountInString(l.src[l.lineStarts[line-1]:offset]) + 1
+	l.warnings = append(l.warnings, LintWarning{
+		Line:    line,
+		Column:  col,
+		Check:   check,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// checkUnixLineEndings warns of each carriage return, which a Unix
+// shell treats as part of a command or argument.
+func (l *linter) checkUnixLineEndings() {
+	for i := 0; i < len(l.src); i++ {
+		if l.src[i] != '\r' {
+			continue
+		}
+		if i+1 == len(l.src) || l.src[i+1] == '\n' {
+			l.warn(i, CheckLineEndings, "CRLF line ending; the carriage return will be treated as part of the command")
+		} else {
+			l.warn(i, CheckLineEndings, "carriage return in line")
+		}
+	}
+}
+
+// checkMixedLineEndings warns if lines end with both CRLF and LF,
+// which usually means that content from different systems has been
+// combined.
+func (l *linter) checkMixedLineEndings() {
+	crlf, lf := -1, -1
+	for i := 0; i < len(l.src); i++ {
+		if l.src[i] != '\n' {
+			continue
+		}
+		if i > 0 && l.src[i-1] == '\r' {
+			if crlf < 0 {
+				crlf = i - 1
+			}
+		} else if lf < 0 {
+			lf = i
+		}
+	}
+	if crlf >= 0 && lf >= 0 {
+		// Report the first line that differs from those before it.
+		offset := crlf
+		if lf > offset {
+			offset = lf
+		}
+		l.warn(offset, CheckLineEndings, "mixed CRLF and LF line endings")
+	}
+}
+
+// lintPowershell checks that the strings, here-strings and block
+// comments of a PowerShell script are terminated.
+func (l *linter) lintPowershell() {
+	src := l.src
+	for i := 0; i < len(src); i++ {
+		switch c := src[i]; {
+		case c == '`':
+			i++
+		case c == '#':
+			i = indexFrom(src, i, "\n")
+		case strings.HasPrefix(src[i:], "<#"):
+			end := strings.Index(src[i+2:], "#>")
+			if end < 0 {
+				l.warn(i, CheckQuotes, "unterminated block comment")
+				return
+			}
+			i += end + 3
+		case strings.HasPrefix(src[i:], "@'\n"), strings.HasPrefix(src[i:], "@'\r\n"),
+			strings.HasPrefix(src[i:], "@\"\n"), strings.HasPrefix(src[i:], "@\"\r\n"):
+			end := regexp.MustCompile(`(?m)^` + regexp.QuoteMeta(src[i+1:i+2]) + `@`).FindStringIndex(src[i+2:])
+			if end == nil {
+				l.warn(i, CheckQuotes, "unterminated here-string")
+				return
+			}
+			i += 2 + end[1] - 1
+		case c == '\'':
+			end := i + 1
+			for ; end < len(src); end++ {
+				if src[end] == '\'' {
+					if end+1 < len(src) && src[end+1] == '\'' {
+						end++
+						continue
+					}
+					break
+				}
+			}
+			if end >= len(src) {
+				l.warn(i, CheckQuotes, "unterminated single-quoted string")
+				return
+			}
+			i = end
+		case c == '"':
+			end := i + 1
+			for ; end < len(src); end++ {
+				if src[end] == '`' {
+					end++
+					continue
+				}
+				if src[end] == '"' {
+					if end+1 < len(src) && src[end+1] == '"' {
+						end++
+						continue
+					}
+					break
+				}
+			}
+			if end >= len(src) {
+				l.warn(i, CheckQuotes, "unterminated double-quoted string")
+				return
+			}
+			i = end
+		}
+	}
+}
+
+// lintWinCmd checks that each line of a batch file has balanced
+// double quotes, as cmd quotes do not span lines.
+func (l *linter) lintWinCmd() {
+	for n, start := range l.lineStarts {
+		end := len(l.src)
+		if n+1 < len(l.lineStarts) {
+			end = l.lineStarts[n+1]
+		}
+		line := l.src[start:end]
+		if strings.HasPrefix(strings.ToLower(strings.TrimSpace(line)), "rem ") {
+			continue
+		}
+		open := -1
+		for i := 0; i < len(line); i++ {
+			switch {
+			case line[i] == '^' && open < 0:
+				i++
+			case line[i] == '"' && open < 0:
+				open = i
+			case line[i] == '"':
+				open = -1
+			}
+		}
+		if open >= 0 {
+			l.warn(start+open, CheckQuotes, "unterminated double quote")
+		}
+	}
+}
+
+// indexFrom returns the index of the first occurrence of substr in s
+// at or after from, or len(s) if there is none.
+func indexFrom(s string, from int, substr string) int {
+	if i := strings.Index(s[from:], substr); i >= 0 {
+		return from + i
+	}
+	return len(s)
+}
+
+// bashScanner scans a bash script sufficiently to find unterminated
+// quotes and unquoted expansions. It does not attempt to parse the
+// full bash grammar.
+type bashScanner struct {
+	*linter
+	i int
+
+	// heredocs holds the here-documents whose bodies
+	// start after the next newline.
+	heredocs []heredoc
+
+	// lastExpansion and lastExpansionKind hold the offset and
+	// description of the last expansion scanned.
+	lastExpansion     int
+	lastExpansionKind string
+}
+
+type heredoc struct {
+	offset    int
+	delimiter string
+	stripTabs bool
+}
+
+// bashCommand holds the state of the simple command being scanned.
+type bashCommand struct {
+	// words holds the number of words completed.
+	words int
+
+	// first and prev hold the first and previous words.
+	first, prev string
+
+	// assignments is true while the words completed may be
+	// followed by assignments.
+	assignments bool
+
+	// inTest is true within [[ ]], where words are not split.
+	inTest bool
+}
+
+func newBashCommand() bashCommand {
+	return bashCommand{assignments: true}
+}
+
+// bashKeywords holds the reserved words that may precede a command.
+var bashKeywords = map[string]bool{
+	"!":     true,
+	"{":     true,
+	"do":    true,
+	"elif":  true,
+	"else":  true,
+	"if":    true,
+	"then":  true,
+	"time":  true,
+	"until": true,
+	"while": true,
+}
+
+// declarationBuiltins hold the builtins whose assignment
+// arguments are not subject to word splitting.
+var declarationBuiltins = map[string]bool{
+	"declare":  true,
+	"export":   true,
+	"local":    true,
+	"readonly": true,
+	"typeset":  true,
+}
+
+var (
+	assignmentPrefix = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\[[^]]*\])?\+?=`)
+	bashNameChars    = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789_"
+)
+
+func (s *bashScanner) scan() {
+	if !s.scanCommands(0, 0) {
+		return
+	}
+	for _, h := range s.heredocs {
+		s.warn(h.offset, CheckQuotes, "unterminated here-document (expected %q)", h.delimiter)
+	}
+}
+
+// scanCommands scans commands until the given terminating character,
+// which is zero at the top level, ')' for a command substitution
+// starting at the given offset or '`' for a backquoted one. It
+// returns false if scanning had to stop because of an unterminated
+// construct.
+func (s *bashScanner) scanCommands(offset int, end byte) bool {
+	src := s.src
+	cmd := newBashCommand()
+	wordStart := -1
+	depth := 0
+	cases := 0
+	endWord := func() {
+		if wordStart < 0 {
+			return
+		}
+		word := src[wordStart:s.i]
+		wordStart = -1
+		switch {
+		case cmd.words == 0 && word == "[[":
+			cmd.inTest = true
+		case word == "]]":
+			cmd.inTest = false
+		case cmd.words == 0 && word == "case":
+			cases++
+		case cmd.words == 0 && word == "esac" && cases > 0:
+			cases--
+		case cmd.words == 0 && bashKeywords[word]:
+			// The command starts after the keyword.
+			return
+		}
+		if cmd.words == 0 {
+			cmd.first = word
+		}
+		if !assignmentPrefix.MatchString(word) && !(cmd.words == 0 && declarationBuiltins[word]) {
+			cmd.assignments = false
+		}
+		cmd.prev = word
+		cmd.words++
+	}
+	endCommand := func() {
+		endWord()
+		cmd = newBashCommand()
+	}
+	// safe reports whether an expansion at the
+	// current position is not subject to splitting.
+	safe := func() bool {
+		if cmd.inTest || cmd.prev == "case" && cmd.words == 1 {
+			return true
+		}
+		return wordStart >= 0 && cmd.assignments && assignmentPrefix.MatchString(src[wordStart:s.i])
+	}
+	for s.i < len(src) {
+		c := src[s.i]
+		if end != 0 && c == end && depth == 0 {
+			// Complete any "esac" before checking whether
+			// the parenthesis ends a case pattern.
+			endWord()
+			if end != ')' || cases == 0 {
+				s.i++
+				return true
+			}
+		}
+		switch c {
+		case ' ', '\t', '\r':
+			endWord()
+			s.i++
+			continue
+		case '\n':
+			endCommand()
+			s.i++
+			if !s.scanHeredocs() {
+				return false
+			}
+			continue
+		case ';', '&', '|':
+			if strings.HasPrefix(src[s.i:], "&>") {
+				// Redirection of both stdout and stderr.
+				endWord()
+				s.i += 2
+				continue
+			}
+			endCommand()
+			s.i++
+			continue
+		case '(':
+			// As in bash, "((" that does not start an arithmetic
+			// command starts nested subshells.
+			if wordStart < 0 && strings.HasPrefix(src[s.i:], "((") && cmd.words == 0 && s.skipArithmetic(s.i, 2) {
+				continue
+			}
+			endCommand()
+			depth++
+			s.i++
+			continue
+		case ')':
+			endCommand()
+			if depth > 0 {
+				depth--
+			}
+			s.i++
+			continue
+		case '#':
+			if wordStart < 0 {
+				s.i = indexFrom(src, s.i, "\n")
+				continue
+			}
+		case '<', '>':
+			endWord()
+			if strings.HasPrefix(src[s.i:], "<<<") {
+				s.i += 3
+				continue
+			}
+			if strings.HasPrefix(src[s.i:], "<<") {
+				s.readHeredocDelimiter()
+				continue
+			}
+			s.i++
+			if s.i < len(src) && strings.IndexByte("&>|", src[s.i]) >= 0 {
+				s.i++
+			}
+			continue
+		}
+		if wordStart < 0 {
+			wordStart = s.i
+		}
+		switch c {
+		case '\\':
+			s.i += 2
+		case '\'':
+			if !s.skipSingleQuoted(s.i, 1) {
+				return false
+			}
+		case '"':
+			if !s.scanDoubleQuoted() {
+				return false
+			}
+		case '`':
+			start := s.i
+			s.i++
+			if !s.scanCommands(start, '`') {
+				return false
+			}
+			if !safe() {
+				s.warn(start, CheckUnquotedExpansion, "unquoted command substitution is subject to word splitting and globbing")
+			}
+		case '$':
+			ok, splittable := s.scanExpansion(false)
+			if !ok {
+				return false
+			}
+			if splittable && !safe() {
+				s.warn(s.lastExpansion, CheckUnquotedExpansion, "unquoted %s is subject to word splitting and globbing", s.lastExpansionKind)
+			}
+		default:
+			s.i++
+		}
+	}
+	switch end {
+	case ')':
+		s.warn(offset, CheckQuotes, "unterminated command substitution")
+		return false
+	case '`':
+		s.warn(offset, CheckQuotes, "unterminated backquoted command substitution")
+		return false
+	}
+	return true
+}
+
+// scanDoubleQuoted scans a double-quoted string starting at the
+// current position.
+func (s *bashScanner) scanDoubleQuoted() bool {
+	start := s.i
+	s.i++
+	for s.i < len(s.src) {
+		switch s.src[s.i] {
+		case '"':
+			s.i++
+			return true
+		case '\\':
+			s.i += 2
+		case '`':
+			s.i++
+			if !s.scanCommands(s.i-1, '`') {
+				return false
+			}
+		case '$':
+			if ok, _ := s.scanExpansion(true); !ok {
+				return false
+			}
+		default:
+			s.i++
+		}
+	}
+	s.warn(start, CheckQuotes, "unterminated double quote")
+	return false
+}
+
+// skipSingleQuoted skips a single-quoted string starting at offset,
+// after an opening sequence of the given length. Backslashes escape
+// quotes in $'...' strings.
+func (s *bashScanner) skipSingleQuoted(offset, open int) bool {
+	escapes := open == 2
+	for i := offset + open; i < len(s.src); i++ {
+		switch {
+		case escapes && s.src[i] == '\\':
+			i++
+		case s.src[i] == '\'':
+			s.i = i + 1
+			return true
+		}
+	}
+	s.warn(offset, CheckQuotes, "unterminated single quote")
+	return false
+}
+
+// skipArithmetic skips an arithmetic expression starting at offset
+// after an opening sequence of the given length, ending with "))".
+// It returns false if the expression is not terminated.
+func (s *bashScanner) skipArithmetic(offset, open int) bool {
+	depth := 0
+	for i := offset + open; i < len(s.src); i++ {
+		switch s.src[i] {
+		case '(':
+			depth++
+		case ')':
+			if depth > 0 {
+				depth--
+				continue
+			}
+			if strings.HasPrefix(s.src[i:], "))") {
+				s.i = i + 2
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// scanExpansion scans an expansion starting with '$' at the current
+// position, which is within double quotes if quoted is true. It
+// returns whether the expansion was terminated and whether its result
+// would be split if not quoted. If so, it sets lastExpansion and
+// lastExpansionKind to describe it.
+func (s *bashScanner) scanExpansion(quoted bool) (ok, splittable bool) {
+	src := s.src
+	offset := s.i
+	s.lastExpansion = offset
+	rest := src[offset+1:]
+	switch {
+	case strings.HasPrefix(rest, "'") && !quoted:
+		return s.skipSingleQuoted(offset, 2), false
+	case strings.HasPrefix(rest, `"`) && !quoted:
+		s.i++
+		return s.scanDoubleQuoted(), false
+	case strings.HasPrefix(rest, "(("):
+		if !s.skipArithmetic(offset, 3) {
+			s.warn(offset, CheckQuotes, "unterminated arithmetic expression")
+			return false, false
+		}
+		return true, false
+	case strings.HasPrefix(rest, "("):
+		s.i += 2
+		if !s.scanCommands(offset, ')') {
+			return false, false
+		}
+		s.lastExpansion = offset
+		s.lastExpansionKind = "command substitution"
+		return true, true
+	case strings.HasPrefix(rest, "{"):
+		depth := 0
+		for i := offset + 2; i < len(src); i++ {
+			switch src[i] {
+			case '\\':
+				i++
+			case '{':
+				depth++
+			case '}':
+				if depth > 0 {
+					depth--
+					continue
+				}
+				s.i = i + 1
+				name := src[offset+2 : i]
+				s.lastExpansionKind = fmt.Sprintf("variable ${%s}", name)
+				// ${#name} expands to a length.
+				return true, !strings.HasPrefix(name, "#") || name == "#"
+			}
+		}
+		s.warn(offset, CheckQuotes, "unterminated parameter expansion")
+		return false, false
+	}
+	s.i++
+	if len(rest) == 0 {
+		return true, false
+	}
+	switch c := rest[0]; {
+	case strings.IndexByte("?#$!-", c) >= 0:
+		// These expand to numbers or option letters.
+		s.i++
+		return true, false
+	case strings.IndexByte("@*0123456789", c) >= 0:
+		s.i++
+		s.lastExpansionKind = "variable $" + string(c)
+		return true, true
+	}
+	n := 0
+	for n < len(rest) && strings.IndexByte(bashNameChars, rest[n]) >= 0 {
+		n++
+	}
+	if n == 0 {
+		// A literal dollar sign.
+		return true, false
+	}
+	s.i += n
+	s.lastExpansionKind = "variable $" + rest[:n]
+	return true, true
+}
+
+// readHeredocDelimiter reads the delimiter of a here-document
+// starting with "<<" at the current position.
+func (s *bashScanner) readHeredocDelimiter() {
+	offset := s.i
+	s.i += 2
+	h := heredoc{offset: offset}
+	if s.i < len(s.src) && s.src[s.i] == '-' {
+		h.stripTabs = true
+		s.i++
+	}
+	for s.i < len(s.src) && (s.src[s.i] == ' ' || s.src[s.i] == '\t') {
+		s.i++
+	}
+	start := s.i
+	for s.i < len(s.src) && strings.IndexByte(" \t\r\n;&|<>()", s.src[s.i]) < 0 {
+		s.i++
+	}
+	h.delimiter = strings.NewReplacer(`'`, "", `"`, "", `\`, "").Replace(s.src[start:s.i])
+	if h.delimiter != "" {
+		s.heredocs = append(s.heredocs, h)
+	}
+}
+
+// scanHeredocs skips the bodies of any here-documents starting at
+// the current position, which follows a newline.
+func (s *bashScanner) scanHeredocs() bool {
+	for len(s.heredocs) > 0 {
+		h := s.heredocs[0]
+		for {
+			if s.i >= len(s.src) {
+				s.warn(h.offset, CheckQuotes, "unterminated here-document (expected %q)", h.delimiter)
+				s.heredocs = nil
+				return false
+			}
+			end := indexFrom(s.src, s.i, "\n")
+			line := s.src[s.i:end]
+			s.i = end + 1
+			line = strings.TrimSuffix(line, "\r")
+			if h.stripTabs {
+				line = strings.TrimLeft(line, "\t")
+			}
+			if line == h.delimiter {
+				break
+			}
+		}
+		s.heredocs = s.heredocs[1:]
+	}
+	return true
+}
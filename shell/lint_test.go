@@ -0,0 +1,158 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package shell_test
+
+import (
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/shell"
+)
+
+type lintSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&lintSuite{})
+
+// lint returns the warnings for the given commands as strings. Bash
+// scripts start with two lines added by the renderer.
+func lint(c *gc.C, renderer shell.ScriptRenderer, commands ...string) []string {
+	warnings, err := shell.LintScript(renderer, commands)
+	c.Assert(err, jc.ErrorIsNil)
+	var result []string
+	for _, w := range warnings {
+		result = append(result, w.String())
+	}
+	return result
+}
+
+func (*lintSuite) TestBashClean(c *gc.C) {
+	c.Check(lint(c, &shell.BashRenderer{},
+		`set -e`,
+		`# don't worry about "quotes" in comments`,
+		`name="$1"`,
+		`dir=$(dirname "$0")`,
+		`export PATH=$PATH:/snap/bin`,
+		`local count=${#items[@]}`,
+		`echo "hello ${name:-world}" 'single $quoted' $'it\'s' >&2`,
+		`echo "nested $(basename "$dir")" "$(( $# + 1 ))" $? $$`,
+		`if [[ $name == x* ]]; then echo yes; fi`,
+		`case $name in`,
+		`  a|b) echo "$name";;`,
+		`esac`,
+		`(( count++ ))`,
+		`cat > /etc/config <<-'EOF'`,
+		"\t$literal 'unbalanced",
+		"\tEOF",
+		`cat <<EOF`,
+		`it's "fine"`,
+		`EOF`,
+		`x=$(case $name in a) echo "a";; esac)`,
+		`((echo "nested") | cat)`,
+		`echo costs \$5 and \"quotes\" 2>&1 | tee "$dir/log"`,
+	), gc.HasLen, 0)
+}
+
+func (*lintSuite) TestBashUnterminatedQuotes(c *gc.C) {
+	for _, test := range []struct {
+		command  string
+		expected string
+	}{{
+		command:  `echo 'it's here'`,
+		expected: `3:16: quotes: unterminated single quote`,
+	}, {
+		command:  `echo "hello`,
+		expected: `3:6: quotes: unterminated double quote`,
+	}, {
+		command:  `echo $(ls "x"`,
+		expected: `3:6: quotes: unterminated command substitution`,
+	}, {
+		command:  "echo `ls",
+		expected: "3:6: quotes: unterminated backquoted command substitution",
+	}, {
+		command:  `echo "${name"`,
+		expected: `3:7: quotes: unterminated parameter expansion`,
+	}, {
+		command:  `echo $(( 1 + 2 )`,
+		expected: `3:6: quotes: unterminated arithmetic expression`,
+	}, {
+		command:  "cat <<EOF\nhello\nEOF ",
+		expected: `3:5: quotes: unterminated here-document (expected "EOF")`,
+	}} {
+		c.Logf("command %q", test.command)
+		c.Check(lint(c, &shell.BashRenderer{}, test.command), jc.DeepEquals, []string{test.expected})
+	}
+}
+
+func (*lintSuite) TestBashUnquotedExpansions(c *gc.C) {
+	c.Check(lint(c, &shell.BashRenderer{},
+		`rm -rf $dir/cache`,
+		`cp ${src} "$dst"`,
+		"for f in `ls`; do echo $f; done",
+		`echo $(date) $@ $1`,
+		`echo x=$y`,
+	), jc.DeepEquals, []string{
+		`3:8: unquoted-expansion: unquoted variable $dir is subject to word splitting and globbing`,
+		`4:4: unquoted-expansion: unquoted variable ${src} is subject to word splitting and globbing`,
+		"5:10: unquoted-expansion: unquoted command substitution is subject to word splitting and globbing",
+		`5:24: unquoted-expansion: unquoted variable $f is subject to word splitting and globbing`,
+		`6:6: unquoted-expansion: unquoted command substitution is subject to word splitting and globbing`,
+		`6:14: unquoted-expansion: unquoted variable $@ is subject to word splitting and globbing`,
+		`6:17: unquoted-expansion: unquoted variable $1 is subject to word splitting and globbing`,
+		`7:8: unquoted-expansion: unquoted variable $y is subject to word splitting and globbing`,
+	})
+}
+
+func (*lintSuite) TestBashLineEndings(c *gc.C) {
+	c.Check(lint(c, &shell.BashRenderer{}, "echo one\r", "echo two\rthree"), jc.DeepEquals, []string{
+		`3:9: line-endings: CRLF line ending; the carriage return will be treated as part of the command`,
+		`4:9: line-endings: carriage return in line`,
+	})
+}
+
+func (*lintSuite) TestPowershell(c *gc.C) {
+	c.Check(lint(c, &shell.PowershellRenderer{},
+		`$name = 'it''s'`,
+		"Write-Host \"say `\"hi`\" to $name\" # it's a comment",
+		`<# a "block`,
+		`comment #>`,
+		`$text = @'`,
+		`it's "raw"`,
+		`'@`,
+	), gc.HasLen, 0)
+
+	c.Check(lint(c, &shell.PowershellRenderer{}, `Write-Host "hello`), jc.DeepEquals, []string{
+		`1:12: quotes: unterminated double-quoted string`,
+	})
+	c.Check(lint(c, &shell.PowershellRenderer{}, `$x = @"`, `text`), jc.DeepEquals, []string{
+		`1:6: quotes: unterminated here-string`,
+	})
+	c.Check(lint(c, &shell.PowershellRenderer{}, "echo one\r", "echo two", "echo three"), jc.DeepEquals, []string{
+		`2:9: line-endings: mixed CRLF and LF line endings`,
+	})
+}
+
+func (*lintSuite) TestWinCmd(c *gc.C) {
+	c.Check(lint(c, &shell.WinCmdRenderer{},
+		`echo "hello" ^"world`,
+		`rem it's "unbalanced`,
+		`echo "unbalanced`,
+	), jc.DeepEquals, []string{
+		`3:6: quotes: unterminated double quote`,
+	})
+}
+
+type otherRenderer struct{}
+
+func (otherRenderer) RenderScript(commands []string) []byte {
+	return nil
+}
+
+func (*lintSuite) TestUnsupportedRenderer(c *gc.C) {
+	_, err := shell.LintScript(otherRenderer{}, nil)
+	c.Assert(err, jc.Satisfies, errors.IsNotSupported)
+}
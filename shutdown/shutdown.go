@@ -0,0 +1,214 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package shutdown coordinates the orderly shutdown of a process.
+// Components register cleanup hooks with a Manager, which runs them
+// in order when shutdown is triggered, either programmatically or by
+// a signal, and reports every hook that failed.
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/juju/clock"
+
+	"github.com/juju/utils/v3/multierror"
+	"github.com/juju/utils/v3/panics"
+	"github.com/juju/utils/v3/parallel"
+	"github.com/juju/utils/v3/signals"
+)
+
+// ErrShuttingDown is returned by Manager.Register once shutdown
+// has started.
+var ErrShuttingDown = errors.New("shutdown in progress")
+
+// Hook describes a cleanup function to be run at shutdown.
+type Hook struct {
+	// Name identifies the hook in errors.
+	Name string
+
+	// Order determines when the hook runs relative to others.
+	// Hooks with lower Order run first. Hooks with the same Order
+	// run in the reverse of the order they were registered, as
+	// deferred calls do.
+	Order int
+
+	// Timeout, if positive, limits how long the hook may run. The
+	// context passed to Func is cancelled when the timeout expires,
+	// and shutdown moves on to the next hook without waiting for
+	// Func to return.
+	Timeout time.Duration
+
+	// Func is the cleanup function.
+	Func func(ctx context.Context) error
+}
+
+// Manager runs registered hooks when shutdown is triggered.
+// The zero value is not usable; use NewManager.
+type Manager struct {
+	clock clock.Clock
+
+	mu      sync.Mutex
+	hooks   []Hook
+	started bool
+	done    chan struct{}
+	err     error
+}
+
+// NewManager returns a new Manager. If clk is nil, the wall clock is
+// used to enforce hook timeouts.
+func NewManager(clk clock.Clock) *Manager {
+	if clk == nil {
+		clk = clock.WallClock
+	}
+	return &Manager{
+		clock: clk,
+		done:  make(chan struct{}),
+	}
+}
+
+// Register adds a hook to be run at shutdown. It returns
+// ErrShuttingDown if shutdown has already started.
+func (m *Manager) Register(h Hook) error {
+	if h.Func == nil {
+		return fmt.Errorf("hook %q has no function", h.Name)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.started {
+		return ErrShuttingDown
+	}
+	m.hooks = append(m.hooks, h)
+	return nil
+}
+
+// Shutdown runs all the registered hooks in order and waits for them
+// to finish. All hooks are run even if some fail; the returned error
+// is a parallel.Errors value holding the error from each failed hook,
+// or nil if all succeeded. If ctx is done before all the hooks have
+// run, the remaining hooks are skipped and reported as failed.
+//
+// Only the first call runs the hooks; later calls wait for the first
+// to finish and return the same error.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	if m.started {
+		m.mu.Unlock()
+		return m.Wait()
+	}
+	m.started = true
+	hooks := m.hooks
+	m.hooks = nil
+	m.mu.Unlock()
+
+	// Reverse first so that the stable sort leaves hooks with
+	// the same order in reverse registration order.
+	for i, j := 0, len(hooks)-1; i < j; i, j = i+1, j-1 {
+		hooks[i], hooks[j] = hooks[j], hooks[i]
+	}
+	sort.SliceStable(hooks, func(i, j int) bool {
+		return hooks[i].Order < hooks[j].Order
+	})
+
+	var errs parallel.Errors
+	for _, h := range hooks {
+		if err := m.runHook(ctx, h); err != nil {
+			errs = append(errs, multierror.WithContext(err, fmt.Sprintf("hook %q", h.Name)))
+		}
+	}
+	var err error
+	if len(errs) > 0 {
+		err = errs
+	}
+	m.mu.Lock()
+	m.err = err
+	m.mu.Unlock()
+	close(m.done)
+	return err
+}
+
+func (m *Manager) runHook(ctx context.Context, h Hook) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	result := make(chan error, 1)
+	go func() {
+		result <- panics.Call(func() error {
+			return h.Func(ctx)
+		})
+	}()
+	var timeout <-chan time.Time
+	if h.Timeout > 0 {
+		timeout = m.clock.After(h.Timeout)
+	}
+	select {
+	case err := <-result:
+		return err
+	case <-timeout:
+		return fmt.Errorf("timed out after %v", h.Timeout)
+	case <-ctx.Done():
+		// The hook may have finished at the same time.
+		select {
+		case err := <-result:
+			return err
+		default:
+			return ctx.Err()
+		}
+	}
+}
+
+// Done returns a channel that is closed when shutdown has finished.
+func (m *Manager) Done() <-chan struct{} {
+	return m.done
+}
+
+// Wait waits for shutdown to finish and returns the same error
+// as Shutdown.
+func (m *Manager) Wait() error {
+	<-m.done
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.err
+}
+
+// TriggerOnSignal starts shutdown, as if Shutdown had been called
+// with ctx, when the process receives one of the given signals. If
+// no signals are given, os.Interrupt and SIGTERM are used. The
+// signals are received through the process's default signal hub.
+// The returned function stops listening for the signals.
+func (m *Manager) TriggerOnSignal(ctx context.Context, sig ...os.Signal) (stop func()) {
+	stop, err := m.TriggerOnHub(ctx, signals.Default(), sig...)
+	if err != nil {
+		// The default hub is never closed.
+		panic(err)
+	}
+	return stop
+}
+
+// TriggerOnHub is like TriggerOnSignal except that it
+// receives the signals through the given hub.
+func (m *Manager) TriggerOnHub(ctx context.Context, hub *signals.Hub, sig ...os.Signal) (stop func(), err error) {
+	if len(sig) == 0 {
+		sig = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	var once sync.Once
+	return hub.Subscribe(signals.Handler{
+		Signals: sig,
+		Func: func(os.Signal) {
+			// Shut down on a goroutine of its own so
+			// that other handlers are not held up.
+			once.Do(func() {
+				go m.Shutdown(ctx)
+			})
+		},
+	})
+}
@@ -0,0 +1,185 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package shutdown_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/juju/clock/testclock"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/parallel"
+	"github.com/juju/utils/v3/shutdown"
+	"github.com/juju/utils/v3/signals"
+)
+
+type shutdownSuite struct {
+	testing.IsolationSuite
+	clock *testclock.Clock
+	m     *shutdown.Manager
+}
+
+var _ = gc.Suite(&shutdownSuite{})
+
+func (s *shutdownSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.clock = testclock.NewClock(time.Now())
+	s.m = shutdown.NewManager(s.clock)
+}
+
+func (s *shutdownSuite) register(c *gc.C, name string, order int, calls *[]string, err error) {
+	e := s.m.Register(shutdown.Hook{
+		Name:  name,
+		Order: order,
+		Func: func(context.Context) error {
+			*calls = append(*calls, name)
+			return err
+		},
+	})
+	c.Assert(e, jc.ErrorIsNil)
+}
+
+func (s *shutdownSuite) TestOrder(c *gc.C) {
+	var calls []string
+	s.register(c, "db", 10, &calls, nil)
+	s.register(c, "listener", 0, &calls, nil)
+	s.register(c, "cache", 10, &calls, nil)
+	s.register(c, "api", 0, &calls, nil)
+
+	err := s.m.Shutdown(context.Background())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(calls, jc.DeepEquals, []string{"api", "listener", "cache", "db"})
+
+	select {
+	case <-s.m.Done():
+	default:
+		c.Fatalf("done channel not closed")
+	}
+}
+
+func (s *shutdownSuite) TestErrorsAggregated(c *gc.C) {
+	var calls []string
+	s.register(c, "a", 0, &calls, errors.New("a failed"))
+	s.register(c, "b", 1, &calls, nil)
+	s.register(c, "c", 2, &calls, errors.New("c failed"))
+
+	err := s.m.Shutdown(context.Background())
+	c.Assert(calls, jc.DeepEquals, []string{"a", "b", "c"})
+	c.Assert(err, gc.ErrorMatches, `hook "a": a failed \(and 1 more\)`)
+	errs, ok := err.(parallel.Errors)
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(errs, gc.HasLen, 2)
+	c.Check(errs[1], gc.ErrorMatches, `hook "c": c failed`)
+	c.Check(errs.Summary(), gc.Equals, "2 errors:\n  hook \"a\": a failed\n  hook \"c\": c failed")
+
+	// Later calls report the same result without running the hooks.
+	c.Assert(s.m.Shutdown(context.Background()), jc.DeepEquals, err)
+	c.Assert(s.m.Wait(), jc.DeepEquals, err)
+	c.Assert(calls, gc.HasLen, 3)
+}
+
+func (s *shutdownSuite) TestTimeout(c *gc.C) {
+	cancelled := make(chan struct{})
+	err := s.m.Register(shutdown.Hook{
+		Name:    "slow",
+		Timeout: time.Second,
+		Func: func(ctx context.Context) error {
+			<-ctx.Done()
+			close(cancelled)
+			return ctx.Err()
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	var calls []string
+	s.register(c, "next", 1, &calls, nil)
+
+	result := make(chan error, 1)
+	go func() {
+		result <- s.m.Shutdown(context.Background())
+	}()
+	err = s.clock.WaitAdvance(time.Second, testing.LongWait, 1)
+	c.Assert(err, jc.ErrorIsNil)
+	select {
+	case err := <-result:
+		c.Assert(err, gc.ErrorMatches, `hook "slow": timed out after 1s`)
+	case <-time.After(testing.LongWait):
+		c.Fatalf("timed out waiting for shutdown")
+	}
+	c.Assert(calls, jc.DeepEquals, []string{"next"})
+	select {
+	case <-cancelled:
+	case <-time.After(testing.LongWait):
+		c.Fatalf("hook context not cancelled")
+	}
+}
+
+func (s *shutdownSuite) TestContextDone(c *gc.C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	err := s.m.Register(shutdown.Hook{
+		Name: "first",
+		Func: func(context.Context) error {
+			cancel()
+			return nil
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	var calls []string
+	s.register(c, "second", 1, &calls, nil)
+
+	err = s.m.Shutdown(ctx)
+	c.Assert(err, gc.ErrorMatches, `hook "second": context canceled`)
+	c.Assert(calls, gc.HasLen, 0)
+}
+
+func (s *shutdownSuite) TestPanic(c *gc.C) {
+	err := s.m.Register(shutdown.Hook{
+		Name: "bad",
+		Func: func(context.Context) error {
+			panic("oops")
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	err = s.m.Shutdown(context.Background())
+	c.Assert(err, gc.ErrorMatches, `hook "bad": panic: oops`)
+}
+
+func (s *shutdownSuite) TestRegisterAfterShutdown(c *gc.C) {
+	c.Assert(s.m.Shutdown(context.Background()), jc.ErrorIsNil)
+	var calls []string
+	err := s.m.Register(shutdown.Hook{
+		Name: "late",
+		Func: func(context.Context) error { return nil },
+	})
+	c.Assert(err, gc.Equals, shutdown.ErrShuttingDown)
+	c.Assert(calls, gc.HasLen, 0)
+}
+
+func (s *shutdownSuite) TestRegisterNoFunc(c *gc.C) {
+	err := s.m.Register(shutdown.Hook{Name: "empty"})
+	c.Assert(err, gc.ErrorMatches, `hook "empty" has no function`)
+}
+
+func (s *shutdownSuite) TestTriggerOnHub(c *gc.C) {
+	hub := signals.NewHub(nil)
+	defer hub.Close()
+	var calls []string
+	s.register(c, "hook", 0, &calls, nil)
+	stop, err := s.m.TriggerOnHub(context.Background(), hub, os.Interrupt)
+	c.Assert(err, jc.ErrorIsNil)
+	defer stop()
+
+	hub.Inject(os.Interrupt)
+	select {
+	case <-s.m.Done():
+	case <-time.After(testing.LongWait):
+		c.Fatalf("shutdown not triggered")
+	}
+	c.Assert(s.m.Wait(), jc.ErrorIsNil)
+	c.Assert(calls, jc.DeepEquals, []string{"hook"})
+}
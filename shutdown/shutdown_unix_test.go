@@ -0,0 +1,47 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+//go:build !windows
+// +build !windows
+
+package shutdown_test
+
+import (
+	"context"
+	"syscall"
+	"time"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/shutdown"
+)
+
+func (s *shutdownSuite) TestTriggerOnSignal(c *gc.C) {
+	called := make(chan struct{})
+	err := s.m.Register(shutdown.Hook{
+		Name: "hook",
+		Func: func(context.Context) error {
+			close(called)
+			return nil
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	stop := s.m.TriggerOnSignal(context.Background(), syscall.SIGUSR1)
+	defer stop()
+
+	err = syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)
+	c.Assert(err, jc.ErrorIsNil)
+	select {
+	case <-s.m.Done():
+	case <-time.After(testing.LongWait):
+		c.Fatalf("shutdown not triggered")
+	}
+	c.Assert(s.m.Wait(), jc.ErrorIsNil)
+	select {
+	case <-called:
+	default:
+		c.Fatalf("hook not called")
+	}
+}
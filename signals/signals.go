@@ -0,0 +1,283 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package signals dispatches the signals received by a process to the
+// components interested in them, such as one that reloads its
+// configuration on SIGHUP and another that shuts down on SIGTERM,
+// so that each need not call signal.Notify itself. Tests can inject
+// signals into a Hub without sending real ones.
+package signals
+
+import (
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+
+	"github.com/juju/errors"
+)
+
+// Source is the source of the signals received by a Hub. Its methods
+// behave like signal.Notify and signal.Stop, with which OS implements
+// it.
+type Source interface {
+	// Notify causes the given signals to be sent on ch.
+	Notify(ch chan<- os.Signal, sig ...os.Signal)
+
+	// Stop stops any signals being sent on ch.
+	Stop(ch chan<- os.Signal)
+}
+
+// OS is the Source of the signals received by the process.
+var OS Source = osSource{}
+
+type osSource struct{}
+
+func (osSource) Notify(ch chan<- os.Signal, sig ...os.Signal) {
+	signal.Notify(ch, sig...)
+}
+
+func (osSource) Stop(ch chan<- os.Signal) {
+	signal.Stop(ch)
+}
+
+// Handler describes a function to be called when
+// the process receives any of a set of signals.
+type Handler struct {
+	// Signals holds the signals that the handler handles.
+	Signals []os.Signal
+
+	// Order determines when the handler is called relative to
+	// others handling the same signal. Handlers with lower Order
+	// are called first. Handlers with the same Order are called
+	// in the order in which they were subscribed.
+	Order int
+
+	// Func is called with each signal received. It is called on
+	// the hub's goroutine, so it should return promptly, starting
+	// a goroutine of its own for lengthy work.
+	Func func(os.Signal)
+}
+
+// Hub calls handlers for the signals received by the process. While
+// a signal has a handler, the signal no longer has its default
+// effect, such as terminating the process. Signals are handled one
+// at a time, in the order in which the hub receives them.
+type Hub struct {
+	source Source
+	queue  chan os.Signal
+	quit   chan struct{}
+	done   chan struct{}
+
+	mu sync.Mutex
+	// handlers holds the handlers in the order
+	// in which they were subscribed.
+	handlers []*Handler
+	// watched holds the watch for each
+	// signal with a handler.
+	watched map[os.Signal]*watch
+	closed  bool
+}
+
+// watch receives a single signal from the source.
+type watch struct {
+	ch   chan os.Signal
+	stop chan struct{}
+}
+
+// NewHub returns a hub receiving signals from source. If source is
+// nil, OS is used. The hub must be closed with Close when it is no
+// longer needed.
+func NewHub(source Source) *Hub {
+	if source == nil {
+		source = OS
+	}
+	h := &Hub{
+		source:  source,
+		queue:   make(chan os.Signal, 16),
+		quit:    make(chan struct{}),
+		done:    make(chan struct{}),
+		watched: make(map[os.Signal]*watch),
+	}
+	go h.loop()
+	return h
+}
+
+var (
+	defaultOnce sync.Once
+	defaultHub  *Hub
+)
+
+// Default returns a hub, shared by the whole process,
+// that receives signals from OS. It is never closed.
+func Default() *Hub {
+	defaultOnce.Do(func() {
+		defaultHub = NewHub(OS)
+	})
+	return defaultHub
+}
+
+// Subscribe adds a handler to the hub. The returned function
+// removes it; it may be called from a handler.
+func (h *Hub) Subscribe(handler Handler) (unsubscribe func(), err error) {
+	if handler.Func == nil {
+		return nil, errors.NotValidf("nil Func")
+	}
+	if len(handler.Signals) == 0 {
+		return nil, errors.NotValidf("empty Signals")
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil, errors.New("signal hub closed")
+	}
+	added := &handler
+	h.handlers = append(h.handlers, added)
+	h.updateWatched()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			for i, handler := range h.handlers {
+				if handler == added {
+					h.handlers = append(h.handlers[:i:i], h.handlers[i+1:]...)
+					break
+				}
+			}
+			if !h.closed {
+				h.updateWatched()
+			}
+		})
+	}, nil
+}
+
+// updateWatched starts receiving the signals that have gained a
+// handler, and stops receiving those that have lost their last one,
+// so that they regain their default effect. It is called with h.mu
+// held.
+func (h *Hub) updateWatched() {
+	wanted := make(map[os.Signal]bool)
+	for _, handler := range h.handlers {
+		for _, sig := range handler.Signals {
+			wanted[sig] = true
+		}
+	}
+	for sig, w := range h.watched {
+		if !wanted[sig] {
+			h.unwatch(sig, w)
+		}
+	}
+	for sig := range wanted {
+		if _, ok := h.watched[sig]; ok {
+			continue
+		}
+		// Each signal has a channel of its own, so that it
+		// can be stopped without stopping the others.
+		w := &watch{
+			ch:   make(chan os.Signal, 1),
+			stop: make(chan struct{}),
+		}
+		h.source.Notify(w.ch, sig)
+		h.watched[sig] = w
+		go h.forward(w)
+	}
+}
+
+// unwatch stops w receiving sig. It is called with h.mu held.
+func (h *Hub) unwatch(sig os.Signal, w *watch) {
+	h.source.Stop(w.ch)
+	close(w.stop)
+	delete(h.watched, sig)
+}
+
+// forward passes the signals received by w to the
+// queue until w is stopped or the hub is closed.
+func (h *Hub) forward(w *watch) {
+	for {
+		select {
+		case sig := <-w.ch:
+			select {
+			case h.queue <- sig:
+			case <-w.stop:
+				return
+			case <-h.quit:
+				return
+			}
+		case <-w.stop:
+			return
+		case <-h.quit:
+			return
+		}
+	}
+}
+
+// Inject handles sig as if the process had received it. It returns
+// once the signal is queued, before any handler is called. Signals
+// injected after the hub is closed are ignored.
+func (h *Hub) Inject(sig os.Signal) {
+	select {
+	case h.queue <- sig:
+	case <-h.quit:
+	}
+}
+
+// Close stops the hub receiving signals, restoring their default
+// effects, and waits for any handler being called to return, so it
+// must not be called from a handler. Signals that have been received
+// but not yet handled are dropped.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	if !h.closed {
+		h.closed = true
+		for sig, w := range h.watched {
+			h.unwatch(sig, w)
+		}
+		close(h.quit)
+	}
+	h.mu.Unlock()
+	<-h.done
+}
+
+func (h *Hub) loop() {
+	defer close(h.done)
+	for {
+		select {
+		case sig := <-h.queue:
+			for _, handler := range h.handlersFor(sig) {
+				select {
+				case <-h.quit:
+					return
+				default:
+				}
+				handler(sig)
+			}
+		case <-h.quit:
+			return
+		}
+	}
+}
+
+// handlersFor returns the functions of the handlers for sig,
+// in the order in which they should be called.
+func (h *Hub) handlersFor(sig os.Signal) []func(os.Signal) {
+	h.mu.Lock()
+	var handlers []*Handler
+	for _, handler := range h.handlers {
+		for _, s := range handler.Signals {
+			if s == sig {
+				handlers = append(handlers, handler)
+				break
+			}
+		}
+	}
+	h.mu.Unlock()
+	sort.SliceStable(handlers, func(i, j int) bool {
+		return handlers[i].Order < handlers[j].Order
+	})
+	funcs := make([]func(os.Signal), len(handlers))
+	for i, handler := range handlers {
+		funcs[i] = handler.Func
+	}
+	return funcs
+}
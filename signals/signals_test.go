@@ -0,0 +1,219 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package signals_test
+
+import (
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/signals"
+)
+
+// fakeSource is a signals.Source whose signals are sent by tests.
+type fakeSource struct {
+	mu       sync.Mutex
+	channels map[chan<- os.Signal][]os.Signal
+}
+
+func newFakeSource() *fakeSource {
+	return &fakeSource{channels: make(map[chan<- os.Signal][]os.Signal)}
+}
+
+func (s *fakeSource) Notify(ch chan<- os.Signal, sig ...os.Signal) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.channels[ch] = append(s.channels[ch], sig...)
+}
+
+func (s *fakeSource) Stop(ch chan<- os.Signal) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.channels, ch)
+}
+
+// send sends sig, as signal.Notify would, to every channel
+// registered for it.
+func (s *fakeSource) send(sig os.Signal) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch, sigs := range s.channels {
+		for _, s := range sigs {
+			if s == sig {
+				ch <- sig
+			}
+		}
+	}
+}
+
+// watched returns the number of signals being watched.
+func (s *fakeSource) watched() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, sigs := range s.channels {
+		n += len(sigs)
+	}
+	return n
+}
+
+type hubSuite struct {
+	testing.IsolationSuite
+	source *fakeSource
+	hub    *signals.Hub
+	calls  chan string
+}
+
+var _ = gc.Suite(&hubSuite{})
+
+func (s *hubSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.source = newFakeSource()
+	s.hub = signals.NewHub(s.source)
+	s.calls = make(chan string, 10)
+}
+
+func (s *hubSuite) TearDownTest(c *gc.C) {
+	s.hub.Close()
+	s.IsolationSuite.TearDownTest(c)
+}
+
+// subscribe subscribes a handler that records
+// calls to it under the given name.
+func (s *hubSuite) subscribe(c *gc.C, name string, order int, sig ...os.Signal) func() {
+	unsubscribe, err := s.hub.Subscribe(signals.Handler{
+		Signals: sig,
+		Order:   order,
+		Func: func(sig os.Signal) {
+			s.calls <- name + ":" + sig.String()
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	return unsubscribe
+}
+
+func (s *hubSuite) assertCalls(c *gc.C, expect ...string) {
+	for _, call := range expect {
+		select {
+		case got := <-s.calls:
+			c.Assert(got, gc.Equals, call)
+		case <-time.After(testing.LongWait):
+			c.Fatalf("timed out waiting for %s", call)
+		}
+	}
+	select {
+	case got := <-s.calls:
+		c.Fatalf("unexpected call %s", got)
+	case <-time.After(testing.ShortWait):
+	}
+}
+
+func (s *hubSuite) TestDispatch(c *gc.C) {
+	s.subscribe(c, "reload", 0, syscall.SIGHUP)
+	s.subscribe(c, "shutdown", 0, syscall.SIGTERM, os.Interrupt)
+
+	s.source.send(syscall.SIGHUP)
+	s.assertCalls(c, "reload:hangup")
+	s.source.send(syscall.SIGTERM)
+	s.assertCalls(c, "shutdown:terminated")
+	s.source.send(os.Interrupt)
+	s.assertCalls(c, "shutdown:interrupt")
+}
+
+func (s *hubSuite) TestOrder(c *gc.C) {
+	s.subscribe(c, "c", 10, syscall.SIGTERM)
+	s.subscribe(c, "a", 0, syscall.SIGTERM)
+	s.subscribe(c, "d", 10, syscall.SIGTERM)
+	s.subscribe(c, "b", 0, syscall.SIGTERM)
+
+	s.source.send(syscall.SIGTERM)
+	s.assertCalls(c, "a:terminated", "b:terminated", "c:terminated", "d:terminated")
+}
+
+func (s *hubSuite) TestSignalsHandledInTurn(c *gc.C) {
+	// A slow handler holds up later signals
+	// rather than being run concurrently.
+	release := make(chan struct{})
+	_, err := s.hub.Subscribe(signals.Handler{
+		Signals: []os.Signal{syscall.SIGHUP},
+		Func: func(os.Signal) {
+			s.calls <- "slow"
+			<-release
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	s.subscribe(c, "fast", 1, syscall.SIGHUP, syscall.SIGTERM)
+
+	s.hub.Inject(syscall.SIGHUP)
+	s.hub.Inject(syscall.SIGTERM)
+	s.assertCalls(c, "slow")
+	close(release)
+	s.assertCalls(c, "fast:hangup", "fast:terminated")
+}
+
+func (s *hubSuite) TestInject(c *gc.C) {
+	s.subscribe(c, "reload", 0, syscall.SIGHUP)
+	s.hub.Inject(syscall.SIGHUP)
+	s.assertCalls(c, "reload:hangup")
+	// Signals without handlers are ignored.
+	s.hub.Inject(syscall.SIGTERM)
+	s.assertCalls(c)
+}
+
+func (s *hubSuite) TestUnsubscribe(c *gc.C) {
+	unsubscribe := s.subscribe(c, "a", 0, syscall.SIGHUP, syscall.SIGTERM)
+	s.subscribe(c, "b", 0, syscall.SIGHUP)
+	c.Assert(s.source.watched(), gc.Equals, 2)
+
+	unsubscribe()
+	// SIGTERM has no handlers left, so it is no longer watched.
+	c.Assert(s.source.watched(), gc.Equals, 1)
+	s.source.send(syscall.SIGHUP)
+	s.assertCalls(c, "b:hangup")
+
+	// Unsubscribing again does nothing.
+	unsubscribe()
+	c.Assert(s.source.watched(), gc.Equals, 1)
+}
+
+func (s *hubSuite) TestUnsubscribeFromHandler(c *gc.C) {
+	var unsubscribe func()
+	unsubscribe, err := s.hub.Subscribe(signals.Handler{
+		Signals: []os.Signal{syscall.SIGHUP},
+		Func: func(os.Signal) {
+			s.calls <- "once"
+			unsubscribe()
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	s.hub.Inject(syscall.SIGHUP)
+	s.hub.Inject(syscall.SIGHUP)
+	s.assertCalls(c, "once")
+}
+
+func (s *hubSuite) TestClose(c *gc.C) {
+	s.subscribe(c, "a", 0, syscall.SIGHUP)
+	s.hub.Close()
+	c.Assert(s.source.watched(), gc.Equals, 0)
+	s.hub.Inject(syscall.SIGHUP)
+	s.assertCalls(c)
+	_, err := s.hub.Subscribe(signals.Handler{
+		Signals: []os.Signal{syscall.SIGHUP},
+		Func:    func(os.Signal) {},
+	})
+	c.Assert(err, gc.ErrorMatches, "signal hub closed")
+}
+
+func (s *hubSuite) TestSubscribeNotValid(c *gc.C) {
+	_, err := s.hub.Subscribe(signals.Handler{Signals: []os.Signal{syscall.SIGHUP}})
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+	_, err = s.hub.Subscribe(signals.Handler{Func: func(os.Signal) {}})
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+}
@@ -17,6 +17,9 @@ import (
 // The string must be a is a non-negative number with
 // an optional multiplier suffix (M, G, T, P, E, Z, or Y).
 // If the suffix is not specified, "M" is implied.
+//
+// Deprecated: use ParseByteSize, which distinguishes
+// SI and IEC units and returns the size in bytes.
 func ParseSize(str string) (MB uint64, err error) {
 	// Find the first non-digit/period:
 	i := strings.IndexFunc(str, func(r rune) bool {
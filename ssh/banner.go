@@ -0,0 +1,22 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package ssh
+
+// SetBannerCallback sets a function to be called with the banner
+// that a server may send before authentication, such as a legal
+// notice, and the address of the server. Without a callback, the
+// go.crypto client discards banners. The OpenSSH client ignores the
+// callback and writes banners to the command's standard error.
+func (o *Options) SetBannerCallback(callback func(host, message string)) {
+	o.bannerCallback = callback
+}
+
+// SetServerVersionCallback sets a function to be called with the
+// identification string sent by the server, such as
+// "SSH-2.0-OpenSSH_8.9p1", and the address of the server, once the
+// go.crypto client has connected and authenticated. The OpenSSH
+// client ignores the callback; see Ping for an alternative.
+func (o *Options) SetServerVersionCallback(callback func(host, version string)) {
+	o.serverVersionCallback = callback
+}
@@ -0,0 +1,84 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package ssh
+
+import (
+	"crypto/sha512"
+
+	"github.com/juju/errors"
+	"golang.org/x/crypto/blowfish"
+)
+
+// bcryptPBKDFBlockSize is the size of each block of key derived
+// by bcryptPBKDF.
+const bcryptPBKDFBlockSize = 32
+
+// bcryptPBKDF derives a key of keyLen bytes from password and salt
+// with the bcrypt_pbkdf function that OpenSSH uses to encrypt private
+// keys, which is PBKDF2 with a bcrypt based hash in place of HMAC.
+func bcryptPBKDF(password, salt []byte, rounds, keyLen int) ([]byte, error) {
+	if rounds < 1 {
+		return nil, errors.New("bcrypt_pbkdf rounds must be at least 1")
+	}
+	if len(password) == 0 || len(salt) == 0 {
+		return nil, errors.New("bcrypt_pbkdf password and salt must not be empty")
+	}
+	if keyLen <= 0 || keyLen > 1024 {
+		return nil, errors.Errorf("invalid bcrypt_pbkdf key length %d", keyLen)
+	}
+	numBlocks := (keyLen + bcryptPBKDFBlockSize - 1) / bcryptPBKDFBlockSize
+	key := make([]byte, numBlocks*bcryptPBKDFBlockSize)
+
+	passHash := sha512.Sum512(password)
+	for block := 1; block <= numBlocks; block++ {
+		h := sha512.New()
+		h.Write(salt)
+		h.Write([]byte{byte(block >> 24), byte(block >> 16), byte(block >> 8), byte(block)})
+		saltHash := h.Sum(nil)
+
+		tmp := bcryptHash(passHash[:], saltHash)
+		out := append([]byte(nil), tmp...)
+		for round := 1; round < rounds; round++ {
+			sum := sha512.Sum512(tmp)
+			tmp = bcryptHash(passHash[:], sum[:])
+			for i := range out {
+				out[i] ^= tmp[i]
+			}
+		}
+		// The output of each block is spread across the key, so that
+		// no part of the key can be derived with less work than the rest.
+		for i, b := range out {
+			key[i*numBlocks+block-1] = b
+		}
+	}
+	return key[:keyLen], nil
+}
+
+// bcryptMagic is encrypted by bcryptHash.
+var bcryptMagic = []byte("OxychromaticBlowfishSwatDynamite")
+
+// bcryptHash returns the bcrypt hash of passHash and saltHash, as
+// used by bcryptPBKDF.
+func bcryptHash(passHash, saltHash []byte) []byte {
+	c, err := blowfish.NewSaltedCipher(passHash, saltHash)
+	if err != nil {
+		// The hashes are never empty or too long.
+		panic(err)
+	}
+	for i := 0; i < 64; i++ {
+		blowfish.ExpandKey(saltHash, c)
+		blowfish.ExpandKey(passHash, c)
+	}
+	text := append([]byte(nil), bcryptMagic...)
+	for i := 0; i < 64; i++ {
+		for j := 0; j < len(text); j += blowfish.BlockSize {
+			c.Encrypt(text[j:j+blowfish.BlockSize], text[j:j+blowfish.BlockSize])
+		}
+	}
+	// The hash is made of the encrypted words in little-endian order.
+	for i := 0; i < len(text); i += 4 {
+		text[i], text[i+1], text[i+2], text[i+3] = text[i+3], text[i+2], text[i+1], text[i]
+	}
+	return text
+}
@@ -13,11 +13,16 @@ import (
 
 	"github.com/juju/collections/set"
 	"github.com/juju/utils/v3"
+	"github.com/juju/utils/v3/secrets"
 	"golang.org/x/crypto/ssh"
 )
 
 const clientKeyName = "juju_id_rsa"
 
+// keyBufferOptions holds the options for the buffers
+// holding private keys while they are parsed.
+var keyBufferOptions = secrets.BufferOptions{Lock: true}
+
 // PublicKeySuffix is the file extension for public key files.
 const PublicKeySuffix = ".pub"
 
@@ -80,16 +85,21 @@ func ClearClientKeys() {
 }
 
 func generateClientKey(dir string) (keyfile string, key ssh.Signer, err error) {
-	private, public, err := GenerateKey("juju-client-key")
+	private, public, err := generateKey("juju-client-key")
+	if err != nil {
+		return "", nil, err
+	}
+	buf, err := secrets.NewBuffer(private, keyBufferOptions)
 	if err != nil {
 		return "", nil, err
 	}
-	clientPrivateKey, err := ssh.ParsePrivateKey([]byte(private))
+	defer buf.Close()
+	clientPrivateKey, err := ssh.ParsePrivateKey(buf.Bytes())
 	if err != nil {
 		return "", nil, err
 	}
 	privkeyFilename := filepath.Join(dir, clientKeyName)
-	if err = ioutil.WriteFile(privkeyFilename, []byte(private), 0600); err != nil {
+	if err = ioutil.WriteFile(privkeyFilename, buf.Bytes(), 0600); err != nil {
 		return "", nil, err
 	}
 	if err := ioutil.WriteFile(privkeyFilename+PublicKeySuffix, []byte(public), 0600); err != nil {
@@ -107,11 +117,14 @@ func loadClientKeys(dir string) (map[string]ssh.Signer, error) {
 	keys := make(map[string]ssh.Signer, len(publicKeyFiles))
 	for _, filename := range publicKeyFiles {
 		filename = filename[:len(filename)-len(PublicKeySuffix)]
-		data, err := ioutil.ReadFile(filename)
+		// The key file is read into a buffer that is
+		// zeroed once the key has been parsed.
+		buf, err := secrets.ReadFile(filename, keyBufferOptions)
 		if err != nil {
 			return nil, err
 		}
-		keys[filename], err = ssh.ParsePrivateKey(data)
+		keys[filename], err = ssh.ParsePrivateKey(buf.Bytes())
+		buf.Close()
 		if err != nil {
 			return nil, fmt.Errorf("parsing key file %q: %v", filename, err)
 		}
@@ -0,0 +1,106 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package ssh
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/juju/clock"
+)
+
+// EventKind identifies a stage in the lifecycle of an SSH connection.
+type EventKind int
+
+const (
+	// EventResolving is sent before the target host name is resolved.
+	EventResolving EventKind = iota
+
+	// EventDialing is sent before the network connection is made.
+	EventDialing
+
+	// EventProxyStarted is sent once the proxy command, if any,
+	// has been started.
+	EventProxyStarted
+
+	// EventHostKeyVerified is sent once the server's host key
+	// has been accepted.
+	EventHostKeyVerified
+
+	// EventAuthenticating is sent when client authentication begins.
+	EventAuthenticating
+
+	// EventSessionStarted is sent once the remote command has started.
+	EventSessionStarted
+
+	// EventClosed is sent when the connection has been closed,
+	// either because the command completed or because a
+	// previous stage failed.
+	EventClosed
+)
+
+var eventKindNames = map[EventKind]string{
+	EventResolving:       "resolving",
+	EventDialing:         "dialing",
+	EventProxyStarted:    "proxy-started",
+	EventHostKeyVerified: "host-key-verified",
+	EventAuthenticating:  "authenticating",
+	EventSessionStarted:  "session-started",
+	EventClosed:          "closed",
+}
+
+// String implements fmt.Stringer.
+func (k EventKind) String() string {
+	if name, ok := eventKindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("EventKind(%d)", int(k))
+}
+
+// Event describes a change in the state of an SSH connection.
+type Event struct {
+	// Kind holds the stage the connection has reached.
+	Kind EventKind
+
+	// Time holds the time at which the event occurred.
+	Time time.Time
+
+	// Host holds the address of the host being connected to.
+	Host string
+
+	// Err holds the error that caused the connection to close.
+	// It is only set for EventClosed, and is nil if the
+	// command completed successfully. The stage at which a
+	// failure occurred is given by the preceding event.
+	Err error
+}
+
+// eventSink sends events to a channel supplied by the user,
+// timestamped by its clock. An eventSink with a nil channel
+// discards all events.
+type eventSink struct {
+	ch    chan<- Event
+	clock clock.Clock
+}
+
+// send sends an event of the given kind without blocking. If the
+// channel is not ready to receive, the event is dropped.
+func (s eventSink) send(kind EventKind, host string, err error) {
+	if s.ch == nil {
+		return
+	}
+	clk := s.clock
+	if clk == nil {
+		clk = clock.WallClock
+	}
+	select {
+	case s.ch <- Event{
+		Kind: kind,
+		Time: clk.Now(),
+		Host: host,
+		Err:  err,
+	}:
+	default:
+	}
+}
@@ -17,11 +17,23 @@ var (
 	InitDefaultClient   = initDefaultClient
 	DefaultIdentities   = &defaultIdentities
 	SSHDial             = &sshDial
+	LookupHost          = &lookupHost
 	RSAGenerateKey      = &rsaGenerateKey
 	TestCopyReader      = copyReader
 	TestNewCmd          = newCmd
+	ControlDir          = &controlDir
+	SplitUserHost       = splitUserHost
+	ExpandProxyTokens   = expandProxyTokens
+	VerifySSHFP         = verifySSHFP
+	DefaultGSSAPIClient = &defaultGSSAPIClient
 )
 
+// NewRecordedCmd returns a Cmd for impl whose I/O is recorded
+// and transformed as configured by options.
+func NewRecordedCmd(impl command, options *Options, host string, args []string) *Cmd {
+	return options.newCmd(impl, host, args)
+}
+
 type ReadLineWriter readLineWriter
 
 func PatchTerminal(s *testing.CleanupSuite, rlw ReadLineWriter) {
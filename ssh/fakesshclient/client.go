@@ -0,0 +1,196 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package fakesshclient provides a fake ssh.Client for unit tests,
+// which runs no commands but returns scripted responses to them and
+// records how it was used.
+package fakesshclient
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"sync"
+
+	"github.com/juju/cmd/v3"
+	"github.com/juju/errors"
+
+	"github.com/juju/utils/v3"
+	"github.com/juju/utils/v3/ssh"
+)
+
+// Response holds the scripted result of a command. The command
+// reads all of its input before it writes its output.
+type Response struct {
+	// Stdout and Stderr are written to the command's
+	// output streams.
+	Stdout, Stderr string
+
+	// Code is the command's exit status. A non-zero status is
+	// returned from Cmd.Wait as a *cmd.RcPassthroughError.
+	Code int
+
+	// Err, if set, is returned from Cmd.Wait in place
+	// of the exit status.
+	Err error
+}
+
+// Call records a command run or a copy made with the client.
+type Call struct {
+	// Host is the host given for a command.
+	Host string
+
+	// Args holds the command's arguments, or those of a copy.
+	Args []string
+
+	// Options holds the options given.
+	Options *ssh.Options
+
+	// Stdin holds the input read by a command that was answered
+	// with a Response. It is set when the command completes.
+	Stdin string
+
+	// Copy is true if the call was a copy.
+	Copy bool
+}
+
+// Client is a fake ssh.Client. Commands are answered by the handler
+// of the first pattern that matches them, in the order in which they
+// were registered. Commands that match no pattern fail with a not
+// found error, and copies succeed unless SetCopyError is called.
+type Client struct {
+	mu        sync.Mutex
+	handlers  []handler
+	calls     []*Call
+	copyError error
+}
+
+type handler struct {
+	pattern *regexp.Regexp
+	run     ssh.CommandFunc
+	respond *Response
+}
+
+var _ ssh.Client = (*Client)(nil)
+
+// New returns a client with no handlers.
+func New() *Client {
+	return &Client{}
+}
+
+// Handle registers a response to the commands that match pattern,
+// a regular expression that must match the whole of the command
+// line, as formatted by utils.CommandString. The pattern is parsed
+// with regexp.MustCompile.
+func (c *Client) Handle(pattern string, response Response) {
+	c.addHandler(pattern, handler{respond: &response})
+}
+
+// HandleFunc registers f to run the commands that match pattern,
+// as for Handle.
+func (c *Client) HandleFunc(pattern string, f ssh.CommandFunc) {
+	c.addHandler(pattern, handler{run: f})
+}
+
+func (c *Client) addHandler(pattern string, h handler) {
+	h.pattern = regexp.MustCompile("^(?:" + pattern + ")$")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.handlers = append(c.handlers, h)
+}
+
+// SetCopyError makes subsequent copies fail with err.
+func (c *Client) SetCopyError(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.copyError = err
+}
+
+// Calls returns the calls made to the client, in order.
+func (c *Client) Calls() []Call {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	calls := make([]Call, len(c.calls))
+	for i, call := range c.calls {
+		calls[i] = *call
+	}
+	return calls
+}
+
+// Commands returns the command lines run with the client,
+// in order, as formatted by utils.CommandString.
+func (c *Client) Commands() []string {
+	var commands []string
+	for _, call := range c.Calls() {
+		if !call.Copy {
+			commands = append(commands, utils.CommandString(call.Args...))
+		}
+	}
+	return commands
+}
+
+// Command implements ssh.Client.Command.
+func (c *Client) Command(host string, command []string, options *ssh.Options) *ssh.Cmd {
+	call := &Call{
+		Host:    host,
+		Args:    append([]string(nil), command...),
+		Options: options,
+	}
+	line := utils.CommandString(command...)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = append(c.calls, call)
+	for _, h := range c.handlers {
+		if !h.pattern.MatchString(line) {
+			continue
+		}
+		run := h.run
+		if run == nil {
+			run = c.respond(call, *h.respond)
+		}
+		return ssh.NewFuncCmd(host, command, options, run)
+	}
+	return ssh.NewFuncCmd(host, command, options, func(context.Context, io.Reader, io.Writer, io.Writer) error {
+		return errors.NotFoundf("response for command %q", line)
+	})
+}
+
+// respond returns a function that answers the call with
+// the response.
+func (c *Client) respond(call *Call, response Response) ssh.CommandFunc {
+	return func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+		input, err := ioutil.ReadAll(stdin)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		c.mu.Lock()
+		call.Stdin = string(input)
+		c.mu.Unlock()
+		if _, err := io.WriteString(stdout, response.Stdout); err != nil {
+			return errors.Trace(err)
+		}
+		if _, err := io.WriteString(stderr, response.Stderr); err != nil {
+			return errors.Trace(err)
+		}
+		if response.Err != nil {
+			return response.Err
+		}
+		if response.Code != 0 {
+			return cmd.NewRcPassthroughError(response.Code)
+		}
+		return nil
+	}
+}
+
+// Copy implements ssh.Client.Copy.
+func (c *Client) Copy(args []string, options *ssh.Options) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = append(c.calls, &Call{
+		Args:    append([]string(nil), args...),
+		Options: options,
+		Copy:    true,
+	})
+	return c.copyError
+}
@@ -0,0 +1,142 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package fakesshclient_test
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/juju/cmd/v3"
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/ssh"
+	"github.com/juju/utils/v3/ssh/fakesshclient"
+)
+
+type ClientSuite struct {
+	testing.IsolationSuite
+	client *fakesshclient.Client
+}
+
+var _ = gc.Suite(&ClientSuite{})
+
+func (s *ClientSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.client = fakesshclient.New()
+}
+
+func (s *ClientSuite) TestHandle(c *gc.C) {
+	s.client.Handle("uname -[a-z]", fakesshclient.Response{Stdout: "Linux\n"})
+	s.client.Handle("uname.*", fakesshclient.Response{Stderr: "bad option\n", Code: 2})
+
+	out, err := s.client.Command("ubuntu@host", []string{"uname", "-s"}, nil).CombinedOutput()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(out), gc.Equals, "Linux\n")
+
+	out, err = s.client.Command("host", []string{"uname", "--bad"}, nil).CombinedOutput()
+	c.Check(cmd.IsRcPassthroughError(err), jc.IsTrue)
+	c.Check(err.(*cmd.RcPassthroughError).Code, gc.Equals, 2)
+	c.Check(string(out), gc.Equals, "bad option\n")
+
+	c.Check(s.client.Commands(), jc.DeepEquals, []string{"uname -s", "uname --bad"})
+	calls := s.client.Calls()
+	c.Assert(calls, gc.HasLen, 2)
+	c.Check(calls[0].Host, gc.Equals, "ubuntu@host")
+	c.Check(calls[0].Args, jc.DeepEquals, []string{"uname", "-s"})
+	c.Check(calls[1].Host, gc.Equals, "host")
+}
+
+func (s *ClientSuite) TestHandleError(c *gc.C) {
+	s.client.Handle("true", fakesshclient.Response{Err: errors.New("connection refused")})
+	err := s.client.Command("host", []string{"true"}, nil).Run()
+	c.Check(err, gc.ErrorMatches, "connection refused")
+}
+
+func (s *ClientSuite) TestNoMatch(c *gc.C) {
+	s.client.Handle("ls", fakesshclient.Response{})
+	err := s.client.Command("host", []string{"ls", "/"}, nil).Run()
+	c.Check(err, jc.Satisfies, errors.IsNotFound)
+	c.Check(err, gc.ErrorMatches, `response for command "ls /" not found`)
+	c.Check(s.client.Commands(), jc.DeepEquals, []string{"ls /"})
+}
+
+func (s *ClientSuite) TestStdin(c *gc.C) {
+	s.client.Handle("cat", fakesshclient.Response{Stdout: "done"})
+	command := s.client.Command("host", []string{"cat"}, nil)
+	command.Stdin = strings.NewReader("some input")
+	out, err := command.Output()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(out), gc.Equals, "done")
+	c.Check(s.client.Calls()[0].Stdin, gc.Equals, "some input")
+}
+
+func (s *ClientSuite) TestHandleFunc(c *gc.C) {
+	s.client.HandleFunc("tr a-z A-Z", func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+		data, err := ioutil.ReadAll(stdin)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(stdout, strings.ToUpper(string(data)))
+		return err
+	})
+	command := s.client.Command("host", []string{"tr", "a-z", "A-Z"}, nil)
+	stdin, err := command.StdinPipe()
+	c.Assert(err, jc.ErrorIsNil)
+	stdout, err := command.StdoutPipe()
+	c.Assert(err, jc.ErrorIsNil)
+	err = command.Start()
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = io.WriteString(stdin, "hello")
+	c.Assert(err, jc.ErrorIsNil)
+	err = stdin.Close()
+	c.Assert(err, jc.ErrorIsNil)
+	out, err := ioutil.ReadAll(stdout)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(out), gc.Equals, "HELLO")
+	err = command.Wait()
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *ClientSuite) TestKill(c *gc.C) {
+	s.client.HandleFunc("sleep .*", func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+		<-ctx.Done()
+		return errors.New("killed")
+	})
+	command := s.client.Command("host", []string{"sleep", "1000"}, nil)
+	err := command.Start()
+	c.Assert(err, jc.ErrorIsNil)
+	err = command.Kill()
+	c.Assert(err, jc.ErrorIsNil)
+	err = command.Wait()
+	c.Check(err, gc.ErrorMatches, "killed")
+}
+
+func (s *ClientSuite) TestOptions(c *gc.C) {
+	var opts ssh.Options
+	opts.AddStreamTransform(ssh.Stdout, ssh.StripCR())
+	s.client.Handle("echo hi", fakesshclient.Response{Stdout: "hi\r\n"})
+	out, err := s.client.Command("host", []string{"echo", "hi"}, &opts).Output()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(out), gc.Equals, "hi\n")
+	c.Check(s.client.Calls()[0].Options, gc.Equals, &opts)
+}
+
+func (s *ClientSuite) TestCopy(c *gc.C) {
+	err := s.client.Copy([]string{"file", "host:/tmp"}, nil)
+	c.Assert(err, jc.ErrorIsNil)
+	s.client.SetCopyError(errors.New("no space"))
+	err = s.client.Copy([]string{"file", "host:/"}, nil)
+	c.Check(err, gc.ErrorMatches, "no space")
+
+	c.Check(s.client.Commands(), gc.HasLen, 0)
+	c.Check(s.client.Calls(), jc.DeepEquals, []fakesshclient.Call{
+		{Args: []string{"file", "host:/tmp"}, Copy: true},
+		{Args: []string{"file", "host:/"}, Copy: true},
+	})
+}
@@ -5,10 +5,21 @@ package ssh
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/md5"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"strings"
 
 	"github.com/juju/errors"
+	"golang.org/x/crypto/ssh"
 )
 
 // KeyFingerprint returns the fingerprint and comment for the specified key
@@ -31,3 +42,243 @@ func KeyFingerprint(key string) (fingerprint, comment string, err error) {
 	}
 	return buf.String(), ak.Comment, nil
 }
+
+// Fingerprint holds the fingerprint of an SSH public key: the hash
+// of its wire encoding.
+type Fingerprint struct {
+	// Hash identifies the hash function used, either
+	// crypto.MD5 or crypto.SHA256.
+	Hash crypto.Hash
+
+	// Sum holds the hash of the key.
+	Sum []byte
+}
+
+// NewFingerprint returns the fingerprint of key
+// using the given hash function.
+func NewFingerprint(key ssh.PublicKey, hash crypto.Hash) (Fingerprint, error) {
+	if hash != crypto.MD5 && hash != crypto.SHA256 {
+		return Fingerprint{}, errors.NotSupportedf("fingerprint hash %v", hash)
+	}
+	h := hash.New()
+	h.Write(key.Marshal())
+	return Fingerprint{Hash: hash, Sum: h.Sum(nil)}, nil
+}
+
+// ParseFingerprint parses a fingerprint as displayed by OpenSSH, either
+// "SHA256:" followed by the unpadded base64 hash, or the hexadecimal
+// bytes of the MD5 hash separated by colons, optionally prefixed by
+// "MD5:".
+func ParseFingerprint(s string) (Fingerprint, error) {
+	s = strings.TrimSpace(s)
+	if b64, ok := cutPrefixFold(s, "SHA256:"); ok {
+		sum, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(b64, "="))
+		if err != nil || len(sum) != sha256.Size {
+			return Fingerprint{}, errors.NotValidf("SHA256 fingerprint %q", s)
+		}
+		return Fingerprint{Hash: crypto.SHA256, Sum: sum}, nil
+	}
+	hexSum, _ := cutPrefixFold(s, "MD5:")
+	sum, err := hex.DecodeString(strings.Replace(hexSum, ":", "", -1))
+	if err != nil || len(sum) != md5.Size || len(hexSum) != 3*md5.Size-1 {
+		return Fingerprint{}, errors.NotValidf("fingerprint %q", s)
+	}
+	for i := 2; i < len(hexSum); i += 3 {
+		if hexSum[i] != ':' {
+			return Fingerprint{}, errors.NotValidf("fingerprint %q", s)
+		}
+	}
+	return Fingerprint{Hash: crypto.MD5, Sum: sum}, nil
+}
+
+func cutPrefixFold(s, prefix string) (string, bool) {
+	if len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix) {
+		return s[len(prefix):], true
+	}
+	return s, false
+}
+
+// String returns the fingerprint as displayed by OpenSSH.
+func (f Fingerprint) String() string {
+	switch f.Hash {
+	case crypto.SHA256:
+		return "SHA256:" + base64.RawStdEncoding.EncodeToString(f.Sum)
+	case crypto.MD5:
+		var buf bytes.Buffer
+		buf.WriteString("MD5:")
+		for i, b := range f.Sum {
+			if i > 0 {
+				buf.WriteByte(':')
+			}
+			fmt.Fprintf(&buf, "%02x", b)
+		}
+		return buf.String()
+	}
+	return fmt.Sprintf("%v:%x", f.Hash, f.Sum)
+}
+
+// Equal reports whether f and other are the same fingerprint. The
+// hashes are compared in constant time.
+func (f Fingerprint) Equal(other Fingerprint) bool {
+	return f.Hash == other.Hash && len(f.Sum) > 0 && subtle.ConstantTimeCompare(f.Sum, other.Sum) == 1
+}
+
+// Matches reports whether f is the fingerprint of key.
+func (f Fingerprint) Matches(key ssh.PublicKey) bool {
+	keyFingerprint, err := NewFingerprint(key, f.Hash)
+	return err == nil && f.Equal(keyFingerprint)
+}
+
+// AuthorisedKeyFingerprint returns the fingerprint, using the given
+// hash function, and the comment of the key in a line of an
+// authorized_keys file.
+func AuthorisedKeyFingerprint(line string, hash crypto.Hash) (Fingerprint, string, error) {
+	key, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+	if err != nil {
+		return Fingerprint{}, "", errors.Errorf("invalid authorized_key %q", line)
+	}
+	f, err := NewFingerprint(key, hash)
+	if err != nil {
+		return Fingerprint{}, "", errors.Trace(err)
+	}
+	return f, comment, nil
+}
+
+// The dimensions of randomart and the characters that show how often
+// each square was visited, as used by OpenSSH.
+const (
+	randomArtWidth  = 17
+	randomArtHeight = 9
+	randomArtChars  = " .o+=*BOX@%&#/^SE"
+)
+
+// RandomArt returns the "randomart" image of key made from its
+// fingerprint with the given hash function, as displayed by
+// ssh-keygen -lv and by ssh with VisualHostKey set. It allows
+// users to recognise keys at a glance.
+func RandomArt(key ssh.PublicKey, hash crypto.Hash) (string, error) {
+	f, err := NewFingerprint(key, hash)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	// Walk the field, moving diagonally by each
+	// pair of bits, starting in the middle.
+	var field [randomArtWidth][randomArtHeight]int
+	x, y := randomArtWidth/2, randomArtHeight/2
+	maxVisits := len(randomArtChars) - 3
+	for _, b := range f.Sum {
+		for i := 0; i < 4; i++ {
+			if b&1 != 0 {
+				x++
+			} else {
+				x--
+			}
+			if b&2 != 0 {
+				y++
+			} else {
+				y--
+			}
+			x = clampInt(x, 0, randomArtWidth-1)
+			y = clampInt(y, 0, randomArtHeight-1)
+			if field[x][y] < maxVisits {
+				field[x][y]++
+			}
+			b >>= 2
+		}
+	}
+	field[randomArtWidth/2][randomArtHeight/2] = len(randomArtChars) - 2
+	field[x][y] = len(randomArtChars) - 1
+
+	var buf bytes.Buffer
+	writeRandomArtBorder(&buf, randomArtKeyTitle(key))
+	buf.WriteByte('\n')
+	for y := 0; y < randomArtHeight; y++ {
+		buf.WriteByte('|')
+		for x := 0; x < randomArtWidth; x++ {
+			buf.WriteByte(randomArtChars[field[x][y]])
+		}
+		buf.WriteString("|\n")
+	}
+	hashName := "SHA256"
+	if hash == crypto.MD5 {
+		hashName = "MD5"
+	}
+	writeRandomArtBorder(&buf, "["+hashName+"]")
+	return buf.String(), nil
+}
+
+// writeRandomArtBorder writes a border of randomart
+// with the given title centred in it.
+func writeRandomArtBorder(buf *bytes.Buffer, title string) {
+	left := (randomArtWidth - len(title)) / 2
+	buf.WriteByte('+')
+	buf.WriteString(strings.Repeat("-", left))
+	buf.WriteString(title)
+	buf.WriteString(strings.Repeat("-", randomArtWidth-len(title)-left))
+	buf.WriteByte('+')
+}
+
+// randomArtKeyTitle returns the title describing key shown above its
+// randomart, such as "[RSA 2048]".
+func randomArtKeyTitle(key ssh.PublicKey) string {
+	suffix := ""
+	if cert, ok := key.(*ssh.Certificate); ok {
+		key = cert.Key
+		suffix = "-CERT"
+	}
+	var name string
+	switch keyType := key.Type(); {
+	case keyType == ssh.KeyAlgoRSA:
+		name = "RSA"
+	case keyType == ssh.KeyAlgoDSA:
+		name = "DSA"
+	case keyType == ssh.KeyAlgoED25519:
+		name = "ED25519"
+	case keyType == ssh.KeyAlgoSKED25519:
+		name = "ED25519-SK"
+	case keyType == ssh.KeyAlgoSKECDSA256:
+		name = "ECDSA-SK"
+	case strings.HasPrefix(keyType, "ecdsa-"):
+		name = "ECDSA"
+	default:
+		name = strings.ToUpper(keyType)
+	}
+	name += suffix
+	title := "[" + name + "]"
+	if bits := publicKeyBits(key); bits > 0 {
+		if sized := fmt.Sprintf("[%s %d]", name, bits); len(sized) <= randomArtWidth {
+			title = sized
+		}
+	}
+	return title
+}
+
+// publicKeyBits returns the size of key in bits,
+// or zero if it is not known.
+func publicKeyBits(key ssh.PublicKey) int {
+	cryptoKey, ok := key.(ssh.CryptoPublicKey)
+	if !ok {
+		return 0
+	}
+	switch k := cryptoKey.CryptoPublicKey().(type) {
+	case *rsa.PublicKey:
+		return k.N.BitLen()
+	case *dsa.PublicKey:
+		return k.P.BitLen()
+	case *ecdsa.PublicKey:
+		return k.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		return 256
+	}
+	return 0
+}
+
+func clampInt(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
@@ -4,8 +4,12 @@
 package ssh_test
 
 import (
+	"crypto"
+
+	"github.com/juju/errors"
 	"github.com/juju/testing"
 	jc "github.com/juju/testing/checkers"
+	cryptossh "golang.org/x/crypto/ssh"
 	gc "gopkg.in/check.v1"
 
 	"github.com/juju/utils/v3/ssh"
@@ -35,3 +39,159 @@ func (s *FingerprintSuite) TestKeyFingerprintError(c *gc.C) {
 	_, _, err := ssh.KeyFingerprint("invalid key")
 	c.Assert(err, gc.ErrorMatches, `generating key fingerprint: invalid authorized_key "invalid key"`)
 }
+
+const ed25519TestKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIETrClCdZzuEbD7++Qo9kFaXoyBWxluFptz816rq0wkF test"
+
+func parseTestKey(c *gc.C, line string) cryptossh.PublicKey {
+	key, _, _, _, err := cryptossh.ParseAuthorizedKey([]byte(line))
+	c.Assert(err, jc.ErrorIsNil)
+	return key
+}
+
+func (s *FingerprintSuite) TestNewFingerprint(c *gc.C) {
+	key := parseTestKey(c, sshtesting.ValidKeyOne.Key)
+	f, err := ssh.NewFingerprint(key, crypto.SHA256)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(f.String(), gc.Equals, "SHA256:o4mn2Zj6qXG0gDlan4PqSrz9/5bt3OQvsUZADv4KXu0")
+
+	f, err = ssh.NewFingerprint(key, crypto.MD5)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(f.String(), gc.Equals, "MD5:"+sshtesting.ValidKeyOne.Fingerprint)
+
+	_, err = ssh.NewFingerprint(key, crypto.SHA1)
+	c.Assert(err, jc.Satisfies, errors.IsNotSupported)
+}
+
+func (s *FingerprintSuite) TestParseFingerprint(c *gc.C) {
+	key := parseTestKey(c, sshtesting.ValidKeyOne.Key)
+	for _, text := range []string{
+		"SHA256:o4mn2Zj6qXG0gDlan4PqSrz9/5bt3OQvsUZADv4KXu0",
+		"sha256:o4mn2Zj6qXG0gDlan4PqSrz9/5bt3OQvsUZADv4KXu0=",
+		" SHA256:o4mn2Zj6qXG0gDlan4PqSrz9/5bt3OQvsUZADv4KXu0\n",
+		"MD5:86:ed:1b:cd:26:a0:a3:4c:27:35:49:60:95:b7:0f:68",
+		"86:ED:1B:CD:26:A0:A3:4C:27:35:49:60:95:B7:0F:68",
+	} {
+		c.Logf("fingerprint %q", text)
+		f, err := ssh.ParseFingerprint(text)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(f.Matches(key), jc.IsTrue)
+	}
+}
+
+func (s *FingerprintSuite) TestParseFingerprintInvalid(c *gc.C) {
+	for _, text := range []string{
+		"",
+		"SHA256:",
+		"SHA256:o4mn2Zj6qXG0gDlan4PqSrz9",
+		"SHA256:not base64!",
+		"MD5:86:ed:1b:cd",
+		"86ed1bcd26a0a34c2735496095b70f68",
+		"86:ed:1b:cd:26:a0:a3:4c:27:35:49:60:95:b7:0f:6",
+		"86:ed:1b:cd:26:a0:a3:4c:27:35:49:60:95:b7:0f:zz",
+		"SHA1:abcd",
+	} {
+		c.Logf("fingerprint %q", text)
+		_, err := ssh.ParseFingerprint(text)
+		c.Check(err, jc.Satisfies, errors.IsNotValid)
+	}
+}
+
+func (s *FingerprintSuite) TestFingerprintEqual(c *gc.C) {
+	one := parseTestKey(c, sshtesting.ValidKeyOne.Key)
+	two := parseTestKey(c, sshtesting.ValidKeyTwo.Key)
+	f1, err := ssh.NewFingerprint(one, crypto.SHA256)
+	c.Assert(err, jc.ErrorIsNil)
+	f2, err := ssh.ParseFingerprint(f1.String())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(f1.Equal(f2), jc.IsTrue)
+	c.Check(f1.Matches(two), jc.IsFalse)
+
+	md5, err := ssh.NewFingerprint(one, crypto.MD5)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(f1.Equal(md5), jc.IsFalse)
+	c.Check(md5.Matches(one), jc.IsTrue)
+	c.Check(ssh.Fingerprint{}.Equal(ssh.Fingerprint{}), jc.IsFalse)
+}
+
+func (s *FingerprintSuite) TestAuthorisedKeyFingerprint(c *gc.C) {
+	f, comment, err := ssh.AuthorisedKeyFingerprint(`no-pty,command="true" `+ed25519TestKey, crypto.SHA256)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(f.String(), gc.Equals, "SHA256:IOtUx5wMYRQJVGek+B+pkzGtaE3zjCv0QrBECWxo2KY")
+	c.Check(comment, gc.Equals, "test")
+
+	_, _, err = ssh.AuthorisedKeyFingerprint("invalid key", crypto.SHA256)
+	c.Assert(err, gc.ErrorMatches, `invalid authorized_key "invalid key"`)
+}
+
+func (s *FingerprintSuite) TestRandomArt(c *gc.C) {
+	// The expected images were made by ssh-keygen -lv.
+	for _, test := range []struct {
+		key      string
+		hash     crypto.Hash
+		expected string
+	}{{
+		key:  sshtesting.ValidKeyOne.Key,
+		hash: crypto.SHA256,
+		expected: `
++---[RSA 2048]----+
+|                 |
+|         . .     |
+|        . +      |
+| o       . o     |
+|+ o .   S o .    |
+|oo = + + o o o   |
+|.oo B = o = ..o  |
+|..oo X . +.E++   |
+|=oo=O.o.o..o.oo. |
++----[SHA256]-----+`[1:],
+	}, {
+		key:  sshtesting.ValidKeyOne.Key,
+		hash: crypto.MD5,
+		expected: `
++---[RSA 2048]----+
+|  o...           |
+| . .. .          |
+|    .o .         |
+|   .E.oo         |
+|   .+ ooS        |
+|   . o +.o       |
+|  o +   + +      |
+| o + .   =       |
+|  o     .        |
++------[MD5]------+`[1:],
+	}, {
+		key:  ed25519TestKey,
+		hash: crypto.SHA256,
+		expected: `
++--[ED25519 256]--+
+|=o oo+B=+        |
+|o+=  o.O .       |
+|o+  o + *        |
+|E o  = + .       |
+| . oo * S        |
+|  .oo+ % .       |
+|   o+.B +        |
+|   .o .o         |
+|     o.          |
++----[SHA256]-----+`[1:],
+	}, {
+		key:  "ecdsa-sha2-nistp256 AAAAE2VjZHNhLXNoYTItbmlzdHAyNTYAAAAIbmlzdHAyNTYAAABBBLD9t8eZWI3KpKn6gotWhBt+0s63woo4jXWss8Kwbe21Q9jN9PfDyfAYrxQA9Rd4eqXq7N4XvuR+/jPLTXVZD5o= test",
+		hash: crypto.SHA256,
+		expected: `
++---[ECDSA 256]---+
+|/o=              |
+|=@ o             |
+|O O          .   |
+|BE.=   .    . .  |
+|==.+    S  o .   |
+|o + .  oo.o .    |
+|     . o =o      |
+|      ..+oo.     |
+|      oo.o.      |
++----[SHA256]-----+`[1:],
+	}} {
+		art, err := ssh.RandomArt(parseTestKey(c, test.key), test.hash)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(art, gc.Equals, test.expected)
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package ssh
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/juju/errors"
+)
+
+// CommandFunc runs a command in place of a remote one, reading its
+// input from stdin and writing its output to stdout and stderr. The
+// context is cancelled if the command is killed. The error returned
+// is returned by Cmd.Wait; return cmd.NewRcPassthroughError to report
+// a non-zero exit status, as Cmd.Run does for remote commands.
+type CommandFunc func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error
+
+// NewFuncCmd returns a Cmd that runs f in place of the command args
+// on host, with its I/O recorded and transformed as set in options.
+// It allows fake clients to be implemented without a server.
+func NewFuncCmd(host string, args []string, options *Options, f CommandFunc) *Cmd {
+	return options.newCmd(&funcCommand{f: f}, host, args)
+}
+
+// funcCommand is the command of a Cmd created by NewFuncCmd.
+type funcCommand struct {
+	f CommandFunc
+
+	stdin          io.Reader
+	stdout, stderr io.Writer
+
+	// pipes holds the write ends of the output pipes,
+	// which are closed when f returns.
+	pipes []*io.PipeWriter
+
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	done    chan struct{}
+	err     error
+	waited  bool
+	started bool
+}
+
+// Start implements command.Start.
+func (c *funcCommand) Start() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.started {
+		return errors.New("ssh: already started")
+	}
+	c.started = true
+	stdin, stdout, stderr := c.stdin, c.stdout, c.stderr
+	if stdin == nil {
+		stdin = strings.NewReader("")
+	}
+	if stdout == nil {
+		stdout = ioutil.Discard
+	}
+	if stderr == nil {
+		stderr = ioutil.Discard
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	c.done = make(chan struct{})
+	go func() {
+		defer close(c.done)
+		defer cancel()
+		c.err = c.f(ctx, stdin, stdout, stderr)
+		for _, w := range c.pipes {
+			w.Close()
+		}
+	}()
+	return nil
+}
+
+// Wait implements command.Wait.
+func (c *funcCommand) Wait() error {
+	c.mu.Lock()
+	if !c.started {
+		c.mu.Unlock()
+		return errors.New("ssh: not started")
+	}
+	if c.waited {
+		c.mu.Unlock()
+		return errors.New("ssh: Wait already called")
+	}
+	c.waited = true
+	c.mu.Unlock()
+	<-c.done
+	return c.err
+}
+
+// Kill implements command.Kill.
+func (c *funcCommand) Kill() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.started {
+		return errors.New("ssh: not started")
+	}
+	c.cancel()
+	return nil
+}
+
+// SetStdio implements command.SetStdio.
+func (c *funcCommand) SetStdio(stdin io.Reader, stdout, stderr io.Writer) {
+	c.stdin = stdin
+	c.stdout = stdout
+	c.stderr = stderr
+}
+
+// StdinPipe implements command.StdinPipe.
+func (c *funcCommand) StdinPipe() (io.WriteCloser, io.Reader, error) {
+	r, w := io.Pipe()
+	return w, r, nil
+}
+
+// StdoutPipe implements command.StdoutPipe.
+func (c *funcCommand) StdoutPipe() (io.ReadCloser, io.Writer, error) {
+	return c.outputPipe()
+}
+
+// StderrPipe implements command.StderrPipe.
+func (c *funcCommand) StderrPipe() (io.ReadCloser, io.Writer, error) {
+	return c.outputPipe()
+}
+
+func (c *funcCommand) outputPipe() (io.ReadCloser, io.Writer, error) {
+	r, w := io.Pipe()
+	c.pipes = append(c.pipes, w)
+	return r, w, nil
+}
@@ -13,6 +13,8 @@ import (
 
 	"github.com/juju/errors"
 	"golang.org/x/crypto/ssh"
+
+	"github.com/juju/utils/v3/secrets"
 )
 
 // rsaGenerateKey allows for tests to patch out rsa key generation
@@ -28,23 +30,36 @@ var KeyBits = 4096
 // be added into an authorized_keys file, and has the comment passed in as the
 // comment part of the key.
 func GenerateKey(comment string) (private, public string, err error) {
-	key, err := rsaGenerateKey(rand.Reader, KeyBits)
+	identity, public, err := generateKey(comment)
 	if err != nil {
 		return "", "", errors.Trace(err)
 	}
+	return string(identity), public, nil
+}
+
+// generateKey is like GenerateKey, but returns the private key as a
+// byte slice, so that callers that do not need a string can zero it.
+func generateKey(comment string) (private []byte, public string, err error) {
+	key, err := rsaGenerateKey(rand.Reader, KeyBits)
+	if err != nil {
+		return nil, "", errors.Trace(err)
+	}
 
+	der := x509.MarshalPKCS1PrivateKey(key)
+	defer secrets.Zero(der)
 	identity := pem.EncodeToMemory(
 		&pem.Block{
 			Type:  "RSA PRIVATE KEY",
-			Bytes: x509.MarshalPKCS1PrivateKey(key),
+			Bytes: der,
 		})
 
 	public, err = PublicKey(identity, comment)
 	if err != nil {
-		return "", "", errors.Trace(err)
+		secrets.Zero(identity)
+		return nil, "", errors.Trace(err)
 	}
 
-	return string(identity), public, nil
+	return identity, public, nil
 }
 
 // PublicKey returns the public key for any private key. The public key is
@@ -0,0 +1,72 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package ssh
+
+import (
+	"net"
+
+	"github.com/juju/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+// GSSAPIClientFunc returns a new GSSAPI client with which to
+// authenticate a single connection.
+type GSSAPIClientFunc func() (ssh.GSSAPIClient, error)
+
+// defaultGSSAPIClient creates the GSSAPI client used if
+// EnableGSSAPIAuth is given none. It is only set when the
+// package is built with the krb5 build tag.
+var defaultGSSAPIClient GSSAPIClientFunc
+
+// EnableGSSAPIAuth enables gssapi-with-mic authentication, as used
+// for single sign-on with Kerberos, which is tried before public key
+// authentication. The go.crypto client authenticates with a client
+// returned by newClient. If newClient is nil, a Kerberos 5 client
+// using the user's credential cache is used if the package was built
+// with the krb5 build tag; otherwise GSSAPI authentication is not
+// available and commands fail unless they can authenticate with a
+// public key.
+//
+// The OpenSSH client ignores newClient and uses the system's GSSAPI
+// implementation, as OpenSSH's GSSAPIAuthentication option does.
+func (o *Options) EnableGSSAPIAuth(newClient GSSAPIClientFunc) {
+	o.gssapiAuth = true
+	o.gssapiClient = newClient
+}
+
+// gssapiAuthMethod returns the method with which to authenticate
+// with GSSAPI to the host at addr.
+func gssapiAuthMethod(newClient GSSAPIClientFunc, addr string, events eventSink) (ssh.AuthMethod, error) {
+	if newClient == nil {
+		newClient = defaultGSSAPIClient
+	}
+	if newClient == nil {
+		return nil, errors.NotSupportedf("GSSAPI authentication without the krb5 build tag")
+	}
+	client, err := newClient()
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot create GSSAPI client")
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	return ssh.GSSAPIWithMICAuthMethod(&gssapiEventClient{client, addr, events}, host), nil
+}
+
+// gssapiEventClient sends EventAuthenticating when
+// GSSAPI authentication begins.
+type gssapiEventClient struct {
+	ssh.GSSAPIClient
+	addr   string
+	events eventSink
+}
+
+// InitSecContext implements ssh.GSSAPIClient.InitSecContext.
+func (c *gssapiEventClient) InitSecContext(target string, token []byte, isGSSDelegCreds bool) ([]byte, bool, error) {
+	if token == nil {
+		c.events.send(EventAuthenticating, c.addr, nil)
+	}
+	return c.GSSAPIClient.InitSecContext(target, token, isGSSDelegCreds)
+}
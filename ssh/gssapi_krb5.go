@@ -0,0 +1,143 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+//go:build krb5
+// +build krb5
+
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	krbcrypto "github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/juju/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+func init() {
+	defaultGSSAPIClient = NewKerberosGSSAPIClient
+}
+
+// NewKerberosGSSAPIClient returns a GSSAPI client that authenticates
+// with the Kerberos 5 tickets in the user's credential cache, as
+// obtained with kinit. The cache and the Kerberos configuration are
+// found as by the MIT tools, using $KRB5CCNAME and $KRB5_CONFIG.
+// Only file credential caches are supported.
+func NewKerberosGSSAPIClient() (ssh.GSSAPIClient, error) {
+	confPath := os.Getenv("KRB5_CONFIG")
+	if confPath == "" {
+		confPath = "/etc/krb5.conf"
+	}
+	conf, err := config.Load(confPath)
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot load Kerberos configuration")
+	}
+	ccachePath := os.Getenv("KRB5CCNAME")
+	if ccachePath == "" {
+		ccachePath = fmt.Sprintf("/tmp/krb5cc_%d", os.Getuid())
+	} else if strings.HasPrefix(ccachePath, "FILE:") {
+		ccachePath = strings.TrimPrefix(ccachePath, "FILE:")
+	} else if strings.Contains(ccachePath, ":") {
+		return nil, errors.NotSupportedf("credential cache %q", ccachePath)
+	}
+	ccache, err := credentials.LoadCCache(ccachePath)
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot load Kerberos credential cache")
+	}
+	cl, err := client.NewFromCCache(ccache, conf, client.DisablePAFXFAST(true))
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &kerberosClient{client: cl}, nil
+}
+
+// kerberosClient implements ssh.GSSAPIClient with the Kerberos 5
+// GSSAPI mechanism.
+type kerberosClient struct {
+	client *client.Client
+	key    types.EncryptionKey
+
+	// acceptorSubkey records whether key is a
+	// subkey chosen by the server.
+	acceptorSubkey bool
+}
+
+// InitSecContext implements ssh.GSSAPIClient.InitSecContext. The
+// target is a host-based service name, such as "host@server.example",
+// for which the server is sent an AP-REQ asking for mutual
+// authentication, to which it replies with an AP-REP.
+func (c *kerberosClient) InitSecContext(target string, token []byte, isGSSDelegCreds bool) ([]byte, bool, error) {
+	if token == nil {
+		ticket, key, err := c.client.GetServiceTicket(strings.Replace(target, "@", "/", 1))
+		if err != nil {
+			return nil, false, errors.Annotatef(err, "cannot get service ticket for %s", target)
+		}
+		c.key = key
+		apreq, err := spnego.NewKRB5TokenAPREQ(
+			c.client, ticket, key,
+			[]int{gssapi.ContextFlagInteg, gssapi.ContextFlagMutual},
+			[]int{flags.APOptionMutualRequired},
+		)
+		if err != nil {
+			return nil, false, errors.Trace(err)
+		}
+		data, err := apreq.Marshal()
+		if err != nil {
+			return nil, false, errors.Trace(err)
+		}
+		return data, true, nil
+	}
+
+	var reply spnego.KRB5Token
+	if err := reply.Unmarshal(token); err != nil {
+		return nil, false, errors.Annotate(err, "cannot parse GSSAPI reply")
+	}
+	switch {
+	case reply.IsKRBError():
+		return nil, false, errors.Errorf("Kerberos error: %v", reply.KRBError.Error())
+	case !reply.IsAPRep():
+		return nil, false, errors.New("unexpected GSSAPI reply")
+	}
+	data, err := krbcrypto.DecryptEncPart(reply.APRep.EncPart, c.key, keyusage.AP_REP_ENCPART)
+	if err != nil {
+		return nil, false, errors.Annotate(err, "cannot decrypt AP-REP")
+	}
+	var part messages.EncAPRepPart
+	if err := part.Unmarshal(data); err != nil {
+		return nil, false, errors.Annotate(err, "cannot parse AP-REP")
+	}
+	if part.Subkey.KeyType != 0 {
+		c.key = part.Subkey
+		c.acceptorSubkey = true
+	}
+	return nil, false, nil
+}
+
+// GetMIC implements ssh.GSSAPIClient.GetMIC.
+func (c *kerberosClient) GetMIC(micField []byte) ([]byte, error) {
+	token := gssapi.MICToken{Payload: micField}
+	if c.acceptorSubkey {
+		token.Flags = gssapi.MICTokenFlagAcceptorSubkey
+	}
+	if err := token.SetChecksum(c.key, keyusage.GSSAPI_INITIATOR_SIGN); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return token.Marshal()
+}
+
+// DeleteSecContext implements ssh.GSSAPIClient.DeleteSecContext.
+func (c *kerberosClient) DeleteSecContext() error {
+	c.key = types.EncryptionKey{}
+	return nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package ssh
+
+import (
+	"strconv"
+	"strings"
+)
+
+// splitUserHost splits a host specification of the form [user@]host
+// into its user, host and port. The host may be an IPv6 address, with
+// or without brackets and with an optional zone, as in "fe80::1%eth0".
+// A bracketed host may be followed by a port, as in "[::1]:2222" or
+// "ubuntu@[10.0.0.1]:2222"; the port is zero if there is none. The
+// returned host has no brackets.
+func splitUserHost(s string) (user, host string, port int) {
+	if i := strings.LastIndex(s, "@"); i >= 0 {
+		user, s = s[:i], s[i+1:]
+	}
+	end := strings.Index(s, "]")
+	if !strings.HasPrefix(s, "[") || end < 0 {
+		return user, s, 0
+	}
+	host, rest := s[1:end], s[end+1:]
+	if rest == "" {
+		return user, host, 0
+	}
+	if strings.HasPrefix(rest, ":") {
+		if p, err := strconv.Atoi(rest[1:]); err == nil && p > 0 && p <= 65535 {
+			return user, host, p
+		}
+	}
+	// Not a host we understand, so leave it to fail later.
+	return user, s, 0
+}
+
+// joinUserHost returns the host specification for user and host,
+// which must not be bracketed. The specification for an IPv6 host is
+// bracketed if bracket is true, as scp requires, and not otherwise,
+// as ssh requires.
+func joinUserHost(user, host string, bracket bool) string {
+	if bracket && strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if user == "" {
+		return host
+	}
+	return user + "@" + host
+}
+
+// hostOptions returns the host to pass to ssh and scp for a host
+// specification, with the options to use with it. If the specification
+// includes a port, it takes precedence over any port in options.
+func hostOptions(spec string, options *Options, bracket bool) (string, *Options) {
+	user, host, port := splitUserHost(spec)
+	if port != 0 {
+		var opts Options
+		if options != nil {
+			opts = *options
+		}
+		opts.port = port
+		options = &opts
+	}
+	return joinUserHost(user, host, bracket), options
+}
+
+// CopyTarget returns the argument to Client.Copy naming path on host,
+// which is given as to Client.Command. IPv6 addresses are bracketed,
+// so that their colons are not mistaken for the one separating the
+// host from the path. A port in host is ignored; use Options.SetPort
+// to copy to another port.
+func CopyTarget(host, path string) string {
+	user, host, _ := splitUserHost(host)
+	return joinUserHost(user, host, true) + ":" + path
+}
+
+// expandProxyTokens expands the tokens understood in a proxy command
+// argument: %h is replaced by the host, %p by the port if it is not
+// empty, %r by the user and %% by a percent sign. The host is never
+// bracketed, so the command may be given an IPv6 address with a zone,
+// as in "fe80::1%eth0", which is not expanded further.
+func expandProxyTokens(arg, host, port, user string) string {
+	var buf strings.Builder
+	for i := 0; i < len(arg); i++ {
+		if arg[i] != '%' || i+1 == len(arg) {
+			buf.WriteByte(arg[i])
+			continue
+		}
+		switch arg[i+1] {
+		case 'h':
+			buf.WriteString(host)
+		case 'p':
+			if port == "" {
+				buf.WriteString("%p")
+			} else {
+				buf.WriteString(port)
+			}
+		case 'r':
+			buf.WriteString(user)
+		case '%':
+			buf.WriteByte('%')
+		default:
+			buf.WriteString(arg[i : i+2])
+		}
+		i++
+	}
+	return buf.String()
+}
@@ -0,0 +1,74 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package ssh_test
+
+import (
+	"github.com/juju/testing"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/ssh"
+)
+
+type HostSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&HostSuite{})
+
+func (s *HostSuite) TestSplitUserHost(c *gc.C) {
+	for i, test := range []struct {
+		spec string
+		user string
+		host string
+		port int
+	}{
+		{spec: "10.0.0.1", host: "10.0.0.1"},
+		{spec: "ubuntu@host.example", user: "ubuntu", host: "host.example"},
+		{spec: "me@corp@host", user: "me@corp", host: "host"},
+		{spec: "::1", host: "::1"},
+		{spec: "[::1]", host: "::1"},
+		{spec: "ubuntu@2001:db8::1", user: "ubuntu", host: "2001:db8::1"},
+		{spec: "ubuntu@[2001:db8::1]", user: "ubuntu", host: "2001:db8::1"},
+		{spec: "ubuntu@[2001:db8::1]:2222", user: "ubuntu", host: "2001:db8::1", port: 2222},
+		{spec: "fe80::1%eth0", host: "fe80::1%eth0"},
+		{spec: "root@[fe80::1%eth0]:22", user: "root", host: "fe80::1%eth0", port: 22},
+		{spec: "[10.0.0.1]:2222", host: "10.0.0.1", port: 2222},
+		{spec: "[::1]:http", host: "[::1]:http"},
+		{spec: "[::1]:0", host: "[::1]:0"},
+		{spec: "[::1", host: "[::1"},
+	} {
+		c.Logf("test %d: %s", i, test.spec)
+		user, host, port := ssh.SplitUserHost(test.spec)
+		c.Check(user, gc.Equals, test.user)
+		c.Check(host, gc.Equals, test.host)
+		c.Check(port, gc.Equals, test.port)
+	}
+}
+
+func (s *HostSuite) TestCopyTarget(c *gc.C) {
+	c.Check(ssh.CopyTarget("host", "/tmp/x"), gc.Equals, "host:/tmp/x")
+	c.Check(ssh.CopyTarget("ubuntu@10.0.0.1", "x"), gc.Equals, "ubuntu@10.0.0.1:x")
+	c.Check(ssh.CopyTarget("ubuntu@2001:db8::1", "x"), gc.Equals, "ubuntu@[2001:db8::1]:x")
+	c.Check(ssh.CopyTarget("ubuntu@[2001:db8::1]:2222", "x"), gc.Equals, "ubuntu@[2001:db8::1]:x")
+	c.Check(ssh.CopyTarget("fe80::1%eth0", "x"), gc.Equals, "[fe80::1%eth0]:x")
+}
+
+func (s *HostSuite) TestExpandProxyTokens(c *gc.C) {
+	for i, test := range []struct {
+		arg    string
+		host   string
+		port   string
+		expect string
+	}{
+		{arg: "%h:%p", host: "10.0.0.1", port: "22", expect: "10.0.0.1:22"},
+		{arg: "[%h]:%p", host: "2001:db8::1", port: "2222", expect: "[2001:db8::1]:2222"},
+		{arg: "%h", host: "fe80::1%pr", port: "22", expect: "fe80::1%pr"},
+		{arg: "%r@%h", host: "host", expect: "ubuntu@host"},
+		{arg: "%p", host: "host", expect: "%p"},
+		{arg: "100%% %x %", host: "host", expect: "100% %x %"},
+	} {
+		c.Logf("test %d: %s", i, test.arg)
+		c.Check(ssh.ExpandProxyTokens(test.arg, test.host, test.port, "ubuntu"), gc.Equals, test.expect)
+	}
+}
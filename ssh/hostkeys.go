@@ -0,0 +1,182 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package ssh
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/clock"
+	"github.com/juju/errors"
+	"github.com/juju/mutex/v2"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/juju/utils/v3"
+)
+
+// HostKeyStore holds the host keys trusted by the go.crypto client,
+// in place of a known_hosts file. Hosts are named as in known_hosts
+// files: "host" for the default port and "[host]:port" otherwise.
+type HostKeyStore interface {
+	// HostKeys returns the keys trusted for the host, if any.
+	HostKeys(host string) ([]ssh.PublicKey, error)
+
+	// AddHostKey adds a key to those trusted for the host.
+	AddHostKey(host string, key ssh.PublicKey) error
+}
+
+// SetHostKeyStore makes the go.crypto client check and record host
+// keys in the given store instead of a known_hosts file, so that the
+// user's known_hosts file is neither read nor modified. Keys for
+// unknown hosts are handled as set by SetStrictHostKeyChecking; to
+// trust each host's key on first use without prompting, use
+// StrictHostChecksNo. The OpenSSH client ignores this option.
+func (o *Options) SetHostKeyStore(store HostKeyStore) {
+	o.hostKeyStore = store
+}
+
+// NewMemoryHostKeyStore returns a HostKeyStore that holds
+// keys in memory.
+func NewMemoryHostKeyStore() HostKeyStore {
+	return &memoryHostKeyStore{keys: make(map[string][]ssh.PublicKey)}
+}
+
+type memoryHostKeyStore struct {
+	mu   sync.Mutex
+	keys map[string][]ssh.PublicKey
+}
+
+// HostKeys implements HostKeyStore.HostKeys.
+func (s *memoryHostKeyStore) HostKeys(host string) ([]ssh.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ssh.PublicKey(nil), s.keys[host]...), nil
+}
+
+// AddHostKey implements HostKeyStore.AddHostKey.
+func (s *memoryHostKeyStore) AddHostKey(host string, key ssh.PublicKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !containsKey(s.keys[host], key) {
+		s.keys[host] = append(s.keys[host], key)
+	}
+	return nil
+}
+
+// FileHostKeyStore is a HostKeyStore that keeps keys in a JSON file,
+// mapping each host to a list of keys in authorized_keys format.
+// The file is replaced atomically when a key is added, and writers
+// in other processes are excluded while it is updated.
+type FileHostKeyStore struct {
+	path  string
+	clock clock.Clock
+	mu    sync.Mutex
+}
+
+// NewFileHostKeyStore returns a store that keeps keys in the file
+// at path, which is created when the first key is added.
+func NewFileHostKeyStore(path string) *FileHostKeyStore {
+	return &FileHostKeyStore{path: path, clock: clock.WallClock}
+}
+
+// HostKeys implements HostKeyStore.HostKeys.
+func (s *FileHostKeyStore) HostKeys(host string) ([]ssh.PublicKey, error) {
+	hosts, err := s.read()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var keys []ssh.PublicKey
+	for _, line := range hosts[host] {
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			return nil, errors.Annotatef(err, "invalid key for %s in %s", host, s.path)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// AddHostKey implements HostKeyStore.AddHostKey.
+func (s *FileHostKeyStore) AddHostKey(host string, key ssh.PublicKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	releaser, err := mutex.Acquire(mutex.Spec{
+		Name:  "juju-ssh-client",
+		Clock: s.clock,
+		Delay: time.Second,
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer releaser.Release()
+
+	hosts, err := s.read()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	line := strings.TrimSuffix(string(ssh.MarshalAuthorizedKey(key)), "\n")
+	for _, existing := range hosts[host] {
+		if existing == line {
+			return nil
+		}
+	}
+	hosts[host] = append(hosts[host], line)
+	data, err := json.MarshalIndent(hosts, "", "  ")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(utils.AtomicWriteFile(s.path, append(data, '\n'), 0600))
+}
+
+// Hosts returns the hosts with keys in the store, sorted by name.
+func (s *FileHostKeyStore) Hosts() ([]string, error) {
+	hosts, err := s.read()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	names := make([]string, 0, len(hosts))
+	for host := range hosts {
+		names = append(names, host)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// String returns the path of the store's file.
+func (s *FileHostKeyStore) String() string {
+	return s.path
+}
+
+// read returns the contents of the store's file, which
+// is empty if the file does not exist.
+func (s *FileHostKeyStore) read() (map[string][]string, error) {
+	hosts := make(map[string][]string)
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return hosts, nil
+	} else if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err := json.Unmarshal(data, &hosts); err != nil {
+		return nil, errors.Annotatef(err, "cannot parse host key store %s", s.path)
+	}
+	return hosts, nil
+}
+
+// containsKey reports whether key is one of keys.
+func containsKey(keys []ssh.PublicKey, key ssh.PublicKey) bool {
+	data := key.Marshal()
+	for _, k := range keys {
+		if bytes.Equal(k.Marshal(), data) {
+			return true
+		}
+	}
+	return false
+}
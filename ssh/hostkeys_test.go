@@ -0,0 +1,97 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package ssh_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	cryptossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/testdata"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/ssh"
+)
+
+type HostKeyStoreSuite struct {
+	testing.IsolationSuite
+	keys []cryptossh.PublicKey
+}
+
+var _ = gc.Suite(&HostKeyStoreSuite{})
+
+func (s *HostKeyStoreSuite) SetUpSuite(c *gc.C) {
+	s.IsolationSuite.SetUpSuite(c)
+	s.keys = nil
+	for _, t := range []string{"rsa", "ed25519"} {
+		signer, err := cryptossh.ParsePrivateKey(testdata.PEMBytes[t])
+		c.Assert(err, jc.ErrorIsNil)
+		s.keys = append(s.keys, signer.PublicKey())
+	}
+}
+
+func (s *HostKeyStoreSuite) checkStore(c *gc.C, store ssh.HostKeyStore) {
+	keys, err := store.HostKeys("[10.0.0.1]:2222")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(keys, gc.HasLen, 0)
+
+	for _, key := range append(s.keys, s.keys[0]) {
+		err := store.AddHostKey("[10.0.0.1]:2222", key)
+		c.Assert(err, jc.ErrorIsNil)
+	}
+	err = store.AddHostKey("10.0.0.2", s.keys[1])
+	c.Assert(err, jc.ErrorIsNil)
+
+	keys, err = store.HostKeys("[10.0.0.1]:2222")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(keys, jc.DeepEquals, s.keys)
+	keys, err = store.HostKeys("10.0.0.2")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(keys, jc.DeepEquals, s.keys[1:])
+	keys, err = store.HostKeys("10.0.0.1")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(keys, gc.HasLen, 0)
+}
+
+func (s *HostKeyStoreSuite) TestMemoryStore(c *gc.C) {
+	s.checkStore(c, ssh.NewMemoryHostKeyStore())
+}
+
+func (s *HostKeyStoreSuite) TestFileStore(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "hostkeys.json")
+	store := ssh.NewFileHostKeyStore(path)
+	c.Check(store.String(), gc.Equals, path)
+	s.checkStore(c, store)
+
+	info, err := os.Stat(path)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(info.Mode().Perm(), gc.Equals, os.FileMode(0600))
+
+	// A new store reads the keys back from the file.
+	hosts, err := ssh.NewFileHostKeyStore(path).Hosts()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(hosts, jc.DeepEquals, []string{"10.0.0.2", "[10.0.0.1]:2222"})
+	keys, err := ssh.NewFileHostKeyStore(path).HostKeys("10.0.0.2")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(keys, jc.DeepEquals, s.keys[1:])
+}
+
+func (s *HostKeyStoreSuite) TestFileStoreInvalid(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "hostkeys.json")
+	err := ioutil.WriteFile(path, []byte("not json"), 0600)
+	c.Assert(err, jc.ErrorIsNil)
+	store := ssh.NewFileHostKeyStore(path)
+	_, err = store.HostKeys("host")
+	c.Check(err, gc.ErrorMatches, "cannot parse host key store .*hostkeys.json: .*")
+	err = store.AddHostKey("host", s.keys[0])
+	c.Check(err, gc.ErrorMatches, "cannot parse host key store .*hostkeys.json: .*")
+
+	err = ioutil.WriteFile(path, []byte(`{"host": ["ssh-rsa !!!"]}`), 0600)
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = store.HostKeys("host")
+	c.Check(err, gc.ErrorMatches, "invalid key for host in .*hostkeys.json: .*")
+}
@@ -0,0 +1,210 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package ssh
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"math/big"
+
+	"github.com/juju/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// openSSHKeyMagic starts the data of a key in the OpenSSH format.
+	openSSHKeyMagic = "openssh-key-v1\x00"
+
+	// openSSHKDFRounds is the number of bcrypt_pbkdf rounds used
+	// to encrypt keys, as by ssh-keygen.
+	openSSHKDFRounds = 16
+)
+
+// ParsePrivateKey parses a PEM encoded RSA, ECDSA or Ed25519 private
+// key in any of the PKCS#1, SEC 1, PKCS#8 and OpenSSH formats. If the
+// key is encrypted, it is decrypted with passphrase; otherwise the
+// passphrase is ignored. Ed25519 keys are returned as
+// ed25519.PrivateKey values, and other keys as pointers.
+//
+// A key can be converted between formats by parsing it and marshaling
+// the result with MarshalOpenSSHPrivateKey or MarshalPKCS8PrivateKey.
+func ParsePrivateKey(data, passphrase []byte) (crypto.Signer, error) {
+	key, err := ssh.ParseRawPrivateKey(data)
+	if _, ok := err.(*ssh.PassphraseMissingError); ok {
+		if len(passphrase) == 0 {
+			return nil, errors.New("private key is encrypted and no passphrase was given")
+		}
+		key, err = ssh.ParseRawPrivateKeyWithPassphrase(data, passphrase)
+	}
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot parse private key")
+	}
+	switch key := key.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey:
+		return key.(crypto.Signer), nil
+	case *ed25519.PrivateKey:
+		return *key, nil
+	default:
+		return nil, errors.NotSupportedf("private key type %T", key)
+	}
+}
+
+// MarshalPKCS8PrivateKey returns key, which must be an RSA, ECDSA or
+// Ed25519 private key, PEM encoded in PKCS#8 format.
+func MarshalPKCS8PrivateKey(key crypto.PrivateKey) ([]byte, error) {
+	if k, ok := key.(*ed25519.PrivateKey); ok {
+		key = *k
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// MarshalOpenSSHPrivateKey returns key, which must be an RSA, ECDSA
+// or Ed25519 private key, PEM encoded in the OpenSSH format written
+// by ssh-keygen, with the given comment. If passphrase is not empty,
+// the key is encrypted with it as ssh-keygen does, using AES-256 in
+// CTR mode with a key derived by bcrypt_pbkdf.
+func MarshalOpenSSHPrivateKey(key crypto.PrivateKey, comment string, passphrase []byte) ([]byte, error) {
+	if k, ok := key.(*ed25519.PrivateKey); ok {
+		key = *k
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	private, err := openSSHPrivateKeyFields(key, comment)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	header := struct {
+		CipherName string
+		KDFName    string
+		KDFOptions string
+		NumKeys    uint32
+		PublicKey  []byte
+	}{"none", "none", "", 1, signer.PublicKey().Marshal()}
+	blockSize := 8
+	var stream cipher.Stream
+	if len(passphrase) > 0 {
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, errors.Trace(err)
+		}
+		k, err := bcryptPBKDF(passphrase, salt, openSSHKDFRounds, 32+aes.BlockSize)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		block, err := aes.NewCipher(k[:32])
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		stream = cipher.NewCTR(block, k[32:])
+		blockSize = aes.BlockSize
+		header.CipherName = "aes256-ctr"
+		header.KDFName = "bcrypt"
+		header.KDFOptions = string(ssh.Marshal(struct {
+			Salt   []byte
+			Rounds uint32
+		}{salt, openSSHKDFRounds}))
+	}
+
+	// The private section starts with a random number, repeated
+	// so that a wrong passphrase can be detected, and is padded
+	// to a whole number of cipher blocks.
+	var check [4]byte
+	if _, err := rand.Read(check[:]); err != nil {
+		return nil, errors.Trace(err)
+	}
+	checkValue := binary.BigEndian.Uint32(check[:])
+	section := ssh.Marshal(struct {
+		Check1 uint32
+		Check2 uint32
+	}{checkValue, checkValue})
+	section = append(section, private...)
+	for i := byte(1); len(section)%blockSize != 0; i++ {
+		section = append(section, i)
+	}
+	if stream != nil {
+		stream.XORKeyStream(section, section)
+	}
+
+	data := append([]byte(openSSHKeyMagic), ssh.Marshal(header)...)
+	data = append(data, ssh.Marshal(struct{ Section []byte }{section})...)
+	return pem.EncodeToMemory(&pem.Block{Type: "OPENSSH PRIVATE KEY", Bytes: data}), nil
+}
+
+// openSSHPrivateKeyFields returns the type, fields and comment of a
+// private key as they appear in the OpenSSH format.
+func openSSHPrivateKeyFields(key crypto.PrivateKey, comment string) ([]byte, error) {
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		if len(key.Primes) != 2 {
+			return nil, errors.NotSupportedf("RSA key with %d primes", len(key.Primes))
+		}
+		key.Precompute()
+		return ssh.Marshal(struct {
+			KeyType string
+			N       *big.Int
+			E       *big.Int
+			D       *big.Int
+			Iqmp    *big.Int
+			P       *big.Int
+			Q       *big.Int
+			Comment string
+		}{
+			ssh.KeyAlgoRSA,
+			key.N, big.NewInt(int64(key.E)), key.D,
+			key.Precomputed.Qinv, key.Primes[0], key.Primes[1],
+			comment,
+		}), nil
+	case *ecdsa.PrivateKey:
+		var keyType, curve string
+		switch key.Curve {
+		case elliptic.P256():
+			keyType, curve = ssh.KeyAlgoECDSA256, "nistp256"
+		case elliptic.P384():
+			keyType, curve = ssh.KeyAlgoECDSA384, "nistp384"
+		case elliptic.P521():
+			keyType, curve = ssh.KeyAlgoECDSA521, "nistp521"
+		default:
+			return nil, errors.NotSupportedf("ECDSA curve %s", key.Curve.Params().Name)
+		}
+		return ssh.Marshal(struct {
+			KeyType string
+			Curve   string
+			Public  []byte
+			D       *big.Int
+			Comment string
+		}{
+			keyType, curve,
+			elliptic.Marshal(key.Curve, key.X, key.Y), key.D,
+			comment,
+		}), nil
+	case ed25519.PrivateKey:
+		return ssh.Marshal(struct {
+			KeyType string
+			Public  []byte
+			Private []byte
+			Comment string
+		}{
+			ssh.KeyAlgoED25519,
+			[]byte(key.Public().(ed25519.PublicKey)), []byte(key),
+			comment,
+		}), nil
+	}
+	return nil, errors.NotSupportedf("private key type %T", key)
+}
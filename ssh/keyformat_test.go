@@ -0,0 +1,138 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package ssh_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	cryptossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/testdata"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/ssh"
+)
+
+type KeyFormatSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&KeyFormatSuite{})
+
+func (s *KeyFormatSuite) keys(c *gc.C) []crypto.Signer {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	c.Assert(err, jc.ErrorIsNil)
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	c.Assert(err, jc.ErrorIsNil)
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	c.Assert(err, jc.ErrorIsNil)
+	return []crypto.Signer{rsaKey, ecdsaKey, ed25519Key}
+}
+
+func (s *KeyFormatSuite) TestMarshalOpenSSHPrivateKey(c *gc.C) {
+	for _, key := range s.keys(c) {
+		c.Logf("%T", key)
+		data, err := ssh.MarshalOpenSSHPrivateKey(key, "me@host", nil)
+		c.Assert(err, jc.ErrorIsNil)
+		block, _ := pem.Decode(data)
+		c.Assert(block, gc.NotNil)
+		c.Check(block.Type, gc.Equals, "OPENSSH PRIVATE KEY")
+
+		parsed, err := cryptossh.ParseRawPrivateKey(data)
+		c.Assert(err, jc.ErrorIsNil)
+		if k, ok := parsed.(*ed25519.PrivateKey); ok {
+			parsed = *k
+		}
+		c.Check(parsed, jc.DeepEquals, key)
+
+		pub, err := ssh.PublicKey(data, "me@host")
+		c.Assert(err, jc.ErrorIsNil)
+		sshKey, err := cryptossh.NewPublicKey(key.Public())
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(pub, gc.Equals, strings.TrimSpace(string(cryptossh.MarshalAuthorizedKey(sshKey)))+" me@host\n")
+	}
+}
+
+func (s *KeyFormatSuite) TestMarshalOpenSSHPrivateKeyEncrypted(c *gc.C) {
+	for _, key := range s.keys(c) {
+		c.Logf("%T", key)
+		data, err := ssh.MarshalOpenSSHPrivateKey(key, "", []byte("sekrit"))
+		c.Assert(err, jc.ErrorIsNil)
+
+		_, err = cryptossh.ParseRawPrivateKey(data)
+		c.Check(err, gc.FitsTypeOf, &cryptossh.PassphraseMissingError{})
+		_, err = cryptossh.ParseRawPrivateKeyWithPassphrase(data, []byte("wrong"))
+		c.Check(err, gc.Equals, x509.IncorrectPasswordError)
+
+		parsed, err := cryptossh.ParseRawPrivateKeyWithPassphrase(data, []byte("sekrit"))
+		c.Assert(err, jc.ErrorIsNil)
+		if k, ok := parsed.(*ed25519.PrivateKey); ok {
+			parsed = *k
+		}
+		c.Check(parsed, jc.DeepEquals, key)
+	}
+}
+
+func (s *KeyFormatSuite) TestParsePrivateKey(c *gc.C) {
+	for _, t := range []string{"rsa", "ecdsa", "ed25519"} {
+		c.Logf("%s", t)
+		key, err := ssh.ParsePrivateKey(testdata.PEMBytes[t], nil)
+		c.Assert(err, jc.ErrorIsNil)
+		expect, err := cryptossh.ParseRawPrivateKey(testdata.PEMBytes[t])
+		c.Assert(err, jc.ErrorIsNil)
+		if k, ok := expect.(*ed25519.PrivateKey); ok {
+			expect = *k
+		}
+		c.Check(key, jc.DeepEquals, expect)
+	}
+}
+
+func (s *KeyFormatSuite) TestParsePrivateKeyEncrypted(c *gc.C) {
+	data, err := ssh.MarshalOpenSSHPrivateKey(s.keys(c)[2], "", []byte("sekrit"))
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = ssh.ParsePrivateKey(data, nil)
+	c.Check(err, gc.ErrorMatches, "private key is encrypted and no passphrase was given")
+	_, err = ssh.ParsePrivateKey(data, []byte("wrong"))
+	c.Check(err, gc.ErrorMatches, "cannot parse private key: .*")
+	key, err := ssh.ParsePrivateKey(data, []byte("sekrit"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(key, gc.FitsTypeOf, ed25519.PrivateKey{})
+}
+
+func (s *KeyFormatSuite) TestConvert(c *gc.C) {
+	for _, key := range s.keys(c) {
+		c.Logf("%T", key)
+		pkcs8, err := ssh.MarshalPKCS8PrivateKey(key)
+		c.Assert(err, jc.ErrorIsNil)
+		block, _ := pem.Decode(pkcs8)
+		c.Assert(block, gc.NotNil)
+		c.Check(block.Type, gc.Equals, "PRIVATE KEY")
+
+		parsed, err := ssh.ParsePrivateKey(pkcs8, nil)
+		c.Assert(err, jc.ErrorIsNil)
+		openssh, err := ssh.MarshalOpenSSHPrivateKey(parsed, "", []byte("sekrit"))
+		c.Assert(err, jc.ErrorIsNil)
+		parsed, err = ssh.ParsePrivateKey(openssh, []byte("sekrit"))
+		c.Assert(err, jc.ErrorIsNil)
+		converted, err := ssh.MarshalPKCS8PrivateKey(parsed)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(string(converted), gc.Equals, string(pkcs8))
+	}
+}
+
+func (s *KeyFormatSuite) TestMarshalUnsupported(c *gc.C) {
+	key, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = ssh.MarshalOpenSSHPrivateKey(key, "", nil)
+	c.Check(err, gc.ErrorMatches, "ssh: only P-256, P-384 and P-521 EC keys are supported")
+}
@@ -0,0 +1,97 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// defaultControlPersist is how long a master connection is kept
+// open after its last session if EnableMultiplexing is not given
+// a positive duration.
+const defaultControlPersist = time.Minute
+
+// controlDir holds the directory in which the control sockets of
+// master connections are created. If it is empty, a directory
+// private to the user is used.
+var controlDir = ""
+
+// EnableMultiplexing makes the OpenSSH client share a single master
+// connection for all the commands and copies run against the same
+// host, port and user, as OpenSSH's ControlMaster option does. The
+// first command starts the master connection in the background, and
+// it is closed once it has been unused for persist.
+//
+// The control sockets are kept in a directory private to the user,
+// which is created if necessary. If it cannot be created, or on
+// Windows, where OpenSSH does not support multiplexing, each command
+// uses its own connection. The go.crypto client ignores this option.
+func (o *Options) EnableMultiplexing(persist time.Duration) {
+	if persist <= 0 {
+		persist = defaultControlPersist
+	}
+	o.controlPersist = persist
+}
+
+// multiplexOptions returns the OpenSSH options that enable
+// multiplexing as configured by the options, if any.
+func multiplexOptions(options *Options) []string {
+	if options.controlPersist <= 0 || runtime.GOOS == "windows" {
+		return nil
+	}
+	dir, err := ensureControlDir()
+	if err != nil {
+		logger.Warningf("not multiplexing ssh connections: %v", err)
+		return nil
+	}
+	// The %C token, a hash of the connection's local host, remote
+	// host, port and user, keeps the path short enough for a
+	// Unix socket.
+	return []string{
+		"-o", "ControlMaster auto",
+		"-o", "ControlPath " + filepath.Join(dir, "%C"),
+		"-o", fmt.Sprintf("ControlPersist %ds", int64((options.controlPersist+time.Second-1)/time.Second)),
+	}
+}
+
+// ensureControlDir creates the directory for control sockets if
+// necessary and checks that it is a directory, not a symbolic link,
+// that is owned by the current user and private to them, returning its
+// path.
+func ensureControlDir() (string, error) {
+	dir := controlDir
+	if dir == "" {
+		base := os.Getenv("XDG_RUNTIME_DIR")
+		if base == "" {
+			base = os.TempDir()
+		}
+		dir = filepath.Join(base, fmt.Sprintf("juju-ssh-%d", os.Getuid()))
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", errors.Annotate(err, "cannot create control directory")
+	}
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		return "", errors.Errorf("control directory %q is a symbolic link", dir)
+	}
+	if !info.IsDir() {
+		return "", errors.Errorf("control directory %q is not a directory", dir)
+	}
+	if !ownedByUser(info) {
+		return "", errors.Errorf("control directory %q is not owned by the current user", dir)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return "", errors.Errorf("control directory %q is accessible by other users", dir)
+	}
+	return dir, nil
+}
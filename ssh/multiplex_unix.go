@@ -0,0 +1,19 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+//go:build !windows
+// +build !windows
+
+package ssh
+
+import (
+	"os"
+	"syscall"
+)
+
+// ownedByUser reports whether the file described
+// by info is owned by the current user.
+func ownedByUser(info os.FileInfo) bool {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	return ok && int(st.Uid) == os.Getuid()
+}
@@ -0,0 +1,119 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package ssh
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// PingResult describes a successful round trip to an SSH server,
+// with the time taken by each stage of the connection. Stages that
+// did not happen, such as resolving an IP address or connecting
+// when the OpenSSH client reuses a multiplexed connection, take no
+// time.
+type PingResult struct {
+	// ServerVersion holds the version string sent by the server,
+	// such as "SSH-2.0-OpenSSH_8.9p1".
+	ServerVersion string
+
+	// DNS holds the time taken to resolve the host name.
+	DNS time.Duration
+
+	// TCP holds the time taken to establish the network
+	// connection, or to start the proxy command.
+	TCP time.Duration
+
+	// KeyExchange holds the time taken to exchange keys and
+	// verify the server's host key.
+	KeyExchange time.Duration
+
+	// Auth holds the time taken to authenticate.
+	Auth time.Duration
+
+	// RoundTrip holds the time taken by a no-op request
+	// once connected.
+	RoundTrip time.Duration
+
+	// Total holds the time taken by the whole ping.
+	Total time.Duration
+}
+
+// String returns a summary of the result.
+func (r PingResult) String() string {
+	return fmt.Sprintf("%s: dns %v, tcp %v, kex %v, auth %v, round trip %v, total %v",
+		r.ServerVersion, r.DNS, r.TCP, r.KeyExchange, r.Auth, r.RoundTrip, r.Total)
+}
+
+// Pinger is implemented by clients that can check that a host is
+// reachable. Both OpenSSHClient and GoCryptoClient implement it.
+type Pinger interface {
+	// Ping connects and authenticates to the host, specified in
+	// the format [user@]host, makes a no-op request, and reports
+	// how long each stage took. The go.crypto client sends a
+	// keepalive request; the OpenSSH client, which cannot make
+	// requests on its own, runs the command "exit". A host that
+	// does not respond within the timeout set with
+	// Options.SetPingTimeout causes an error with the code
+	// errcode.ErrTimeout.
+	Ping(host string, options *Options) (*PingResult, error)
+}
+
+// defaultPingTimeout is how long a ping may take if
+// SetPingTimeout has not been called.
+const defaultPingTimeout = 30 * time.Second
+
+// SetPingTimeout sets how long Pinger.Ping waits for the host before
+// giving up. The go.crypto client bounds the whole ping by it; the
+// OpenSSH client passes it to ssh as ConnectTimeout, which bounds
+// connecting and the initial exchange with the server. If it is not
+// positive, 30s is used.
+func (o *Options) SetPingTimeout(timeout time.Duration) {
+	o.pingTimeout = timeout
+}
+
+// getPingTimeout returns the timeout set with
+// SetPingTimeout, or defaultPingTimeout.
+func (o *Options) getPingTimeout() time.Duration {
+	if o == nil || o.pingTimeout <= 0 {
+		return defaultPingTimeout
+	}
+	return o.pingTimeout
+}
+
+// Ping is a short-cut for DefaultClient.Ping. It returns an error
+// satisfying errors.IsNotSupported if DefaultClient is not a Pinger.
+func Ping(host string, options *Options) (*PingResult, error) {
+	pinger, ok := DefaultClient.(Pinger)
+	if !ok {
+		return nil, errors.NotSupportedf("ping with %T", DefaultClient)
+	}
+	return pinger.Ping(host, options)
+}
+
+// stageTimer records the time taken by successive stages of a ping.
+type stageTimer struct {
+	now   func() time.Time
+	start time.Time
+	last  time.Time
+}
+
+func newStageTimer(now func() time.Time) *stageTimer {
+	t := now()
+	return &stageTimer{now: now, start: t, last: t}
+}
+
+// done stores the time since the end of the previous stage in *d.
+func (t *stageTimer) done(d *time.Duration) {
+	now := t.now()
+	*d = now.Sub(t.last)
+	t.last = now
+}
+
+// total returns the time since the timer was created.
+func (t *stageTimer) total() time.Duration {
+	return t.now().Sub(t.start)
+}
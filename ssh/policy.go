@@ -0,0 +1,234 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+
+	"github.com/juju/utils/v3/errcode"
+)
+
+// Request describes a remote command, or a copy, that a client
+// is asked to run.
+type Request struct {
+	// Host holds the host the command is run on, in the format
+	// [user@]host. It is empty for copies.
+	Host string
+
+	// Command holds the command to run. For copies, it holds
+	// the arguments passed to Copy.
+	Command []string
+
+	// Copy records whether the request is for a copy.
+	Copy bool
+}
+
+// String returns a description of the request for use in
+// messages and logs.
+func (r Request) String() string {
+	if r.Copy {
+		return fmt.Sprintf("copy %q", r.Command)
+	}
+	return fmt.Sprintf("command %q on %s", r.Command, r.Host)
+}
+
+// Policy decides whether a request may proceed. It returns the
+// command to run, which may be a rewritten version of req.Command,
+// or an error to deny the request.
+type Policy func(req Request) ([]string, error)
+
+// AuditRecord records a decision made by a Policy.
+type AuditRecord struct {
+	// Time holds the time of the decision.
+	Time time.Time
+
+	// Request holds the request as made.
+	Request Request
+
+	// Command holds the command actually run, if the request
+	// was allowed.
+	Command []string
+
+	// Rewritten records whether the policy changed the command.
+	Rewritten bool
+
+	// Err holds the reason for denying the request, or
+	// nil if it was allowed.
+	Err error
+}
+
+// Allowed reports whether the request was allowed.
+func (r AuditRecord) Allowed() bool {
+	return r.Err == nil
+}
+
+// policyClient applies a Policy to the requests made
+// to another Client.
+type policyClient struct {
+	client Client
+	policy Policy
+	audit  func(AuditRecord)
+}
+
+// NewPolicyClient returns a Client that asks policy to approve every
+// command and copy before passing it on to client. If audit is not
+// nil, it is called with a record of each decision before the request
+// proceeds, using the clock of the request's Options.
+//
+// Denied commands fail when started, and denied copies fail
+// immediately. The errors satisfy errors.IsForbidden.
+func NewPolicyClient(client Client, policy Policy, audit func(AuditRecord)) Client {
+	return &policyClient{
+		client: client,
+		policy: policy,
+		audit:  audit,
+	}
+}
+
+// decide applies the policy to req and records the decision.
+func (c *policyClient) decide(req Request, options *Options) ([]string, error) {
+	req.Command = append([]string{}, req.Command...)
+	command, err := c.policy(Request{
+		Host:    req.Host,
+		Command: append([]string{}, req.Command...),
+		Copy:    req.Copy,
+	})
+	if err != nil {
+		msg := fmt.Sprintf("%s denied", req)
+		if errors.IsForbidden(err) {
+			err = errors.Annotate(err, msg)
+		} else {
+			err = errors.NewForbidden(err, msg)
+		}
+		command = nil
+	}
+	if c.audit != nil {
+		c.audit(AuditRecord{
+			Time:      options.getClock().Now(),
+			Request:   req,
+			Command:   command,
+			Rewritten: err == nil && !equalStrings(command, req.Command),
+			Err:       err,
+		})
+	}
+	return command, err
+}
+
+// Command implements Client.Command.
+func (c *policyClient) Command(host string, command []string, options *Options) *Cmd {
+	command, err := c.decide(Request{Host: host, Command: command}, options)
+	if err != nil {
+		logger.Debugf("%v", err)
+		return newCmd(deniedCommand{errcode.Wrap(errcode.ErrForbidden, err)})
+	}
+	return c.client.Command(host, command, options)
+}
+
+// Copy implements Client.Copy.
+func (c *policyClient) Copy(args []string, options *Options) error {
+	args, err := c.decide(Request{Command: args, Copy: true}, options)
+	if err != nil {
+		return errcode.Wrap(errcode.ErrForbidden, errors.Trace(err))
+	}
+	return c.client.Copy(args, options)
+}
+
+// Ping implements Pinger.Ping by passing the ping on to the
+// wrapped client, if it is a Pinger. Pings are not subject to
+// the policy, as they run no commands of the caller's choosing.
+func (c *policyClient) Ping(host string, options *Options) (*PingResult, error) {
+	pinger, ok := c.client.(Pinger)
+	if !ok {
+		return nil, errors.NotSupportedf("ping with %T", c.client)
+	}
+	return pinger.Ping(host, options)
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// deniedCommand is the command of a Cmd denied by a Policy.
+// Every operation fails with the reason for the denial.
+type deniedCommand struct {
+	err error
+}
+
+func (c deniedCommand) Start() error {
+	return c.err
+}
+
+func (c deniedCommand) Wait() error {
+	return c.err
+}
+
+func (c deniedCommand) Kill() error {
+	return c.err
+}
+
+func (c deniedCommand) SetStdio(stdin io.Reader, stdout, stderr io.Writer) {
+}
+
+func (c deniedCommand) StdinPipe() (io.WriteCloser, io.Reader, error) {
+	return nil, nil, c.err
+}
+
+func (c deniedCommand) StdoutPipe() (io.ReadCloser, io.Writer, error) {
+	return nil, nil, c.err
+}
+
+func (c deniedCommand) StderrPipe() (io.ReadCloser, io.Writer, error) {
+	return nil, nil, c.err
+}
+
+// shellMetacharacters are the characters that allow a shell command
+// line to run more than the program it starts with.
+const shellMetacharacters = ";&|`$()<>\n"
+
+// AllowCommands returns a Policy that allows only commands running
+// one of the named programs, and denies all copies. The program is
+// the first element of the command; if the command has a single
+// element, it is treated as a shell command line, its first word is
+// the program, and it is denied if it contains characters that would
+// let it run other programs, such as ";" or "|".
+func AllowCommands(programs ...string) Policy {
+	allowed := make(map[string]bool)
+	for _, program := range programs {
+		allowed[program] = true
+	}
+	return func(req Request) ([]string, error) {
+		if req.Copy {
+			return nil, errors.Forbiddenf("copying not allowed")
+		}
+		if len(req.Command) == 0 {
+			return nil, errors.Forbiddenf("empty command not allowed")
+		}
+		program := req.Command[0]
+		if len(req.Command) == 1 {
+			if strings.ContainsAny(program, shellMetacharacters) {
+				return nil, errors.Forbiddenf("shell command line %q not allowed", program)
+			}
+			if fields := strings.Fields(program); len(fields) > 0 {
+				program = fields[0]
+			}
+		}
+		if !allowed[program] {
+			return nil, errors.Forbiddenf("program %q not allowed", program)
+		}
+		return req.Command, nil
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package ssh_test
+
+import (
+	"time"
+
+	"github.com/juju/clock/testclock"
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/errcode"
+	"github.com/juju/utils/v3/ssh"
+)
+
+type PolicySuite struct {
+	testing.IsolationSuite
+	fake    *fakeClient
+	records []ssh.AuditRecord
+	options *ssh.Options
+	now     time.Time
+}
+
+var _ = gc.Suite(&PolicySuite{})
+
+func (s *PolicySuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.fake = &fakeClient{}
+	s.records = nil
+	s.now = time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	s.options = &ssh.Options{}
+	s.options.SetClock(testclock.NewClock(s.now))
+}
+
+func (s *PolicySuite) client(policy ssh.Policy) ssh.Client {
+	return ssh.NewPolicyClient(s.fake, policy, func(r ssh.AuditRecord) {
+		s.records = append(s.records, r)
+	})
+}
+
+func (s *PolicySuite) TestCommandAllowed(c *gc.C) {
+	client := s.client(ssh.AllowCommands("uptime"))
+	err := client.Command("ubuntu@host", []string{"uptime"}, s.options).Run()
+	c.Assert(err, jc.ErrorIsNil)
+	s.fake.checkCalls(c, "ubuntu@host", []string{"uptime"}, s.options, nil, "Command")
+	c.Check(s.records, jc.DeepEquals, []ssh.AuditRecord{{
+		Time:    s.now,
+		Request: ssh.Request{Host: "ubuntu@host", Command: []string{"uptime"}},
+		Command: []string{"uptime"},
+	}})
+	c.Check(s.records[0].Allowed(), jc.IsTrue)
+}
+
+func (s *PolicySuite) TestCommandDenied(c *gc.C) {
+	client := s.client(ssh.AllowCommands("uptime"))
+	cmd := client.Command("host", []string{"rm", "-rf", "/"}, s.options)
+	err := cmd.Run()
+	c.Check(err, gc.ErrorMatches, `command \["rm" "-rf" "/"\] on host denied: program "rm" not allowed`)
+	c.Check(err, jc.Satisfies, errors.IsForbidden)
+	_, err = cmd.StdoutPipe()
+	c.Check(err, jc.Satisfies, errors.IsForbidden)
+	c.Check(s.fake.calls, gc.HasLen, 0)
+
+	c.Assert(s.records, gc.HasLen, 1)
+	c.Check(s.records[0].Allowed(), jc.IsFalse)
+	c.Check(s.records[0].Command, gc.IsNil)
+	c.Check(s.records[0].Err, jc.Satisfies, errors.IsForbidden)
+}
+
+func (s *PolicySuite) TestCommandRewritten(c *gc.C) {
+	client := s.client(func(req ssh.Request) ([]string, error) {
+		return append([]string{"sudo", "-n"}, req.Command...), nil
+	})
+	err := client.Command("host", []string{"reboot"}, s.options).Run()
+	c.Assert(err, jc.ErrorIsNil)
+	s.fake.checkCalls(c, "host", []string{"sudo", "-n", "reboot"}, s.options, nil, "Command")
+	c.Assert(s.records, gc.HasLen, 1)
+	c.Check(s.records[0].Request.Command, jc.DeepEquals, []string{"reboot"})
+	c.Check(s.records[0].Command, jc.DeepEquals, []string{"sudo", "-n", "reboot"})
+	c.Check(s.records[0].Rewritten, jc.IsTrue)
+}
+
+func (s *PolicySuite) TestPolicyCannotModifyRequest(c *gc.C) {
+	client := s.client(func(req ssh.Request) ([]string, error) {
+		req.Command[0] = "changed"
+		return req.Command, nil
+	})
+	command := []string{"ls"}
+	err := client.Command("host", command, s.options).Run()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(command, jc.DeepEquals, []string{"ls"})
+	c.Assert(s.records, gc.HasLen, 1)
+	c.Check(s.records[0].Request.Command, jc.DeepEquals, []string{"ls"})
+	c.Check(s.records[0].Rewritten, jc.IsTrue)
+}
+
+func (s *PolicySuite) TestPolicyErrorIsForbidden(c *gc.C) {
+	client := s.client(func(req ssh.Request) ([]string, error) {
+		return nil, errors.New("outside maintenance window")
+	})
+	err := client.Command("host", []string{"ls"}, s.options).Run()
+	c.Check(err, gc.ErrorMatches, `command \["ls"\] on host denied: outside maintenance window`)
+	c.Check(err, jc.Satisfies, errors.IsForbidden)
+}
+
+func (s *PolicySuite) TestCopy(c *gc.C) {
+	client := s.client(func(req ssh.Request) ([]string, error) {
+		c.Check(req.Copy, jc.IsTrue)
+		return append(req.Command, "-q"), nil
+	})
+	err := client.Copy([]string{"a", "host:b"}, s.options)
+	c.Assert(err, jc.ErrorIsNil)
+	s.fake.checkCalls(c, "", nil, s.options, []string{"a", "host:b", "-q"}, "Copy")
+	c.Assert(s.records, gc.HasLen, 1)
+	c.Check(s.records[0].Request, jc.DeepEquals, ssh.Request{Command: []string{"a", "host:b"}, Copy: true})
+}
+
+func (s *PolicySuite) TestCopyDenied(c *gc.C) {
+	client := s.client(ssh.AllowCommands("uptime"))
+	err := client.Copy([]string{"a", "host:b"}, s.options)
+	c.Check(err, gc.ErrorMatches, `copy \["a" "host:b"\] denied: copying not allowed`)
+	c.Check(err, jc.Satisfies, errors.IsForbidden)
+	c.Check(errcode.Of(err), gc.Equals, errcode.ErrForbidden)
+	c.Check(s.fake.calls, gc.HasLen, 0)
+}
+
+func (s *PolicySuite) TestNoAudit(c *gc.C) {
+	client := ssh.NewPolicyClient(s.fake, ssh.AllowCommands("ls"), nil)
+	err := client.Command("host", []string{"ls"}, nil).Run()
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *PolicySuite) TestPingNotSupported(c *gc.C) {
+	client := s.client(ssh.AllowCommands())
+	_, err := client.(ssh.Pinger).Ping("host", s.options)
+	c.Check(err, jc.Satisfies, errors.IsNotSupported)
+}
+
+func (s *PolicySuite) TestAllowCommands(c *gc.C) {
+	policy := ssh.AllowCommands("ls", "cat")
+	for i, test := range []struct {
+		command []string
+		err     string
+	}{{
+		command: []string{"ls", "-l", "; rm -rf /"},
+	}, {
+		command: []string{"cat /etc/hostname"},
+	}, {
+		command: []string{"cat - > /tmp/x"},
+		err:     `shell command line "cat - > /tmp/x" not allowed`,
+	}, {
+		command: []string{"ls; rm -rf /"},
+		err:     `shell command line "ls; rm -rf /" not allowed`,
+	}, {
+		command: []string{"ls $(rm -rf /)"},
+		err:     `shell command line .* not allowed`,
+	}, {
+		command: []string{"/bin/ls"},
+		err:     `program "/bin/ls" not allowed`,
+	}, {
+		command: nil,
+		err:     `empty command not allowed`,
+	}} {
+		c.Logf("test %d: %q", i, test.command)
+		command, err := policy(ssh.Request{Host: "host", Command: test.command})
+		if test.err == "" {
+			c.Check(err, jc.ErrorIsNil)
+			c.Check(command, jc.DeepEquals, test.command)
+		} else {
+			c.Check(err, gc.ErrorMatches, test.err)
+			c.Check(err, jc.Satisfies, errors.IsForbidden)
+		}
+	}
+}
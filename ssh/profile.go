@@ -0,0 +1,253 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package ssh
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/juju/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Profile holds a named set of options for a class of hosts. Profiles
+// are usually loaded from YAML files with LoadProfiles; a profile file
+// looks like this:
+//
+//	hosts: ["*.internal", "10.0.*", "!bastion.internal"]
+//	port: 2222
+//	identities: [~/.ssh/fleet_key]
+//	known-hosts-file: /etc/fleet/known_hosts
+//	proxy-command: [ssh, -W, "%h:%p", bastion.internal]
+//	strict-host-key-checking: yes
+//	host-key-algorithms: [ssh-ed25519]
+//	password-authentication: false
+//	pty: false
+type Profile struct {
+	// Name holds the name of the profile. Profiles loaded by
+	// LoadProfiles are named after their files.
+	Name string `yaml:"-"`
+
+	// Hosts holds the patterns of the hosts to which the profile
+	// applies. Patterns use "*" and "?" wildcards, as in OpenSSH
+	// configuration files; a pattern starting with "!" excludes the
+	// hosts it matches, even if another pattern matches them.
+	Hosts []string `yaml:"hosts"`
+
+	// Port holds the SSH server port. Zero means the default.
+	Port int `yaml:"port,omitempty"`
+
+	// Identities holds the paths of private key files. Paths are
+	// relative to the directory of the profile file, and a leading
+	// "~/" refers to the home directory.
+	Identities []string `yaml:"identities,omitempty"`
+
+	// KnownHostsFile holds the path of the known hosts file,
+	// interpreted as for Identities.
+	KnownHostsFile string `yaml:"known-hosts-file,omitempty"`
+
+	// ProxyCommand holds the command used to proxy connections.
+	ProxyCommand []string `yaml:"proxy-command,omitempty"`
+
+	// StrictHostKeyChecking holds "yes", "no", "ask" or "default".
+	// Empty means "default".
+	StrictHostKeyChecking string `yaml:"strict-host-key-checking,omitempty"`
+
+	// HostKeyAlgorithms holds the accepted host key
+	// types, in order of preference.
+	HostKeyAlgorithms []string `yaml:"host-key-algorithms,omitempty"`
+
+	// PasswordAuthentication allows password authentication.
+	PasswordAuthentication bool `yaml:"password-authentication,omitempty"`
+
+	// PTY forces the allocation of a pseudo-TTY.
+	PTY bool `yaml:"pty,omitempty"`
+}
+
+var strictHostChecksValues = map[string]StrictHostChecksOption{
+	"":        StrictHostChecksDefault,
+	"default": StrictHostChecksDefault,
+	"no":      StrictHostChecksNo,
+	"yes":     StrictHostChecksYes,
+	"ask":     StrictHostChecksAsk,
+}
+
+// Validate checks that the profile's values are valid.
+func (p Profile) Validate() error {
+	if p.Port < 0 || p.Port > 65535 {
+		return errors.NotValidf("port %d", p.Port)
+	}
+	if _, ok := strictHostChecksValues[p.StrictHostKeyChecking]; !ok {
+		return errors.NotValidf("strict-host-key-checking value %q", p.StrictHostKeyChecking)
+	}
+	for _, pattern := range p.Hosts {
+		if _, err := path.Match(strings.TrimPrefix(pattern, "!"), ""); err != nil {
+			return errors.NotValidf("host pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// Matches reports whether the profile applies to host, which may
+// include a user name and port, as in "ubuntu@10.0.0.1" or
+// "[fe80::1]:2222". IPv6 addresses are matched without brackets.
+func (p Profile) Matches(host string) bool {
+	_, host, _ = splitUserHost(host)
+	host = strings.ToLower(host)
+	matched := false
+	for _, pattern := range p.Hosts {
+		negated := strings.HasPrefix(pattern, "!")
+		pattern = strings.ToLower(strings.TrimPrefix(pattern, "!"))
+		if ok, _ := path.Match(pattern, host); !ok {
+			continue
+		}
+		if negated {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+// Options returns a new Options holding the profile's settings.
+func (p Profile) Options() (*Options, error) {
+	if err := p.Validate(); err != nil {
+		return nil, errors.Annotatef(err, "profile %q", p.Name)
+	}
+	var options Options
+	options.SetPort(p.Port)
+	if len(p.Identities) > 0 {
+		options.SetIdentities(p.Identities...)
+	}
+	options.SetKnownHostsFile(p.KnownHostsFile)
+	if len(p.ProxyCommand) > 0 {
+		options.SetProxyCommand(p.ProxyCommand...)
+	}
+	options.SetStrictHostKeyChecking(strictHostChecksValues[p.StrictHostKeyChecking])
+	if len(p.HostKeyAlgorithms) > 0 {
+		options.SetHostKeyAlgorithms(p.HostKeyAlgorithms...)
+	}
+	if p.PasswordAuthentication {
+		options.AllowPasswordAuthentication()
+	}
+	if p.PTY {
+		options.EnablePTY()
+	}
+	return &options, nil
+}
+
+// Profiles holds a sequence of profiles, in order of precedence.
+type Profiles []Profile
+
+// LoadProfiles loads a profile from each file in dir with a ".yaml"
+// or ".yml" extension, naming it after the file without the extension.
+// The profiles are ordered by name, so that the precedence of
+// overlapping host patterns can be controlled with names such as
+// "10-bastion.yaml" and "90-default.yaml".
+func LoadProfiles(dir string) (Profiles, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var profiles Profiles
+	for _, info := range infos {
+		ext := filepath.Ext(info.Name())
+		if info.IsDir() || ext != ".yaml" && ext != ".yml" {
+			continue
+		}
+		profile, err := loadProfile(dir, info.Name())
+		if err != nil {
+			return nil, errors.Annotatef(err, "cannot load profile %q", info.Name())
+		}
+		profiles = append(profiles, profile)
+	}
+	sort.SliceStable(profiles, func(i, j int) bool {
+		return profiles[i].Name < profiles[j].Name
+	})
+	for i := 1; i < len(profiles); i++ {
+		if profiles[i].Name == profiles[i-1].Name {
+			return nil, errors.AlreadyExistsf("profile %q", profiles[i].Name)
+		}
+	}
+	return profiles, nil
+}
+
+func loadProfile(dir, name string) (Profile, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return Profile{}, errors.Trace(err)
+	}
+	var profile Profile
+	if err := yaml.UnmarshalStrict(data, &profile); err != nil {
+		return Profile{}, errors.Trace(err)
+	}
+	profile.Name = strings.TrimSuffix(name, filepath.Ext(name))
+	if err := profile.Validate(); err != nil {
+		return Profile{}, errors.Trace(err)
+	}
+	for i, identity := range profile.Identities {
+		if profile.Identities[i], err = resolvePath(dir, identity); err != nil {
+			return Profile{}, errors.Trace(err)
+		}
+	}
+	if profile.KnownHostsFile != "" {
+		if profile.KnownHostsFile, err = resolvePath(dir, profile.KnownHostsFile); err != nil {
+			return Profile{}, errors.Trace(err)
+		}
+	}
+	return profile, nil
+}
+
+// resolvePath returns p relative to dir, expanding a leading "~/"
+// to the home directory.
+func resolvePath(dir, p string) (string, error) {
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", errors.Annotatef(err, "cannot expand %q", p)
+		}
+		return filepath.Join(home, p[1:]), nil
+	}
+	if filepath.IsAbs(p) {
+		return p, nil
+	}
+	return filepath.Join(dir, p), nil
+}
+
+// Profile returns the profile with the given name. It returns an
+// error satisfying errors.IsNotFound if there is none.
+func (ps Profiles) Profile(name string) (Profile, error) {
+	for _, p := range ps {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return Profile{}, errors.NotFoundf("profile %q", name)
+}
+
+// Match returns the first profile that applies to host, and
+// whether there is one.
+func (ps Profiles) Match(host string) (Profile, bool) {
+	for _, p := range ps {
+		if p.Matches(host) {
+			return p, true
+		}
+	}
+	return Profile{}, false
+}
+
+// Options returns the options of the first profile that applies to
+// host. If no profile applies, it returns empty options, so that the
+// client's defaults are used.
+func (ps Profiles) Options(host string) (*Options, error) {
+	p, ok := ps.Match(host)
+	if !ok {
+		return &Options{}, nil
+	}
+	return p.Options()
+}
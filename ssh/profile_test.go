@@ -0,0 +1,185 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package ssh_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/ssh"
+)
+
+type ProfileSuite struct {
+	testing.IsolationSuite
+	dir string
+}
+
+var _ = gc.Suite(&ProfileSuite{})
+
+func (s *ProfileSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.dir = c.MkDir()
+}
+
+func (s *ProfileSuite) writeProfile(c *gc.C, name, content string) {
+	err := ioutil.WriteFile(filepath.Join(s.dir, name), []byte(content), 0600)
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *ProfileSuite) TestLoadProfiles(c *gc.C) {
+	s.writeProfile(c, "20-internal.yaml", `
+hosts: ["*.internal", "!bastion.internal"]
+port: 2222
+identities: [keys/fleet, /etc/fleet/key]
+known-hosts-file: known_hosts
+proxy-command: [ssh, -W, "%h:%p", bastion.internal]
+strict-host-key-checking: yes
+host-key-algorithms: [ssh-ed25519]
+password-authentication: true
+pty: true
+`)
+	s.writeProfile(c, "10-bastion.yml", `
+hosts: [bastion.internal]
+strict-host-key-checking: ask
+`)
+	s.writeProfile(c, "README", "not a profile")
+	err := os.Mkdir(filepath.Join(s.dir, "keys.yaml"), 0700)
+	c.Assert(err, jc.ErrorIsNil)
+
+	profiles, err := ssh.LoadProfiles(s.dir)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(profiles, jc.DeepEquals, ssh.Profiles{{
+		Name:                  "10-bastion",
+		Hosts:                 []string{"bastion.internal"},
+		StrictHostKeyChecking: "ask",
+	}, {
+		Name:                   "20-internal",
+		Hosts:                  []string{"*.internal", "!bastion.internal"},
+		Port:                   2222,
+		Identities:             []string{filepath.Join(s.dir, "keys/fleet"), "/etc/fleet/key"},
+		KnownHostsFile:         filepath.Join(s.dir, "known_hosts"),
+		ProxyCommand:           []string{"ssh", "-W", "%h:%p", "bastion.internal"},
+		StrictHostKeyChecking:  "yes",
+		HostKeyAlgorithms:      []string{"ssh-ed25519"},
+		PasswordAuthentication: true,
+		PTY:                    true,
+	}})
+
+	options, err := profiles.Options("ubuntu@db.internal")
+	c.Assert(err, jc.ErrorIsNil)
+	var expected ssh.Options
+	expected.SetPort(2222)
+	expected.SetIdentities(filepath.Join(s.dir, "keys/fleet"), "/etc/fleet/key")
+	expected.SetKnownHostsFile(filepath.Join(s.dir, "known_hosts"))
+	expected.SetProxyCommand("ssh", "-W", "%h:%p", "bastion.internal")
+	expected.SetStrictHostKeyChecking(ssh.StrictHostChecksYes)
+	expected.SetHostKeyAlgorithms("ssh-ed25519")
+	expected.AllowPasswordAuthentication()
+	expected.EnablePTY()
+	c.Check(options, jc.DeepEquals, &expected)
+
+	options, err = profiles.Options("bastion.internal")
+	c.Assert(err, jc.ErrorIsNil)
+	expected = ssh.Options{}
+	expected.SetStrictHostKeyChecking(ssh.StrictHostChecksAsk)
+	c.Check(options, jc.DeepEquals, &expected)
+
+	options, err = profiles.Options("example.com")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(options, jc.DeepEquals, &ssh.Options{})
+}
+
+func (s *ProfileSuite) TestLoadProfilesHomeDir(c *gc.C) {
+	home := c.MkDir()
+	s.PatchEnvironment("HOME", home)
+	s.writeProfile(c, "p.yaml", "identities: [~/.ssh/id_ed25519]\n")
+	profiles, err := ssh.LoadProfiles(s.dir)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(profiles, gc.HasLen, 1)
+	c.Check(profiles[0].Identities, jc.DeepEquals, []string{filepath.Join(home, ".ssh/id_ed25519")})
+}
+
+func (s *ProfileSuite) TestLoadProfilesErrors(c *gc.C) {
+	for i, test := range []struct {
+		content string
+		err     string
+	}{{
+		content: "port: 70000\n",
+		err:     `cannot load profile "p.yaml": port 70000 not valid`,
+	}, {
+		content: "strict-host-key-checking: maybe\n",
+		err:     `cannot load profile "p.yaml": strict-host-key-checking value "maybe" not valid`,
+	}, {
+		content: "hosts: [\"[\"]\n",
+		err:     `cannot load profile "p.yaml": host pattern "\[" not valid`,
+	}, {
+		content: "colour: blue\n",
+		err:     `cannot load profile "p.yaml": yaml: unmarshal errors:\n.*field colour not found.*`,
+	}} {
+		c.Logf("test %d: %q", i, test.content)
+		s.writeProfile(c, "p.yaml", test.content)
+		_, err := ssh.LoadProfiles(s.dir)
+		c.Check(err, gc.ErrorMatches, test.err)
+	}
+}
+
+func (s *ProfileSuite) TestLoadProfilesDuplicateName(c *gc.C) {
+	s.writeProfile(c, "p.yaml", "port: 1\n")
+	s.writeProfile(c, "p.yml", "port: 2\n")
+	_, err := ssh.LoadProfiles(s.dir)
+	c.Check(err, gc.ErrorMatches, `profile "p" already exists`)
+}
+
+func (s *ProfileSuite) TestLoadProfilesMissingDir(c *gc.C) {
+	_, err := ssh.LoadProfiles(filepath.Join(s.dir, "missing"))
+	c.Check(err, gc.NotNil)
+}
+
+func (s *ProfileSuite) TestMatches(c *gc.C) {
+	p := ssh.Profile{Hosts: []string{"*.example.com", "10.0.0.?", "!secret.example.com", "fd00::*"}}
+	for host, expected := range map[string]bool{
+		"www.example.com":        true,
+		"WWW.Example.COM":        true,
+		"ubuntu@www.example.com": true,
+		"example.com":            false,
+		"secret.example.com":     false,
+		"10.0.0.1":               true,
+		"10.0.0.10":              false,
+		"[10.0.0.1]:2222":        true,
+		"fd00::1":                true,
+		"ubuntu@[FD00::1]:2222":  true,
+		"fd01::1":                false,
+	} {
+		c.Check(p.Matches(host), gc.Equals, expected, gc.Commentf("host %q", host))
+	}
+	c.Check(ssh.Profile{}.Matches("anything"), jc.IsFalse)
+}
+
+func (s *ProfileSuite) TestProfileByName(c *gc.C) {
+	profiles := ssh.Profiles{{Name: "a"}, {Name: "b", Port: 2}}
+	p, err := profiles.Profile("b")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(p.Port, gc.Equals, 2)
+	_, err = profiles.Profile("c")
+	c.Check(err, jc.Satisfies, errors.IsNotFound)
+}
+
+func (s *ProfileSuite) TestMatchFirstWins(c *gc.C) {
+	profiles := ssh.Profiles{
+		{Name: "a", Hosts: []string{"db*"}, Port: 1},
+		{Name: "b", Hosts: []string{"*"}, Port: 2},
+	}
+	p, ok := profiles.Match("db1")
+	c.Assert(ok, jc.IsTrue)
+	c.Check(p.Name, gc.Equals, "a")
+	p, ok = profiles.Match("web1")
+	c.Assert(ok, jc.IsTrue)
+	c.Check(p.Name, gc.Equals, "b")
+}
@@ -0,0 +1,276 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package ssh
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/juju/clock"
+
+	"github.com/juju/utils/v3"
+	"github.com/juju/utils/v3/redact"
+)
+
+// Recording configures the recording of the I/O of remote commands
+// in asciicast v2 format, as played back by asciinema. A recording
+// holds a JSON header line followed by a line for each chunk of data,
+// timestamped relative to the start of the command.
+type Recording struct {
+	// Writer receives the recording. A separate recording is
+	// written for each command run with the options, so each
+	// command should be given its own writer.
+	Writer io.Writer
+
+	// Redactor redacts the command and the recorded data. Data is
+	// redacted a chunk at a time, so secrets split across chunks
+	// may not be redacted. If it is nil, redact.Credentials is used.
+	Redactor *redact.Redactor
+
+	// Input specifies that the command's input is recorded as
+	// well as its output. Input often holds secrets, so it is
+	// not recorded by default.
+	Input bool
+
+	// Width and Height give the terminal size recorded in the
+	// header. They default to 80 and 24.
+	Width, Height int
+
+	// Title is recorded in the header. It defaults to the host.
+	Title string
+}
+
+// SetRecording records the I/O of commands run with the options.
+// Stdout and stderr are both recorded as output. Copies are not
+// recorded.
+func (o *Options) SetRecording(recording Recording) {
+	o.recording = &recording
+}
+
+// sessionRecorder returns a recorder for a command run
+// on host with the options, or nil if there is none.
+func (o *Options) sessionRecorder(host string, command []string) *sessionRecorder {
+	if o == nil || o.recording == nil || o.recording.Writer == nil {
+		return nil
+	}
+	rec := *o.recording
+	if rec.Redactor == nil {
+		rec.Redactor = redact.Credentials
+	}
+	if rec.Width <= 0 {
+		rec.Width = 80
+	}
+	if rec.Height <= 0 {
+		rec.Height = 24
+	}
+	if rec.Title == "" {
+		rec.Title = host
+	}
+	return &sessionRecorder{
+		rec:     rec,
+		clock:   o.getClock(),
+		command: rec.Redactor.Redact(utils.CommandString(command...)),
+		pending: make(map[string][]byte),
+	}
+}
+
+// asciicastHeader is the first line of an asciicast v2 recording.
+type asciicastHeader struct {
+	Version   int    `json:"version"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	Timestamp int64  `json:"timestamp"`
+	Command   string `json:"command,omitempty"`
+	Title     string `json:"title,omitempty"`
+}
+
+// sessionRecorder writes the recording of a single command.
+type sessionRecorder struct {
+	rec     Recording
+	clock   clock.Clock
+	command string
+
+	mu      sync.Mutex
+	start   time.Time
+	started bool
+	failed  bool
+
+	// pending holds, for each stream, the start of an incomplete
+	// UTF-8 sequence held back until the rest is written.
+	pending map[string][]byte
+}
+
+// begin writes the header of the recording.
+func (r *sessionRecorder) begin() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.started {
+		return
+	}
+	r.started = true
+	r.start = r.clock.Now()
+	r.writeLine(asciicastHeader{
+		Version:   2,
+		Width:     r.rec.Width,
+		Height:    r.rec.Height,
+		Timestamp: r.start.Unix(),
+		Command:   r.command,
+		Title:     r.rec.Title,
+	})
+}
+
+// record records data written to or read from the named stream.
+func (r *sessionRecorder) record(stream string, data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	data = append(r.pending[stream], data...)
+	n := completeUTF8(data)
+	r.pending[stream] = append([]byte(nil), data[n:]...)
+	r.event(stream, data[:n])
+}
+
+// finish records any data held back at the end of the command.
+func (r *sessionRecorder) finish() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for stream, data := range r.pending {
+		r.event(stream, data)
+		delete(r.pending, stream)
+	}
+}
+
+// event writes an event for the data. It must be called
+// with r.mu held.
+func (r *sessionRecorder) event(stream string, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	kind := "o"
+	if stream == "stdin" {
+		kind = "i"
+	}
+	elapsed := 0.0
+	if r.started {
+		elapsed = r.clock.Now().Sub(r.start).Seconds()
+	}
+	r.writeLine([]interface{}{elapsed, kind, r.rec.Redactor.Redact(string(data))})
+}
+
+// writeLine writes v to the recording as a line of JSON. If writing
+// fails, the failure is logged and nothing more is recorded. It must
+// be called with r.mu held.
+func (r *sessionRecorder) writeLine(v interface{}) {
+	if r.failed {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err == nil {
+		_, err = r.rec.Writer.Write(append(data, '\n'))
+	}
+	if err != nil {
+		logger.Warningf("cannot record ssh session: %v", err)
+		r.failed = true
+	}
+}
+
+// completeUTF8 returns the length of the prefix of data that does
+// not end with an incomplete UTF-8 sequence.
+func completeUTF8(data []byte) int {
+	for i := 1; i < utf8.UTFMax && i <= len(data); i++ {
+		c := data[len(data)-i]
+		if c < utf8.RuneSelf {
+			break
+		}
+		if utf8.RuneStart(c) {
+			if !utf8.FullRune(data[len(data)-i:]) {
+				return len(data) - i
+			}
+			break
+		}
+	}
+	return len(data)
+}
+
+// writer returns a writer that records the data written to w
+// on the named stream before passing it on.
+func (r *sessionRecorder) writer(stream string, w io.Writer) io.Writer {
+	if w == nil {
+		w = ioutil.Discard
+	}
+	return &recordingWriter{w: w, record: r.recordFunc(stream)}
+}
+
+// writeCloser is like writer, for the write end of a pipe.
+func (r *sessionRecorder) writeCloser(stream string, wc io.WriteCloser) io.WriteCloser {
+	return &recordingWriteCloser{
+		recordingWriter: recordingWriter{w: wc, record: r.recordFunc(stream)},
+		c:               wc,
+	}
+}
+
+// recordFunc returns a function that records data
+// on the named stream.
+func (r *sessionRecorder) recordFunc(stream string) func([]byte) {
+	return func(p []byte) {
+		r.record(stream, p)
+	}
+}
+
+type recordingWriter struct {
+	w      io.Writer
+	record func([]byte)
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.record(p[:n])
+	return n, err
+}
+
+type recordingWriteCloser struct {
+	recordingWriter
+	c io.Closer
+}
+
+func (w *recordingWriteCloser) Close() error {
+	return w.c.Close()
+}
+
+// reader returns a reader that records the data read from rd
+// on the named stream.
+func (r *sessionRecorder) reader(stream string, rd io.Reader) io.Reader {
+	return &recordingReader{r: rd, record: r.recordFunc(stream)}
+}
+
+// readCloser is like reader, for the read end of a pipe.
+func (r *sessionRecorder) readCloser(stream string, rc io.ReadCloser) io.ReadCloser {
+	return &recordingReadCloser{
+		recordingReader: recordingReader{r: rc, record: r.recordFunc(stream)},
+		c:               rc,
+	}
+}
+
+type recordingReader struct {
+	r      io.Reader
+	record func([]byte)
+}
+
+func (r *recordingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.record(p[:n])
+	return n, err
+}
+
+type recordingReadCloser struct {
+	recordingReader
+	c io.Closer
+}
+
+func (r *recordingReadCloser) Close() error {
+	return r.c.Close()
+}
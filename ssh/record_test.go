@@ -0,0 +1,248 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package ssh_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/juju/clock/testclock"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/redact"
+	"github.com/juju/utils/v3/ssh"
+)
+
+type RecordingSuite struct {
+	testing.IsolationSuite
+	clock *testclock.Clock
+	buf   bytes.Buffer
+	impl  fakeCommandImpl
+}
+
+var _ = gc.Suite(&RecordingSuite{})
+
+var recordingEpoch = time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func (s *RecordingSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.clock = testclock.NewClock(recordingEpoch)
+	s.buf.Reset()
+	s.impl = fakeCommandImpl{}
+}
+
+func (s *RecordingSuite) command(rec ssh.Recording, args ...string) *ssh.Cmd {
+	rec.Writer = &s.buf
+	var opts ssh.Options
+	opts.SetClock(s.clock)
+	opts.SetRecording(rec)
+	return ssh.NewRecordedCmd(&s.impl, &opts, "ubuntu@host", args)
+}
+
+// parseRecording returns the header and events of an asciicast recording.
+func parseRecording(c *gc.C, data string) (map[string]interface{}, [][]interface{}) {
+	lines := strings.Split(strings.TrimSuffix(data, "\n"), "\n")
+	var header map[string]interface{}
+	err := json.Unmarshal([]byte(lines[0]), &header)
+	c.Assert(err, jc.ErrorIsNil)
+	var events [][]interface{}
+	for _, line := range lines[1:] {
+		var event []interface{}
+		err := json.Unmarshal([]byte(line), &event)
+		c.Assert(err, jc.ErrorIsNil)
+		events = append(events, event)
+	}
+	return header, events
+}
+
+func (s *RecordingSuite) TestRecordOutput(c *gc.C) {
+	cmd := s.command(ssh.Recording{}, "echo", "hi")
+	err := cmd.Start()
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = s.impl.stdoutArg.Write([]byte("hello "))
+	c.Assert(err, jc.ErrorIsNil)
+	s.clock.Advance(1500 * time.Millisecond)
+	_, err = s.impl.stderrArg.Write([]byte("w\xc3"))
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = s.impl.stderrArg.Write([]byte("\xb6rld\n"))
+	c.Assert(err, jc.ErrorIsNil)
+	err = cmd.Wait()
+	c.Assert(err, jc.ErrorIsNil)
+
+	header, events := parseRecording(c, s.buf.String())
+	c.Check(header, jc.DeepEquals, map[string]interface{}{
+		"version":   2.0,
+		"width":     80.0,
+		"height":    24.0,
+		"timestamp": float64(recordingEpoch.Unix()),
+		"command":   "echo hi",
+		"title":     "ubuntu@host",
+	})
+	c.Check(events, jc.DeepEquals, [][]interface{}{
+		{0.0, "o", "hello "},
+		{1.5, "o", "w"},
+		{1.5, "o", "örld\n"},
+	})
+}
+
+func (s *RecordingSuite) TestRecordNilOutput(c *gc.C) {
+	cmd := s.command(ssh.Recording{Width: 120, Height: 40, Title: "deploy"})
+	err := cmd.Start()
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = s.impl.stdoutArg.Write([]byte("discarded"))
+	c.Assert(err, jc.ErrorIsNil)
+	err = cmd.Wait()
+	c.Assert(err, jc.ErrorIsNil)
+
+	header, events := parseRecording(c, s.buf.String())
+	c.Check(header["width"], gc.Equals, 120.0)
+	c.Check(header["height"], gc.Equals, 40.0)
+	c.Check(header["title"], gc.Equals, "deploy")
+	c.Check(header["command"], gc.IsNil)
+	c.Check(events, jc.DeepEquals, [][]interface{}{{0.0, "o", "discarded"}})
+}
+
+func (s *RecordingSuite) TestRecordRedacts(c *gc.C) {
+	cmd := s.command(ssh.Recording{}, "login", "--password", "hunter2")
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	err := cmd.Start()
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = s.impl.stdoutArg.Write([]byte("token=abc123\n"))
+	c.Assert(err, jc.ErrorIsNil)
+	err = cmd.Wait()
+	c.Assert(err, jc.ErrorIsNil)
+
+	c.Check(stdout.String(), gc.Equals, "token=abc123\n")
+	header, events := parseRecording(c, s.buf.String())
+	c.Check(header["command"], gc.Equals, "login --password [REDACTED]")
+	c.Check(events, jc.DeepEquals, [][]interface{}{{0.0, "o", "token=[REDACTED]\n"}})
+}
+
+func (s *RecordingSuite) TestRecordCustomRedactor(c *gc.C) {
+	cmd := s.command(ssh.Recording{Redactor: redact.New("s3cret")})
+	err := cmd.Start()
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = s.impl.stdoutArg.Write([]byte("the s3cret is out, password=visible"))
+	c.Assert(err, jc.ErrorIsNil)
+	err = cmd.Wait()
+	c.Assert(err, jc.ErrorIsNil)
+
+	_, events := parseRecording(c, s.buf.String())
+	c.Check(events, jc.DeepEquals, [][]interface{}{{0.0, "o", "the [REDACTED] is out, password=visible"}})
+}
+
+func (s *RecordingSuite) TestRecordInput(c *gc.C) {
+	stdin := strings.NewReader("yes\n")
+
+	cmd := s.command(ssh.Recording{})
+	cmd.Stdin = stdin
+	err := cmd.Start()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(s.impl.stdinArg, gc.Equals, stdin)
+	err = cmd.Wait()
+	c.Assert(err, jc.ErrorIsNil)
+	_, events := parseRecording(c, s.buf.String())
+	c.Check(events, gc.HasLen, 0)
+
+	s.SetUpTest(c)
+	stdin = strings.NewReader("yes\n")
+	cmd = s.command(ssh.Recording{Input: true})
+	cmd.Stdin = stdin
+	err = cmd.Start()
+	c.Assert(err, jc.ErrorIsNil)
+	data, err := ioutil.ReadAll(s.impl.stdinArg)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(data), gc.Equals, "yes\n")
+	err = cmd.Wait()
+	c.Assert(err, jc.ErrorIsNil)
+	_, events = parseRecording(c, s.buf.String())
+	c.Check(events, jc.DeepEquals, [][]interface{}{{0.0, "i", "yes\n"}})
+}
+
+func (s *RecordingSuite) TestRecordPipes(c *gc.C) {
+	s.impl.stdoutData.WriteString("out")
+	s.impl.stderrData.WriteString("err")
+	cmd := s.command(ssh.Recording{Input: true})
+	stdin, err := cmd.StdinPipe()
+	c.Assert(err, jc.ErrorIsNil)
+	stdout, err := cmd.StdoutPipe()
+	c.Assert(err, jc.ErrorIsNil)
+	stderr, err := cmd.StderrPipe()
+	c.Assert(err, jc.ErrorIsNil)
+	err = cmd.Start()
+	c.Assert(err, jc.ErrorIsNil)
+
+	_, err = stdin.Write([]byte("in"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stdin.Close(), jc.ErrorIsNil)
+	data, err := ioutil.ReadAll(stdout)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(data), gc.Equals, "out")
+	data, err = ioutil.ReadAll(stderr)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(data), gc.Equals, "err")
+	err = cmd.Wait()
+	c.Assert(err, jc.ErrorIsNil)
+
+	s.impl.checkStdin(c, "in")
+	_, events := parseRecording(c, s.buf.String())
+	c.Check(events, jc.DeepEquals, [][]interface{}{
+		{0.0, "i", "in"},
+		{0.0, "o", "out"},
+		{0.0, "o", "err"},
+	})
+}
+
+func (s *RecordingSuite) TestRecordIncompleteUTF8AtEnd(c *gc.C) {
+	cmd := s.command(ssh.Recording{})
+	err := cmd.Start()
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = s.impl.stdoutArg.Write([]byte("a\xe2\x82"))
+	c.Assert(err, jc.ErrorIsNil)
+	err = cmd.Wait()
+	c.Assert(err, jc.ErrorIsNil)
+
+	_, events := parseRecording(c, s.buf.String())
+	c.Check(events, jc.DeepEquals, [][]interface{}{
+		{0.0, "o", "a"},
+		{0.0, "o", "��"},
+	})
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func (s *RecordingSuite) TestRecordWriterFails(c *gc.C) {
+	var opts ssh.Options
+	opts.SetRecording(ssh.Recording{Writer: failingWriter{}})
+	cmd := ssh.NewRecordedCmd(&s.impl, &opts, "host", nil)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	err := cmd.Start()
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = s.impl.stdoutArg.Write([]byte("still works"))
+	c.Assert(err, jc.ErrorIsNil)
+	err = cmd.Wait()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stdout.String(), gc.Equals, "still works")
+}
+
+func (s *RecordingSuite) TestNoRecording(c *gc.C) {
+	cmd := ssh.NewRecordedCmd(&s.impl, &ssh.Options{}, "host", nil)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	err := cmd.Start()
+	c.Assert(err, jc.ErrorIsNil)
+	s.impl.checkCalls(c, nil, &stdout, nil, "SetStdio", "Start")
+}
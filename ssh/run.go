@@ -12,6 +12,8 @@ import (
 
 	"github.com/juju/clock"
 	"github.com/juju/errors"
+
+	"github.com/juju/utils/v3/errcode"
 	utilexec "github.com/juju/utils/v3/exec"
 )
 
@@ -21,6 +23,10 @@ type ExecParams struct {
 	Host         string
 	Command      string
 	Timeout      time.Duration
+
+	// Clock is used to time the command's timeout.
+	// If it is nil, the wall clock is used.
+	Clock clock.Clock
 }
 
 // StartCommandOnMachine executes the command on the given host. The
@@ -38,6 +44,9 @@ func StartCommandOnMachine(params ExecParams) (*RunningCmd, error) {
 	if params.IdentityFile != "" {
 		options.SetIdentities(params.IdentityFile)
 	}
+	if params.Clock != nil {
+		options.SetClock(params.Clock)
+	}
 	command := Command(params.Host, []string{"/bin/bash", "-s"}, &options)
 
 	// Run the command.
@@ -91,7 +100,8 @@ func (cmd *RunningCmd) Wait() (result utilexec.ExecResponse, _ error) {
 //   Wait(cmd T, abortChans ...<-chan error) ...
 
 // Cancelled is an error indicating that a command timed out.
-var Cancelled = errors.New("command timed out")
+// It has the code errcode.ErrTimeout.
+var Cancelled = errcode.New(errcode.ErrTimeout, "command timed out")
 
 // WaitWithCancel waits for the command to complete and returns the result. If
 // cancel is closed before the result was returned, then it takes longer than
@@ -151,9 +161,13 @@ func ExecuteCommandOnMachine(args ExecParams) (utilexec.ExecResponse, error) {
 		return result, errors.Trace(err)
 	}
 
+	clk := args.Clock
+	if clk == nil {
+		clk = clock.WallClock
+	}
 	cancel := make(chan struct{})
 	go func() {
-		<-clock.WallClock.After(args.Timeout)
+		<-clk.After(args.Timeout)
 		close(cancel)
 	}()
 	result, err = cmd.WaitWithCancel(cancel)
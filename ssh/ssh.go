@@ -9,12 +9,20 @@ package ssh
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"os/exec"
 	"syscall"
+	"time"
 
+	"github.com/juju/clock"
 	"github.com/juju/cmd/v3"
 	"github.com/juju/errors"
+
+	"github.com/juju/utils/v3"
+	"github.com/juju/utils/v3/redact"
+	"github.com/juju/utils/v3/ringbuffer"
+	"github.com/juju/utils/v3/tracing"
 )
 
 // StrictHostChecksOption defines the possible values taken by
@@ -78,6 +86,50 @@ type Options struct {
 	// accept from the server, in order of preference. By default the
 	// client implementation will specify a set of reasonable types.
 	hostKeyAlgorithms []string
+
+	// events receives connection lifecycle events, if set.
+	events chan<- Event
+
+	// clock is used to time events and delays. If it is nil,
+	// the wall clock is used.
+	clock clock.Clock
+
+	// recording configures the recording of command I/O, if set.
+	recording *Recording
+
+	// controlPersist is how long the OpenSSH client keeps master
+	// connections open for reuse. Zero disables multiplexing.
+	controlPersist time.Duration
+
+	// hostKeyStore holds the host keys trusted by the go.crypto
+	// client. If it is nil, a known_hosts file is used.
+	hostKeyStore HostKeyStore
+
+	// sshfpResolver looks up SSHFP records with which to verify
+	// host keys, if set.
+	sshfpResolver SSHFPResolver
+
+	// bannerCallback and serverVersionCallback are called with
+	// the server's banner and identification string, if set.
+	bannerCallback        func(host, message string)
+	serverVersionCallback func(host, version string)
+
+	// gssapiAuth enables GSSAPI authentication, using clients
+	// created by gssapiClient if it is set.
+	gssapiAuth   bool
+	gssapiClient GSSAPIClientFunc
+
+	// streamTransforms holds the transforms applied
+	// to each stream of a command.
+	streamTransforms [numStreams][]StreamTransform
+
+	// tracer reports spans for commands, connections
+	// and copies, if set.
+	tracer tracing.Tracer
+
+	// pingTimeout bounds the time taken by a ping. Zero
+	// means defaultPingTimeout is used.
+	pingTimeout time.Duration
 }
 
 // SetProxyCommand sets a command to execute to proxy traffic through.
@@ -135,19 +187,79 @@ func (o *Options) SetHostKeyAlgorithms(algos ...string) {
 	o.hostKeyAlgorithms = algos
 }
 
+// SetEvents sets a channel on which connection lifecycle events will be
+// sent for commands run with these options. Events are sent without
+// blocking, so the channel should be buffered sufficiently to hold all
+// the events of interest; events that cannot be delivered immediately
+// are dropped. The channel is never closed.
+//
+// The go.crypto client reports every stage of the connection. The
+// OpenSSH client can only observe the ssh process itself, so it reports
+// just EventSessionStarted and EventClosed.
+func (o *Options) SetEvents(events chan<- Event) {
+	o.events = events
+}
+
+// SetClock sets the clock used to timestamp events and to time any
+// delays, such as waiting for the lock on the known_hosts file. By
+// default the wall clock is used.
+func (o *Options) SetClock(clk clock.Clock) {
+	o.clock = clk
+}
+
+// getClock returns the clock set with SetClock,
+// or the wall clock if none was set.
+func (o *Options) getClock() clock.Clock {
+	if o == nil || o.clock == nil {
+		return clock.WallClock
+	}
+	return o.clock
+}
+
+// SetTracer sets the tracer with which spans are reported for
+// commands run and copies made with these options. A command is
+// reported as an "ssh.command" span, from Start until Wait returns,
+// and a copy as an "ssh.copy" span. The go.crypto client also reports
+// the connection to the host as an "ssh.dial" span, which is a child
+// of the command's span unless a pipe was created before the command
+// was started, as that connects to the host.
+func (o *Options) SetTracer(tracer tracing.Tracer) {
+	o.tracer = tracer
+}
+
+// getTracer returns the tracer set with SetTracer, if any.
+func (o *Options) getTracer() tracing.Tracer {
+	if o == nil {
+		return nil
+	}
+	return o.tracer
+}
+
+// eventSink returns the sink for the events channel set
+// with SetEvents.
+func (o *Options) eventSink() eventSink {
+	if o == nil {
+		return eventSink{}
+	}
+	return eventSink{ch: o.events, clock: o.getClock()}
+}
+
 // Client is an interface for SSH clients to implement
 type Client interface {
 	// Command returns a Command for executing a command
 	// on the specified host. Each Command is executed
 	// within its own SSH session.
 	//
-	// Host is specified in the format [user@]host.
+	// Host is specified in the format [user@]host. An IPv6
+	// host may be bracketed, as in "ubuntu@[::1]", and a
+	// bracketed host may be followed by a port, as in
+	// "[::1]:2222", which overrides the port in options.
 	Command(host string, command []string, options *Options) *Cmd
 
 	// Copy copies file(s) between local and remote host(s).
 	// Paths are specified in the scp format, [[user@]host:]path. If
 	// any extra arguments are specified in extraArgs, they are passed
-	// verbatim.
+	// verbatim. IPv6 hosts must be bracketed; see CopyTarget.
 	Copy(args []string, options *Options) error
 }
 
@@ -157,13 +269,53 @@ type Cmd struct {
 	Stdin  io.Reader
 	Stdout io.Writer
 	Stderr io.Writer
-	impl   command
+
+	// Tail, if set, also receives the output written to stdout and
+	// stderr, so that the end of it is retained. It must be set
+	// before the command is started or its output pipes are created.
+	Tail *ringbuffer.Buffer
+
+	impl command
+
+	// recorder records the command's I/O, if set.
+	recorder *sessionRecorder
+
+	// stdinPiped, stdoutPiped and stderrPiped record which
+	// streams are pipes, which are recorded as they are used.
+	stdinPiped, stdoutPiped, stderrPiped bool
+
+	// transforms holds the transforms applied to each stream.
+	transforms [numStreams][]StreamTransform
+
+	// outputClosers holds the transformed output writers,
+	// which are closed when the command completes.
+	outputClosers []io.Closer
+
+	// tracer reports the command's span, if set, and span
+	// holds the span while the command runs.
+	tracer tracing.Tracer
+	span   tracing.Span
+	host   string
+	args   []string
 }
 
 func newCmd(impl command) *Cmd {
 	return &Cmd{impl: impl}
 }
 
+// newCmd returns a Cmd for impl, running args on host, whose
+// I/O is recorded and transformed as set in the options.
+func (o *Options) newCmd(impl command, host string, args []string) *Cmd {
+	return &Cmd{
+		impl:       impl,
+		recorder:   o.sessionRecorder(host, args),
+		transforms: o.getStreamTransforms(),
+		tracer:     o.getTracer(),
+		host:       host,
+		args:       args,
+	}
+}
+
 // CombinedOutput runs the command, and returns the
 // combined stdout/stderr output and result of
 // executing the command.
@@ -212,14 +364,108 @@ func (c *Cmd) Run() error {
 // it to complete. If the command could not be started, an
 // error is returned.
 func (c *Cmd) Start() error {
-	c.impl.SetStdio(c.Stdin, c.Stdout, c.Stderr)
-	return c.impl.Start()
+	stdin, stdout, stderr := c.Stdin, c.Stdout, c.Stderr
+	if c.Tail != nil {
+		if !c.stdoutPiped {
+			stdout = teeWriter(stdout, c.Tail)
+		}
+		if !c.stderrPiped {
+			stderr = teeWriter(stderr, c.Tail)
+		}
+	}
+	if r := c.recorder; r != nil {
+		r.begin()
+		if stdin != nil && !c.stdinPiped && r.rec.Input {
+			stdin = r.reader("stdin", stdin)
+		}
+		if !c.stdoutPiped {
+			stdout = r.writer("stdout", stdout)
+		}
+		if !c.stderrPiped {
+			stderr = r.writer("stderr", stderr)
+		}
+	}
+	if !c.stdinPiped {
+		stdin = c.transformedReader(Stdin, stdin)
+	}
+	if !c.stdoutPiped {
+		stdout = c.transformedWriter(Stdout, stdout)
+	}
+	if !c.stderrPiped {
+		stderr = c.transformedWriter(Stderr, stderr)
+	}
+	c.impl.SetStdio(stdin, stdout, stderr)
+	c.startSpan()
+	if err := c.impl.Start(); err != nil {
+		c.endSpan(err)
+		return err
+	}
+	return nil
+}
+
+// tracedCommand is implemented by commands that report spans
+// of their own as children of the span of the Cmd.
+type tracedCommand interface {
+	setTraceContext(ctx context.Context)
+}
+
+// startSpan starts the command's span, if it is traced.
+func (c *Cmd) startSpan() {
+	if c.tracer == nil {
+		return
+	}
+	ctx, span := c.tracer.Start(context.Background(), "ssh.command",
+		tracing.String("ssh.host", c.host),
+		tracing.String("ssh.command", redact.Credentials.Redact(utils.CommandString(c.args...))),
+	)
+	if impl, ok := c.impl.(tracedCommand); ok {
+		impl.setTraceContext(ctx)
+	}
+	c.span = span
+}
+
+// endSpan ends the command's span, if it has one,
+// with the error the command failed with.
+func (c *Cmd) endSpan(err error) {
+	if c.span == nil {
+		return
+	}
+	if code, ok := exitCode(err); ok {
+		c.span.SetAttributes(tracing.Int("ssh.exit_code", int64(code)))
+	}
+	c.span.End(err)
+	c.span = nil
+}
+
+// exitCode returns the exit status of a command that returned err
+// from Wait, and whether err holds one.
+func exitCode(err error) (int, bool) {
+	switch err := err.(type) {
+	case nil:
+		return 0, true
+	case *cmd.RcPassthroughError:
+		return err.Code, true
+	case *exec.ExitError:
+		return err.ExitCode(), err.Exited()
+	case interface{ ExitStatus() int }:
+		// The go.crypto client returns *ssh.ExitError.
+		return err.ExitStatus(), true
+	}
+	return 0, false
 }
 
 // Wait waits for the started command to complete,
 // and returns the result as an error.
 func (c *Cmd) Wait() error {
-	return c.impl.Wait()
+	err := c.impl.Wait()
+	if cerr := c.closeOutputs(); err == nil {
+		err = cerr
+	}
+	if c.recorder != nil {
+		c.recorder.finish()
+	}
+	c.endSpan(err)
+	return err
 }
 
 // Kill kills the started command.
@@ -236,6 +482,11 @@ func (c *Cmd) StdinPipe() (io.WriteCloser, error) {
 		return nil, err
 	}
 	c.Stdin = r
+	c.stdinPiped = true
+	wc = c.transformedWriteCloser(Stdin, wc)
+	if c.recorder != nil && c.recorder.rec.Input {
+		return c.recorder.writeCloser("stdin", wc), nil
+	}
 	return wc, nil
 }
 
@@ -248,6 +499,14 @@ func (c *Cmd) StdoutPipe() (io.ReadCloser, error) {
 		return nil, err
 	}
 	c.Stdout = w
+	c.stdoutPiped = true
+	rc = c.transformedReadCloser(Stdout, rc)
+	if c.Tail != nil {
+		rc = utils.TeeReadCloser(rc, c.Tail)
+	}
+	if c.recorder != nil {
+		return c.recorder.readCloser("stdout", rc), nil
+	}
 	return rc, nil
 }
 
@@ -260,9 +519,26 @@ func (c *Cmd) StderrPipe() (io.ReadCloser, error) {
 		return nil, err
 	}
 	c.Stderr = w
+	c.stderrPiped = true
+	rc = c.transformedReadCloser(Stderr, rc)
+	if c.Tail != nil {
+		rc = utils.TeeReadCloser(rc, c.Tail)
+	}
+	if c.recorder != nil {
+		return c.recorder.readCloser("stderr", rc), nil
+	}
 	return rc, nil
 }
 
+// teeWriter returns a writer that writes to both w, if
+// it is not nil, and tail.
+func teeWriter(w io.Writer, tail io.Writer) io.Writer {
+	if w == nil {
+		return tail
+	}
+	return io.MultiWriter(w, tail)
+}
+
 // command is an implementation-specific representation of a
 // command prepared to execute against a specific host.
 type command interface {
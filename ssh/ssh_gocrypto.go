@@ -5,6 +5,7 @@ package ssh
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -22,9 +23,12 @@ import (
 	"github.com/juju/mutex/v2"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/knownhosts"
-	"golang.org/x/crypto/ssh/terminal"
 
 	"github.com/juju/utils/v3"
+	"github.com/juju/utils/v3/errcode"
+	"github.com/juju/utils/v3/prompt"
+	"github.com/juju/utils/v3/redact"
+	"github.com/juju/utils/v3/tracing"
 )
 
 const sshDefaultPort = 22
@@ -55,32 +59,60 @@ func (c *GoCryptoClient) Command(host string, command []string, options *Options
 	if len(signers) == 0 {
 		signers = privateKeys()
 	}
-	user, host := splitUserHost(host)
+	target := host
+	user, host, hostPort := splitUserHost(host)
 	port := sshDefaultPort
 	var proxyCommand []string
 	var knownHostsFile string
+	var hostKeyStore HostKeyStore
+	var sshfpResolver SSHFPResolver
+	var bannerCallback func(host, message string)
+	var serverVersionCallback func(host, version string)
+	var gssapiAuth bool
+	var gssapiClient GSSAPIClientFunc
 	var strictHostKeyChecking StrictHostChecksOption
 	var hostKeyAlgorithms []string
+	events := options.eventSink()
 	if options != nil {
 		if options.port != 0 {
 			port = options.port
 		}
 		proxyCommand = options.proxyCommand
 		knownHostsFile = options.knownHostsFile
+		hostKeyStore = options.hostKeyStore
+		sshfpResolver = options.sshfpResolver
+		bannerCallback = options.bannerCallback
+		serverVersionCallback = options.serverVersionCallback
+		gssapiAuth = options.gssapiAuth
+		gssapiClient = options.gssapiClient
 		strictHostKeyChecking = options.strictHostKeyChecking
 		hostKeyAlgorithms = options.hostKeyAlgorithms
 	}
-	logger.Tracef(`running (equivalent of): ssh "%s@%s" -p %d '%s'`, user, host, port, shellCommand)
-	return &Cmd{impl: &goCryptoCommand{
+	if hostPort != 0 {
+		port = hostPort
+	}
+	logger.Tracef(`running (equivalent of): ssh "%s@%s" -p %d '%s'`, user, host, port, redact.Credentials.Redact(shellCommand))
+	impl := &goCryptoCommand{
 		signers:               signers,
 		user:                  user,
 		addr:                  net.JoinHostPort(host, strconv.Itoa(port)),
 		command:               shellCommand,
 		proxyCommand:          proxyCommand,
 		knownHostsFile:        knownHostsFile,
+		hostKeyStore:          hostKeyStore,
+		sshfpResolver:         sshfpResolver,
+		bannerCallback:        bannerCallback,
+		serverVersionCallback: serverVersionCallback,
+		gssapiAuth:            gssapiAuth,
+		gssapiClient:          gssapiClient,
 		strictHostKeyChecking: strictHostKeyChecking,
 		hostKeyAlgorithms:     hostKeyAlgorithms,
-	}}
+		events:                events,
+		clock:                 options.getClock(),
+		tracer:                options.getTracer(),
+		traceCtx:              context.Background(),
+	}
+	return options.newCmd(impl, target, command)
 }
 
 // Copy implements Client.Copy.
@@ -97,21 +129,66 @@ type goCryptoCommand struct {
 	command               string
 	proxyCommand          []string
 	knownHostsFile        string
+	hostKeyStore          HostKeyStore
+	sshfpResolver         SSHFPResolver
+	bannerCallback        func(host, message string)
+	serverVersionCallback func(host, version string)
+	gssapiAuth            bool
+	gssapiClient          GSSAPIClientFunc
 	strictHostKeyChecking StrictHostChecksOption
 	hostKeyAlgorithms     []string
+	events                eventSink
+	clock                 clock.Clock
 	stdin                 io.Reader
 	stdout                io.Writer
 	stderr                io.Writer
 	client                *ssh.Client
 	sess                  *ssh.Session
+
+	// hostKeyErr holds the error with which the
+	// host key was rejected, if it was.
+	hostKeyErr error
+
+	// tracer reports the connection to the host, if set,
+	// as a child of any span in traceCtx.
+	tracer   tracing.Tracer
+	traceCtx context.Context
 }
 
 var sshDial = ssh.Dial
 
-var sshDialWithProxy = func(addr string, proxyCommand []string, config *ssh.ClientConfig) (*ssh.Client, error) {
+var lookupHost = net.LookupHost
+
+var sshDialWithProxy = func(addr string, proxyCommand []string, config *ssh.ClientConfig, events eventSink) (*ssh.Client, error) {
 	if len(proxyCommand) == 0 {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		if net.ParseIP(host) == nil {
+			events.send(EventResolving, addr, nil)
+			if _, err := lookupHost(host); err != nil {
+				return nil, err
+			}
+		}
+		events.send(EventDialing, addr, nil)
 		return sshDial("tcp", addr, config)
 	}
+	client, err := dialProxy(addr, proxyCommand, config.User)
+	if err != nil {
+		return nil, err
+	}
+	events.send(EventProxyStarted, addr, nil)
+	conn, chans, reqs, err := ssh.NewClientConn(client, addr, config)
+	if err != nil {
+		return nil, err
+	}
+	return ssh.NewClient(conn, chans, reqs), nil
+}
+
+// dialProxy starts the proxy command and returns a connection
+// to its stdin and stdout.
+func dialProxy(addr string, proxyCommand []string, user string) (net.Conn, error) {
 	// User has specified a proxy. Create a pipe and
 	// redirect the proxy command's stdin/stdout to it.
 	host, port, err := net.SplitHostPort(addr)
@@ -119,12 +196,7 @@ var sshDialWithProxy = func(addr string, proxyCommand []string, config *ssh.Clie
 		host = addr
 	}
 	for i, arg := range proxyCommand {
-		arg = strings.Replace(arg, "%h", host, -1)
-		if port != "" {
-			arg = strings.Replace(arg, "%p", port, -1)
-		}
-		arg = strings.Replace(arg, "%r", config.User, -1)
-		proxyCommand[i] = arg
+		proxyCommand[i] = expandProxyTokens(arg, host, port, user)
 	}
 	client, server := net.Pipe()
 	logger.Tracef(`executing proxy command %q`, proxyCommand)
@@ -135,19 +207,39 @@ var sshDialWithProxy = func(addr string, proxyCommand []string, config *ssh.Clie
 	if err := cmd.Start(); err != nil {
 		return nil, err
 	}
-	conn, chans, reqs, err := ssh.NewClientConn(client, addr, config)
-	if err != nil {
-		return nil, err
-	}
-	return ssh.NewClient(conn, chans, reqs), nil
+	return client, nil
 }
 
 func (c *goCryptoCommand) ensureSession() (*ssh.Session, error) {
 	if c.sess != nil {
 		return c.sess, nil
 	}
-	if len(c.signers) == 0 {
-		return nil, errors.Errorf("no private keys available")
+	sess, err := c.newSession()
+	if err != nil {
+		c.events.send(EventClosed, c.addr, err)
+	}
+	return sess, err
+}
+
+// clientConfig returns the configuration for connecting to the host.
+func (c *goCryptoCommand) clientConfig() (*ssh.ClientConfig, error) {
+	var auth []ssh.AuthMethod
+	if c.gssapiAuth {
+		method, err := gssapiAuthMethod(c.gssapiClient, c.addr, c.events)
+		if err != nil {
+			logger.Warningf("not using GSSAPI authentication: %v", err)
+		} else {
+			auth = append(auth, method)
+		}
+	}
+	if len(c.signers) > 0 {
+		auth = append(auth, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			c.events.send(EventAuthenticating, c.addr, nil)
+			return c.signers, nil
+		}))
+	}
+	if len(auth) == 0 {
+		return nil, errcode.New(errcode.ErrAuthFailed, "no private keys available")
 	}
 	if c.user == "" {
 		currentUser, err := user.Current()
@@ -157,19 +249,76 @@ func (c *goCryptoCommand) ensureSession() (*ssh.Session, error) {
 		c.user = currentUser.Username
 	}
 	config := &ssh.ClientConfig{
-		User:              c.user,
-		HostKeyCallback:   c.hostKeyCallback,
-		HostKeyAlgorithms: c.hostKeyAlgorithms,
-		Auth: []ssh.AuthMethod{
-			ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
-				return c.signers, nil
-			}),
+		User: c.user,
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			if err := c.hostKeyCallback(hostname, remote, key); err != nil {
+				c.hostKeyErr = err
+				return err
+			}
+			c.events.send(EventHostKeyVerified, c.addr, nil)
+			return nil
 		},
+		HostKeyAlgorithms: c.hostKeyAlgorithms,
+		Auth:              auth,
+	}
+	if c.bannerCallback != nil {
+		config.BannerCallback = func(message string) error {
+			c.bannerCallback(c.addr, message)
+			return nil
+		}
+	}
+	return config, nil
+}
+
+// connected reports the version of the server to which
+// the client has connected.
+func (c *goCryptoCommand) connected(conn ssh.ConnMetadata) {
+	if c.serverVersionCallback != nil {
+		c.serverVersionCallback(c.addr, string(conn.ServerVersion()))
+	}
+}
+
+// dialError returns err, from connecting to the host, with a code
+// that tells why the connection failed. The go.crypto ssh package
+// reports why a handshake failed only in the text of its errors.
+func (c *goCryptoCommand) dialError(err error) error {
+	if code := errcode.Of(c.hostKeyErr); code != "" {
+		return errcode.Wrap(code, err)
+	}
+	if strings.Contains(err.Error(), "ssh: unable to authenticate") {
+		return errcode.Wrap(errcode.ErrAuthFailed, err)
+	}
+	if netErr, ok := errors.Cause(err).(net.Error); ok {
+		if netErr.Timeout() {
+			return errcode.Wrap(errcode.ErrTimeout, err)
+		}
+		return errcode.Wrap(errcode.ErrConnectionFailed, err)
+	}
+	if code := errcode.Of(err); code != "" {
+		return errcode.Wrap(code, err)
+	}
+	return err
+}
+
+func (c *goCryptoCommand) newSession() (*ssh.Session, error) {
+	config, err := c.clientConfig()
+	if err != nil {
+		return nil, err
 	}
-	client, err := sshDialWithProxy(c.addr, c.proxyCommand, config)
+	_, span := tracing.Start(c.tracer, c.traceCtx, "ssh.dial",
+		tracing.String("ssh.address", c.addr),
+		tracing.String("ssh.user", c.user),
+		tracing.Bool("ssh.proxy", len(c.proxyCommand) > 0),
+	)
+	client, err := sshDialWithProxy(c.addr, c.proxyCommand, config, c.events)
 	if err != nil {
+		err = c.dialError(err)
+		span.End(err)
 		return nil, err
 	}
+	span.SetAttributes(tracing.String("ssh.server_version", string(client.ServerVersion())))
+	span.End(nil)
+	c.connected(client)
 	sess, err := client.NewSession()
 	if err != nil {
 		client.Close()
@@ -183,15 +332,127 @@ func (c *goCryptoCommand) ensureSession() (*ssh.Session, error) {
 	return sess, nil
 }
 
+// Ping implements Pinger.Ping.
+func (c *GoCryptoClient) Ping(host string, options *Options) (*PingResult, error) {
+	cmd := c.Command(host, nil, options).impl.(*goCryptoCommand)
+	result, err := cmd.ping(options.getPingTimeout())
+	cmd.events.send(EventClosed, cmd.addr, err)
+	return result, err
+}
+
+// ping connects to the host, timing each stage, and sends
+// a keepalive request, giving up after the given timeout.
+func (c *goCryptoCommand) ping(timeout time.Duration) (*PingResult, error) {
+	deadline := time.Now().Add(timeout)
+	config, err := c.clientConfig()
+	if err != nil {
+		return nil, err
+	}
+	var result PingResult
+	timer := newStageTimer(c.clock.Now)
+	hostKeyCallback := config.HostKeyCallback
+	config.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if err := hostKeyCallback(hostname, remote, key); err != nil {
+			return err
+		}
+		timer.done(&result.KeyExchange)
+		return nil
+	}
+
+	var conn net.Conn
+	if len(c.proxyCommand) == 0 {
+		host, port, err := net.SplitHostPort(c.addr)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		addr := c.addr
+		if net.ParseIP(host) == nil {
+			c.events.send(EventResolving, c.addr, nil)
+			addrs, err := lookupHost(host)
+			if err != nil {
+				return nil, err
+			}
+			if len(addrs) == 0 {
+				return nil, errors.NotFoundf("addresses for %q", host)
+			}
+			addr = net.JoinHostPort(addrs[0], port)
+		}
+		timer.done(&result.DNS)
+		c.events.send(EventDialing, c.addr, nil)
+		dialer := net.Dialer{Deadline: deadline}
+		if conn, err = dialer.Dial("tcp", addr); err != nil {
+			return nil, c.dialError(err)
+		}
+	} else {
+		if conn, err = dialProxy(c.addr, c.proxyCommand, config.User); err != nil {
+			return nil, err
+		}
+		c.events.send(EventProxyStarted, c.addr, nil)
+	}
+	timer.done(&result.TCP)
+
+	// The deadline bounds the handshake and the keepalive request,
+	// either of which could otherwise wait forever for a server that
+	// accepts connections but does not respond.
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return nil, errors.Trace(err)
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, c.addr, config)
+	if err != nil {
+		conn.Close()
+		return nil, c.pingError(err, deadline)
+	}
+	timer.done(&result.Auth)
+	c.connected(sshConn)
+	client := ssh.NewClient(sshConn, chans, reqs)
+	defer client.Close()
+	if _, _, err := client.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+		return nil, c.pingError(errors.Annotate(err, "keepalive request failed"), deadline)
+	}
+	timer.done(&result.RoundTrip)
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		return nil, errors.Trace(err)
+	}
+	result.ServerVersion = string(sshConn.ServerVersion())
+	result.Total = timer.total()
+	return &result, nil
+}
+
+// pingError returns err, from a ping, with the code errcode.ErrTimeout
+// if the ping's deadline has passed. The go.crypto ssh package does not
+// always report that a read failed because of the deadline; a keepalive
+// request fails with io.EOF once the connection has been closed.
+func (c *goCryptoCommand) pingError(err error, deadline time.Time) error {
+	err = c.dialError(err)
+	if errcode.Of(err) == "" && !time.Now().Before(deadline) {
+		return errcode.Wrap(errcode.ErrTimeout, errors.Annotate(err, "ping timed out"))
+	}
+	return err
+}
+
 func (c *goCryptoCommand) Start() error {
 	sess, err := c.ensureSession()
 	if err != nil {
 		return err
 	}
 	if c.command == "" {
-		return sess.Shell()
+		err = sess.Shell()
+	} else {
+		err = sess.Start(c.command)
 	}
-	return sess.Start(c.command)
+	if err != nil {
+		c.Close()
+		c.events.send(EventClosed, c.addr, err)
+		return err
+	}
+	c.events.send(EventSessionStarted, c.addr, nil)
+	return nil
+}
+
+// setTraceContext implements tracedCommand.
+func (c *goCryptoCommand) setTraceContext(ctx context.Context) {
+	c.traceCtx = ctx
 }
 
 func (c *goCryptoCommand) Close() error {
@@ -214,6 +475,7 @@ func (c *goCryptoCommand) Wait() error {
 	}
 	err := c.sess.Wait()
 	c.Close()
+	c.events.send(EventClosed, c.addr, err)
 	return err
 }
 
@@ -258,8 +520,11 @@ func (c *goCryptoCommand) StderrPipe() (io.ReadCloser, io.Writer, error) {
 }
 
 func (c *goCryptoCommand) hostKeyCallback(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	if c.sshfpResolver != nil && verifySSHFP(c.sshfpResolver, hostname, key) {
+		return nil
+	}
 	knownHostsFile := c.knownHostsFile
-	if knownHostsFile == "" {
+	if knownHostsFile == "" && c.hostKeyStore == nil {
 		knownHostsFile = GoCryptoKnownHostsFile()
 		if knownHostsFile == "" {
 			return errors.New("known_hosts file not configured")
@@ -283,7 +548,12 @@ func (c *goCryptoCommand) hostKeyCallback(hostname string, remote net.Addr, key
 		}
 	}
 
-	matched, err := checkHostKey(hostname, remote, key, knownHostsFile, printError)
+	var matched bool
+	if c.hostKeyStore != nil {
+		matched, err = checkStoredHostKey(hostname, key, c.hostKeyStore, printError)
+	} else {
+		matched, err = checkHostKey(hostname, remote, key, knownHostsFile, printError)
+	}
 	if err != nil || matched {
 		return errors.Trace(err)
 	}
@@ -309,41 +579,35 @@ func (c *goCryptoCommand) hostKeyCallback(hostname string, remote net.Addr, key
 			// we can't ask the user if they want
 			// to accept.
 			logger.Errorf("%s", message)
-			return errors.New("not running in a terminal, cannot prompt for verification")
+			return errcode.New(errcode.ErrHostKeyUnknown, "not running in a terminal, cannot prompt for verification")
 		}
 
 		// Prompt user, asking if they trust the key.
-		fmt.Fprint(term, message+"Are you sure you want to continue connecting (yes/no)? ")
-		for {
-			line, err := term.ReadLine()
-			if err != nil {
-				return errors.Trace(err)
-			}
-			var yes bool
-			switch strings.ToLower(line) {
-			case "yes":
-				yes = true
-			case "no":
-				return errors.New("Host key verification failed.")
-			default:
-				fmt.Fprint(term, "Please type 'yes' or 'no': ")
-			}
-			if yes {
-				break
-			}
+		answer, err := prompt.New(term, c.clock).Choice(prompt.Prompt{
+			Question: message + "Are you sure you want to continue connecting (yes/no)? ",
+		}, []string{"yes", "no"})
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if answer == "no" {
+			return errcode.New(errcode.ErrHostKeyUnknown, "Host key verification failed.")
 		}
 	default:
-		return errors.Errorf(
+		return errcode.Errorf(errcode.ErrHostKeyUnknown,
 			`no %s host key is known for %s and you have requested strict checking`,
 			key.Type(), hostname,
 		)
 	}
 
-	if knownHostsFile != os.DevNull {
+	if c.hostKeyStore != nil {
+		if err := c.hostKeyStore.AddHostKey(knownhosts.Normalize(hostname), key); err != nil {
+			return errors.Annotate(err, "cannot store host key")
+		}
+	} else if knownHostsFile != os.DevNull {
 		// Make sure no other process modifies the file.
 		releaser, err := mutex.Acquire(mutex.Spec{
 			Name:  "juju-ssh-client",
-			Clock: clock.WallClock,
+			Clock: c.clock,
 			Delay: time.Second,
 		})
 		if err != nil {
@@ -376,22 +640,9 @@ func (c *goCryptoCommand) hostKeyCallback(hostname string, remote net.Addr, key
 	return nil
 }
 
-type readLineWriter interface {
-	io.Writer
-	ReadLine() (string, error)
-}
+type readLineWriter = prompt.ReadLineWriter
 
-var getTerminal = func() (readLineWriter, func(), error) {
-	if fd := int(os.Stdin.Fd()); terminal.IsTerminal(fd) {
-		oldState, err := terminal.MakeRaw(fd)
-		if err != nil {
-			return nil, nil, errors.Trace(err)
-		}
-		cleanup := func() { terminal.Restore(fd, oldState) }
-		return terminal.NewTerminal(os.Stdin, ""), cleanup, nil
-	}
-	return nil, nil, nil
-}
+var getTerminal = prompt.OpenTerminal
 
 // checkHostKey checks the given (hostname, address, public key) tuple
 // against the local known-hosts database, if it exists, and returns a
@@ -426,18 +677,7 @@ func checkHostKey(
 			// Unknown host.
 			return false, nil
 		}
-		head := fmt.Sprintf(`
-@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@
-@    WARNING: REMOTE HOST IDENTIFICATION HAS CHANGED!     @
-@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@
-IT IS POSSIBLE THAT SOMEONE IS DOING SOMETHING NASTY!
-Someone could be eavesdropping on you right now (man-in-the-middle attack)!
-It is also possible that a host key has just been changed.
-The fingerprint for the %s key sent by the remote host is
-%s.
-Please contact your system administrator.
-Add correct host key in %s to get rid of this message.
-`[1:], key.Type(), ssh.FingerprintSHA256(key), knownHostsFile)
+		head := hostKeyChangedWarning(key, knownHostsFile)
 
 		var typeKey *knownhosts.KnownKey
 		for i, knownKey := range err.Want {
@@ -472,16 +712,63 @@ Add correct host key in %s to get rid of this message.
 				err, "failed to print host key mismatch warning",
 			)
 		}
+		return false, errcode.Wrap(errcode.ErrHostKeyMismatch, errors.Trace(err))
 	}
 	return false, errors.Trace(err)
 }
 
-func splitUserHost(s string) (user, host string) {
-	userHost := strings.SplitN(s, "@", 2)
-	if len(userHost) == 2 {
-		return userHost[0], userHost[1]
+// checkStoredHostKey is like checkHostKey, for a host key store.
+func checkStoredHostKey(
+	hostname string,
+	key ssh.PublicKey,
+	store HostKeyStore,
+	printError func(string) error,
+) (bool, error) {
+	known, err := store.HostKeys(knownhosts.Normalize(hostname))
+	if err != nil {
+		return false, errors.Annotate(err, "cannot read host keys")
+	}
+	if len(known) == 0 {
+		return false, nil
+	}
+	if containsKey(known, key) {
+		return true, nil
+	}
+	tail := "Host was previously using different host key algorithms:"
+	for _, knownKey := range known {
+		if knownKey.Type() == key.Type() {
+			tail = fmt.Sprintf("Offending %s key %s", knownKey.Type(), ssh.FingerprintSHA256(knownKey))
+			break
+		}
+		tail += fmt.Sprintf("\n - %s key %s", knownKey.Type(), ssh.FingerprintSHA256(knownKey))
 	}
-	return "", userHost[0]
+	location := "the host key store"
+	if s, ok := store.(fmt.Stringer); ok {
+		location = s.String()
+	}
+	if err := printError(hostKeyChangedWarning(key, location) + tail); err != nil {
+		return false, errors.Annotate(
+			err, "failed to print host key mismatch warning",
+		)
+	}
+	return false, errcode.Errorf(errcode.ErrHostKeyMismatch, "host key mismatch for %s", hostname)
+}
+
+// hostKeyChangedWarning returns the start of the warning printed when
+// a host's key does not match the one stored in the given location.
+func hostKeyChangedWarning(key ssh.PublicKey, location string) string {
+	return fmt.Sprintf(`
+@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@
+@    WARNING: REMOTE HOST IDENTIFICATION HAS CHANGED!     @
+@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@
+IT IS POSSIBLE THAT SOMEONE IS DOING SOMETHING NASTY!
+Someone could be eavesdropping on you right now (man-in-the-middle attack)!
+It is also possible that a host key has just been changed.
+The fingerprint for the %s key sent by the remote host is
+%s.
+Please contact your system administrator.
+Add correct host key in %s to get rid of this message.
+`[1:], key.Type(), ssh.FingerprintSHA256(key), location)
 }
 
 var (
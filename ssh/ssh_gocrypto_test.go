@@ -17,14 +17,18 @@ import (
 	"path/filepath"
 	"regexp"
 	"sync"
+	"time"
 
+	"github.com/juju/clock/testclock"
 	"github.com/juju/testing"
 	jc "github.com/juju/testing/checkers"
 	cryptossh "golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/testdata"
 	gc "gopkg.in/check.v1"
 
+	"github.com/juju/utils/v3/errcode"
 	"github.com/juju/utils/v3/ssh"
+	"github.com/juju/utils/v3/tracing"
 )
 
 var (
@@ -44,7 +48,11 @@ func (s *sshServer) run(c *gc.C) {
 	defer netconn.Close()
 
 	conn, chans, reqs, err := cryptossh.NewServerConn(netconn, s.cfg)
-	c.Assert(err, jc.ErrorIsNil)
+	if err != nil {
+		// Some tests expect the client to reject the server, and
+		// may have finished by the time the handshake fails.
+		return
+	}
 	s.client = cryptossh.NewClient(conn, chans, reqs)
 
 	var wg sync.WaitGroup
@@ -235,6 +243,238 @@ func (s *SSHGoCryptoCommandSuite) TestCommand(c *gc.C) {
 	)
 }
 
+func (s *SSHGoCryptoCommandSuite) TestCommandRecording(c *gc.C) {
+	client, _ := newClient(c)
+	server, _ := s.newServer(c, cryptossh.ServerConfig{})
+	serverPort := server.listener.Addr().(*net.TCPAddr).Port
+	var recording bytes.Buffer
+	var opts ssh.Options
+	opts.SetPort(serverPort)
+	opts.SetStrictHostKeyChecking(ssh.StrictHostChecksNo)
+	opts.SetRecording(ssh.Recording{Writer: &recording})
+	cmd := client.Command("127.0.0.1", testCommand, &opts)
+	server.cfg.PublicKeyCallback = func(_ cryptossh.ConnMetadata, _ cryptossh.PublicKey) (*cryptossh.Permissions, error) {
+		return nil, nil
+	}
+	go server.run(c)
+	out, err := cmd.Output()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(out), gc.Equals, "abc value\n")
+
+	header, events := parseRecording(c, recording.String())
+	c.Check(header["title"], gc.Equals, "127.0.0.1")
+	c.Check(events, gc.HasLen, 1)
+	c.Check(events[0][1:], jc.DeepEquals, []interface{}{"o", "abc value\n"})
+}
+
+func (s *SSHGoCryptoCommandSuite) TestPing(c *gc.C) {
+	client, _ := newClient(c)
+	server, _ := s.newServer(c, cryptossh.ServerConfig{})
+	serverPort := server.listener.Addr().(*net.TCPAddr).Port
+	server.cfg.PublicKeyCallback = func(_ cryptossh.ConnMetadata, _ cryptossh.PublicKey) (*cryptossh.Permissions, error) {
+		return nil, nil
+	}
+	s.PatchValue(ssh.LookupHost, func(host string) ([]string, error) {
+		c.Check(host, gc.Equals, "server.example")
+		return []string{"127.0.0.1"}, nil
+	})
+	events := make(chan ssh.Event, 10)
+	var opts ssh.Options
+	opts.SetPort(serverPort)
+	opts.SetStrictHostKeyChecking(ssh.StrictHostChecksNo)
+	opts.SetEvents(events)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		server.run(c)
+	}()
+
+	result, err := client.Ping("server.example", &opts)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(result.ServerVersion, gc.Equals, "SSH-2.0-Go")
+	for _, d := range []time.Duration{result.DNS, result.TCP, result.KeyExchange, result.Auth, result.RoundTrip} {
+		c.Check(d >= 0, jc.IsTrue)
+		c.Check(d <= result.Total, jc.IsTrue)
+	}
+	<-done
+
+	close(events)
+	var kinds []ssh.EventKind
+	for event := range events {
+		kinds = append(kinds, event.Kind)
+	}
+	c.Assert(kinds, jc.DeepEquals, []ssh.EventKind{
+		ssh.EventResolving,
+		ssh.EventDialing,
+		ssh.EventHostKeyVerified,
+		ssh.EventAuthenticating,
+		ssh.EventClosed,
+	})
+}
+
+func (s *SSHGoCryptoCommandSuite) TestPingTimeout(c *gc.C) {
+	client, _ := newClient(c)
+	// The server accepts connections but never speaks.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, jc.ErrorIsNil)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	var opts ssh.Options
+	opts.SetPort(listener.Addr().(*net.TCPAddr).Port)
+	opts.SetStrictHostKeyChecking(ssh.StrictHostChecksNo)
+	opts.SetPingTimeout(100 * time.Millisecond)
+	_, err = client.Ping("127.0.0.1", &opts)
+	c.Assert(err, gc.ErrorMatches, "ping timed out: .*")
+	c.Check(errcode.Of(err), gc.Equals, errcode.ErrTimeout)
+}
+
+func (s *SSHGoCryptoCommandSuite) TestPingResolveFailure(c *gc.C) {
+	client, _ := newClient(c)
+	s.PatchValue(ssh.LookupHost, func(host string) ([]string, error) {
+		return nil, errors.New("no such host")
+	})
+	_, err := client.Ping("server.example", nil)
+	c.Assert(err, gc.ErrorMatches, "no such host")
+}
+
+func (s *SSHGoCryptoCommandSuite) TestCommandEvents(c *gc.C) {
+	client, _ := newClient(c)
+	server, _ := s.newServer(c, cryptossh.ServerConfig{})
+	serverPort := server.listener.Addr().(*net.TCPAddr).Port
+	events := make(chan ssh.Event, 10)
+	var opts ssh.Options
+	opts.SetPort(serverPort)
+	opts.SetStrictHostKeyChecking(ssh.StrictHostChecksNo)
+	opts.SetEvents(events)
+	cmd := client.Command("127.0.0.1", testCommand, &opts)
+	server.cfg.PublicKeyCallback = func(_ cryptossh.ConnMetadata, _ cryptossh.PublicKey) (*cryptossh.Permissions, error) {
+		return nil, nil
+	}
+	go server.run(c)
+	_, err := cmd.Output()
+	c.Assert(err, jc.ErrorIsNil)
+	close(events)
+
+	var kinds []ssh.EventKind
+	for event := range events {
+		c.Check(event.Host, gc.Equals, fmt.Sprintf("127.0.0.1:%d", serverPort))
+		c.Check(event.Time.IsZero(), jc.IsFalse)
+		c.Check(event.Err, jc.ErrorIsNil)
+		kinds = append(kinds, event.Kind)
+	}
+	c.Assert(kinds, jc.DeepEquals, []ssh.EventKind{
+		ssh.EventDialing,
+		ssh.EventHostKeyVerified,
+		ssh.EventAuthenticating,
+		ssh.EventSessionStarted,
+		ssh.EventClosed,
+	})
+}
+
+func (s *SSHGoCryptoCommandSuite) TestCommandTracing(c *gc.C) {
+	client, _ := newClient(c)
+	server, _ := s.newServer(c, cryptossh.ServerConfig{})
+	serverPort := server.listener.Addr().(*net.TCPAddr).Port
+	var rec tracing.Recorder
+	var opts ssh.Options
+	opts.SetPort(serverPort)
+	opts.SetStrictHostKeyChecking(ssh.StrictHostChecksNo)
+	opts.SetTracer(&rec)
+	cmd := client.Command("127.0.0.1", testCommand, &opts)
+	server.cfg.PublicKeyCallback = func(_ cryptossh.ConnMetadata, _ cryptossh.PublicKey) (*cryptossh.Permissions, error) {
+		return nil, nil
+	}
+	go server.run(c)
+	_, err := cmd.Output()
+	c.Assert(err, jc.ErrorIsNil)
+
+	spans := rec.Spans()
+	c.Assert(rec.Names(), jc.DeepEquals, []string{"ssh.command", "ssh.dial"})
+	c.Check(spans[0].Attribute("ssh.host"), gc.Equals, "127.0.0.1")
+	c.Check(spans[0].Attribute("ssh.exit_code"), gc.Equals, int64(0))
+	c.Check(spans[0].Ended, jc.IsTrue)
+	c.Check(spans[1].Parent, gc.Equals, 0)
+	c.Check(spans[1].Attribute("ssh.address"), gc.Equals, fmt.Sprintf("127.0.0.1:%d", serverPort))
+	c.Check(spans[1].Attribute("ssh.server_version"), gc.Matches, "SSH-2.0-.*")
+	c.Check(spans[1].Ended, jc.IsTrue)
+	c.Check(spans[1].Err, jc.ErrorIsNil)
+}
+
+func (s *SSHGoCryptoCommandSuite) TestCommandTracingDialFailure(c *gc.C) {
+	client, _ := newClient(c)
+	s.PatchValue(ssh.SSHDial, func(network, address string, cfg *cryptossh.ClientConfig) (*cryptossh.Client, error) {
+		return nil, errors.New("ssh.Dial failed")
+	})
+	var rec tracing.Recorder
+	var opts ssh.Options
+	opts.SetTracer(&rec)
+	err := client.Command("127.0.0.1", testCommand, &opts).Run()
+	c.Assert(err, gc.ErrorMatches, "ssh.Dial failed")
+
+	spans := rec.Spans()
+	c.Assert(rec.Names(), jc.DeepEquals, []string{"ssh.command", "ssh.dial"})
+	for _, span := range spans {
+		c.Check(span.Ended, jc.IsTrue)
+		c.Check(span.Err, gc.ErrorMatches, "ssh.Dial failed")
+	}
+	c.Check(spans[0].Attribute("ssh.exit_code"), gc.IsNil)
+}
+
+func (s *SSHGoCryptoCommandSuite) TestCommandEventsResolveFailure(c *gc.C) {
+	s.PatchValue(ssh.LookupHost, func(host string) ([]string, error) {
+		c.Check(host, gc.Equals, "nowhere.invalid")
+		return nil, errors.New("no such host")
+	})
+	client, _ := newClient(c)
+	events := make(chan ssh.Event, 10)
+	var opts ssh.Options
+	opts.SetEvents(events)
+	cmd := client.Command("nowhere.invalid", testCommand, &opts)
+	_, err := cmd.Output()
+	c.Assert(err, gc.ErrorMatches, "no such host")
+	close(events)
+
+	var got []ssh.Event
+	for event := range events {
+		got = append(got, event)
+	}
+	c.Assert(got, gc.HasLen, 2)
+	c.Assert(got[0].Kind, gc.Equals, ssh.EventResolving)
+	c.Assert(got[1].Kind, gc.Equals, ssh.EventClosed)
+	c.Assert(got[1].Err, gc.ErrorMatches, "no such host")
+}
+
+func (s *SSHGoCryptoCommandSuite) TestCommandEventsUseClock(c *gc.C) {
+	s.PatchValue(ssh.LookupHost, func(host string) ([]string, error) {
+		return nil, errors.New("no such host")
+	})
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	client, _ := newClient(c)
+	events := make(chan ssh.Event, 10)
+	var opts ssh.Options
+	opts.SetEvents(events)
+	opts.SetClock(testclock.NewClock(now))
+	cmd := client.Command("nowhere.invalid", testCommand, &opts)
+	_, err := cmd.Output()
+	c.Assert(err, gc.ErrorMatches, "no such host")
+	close(events)
+
+	n := 0
+	for event := range events {
+		c.Check(event.Time, gc.Equals, now)
+		n++
+	}
+	c.Assert(n, gc.Equals, 2)
+}
+
 func (s *SSHGoCryptoCommandSuite) TestCopy(c *gc.C) {
 	client, err := ssh.NewGoCryptoClient()
 	c.Assert(err, jc.ErrorIsNil)
@@ -272,6 +512,299 @@ func (s *SSHGoCryptoCommandSuite) TestProxyCommand(c *gc.C) {
 	c.Assert(string(data), gc.Equals, fmt.Sprintf("%s -q0 127.0.0.1 %v\n", netcat, port))
 }
 
+func (s *SSHGoCryptoCommandSuite) TestCommandIPv6Address(c *gc.C) {
+	var addrs []string
+	s.PatchValue(ssh.SSHDial, func(network, address string, cfg *cryptossh.ClientConfig) (*cryptossh.Client, error) {
+		c.Check(cfg.User, gc.Equals, "ubuntu")
+		addrs = append(addrs, address)
+		return nil, errors.New("ssh.Dial failed")
+	})
+	client, _ := newClient(c)
+	var opts ssh.Options
+	opts.SetPort(2022)
+	for _, host := range []string{
+		"ubuntu@2001:db8::1",
+		"ubuntu@[2001:db8::1]",
+		"ubuntu@[2001:db8::1]:2222",
+		"ubuntu@fe80::1%eth0",
+		"ubuntu@[fe80::1%eth0]:2222",
+	} {
+		_, err := client.Command(host, testCommand, &opts).Output()
+		c.Check(err, gc.ErrorMatches, "ssh.Dial failed")
+	}
+	c.Assert(addrs, jc.DeepEquals, []string{
+		"[2001:db8::1]:2022",
+		"[2001:db8::1]:2022",
+		"[2001:db8::1]:2222",
+		"[fe80::1%eth0]:2022",
+		"[fe80::1%eth0]:2222",
+	})
+}
+
+func (s *SSHGoCryptoCommandSuite) TestCommandIPv6KnownHosts(c *gc.C) {
+	listener, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		c.Skip(fmt.Sprintf("IPv6 loopback not available: %v", err))
+	}
+	server := &sshServer{cfg: &cryptossh.ServerConfig{NoClientAuth: true}, listener: listener}
+	server.cfg.AddHostKey(s.testSigners["rsa"])
+	serverPort := listener.Addr().(*net.TCPAddr).Port
+	go server.run(c)
+
+	var opts ssh.Options
+	opts.SetStrictHostKeyChecking(ssh.StrictHostChecksNo)
+	client, _ := newClient(c)
+	out, err := client.Command(fmt.Sprintf("ubuntu@[::1]:%d", serverPort), testCommand, &opts).Output()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(out), gc.Equals, "abc value\n")
+
+	knownHosts, err := ioutil.ReadFile(s.knownHostsFile)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(knownHosts), gc.Equals, fmt.Sprintf(
+		"[::1]:%d %s",
+		serverPort,
+		cryptossh.MarshalAuthorizedKey(s.testPublicKeys["rsa"]),
+	))
+}
+
+func (s *SSHGoCryptoCommandSuite) TestProxyCommandIPv6(c *gc.C) {
+	realNetcat, err := exec.LookPath("nc")
+	if err != nil {
+		c.Skip(fmt.Sprintf("skipping test, couldn't find netcat: %v", err))
+	}
+	listener, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		c.Skip(fmt.Sprintf("IPv6 loopback not available: %v", err))
+	}
+	server := &sshServer{cfg: &cryptossh.ServerConfig{NoClientAuth: true}, listener: listener}
+	server.cfg.AddHostKey(s.testSigners["rsa"])
+	serverPort := listener.Addr().(*net.TCPAddr).Port
+	go server.run(c)
+
+	proxy := filepath.Join(c.MkDir(), "proxy")
+	err = ioutil.WriteFile(proxy, []byte("#!/bin/sh\necho \"$@\" > $0.args && exec "+realNetcat+" -q0 $2 $3"), 0755)
+	c.Assert(err, jc.ErrorIsNil)
+
+	client, _ := newClient(c)
+	var opts ssh.Options
+	opts.SetStrictHostKeyChecking(ssh.StrictHostChecksNo)
+	opts.SetProxyCommand(proxy, "%r", "%h", "%p", "[%h]:%p")
+	out, err := client.Command(fmt.Sprintf("ubuntu@[::1]:%d", serverPort), testCommand, &opts).Output()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(out), gc.Equals, "abc value\n")
+	data, err := ioutil.ReadFile(proxy + ".args")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(data), gc.Equals, fmt.Sprintf("ubuntu ::1 %[1]d [::1]:%[1]d\n", serverPort))
+}
+
+// dialAs connects to the SSH server at addr, as if it were at address.
+func dialAs(network, addr, address string, cfg *cryptossh.ClientConfig) (*cryptossh.Client, error) {
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	c, chans, reqs, err := cryptossh.NewClientConn(conn, address, cfg)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return cryptossh.NewClient(c, chans, reqs), nil
+}
+
+func (s *SSHGoCryptoCommandSuite) TestSSHFP(c *gc.C) {
+	server, serverKey := s.newServer(c, cryptossh.ServerConfig{NoClientAuth: true})
+	serverPort := server.listener.Addr().(*net.TCPAddr).Port
+	go server.run(c)
+	s.PatchValue(ssh.LookupHost, func(host string) ([]string, error) {
+		return []string{"127.0.0.1"}, nil
+	})
+	s.PatchValue(ssh.SSHDial, func(network, address string, cfg *cryptossh.ClientConfig) (*cryptossh.Client, error) {
+		return dialAs(network, server.listener.Addr().String(), address, cfg)
+	})
+
+	var opts ssh.Options
+	opts.SetPort(serverPort)
+	opts.SetStrictHostKeyChecking(ssh.StrictHostChecksYes)
+	opts.SetSSHFPResolver(func(host string) ([]ssh.SSHFPRecord, bool, error) {
+		c.Check(host, gc.Equals, "host.example")
+		return ssh.NewSSHFPRecords(serverKey), true, nil
+	})
+	client, _ := newClient(c)
+	out, err := client.Command("host.example", testCommand, &opts).Output()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(out), gc.Equals, "abc value\n")
+	_, err = os.Stat(s.knownHostsFile)
+	c.Assert(err, jc.Satisfies, os.IsNotExist)
+}
+
+func (s *SSHGoCryptoCommandSuite) TestSSHFPNotValidated(c *gc.C) {
+	server, serverKey := s.newServer(c, cryptossh.ServerConfig{NoClientAuth: true})
+	serverPort := server.listener.Addr().(*net.TCPAddr).Port
+	go server.run(c)
+	s.PatchValue(ssh.LookupHost, func(host string) ([]string, error) {
+		return []string{"127.0.0.1"}, nil
+	})
+	s.PatchValue(ssh.SSHDial, func(network, address string, cfg *cryptossh.ClientConfig) (*cryptossh.Client, error) {
+		return dialAs(network, server.listener.Addr().String(), address, cfg)
+	})
+
+	// Falling back to the known hosts, the key is added.
+	var opts ssh.Options
+	opts.SetPort(serverPort)
+	opts.SetStrictHostKeyChecking(ssh.StrictHostChecksNo)
+	opts.SetSSHFPResolver(func(host string) ([]ssh.SSHFPRecord, bool, error) {
+		return ssh.NewSSHFPRecords(serverKey), false, nil
+	})
+	client, _ := newClient(c)
+	_, err := client.Command("host.example", testCommand, &opts).Output()
+	c.Assert(err, jc.ErrorIsNil)
+	knownHosts, err := ioutil.ReadFile(s.knownHostsFile)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(knownHosts), gc.Equals, fmt.Sprintf(
+		"[host.example]:%d %s",
+		serverPort,
+		cryptossh.MarshalAuthorizedKey(serverKey),
+	))
+}
+
+func (s *SSHGoCryptoCommandSuite) TestSSHFPIPAddress(c *gc.C) {
+	server, _ := s.newServer(c, cryptossh.ServerConfig{NoClientAuth: true})
+	serverPort := server.listener.Addr().(*net.TCPAddr).Port
+	go server.run(c)
+
+	var opts ssh.Options
+	opts.SetPort(serverPort)
+	opts.SetStrictHostKeyChecking(ssh.StrictHostChecksNo)
+	opts.SetSSHFPResolver(func(host string) ([]ssh.SSHFPRecord, bool, error) {
+		c.Errorf("unexpected lookup of %q", host)
+		return nil, false, nil
+	})
+	client, _ := newClient(c)
+	_, err := client.Command("127.0.0.1", testCommand, &opts).Output()
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = os.Stat(s.knownHostsFile)
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *SSHGoCryptoCommandSuite) TestBannerAndServerVersionCallbacks(c *gc.C) {
+	server, _ := s.newServer(c, cryptossh.ServerConfig{
+		NoClientAuth:  true,
+		ServerVersion: "SSH-2.0-Test_1.0",
+		BannerCallback: func(cryptossh.ConnMetadata) string {
+			return "Authorised use only.\n"
+		},
+	})
+	serverPort := server.listener.Addr().(*net.TCPAddr).Port
+	addr := fmt.Sprintf("127.0.0.1:%d", serverPort)
+
+	var calls []string
+	var opts ssh.Options
+	opts.SetPort(serverPort)
+	opts.SetStrictHostKeyChecking(ssh.StrictHostChecksNo)
+	opts.SetBannerCallback(func(host, message string) {
+		calls = append(calls, "banner "+host+" "+message)
+	})
+	opts.SetServerVersionCallback(func(host, version string) {
+		calls = append(calls, "version "+host+" "+version)
+	})
+	client, _ := newClient(c)
+	go server.run(c)
+	_, err := client.Command("127.0.0.1", testCommand, &opts).Output()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(calls, jc.DeepEquals, []string{
+		"banner " + addr + " Authorised use only.\n",
+		"version " + addr + " SSH-2.0-Test_1.0",
+	})
+
+	calls = nil
+	go server.run(c)
+	result, err := client.Ping("127.0.0.1", &opts)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(result.ServerVersion, gc.Equals, "SSH-2.0-Test_1.0")
+	c.Check(calls, jc.DeepEquals, []string{
+		"banner " + addr + " Authorised use only.\n",
+		"version " + addr + " SSH-2.0-Test_1.0",
+	})
+}
+
+// fakeGSSAPI implements both ends of a trivial GSSAPI mechanism.
+type fakeGSSAPI struct {
+	testing.Stub
+}
+
+func (f *fakeGSSAPI) InitSecContext(target string, token []byte, isGSSDelegCreds bool) ([]byte, bool, error) {
+	f.MethodCall(f, "InitSecContext", target, string(token))
+	return []byte("ticket for " + target), false, f.NextErr()
+}
+
+func (f *fakeGSSAPI) GetMIC(micField []byte) ([]byte, error) {
+	f.MethodCall(f, "GetMIC")
+	return append([]byte("mic:"), micField...), f.NextErr()
+}
+
+func (f *fakeGSSAPI) AcceptSecContext(token []byte) ([]byte, string, bool, error) {
+	f.MethodCall(f, "AcceptSecContext", string(token))
+	return nil, "ubuntu@EXAMPLE.COM", false, f.NextErr()
+}
+
+func (f *fakeGSSAPI) VerifyMIC(micField []byte, micToken []byte) error {
+	f.MethodCall(f, "VerifyMIC")
+	if !bytes.Equal(micToken, append([]byte("mic:"), micField...)) {
+		return errors.New("bad MIC")
+	}
+	return f.NextErr()
+}
+
+func (f *fakeGSSAPI) DeleteSecContext() error {
+	f.MethodCall(f, "DeleteSecContext")
+	return f.NextErr()
+}
+
+func (s *SSHGoCryptoCommandSuite) TestGSSAPIAuth(c *gc.C) {
+	var clientGSS, serverGSS fakeGSSAPI
+	server, _ := s.newServer(c, cryptossh.ServerConfig{
+		GSSAPIWithMICConfig: &cryptossh.GSSAPIWithMICConfig{
+			AllowLogin: func(conn cryptossh.ConnMetadata, srcName string) (*cryptossh.Permissions, error) {
+				c.Check(conn.User(), gc.Equals, "ubuntu")
+				c.Check(srcName, gc.Equals, "ubuntu@EXAMPLE.COM")
+				return nil, nil
+			},
+			Server: &serverGSS,
+		},
+	})
+	serverPort := server.listener.Addr().(*net.TCPAddr).Port
+	go server.run(c)
+
+	// The client has no keys, so it can only use GSSAPI.
+	client, err := ssh.NewGoCryptoClient()
+	c.Assert(err, jc.ErrorIsNil)
+	var opts ssh.Options
+	opts.SetPort(serverPort)
+	opts.SetStrictHostKeyChecking(ssh.StrictHostChecksNo)
+	opts.EnableGSSAPIAuth(func() (cryptossh.GSSAPIClient, error) {
+		return &clientGSS, nil
+	})
+	out, err := client.Command("ubuntu@127.0.0.1", testCommand, &opts).Output()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(out), gc.Equals, "abc value\n")
+	clientGSS.CheckCallNames(c, "InitSecContext", "GetMIC", "DeleteSecContext")
+	clientGSS.CheckCall(c, 0, "InitSecContext", "host@127.0.0.1", "")
+	serverGSS.CheckCall(c, 0, "AcceptSecContext", "ticket for host@127.0.0.1")
+}
+
+func (s *SSHGoCryptoCommandSuite) TestGSSAPIAuthUnavailable(c *gc.C) {
+	// Without the krb5 build tag, there is no default GSSAPI
+	// client, so only public key authentication is possible.
+	s.PatchValue(ssh.DefaultGSSAPIClient, nil)
+	client, err := ssh.NewGoCryptoClient()
+	c.Assert(err, jc.ErrorIsNil)
+	var opts ssh.Options
+	opts.EnableGSSAPIAuth(nil)
+	_, err = client.Command("ubuntu@127.0.0.1", testCommand, &opts).Output()
+	c.Assert(err, gc.ErrorMatches, "no private keys available")
+	c.Check(errcode.Of(err), gc.Equals, errcode.ErrAuthFailed)
+}
+
 func (s *SSHGoCryptoCommandSuite) TestStrictHostChecksYes(c *gc.C) {
 	server, _ := s.newServer(c, cryptossh.ServerConfig{NoClientAuth: true})
 	serverPort := server.listener.Addr().(*net.TCPAddr).Port
@@ -303,6 +836,7 @@ func (s *SSHGoCryptoCommandSuite) TestStrictHostChecksAskNonTerminal(c *gc.C) {
 	cmd := client.Command("127.0.0.1", testCommand, &opts)
 	_, err := cmd.Output()
 	c.Assert(err, gc.ErrorMatches, "ssh: handshake failed: not running in a terminal, cannot prompt for verification")
+	c.Check(errcode.Of(err), gc.Equals, errcode.ErrHostKeyUnknown)
 	_, err = os.Stat(s.knownHostsFile)
 	c.Assert(err, jc.Satisfies, os.IsNotExist)
 }
@@ -396,6 +930,7 @@ func (s *SSHGoCryptoCommandSuite) TestStrictHostChecksNoMismatch(c *gc.C) {
 	cmd := client.Command("127.0.0.1", testCommand, &opts)
 	_, err = cmd.Output()
 	c.Assert(err, gc.ErrorMatches, "ssh: handshake failed: knownhosts: key mismatch")
+	c.Check(errcode.Of(err), gc.Equals, errcode.ErrHostKeyMismatch)
 
 	c.Assert(readLineWriter.written.String(), gc.Matches, fmt.Sprintf(`
 @@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@
@@ -459,6 +994,86 @@ Host was previously using different host key algorithms:
 `[1:], regexp.QuoteMeta(cryptossh.FingerprintSHA256(serverKey))))
 }
 
+func (s *SSHGoCryptoCommandSuite) TestHostKeyStoreTrustOnFirstUse(c *gc.C) {
+	server, serverKey := s.newServer(c, cryptossh.ServerConfig{NoClientAuth: true})
+	serverPort := server.listener.Addr().(*net.TCPAddr).Port
+	go server.run(c)
+
+	store := ssh.NewMemoryHostKeyStore()
+	var opts ssh.Options
+	opts.SetPort(serverPort)
+	opts.SetStrictHostKeyChecking(ssh.StrictHostChecksNo)
+	opts.SetHostKeyStore(store)
+	client, _ := newClient(c)
+	_, err := client.Command("127.0.0.1", testCommand, &opts).Output()
+	c.Assert(err, jc.ErrorIsNil)
+
+	keys, err := store.HostKeys(fmt.Sprintf("[127.0.0.1]:%d", serverPort))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(keys, jc.DeepEquals, []cryptossh.PublicKey{serverKey})
+	_, err = os.Stat(s.knownHostsFile)
+	c.Assert(err, jc.Satisfies, os.IsNotExist)
+
+	// The stored key is trusted even with strict checking.
+	go server.run(c)
+	opts.SetStrictHostKeyChecking(ssh.StrictHostChecksYes)
+	_, err = client.Command("127.0.0.1", testCommand, &opts).Output()
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *SSHGoCryptoCommandSuite) TestHostKeyStoreStrict(c *gc.C) {
+	server, _ := s.newServer(c, cryptossh.ServerConfig{NoClientAuth: true})
+	serverPort := server.listener.Addr().(*net.TCPAddr).Port
+	go server.run(c)
+
+	store := ssh.NewMemoryHostKeyStore()
+	var opts ssh.Options
+	opts.SetPort(serverPort)
+	opts.SetStrictHostKeyChecking(ssh.StrictHostChecksYes)
+	opts.SetHostKeyStore(store)
+	client, _ := newClient(c)
+	_, err := client.Command("127.0.0.1", testCommand, &opts).Output()
+	c.Assert(err, gc.ErrorMatches, "ssh: handshake failed: no ssh-rsa host key is known for .* and you have requested strict checking")
+	keys, err := store.HostKeys(fmt.Sprintf("[127.0.0.1]:%d", serverPort))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(keys, gc.HasLen, 0)
+}
+
+func (s *SSHGoCryptoCommandSuite) TestHostKeyStoreMismatch(c *gc.C) {
+	var readLineWriter mockReadLineWriter
+	ssh.PatchTerminal(&s.CleanupSuite, &readLineWriter)
+
+	server, serverKey := s.newServer(c, cryptossh.ServerConfig{NoClientAuth: true})
+	serverPort := server.listener.Addr().(*net.TCPAddr).Port
+	go server.run(c)
+
+	path := filepath.Join(c.MkDir(), "hostkeys.json")
+	store := ssh.NewFileHostKeyStore(path)
+	err := store.AddHostKey(fmt.Sprintf("[127.0.0.1]:%d", serverPort), s.testPublicKeys["ed25519"])
+	c.Assert(err, jc.ErrorIsNil)
+
+	var opts ssh.Options
+	opts.SetPort(serverPort)
+	opts.SetStrictHostKeyChecking(ssh.StrictHostChecksNo)
+	opts.SetHostKeyStore(store)
+	client, _ := newClient(c)
+	_, err = client.Command("127.0.0.1", testCommand, &opts).Output()
+	c.Assert(err, gc.ErrorMatches, fmt.Sprintf("ssh: handshake failed: host key mismatch for 127.0.0.1:%d", serverPort))
+	c.Check(errcode.Of(err), gc.Equals, errcode.ErrHostKeyMismatch)
+
+	c.Assert(readLineWriter.written.String(), gc.Matches, fmt.Sprintf(`(?s).*
+The fingerprint for the ssh-rsa key sent by the remote host is
+%s.
+Please contact your system administrator.
+Add correct host key in %s to get rid of this message.
+Host was previously using different host key algorithms:
+ - ssh-ed25519 key %s
+`,
+		regexp.QuoteMeta(cryptossh.FingerprintSHA256(serverKey)),
+		regexp.QuoteMeta(path),
+		regexp.QuoteMeta(cryptossh.FingerprintSHA256(s.testPublicKeys["ed25519"]))))
+}
+
 type mockReadLineWriter struct {
 	testing.Stub
 	lines   []string
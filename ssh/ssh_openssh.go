@@ -4,15 +4,21 @@
 package ssh
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/juju/errors"
 	"github.com/juju/utils/v3"
+	"github.com/juju/utils/v3/errcode"
+	"github.com/juju/utils/v3/redact"
+	"github.com/juju/utils/v3/tracing"
 )
 
 // default identities will not be attempted if
@@ -100,9 +106,16 @@ func opensshOptions(options *Options, commandKind opensshCommandKind) []string {
 	if options.allocatePTY {
 		args = append(args, "-t", "-t") // twice to force
 	}
+	args = append(args, multiplexOptions(options)...)
 	if options.knownHostsFile != "" {
 		args = append(args, "-o", "UserKnownHostsFile "+utils.CommandString(options.knownHostsFile))
 	}
+	if options.gssapiAuth {
+		args = append(args, "-o", "GSSAPIAuthentication yes")
+	}
+	if options.sshfpResolver != nil {
+		args = append(args, "-o", "VerifyHostKeyDNS yes")
+	}
 	if len(options.hostKeyAlgorithms) > 0 {
 		args = append(args, "-o", "HostKeyAlgorithms "+utils.CommandString(strings.Join(options.hostKeyAlgorithms, ",")))
 	}
@@ -142,14 +155,20 @@ func opensshOptions(options *Options, commandKind opensshCommandKind) []string {
 
 // Command implements Client.Command.
 func (c *OpenSSHClient) Command(host string, command []string, options *Options) *Cmd {
-	args := opensshOptions(options, sshKind)
-	args = append(args, host)
+	target, targetOptions := hostOptions(host, options, false)
+	args := opensshOptions(targetOptions, sshKind)
+	args = append(args, target)
 	if len(command) > 0 {
 		args = append(args, command...)
 	}
 	bin, args := sshpassWrap("ssh", args)
-	logger.Tracef("running: %s %s", bin, utils.CommandString(args...))
-	return &Cmd{impl: &opensshCmd{exec.Command(bin, args...)}}
+	logger.Tracef("running: %s %s", bin, redact.Credentials.Redact(utils.CommandString(args...)))
+	impl := &opensshCmd{
+		Cmd:    exec.Command(bin, args...),
+		host:   host,
+		events: options.eventSink(),
+	}
+	return options.newCmd(impl, host, command)
 }
 
 // Copy implements Client.Copy.
@@ -165,19 +184,134 @@ func (c *OpenSSHClient) Copy(args []string, userOptions *Options) error {
 	cmd := exec.Command(bin, allArgs...)
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
-	logger.Tracef("running: %s %s", bin, utils.CommandString(args...))
-	if err := cmd.Run(); err != nil {
-		stderr := strings.TrimSpace(stderr.String())
-		if len(stderr) > 0 {
-			err = errors.Errorf("%v (%v)", err, stderr)
+	redactedArgs := redact.Credentials.Redact(utils.CommandString(args...))
+	logger.Tracef("running: %s %s", bin, redactedArgs)
+	_, span := tracing.Start(userOptions.getTracer(), context.Background(), "ssh.copy",
+		tracing.String("ssh.args", redactedArgs),
+	)
+	err := cmd.Run()
+	if err != nil {
+		err = opensshError(err, stderr.String())
+	}
+	span.End(err)
+	return err
+}
+
+// opensshErrorCodes maps messages written by ssh and scp
+// to the codes of the errors they report.
+var opensshErrorCodes = []struct {
+	message string
+	code    errcode.Code
+}{
+	// A changed host key is also reported as failing verification.
+	{"REMOTE HOST IDENTIFICATION HAS CHANGED", errcode.ErrHostKeyMismatch},
+	{"Host key verification failed", errcode.ErrHostKeyUnknown},
+	{"Permission denied (", errcode.ErrAuthFailed},
+	{"Too many authentication failures", errcode.ErrAuthFailed},
+	{"timed out", errcode.ErrTimeout},
+	{"Connection refused", errcode.ErrConnectionFailed},
+	{"Could not resolve hostname", errcode.ErrConnectionFailed},
+	{"No route to host", errcode.ErrConnectionFailed},
+}
+
+// opensshError returns err, from running ssh or scp, annotated with
+// the command's error output, and with a code if the output tells
+// why the command failed.
+func opensshError(err error, stderr string) error {
+	stderr = redact.Credentials.Redact(strings.TrimSpace(stderr))
+	if len(stderr) > 0 {
+		err = errors.Errorf("%v (%v)", err, stderr)
+	}
+	for _, m := range opensshErrorCodes {
+		if strings.Contains(stderr, m.message) {
+			return errcode.Wrap(m.code, err)
 		}
-		return err
 	}
-	return nil
+	return err
+}
+
+// Ping implements Pinger.Ping. The stages are timed by watching
+// the debugging output of "ssh -v", so stages that OpenSSH does not
+// report take no time.
+func (c *OpenSSHClient) Ping(host string, options *Options) (*PingResult, error) {
+	target, targetOptions := hostOptions(host, options, false)
+	args := opensshOptions(targetOptions, sshKind)
+	timeout := int64((options.getPingTimeout() + time.Second - 1) / time.Second)
+	args = append(args, "-o", fmt.Sprintf("ConnectTimeout %d", timeout), "-v", target, "exit")
+	bin, args := sshpassWrap("ssh", args)
+	logger.Tracef("running: %s %s", bin, redact.Credentials.Redact(utils.CommandString(args...)))
+	cmd := exec.Command(bin, args...)
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var result PingResult
+	timer := newStageTimer(options.getClock().Now)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	var messages []string
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "debug") {
+			messages = append(messages, line)
+			continue
+		}
+		switch {
+		case strings.Contains(line, "Connecting to "):
+			timer.done(&result.DNS)
+		case strings.Contains(line, "Connection established"):
+			timer.done(&result.TCP)
+		case strings.Contains(line, "SSH2_MSG_NEWKEYS received"):
+			timer.done(&result.KeyExchange)
+		case strings.Contains(line, "Authenticated to "):
+			timer.done(&result.Auth)
+		case strings.Contains(line, "remote software version "):
+			result.ServerVersion = serverVersion(line)
+		}
+	}
+	if err := cmd.Wait(); err != nil {
+		return nil, opensshError(err, strings.Join(messages, "\n"))
+	}
+	timer.done(&result.RoundTrip)
+	result.Total = timer.total()
+	return &result, nil
+}
+
+// serverVersion returns the version string reported by a debug line
+// such as "Remote protocol version 2.0, remote software version
+// OpenSSH_8.9p1", in the form the server sent it.
+func serverVersion(line string) string {
+	const protocol, software = "protocol version ", "remote software version "
+	i := strings.Index(line, protocol)
+	j := strings.Index(line, software)
+	if i < 0 || j < i {
+		return ""
+	}
+	version := strings.TrimSuffix(line[i+len(protocol):j], ", ")
+	return "SSH-" + version + "-" + line[j+len(software):]
 }
 
 type opensshCmd struct {
 	*exec.Cmd
+	host   string
+	events eventSink
+}
+
+func (c *opensshCmd) Start() error {
+	if err := c.Cmd.Start(); err != nil {
+		c.events.send(EventClosed, c.host, err)
+		return err
+	}
+	c.events.send(EventSessionStarted, c.host, nil)
+	return nil
+}
+
+func (c *opensshCmd) Wait() error {
+	err := c.Cmd.Wait()
+	c.events.send(EventClosed, c.host, err)
+	return err
 }
 
 func (c *opensshCmd) SetStdio(stdin io.Reader, stdout, stderr io.Writer) {
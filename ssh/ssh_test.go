@@ -13,13 +13,18 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/juju/cmd/v3"
 	"github.com/juju/testing"
 	jc "github.com/juju/testing/checkers"
 	gc "gopkg.in/check.v1"
 
+	"github.com/juju/utils/v3/errcode"
+	"github.com/juju/utils/v3/redact"
+	"github.com/juju/utils/v3/ringbuffer"
 	"github.com/juju/utils/v3/ssh"
+	"github.com/juju/utils/v3/tracing"
 )
 
 const (
@@ -105,6 +110,29 @@ func (s *SSHCommandSuite) TestCommand(c *gc.C) {
 	)
 }
 
+func (s *SSHCommandSuite) TestCommandRecording(c *gc.C) {
+	var recording bytes.Buffer
+	var opts ssh.Options
+	opts.SetRecording(ssh.Recording{
+		Writer: &recording,
+		// The fake ssh echoes "-o PasswordAuthentication no", which
+		// the default redactor would mistake for a password.
+		Redactor: redact.New(),
+	})
+	out, err := s.commandOptions([]string{echoCommand, "123"}, &opts).Output()
+	c.Assert(err, jc.ErrorIsNil)
+
+	header, events := parseRecording(c, recording.String())
+	c.Check(header["command"], gc.Equals, echoCommand+" 123")
+	c.Check(header["title"], gc.Equals, "localhost")
+	var recorded string
+	for _, event := range events {
+		c.Check(event[1], gc.Equals, "o")
+		recorded += event[2].(string)
+	}
+	c.Check(recorded, gc.Equals, string(out))
+}
+
 func (s *SSHCommandSuite) TestCommandEnablePTY(c *gc.C) {
 	var opts ssh.Options
 	opts.EnablePTY()
@@ -176,6 +204,58 @@ func (s *SSHCommandSuite) TestCommandPort(c *gc.C) {
 	)
 }
 
+func (s *SSHCommandSuite) TestCommandSSHFPResolver(c *gc.C) {
+	var opts ssh.Options
+	opts.SetSSHFPResolver(func(string) ([]ssh.SSHFPRecord, bool, error) {
+		return nil, false, nil
+	})
+	s.assertCommandArgs(c, s.commandOptions([]string{echoCommand, "123"}, &opts),
+		fmt.Sprintf("%s -o PasswordAuthentication no -o ServerAliveInterval 30 -o VerifyHostKeyDNS yes localhost %s 123",
+			s.fakessh, echoCommand),
+	)
+}
+
+func (s *SSHCommandSuite) TestCommandGSSAPIAuth(c *gc.C) {
+	var opts ssh.Options
+	opts.EnableGSSAPIAuth(nil)
+	s.assertCommandArgs(c, s.commandOptions([]string{echoCommand, "123"}, &opts),
+		fmt.Sprintf("%s -o PasswordAuthentication no -o ServerAliveInterval 30 -o GSSAPIAuthentication yes localhost %s 123",
+			s.fakessh, echoCommand),
+	)
+}
+
+func (s *SSHCommandSuite) TestCommandIPv6(c *gc.C) {
+	var opts ssh.Options
+	opts.SetPort(2022)
+	for i, test := range []struct {
+		host   string
+		expect string
+	}{
+		{host: "ubuntu@2001:db8::1", expect: "-p 2022 ubuntu@2001:db8::1"},
+		{host: "ubuntu@[2001:db8::1]", expect: "-p 2022 ubuntu@2001:db8::1"},
+		{host: "ubuntu@[2001:db8::1]:2222", expect: "-p 2222 ubuntu@2001:db8::1"},
+		{host: "[fe80::1%eth0]:2222", expect: "-p 2222 fe80::1%eth0"},
+	} {
+		c.Logf("test %d: %s", i, test.host)
+		s.assertCommandArgs(c, s.client.Command(test.host, []string{echoCommand, "123"}, &opts),
+			fmt.Sprintf("%s -o PasswordAuthentication no -o ServerAliveInterval 30 %s %s 123",
+				s.fakessh, test.expect, echoCommand),
+		)
+	}
+	s.assertCommandArgs(c, s.client.Command("[::1]:2222", []string{echoCommand, "123"}, nil),
+		fmt.Sprintf("%s -o PasswordAuthentication no -o ServerAliveInterval 30 -p 2222 ::1 %s 123",
+			s.fakessh, echoCommand),
+	)
+}
+
+func (s *SSHCommandSuite) TestCopyIPv6(c *gc.C) {
+	err := s.client.Copy([]string{"/tmp/blah", ssh.CopyTarget("foo@fe80::1%eth0", "baz")}, nil)
+	c.Assert(err, jc.ErrorIsNil)
+	out, err := ioutil.ReadFile(s.fakescp + ".args")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(out), gc.Equals, s.fakescp+" -o PasswordAuthentication no -o ServerAliveInterval 30 /tmp/blah foo@[fe80::1%eth0]:baz\n")
+}
+
 func (s *SSHCommandSuite) TestCopy(c *gc.C) {
 	var opts ssh.Options
 	opts.EnablePTY()
@@ -204,6 +284,20 @@ func (s *SSHCommandSuite) TestCopy(c *gc.C) {
 	c.Assert(string(out), gc.Equals, s.fakescp+" -o ServerAliveInterval 30 -i x -i y -P 2022 -r /tmp/blah -v foo@bar.com:baz\n")
 }
 
+func (s *SSHCommandSuite) TestCopyTracing(c *gc.C) {
+	var rec tracing.Recorder
+	var opts ssh.Options
+	opts.SetTracer(&rec)
+	err := s.client.Copy([]string{"/tmp/blah", "foo@bar.com:baz"}, &opts)
+	c.Assert(err, jc.ErrorIsNil)
+
+	spans := rec.Spans()
+	c.Assert(rec.Names(), jc.DeepEquals, []string{"ssh.copy"})
+	c.Check(spans[0].Attribute("ssh.args"), gc.Equals, "/tmp/blah foo@bar.com:baz")
+	c.Check(spans[0].Ended, jc.IsTrue)
+	c.Check(spans[0].Err, jc.ErrorIsNil)
+}
+
 func (s *SSHCommandSuite) TestCommandClientKeys(c *gc.C) {
 	defer overrideGenerateKey(c).Restore()
 	clientKeysDir := c.MkDir()
@@ -250,6 +344,138 @@ func (s *SSHCommandSuite) TestCommandDefaultIdentities(c *gc.C) {
 	)
 }
 
+func (s *SSHCommandSuite) TestCommandMultiplexing(c *gc.C) {
+	dir := filepath.Join(c.MkDir(), "control")
+	s.PatchValue(ssh.ControlDir, dir)
+	var opts ssh.Options
+	opts.EnableMultiplexing(90 * time.Second)
+	s.assertCommandArgs(c, s.commandOptions([]string{echoCommand, "123"}, &opts),
+		fmt.Sprintf("%s -o PasswordAuthentication no -o ServerAliveInterval 30 "+
+			"-o ControlMaster auto -o ControlPath %s/%%C -o ControlPersist 90s localhost %s 123",
+			s.fakessh, dir, echoCommand),
+	)
+	info, err := os.Stat(dir)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(info.IsDir(), jc.IsTrue)
+	c.Check(info.Mode().Perm(), gc.Equals, os.FileMode(0700))
+}
+
+func (s *SSHCommandSuite) TestCommandMultiplexingDefaultPersist(c *gc.C) {
+	dir := c.MkDir()
+	s.PatchValue(ssh.ControlDir, dir)
+	var opts ssh.Options
+	opts.EnableMultiplexing(0)
+	s.assertCommandArgs(c, s.commandOptions([]string{echoCommand, "123"}, &opts),
+		fmt.Sprintf("%s -o PasswordAuthentication no -o ServerAliveInterval 30 "+
+			"-o ControlMaster auto -o ControlPath %s/%%C -o ControlPersist 60s localhost %s 123",
+			s.fakessh, dir, echoCommand),
+	)
+}
+
+func (s *SSHCommandSuite) TestCommandMultiplexingSharedControlDir(c *gc.C) {
+	dir := c.MkDir()
+	err := os.Chmod(dir, 0755)
+	c.Assert(err, jc.ErrorIsNil)
+	s.PatchValue(ssh.ControlDir, dir)
+	var opts ssh.Options
+	opts.EnableMultiplexing(time.Minute)
+	s.assertCommandArgs(c, s.commandOptions([]string{echoCommand, "123"}, &opts),
+		fmt.Sprintf("%s -o PasswordAuthentication no -o ServerAliveInterval 30 localhost %s 123",
+			s.fakessh, echoCommand),
+	)
+}
+
+func (s *SSHCommandSuite) TestCommandMultiplexingSymlinkControlDir(c *gc.C) {
+	target := c.MkDir()
+	err := os.Chmod(target, 0700)
+	c.Assert(err, jc.ErrorIsNil)
+	dir := filepath.Join(c.MkDir(), "control")
+	err = os.Symlink(target, dir)
+	c.Assert(err, jc.ErrorIsNil)
+	s.PatchValue(ssh.ControlDir, dir)
+	var opts ssh.Options
+	opts.EnableMultiplexing(time.Minute)
+	s.assertCommandArgs(c, s.commandOptions([]string{echoCommand, "123"}, &opts),
+		fmt.Sprintf("%s -o PasswordAuthentication no -o ServerAliveInterval 30 localhost %s 123",
+			s.fakessh, echoCommand),
+	)
+}
+
+func (s *SSHCommandSuite) TestCommandMultiplexingControlDirNotOwned(c *gc.C) {
+	if os.Getuid() != 0 {
+		c.Skip("changing the owner of a directory requires root")
+	}
+	dir := c.MkDir()
+	err := os.Chmod(dir, 0700)
+	c.Assert(err, jc.ErrorIsNil)
+	err = os.Chown(dir, 1, 1)
+	c.Assert(err, jc.ErrorIsNil)
+	s.PatchValue(ssh.ControlDir, dir)
+	var opts ssh.Options
+	opts.EnableMultiplexing(time.Minute)
+	s.assertCommandArgs(c, s.commandOptions([]string{echoCommand, "123"}, &opts),
+		fmt.Sprintf("%s -o PasswordAuthentication no -o ServerAliveInterval 30 localhost %s 123",
+			s.fakessh, echoCommand),
+	)
+}
+
+func (s *SSHCommandSuite) TestCopyMultiplexing(c *gc.C) {
+	dir := c.MkDir()
+	s.PatchValue(ssh.ControlDir, dir)
+	var opts ssh.Options
+	opts.EnableMultiplexing(time.Minute)
+	err := s.client.Copy([]string{"/tmp/blah", "foo@bar.com:baz"}, &opts)
+	c.Assert(err, jc.ErrorIsNil)
+	out, err := ioutil.ReadFile(s.fakescp + ".args")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(out), gc.Equals, fmt.Sprintf("%s -o PasswordAuthentication no -o ServerAliveInterval 30 "+
+		"-o ControlMaster auto -o ControlPath %s/%%C -o ControlPersist 60s /tmp/blah foo@bar.com:baz\n",
+		s.fakescp, dir))
+}
+
+const pingScript = `#!/bin/sh
+echo "$@" > $0.args
+echo "OpenSSH_8.9p1, OpenSSL 3.0.2" >&2
+echo "debug1: Connecting to localhost [127.0.0.1] port 22." >&2
+echo "debug1: Connection established." >&2
+echo "debug1: Remote protocol version 2.0, remote software version OpenSSH_8.4p1 Debian-5" >&2
+echo "debug1: SSH2_MSG_NEWKEYS received" >&2
+echo "debug1: Authenticated to localhost ([127.0.0.1]:22) using \"publickey\"." >&2
+`
+
+func (s *SSHCommandSuite) TestPing(c *gc.C) {
+	err := ioutil.WriteFile(s.fakessh, []byte(pingScript), 0755)
+	c.Assert(err, jc.ErrorIsNil)
+	result, err := s.client.(ssh.Pinger).Ping("localhost", nil)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(result.ServerVersion, gc.Equals, "SSH-2.0-OpenSSH_8.4p1 Debian-5")
+	c.Check(result.Total >= result.DNS+result.TCP+result.KeyExchange+result.Auth+result.RoundTrip, jc.IsTrue)
+
+	out, err := ioutil.ReadFile(s.fakessh + ".args")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(out), gc.Equals, "-o PasswordAuthentication no -o ServerAliveInterval 30 -o ConnectTimeout 30 -v localhost exit\n")
+
+	var opts ssh.Options
+	opts.SetPingTimeout(1500 * time.Millisecond)
+	_, err = s.client.(ssh.Pinger).Ping("localhost", &opts)
+	c.Assert(err, jc.ErrorIsNil)
+	out, err = ioutil.ReadFile(s.fakessh + ".args")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(out), gc.Equals, "-o PasswordAuthentication no -o ServerAliveInterval 30 -o ConnectTimeout 2 -v localhost exit\n")
+}
+
+func (s *SSHCommandSuite) TestPingFailure(c *gc.C) {
+	script := "#!/bin/sh\n" +
+		"echo 'debug1: Connecting to localhost [127.0.0.1] port 22.' >&2\n" +
+		"echo 'ssh: connect to host localhost port 22: Connection refused' >&2\n" +
+		"exit 255\n"
+	err := ioutil.WriteFile(s.fakessh, []byte(script), 0755)
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = s.client.(ssh.Pinger).Ping("localhost", nil)
+	c.Assert(err, gc.ErrorMatches, `exit status 255 \(ssh: connect to host localhost port 22: Connection refused\)`)
+	c.Check(errcode.Of(err), gc.Equals, errcode.ErrConnectionFailed)
+}
+
 func (s *SSHCommandSuite) TestCopyReader(c *gc.C) {
 	client := &fakeClient{}
 	r := bytes.NewBufferString("<data>")
@@ -260,3 +486,31 @@ func (s *SSHCommandSuite) TestCopyReader(c *gc.C) {
 	client.checkCalls(c, "foo@bar.com:baz", []string{"cat - > /tmp/blah"}, nil, nil, "Command")
 	client.impl.checkCalls(c, r, nil, nil, "SetStdio", "Start", "Wait")
 }
+
+func (s *SSHCommandSuite) TestCommandTail(c *gc.C) {
+	script := "#!/bin/sh\n" +
+		"for i in 1 2 3 4; do echo out$i; done\n" +
+		"/bin/sleep 0.1\n" +
+		"echo err >&2\n"
+	err := ioutil.WriteFile(s.fakessh, []byte(script), 0755)
+	c.Assert(err, jc.ErrorIsNil)
+	cmd := s.client.Command("localhost", []string{"true"}, nil)
+	cmd.Tail = ringbuffer.NewLines(3, 1024)
+	out, err := cmd.Output()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(out), gc.Equals, "out1\nout2\nout3\nout4\n")
+	c.Check(cmd.Tail.Snapshot().Lines(), jc.DeepEquals, []string{"out3", "out4", "err"})
+}
+
+func (s *SSHCommandSuite) TestCommandTailPipe(c *gc.C) {
+	impl := &fakeCommandImpl{}
+	impl.stdoutData.WriteString("one\ntwo\n")
+	cmd := ssh.TestNewCmd(impl)
+	cmd.Tail = ringbuffer.New(5)
+	stdout, err := cmd.StdoutPipe()
+	c.Assert(err, jc.ErrorIsNil)
+	data, err := ioutil.ReadAll(stdout)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(data), gc.Equals, "one\ntwo\n")
+	c.Check(cmd.Tail.Snapshot().String(), gc.Equals, "[3 bytes omitted]\n\ntwo\n")
+}
@@ -0,0 +1,153 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package ssh
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SSHFP algorithm numbers, as assigned by IANA.
+const (
+	SSHFPAlgorithmRSA     = 1
+	SSHFPAlgorithmDSA     = 2
+	SSHFPAlgorithmECDSA   = 3
+	SSHFPAlgorithmEd25519 = 4
+)
+
+// SSHFP fingerprint types, as assigned by IANA.
+const (
+	SSHFPTypeSHA1   = 1
+	SSHFPTypeSHA256 = 2
+)
+
+// SSHFPRecord holds the data of an SSHFP DNS record, as defined by
+// RFC 4255, which publishes the fingerprint of a host key.
+type SSHFPRecord struct {
+	Algorithm       uint8
+	FingerprintType uint8
+	Fingerprint     []byte
+}
+
+// NewSSHFPRecords returns the records that publish key, one for
+// each fingerprint type. It returns nil if the key's algorithm has
+// no SSHFP algorithm number.
+func NewSSHFPRecords(key ssh.PublicKey) []SSHFPRecord {
+	algorithm := sshfpAlgorithm(key)
+	if algorithm == 0 {
+		return nil
+	}
+	var records []SSHFPRecord
+	for _, fpType := range []uint8{SSHFPTypeSHA1, SSHFPTypeSHA256} {
+		records = append(records, SSHFPRecord{
+			Algorithm:       algorithm,
+			FingerprintType: fpType,
+			Fingerprint:     sshfpFingerprint(fpType, key),
+		})
+	}
+	return records
+}
+
+// Matches reports whether the record publishes key.
+func (r SSHFPRecord) Matches(key ssh.PublicKey) bool {
+	if r.Algorithm == 0 || r.Algorithm != sshfpAlgorithm(key) {
+		return false
+	}
+	fp := sshfpFingerprint(r.FingerprintType, key)
+	return fp != nil && bytes.Equal(fp, r.Fingerprint)
+}
+
+// String returns the record's data in zone file format,
+// such as "4 2 c0ffee...".
+func (r SSHFPRecord) String() string {
+	return fmt.Sprintf("%d %d %s", r.Algorithm, r.FingerprintType, hex.EncodeToString(r.Fingerprint))
+}
+
+// SSHFPResolver looks up the SSHFP records for a host name. It
+// reports whether the answer was validated with DNSSEC; records
+// that were not are ignored, as anyone able to tamper with DNS
+// responses could otherwise vouch for their own host key.
+type SSHFPResolver func(host string) (records []SSHFPRecord, validated bool, err error)
+
+// SetSSHFPResolver makes the go.crypto client accept host keys that
+// are published in DNSSEC-validated SSHFP records, as looked up with
+// the given resolver. Keys that are not published, hosts specified by
+// IP address, and hosts whose records cannot be looked up are checked
+// against the known hosts as usual. Keys accepted in this way are not
+// added to the known hosts.
+//
+// The OpenSSH client cannot use the resolver; instead, setting one
+// enables OpenSSH's VerifyHostKeyDNS option, so that it looks up
+// SSHFP records itself.
+func (o *Options) SetSSHFPResolver(resolver SSHFPResolver) {
+	o.sshfpResolver = resolver
+}
+
+// verifySSHFP reports whether key is published for the host in
+// hostname, which may include a port, in validated SSHFP records.
+func verifySSHFP(resolver SSHFPResolver, hostname string, key ssh.PublicKey) bool {
+	host, _, err := net.SplitHostPort(hostname)
+	if err != nil {
+		host = hostname
+	}
+	if net.ParseIP(host) != nil {
+		return false
+	}
+	records, validated, err := resolver(strings.TrimSuffix(host, "."))
+	switch {
+	case err != nil:
+		logger.Debugf("cannot look up SSHFP records for %s: %v", host, err)
+		return false
+	case len(records) == 0:
+		return false
+	case !validated:
+		logger.Debugf("ignoring SSHFP records for %s not validated with DNSSEC", host)
+		return false
+	}
+	for _, record := range records {
+		if record.Matches(key) {
+			logger.Debugf("%s host key for %s verified by SSHFP record", key.Type(), host)
+			return true
+		}
+	}
+	logger.Warningf("no SSHFP record for %s matches its %s host key %s", host, key.Type(), ssh.FingerprintSHA256(key))
+	return false
+}
+
+// sshfpAlgorithm returns the SSHFP algorithm number
+// for key, or zero if there is none.
+func sshfpAlgorithm(key ssh.PublicKey) uint8 {
+	switch t := key.Type(); {
+	case t == ssh.KeyAlgoRSA:
+		return SSHFPAlgorithmRSA
+	case t == ssh.KeyAlgoDSA:
+		return SSHFPAlgorithmDSA
+	case strings.HasPrefix(t, "ecdsa-sha2-"):
+		return SSHFPAlgorithmECDSA
+	case t == ssh.KeyAlgoED25519:
+		return SSHFPAlgorithmEd25519
+	}
+	return 0
+}
+
+// sshfpFingerprint returns the fingerprint of key of the given
+// type, or nil if the type is not known.
+func sshfpFingerprint(fpType uint8, key ssh.PublicKey) []byte {
+	switch fpType {
+	case SSHFPTypeSHA1:
+		sum := sha1.Sum(key.Marshal())
+		return sum[:]
+	case SSHFPTypeSHA256:
+		sum := sha256.Sum256(key.Marshal())
+		return sum[:]
+	}
+	return nil
+}
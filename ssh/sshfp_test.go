@@ -0,0 +1,131 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package ssh_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	cryptossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/testdata"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/ssh"
+)
+
+type SSHFPSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&SSHFPSuite{})
+
+func publicKey(c *gc.C, keyType string) cryptossh.PublicKey {
+	signer, err := cryptossh.ParsePrivateKey(testdata.PEMBytes[keyType])
+	c.Assert(err, jc.ErrorIsNil)
+	return signer.PublicKey()
+}
+
+func (s *SSHFPSuite) TestNewSSHFPRecords(c *gc.C) {
+	for keyType, algorithm := range map[string]uint8{
+		"rsa":     ssh.SSHFPAlgorithmRSA,
+		"dsa":     ssh.SSHFPAlgorithmDSA,
+		"ecdsa":   ssh.SSHFPAlgorithmECDSA,
+		"ed25519": ssh.SSHFPAlgorithmEd25519,
+	} {
+		c.Logf("key type %s", keyType)
+		key := publicKey(c, keyType)
+		records := ssh.NewSSHFPRecords(key)
+		c.Assert(records, gc.HasLen, 2)
+		c.Check(records[0].Algorithm, gc.Equals, algorithm)
+		c.Check(records[0].FingerprintType, gc.Equals, uint8(ssh.SSHFPTypeSHA1))
+		c.Check(records[0].Fingerprint, gc.HasLen, 20)
+		c.Check(records[1].FingerprintType, gc.Equals, uint8(ssh.SSHFPTypeSHA256))
+		sum := sha256.Sum256(key.Marshal())
+		c.Check(records[1].Fingerprint, jc.DeepEquals, sum[:])
+		for _, record := range records {
+			c.Check(record.Matches(key), jc.IsTrue)
+		}
+	}
+}
+
+func (s *SSHFPSuite) TestMatches(c *gc.C) {
+	key := publicKey(c, "ed25519")
+	record := ssh.NewSSHFPRecords(key)[1]
+	c.Check(record.Matches(publicKey(c, "rsa")), jc.IsFalse)
+
+	wrongAlgorithm := record
+	wrongAlgorithm.Algorithm = ssh.SSHFPAlgorithmRSA
+	c.Check(wrongAlgorithm.Matches(key), jc.IsFalse)
+
+	unknownType := record
+	unknownType.FingerprintType = 9
+	c.Check(unknownType.Matches(key), jc.IsFalse)
+}
+
+func (s *SSHFPSuite) TestString(c *gc.C) {
+	record := ssh.NewSSHFPRecords(publicKey(c, "ed25519"))[1]
+	c.Check(record.String(), gc.Equals, "4 2 "+hex.EncodeToString(record.Fingerprint))
+}
+
+func (s *SSHFPSuite) TestVerifySSHFP(c *gc.C) {
+	key := publicKey(c, "ed25519")
+	other := publicKey(c, "rsa")
+	for i, test := range []struct {
+		hostname  string
+		records   []ssh.SSHFPRecord
+		validated bool
+		err       error
+		lookup    string
+		verified  bool
+	}{{
+		hostname:  "host.example:22",
+		records:   ssh.NewSSHFPRecords(key),
+		validated: true,
+		lookup:    "host.example",
+		verified:  true,
+	}, {
+		hostname:  "host.example.",
+		records:   append(ssh.NewSSHFPRecords(other), ssh.NewSSHFPRecords(key)[1]),
+		validated: true,
+		lookup:    "host.example",
+		verified:  true,
+	}, {
+		hostname: "host.example:22",
+		records:  ssh.NewSSHFPRecords(key),
+		lookup:   "host.example",
+	}, {
+		hostname:  "host.example:22",
+		records:   ssh.NewSSHFPRecords(other),
+		validated: true,
+		lookup:    "host.example",
+	}, {
+		hostname:  "host.example:22",
+		validated: true,
+		lookup:    "host.example",
+	}, {
+		hostname: "host.example:22",
+		err:      errors.New("SERVFAIL"),
+		lookup:   "host.example",
+	}, {
+		hostname: "[2001:db8::1]:22",
+	}, {
+		hostname: "10.0.0.1:2222",
+	}} {
+		c.Logf("test %d", i)
+		var lookups []string
+		resolver := func(host string) ([]ssh.SSHFPRecord, bool, error) {
+			lookups = append(lookups, host)
+			return test.records, test.validated, test.err
+		}
+		c.Check(ssh.VerifySSHFP(resolver, test.hostname, key), gc.Equals, test.verified)
+		if test.lookup == "" {
+			c.Check(lookups, gc.HasLen, 0)
+		} else {
+			c.Check(lookups, jc.DeepEquals, []string{test.lookup})
+		}
+	}
+}
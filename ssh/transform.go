@@ -0,0 +1,489 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+
+	"github.com/juju/errors"
+	"github.com/juju/loggo"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/transform"
+
+	"github.com/juju/utils/v3"
+	"github.com/juju/utils/v3/redact"
+)
+
+// Stream identifies one of the standard streams of a command.
+type Stream int
+
+const (
+	Stdin Stream = iota
+	Stdout
+	Stderr
+	numStreams
+)
+
+// String returns the name of the stream, such as "stdin".
+func (s Stream) String() string {
+	switch s {
+	case Stdin:
+		return "stdin"
+	case Stdout:
+		return "stdout"
+	case Stderr:
+		return "stderr"
+	}
+	return "unknown stream"
+}
+
+// StreamTransform transforms the data flowing through a stream of a
+// command: the input sent to the remote command, or the output it
+// returns. A transform must keep no state between the readers and
+// writers it returns, as it may be used by many commands at once.
+type StreamTransform interface {
+	// Reader returns a reader that reads data from r and
+	// returns it transformed.
+	Reader(r io.Reader) io.Reader
+
+	// Writer returns a writer that writes data to w transformed.
+	// Closing the writer writes any data that it holds back, such
+	// as an incomplete line, but does not close w.
+	Writer(w io.Writer) io.WriteCloser
+}
+
+// AddStreamTransform adds transforms to the pipeline through which
+// the data of the given stream of each command flows. Input is
+// transformed after it is read from the command's Stdin and before it
+// is sent to the remote command; output is transformed after it is
+// received and before it is written to the command's Stdout or Stderr.
+// Transforms are applied in the order in which they are added.
+//
+// A recording set with SetRecording records the input as read from
+// Stdin and the output as written to Stdout and Stderr.
+func (o *Options) AddStreamTransform(stream Stream, transforms ...StreamTransform) {
+	if stream < 0 || stream >= numStreams {
+		panic(errors.Errorf("invalid stream %d", stream))
+	}
+	// Copy the pipeline, in case it is shared with a copy of o.
+	pipeline := append([]StreamTransform(nil), o.streamTransforms[stream]...)
+	o.streamTransforms[stream] = append(pipeline, transforms...)
+}
+
+// getStreamTransforms returns the stream transforms set with
+// AddStreamTransform.
+func (o *Options) getStreamTransforms() [numStreams][]StreamTransform {
+	if o == nil {
+		return [numStreams][]StreamTransform{}
+	}
+	return o.streamTransforms
+}
+
+// transformReader returns r transformed by each of the transforms in
+// turn.
+func transformReader(r io.Reader, transforms []StreamTransform) io.Reader {
+	for _, t := range transforms {
+		r = t.Reader(r)
+	}
+	return r
+}
+
+// transformWriter returns a writer that writes to w the data
+// transformed by each of the transforms in turn. Closing the writer
+// closes the writer of each transform in turn, but not w.
+func transformWriter(w io.Writer, transforms []StreamTransform) io.WriteCloser {
+	// The data written flows through the transforms in order, so the
+	// writer of the last wraps w. The writers are closed in the same
+	// order, so that any data each holds back reaches the next.
+	closers := make([]io.Closer, len(transforms))
+	for i := len(transforms) - 1; i >= 0; i-- {
+		wc := transforms[i].Writer(w)
+		closers[i] = wc
+		w = wc
+	}
+	return &transformingWriter{Writer: w, closers: closers}
+}
+
+type transformingWriter struct {
+	io.Writer
+	closers []io.Closer
+}
+
+// Close implements io.Closer.
+func (w *transformingWriter) Close() error {
+	var firstErr error
+	for _, c := range w.closers {
+		if err := c.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// transformingWriteCloser is a transformingWriter that
+// closes the underlying writer when it is closed.
+type transformingWriteCloser struct {
+	io.WriteCloser
+	c io.Closer
+}
+
+// Close implements io.Closer.
+func (w *transformingWriteCloser) Close() error {
+	err := w.WriteCloser.Close()
+	if cerr := w.c.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// transformingReadCloser is a transformed reader that
+// closes the underlying reader when it is closed.
+type transformingReadCloser struct {
+	io.Reader
+	c io.Closer
+}
+
+// Close implements io.Closer.
+func (r *transformingReadCloser) Close() error {
+	return r.c.Close()
+}
+
+// TextTransform returns a transform that applies a transformer
+// created by newTransformer to each reader or writer.
+func TextTransform(newTransformer func() transform.Transformer) StreamTransform {
+	return textTransform(newTransformer)
+}
+
+type textTransform func() transform.Transformer
+
+// Reader implements StreamTransform.Reader.
+func (t textTransform) Reader(r io.Reader) io.Reader {
+	return transform.NewReader(r, t())
+}
+
+// Writer implements StreamTransform.Writer.
+func (t textTransform) Writer(w io.Writer) io.WriteCloser {
+	return transform.NewWriter(w, t())
+}
+
+// DecodeStream returns a transform that converts text in the given
+// encoding to UTF-8, as is needed for the output of a remote command
+// that uses another encoding.
+func DecodeStream(enc encoding.Encoding) StreamTransform {
+	return TextTransform(func() transform.Transformer {
+		return enc.NewDecoder()
+	})
+}
+
+// EncodeStream returns a transform that converts UTF-8 text to the
+// given encoding, as is needed for the input of a remote command that
+// uses another encoding. Characters that cannot be encoded cause an
+// error.
+func EncodeStream(enc encoding.Encoding) StreamTransform {
+	return TextTransform(func() transform.Transformer {
+		return enc.NewEncoder()
+	})
+}
+
+// NormalizeCRLF returns a transform that converts CRLF line endings
+// to LF. Other carriage returns are left alone.
+func NormalizeCRLF() StreamTransform {
+	return TextTransform(func() transform.Transformer {
+		return crTransformer{lineEndingsOnly: true}
+	})
+}
+
+// StripCR returns a transform that removes all carriage returns, as
+// WrapStdin does on Windows.
+func StripCR() StreamTransform {
+	return TextTransform(func() transform.Transformer {
+		return crTransformer{}
+	})
+}
+
+// crTransformer removes carriage returns, or only those that
+// precede a line feed if lineEndingsOnly is true.
+type crTransformer struct {
+	transform.NopResetter
+	lineEndingsOnly bool
+}
+
+// Transform implements transform.Transformer.
+func (t crTransformer) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for ; nSrc < len(src); nSrc++ {
+		c := src[nSrc]
+		if c == '\r' {
+			if !t.lineEndingsOnly {
+				continue
+			}
+			if nSrc+1 == len(src) && !atEOF {
+				// Wait to see whether a line feed follows.
+				return nDst, nSrc, transform.ErrShortSrc
+			}
+			if nSrc+1 < len(src) && src[nSrc+1] == '\n' {
+				continue
+			}
+		}
+		if nDst == len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		dst[nDst] = c
+		nDst++
+	}
+	return nDst, nSrc, nil
+}
+
+// RateLimitStream returns a transform that limits the rate at which
+// data flows, taking a token from limiter for every blockSize bytes.
+// The limiter may be shared, to limit the combined rate of several
+// streams or commands.
+func RateLimitStream(limiter utils.RateLimiter, blockSize int) StreamTransform {
+	if blockSize <= 0 {
+		panic("block size must be > 0")
+	}
+	return rateLimitTransform{limiter: limiter, blockSize: blockSize}
+}
+
+type rateLimitTransform struct {
+	limiter   utils.RateLimiter
+	blockSize int
+}
+
+// Reader implements StreamTransform.Reader.
+func (t rateLimitTransform) Reader(r io.Reader) io.Reader {
+	return &rateLimitReader{r: r, t: t}
+}
+
+// Writer implements StreamTransform.Writer.
+func (t rateLimitTransform) Writer(w io.Writer) io.WriteCloser {
+	return &rateLimitWriter{w: w, t: t}
+}
+
+type rateLimitReader struct {
+	r io.Reader
+	t rateLimitTransform
+}
+
+// Read implements io.Reader, reading a block at a time.
+func (r *rateLimitReader) Read(p []byte) (int, error) {
+	if len(p) > r.t.blockSize {
+		p = p[:r.t.blockSize]
+	}
+	if err := r.t.limiter.Acquire(context.Background()); err != nil {
+		return 0, errors.Trace(err)
+	}
+	return r.r.Read(p)
+}
+
+type rateLimitWriter struct {
+	w io.Writer
+	t rateLimitTransform
+}
+
+// Write implements io.Writer, writing a block at a time.
+func (w *rateLimitWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		block := p
+		if len(block) > w.t.blockSize {
+			block = block[:w.t.blockSize]
+		}
+		if err := w.t.limiter.Acquire(context.Background()); err != nil {
+			return written, errors.Trace(err)
+		}
+		n, err := w.w.Write(block)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// Close implements io.Closer.
+func (w *rateLimitWriter) Close() error {
+	return nil
+}
+
+// LimitBandwidthStream returns a transform that limits the rate at
+// which data flows to that allowed by limiter, which may be shared
+// to limit the combined bandwidth of several streams or commands.
+func LimitBandwidthStream(limiter *utils.BandwidthLimiter) StreamTransform {
+	return bandwidthTransform{limiter: limiter}
+}
+
+type bandwidthTransform struct {
+	limiter *utils.BandwidthLimiter
+}
+
+// Reader implements StreamTransform.Reader.
+func (t bandwidthTransform) Reader(r io.Reader) io.Reader {
+	return t.limiter.Reader(context.Background(), r)
+}
+
+// Writer implements StreamTransform.Writer.
+func (t bandwidthTransform) Writer(w io.Writer) io.WriteCloser {
+	return nopWriteCloser{t.limiter.Writer(context.Background(), w)}
+}
+
+// nopWriteCloser is an io.WriteCloser whose Close does nothing.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+// Close implements io.Closer.
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// TeeToLog returns a transform that logs each line of the data that
+// flows through it, unchanged, at the given level, prefixed by prefix.
+// Credentials are redacted from the logged lines.
+func TeeToLog(logger loggo.Logger, level loggo.Level, prefix string) StreamTransform {
+	return logTransform{logger: logger, level: level, prefix: prefix}
+}
+
+type logTransform struct {
+	logger loggo.Logger
+	level  loggo.Level
+	prefix string
+}
+
+// Reader implements StreamTransform.Reader.
+func (t logTransform) Reader(r io.Reader) io.Reader {
+	return &logReader{r: r, log: &lineLogger{t: t}}
+}
+
+// Writer implements StreamTransform.Writer.
+func (t logTransform) Writer(w io.Writer) io.WriteCloser {
+	return &logWriter{w: w, log: &lineLogger{t: t}}
+}
+
+// lineLogger logs the lines of the data written to it.
+type lineLogger struct {
+	t       logTransform
+	partial []byte
+}
+
+func (l *lineLogger) write(p []byte) {
+	if !l.t.logger.IsLevelEnabled(l.t.level) {
+		return
+	}
+	data := append(l.partial, p...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		l.log(data[:i])
+		data = data[i+1:]
+	}
+	l.partial = append(l.partial[:0], data...)
+}
+
+func (l *lineLogger) flush() {
+	if len(l.partial) > 0 {
+		l.log(l.partial)
+		l.partial = nil
+	}
+}
+
+func (l *lineLogger) log(line []byte) {
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	l.t.logger.Logf(l.t.level, "%s%s", l.t.prefix, redact.Credentials.Redact(string(line)))
+}
+
+type logReader struct {
+	r   io.Reader
+	log *lineLogger
+}
+
+// Read implements io.Reader.
+func (r *logReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.log.write(p[:n])
+	if err != nil {
+		r.log.flush()
+	}
+	return n, err
+}
+
+type logWriter struct {
+	w   io.Writer
+	log *lineLogger
+}
+
+// Write implements io.Writer.
+func (w *logWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.log.write(p[:n])
+	return n, err
+}
+
+// Close implements io.Closer.
+func (w *logWriter) Close() error {
+	w.log.flush()
+	return nil
+}
+
+// transformedReader returns r transformed for the stream.
+func (c *Cmd) transformedReader(stream Stream, r io.Reader) io.Reader {
+	transforms := c.transforms[stream]
+	if len(transforms) == 0 || r == nil {
+		return r
+	}
+	return transformReader(r, transforms)
+}
+
+// transformedWriter returns a writer that writes the stream's data to
+// w transformed. The writer is closed when the command completes.
+func (c *Cmd) transformedWriter(stream Stream, w io.Writer) io.Writer {
+	transforms := c.transforms[stream]
+	if len(transforms) == 0 {
+		return w
+	}
+	if w == nil {
+		w = ioutil.Discard
+	}
+	tw := transformWriter(w, transforms)
+	c.outputClosers = append(c.outputClosers, tw)
+	return tw
+}
+
+// transformedWriteCloser is like transformedWriter, for the write end
+// of a pipe, which is closed by its user.
+func (c *Cmd) transformedWriteCloser(stream Stream, wc io.WriteCloser) io.WriteCloser {
+	transforms := c.transforms[stream]
+	if len(transforms) == 0 {
+		return wc
+	}
+	return &transformingWriteCloser{WriteCloser: transformWriter(wc, transforms), c: wc}
+}
+
+// transformedReadCloser is like transformedReader, for the read
+// end of a pipe.
+func (c *Cmd) transformedReadCloser(stream Stream, rc io.ReadCloser) io.ReadCloser {
+	transforms := c.transforms[stream]
+	if len(transforms) == 0 {
+		return rc
+	}
+	return &transformingReadCloser{Reader: transformReader(rc, transforms), c: rc}
+}
+
+// closeOutputs closes the writers of the command's transformed
+// output streams, so that they write any data held back.
+func (c *Cmd) closeOutputs() error {
+	var firstErr error
+	for _, closer := range c.outputClosers {
+		if err := closer.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	c.outputClosers = nil
+	return firstErr
+}
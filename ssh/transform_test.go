@@ -0,0 +1,237 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package ssh_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/juju/clock/testclock"
+	"github.com/juju/loggo"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	"golang.org/x/text/encoding/charmap"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3"
+	"github.com/juju/utils/v3/ssh"
+)
+
+type TransformSuite struct {
+	testing.IsolationSuite
+	impl fakeCommandImpl
+}
+
+var _ = gc.Suite(&TransformSuite{})
+
+func (s *TransformSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.impl = fakeCommandImpl{}
+}
+
+// transform returns the result of passing data through t, both
+// read through its reader and written through its writer a byte
+// at a time.
+func transform(c *gc.C, t ssh.StreamTransform, data string) string {
+	read, err := ioutil.ReadAll(t.Reader(strings.NewReader(data)))
+	c.Assert(err, jc.ErrorIsNil)
+
+	var buf bytes.Buffer
+	w := t.Writer(&buf)
+	for i := 0; i < len(data); i++ {
+		_, err := w.Write([]byte{data[i]})
+		c.Assert(err, jc.ErrorIsNil)
+	}
+	err = w.Close()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(buf.String(), gc.Equals, string(read))
+	return string(read)
+}
+
+func (s *TransformSuite) TestNormalizeCRLF(c *gc.C) {
+	out := transform(c, ssh.NormalizeCRLF(), "one\r\ntwo\rthree\n\r\n\r")
+	c.Check(out, gc.Equals, "one\ntwo\rthree\n\n\r")
+}
+
+func (s *TransformSuite) TestStripCR(c *gc.C) {
+	out := transform(c, ssh.StripCR(), "one\r\ntwo\rthree\n\r")
+	c.Check(out, gc.Equals, "one\ntwothree\n")
+}
+
+func (s *TransformSuite) TestEncoding(c *gc.C) {
+	out := transform(c, ssh.DecodeStream(charmap.ISO8859_1), "caf\xe9\n")
+	c.Check(out, gc.Equals, "café\n")
+	out = transform(c, ssh.EncodeStream(charmap.ISO8859_1), "café\n")
+	c.Check(out, gc.Equals, "caf\xe9\n")
+}
+
+func (s *TransformSuite) TestRateLimit(c *gc.C) {
+	clk := testclock.NewClock(time.Now())
+	limiter := utils.NewRateLimiterWithClock(1, 1, clk)
+	w := ssh.RateLimitStream(limiter, 4).Writer(ioutil.Discard)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := w.Write([]byte("0123456789"))
+		done <- err
+	}()
+	// The first block goes at once, and each of the
+	// others a second later.
+	for i := 0; i < 2; i++ {
+		err := clk.WaitAdvance(time.Second, testing.LongWait, 1)
+		c.Assert(err, jc.ErrorIsNil)
+	}
+	select {
+	case err := <-done:
+		c.Assert(err, jc.ErrorIsNil)
+	case <-time.After(testing.LongWait):
+		c.Fatalf("write not done")
+	}
+
+	r := ssh.RateLimitStream(limiter, 4).Reader(strings.NewReader("0123456789"))
+	buf := make([]byte, 10)
+	go func() {
+		n, err := r.Read(buf)
+		c.Check(n, gc.Equals, 4)
+		done <- err
+	}()
+	err := clk.WaitAdvance(time.Second, testing.LongWait, 1)
+	c.Assert(err, jc.ErrorIsNil)
+	select {
+	case err := <-done:
+		c.Assert(err, jc.ErrorIsNil)
+	case <-time.After(testing.LongWait):
+		c.Fatalf("read not done")
+	}
+}
+
+func (s *TransformSuite) TestLimitBandwidth(c *gc.C) {
+	clk := testclock.NewClock(time.Now())
+	limiter := utils.NewBandwidthLimiter(4, 4, clk)
+	var buf bytes.Buffer
+	w := ssh.LimitBandwidthStream(limiter).Writer(&buf)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := w.Write([]byte("01234567"))
+		done <- err
+	}()
+	err := clk.WaitAdvance(time.Second, testing.LongWait, 1)
+	c.Assert(err, jc.ErrorIsNil)
+	select {
+	case err := <-done:
+		c.Assert(err, jc.ErrorIsNil)
+	case <-time.After(testing.LongWait):
+		c.Fatalf("write not done")
+	}
+	c.Assert(w.Close(), jc.ErrorIsNil)
+	c.Assert(buf.String(), gc.Equals, "01234567")
+
+	data, err := ioutil.ReadAll(ssh.LimitBandwidthStream(utils.NewBandwidthLimiter(1e6, 1e6, nil)).Reader(strings.NewReader("hello")))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(data), gc.Equals, "hello")
+}
+
+func (s *TransformSuite) TestTeeToLog(c *gc.C) {
+	ctx := loggo.NewContext(loggo.DEBUG)
+	var tw loggo.TestWriter
+	err := ctx.AddWriter("test", &tw)
+	c.Assert(err, jc.ErrorIsNil)
+	t := ssh.TeeToLog(ctx.GetLogger("test"), loggo.DEBUG, "host: ")
+
+	out := transform(c, t, "one\r\npassword=hunter2\npartial")
+	c.Check(out, gc.Equals, "one\r\npassword=hunter2\npartial")
+	var messages []string
+	for _, entry := range tw.Log() {
+		messages = append(messages, entry.Message)
+	}
+	// Each line is logged once by the reader and once by the writer.
+	line := []string{"host: one", "host: password=[REDACTED]", "host: partial"}
+	c.Check(messages, jc.DeepEquals, append(line, line...))
+
+	// Nothing is logged below the logger's level.
+	tw.Clear()
+	t = ssh.TeeToLog(ctx.GetLogger("test"), loggo.TRACE, "")
+	transform(c, t, "one\n")
+	c.Check(tw.Log(), gc.HasLen, 0)
+}
+
+func (s *TransformSuite) TestCmdPipeline(c *gc.C) {
+	var opts ssh.Options
+	opts.AddStreamTransform(ssh.Stdin, ssh.EncodeStream(charmap.ISO8859_1))
+	opts.AddStreamTransform(ssh.Stdout, ssh.DecodeStream(charmap.ISO8859_1), ssh.NormalizeCRLF())
+	cmd := ssh.NewRecordedCmd(&s.impl, &opts, "host", nil)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = strings.NewReader("café")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Start()
+	c.Assert(err, jc.ErrorIsNil)
+
+	input, err := ioutil.ReadAll(s.impl.stdinArg)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(input), gc.Equals, "caf\xe9")
+	_, err = s.impl.stdoutArg.Write([]byte("caf\xe9\r"))
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = s.impl.stderrArg.Write([]byte("err\r\n"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stdout.String(), gc.Equals, "café")
+	// Stderr has no transforms.
+	c.Check(s.impl.stderrArg, gc.Equals, &stderr)
+
+	// Waiting flushes the data held back.
+	err = cmd.Wait()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stdout.String(), gc.Equals, "café\r")
+	c.Check(stderr.String(), gc.Equals, "err\r\n")
+}
+
+func (s *TransformSuite) TestCmdPipes(c *gc.C) {
+	var opts ssh.Options
+	opts.AddStreamTransform(ssh.Stdin, ssh.NormalizeCRLF())
+	opts.AddStreamTransform(ssh.Stderr, ssh.StripCR())
+	s.impl.stderrData.WriteString("a\r\nb\r")
+	cmd := ssh.NewRecordedCmd(&s.impl, &opts, "host", nil)
+
+	stdin, err := cmd.StdinPipe()
+	c.Assert(err, jc.ErrorIsNil)
+	stderr, err := cmd.StderrPipe()
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = stdin.Write([]byte("x\r\ny\r"))
+	c.Assert(err, jc.ErrorIsNil)
+	s.impl.checkStdin(c, "x\ny")
+	err = stdin.Close()
+	c.Assert(err, jc.ErrorIsNil)
+	s.impl.checkStdin(c, "x\ny\r")
+
+	data, err := ioutil.ReadAll(stderr)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(data), gc.Equals, "a\nb")
+}
+
+func (s *TransformSuite) TestOptionsCopy(c *gc.C) {
+	var opts ssh.Options
+	opts.AddStreamTransform(ssh.Stdout, ssh.StripCR())
+	copied := opts
+	copied.AddStreamTransform(ssh.Stdout, ssh.DecodeStream(charmap.ISO8859_1))
+
+	var stdout bytes.Buffer
+	cmd := ssh.NewRecordedCmd(&s.impl, &opts, "host", nil)
+	cmd.Stdout = &stdout
+	err := cmd.Start()
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = s.impl.stdoutArg.Write([]byte("caf\xe9\r\n"))
+	c.Assert(err, jc.ErrorIsNil)
+	err = cmd.Wait()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stdout.String(), gc.Equals, "caf\xe9\n")
+}
+
+func (s *TransformSuite) TestStreamString(c *gc.C) {
+	c.Check(ssh.Stdin.String(), gc.Equals, "stdin")
+	c.Check(ssh.Stdout.String(), gc.Equals, "stdout")
+	c.Check(ssh.Stderr.String(), gc.Equals, "stderr")
+}
@@ -0,0 +1,142 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package stats provides lightweight statistics helpers for reporting
+// rates and latencies without depending on a metrics framework. All
+// the types in this package are safe for concurrent use.
+package stats
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/juju/clock"
+)
+
+// EWMA is an exponentially weighted moving average of samples taken at
+// irregular intervals. The weight given to the previous average decays
+// with the time elapsed since it was last updated, halving every
+// half-life.
+type EWMA struct {
+	clock    clock.Clock
+	halfLife time.Duration
+
+	// mu guards the fields below it.
+	mu    sync.Mutex
+	value float64
+	last  time.Time
+	set   bool
+}
+
+// NewEWMA returns a moving average with the given half-life. If clk is
+// nil, the wall clock is used.
+func NewEWMA(halfLife time.Duration, clk clock.Clock) *EWMA {
+	if halfLife <= 0 {
+		panic("half-life must be > 0")
+	}
+	if clk == nil {
+		clk = clock.WallClock
+	}
+	return &EWMA{
+		clock:    clk,
+		halfLife: halfLife,
+	}
+}
+
+// Add adds a sample to the average. The first sample
+// becomes the average.
+func (e *EWMA) Add(sample float64) {
+	now := e.clock.Now()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.set {
+		e.value = sample
+		e.last = now
+		e.set = true
+		return
+	}
+	weight := e.decay(now)
+	e.value = e.value*weight + sample*(1-weight)
+	e.last = now
+}
+
+// decay returns the weight remaining to the
+// current value at the given time.
+func (e *EWMA) decay(now time.Time) float64 {
+	elapsed := now.Sub(e.last)
+	if elapsed <= 0 {
+		// Samples at the same instant are weighted as
+		// if a tiny amount of time had passed, so that
+		// they still move the average.
+		elapsed = 1
+	}
+	return math.Exp2(-float64(elapsed) / float64(e.halfLife))
+}
+
+// Value returns the current average, or zero
+// if no samples have been added.
+func (e *EWMA) Value() float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.value
+}
+
+// Rate measures the rate of events per second, decaying exponentially
+// so that recent events count for more than older ones.
+type Rate struct {
+	clock    clock.Clock
+	halfLife time.Duration
+
+	// mu guards the fields below it.
+	mu    sync.Mutex
+	rate  float64
+	last  time.Time
+	start time.Time
+}
+
+// NewRate returns a rate tracker with the given half-life. If clk is
+// nil, the wall clock is used.
+func NewRate(halfLife time.Duration, clk clock.Clock) *Rate {
+	if halfLife <= 0 {
+		panic("half-life must be > 0")
+	}
+	if clk == nil {
+		clk = clock.WallClock
+	}
+	now := clk.Now()
+	return &Rate{
+		clock:    clk,
+		halfLife: halfLife,
+		last:     now,
+		start:    now,
+	}
+}
+
+// Add records n events.
+func (r *Rate) Add(n int64) {
+	now := r.clock.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.advance(now)
+	// Each event contributes an impulse whose integral over
+	// all time is 1, so that a steady stream of events at a
+	// given rate converges on that rate.
+	r.rate += float64(n) * math.Ln2 / r.halfLife.Seconds()
+}
+
+// PerSecond returns the current rate in events per second.
+func (r *Rate) PerSecond() float64 {
+	now := r.clock.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.advance(now)
+	return r.rate
+}
+
+func (r *Rate) advance(now time.Time) {
+	if elapsed := now.Sub(r.last); elapsed > 0 {
+		r.rate *= math.Exp2(-float64(elapsed) / float64(r.halfLife))
+		r.last = now
+	}
+}
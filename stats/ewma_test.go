@@ -0,0 +1,78 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package stats_test
+
+import (
+	"math"
+	"time"
+
+	"github.com/juju/clock/testclock"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/stats"
+)
+
+type ewmaSuite struct {
+	testing.IsolationSuite
+	clock *testclock.Clock
+}
+
+var _ = gc.Suite(&ewmaSuite{})
+
+func (s *ewmaSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.clock = testclock.NewClock(time.Now())
+}
+
+func (s *ewmaSuite) TestEWMA(c *gc.C) {
+	e := stats.NewEWMA(time.Second, s.clock)
+	c.Assert(e.Value(), gc.Equals, 0.0)
+	e.Add(10)
+	c.Assert(e.Value(), gc.Equals, 10.0)
+
+	// After one half-life the old value and the
+	// new sample carry equal weight.
+	s.clock.Advance(time.Second)
+	e.Add(20)
+	c.Assert(e.Value(), gc.Equals, 15.0)
+
+	// After many half-lives the old value is forgotten.
+	s.clock.Advance(time.Minute)
+	e.Add(100)
+	c.Assert(e.Value(), jc.GreaterThan, 99.9)
+}
+
+func (s *ewmaSuite) TestEWMASameInstant(c *gc.C) {
+	e := stats.NewEWMA(time.Second, s.clock)
+	e.Add(10)
+	e.Add(20)
+	c.Assert(e.Value(), jc.GreaterThan, 10.0)
+}
+
+func (s *ewmaSuite) TestRate(c *gc.C) {
+	r := stats.NewRate(time.Second, s.clock)
+	c.Assert(r.PerSecond(), gc.Equals, 0.0)
+	for i := 0; i < 100; i++ {
+		r.Add(10)
+		s.clock.Advance(100 * time.Millisecond)
+	}
+	assertNear(c, r.PerSecond(), 100, 10)
+
+	// The rate halves every half-life once events stop.
+	before := r.PerSecond()
+	s.clock.Advance(time.Second)
+	assertNear(c, r.PerSecond(), before/2, 0.001)
+}
+
+func (s *ewmaSuite) TestInvalidHalfLife(c *gc.C) {
+	c.Assert(func() { stats.NewEWMA(0, nil) }, gc.PanicMatches, "half-life must be > 0")
+	c.Assert(func() { stats.NewRate(-1, nil) }, gc.PanicMatches, "half-life must be > 0")
+}
+
+func assertNear(c *gc.C, obtained, expected, tolerance float64) {
+	c.Assert(math.Abs(obtained-expected) <= tolerance, jc.IsTrue,
+		gc.Commentf("obtained %v, expected %v±%v", obtained, expected, tolerance))
+}
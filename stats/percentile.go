@@ -0,0 +1,93 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package stats
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// Samples holds the most recent samples of some measurement, such as
+// a latency, and estimates percentiles from them.
+type Samples struct {
+	// mu guards the fields below it.
+	mu     sync.Mutex
+	values []float64
+	next   int
+	count  int64
+}
+
+// NewSamples returns a Samples that keeps the
+// most recent size samples.
+func NewSamples(size int) *Samples {
+	if size < 1 {
+		panic("size must be >= 1")
+	}
+	return &Samples{
+		values: make([]float64, 0, size),
+	}
+}
+
+// Add adds a sample, discarding the oldest
+// sample if there are already size samples.
+func (s *Samples) Add(v float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.count++
+	if len(s.values) < cap(s.values) {
+		s.values = append(s.values, v)
+		return
+	}
+	s.values[s.next] = v
+	s.next = (s.next + 1) % len(s.values)
+}
+
+// Count returns the total number of samples ever added.
+func (s *Samples) Count() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count
+}
+
+// Percentile returns the p'th percentile of the samples held, for p
+// between 0 and 100, interpolating between samples where necessary.
+// It returns NaN if there are no samples.
+func (s *Samples) Percentile(p float64) float64 {
+	return s.Percentiles(p)[0]
+}
+
+// Percentiles is like Percentile but returns
+// several percentiles at once.
+func (s *Samples) Percentiles(ps ...float64) []float64 {
+	s.mu.Lock()
+	sorted := append([]float64(nil), s.values...)
+	s.mu.Unlock()
+	sort.Float64s(sorted)
+
+	result := make([]float64, len(ps))
+	for i, p := range ps {
+		result[i] = percentile(sorted, p)
+	}
+	return result
+}
+
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return math.NaN()
+	}
+	switch {
+	case p <= 0:
+		return sorted[0]
+	case p >= 100:
+		return sorted[len(sorted)-1]
+	}
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(rank)
+	frac := rank - float64(lower)
+	if lower+1 >= len(sorted) {
+		return sorted[lower]
+	}
+	return sorted[lower] + frac*(sorted[lower+1]-sorted[lower])
+}
@@ -0,0 +1,51 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package stats_test
+
+import (
+	"math"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/stats"
+)
+
+type samplesSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&samplesSuite{})
+
+func (*samplesSuite) TestPercentiles(c *gc.C) {
+	s := stats.NewSamples(100)
+	for i := 100; i >= 1; i-- {
+		s.Add(float64(i))
+	}
+	c.Assert(s.Count(), gc.Equals, int64(100))
+	c.Assert(s.Percentile(0), gc.Equals, 1.0)
+	c.Assert(s.Percentile(100), gc.Equals, 100.0)
+	c.Assert(s.Percentile(50), gc.Equals, 50.5)
+	ps := s.Percentiles(90, 99)
+	c.Assert(ps, gc.HasLen, 2)
+	assertNear(c, ps[0], 90.1, 1e-9)
+	assertNear(c, ps[1], 99.01, 1e-9)
+}
+
+func (*samplesSuite) TestOldestDiscarded(c *gc.C) {
+	s := stats.NewSamples(3)
+	for _, v := range []float64{100, 200, 1, 2, 3} {
+		s.Add(v)
+	}
+	c.Assert(s.Count(), gc.Equals, int64(5))
+	c.Assert(s.Percentile(100), gc.Equals, 3.0)
+	c.Assert(s.Percentile(50), gc.Equals, 2.0)
+}
+
+func (*samplesSuite) TestEmpty(c *gc.C) {
+	s := stats.NewSamples(3)
+	c.Assert(math.IsNaN(s.Percentile(50)), jc.IsTrue)
+	c.Assert(func() { stats.NewSamples(0) }, gc.PanicMatches, "size must be >= 1")
+}
@@ -0,0 +1,94 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package stats
+
+import (
+	"sync"
+	"time"
+
+	"github.com/juju/clock"
+)
+
+// Window counts events over a sliding window of time. The window is
+// divided into buckets; as time passes the oldest bucket is discarded,
+// so counts are accurate to within the length of one bucket.
+type Window struct {
+	clock  clock.Clock
+	size   time.Duration
+	bucket time.Duration
+
+	// mu guards the fields below it.
+	mu      sync.Mutex
+	counts  []int64
+	current int
+	// start holds the start time of the current bucket.
+	start time.Time
+}
+
+// NewWindow returns a counter over a window of the given size, divided
+// into the given number of buckets. If clk is nil, the wall clock is
+// used.
+func NewWindow(size time.Duration, buckets int, clk clock.Clock) *Window {
+	if buckets < 1 {
+		panic("buckets must be >= 1")
+	}
+	if size < time.Duration(buckets) {
+		panic("window too small for number of buckets")
+	}
+	if clk == nil {
+		clk = clock.WallClock
+	}
+	return &Window{
+		clock:  clk,
+		size:   size,
+		bucket: size / time.Duration(buckets),
+		counts: make([]int64, buckets),
+		start:  clk.Now(),
+	}
+}
+
+// Add adds n to the count.
+func (w *Window) Add(n int64) {
+	now := w.clock.Now()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.advance(now)
+	w.counts[w.current] += n
+}
+
+// Sum returns the total count within the window.
+func (w *Window) Sum() int64 {
+	now := w.clock.Now()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.advance(now)
+	var sum int64
+	for _, n := range w.counts {
+		sum += n
+	}
+	return sum
+}
+
+// PerSecond returns the average count per second over the window.
+func (w *Window) PerSecond() float64 {
+	return float64(w.Sum()) / w.size.Seconds()
+}
+
+// advance discards the buckets that have
+// passed out of the window by now.
+func (w *Window) advance(now time.Time) {
+	elapsed := now.Sub(w.start)
+	if elapsed < w.bucket {
+		return
+	}
+	steps := int(elapsed / w.bucket)
+	if steps > len(w.counts) {
+		steps = len(w.counts)
+	}
+	for i := 0; i < steps; i++ {
+		w.current = (w.current + 1) % len(w.counts)
+		w.counts[w.current] = 0
+	}
+	w.start = w.start.Add(elapsed - elapsed%w.bucket)
+}
@@ -0,0 +1,64 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package stats_test
+
+import (
+	"time"
+
+	"github.com/juju/clock/testclock"
+	"github.com/juju/testing"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/stats"
+)
+
+type windowSuite struct {
+	testing.IsolationSuite
+	clock *testclock.Clock
+}
+
+var _ = gc.Suite(&windowSuite{})
+
+func (s *windowSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.clock = testclock.NewClock(time.Now())
+}
+
+func (s *windowSuite) TestSlidingWindow(c *gc.C) {
+	w := stats.NewWindow(10*time.Second, 10, s.clock)
+	c.Assert(w.Sum(), gc.Equals, int64(0))
+
+	for i := 0; i < 10; i++ {
+		w.Add(int64(i + 1))
+		s.clock.Advance(time.Second)
+	}
+	// The first bucket, holding 1, has just left the window.
+	c.Assert(w.Sum(), gc.Equals, int64(54))
+	c.Assert(w.PerSecond(), gc.Equals, 5.4)
+
+	s.clock.Advance(5 * time.Second)
+	c.Assert(w.Sum(), gc.Equals, int64(7+8+9+10))
+
+	s.clock.Advance(time.Hour)
+	c.Assert(w.Sum(), gc.Equals, int64(0))
+	w.Add(3)
+	c.Assert(w.Sum(), gc.Equals, int64(3))
+}
+
+func (s *windowSuite) TestPartialBucket(c *gc.C) {
+	w := stats.NewWindow(4*time.Second, 2, s.clock)
+	w.Add(1)
+	s.clock.Advance(1500 * time.Millisecond)
+	w.Add(1)
+	s.clock.Advance(time.Second)
+	w.Add(1)
+	c.Assert(w.Sum(), gc.Equals, int64(3))
+	s.clock.Advance(2 * time.Second)
+	c.Assert(w.Sum(), gc.Equals, int64(1))
+}
+
+func (s *windowSuite) TestInvalid(c *gc.C) {
+	c.Assert(func() { stats.NewWindow(time.Second, 0, nil) }, gc.PanicMatches, "buckets must be >= 1")
+	c.Assert(func() { stats.NewWindow(2, 3, nil) }, gc.PanicMatches, "window too small for number of buckets")
+}
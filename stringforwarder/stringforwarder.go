@@ -0,0 +1,240 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package stringforwarder forwards strings, such as log messages, to
+// a callback in a goroutine of its own, so that a slow callback does
+// not hold up the sender. Messages wait in a bounded queue; what
+// happens when it is full is set by an OverflowPolicy.
+package stringforwarder
+
+import (
+	"context"
+	"sync"
+
+	"github.com/juju/errors"
+)
+
+// OverflowPolicy says what Forward does when the queue is full.
+type OverflowPolicy int
+
+const (
+	// DropOldest discards the oldest message in the queue to make
+	// room for the new one.
+	DropOldest OverflowPolicy = iota
+
+	// DropNewest discards the new message.
+	DropNewest
+
+	// Block waits until there is room in the queue.
+	Block
+)
+
+// String implements fmt.Stringer.
+func (p OverflowPolicy) String() string {
+	switch p {
+	case DropOldest:
+		return "drop-oldest"
+	case DropNewest:
+		return "drop-newest"
+	case Block:
+		return "block"
+	}
+	return "unknown"
+}
+
+// Config holds the configuration of a StringForwarder.
+type Config struct {
+	// Callback is called with each message forwarded,
+	// one at a time, in the order they were sent.
+	Callback func(string)
+
+	// QueueSize holds the number of messages that may wait to be
+	// forwarded while the callback is busy. It must be at least 1.
+	QueueSize int
+
+	// Policy says what happens when the queue is full.
+	Policy OverflowPolicy
+}
+
+// Validate returns an error if the configuration is not valid.
+func (config Config) Validate() error {
+	if config.Callback == nil {
+		return errors.NotValidf("nil Callback")
+	}
+	if config.QueueSize < 1 {
+		return errors.NotValidf("QueueSize %d", config.QueueSize)
+	}
+	switch config.Policy {
+	case DropOldest, DropNewest, Block:
+	default:
+		return errors.NotValidf("Policy %d", config.Policy)
+	}
+	return nil
+}
+
+// Stats holds counts of the messages handled by a StringForwarder.
+type Stats struct {
+	// Forwarded holds the number of messages
+	// passed to the callback.
+	Forwarded uint64
+
+	// Dropped holds the number of messages discarded, because
+	// the queue was full or the forwarder was stopped.
+	Dropped uint64
+
+	// Queued holds the number of messages waiting.
+	Queued int
+}
+
+// StringForwarder forwards messages to a callback.
+type StringForwarder struct {
+	config Config
+
+	mu         sync.Mutex
+	cond       *sync.Cond
+	queue      []string
+	delivering bool
+	stopped    bool
+	stats      Stats
+	done       chan struct{}
+}
+
+// New returns a forwarder that passes messages to callback, keeping
+// only the most recent message while the callback is busy.
+func New(callback func(string)) *StringForwarder {
+	f, err := NewWithConfig(Config{
+		Callback:  callback,
+		QueueSize: 1,
+		Policy:    DropOldest,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+// NewWithConfig returns a forwarder with the given configuration.
+// The forwarder must be stopped with Stop when it is no longer needed.
+func NewWithConfig(config Config) (*StringForwarder, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	f := &StringForwarder{
+		config: config,
+		done:   make(chan struct{}),
+	}
+	f.cond = sync.NewCond(&f.mu)
+	go f.loop()
+	return f, nil
+}
+
+// Forward queues msg to be passed to the callback. If the queue is
+// full, the message or the oldest queued one is dropped, or Forward
+// blocks, according to the overflow policy. Messages forwarded after
+// Stop has been called are dropped.
+func (f *StringForwarder) Forward(msg string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.config.Policy == Block {
+		for len(f.queue) >= f.config.QueueSize && !f.stopped {
+			f.cond.Wait()
+		}
+	}
+	switch {
+	case f.stopped:
+		f.stats.Dropped++
+		return
+	case len(f.queue) < f.config.QueueSize:
+	case f.config.Policy == DropNewest:
+		f.stats.Dropped++
+		return
+	default:
+		f.queue = f.queue[1:]
+		f.stats.Dropped++
+	}
+	f.queue = append(f.queue, msg)
+	f.cond.Broadcast()
+}
+
+// Flush waits until every message queued has been passed to the
+// callback and the callback has returned, or until the forwarder is
+// stopped. It returns the context's error if the context is done
+// first.
+func (f *StringForwarder) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// Wake the waiter below so that it sees
+			// the context is done.
+			f.mu.Lock()
+			f.cond.Broadcast()
+			f.mu.Unlock()
+		case <-done:
+		}
+	}()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for (len(f.queue) > 0 || f.delivering) && !f.stopped {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		f.cond.Wait()
+	}
+	return nil
+}
+
+// Stats returns counts of the messages handled so far.
+func (f *StringForwarder) Stats() Stats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stats := f.stats
+	stats.Queued = len(f.queue)
+	return stats
+}
+
+// Stop stops the forwarder, dropping any messages still queued, and
+// returns the total number of messages dropped. It waits for any
+// call to the callback in progress to return, so it must not be
+// called from the callback.
+func (f *StringForwarder) Stop() uint64 {
+	f.mu.Lock()
+	if !f.stopped {
+		f.stopped = true
+		f.stats.Dropped += uint64(len(f.queue))
+		f.queue = nil
+		f.cond.Broadcast()
+	}
+	f.mu.Unlock()
+	<-f.done
+	return f.Stats().Dropped
+}
+
+// loop passes queued messages to the callback until
+// the forwarder is stopped.
+func (f *StringForwarder) loop() {
+	defer close(f.done)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for {
+		for len(f.queue) == 0 && !f.stopped {
+			f.cond.Wait()
+		}
+		if f.stopped {
+			return
+		}
+		msg := f.queue[0]
+		f.queue = f.queue[1:]
+		f.delivering = true
+		// Wake any senders waiting for room.
+		f.cond.Broadcast()
+		f.mu.Unlock()
+		f.config.Callback(msg)
+		f.mu.Lock()
+		f.delivering = false
+		f.stats.Forwarded++
+		// Wake any flushers.
+		f.cond.Broadcast()
+	}
+}
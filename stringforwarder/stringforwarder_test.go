@@ -0,0 +1,241 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package stringforwarder_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/stringforwarder"
+)
+
+type ForwarderSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&ForwarderSuite{})
+
+// blockingCallback returns a callback that sends each message it
+// receives on received and then waits for a value on release.
+func blockingCallback() (callback func(string), received chan string, release chan struct{}) {
+	received = make(chan string, 100)
+	release = make(chan struct{})
+	callback = func(msg string) {
+		received <- msg
+		<-release
+	}
+	return callback, received, release
+}
+
+func expectMessage(c *gc.C, received <-chan string, expect string) {
+	select {
+	case msg := <-received:
+		c.Assert(msg, gc.Equals, expect)
+	case <-time.After(testing.LongWait):
+		c.Fatalf("message %q not received", expect)
+	}
+}
+
+func (*ForwarderSuite) TestNewKeepsLatest(c *gc.C) {
+	callback, received, release := blockingCallback()
+	f := stringforwarder.New(callback)
+	defer f.Stop()
+
+	f.Forward("a")
+	expectMessage(c, received, "a")
+	f.Forward("b")
+	f.Forward("c")
+	c.Check(f.Stats(), jc.DeepEquals, stringforwarder.Stats{Dropped: 1, Queued: 1})
+
+	release <- struct{}{}
+	expectMessage(c, received, "c")
+	release <- struct{}{}
+	err := f.Flush(context.Background())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(f.Stats(), jc.DeepEquals, stringforwarder.Stats{Forwarded: 2, Dropped: 1})
+}
+
+func (*ForwarderSuite) TestDropNewest(c *gc.C) {
+	callback, received, release := blockingCallback()
+	f, err := stringforwarder.NewWithConfig(stringforwarder.Config{
+		Callback:  callback,
+		QueueSize: 2,
+		Policy:    stringforwarder.DropNewest,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	defer f.Stop()
+
+	f.Forward("a")
+	expectMessage(c, received, "a")
+	for _, msg := range []string{"b", "c", "d", "e"} {
+		f.Forward(msg)
+	}
+	c.Check(f.Stats(), jc.DeepEquals, stringforwarder.Stats{Dropped: 2, Queued: 2})
+	close(release)
+	expectMessage(c, received, "b")
+	expectMessage(c, received, "c")
+	err = f.Flush(context.Background())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(f.Stats().Forwarded, gc.Equals, uint64(3))
+}
+
+func (*ForwarderSuite) TestDropOldest(c *gc.C) {
+	callback, received, release := blockingCallback()
+	f, err := stringforwarder.NewWithConfig(stringforwarder.Config{
+		Callback:  callback,
+		QueueSize: 2,
+		Policy:    stringforwarder.DropOldest,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	defer f.Stop()
+
+	f.Forward("a")
+	expectMessage(c, received, "a")
+	for _, msg := range []string{"b", "c", "d", "e"} {
+		f.Forward(msg)
+	}
+	close(release)
+	expectMessage(c, received, "d")
+	expectMessage(c, received, "e")
+	err = f.Flush(context.Background())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(f.Stats(), jc.DeepEquals, stringforwarder.Stats{Forwarded: 3, Dropped: 2})
+}
+
+func (*ForwarderSuite) TestBlock(c *gc.C) {
+	callback, received, release := blockingCallback()
+	f, err := stringforwarder.NewWithConfig(stringforwarder.Config{
+		Callback:  callback,
+		QueueSize: 1,
+		Policy:    stringforwarder.Block,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	defer f.Stop()
+
+	f.Forward("a")
+	expectMessage(c, received, "a")
+	f.Forward("b")
+	sent := make(chan struct{})
+	go func() {
+		f.Forward("c")
+		close(sent)
+	}()
+	select {
+	case <-sent:
+		c.Fatalf("Forward did not block")
+	case <-time.After(testing.ShortWait):
+	}
+	release <- struct{}{}
+	expectMessage(c, received, "b")
+	select {
+	case <-sent:
+	case <-time.After(testing.LongWait):
+		c.Fatalf("Forward still blocked")
+	}
+	close(release)
+	expectMessage(c, received, "c")
+	err = f.Flush(context.Background())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(f.Stats(), jc.DeepEquals, stringforwarder.Stats{Forwarded: 3})
+}
+
+func (*ForwarderSuite) TestFlushTimeout(c *gc.C) {
+	callback, received, release := blockingCallback()
+	f := stringforwarder.New(callback)
+	defer f.Stop()
+
+	f.Forward("a")
+	expectMessage(c, received, "a")
+	ctx, cancel := context.WithTimeout(context.Background(), testing.ShortWait)
+	defer cancel()
+	err := f.Flush(ctx)
+	c.Check(err, gc.Equals, context.DeadlineExceeded)
+
+	close(release)
+	err = f.Flush(context.Background())
+	c.Check(err, jc.ErrorIsNil)
+}
+
+func (*ForwarderSuite) TestStop(c *gc.C) {
+	callback, received, release := blockingCallback()
+	f, err := stringforwarder.NewWithConfig(stringforwarder.Config{
+		Callback:  callback,
+		QueueSize: 5,
+		Policy:    stringforwarder.Block,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	f.Forward("a")
+	expectMessage(c, received, "a")
+	f.Forward("b")
+	f.Forward("c")
+
+	stopped := make(chan uint64)
+	go func() {
+		stopped <- f.Stop()
+	}()
+	// Stop waits for the callback to return.
+	select {
+	case <-stopped:
+		c.Fatalf("Stop did not wait for the callback")
+	case <-time.After(testing.ShortWait):
+	}
+	close(release)
+	select {
+	case dropped := <-stopped:
+		c.Check(dropped, gc.Equals, uint64(2))
+	case <-time.After(testing.LongWait):
+		c.Fatalf("Stop did not return")
+	}
+
+	// Messages forwarded after stopping are dropped, and
+	// flushing and stopping again return at once.
+	f.Forward("d")
+	c.Check(f.Flush(context.Background()), jc.ErrorIsNil)
+	c.Check(f.Stop(), gc.Equals, uint64(3))
+	c.Check(f.Stats(), jc.DeepEquals, stringforwarder.Stats{Forwarded: 1, Dropped: 3})
+	select {
+	case msg := <-received:
+		c.Fatalf("unexpected message %q", msg)
+	default:
+	}
+}
+
+func (*ForwarderSuite) TestInvalidConfig(c *gc.C) {
+	valid := stringforwarder.Config{
+		Callback:  func(string) {},
+		QueueSize: 1,
+	}
+	for i, test := range []struct {
+		change func(*stringforwarder.Config)
+		err    string
+	}{{
+		change: func(config *stringforwarder.Config) { config.Callback = nil },
+		err:    "nil Callback not valid",
+	}, {
+		change: func(config *stringforwarder.Config) { config.QueueSize = 0 },
+		err:    "QueueSize 0 not valid",
+	}, {
+		change: func(config *stringforwarder.Config) { config.Policy = 7 },
+		err:    "Policy 7 not valid",
+	}} {
+		c.Logf("test %d", i)
+		config := valid
+		test.change(&config)
+		_, err := stringforwarder.NewWithConfig(config)
+		c.Check(err, gc.ErrorMatches, test.err)
+		c.Check(err, jc.Satisfies, errors.IsNotValid)
+	}
+}
+
+func (*ForwarderSuite) TestPolicyString(c *gc.C) {
+	c.Check(stringforwarder.DropOldest.String(), gc.Equals, "drop-oldest")
+	c.Check(stringforwarder.DropNewest.String(), gc.Equals, "drop-newest")
+	c.Check(stringforwarder.Block.String(), gc.Equals, "block")
+}
@@ -0,0 +1,230 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package symlink
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/juju/utils/v3/vfs"
+)
+
+// CopyOptions holds the options for CopyTree.
+type CopyOptions struct {
+	// RewriteAbsolute, if true, causes symbolic links whose targets
+	// are absolute paths inside the source tree to be rewritten so
+	// that they point to the same place inside the destination tree.
+	// Other link targets are copied unchanged.
+	RewriteAbsolute bool
+
+	// FS holds the filesystem holding both trees.
+	// If it is nil, vfs.OS is used.
+	FS vfs.FS
+}
+
+// CopyTree recursively copies the directory tree at src to dst, which
+// must not already exist. Unlike a plain copy, it preserves the
+// structure of the tree: symbolic links (and, on Windows, directory
+// junctions) are recreated as links rather than followed, files that
+// are hard links to each other within the tree are recreated as hard
+// links, and permission bits are preserved on files and directories.
+//
+// Links are created after all the files and directories have been
+// copied, so that links to targets elsewhere in the tree resolve
+// correctly on platforms that inspect the target when the link is made.
+//
+// If the copy fails half way through, the destination might be left
+// partially written.
+func CopyTree(src, dst string, opts CopyOptions) error {
+	fsys := opts.FS
+	if fsys == nil {
+		fsys = vfs.OS
+	}
+	info, err := fsys.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("cannot copy %q: not a directory", src)
+	}
+	if _, err := fsys.Lstat(dst); err == nil {
+		return fmt.Errorf("will not overwrite %q", dst)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	c := &treeCopier{
+		opts:  opts,
+		fs:    fsys,
+		files: make(map[int64][]copiedFile),
+	}
+	if c.srcRoot, err = absPath(fsys, src); err != nil {
+		return err
+	}
+	if c.dstRoot, err = absPath(fsys, dst); err != nil {
+		return err
+	}
+	if err := c.copyDir(src, dst, info); err != nil {
+		return err
+	}
+	for _, l := range c.links {
+		if err := fsys.Symlink(l.target, l.path); err != nil {
+			return err
+		}
+	}
+	// Directory permissions are applied last, so that read-only
+	// directories could still be populated above.
+	for i := len(c.dirs) - 1; i >= 0; i-- {
+		d := c.dirs[i]
+		if err := fsys.Chmod(d.path, d.mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// absPath returns an absolute representation of path in fsys.
+// Paths in filesystems other than the operating system's are
+// taken to be relative to the root.
+func absPath(fsys vfs.FS, path string) (string, error) {
+	if fsys == vfs.OS {
+		return filepath.Abs(path)
+	}
+	return filepath.Join(string(filepath.Separator), path), nil
+}
+
+// treeCopier holds the state of a CopyTree call.
+type treeCopier struct {
+	opts             CopyOptions
+	fs               vfs.FS
+	srcRoot, dstRoot string
+
+	// files holds the regular files copied so far, indexed by size,
+	// so that hard links to them can be recognised.
+	files map[int64][]copiedFile
+
+	// links holds the symbolic links still to be created.
+	links []pendingLink
+
+	// dirs holds the directories created, in the order they
+	// were created, along with their final permissions.
+	dirs []copiedDir
+}
+
+type copiedFile struct {
+	info os.FileInfo
+	dst  string
+}
+
+type pendingLink struct {
+	path, target string
+}
+
+type copiedDir struct {
+	path string
+	mode os.FileMode
+}
+
+func (c *treeCopier) copy(src, dst string) error {
+	info, err := c.fs.Lstat(src)
+	if err != nil {
+		return err
+	}
+	isLink, err := isLinkInfo(src, info)
+	if err != nil {
+		return err
+	}
+	switch {
+	case isLink:
+		return c.copyLink(src, dst)
+	case info.IsDir():
+		return c.copyDir(src, dst, info)
+	case info.Mode().IsRegular():
+		return c.copyFile(src, dst, info)
+	default:
+		return fmt.Errorf("cannot copy %q: unsupported file mode %v", src, info.Mode())
+	}
+}
+
+func (c *treeCopier) copyDir(src, dst string, info os.FileInfo) error {
+	// Create the directory writable so that it can be populated;
+	// its real permissions are applied at the end.
+	if err := c.fs.Mkdir(dst, 0700); err != nil {
+		return err
+	}
+	c.dirs = append(c.dirs, copiedDir{path: dst, mode: preservedMode(info.Mode())})
+	entries, err := c.fs.ReadDir(src)
+	if err != nil {
+		return fmt.Errorf("error reading directory %q: %v", src, err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if err := c.copy(filepath.Join(src, name), filepath.Join(dst, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *treeCopier) copyFile(src, dst string, info os.FileInfo) error {
+	for _, f := range c.files[info.Size()] {
+		if vfs.SameFile(f.info, info) {
+			return c.fs.Link(f.dst, dst)
+		}
+	}
+	srcf, err := c.fs.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcf.Close()
+	mode := preservedMode(info.Mode())
+	dstf, err := c.fs.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode.Perm())
+	if err != nil {
+		return err
+	}
+	defer dstf.Close()
+	if _, err := io.Copy(dstf, srcf); err != nil {
+		return fmt.Errorf("cannot copy %q to %q: %v", src, dst, err)
+	}
+	// Make the actual permissions match the source permissions
+	// even in the presence of umask.
+	if err := c.fs.Chmod(dst, mode); err != nil {
+		return err
+	}
+	c.files[info.Size()] = append(c.files[info.Size()], copiedFile{info: info, dst: dst})
+	return nil
+}
+
+func (c *treeCopier) copyLink(src, dst string) error {
+	target, err := c.fs.Readlink(src)
+	if err != nil {
+		return err
+	}
+	if c.opts.RewriteAbsolute {
+		target = c.rewrite(target)
+	}
+	c.links = append(c.links, pendingLink{path: dst, target: target})
+	return nil
+}
+
+// rewrite returns the link target that should be used in the
+// destination tree for the given target in the source tree.
+func (c *treeCopier) rewrite(target string) string {
+	if !filepath.IsAbs(target) {
+		return target
+	}
+	rel, err := filepath.Rel(c.srcRoot, filepath.Clean(target))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return target
+	}
+	return filepath.Join(c.dstRoot, rel)
+}
+
+// preservedMode returns the mode bits that are
+// preserved when copying a file with the given mode.
+func preservedMode(mode os.FileMode) os.FileMode {
+	return mode & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+}
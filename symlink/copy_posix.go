@@ -0,0 +1,17 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+//go:build linux || darwin
+// +build linux darwin
+
+package symlink
+
+import (
+	"os"
+)
+
+// isLinkInfo reports whether the file at path, described
+// by info, should be copied as a symbolic link.
+func isLinkInfo(path string, info os.FileInfo) (bool, error) {
+	return info.Mode()&os.ModeSymlink != 0, nil
+}
@@ -0,0 +1,160 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package symlink_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/symlink"
+	"github.com/juju/utils/v3/vfs"
+)
+
+type CopySuite struct{}
+
+var _ = gc.Suite(&CopySuite{})
+
+// makeTree creates a tree to copy under dir/src and returns its path.
+func makeTree(c *gc.C, dir string) string {
+	src := filepath.Join(dir, "src")
+	c.Assert(os.MkdirAll(filepath.Join(src, "data", "sub"), 0755), jc.ErrorIsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(src, "data", "file"), []byte("file"), 0640), jc.ErrorIsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(src, "data", "sub", "exec"), []byte("exec"), 0750), jc.ErrorIsNil)
+	c.Assert(os.Link(filepath.Join(src, "data", "file"), filepath.Join(src, "hardlink")), jc.ErrorIsNil)
+	c.Assert(os.Symlink(filepath.Join("data", "sub"), filepath.Join(src, "relative")), jc.ErrorIsNil)
+	c.Assert(os.Symlink(filepath.Join(src, "data", "file"), filepath.Join(src, "absolute")), jc.ErrorIsNil)
+	c.Assert(os.Symlink(dir, filepath.Join(src, "outside")), jc.ErrorIsNil)
+	return src
+}
+
+func (*CopySuite) TestCopyTree(c *gc.C) {
+	dir := c.MkDir()
+	src := makeTree(c, dir)
+	dst := filepath.Join(dir, "dst")
+
+	err := symlink.CopyTree(src, dst, symlink.CopyOptions{})
+	c.Assert(err, jc.ErrorIsNil)
+
+	data, err := ioutil.ReadFile(filepath.Join(dst, "data", "file"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(data), gc.Equals, "file")
+
+	target, err := os.Readlink(filepath.Join(dst, "relative"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(target, gc.Equals, filepath.Join("data", "sub"))
+	target, err = os.Readlink(filepath.Join(dst, "absolute"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(target, gc.Equals, filepath.Join(src, "data", "file"))
+	target, err = os.Readlink(filepath.Join(dst, "outside"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(target, gc.Equals, dir)
+
+	file, err := os.Stat(filepath.Join(dst, "data", "file"))
+	c.Assert(err, jc.ErrorIsNil)
+	hardlink, err := os.Stat(filepath.Join(dst, "hardlink"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(os.SameFile(file, hardlink), jc.IsTrue)
+
+	if runtime.GOOS != "windows" {
+		c.Check(file.Mode().Perm(), gc.Equals, os.FileMode(0640))
+		info, err := os.Stat(filepath.Join(dst, "data", "sub", "exec"))
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(info.Mode().Perm(), gc.Equals, os.FileMode(0750))
+	}
+}
+
+func (*CopySuite) TestCopyTreeRewriteAbsolute(c *gc.C) {
+	dir := c.MkDir()
+	src := makeTree(c, dir)
+	dst := filepath.Join(dir, "dst")
+
+	err := symlink.CopyTree(src, dst, symlink.CopyOptions{RewriteAbsolute: true})
+	c.Assert(err, jc.ErrorIsNil)
+
+	target, err := os.Readlink(filepath.Join(dst, "absolute"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(target, gc.Equals, filepath.Join(dst, "data", "file"))
+	// Targets outside the source tree and relative targets are unchanged.
+	target, err = os.Readlink(filepath.Join(dst, "outside"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(target, gc.Equals, dir)
+	target, err = os.Readlink(filepath.Join(dst, "relative"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(target, gc.Equals, filepath.Join("data", "sub"))
+}
+
+func (*CopySuite) TestCopyTreeReadOnlyDir(c *gc.C) {
+	if runtime.GOOS == "windows" {
+		c.Skip("directory permissions are not supported on windows")
+	}
+	dir := c.MkDir()
+	src := filepath.Join(dir, "src")
+	c.Assert(os.MkdirAll(filepath.Join(src, "ro"), 0755), jc.ErrorIsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(src, "ro", "file"), []byte("x"), 0644), jc.ErrorIsNil)
+	c.Assert(os.Chmod(filepath.Join(src, "ro"), 0555), jc.ErrorIsNil)
+	defer os.Chmod(filepath.Join(src, "ro"), 0755)
+	dst := filepath.Join(dir, "dst")
+
+	err := symlink.CopyTree(src, dst, symlink.CopyOptions{})
+	c.Assert(err, jc.ErrorIsNil)
+	defer os.Chmod(filepath.Join(dst, "ro"), 0755)
+
+	info, err := os.Stat(filepath.Join(dst, "ro"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(info.Mode().Perm(), gc.Equals, os.FileMode(0555))
+	_, err = os.Stat(filepath.Join(dst, "ro", "file"))
+	c.Check(err, jc.ErrorIsNil)
+}
+
+func (*CopySuite) TestCopyTreeWillNotOverwrite(c *gc.C) {
+	dir := c.MkDir()
+	src := makeTree(c, dir)
+
+	err := symlink.CopyTree(src, dir, symlink.CopyOptions{})
+	c.Assert(err, gc.ErrorMatches, `will not overwrite ".*"`)
+}
+
+func (*CopySuite) TestCopyTreeNotDirectory(c *gc.C) {
+	dir := c.MkDir()
+	src := makeTree(c, dir)
+
+	err := symlink.CopyTree(filepath.Join(src, "data", "file"), filepath.Join(dir, "dst"), symlink.CopyOptions{})
+	c.Assert(err, gc.ErrorMatches, `cannot copy ".*": not a directory`)
+}
+
+func (*CopySuite) TestCopyTreeMemFS(c *gc.C) {
+	fsys := vfs.NewMemFS()
+	c.Assert(fsys.MkdirAll("/src/data", 0755), jc.ErrorIsNil)
+	c.Assert(vfs.WriteFile(fsys, "/src/data/file", []byte("file"), 0640), jc.ErrorIsNil)
+	c.Assert(fsys.Link("/src/data/file", "/src/hardlink"), jc.ErrorIsNil)
+	c.Assert(fsys.Symlink("/src/data/file", "/src/absolute"), jc.ErrorIsNil)
+	c.Assert(fsys.Chmod("/src/data", 0500), jc.ErrorIsNil)
+
+	err := symlink.CopyTree("/src", "/dst", symlink.CopyOptions{
+		RewriteAbsolute: true,
+		FS:              fsys,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	data, err := vfs.ReadFile(fsys, "/dst/data/file")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(data), gc.Equals, "file")
+	file, err := fsys.Stat("/dst/data/file")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(file.Mode().Perm(), gc.Equals, os.FileMode(0640))
+	hardlink, err := fsys.Stat("/dst/hardlink")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(vfs.SameFile(file, hardlink), jc.IsTrue)
+	target, err := fsys.Readlink("/dst/absolute")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(target, gc.Equals, filepath.FromSlash("/dst/data/file"))
+	dirInfo, err := fsys.Stat("/dst/data")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(dirInfo.Mode().Perm(), gc.Equals, os.FileMode(0500))
+}
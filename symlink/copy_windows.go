@@ -0,0 +1,24 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package symlink
+
+import (
+	"os"
+)
+
+// isLinkInfo reports whether the file at path, described by info,
+// should be copied as a symbolic link. Depending on the Go version,
+// directory junctions are reported either as symbolic links or as
+// irregular files; in the latter case the reparse point attribute is
+// checked, and the junction is recreated as a directory symlink.
+func isLinkInfo(path string, info os.FileInfo) (bool, error) {
+	mode := info.Mode()
+	if mode&os.ModeSymlink != 0 {
+		return true, nil
+	}
+	if mode&os.ModeIrregular != 0 {
+		return IsSymlink(path)
+	}
+	return false, nil
+}
@@ -0,0 +1,291 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package table renders rows of data as an aligned text table,
+// CSV, TSV or JSON, so that command line tools can offer the
+// same output in several formats.
+package table
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/juju/errors"
+
+	"github.com/juju/utils/v3/orderedmap"
+	"github.com/juju/utils/v3/tty"
+)
+
+// Format identifies an output format.
+type Format string
+
+const (
+	// Text renders an aligned table with a header line.
+	Text Format = "text"
+
+	// CSV renders comma separated values as described
+	// in RFC 4180.
+	CSV Format = "csv"
+
+	// TSV renders tab separated values, quoted in the
+	// same way as CSV.
+	TSV Format = "tsv"
+
+	// JSON renders a list of objects, one for each row,
+	// keyed by column name.
+	JSON Format = "json"
+)
+
+// Formats holds all the supported formats.
+var Formats = []Format{Text, CSV, TSV, JSON}
+
+// ParseFormat returns the format with the given name.
+func ParseFormat(s string) (Format, error) {
+	for _, f := range Formats {
+		if string(f) == strings.ToLower(s) {
+			return f, nil
+		}
+	}
+	return "", errors.NotValidf("format %q", s)
+}
+
+// Column describes a column of a table.
+type Column struct {
+	// Name holds the name of the column. It is used as the
+	// header in text, CSV and TSV output and as the key in
+	// JSON output.
+	Name string
+
+	// RightAlign specifies that values in the column are
+	// aligned to the right in text output, as is usual
+	// for numbers.
+	RightAlign bool
+}
+
+// Table holds a table of values.
+type Table struct {
+	// Columns holds the columns of the table.
+	Columns []Column
+
+	// Rows holds the rows of the table. Each row holds a
+	// value for each column; missing values are treated
+	// as nil. Values are rendered with fmt.Sprint, except
+	// in JSON output, where they are marshaled as JSON.
+	Rows [][]interface{}
+}
+
+// New returns a new table with the given column names.
+func New(names ...string) *Table {
+	t := &Table{}
+	for _, name := range names {
+		t.Columns = append(t.Columns, Column{Name: name})
+	}
+	return t
+}
+
+// AddRow adds a row holding the given values.
+func (t *Table) AddRow(values ...interface{}) {
+	t.Rows = append(t.Rows, values)
+}
+
+// Options holds options for writing a table.
+type Options struct {
+	// Format holds the output format. If it is empty,
+	// Text is used.
+	Format Format
+
+	// Columns holds the names of the columns to write,
+	// in order. If it is empty, all columns are written.
+	Columns []string
+
+	// MaxWidth, if positive, holds the maximum width of
+	// a value in text output. Longer values are truncated
+	// and end with an ellipsis.
+	MaxWidth int
+
+	// NoHeader specifies that the header is omitted from
+	// text, CSV and TSV output.
+	NoHeader bool
+}
+
+// Write writes the table to w using the given options.
+func (t *Table) Write(w io.Writer, options Options) error {
+	cols, err := t.selectColumns(options.Columns)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	switch options.Format {
+	case Text, "":
+		return t.writeText(w, cols, options)
+	case CSV:
+		return t.writeCSV(w, cols, ',', options)
+	case TSV:
+		return t.writeCSV(w, cols, '\t', options)
+	case JSON:
+		return t.writeJSON(w, cols)
+	}
+	return errors.NotValidf("format %q", options.Format)
+}
+
+// String returns the table as text with the default options.
+func (t *Table) String() string {
+	var buf bytes.Buffer
+	t.Write(&buf, Options{})
+	return buf.String()
+}
+
+// selectColumns returns the indexes of the named columns,
+// or of all columns if names is empty.
+func (t *Table) selectColumns(names []string) ([]int, error) {
+	var cols []int
+	if len(names) == 0 {
+		for i := range t.Columns {
+			cols = append(cols, i)
+		}
+		return cols, nil
+	}
+	for _, name := range names {
+		i := t.columnIndex(name)
+		if i < 0 {
+			return nil, errors.NotFoundf("column %q", name)
+		}
+		cols = append(cols, i)
+	}
+	return cols, nil
+}
+
+func (t *Table) columnIndex(name string) int {
+	for i, col := range t.Columns {
+		if col.Name == name {
+			return i
+		}
+	}
+	for i, col := range t.Columns {
+		if strings.EqualFold(col.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// value returns the value in the given row and column.
+func value(row []interface{}, col int) interface{} {
+	if col < len(row) {
+		return row[col]
+	}
+	return nil
+}
+
+// text returns the text form of v.
+func text(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case fmt.Stringer:
+		return v.String()
+	}
+	return fmt.Sprint(v)
+}
+
+func (t *Table) writeText(w io.Writer, cols []int, options Options) error {
+	var lines [][]string
+	if !options.NoHeader {
+		var header []string
+		for _, col := range cols {
+			header = append(header, strings.ToUpper(t.Columns[col].Name))
+		}
+		lines = append(lines, header)
+	}
+	for _, row := range t.Rows {
+		var line []string
+		for _, col := range cols {
+			s := strings.Join(strings.Fields(text(value(row, col))), " ")
+			line = append(line, Truncate(s, options.MaxWidth))
+		}
+		lines = append(lines, line)
+	}
+
+	widths := make([]int, len(cols))
+	for _, line := range lines {
+		for i, s := range line {
+			if n := tty.StringWidth(s); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, line := range lines {
+		for i, s := range line {
+			pad := strings.Repeat(" ", widths[i]-tty.StringWidth(s))
+			if i > 0 {
+				buf.WriteString("  ")
+			}
+			if t.Columns[cols[i]].RightAlign {
+				buf.WriteString(pad + s)
+			} else {
+				buf.WriteString(s + pad)
+			}
+		}
+		// Trailing padding is just noise.
+		trimmed := bytes.TrimRight(buf.Bytes(), " ")
+		buf.Truncate(len(trimmed))
+		buf.WriteByte('\n')
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			return errors.Trace(err)
+		}
+		buf.Reset()
+	}
+	return nil
+}
+
+func (t *Table) writeCSV(w io.Writer, cols []int, comma rune, options Options) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+	if !options.NoHeader {
+		var header []string
+		for _, col := range cols {
+			header = append(header, t.Columns[col].Name)
+		}
+		cw.Write(header)
+	}
+	for _, row := range t.Rows {
+		var record []string
+		for _, col := range cols {
+			record = append(record, text(value(row, col)))
+		}
+		cw.Write(record)
+	}
+	cw.Flush()
+	return errors.Trace(cw.Error())
+}
+
+func (t *Table) writeJSON(w io.Writer, cols []int) error {
+	objects := make([]*orderedmap.Map[string, interface{}], 0, len(t.Rows))
+	for _, row := range t.Rows {
+		obj := orderedmap.New[string, interface{}]()
+		for _, col := range cols {
+			obj.Set(t.Columns[col].Name, value(row, col))
+		}
+		objects = append(objects, obj)
+	}
+	data, err := json.MarshalIndent(objects, "", "  ")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	_, err = w.Write(append(data, '\n'))
+	return errors.Trace(err)
+}
+
+// Truncate returns s shortened to take up at most width columns
+// on a terminal, ending with an ellipsis if it was truncated. If
+// width is not positive, s is returned unchanged.
+func Truncate(s string, width int) string {
+	return tty.Truncate(s, width)
+}
@@ -0,0 +1,167 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package table_test
+
+import (
+	"bytes"
+
+	"github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/table"
+)
+
+type tableSuite struct{}
+
+var _ = gc.Suite(&tableSuite{})
+
+func newTable() *table.Table {
+	t := &table.Table{
+		Columns: []table.Column{
+			{Name: "name"},
+			{Name: "size", RightAlign: true},
+			{Name: "notes"},
+		},
+	}
+	t.AddRow("agent.conf", 1024, "configuration")
+	t.AddRow("ünïcode", 7, "tabs\tand\nnewlines")
+	t.AddRow("machine.log", 123456, nil)
+	t.AddRow("short")
+	return t
+}
+
+var writeTests = []struct {
+	about   string
+	options table.Options
+	expect  string
+}{{
+	about:   "text",
+	options: table.Options{},
+	expect: `
+NAME           SIZE  NOTES
+agent.conf     1024  configuration
+ünïcode           7  tabs and newlines
+machine.log  123456
+short
+`[1:],
+}, {
+	about:   "text with selected columns and truncation",
+	options: table.Options{Format: table.Text, Columns: []string{"notes", "Name"}, MaxWidth: 8},
+	expect: `
+NOTES     NAME
+configu…  agent.c…
+tabs an…  ünïcode
+          machine…
+          short
+`[1:],
+}, {
+	about:   "text without header",
+	options: table.Options{Columns: []string{"size"}, NoHeader: true},
+	expect: `
+  1024
+     7
+123456
+
+`[1:],
+}, {
+	about:   "csv",
+	options: table.Options{Format: table.CSV, MaxWidth: 3},
+	expect: `
+name,size,notes
+agent.conf,1024,configuration
+ünïcode,7,"tabs	and
+newlines"
+machine.log,123456,
+short,,
+`[1:],
+}, {
+	about:   "tsv",
+	options: table.Options{Format: table.TSV, Columns: []string{"name", "notes"}, NoHeader: true},
+	expect: `
+agent.conf	configuration
+ünïcode	"tabs	and
+newlines"
+machine.log	
+short	
+`[1:],
+}, {
+	about:   "json",
+	options: table.Options{Format: table.JSON, Columns: []string{"size", "name"}},
+	expect: `
+[
+  {
+    "size": 1024,
+    "name": "agent.conf"
+  },
+  {
+    "size": 7,
+    "name": "ünïcode"
+  },
+  {
+    "size": 123456,
+    "name": "machine.log"
+  },
+  {
+    "size": null,
+    "name": "short"
+  }
+]
+`[1:],
+}}
+
+func (*tableSuite) TestWrite(c *gc.C) {
+	for i, test := range writeTests {
+		c.Logf("test %d: %s", i, test.about)
+		var buf bytes.Buffer
+		err := newTable().Write(&buf, test.options)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(buf.String(), gc.Equals, test.expect)
+	}
+}
+
+func (*tableSuite) TestWriteEmptyJSON(c *gc.C) {
+	var buf bytes.Buffer
+	err := table.New("a").Write(&buf, table.Options{Format: table.JSON})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(buf.String(), gc.Equals, "[]\n")
+}
+
+func (*tableSuite) TestString(c *gc.C) {
+	t := table.New("id", "status")
+	t.AddRow(0, "started")
+	c.Check(t.String(), gc.Equals, "ID  STATUS\n0   started\n")
+}
+
+func (*tableSuite) TestUnknownColumn(c *gc.C) {
+	err := newTable().Write(&bytes.Buffer{}, table.Options{Columns: []string{"name", "owner"}})
+	c.Check(err, gc.ErrorMatches, `column "owner" not found`)
+	c.Check(err, jc.Satisfies, errors.IsNotFound)
+}
+
+func (*tableSuite) TestInvalidFormat(c *gc.C) {
+	err := newTable().Write(&bytes.Buffer{}, table.Options{Format: "yaml"})
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+}
+
+func (*tableSuite) TestParseFormat(c *gc.C) {
+	for _, f := range table.Formats {
+		got, err := table.ParseFormat(string(f))
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(got, gc.Equals, f)
+	}
+	got, err := table.ParseFormat("CSV")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(got, gc.Equals, table.CSV)
+	_, err = table.ParseFormat("xml")
+	c.Check(err, gc.ErrorMatches, `format "xml" not valid`)
+}
+
+func (*tableSuite) TestTruncate(c *gc.C) {
+	c.Check(table.Truncate("hello", 0), gc.Equals, "hello")
+	c.Check(table.Truncate("hello", 5), gc.Equals, "hello")
+	c.Check(table.Truncate("hello", 4), gc.Equals, "hel…")
+	c.Check(table.Truncate("ünïcode", 3), gc.Equals, "ün…")
+	c.Check(table.Truncate("hello", 1), gc.Equals, "…")
+}
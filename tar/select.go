@@ -0,0 +1,204 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package tar
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+
+	"github.com/juju/utils/v3/errcode"
+	"github.com/juju/utils/v3/tracing"
+	"github.com/juju/utils/v3/vfs"
+)
+
+// EntryType describes the kind of an archive entry.
+type EntryType string
+
+// The types of entry reported by List.
+const (
+	TypeFile     EntryType = "file"
+	TypeDir      EntryType = "directory"
+	TypeSymlink  EntryType = "symlink"
+	TypeHardlink EntryType = "hardlink"
+	TypeOther    EntryType = "other"
+)
+
+// Entry describes an entry in a tar archive.
+type Entry struct {
+	// Path holds the cleaned, slash separated path of the entry.
+	Path string
+
+	// Type holds the kind of entry.
+	Type EntryType
+
+	// Size holds the size of the entry's contents in bytes.
+	Size int64
+
+	// Mode holds the permission bits of the entry, along with
+	// the type bits for directories and symlinks.
+	Mode os.FileMode
+
+	// Linkname holds the target of a symlink or hard link.
+	Linkname string
+
+	// ModTime holds the modification time of the entry.
+	ModTime time.Time
+}
+
+// List returns the entries in tarFile without extracting them.
+func List(tarFile io.Reader) ([]Entry, error) {
+	tr := tar.NewReader(tarFile)
+	var entries []Entry
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, errcode.Wrap(errcode.ErrCorrupt, fmt.Errorf("failed while reading tar header: %w", err))
+		}
+		entries = append(entries, Entry{
+			Path:     cleanPath(hdr.Name),
+			Type:     entryType(hdr.Typeflag),
+			Size:     hdr.Size,
+			Mode:     hdr.FileInfo().Mode(),
+			Linkname: hdr.Linkname,
+			ModTime:  hdr.ModTime,
+		})
+	}
+}
+
+func entryType(flag byte) EntryType {
+	switch flag {
+	case tar.TypeReg, tar.TypeRegA:
+		return TypeFile
+	case tar.TypeDir:
+		return TypeDir
+	case tar.TypeSymlink:
+		return TypeSymlink
+	case tar.TypeLink:
+		return TypeHardlink
+	}
+	return TypeOther
+}
+
+// ExtractOptions selects the entries extracted by ExtractSelected.
+type ExtractOptions struct {
+	// Patterns, if not empty, restricts extraction to entries whose
+	// paths match at least one of the patterns, as interpreted by
+	// path.Match. An entry is also extracted if a pattern matches
+	// any of its parent directories, so "etc/*" extracts everything
+	// beneath etc.
+	Patterns []string
+
+	// Prefix, if not empty, restricts extraction to the entry with
+	// that path and everything beneath it.
+	Prefix string
+
+	// StripComponents removes that many leading path elements from
+	// each entry before extraction, as tar's --strip-components does.
+	// Entries with no elements left are skipped.
+	StripComponents int
+
+	// Tracer, if set, reports the extraction as
+	// a "tar.extract" span.
+	Tracer tracing.Tracer
+}
+
+// ExtractSelected extracts the entries of tarFile selected by options
+// into outputFolder. It returns an error satisfying errors.IsNotFound
+// if Patterns or Prefix were given but no entries were extracted.
+// Entries with paths leading out of outputFolder cause an error, as do
+// symlinks that are absolute or lead out of outputFolder, and entries
+// that would be written through a symlink.
+func ExtractSelected(tarFile io.Reader, outputFolder string, options ExtractOptions) error {
+	return ExtractSelectedFS(vfs.OS, tarFile, outputFolder, options)
+}
+
+// ExtractSelectedFS is like ExtractSelected but writes the files to fsys.
+func ExtractSelectedFS(fsys vfs.FS, tarFile io.Reader, outputFolder string, options ExtractOptions) (err error) {
+	_, span := tracing.Start(options.Tracer, context.Background(), "tar.extract",
+		tracing.String("tar.output", outputFolder),
+	)
+	defer func() { span.End(err) }()
+	for _, pattern := range options.Patterns {
+		if _, err := path.Match(pattern, "check"); err != nil {
+			return errors.Annotatef(err, "invalid pattern %q", pattern)
+		}
+	}
+	n, err := untar(fsys, tarFile, outputFolder, true, func(hdr *tar.Header) (string, bool, error) {
+		return options.target(hdr.Name)
+	})
+	span.SetAttributes(tracing.Int("tar.entries", int64(n)))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if n == 0 && (len(options.Patterns) > 0 || options.Prefix != "") {
+		return errors.NotFoundf("entries matching %s", options.describe())
+	}
+	return nil
+}
+
+// target returns the path to which the entry with the given
+// name is extracted, and whether it is selected.
+func (o ExtractOptions) target(name string) (string, bool, error) {
+	p := cleanPath(name)
+	if p == "." || !o.selects(p) {
+		return "", false, nil
+	}
+	if p == ".." || strings.HasPrefix(p, "../") {
+		return "", false, errcode.Errorf(errcode.ErrUnsafePath, "entry %q leads out of scope", name)
+	}
+	parts := strings.Split(p, "/")
+	if len(parts) <= o.StripComponents {
+		return "", false, nil
+	}
+	return path.Join(parts[o.StripComponents:]...), true, nil
+}
+
+// selects reports whether the entry with the cleaned path p
+// is selected by the options.
+func (o ExtractOptions) selects(p string) bool {
+	if prefix := cleanPath(o.Prefix); prefix != "." {
+		if p != prefix && !strings.HasPrefix(p, prefix+"/") {
+			return false
+		}
+	}
+	if len(o.Patterns) == 0 {
+		return true
+	}
+	for dir := p; dir != "." && dir != "/"; dir = path.Dir(dir) {
+		for _, pattern := range o.Patterns {
+			if ok, _ := path.Match(pattern, dir); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (o ExtractOptions) describe() string {
+	var parts []string
+	if o.Prefix != "" {
+		parts = append(parts, fmt.Sprintf("prefix %q", o.Prefix))
+	}
+	if len(o.Patterns) > 0 {
+		parts = append(parts, fmt.Sprintf("patterns %q", o.Patterns))
+	}
+	return strings.Join(parts, " and ")
+}
+
+// cleanPath returns the cleaned form of an entry name,
+// relative to the root of the archive.
+func cleanPath(name string) string {
+	return path.Clean(strings.TrimLeft(name, "/"))
+}
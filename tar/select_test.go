@@ -0,0 +1,270 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package tar
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/errcode"
+	"github.com/juju/utils/v3/tracing"
+	"github.com/juju/utils/v3/vfs"
+)
+
+type SelectSuite struct{}
+
+var _ = gc.Suite(&SelectSuite{})
+
+var modTime = time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// backupTar returns a tar archive laid out like a backup.
+func backupTar(c *gc.C) *bytes.Buffer {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	write := func(hdr *tar.Header, data string) {
+		hdr.ModTime = modTime
+		hdr.Size = int64(len(data))
+		c.Assert(tw.WriteHeader(hdr), jc.ErrorIsNil)
+		_, err := tw.Write([]byte(data))
+		c.Assert(err, jc.ErrorIsNil)
+	}
+	write(&tar.Header{Name: "backup/", Typeflag: tar.TypeDir, Mode: 0755}, "")
+	write(&tar.Header{Name: "backup/etc/", Typeflag: tar.TypeDir, Mode: 0755}, "")
+	write(&tar.Header{Name: "backup/etc/agent.conf", Typeflag: tar.TypeReg, Mode: 0600}, "agent")
+	write(&tar.Header{Name: "backup/etc/juju/db.yaml", Typeflag: tar.TypeReg, Mode: 0644}, "db: true")
+	write(&tar.Header{Name: "backup/etc/current", Typeflag: tar.TypeSymlink, Linkname: "agent.conf", Mode: 0777}, "")
+	write(&tar.Header{Name: "/backup/var/log/machine.log", Typeflag: tar.TypeReg, Mode: 0640}, "log data")
+	write(&tar.Header{Name: "backup/var/log/copy.log", Typeflag: tar.TypeLink, Linkname: "backup/var/log/machine.log"}, "")
+	c.Assert(tw.Close(), jc.ErrorIsNil)
+	return &buf
+}
+
+func (*SelectSuite) TestList(c *gc.C) {
+	entries, err := List(backupTar(c))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(entries, jc.DeepEquals, []Entry{
+		{Path: "backup", Type: TypeDir, Mode: os.ModeDir | 0755, ModTime: modTime},
+		{Path: "backup/etc", Type: TypeDir, Mode: os.ModeDir | 0755, ModTime: modTime},
+		{Path: "backup/etc/agent.conf", Type: TypeFile, Size: 5, Mode: 0600, ModTime: modTime},
+		{Path: "backup/etc/juju/db.yaml", Type: TypeFile, Size: 8, Mode: 0644, ModTime: modTime},
+		{Path: "backup/etc/current", Type: TypeSymlink, Mode: os.ModeSymlink | 0777, Linkname: "agent.conf", ModTime: modTime},
+		{Path: "backup/var/log/machine.log", Type: TypeFile, Size: 8, Mode: 0640, ModTime: modTime},
+		{Path: "backup/var/log/copy.log", Type: TypeHardlink, Linkname: "backup/var/log/machine.log", ModTime: modTime},
+	})
+}
+
+func (*SelectSuite) TestListInvalid(c *gc.C) {
+	_, err := List(bytes.NewBufferString("not a tar file at all, but long enough to hold some kind of header, or so one would hope......................................................................................................................................................................................................................................................................................................................................................................................................................................................................................................"))
+	c.Check(err, gc.ErrorMatches, "failed while reading tar header: .*")
+}
+
+var extractTests = []struct {
+	about   string
+	options ExtractOptions
+	expect  []string
+}{{
+	about:   "everything",
+	options: ExtractOptions{},
+	expect: []string{
+		"/out/backup/",
+		"/out/backup/etc/",
+		"/out/backup/etc/agent.conf",
+		"/out/backup/etc/current",
+		"/out/backup/etc/juju/",
+		"/out/backup/etc/juju/db.yaml",
+		"/out/backup/var/",
+		"/out/backup/var/log/",
+		"/out/backup/var/log/machine.log",
+	},
+}, {
+	about:   "single file with strip",
+	options: ExtractOptions{Patterns: []string{"backup/etc/agent.conf"}, StripComponents: 2},
+	expect:  []string{"/out/agent.conf"},
+}, {
+	about:   "pattern matching directory",
+	options: ExtractOptions{Patterns: []string{"*/etc/j*"}},
+	expect: []string{
+		"/out/backup/",
+		"/out/backup/etc/",
+		"/out/backup/etc/juju/",
+		"/out/backup/etc/juju/db.yaml",
+	},
+}, {
+	about:   "several patterns",
+	options: ExtractOptions{Patterns: []string{"backup/etc/*.conf", "*/*/log/*.log"}, StripComponents: 1},
+	expect: []string{
+		"/out/etc/",
+		"/out/etc/agent.conf",
+		"/out/var/",
+		"/out/var/log/",
+		"/out/var/log/machine.log",
+	},
+}, {
+	about:   "prefix",
+	options: ExtractOptions{Prefix: "backup/etc/", StripComponents: 2},
+	expect: []string{
+		"/out/agent.conf",
+		"/out/current",
+		"/out/juju/",
+		"/out/juju/db.yaml",
+	},
+}, {
+	about:   "prefix and pattern",
+	options: ExtractOptions{Prefix: "/backup/etc", Patterns: []string{"*/*/*/*.yaml"}, StripComponents: 2},
+	expect:  []string{"/out/juju/", "/out/juju/db.yaml"},
+}}
+
+func (*SelectSuite) TestExtractSelected(c *gc.C) {
+	for i, test := range extractTests {
+		c.Logf("test %d: %s", i, test.about)
+		fsys := vfs.NewMemFS()
+		err := ExtractSelectedFS(fsys, backupTar(c), "/out", test.options)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(walk(c, fsys, "/out"), jc.DeepEquals, test.expect)
+	}
+}
+
+func (*SelectSuite) TestExtractSelectedTracing(c *gc.C) {
+	var rec tracing.Recorder
+	err := ExtractSelectedFS(vfs.NewMemFS(), backupTar(c), "/out", ExtractOptions{
+		Prefix: "nowhere",
+		Tracer: &rec,
+	})
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+
+	spans := rec.Spans()
+	c.Assert(rec.Names(), jc.DeepEquals, []string{"tar.extract"})
+	c.Check(spans[0].Attribute("tar.output"), gc.Equals, "/out")
+	c.Check(spans[0].Attribute("tar.entries"), gc.Equals, int64(0))
+	c.Check(spans[0].Err, gc.Equals, err)
+}
+
+func (*SelectSuite) TestExtractSelectedContents(c *gc.C) {
+	fsys := vfs.NewMemFS()
+	err := ExtractSelectedFS(fsys, backupTar(c), "/out", ExtractOptions{
+		Prefix:          "backup/etc",
+		StripComponents: 2,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	data, err := vfs.ReadFile(fsys, "/out/agent.conf")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(data), gc.Equals, "agent")
+	info, err := fsys.Stat("/out/agent.conf")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(info.Mode().Perm(), gc.Equals, os.FileMode(0600))
+	target, err := fsys.Readlink("/out/current")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(target, gc.Equals, "agent.conf")
+}
+
+func (*SelectSuite) TestExtractSelectedToDisk(c *gc.C) {
+	dir := c.MkDir()
+	err := ExtractSelected(backupTar(c), dir, ExtractOptions{Patterns: []string{"*/*/juju/db.yaml"}, StripComponents: 3})
+	c.Assert(err, jc.ErrorIsNil)
+	data, err := os.ReadFile(path.Join(dir, "db.yaml"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(data), gc.Equals, "db: true")
+}
+
+func (*SelectSuite) TestExtractSelectedNoMatch(c *gc.C) {
+	err := ExtractSelectedFS(vfs.NewMemFS(), backupTar(c), "/out", ExtractOptions{
+		Prefix:   "backup/etc",
+		Patterns: []string{"*.json"},
+	})
+	c.Check(err, gc.ErrorMatches, `entries matching prefix "backup/etc" and patterns \["\*.json"\] not found`)
+	c.Check(err, jc.Satisfies, errors.IsNotFound)
+}
+
+func (*SelectSuite) TestExtractSelectedStripsEverything(c *gc.C) {
+	err := ExtractSelectedFS(vfs.NewMemFS(), backupTar(c), "/out", ExtractOptions{
+		Patterns:        []string{"backup/etc/agent.conf"},
+		StripComponents: 3,
+	})
+	c.Check(err, jc.Satisfies, errors.IsNotFound)
+}
+
+func (*SelectSuite) TestExtractSelectedInvalidPattern(c *gc.C) {
+	err := ExtractSelectedFS(vfs.NewMemFS(), backupTar(c), "/out", ExtractOptions{Patterns: []string{"["}})
+	c.Check(err, gc.ErrorMatches, `invalid pattern "\[": syntax error in pattern`)
+}
+
+func (*SelectSuite) TestExtractSelectedOutOfScope(c *gc.C) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	c.Assert(tw.WriteHeader(&tar.Header{Name: "a/../../evil", Typeflag: tar.TypeReg}), jc.ErrorIsNil)
+	c.Assert(tw.Close(), jc.ErrorIsNil)
+
+	err := ExtractSelectedFS(vfs.NewMemFS(), &buf, "/out", ExtractOptions{})
+	c.Check(err, gc.ErrorMatches, `entry "a/../../evil" leads out of scope`)
+	c.Check(errcode.Of(err), gc.Equals, errcode.ErrUnsafePath)
+}
+
+// symlinkTar returns a tar archive holding a symlink named "a" to
+// linkname, followed by a file "a/pwned".
+func symlinkTar(c *gc.C, linkname string) *bytes.Buffer {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	c.Assert(tw.WriteHeader(&tar.Header{Name: "b/", Typeflag: tar.TypeDir, Mode: 0755}), jc.ErrorIsNil)
+	c.Assert(tw.WriteHeader(&tar.Header{Name: "a", Typeflag: tar.TypeSymlink, Linkname: linkname, Mode: 0777}), jc.ErrorIsNil)
+	c.Assert(tw.WriteHeader(&tar.Header{Name: "a/pwned", Typeflag: tar.TypeReg, Mode: 0644, Size: 5}), jc.ErrorIsNil)
+	_, err := tw.Write([]byte("pwned"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(tw.Close(), jc.ErrorIsNil)
+	return &buf
+}
+
+func (*SelectSuite) TestExtractSelectedAbsoluteSymlink(c *gc.C) {
+	outside := c.MkDir()
+	dir := c.MkDir()
+	err := ExtractSelected(symlinkTar(c, outside), dir, ExtractOptions{})
+	c.Check(err, gc.ErrorMatches, `symlink "a" to ".*" is absolute`)
+	c.Check(errcode.Of(err), gc.Equals, errcode.ErrUnsafePath)
+	_, err = os.Lstat(path.Join(outside, "pwned"))
+	c.Check(err, jc.Satisfies, os.IsNotExist)
+}
+
+func (*SelectSuite) TestExtractSelectedEscapingSymlink(c *gc.C) {
+	err := ExtractSelectedFS(vfs.NewMemFS(), symlinkTar(c, "b/../.."), "/out", ExtractOptions{})
+	c.Check(err, gc.ErrorMatches, `symlink "a" to "b/../.." leads out of scope`)
+	c.Check(errcode.Of(err), gc.Equals, errcode.ErrUnsafePath)
+}
+
+func (*SelectSuite) TestExtractSelectedThroughSymlink(c *gc.C) {
+	// Even a symlink that stays in scope is not written through.
+	fsys := vfs.NewMemFS()
+	err := ExtractSelectedFS(fsys, symlinkTar(c, "b"), "/out", ExtractOptions{})
+	c.Check(err, gc.ErrorMatches, `entry "a/pwned" would be written through symlink "/out/a"`)
+	c.Check(errcode.Of(err), gc.Equals, errcode.ErrUnsafePath)
+	c.Check(walk(c, fsys, "/out"), jc.DeepEquals, []string{"/out/a", "/out/b/"})
+}
+
+// walk returns the paths of everything beneath dir in fsys,
+// with a trailing slash on directories.
+func walk(c *gc.C, fsys vfs.FS, dir string) []string {
+	infos, err := fsys.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	c.Assert(err, jc.ErrorIsNil)
+	var paths []string
+	for _, info := range infos {
+		p := path.Join(dir, info.Name())
+		if info.IsDir() {
+			paths = append(paths, p+"/")
+			paths = append(paths, walk(c, fsys, p)...)
+		} else {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
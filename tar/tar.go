@@ -8,18 +8,26 @@ package tar
 
 import (
 	"archive/tar"
+	"context"
 	"crypto/sha1"
 	"encoding/base64"
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/juju/errors"
 
 	"github.com/juju/collections/set"
+	"github.com/juju/utils/v3"
+	"github.com/juju/utils/v3/errcode"
 	"github.com/juju/utils/v3/symlink"
+	"github.com/juju/utils/v3/tracing"
+	"github.com/juju/utils/v3/vfs"
 )
 
 // FindFile returns the header and ReadCloser for the entry in the
@@ -55,18 +63,70 @@ func FindFile(tarFile io.Reader, filename string) (*tar.Header, io.Reader, error
 // however at least the bytes up to the inital size are written
 // successfully if no error is returned.
 func TarFiles(fileList []string, target io.Writer, strip string) (shaSum string, err error) {
+	return TarFilesFS(vfs.OS, fileList, target, strip)
+}
+
+// TarFilesFS is like TarFiles but reads the files from fsys.
+func TarFilesFS(fsys vfs.FS, fileList []string, target io.Writer, strip string) (shaSum string, err error) {
+	return TarFilesWithOptions(fileList, target, strip, Options{FS: fsys})
+}
+
+// Options holds options for TarFilesWithOptions.
+type Options struct {
+	// FS holds the file system the files are read from.
+	// If it is nil, vfs.OS is used.
+	FS vfs.FS
+
+	// Reproducible specifies that identical inputs always produce
+	// byte-identical archives, whenever and by whoever they are
+	// created. The files and directory contents are written in
+	// sorted order, every entry is given the time in ModTime, and
+	// owner names and ids are cleared.
+	Reproducible bool
+
+	// ModTime holds the modification time given to every entry
+	// of a reproducible archive. If it is zero, the Unix epoch
+	// is used.
+	ModTime time.Time
+
+	// Tracer, if set, reports the creation of the archive
+	// as a "tar.create" span.
+	Tracer tracing.Tracer
+}
+
+// TarFilesWithOptions is like TarFiles but takes options
+// controlling how the archive is made.
+func TarFilesWithOptions(fileList []string, target io.Writer, strip string, options Options) (shaSum string, err error) {
+	_, span := tracing.Start(options.Tracer, context.Background(), "tar.create",
+		tracing.Int("tar.files", int64(len(fileList))),
+		tracing.Bool("tar.reproducible", options.Reproducible),
+	)
+	defer func() { span.End(err) }()
+	if options.FS == nil {
+		options.FS = vfs.OS
+	}
+	if options.Reproducible {
+		if options.ModTime.IsZero() {
+			options.ModTime = time.Unix(0, 0)
+		}
+		options.ModTime = options.ModTime.Truncate(time.Second)
+		fileList = append([]string(nil), fileList...)
+		sort.Strings(fileList)
+	}
 	shahash := sha1.New()
-	if err := tarAndHashFiles(fileList, target, strip, shahash); err != nil {
+	counter := utils.NewCountingWriter(shahash)
+	if err := tarAndHashFiles(options, fileList, target, strip, counter); err != nil {
 		return "", err
 	}
+	span.SetAttributes(tracing.Int("tar.bytes", counter.Count()))
 	encodedHash := base64.StdEncoding.EncodeToString(shahash.Sum(nil))
 	return encodedHash, nil
 }
 
-func tarAndHashFiles(fileList []string, target io.Writer, strip string, hashw io.Writer) (err error) {
+func tarAndHashFiles(options Options, fileList []string, target io.Writer, strip string, hashw io.Writer) (err error) {
 	checkClose := func(w io.Closer) {
 		if closeErr := w.Close(); closeErr != nil && err == nil {
-			err = fmt.Errorf("error closing tar writer: %v", closeErr)
+			err = fmt.Errorf("error closing tar writer: %w", closeErr)
 		}
 	}
 
@@ -74,8 +134,8 @@ func tarAndHashFiles(fileList []string, target io.Writer, strip string, hashw io
 	tarw := tar.NewWriter(w)
 	defer checkClose(tarw)
 	for _, ent := range fileList {
-		if err := writeContents(ent, strip, tarw); err != nil {
-			return fmt.Errorf("write to tar file failed: %v", err)
+		if err := writeContents(options, ent, strip, tarw); err != nil {
+			return fmt.Errorf("write to tar file failed: %w", err)
 		}
 	}
 	return nil
@@ -83,33 +143,37 @@ func tarAndHashFiles(fileList []string, target io.Writer, strip string, hashw io
 
 // writeContents creates an entry for the given file
 // or directory in the given tar archive.
-func writeContents(fileName, strip string, tarw *tar.Writer) error {
-	f, err := os.Open(fileName)
+func writeContents(options Options, fileName, strip string, tarw *tar.Writer) error {
+	fsys := options.FS
+	f, err := fsys.Open(fileName)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
-	fInfo, err := os.Lstat(fileName)
+	fInfo, err := fsys.Lstat(fileName)
 	if err != nil {
 		return err
 	}
 	link := ""
 
 	if fInfo.Mode()&os.ModeSymlink == os.ModeSymlink {
-		link, err = filepath.EvalSymlinks(fileName)
+		link, err = vfs.EvalSymlinks(fsys, fileName)
 
 		if err != nil {
-			return fmt.Errorf("cannnot dereference symlink: %v", err)
+			return fmt.Errorf("cannnot dereference symlink: %w", err)
 		}
 
 	}
 	h, err := tar.FileInfoHeader(fInfo, link)
 	if err != nil {
-		return fmt.Errorf("cannot create tar header for %q: %v", fileName, err)
+		return fmt.Errorf("cannot create tar header for %q: %w", fileName, err)
 	}
 	h.Name = filepath.ToSlash(strings.TrimPrefix(fileName, strip))
+	if options.Reproducible {
+		normaliseHeader(h, options.ModTime)
+	}
 	if err := tarw.WriteHeader(h); err != nil {
-		return fmt.Errorf("cannot write header for %q: %v", fileName, err)
+		return fmt.Errorf("cannot write header for %q: %w", fileName, err)
 	}
 	if fInfo.Mode()&os.ModeSymlink == os.ModeSymlink {
 		return nil
@@ -118,49 +182,62 @@ func writeContents(fileName, strip string, tarw *tar.Writer) error {
 		// Limit data copied to inital stat size included in tar header
 		// or ErrWriteTooLong is raised by archive/tar Writer.
 		if _, err := io.CopyN(tarw, f, fInfo.Size()); err != nil {
-			return fmt.Errorf("failed to write %q: %v", fileName, err)
+			return fmt.Errorf("failed to write %q: %w", fileName, err)
 		}
 		return nil
 	}
 
-	for {
-		names, err := f.Readdirnames(100)
-		// will return at most 100 names and if less than 100 remaining
-		// next call will return io.EOF and no names
-		if err == io.EOF {
-			return nil
-		}
-		if err != nil {
-			return fmt.Errorf("error reading directory %q: %v", fileName, err)
-		}
-		for _, name := range names {
-			if err := writeContents(filepath.Join(fileName, name), strip, tarw); err != nil {
-				return err
-			}
+	entries, err := fsys.ReadDir(fileName)
+	if err != nil {
+		return fmt.Errorf("error reading directory %q: %w", fileName, err)
+	}
+	if options.Reproducible {
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].Name() < entries[j].Name()
+		})
+	}
+	for _, entry := range entries {
+		if err := writeContents(options, filepath.Join(fileName, entry.Name()), strip, tarw); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
+// normaliseHeader removes everything from h that depends on when
+// or by whom the archive was made.
+func normaliseHeader(h *tar.Header, modTime time.Time) {
+	h.ModTime = modTime
+	h.AccessTime = time.Time{}
+	h.ChangeTime = time.Time{}
+	h.Uid, h.Gid = 0, 0
+	h.Uname, h.Gname = "", ""
+	h.Devmajor, h.Devminor = 0, 0
+	h.PAXRecords = nil
+	// Choosing the format explicitly stops it varying with
+	// the values in the header, such as long names.
+	h.Format = tar.FormatPAX
 }
 
-func createAndFill(filePath string, mode int64, content io.Reader) error {
-	fh, err := os.Create(filePath)
-	defer fh.Close()
+func createAndFill(fsys vfs.FS, filePath string, mode int64, content io.Reader) error {
+	fh, err := fsys.Create(filePath)
 	if err != nil {
-		return fmt.Errorf("some of the tar contents cannot be written to disk: %v", err)
+		return fmt.Errorf("some of the tar contents cannot be written to disk: %w", err)
 	}
+	defer fh.Close()
 	_, err = io.Copy(fh, content)
 	if err != nil {
-		return fmt.Errorf("failed while reading tar contents: %v", err)
+		return fmt.Errorf("failed while reading tar contents: %w", err)
 	}
-	err = os.Chmod(fh.Name(), os.FileMode(mode))
+	err = fsys.Chmod(fh.Name(), os.FileMode(mode))
 	if err != nil {
-		return fmt.Errorf("cannot set proper mode on file %q: %v", filePath, err)
+		return fmt.Errorf("cannot set proper mode on file %q: %w", filePath, err)
 	}
 	if err := fh.Sync(); err != nil {
-		return fmt.Errorf("failed to sync contents of file %v: %v", filePath, err)
+		return fmt.Errorf("failed to sync contents of file %v: %w", filePath, err)
 	}
 	if err := fh.Close(); err != nil {
-		return fmt.Errorf("failed to close file %v: %v", filePath, err)
+		return fmt.Errorf("failed to close file %v: %w", filePath, err)
 	}
 	return nil
 }
@@ -168,6 +245,24 @@ func createAndFill(filePath string, mode int64, content io.Reader) error {
 // UntarFiles will extract the contents of tarFile using
 // outputFolder as root
 func UntarFiles(tarFile io.Reader, outputFolder string) error {
+	return UntarFilesFS(vfs.OS, tarFile, outputFolder)
+}
+
+// UntarFilesFS is like UntarFiles but writes the files to fsys.
+func UntarFilesFS(fsys vfs.FS, tarFile io.Reader, outputFolder string) error {
+	_, err := untar(fsys, tarFile, outputFolder, false, func(hdr *tar.Header) (string, bool, error) {
+		return hdr.Name, true, nil
+	})
+	return err
+}
+
+// untar extracts the contents of tarFile into outputFolder. The
+// target function returns the path, relative to outputFolder, to
+// which an entry is extracted and whether it should be extracted
+// at all. If confine is true, symlinks that lead out of outputFolder
+// are rejected, as are entries that would be written through a
+// symlink. It returns the number of entries extracted.
+func untar(fsys vfs.FS, tarFile io.Reader, outputFolder string, confine bool, target func(*tar.Header) (string, bool, error)) (int, error) {
 	tr := tar.NewReader(tarFile)
 	// Ensure we still make directories for any files where we haven't
 	// already seen the directory (for example, juju backup generates
@@ -179,47 +274,104 @@ func UntarFiles(tarFile io.Reader, outputFolder string) error {
 		if seenDirs.Contains(dirName) {
 			return nil
 		}
-		err := os.MkdirAll(dirName, os.FileMode(0755))
+		err := fsys.MkdirAll(dirName, os.FileMode(0755))
 		if err != nil {
-			return fmt.Errorf("cannot create parent directory for %q: %v", path, err)
+			return fmt.Errorf("cannot create parent directory for %q: %w", path, err)
 		}
 		seenDirs.Add(dirName)
 		return nil
 	}
 
+	extracted := 0
 	for {
 		hdr, err := tr.Next()
 		if err == io.EOF {
 			// end of tar archive
-			return nil
+			return extracted, nil
 		}
 		if err != nil {
-			return fmt.Errorf("failed while reading tar header: %v", err)
+			return extracted, errcode.Wrap(errcode.ErrCorrupt, fmt.Errorf("failed while reading tar header: %w", err))
+		}
+		name, ok, err := target(hdr)
+		if err != nil {
+			return extracted, err
+		}
+		if !ok {
+			continue
+		}
+		fullPath := filepath.Join(outputFolder, name)
+		if confine {
+			if err := checkConfined(fsys, outputFolder, name, hdr); err != nil {
+				return extracted, err
+			}
 		}
-		fullPath := filepath.Join(outputFolder, hdr.Name)
 		switch hdr.Typeflag {
 		case tar.TypeDir:
-			if err = os.MkdirAll(fullPath, os.FileMode(hdr.Mode)); err != nil {
-				return fmt.Errorf("cannot extract directory %q: %v", fullPath, err)
+			if err = fsys.MkdirAll(fullPath, os.FileMode(hdr.Mode)); err != nil {
+				return extracted, fmt.Errorf("cannot extract directory %q: %w", fullPath, err)
 			}
 			seenDirs.Add(fullPath)
 
 		case tar.TypeSymlink:
 			if err = maybeMkParentDir(fullPath); err != nil {
-				return err
+				return extracted, err
 			}
-			if err = symlink.New(hdr.Linkname, fullPath); err != nil {
-				return fmt.Errorf("cannot extract symlink %q to %q: %v", hdr.Linkname, fullPath, err)
+			if err = newSymlink(fsys, hdr.Linkname, fullPath); err != nil {
+				return extracted, fmt.Errorf("cannot extract symlink %q to %q: %w", hdr.Linkname, fullPath, err)
 			}
-			continue
 
 		case tar.TypeReg, tar.TypeRegA:
 			if err = maybeMkParentDir(fullPath); err != nil {
-				return err
+				return extracted, err
 			}
-			if err = createAndFill(fullPath, hdr.Mode, tr); err != nil {
-				return fmt.Errorf("cannot extract file %q: %v", fullPath, err)
+			if err = createAndFill(fsys, fullPath, hdr.Mode, tr); err != nil {
+				return extracted, fmt.Errorf("cannot extract file %q: %w", fullPath, err)
 			}
+
+		default:
+			continue
+		}
+		extracted++
+	}
+}
+
+// checkConfined returns an error if extracting the entry described by
+// hdr to the slash-separated path name within outputFolder would write
+// outside outputFolder, either because the entry is a symlink leading
+// out of it, or because the entry would be written through a symlink.
+func checkConfined(fsys vfs.FS, outputFolder, name string, hdr *tar.Header) error {
+	if hdr.Typeflag == tar.TypeSymlink {
+		if path.IsAbs(hdr.Linkname) || filepath.IsAbs(hdr.Linkname) {
+			return errcode.Errorf(errcode.ErrUnsafePath, "symlink %q to %q is absolute", hdr.Name, hdr.Linkname)
+		}
+		p := path.Join(path.Dir(name), filepath.ToSlash(hdr.Linkname))
+		if p == ".." || strings.HasPrefix(p, "../") {
+			return errcode.Errorf(errcode.ErrUnsafePath, "symlink %q to %q leads out of scope", hdr.Name, hdr.Linkname)
+		}
+	}
+	p := outputFolder
+	for _, part := range strings.Split(name, "/") {
+		p = filepath.Join(p, part)
+		info, err := fsys.Lstat(p)
+		if os.IsNotExist(err) {
+			return nil
 		}
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return errcode.Errorf(errcode.ErrUnsafePath, "entry %q would be written through symlink %q", hdr.Name, p)
+		}
+	}
+	return nil
+}
+
+// newSymlink creates a symbolic link in fsys, using symlink.New
+// for the operating system so that Windows links are created
+// correctly.
+func newSymlink(fsys vfs.FS, oldname, newname string) error {
+	if fsys == vfs.OS {
+		return symlink.New(oldname, newname)
 	}
+	return fsys.Symlink(oldname, newname)
 }
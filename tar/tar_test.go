@@ -15,10 +15,14 @@ import (
 	"path/filepath"
 	"strings"
 	stdtesting "testing"
+	"time"
 
 	"github.com/juju/testing"
 	jc "github.com/juju/testing/checkers"
 	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/tracing"
+	"github.com/juju/utils/v3/vfs"
 )
 
 func TestPackage(t *stdtesting.T) {
@@ -351,3 +355,121 @@ func (t *TarSuite) TestUntarFilesWithMissingDirectories(c *gc.C) {
 	}
 	c.Assert(names, gc.DeepEquals, expected)
 }
+
+func (t *TarSuite) TestTarUntarMemFS(c *gc.C) {
+	fsys := vfs.NewMemFS()
+	c.Assert(fsys.MkdirAll("/src/dir", 0755), jc.ErrorIsNil)
+	c.Assert(vfs.WriteFile(fsys, "/src/dir/file", []byte("contents"), 0640), jc.ErrorIsNil)
+	c.Assert(fsys.Symlink("file", "/src/dir/link"), jc.ErrorIsNil)
+
+	var outputTar bytes.Buffer
+	_, err := TarFilesFS(fsys, []string{"/src/dir"}, &outputTar, "/src/")
+	c.Assert(err, jc.ErrorIsNil)
+
+	err = UntarFilesFS(fsys, &outputTar, "/dst")
+	c.Assert(err, jc.ErrorIsNil)
+	data, err := vfs.ReadFile(fsys, "/dst/dir/file")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(data), gc.Equals, "contents")
+	info, err := fsys.Stat("/dst/dir/file")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(info.Mode().Perm(), gc.Equals, os.FileMode(0640))
+	target, err := fsys.Readlink("/dst/dir/link")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(target, gc.Equals, "/src/dir/file")
+
+	// Nothing was written to disk.
+	_, err = os.Stat("/dst")
+	c.Check(os.IsNotExist(err), jc.IsTrue)
+}
+
+func (t *TarSuite) TestTarFilesTracing(c *gc.C) {
+	fsys := vfs.NewMemFS()
+	c.Assert(fsys.MkdirAll("/src", 0755), jc.ErrorIsNil)
+	c.Assert(vfs.WriteFile(fsys, "/src/file", []byte("contents"), 0644), jc.ErrorIsNil)
+	var rec tracing.Recorder
+	var buf bytes.Buffer
+	_, err := TarFilesWithOptions([]string{"/src/file"}, &buf, "/src/", Options{
+		FS:     fsys,
+		Tracer: &rec,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	spans := rec.Spans()
+	c.Assert(rec.Names(), jc.DeepEquals, []string{"tar.create"})
+	c.Check(spans[0].Attribute("tar.files"), gc.Equals, int64(1))
+	c.Check(spans[0].Attribute("tar.bytes"), gc.Equals, int64(buf.Len()))
+	c.Check(spans[0].Ended, jc.IsTrue)
+	c.Check(spans[0].Err, jc.ErrorIsNil)
+
+	_, err = TarFilesWithOptions([]string{"/src/missing"}, &buf, "/src/", Options{
+		FS:     fsys,
+		Tracer: &rec,
+	})
+	c.Assert(err, gc.NotNil)
+	spans = rec.Spans()
+	c.Assert(spans, gc.HasLen, 2)
+	c.Check(spans[1].Err, gc.Equals, err)
+}
+
+func (t *TarSuite) TestTarFilesReproducible(c *gc.C) {
+	// makeTree creates the same tree in a new file system,
+	// creating the files in the given order.
+	makeTree := func(names ...string) vfs.FS {
+		fsys := vfs.NewMemFS()
+		c.Assert(fsys.MkdirAll("/src/dir", 0755), jc.ErrorIsNil)
+		for _, name := range names {
+			c.Assert(vfs.WriteFile(fsys, "/src/"+name, []byte("contents of "+name), 0644), jc.ErrorIsNil)
+		}
+		return fsys
+	}
+	tarTree := func(fsys vfs.FS, files ...string) ([]byte, string) {
+		var buf bytes.Buffer
+		sum, err := TarFilesWithOptions(files, &buf, "/src/", Options{
+			FS:           fsys,
+			Reproducible: true,
+		})
+		c.Assert(err, jc.ErrorIsNil)
+		return buf.Bytes(), sum
+	}
+	data1, sum1 := tarTree(makeTree("b", "dir/z", "dir/a", "a"), "/src/dir", "/src/a", "/src/b")
+	data2, sum2 := tarTree(makeTree("a", "dir/a", "b", "dir/z"), "/src/b", "/src/a", "/src/dir")
+	c.Check(sum1, gc.Equals, sum2)
+	c.Check(data1, jc.DeepEquals, data2)
+
+	entries, err := List(bytes.NewReader(data1))
+	c.Assert(err, jc.ErrorIsNil)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Path)
+		c.Check(entry.ModTime.Equal(time.Unix(0, 0)), jc.IsTrue)
+	}
+	c.Check(names, jc.DeepEquals, []string{"a", "b", "dir", "dir/a", "dir/z"})
+}
+
+func (t *TarSuite) TestTarFilesReproducibleHeaders(c *gc.C) {
+	dir := c.MkDir()
+	file := filepath.Join(dir, "file")
+	err := ioutil.WriteFile(file, []byte("data"), 0600)
+	c.Assert(err, jc.ErrorIsNil)
+	err = os.Chtimes(file, time.Now(), time.Now().Add(-time.Hour))
+	c.Assert(err, jc.ErrorIsNil)
+
+	modTime := time.Date(2022, 1, 2, 3, 4, 5, 600, time.UTC)
+	var buf bytes.Buffer
+	_, err = TarFilesWithOptions([]string{file}, &buf, dir+"/", Options{
+		Reproducible: true,
+		ModTime:      modTime,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	hdr, _, err := FindFile(&buf, "file")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(hdr.ModTime.Equal(modTime.Truncate(time.Second)), jc.IsTrue)
+	c.Check(hdr.AccessTime.IsZero(), jc.IsTrue)
+	c.Check(hdr.Uid, gc.Equals, 0)
+	c.Check(hdr.Gid, gc.Equals, 0)
+	c.Check(hdr.Uname, gc.Equals, "")
+	c.Check(hdr.Gname, gc.Equals, "")
+	c.Check(hdr.Mode, gc.Equals, int64(0600))
+}
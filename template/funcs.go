@@ -0,0 +1,204 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package template
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/juju/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/juju/utils/v3"
+)
+
+// builtins holds the functions available to every template,
+// in addition to "include" and those predefined by text/template.
+var builtins = map[string]interface{}{
+	// String manipulation.
+	"upper":      strings.ToUpper,
+	"lower":      strings.ToLower,
+	"trim":       strings.TrimSpace,
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+	"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+	"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+	"split":      func(sep, s string) []string { return strings.Split(s, sep) },
+	"join":       join,
+	"repeat":     func(n int, s string) string { return strings.Repeat(s, n) },
+	"indent":     indent,
+	"nindent":    func(n int, s string) string { return "\n" + indent(n, s) },
+
+	// Quoting.
+	"quote":    func(v interface{}) string { return fmt.Sprintf("%q", toString(v)) },
+	"squote":   func(v interface{}) string { return "'" + toString(v) + "'" },
+	"shquote":  func(v interface{}) string { return utils.ShQuote(toString(v)) },
+	"psquote":  psquote,
+	"cmdquote": func(v interface{}) string { return utils.WinCmdQuote(toString(v)) },
+
+	// Encoding.
+	"b64enc":       func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+	"b64dec":       b64dec,
+	"toJson":       toJSON,
+	"toPrettyJson": toPrettyJSON,
+	"toYaml":       toYAML,
+
+	// Defaults and checks.
+	"default":  defaultValue,
+	"empty":    empty,
+	"coalesce": coalesce,
+	"required": required,
+	"fail":     func(msg string) (string, error) { return "", errors.New(msg) },
+
+	// Collections.
+	"list": func(v ...interface{}) []interface{} { return v },
+	"dict": dict,
+}
+
+// toString returns the text form of v, or the empty
+// string if v is nil.
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	return fmt.Sprint(v)
+}
+
+// psquote quotes v as a PowerShell string literal. Unlike
+// utils.WinPSQuote it preserves any single quotes in v.
+func psquote(v interface{}) string {
+	return "'" + strings.ReplaceAll(toString(v), "'", "''") + "'"
+}
+
+// indent prefixes each line of s with n spaces.
+func indent(n int, s string) string {
+	pad := strings.Repeat(" ", n)
+	return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+}
+
+// join joins the elements of a slice, which need not
+// be strings, with sep.
+func join(sep string, v interface{}) (string, error) {
+	if ss, ok := v.([]string); ok {
+		return strings.Join(ss, sep), nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return "", errors.Errorf("join: cannot join %T", v)
+	}
+	parts := make([]string, rv.Len())
+	for i := range parts {
+		parts[i] = toString(rv.Index(i).Interface())
+	}
+	return strings.Join(parts, sep), nil
+}
+
+func b64dec(s string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", errors.Annotate(err, "b64dec")
+	}
+	return string(data), nil
+}
+
+func toJSON(v interface{}) (string, error) {
+	v, err := utils.YAMLToJSON(v)
+	if err != nil {
+		return "", errors.Annotate(err, "toJson")
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", errors.Annotate(err, "toJson")
+	}
+	return string(data), nil
+}
+
+func toPrettyJSON(v interface{}) (string, error) {
+	v, err := utils.YAMLToJSON(v)
+	if err != nil {
+		return "", errors.Annotate(err, "toPrettyJson")
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "", errors.Annotate(err, "toPrettyJson")
+	}
+	return string(data), nil
+}
+
+// toYAML returns v marshaled as YAML without a trailing
+// newline, so that it can be piped to indent.
+func toYAML(v interface{}) (string, error) {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return "", errors.Annotate(err, "toYaml")
+	}
+	return strings.TrimSuffix(string(data), "\n"), nil
+}
+
+// empty reports whether v is nil or the zero value of its type,
+// or an empty slice, map or string.
+func empty(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return true
+	}
+	switch rv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	}
+	return rv.IsZero()
+}
+
+// defaultValue returns v unless it is empty, in which case
+// it returns def. It is used as {{.Port | default 80}}.
+func defaultValue(def interface{}, v ...interface{}) interface{} {
+	if len(v) == 0 || empty(v[0]) {
+		return def
+	}
+	return v[0]
+}
+
+// coalesce returns the first value that is not empty.
+func coalesce(v ...interface{}) interface{} {
+	for _, x := range v {
+		if !empty(x) {
+			return x
+		}
+	}
+	return nil
+}
+
+// required returns v, or an error holding msg if v is empty.
+func required(msg string, v interface{}) (interface{}, error) {
+	if empty(v) {
+		return nil, errors.New(msg)
+	}
+	return v, nil
+}
+
+// dict returns a map built from alternating keys and values.
+func dict(kv ...interface{}) (map[string]interface{}, error) {
+	if len(kv)%2 != 0 {
+		return nil, errors.New("dict: odd number of arguments")
+	}
+	m := make(map[string]interface{}, len(kv)/2)
+	for i := 0; i < len(kv); i += 2 {
+		key, ok := kv[i].(string)
+		if !ok {
+			return nil, errors.Errorf("dict: key %v is not a string", kv[i])
+		}
+		m[key] = kv[i+1]
+	}
+	return m, nil
+}
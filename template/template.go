@@ -0,0 +1,168 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package template renders text templates with a small, curated
+// set of functions suitable for generating configuration files,
+// service unit files and shell snippets.
+//
+// Unlike larger function libraries, nothing here can read the
+// environment, touch the file system or run commands, so templates
+// may be taken from less trusted sources.
+package template
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+
+	"github.com/juju/errors"
+)
+
+// MissingKey specifies what happens when a template refers to a map
+// key that is not present.
+type MissingKey int
+
+const (
+	// MissingKeyError stops rendering with an error.
+	MissingKeyError MissingKey = iota
+
+	// MissingKeyZero renders the zero value of the map's
+	// element type.
+	MissingKeyZero
+
+	// MissingKeyDefault renders "<no value>" as text/template
+	// does by default.
+	MissingKeyDefault
+)
+
+func (m MissingKey) option() string {
+	switch m {
+	case MissingKeyZero:
+		return "missingkey=zero"
+	case MissingKeyDefault:
+		return "missingkey=default"
+	}
+	return "missingkey=error"
+}
+
+// DefaultMaxIncludeDepth holds the include depth used when
+// Options.MaxIncludeDepth is zero.
+const DefaultMaxIncludeDepth = 10
+
+// Options holds options for a Renderer.
+type Options struct {
+	// MissingKey holds the policy for missing map keys.
+	MissingKey MissingKey
+
+	// MaxIncludeDepth holds the maximum depth to which
+	// templates may include one another. If it is zero,
+	// DefaultMaxIncludeDepth is used.
+	MaxIncludeDepth int
+
+	// Funcs holds additional functions made available to
+	// templates. They take precedence over the built in ones.
+	Funcs template.FuncMap
+}
+
+// Renderer holds a set of named templates that may include
+// one another. It is safe to render concurrently once all
+// templates have been added.
+type Renderer struct {
+	options  Options
+	template *template.Template
+}
+
+// New returns a new Renderer with no templates.
+func New(options Options) *Renderer {
+	if options.MaxIncludeDepth == 0 {
+		options.MaxIncludeDepth = DefaultMaxIncludeDepth
+	}
+	r := &Renderer{options: options}
+	r.template = template.New("").
+		Option(options.MissingKey.option()).
+		Funcs(r.funcs(nil))
+	return r
+}
+
+// Add parses text as the template with the given name, which
+// may then be rendered or included from other templates. Any
+// templates defined within text are added too.
+func (r *Renderer) Add(name, text string) error {
+	if _, err := r.template.New(name).Parse(text); err != nil {
+		return errors.Annotatef(err, "cannot parse template %q", name)
+	}
+	return nil
+}
+
+// Render renders the named template with the given data.
+func (r *Renderer) Render(name string, data interface{}) (string, error) {
+	t := r.template.Lookup(name)
+	if t == nil {
+		return "", errors.NotFoundf("template %q", name)
+	}
+	// Each rendering gets its own copy of the templates so that
+	// include can track its depth.
+	t, err := r.template.Clone()
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	state := &renderState{template: t, maxDepth: r.options.MaxIncludeDepth}
+	t.Funcs(r.funcs(state))
+	var buf bytes.Buffer
+	if err := t.ExecuteTemplate(&buf, name, data); err != nil {
+		return "", errors.Annotatef(err, "cannot render template %q", name)
+	}
+	return buf.String(), nil
+}
+
+// Render renders text as a template with the given data and
+// default options.
+func Render(text string, data interface{}) (string, error) {
+	r := New(Options{})
+	if err := r.Add("template", text); err != nil {
+		return "", errors.Trace(err)
+	}
+	return r.Render("template", data)
+}
+
+// renderState holds the state of a single call to Render.
+type renderState struct {
+	template *template.Template
+	maxDepth int
+	depth    int
+}
+
+// include renders the named template with the given data and
+// returns the result, so that it can be piped to other functions.
+func (s *renderState) include(name string, data interface{}) (string, error) {
+	if s.depth >= s.maxDepth {
+		return "", fmt.Errorf("include %q: maximum include depth %d exceeded", name, s.maxDepth)
+	}
+	s.depth++
+	defer func() { s.depth-- }()
+	var buf bytes.Buffer
+	if err := s.template.ExecuteTemplate(&buf, name, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// funcs returns the functions available to templates rendered
+// with the given state. If state is nil, include fails; it is
+// only used while parsing.
+func (r *Renderer) funcs(state *renderState) template.FuncMap {
+	fm := make(template.FuncMap, len(builtins)+len(r.options.Funcs)+1)
+	for name, f := range builtins {
+		fm[name] = f
+	}
+	fm["include"] = func(name string, data interface{}) (string, error) {
+		if state == nil {
+			return "", errors.New("include called outside Render")
+		}
+		return state.include(name, data)
+	}
+	for name, f := range r.options.Funcs {
+		fm[name] = f
+	}
+	return fm
+}
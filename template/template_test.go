@@ -0,0 +1,191 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package template_test
+
+import (
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/template"
+)
+
+type templateSuite struct{}
+
+var _ = gc.Suite(&templateSuite{})
+
+var funcTests = []struct {
+	template string
+	data     interface{}
+	expect   string
+	err      string
+}{
+	{`{{upper "abc"}} {{lower "ABC"}} {{trim "  x "}}`, nil, "ABC abc x", ""},
+	{`{{"foo.conf" | trimSuffix ".conf" | trimPrefix "f"}}`, nil, "oo", ""},
+	{`{{"a-b-c" | replace "-" "_"}} {{"abc" | contains "b"}}`, nil, "a_b_c true", ""},
+	{`{{join "," .}}`, []int{1, 2, 3}, "1,2,3", ""},
+	{`{{"a,b" | split "," | join " "}}`, nil, "a b", ""},
+	{`{{join "," 3}}`, nil, "", `.*join: cannot join int`},
+	{`{{repeat 3 "ab"}}`, nil, "ababab", ""},
+	{`{{"a\nb" | indent 2}}`, nil, "  a\n  b", ""},
+	{`x:{{"a\nb" | nindent 4}}`, nil, "x:\n    a\n    b", ""},
+	{`{{quote .}} {{squote .}}`, `say "hi"`, `"say \"hi\"" 'say "hi"'`, ""},
+	{`{{shquote .}}`, "it's", `'it'"'"'s'`, ""},
+	{`{{psquote .}}`, "it's", `'it''s'`, ""},
+	{`{{quote .}}`, nil, `""`, ""},
+	{`{{b64enc "hello"}} {{b64enc "hello" | b64dec}}`, nil, "aGVsbG8= hello", ""},
+	{`{{b64dec "!"}}`, nil, "", `.*b64dec: illegal base64 data.*`},
+	{`{{toJson .}}`, map[interface{}]interface{}{"a": []interface{}{1, "x"}}, `{"a":[1,"x"]}`, ""},
+	{`{{toPrettyJson .}}`, map[string]int{"a": 1}, "{\n  \"a\": 1\n}", ""},
+	{`{{toJson .}}`, map[interface{}]interface{}{1: 2}, "", `.*toJson: map key 1 \(int\) at top level is not a string`},
+	{"config:{{toYaml . | nindent 2}}", map[string]interface{}{"b": []string{"x"}, "a": 1}, "config:\n  a: 1\n  b:\n  - x", ""},
+	{`{{.port | default 80}} {{.host | default "localhost"}}`, map[string]interface{}{"port": 0, "host": "h"}, "80 h", ""},
+	{`{{default "none"}}`, nil, "none", ""},
+	{`{{coalesce "" .a "z"}}`, map[string]interface{}{"a": nil}, "z", ""},
+	{`{{empty .}} {{empty ""}} {{empty "x"}}`, []string{}, "true true false", ""},
+	{`{{required "name is required" .name}}`, map[string]interface{}{"name": "x"}, "x", ""},
+	{`{{required "name is required" .name}}`, map[string]interface{}{"name": ""}, "", `.*name is required`},
+	{`{{fail "bad things"}}`, nil, "", `.*bad things`},
+	{`{{range list 1 2}}{{.}}{{end}}`, nil, "12", ""},
+	{`{{$d := dict "a" 1 "b" "x"}}{{$d.a}}{{$d.b}}`, nil, "1x", ""},
+	{`{{dict "a"}}`, nil, "", `.*dict: odd number of arguments`},
+}
+
+func (*templateSuite) TestFuncs(c *gc.C) {
+	for i, test := range funcTests {
+		c.Logf("test %d: %s", i, test.template)
+		out, err := template.Render(test.template, test.data)
+		if test.err != "" {
+			c.Check(err, gc.ErrorMatches, test.err)
+			continue
+		}
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(out, gc.Equals, test.expect)
+	}
+}
+
+func (*templateSuite) TestMissingKey(c *gc.C) {
+	data := map[string]string{"a": "x"}
+	for i, test := range []struct {
+		policy template.MissingKey
+		expect string
+		err    string
+	}{
+		{template.MissingKeyError, "", `cannot render template "t": .*map has no entry for key "b"`},
+		{template.MissingKeyZero, "x[]", ""},
+		{template.MissingKeyDefault, "x[<no value>]", ""},
+	} {
+		c.Logf("test %d", i)
+		r := template.New(template.Options{MissingKey: test.policy})
+		err := r.Add("t", "{{.a}}[{{.b}}]")
+		c.Assert(err, jc.ErrorIsNil)
+		out, err := r.Render("t", data)
+		if test.err != "" {
+			c.Check(err, gc.ErrorMatches, test.err)
+			continue
+		}
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(out, gc.Equals, test.expect)
+	}
+}
+
+func (*templateSuite) TestInclude(c *gc.C) {
+	r := template.New(template.Options{})
+	err := r.Add("unit", `
+[Unit]
+Description={{.name}}
+
+[Service]
+{{include "env" .env | trim}}
+ExecStart={{.exec}}
+`[1:])
+	c.Assert(err, jc.ErrorIsNil)
+	err = r.Add("env", `{{range $k, $v := .}}Environment={{$k}}={{$v}}
+{{end}}`)
+	c.Assert(err, jc.ErrorIsNil)
+
+	out, err := r.Render("unit", map[string]interface{}{
+		"name": "agent",
+		"exec": "/usr/bin/agent",
+		"env":  map[string]string{"A": "1", "B": "2"},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(out, gc.Equals, `
+[Unit]
+Description=agent
+
+[Service]
+Environment=A=1
+Environment=B=2
+ExecStart=/usr/bin/agent
+`[1:])
+}
+
+func (*templateSuite) TestIncludeDepth(c *gc.C) {
+	r := template.New(template.Options{MaxIncludeDepth: 3})
+	err := r.Add("nest", `{{if .}}({{include "nest" (slice . 1)}}){{end}}`)
+	c.Assert(err, jc.ErrorIsNil)
+
+	out, err := r.Render("nest", "abc")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(out, gc.Equals, "((()))")
+
+	_, err = r.Render("nest", "abcd")
+	c.Check(err, gc.ErrorMatches, `cannot render template "nest": .*include "nest": maximum include depth 3 exceeded`)
+
+	// The depth is tracked separately for each rendering.
+	out, err = r.Render("nest", "abc")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(out, gc.Equals, "((()))")
+}
+
+func (*templateSuite) TestIncludeRecursionLimitedByDefault(c *gc.C) {
+	r := template.New(template.Options{})
+	err := r.Add("loop", `{{include "loop" .}}`)
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = r.Render("loop", nil)
+	c.Check(err, gc.ErrorMatches, `.*maximum include depth 10 exceeded`)
+}
+
+func (*templateSuite) TestDefinedTemplates(c *gc.C) {
+	r := template.New(template.Options{})
+	err := r.Add("main", `{{define "greet"}}hello {{.}}{{end}}{{include "greet" . | upper}}`)
+	c.Assert(err, jc.ErrorIsNil)
+	out, err := r.Render("main", "world")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(out, gc.Equals, "HELLO WORLD")
+	out, err = r.Render("greet", "there")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(out, gc.Equals, "hello there")
+}
+
+func (*templateSuite) TestExtraFuncs(c *gc.C) {
+	r := template.New(template.Options{
+		Funcs: texttemplate.FuncMap{
+			"upper": func(s string) string { return "UP:" + s },
+			"title": func(s string) string { return strings.ToUpper(s[:1]) + s[1:] },
+		},
+	})
+	err := r.Add("t", `{{upper "a"}} {{title "b"}}`)
+	c.Assert(err, jc.ErrorIsNil)
+	out, err := r.Render("t", nil)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(out, gc.Equals, "UP:a B")
+}
+
+func (*templateSuite) TestParseError(c *gc.C) {
+	r := template.New(template.Options{})
+	err := r.Add("bad", `{{.a`)
+	c.Check(err, gc.ErrorMatches, `cannot parse template "bad": .*`)
+	err = r.Add("bad", `{{exec "rm"}}`)
+	c.Check(err, gc.ErrorMatches, `cannot parse template "bad": .*function "exec" not defined`)
+}
+
+func (*templateSuite) TestRenderNotFound(c *gc.C) {
+	_, err := template.New(template.Options{}).Render("missing", nil)
+	c.Check(err, jc.Satisfies, errors.IsNotFound)
+}
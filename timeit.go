@@ -4,28 +4,165 @@
 package utils
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/juju/clock"
+)
+
+// TimingReport holds the time spent in an action and in
+// the actions nested within it.
+type TimingReport struct {
+	Action   string          `json:"action"`
+	Start    time.Time       `json:"start"`
+	Duration time.Duration   `json:"duration"`
+	Children []*TimingReport `json:"children,omitempty"`
+}
+
+// String returns the report as text, one action per line, with
+// nested actions indented beneath the action that contains them.
+func (r *TimingReport) String() string {
+	var buf strings.Builder
+	r.write(&buf, 0)
+	return buf.String()
+}
+
+func (r *TimingReport) write(buf *strings.Builder, depth int) {
+	fmt.Fprintf(buf, "%.3fs %*s%s\n", r.Duration.Seconds(), depth, "", r.Action)
+	for _, child := range r.Children {
+		child.write(buf, depth+1)
+	}
+}
+
+// Filter returns a copy of the report without the actions that took
+// less than threshold, or nil if the report's own action did.
+func (r *TimingReport) Filter(threshold time.Duration) *TimingReport {
+	if r.Duration < threshold {
+		return nil
+	}
+	filtered := *r
+	filtered.Children = nil
+	for _, child := range r.Children {
+		if child := child.Filter(threshold); child != nil {
+			filtered.Children = append(filtered.Children, child)
+		}
+	}
+	return &filtered
+}
+
+// TimingFormat names a format in which timing reports are written.
+type TimingFormat string
+
+const (
+	// TimingText writes reports as returned by TimingReport.String.
+	TimingText TimingFormat = "text"
+
+	// TimingJSON writes each report as a line of JSON,
+	// with durations in nanoseconds.
+	TimingJSON TimingFormat = "json"
 )
 
-type timer struct {
-	action     string
-	start      time.Time
-	depth      int
-	duration   time.Duration
-	subActions []*timer
+// TimingConfig holds the configuration of a Timings.
+type TimingConfig struct {
+	// Clock is used to time actions. If it is nil,
+	// the wall clock is used.
+	Clock clock.Clock
+
+	// Writer receives a report when each outermost action
+	// finishes. If it is nil, os.Stderr is used.
+	Writer io.Writer
+
+	// Format holds the format of the reports. If it is
+	// empty, TimingText is used.
+	Format TimingFormat
+
+	// Threshold holds the time an action must take for it to be
+	// reported. Shorter actions, and the actions nested within
+	// them, are left out of the reports.
+	Threshold time.Duration
+}
+
+// Timings records the time spent in nested actions and
+// reports it when the outermost action finishes.
+type Timings struct {
+	config TimingConfig
+
+	mu    sync.Mutex
+	stack []*TimingReport
+}
+
+// NewTimings returns a Timings with the given configuration.
+func NewTimings(config TimingConfig) *Timings {
+	if config.Clock == nil {
+		config.Clock = clock.WallClock
+	}
+	if config.Writer == nil {
+		config.Writer = os.Stderr
+	}
+	if config.Format == "" {
+		config.Format = TimingText
+	}
+	return &Timings{config: config}
+}
+
+// Start starts timing an action, returning a function to be called
+// when the action finishes. An action started while another is in
+// progress is nested within it. When the outermost action finishes,
+// the report of it is written.
+func (t *Timings) Start(action string) func() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	cur := &TimingReport{Action: action, Start: t.config.Clock.Now()}
+	if len(t.stack) != 0 {
+		tip := t.stack[len(t.stack)-1]
+		tip.Children = append(tip.Children, cur)
+	}
+	t.stack = append(t.stack, cur)
+	return func() {
+		t.finish(cur)
+	}
 }
 
-func (t *timer) String() string {
-	this := fmt.Sprintf("%.3fs %*s%s\n", t.duration.Seconds(), t.depth, "", t.action)
-	for _, sub := range t.subActions {
-		this += sub.String()
+func (t *Timings) finish(cur *TimingReport) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	cur.Duration = t.config.Clock.Now().Sub(cur.Start)
+	// Pop cur along with any actions nested within it
+	// that were never finished.
+	for i := len(t.stack) - 1; i >= 0; i-- {
+		if t.stack[i] == cur {
+			t.stack = t.stack[:i]
+			break
+		}
+	}
+	if len(t.stack) == 0 {
+		t.write(cur)
 	}
-	return this
 }
 
-var stack []*timer
+func (t *Timings) write(report *TimingReport) {
+	report = report.Filter(t.config.Threshold)
+	if report == nil {
+		return
+	}
+	switch t.config.Format {
+	case TimingJSON:
+		data, err := json.Marshal(report)
+		if err != nil {
+			return
+		}
+		t.config.Writer.Write(append(data, '\n'))
+	default:
+		io.WriteString(t.config.Writer, report.String())
+	}
+}
+
+var defaultTimings = NewTimings(TimingConfig{})
 
 // Start a timer, used for tracking time spent.
 // Generally used with either defer, as in:
@@ -37,21 +174,9 @@ var stack []*timer
 //  anotherFunc()
 //  toc()
 // This tracks nested calls by indenting the output, and will print out the
-// full stack of timing when we reach the top of the stack.
+// full stack of timing when we reach the top of the stack. To report
+// in other formats or places, or to leave out short actions, use a
+// Timings.
 func Timeit(action string) func() {
-	cur := &timer{action: action, start: time.Now(), depth: len(stack)}
-	if len(stack) != 0 {
-		tip := stack[len(stack)-1]
-		tip.subActions = append(tip.subActions, cur)
-	}
-	stack = append(stack, cur)
-	return func() {
-		cur.duration = time.Since(cur.start)
-		if len(stack) == 0 || cur == stack[0] {
-			fmt.Fprint(os.Stderr, cur)
-			stack = nil
-		} else {
-			stack = stack[0 : len(stack)-1]
-		}
-	}
+	return defaultTimings.Start(action)
 }
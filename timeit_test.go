@@ -0,0 +1,117 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package utils_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/juju/clock/testclock"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3"
+)
+
+type timeitSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&timeitSuite{})
+
+// runActions times an outer action holding two inner ones,
+// the first of which holds another.
+func runActions(t *utils.Timings, clk *testclock.Clock) {
+	done := t.Start("outer")
+	clk.Advance(time.Second)
+	inner := t.Start("inner")
+	clk.Advance(2 * time.Second)
+	leaf := t.Start("leaf")
+	clk.Advance(10 * time.Millisecond)
+	leaf()
+	inner()
+	quick := t.Start("quick")
+	clk.Advance(time.Millisecond)
+	quick()
+	done()
+}
+
+func (*timeitSuite) TestText(c *gc.C) {
+	clk := testclock.NewClock(time.Now())
+	var buf bytes.Buffer
+	t := utils.NewTimings(utils.TimingConfig{Clock: clk, Writer: &buf})
+	runActions(t, clk)
+	c.Assert(buf.String(), gc.Equals, ""+
+		"3.011s outer\n"+
+		"2.010s  inner\n"+
+		"0.010s   leaf\n"+
+		"0.001s  quick\n")
+}
+
+func (*timeitSuite) TestJSON(c *gc.C) {
+	start := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	clk := testclock.NewClock(start)
+	var buf bytes.Buffer
+	t := utils.NewTimings(utils.TimingConfig{
+		Clock:  clk,
+		Writer: &buf,
+		Format: utils.TimingJSON,
+	})
+	runActions(t, clk)
+
+	var report utils.TimingReport
+	err := json.Unmarshal(buf.Bytes(), &report)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(report.Action, gc.Equals, "outer")
+	c.Assert(report.Start.Equal(start), jc.IsTrue)
+	c.Assert(report.Duration, gc.Equals, 3011*time.Millisecond)
+	c.Assert(report.Children, gc.HasLen, 2)
+	c.Assert(report.Children[0].Action, gc.Equals, "inner")
+	c.Assert(report.Children[0].Children, gc.HasLen, 1)
+	c.Assert(report.Children[0].Children[0].Duration, gc.Equals, 10*time.Millisecond)
+	c.Assert(report.Children[1].Action, gc.Equals, "quick")
+}
+
+func (*timeitSuite) TestThreshold(c *gc.C) {
+	clk := testclock.NewClock(time.Now())
+	var buf bytes.Buffer
+	t := utils.NewTimings(utils.TimingConfig{
+		Clock:     clk,
+		Writer:    &buf,
+		Threshold: 5 * time.Millisecond,
+	})
+	runActions(t, clk)
+	c.Assert(buf.String(), gc.Equals, ""+
+		"3.011s outer\n"+
+		"2.010s  inner\n"+
+		"0.010s   leaf\n")
+
+	// Nothing is written when the outermost action is too short.
+	buf.Reset()
+	done := t.Start("short")
+	clk.Advance(time.Millisecond)
+	done()
+	c.Assert(buf.String(), gc.Equals, "")
+}
+
+func (*timeitSuite) TestUnfinishedNestedAction(c *gc.C) {
+	clk := testclock.NewClock(time.Now())
+	var buf bytes.Buffer
+	t := utils.NewTimings(utils.TimingConfig{Clock: clk, Writer: &buf})
+	done := t.Start("outer")
+	t.Start("never finished")
+	clk.Advance(time.Second)
+	done()
+	c.Assert(buf.String(), gc.Equals, ""+
+		"1.000s outer\n"+
+		"0.000s  never finished\n")
+
+	// The unfinished action does not hold up later reports.
+	buf.Reset()
+	done = t.Start("next")
+	done()
+	c.Assert(buf.String(), gc.Equals, "0.000s next\n")
+}
@@ -0,0 +1,223 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package tracing defines the hooks through which long operations in
+// this module, such as dialling SSH servers, running commands and
+// creating archives, report spans of work. It depends on no tracing
+// system; an embedder connects the hooks to one, such as
+// OpenTelemetry, by implementing Tracer. For example:
+//
+//	type otelTracer struct{ trace.Tracer }
+//
+//	func (t otelTracer) Start(ctx context.Context, name string, attrs ...tracing.Attribute) (context.Context, tracing.Span) {
+//		ctx, span := t.Tracer.Start(ctx, name)
+//		s := otelSpan{span}
+//		s.SetAttributes(attrs...)
+//		return ctx, s
+//	}
+//
+// Span names are dotted, starting with the name of the package that
+// reports them, as in "ssh.dial", and attribute keys are prefixed in
+// the same way, as in "ssh.host".
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Attribute is a key and value describing a span.
+type Attribute struct {
+	Key string
+
+	// Value holds a string, int64, bool or float64.
+	Value interface{}
+}
+
+// String returns a string attribute.
+func String(key, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int returns an integer attribute.
+func Int(key string, value int64) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Bool returns a boolean attribute.
+func Bool(key string, value bool) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Float returns a floating point attribute.
+func Float(key string, value float64) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// String implements fmt.Stringer.
+func (a Attribute) String() string {
+	return fmt.Sprintf("%s=%v", a.Key, a.Value)
+}
+
+// Tracer starts spans.
+type Tracer interface {
+	// Start starts a span with the given name and attributes,
+	// as a child of any span in ctx. It returns a context
+	// holding the new span, with which child spans are started.
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span is an operation being traced.
+type Span interface {
+	// SetAttributes adds attributes to the span, replacing
+	// any with the same keys.
+	SetAttributes(attrs ...Attribute)
+
+	// End ends the span. If err is not nil, the operation failed
+	// with that error. End is called exactly once for each span.
+	End(err error)
+}
+
+// Start starts a span with t. If t is nil, it returns ctx and
+// a span that does nothing, so that callers need not check
+// whether tracing is enabled.
+func Start(t Tracer, ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	if t == nil {
+		return ctx, noopSpan{}
+	}
+	return t.Start(ctx, name, attrs...)
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...Attribute) {}
+
+func (noopSpan) End(error) {}
+
+// Recorder is a Tracer that records the spans started with it,
+// for use in tests.
+type Recorder struct {
+	// Now, if set, is used in place of time.Now to
+	// time the spans.
+	Now func() time.Time
+
+	mu    sync.Mutex
+	spans []*RecordedSpan
+}
+
+// RecordedSpan holds a span recorded by a Recorder.
+type RecordedSpan struct {
+	// Name holds the name of the span.
+	Name string
+
+	// Parent holds the index of the span's parent in the
+	// spans returned by Recorder.Spans, or -1 if it has none.
+	Parent int
+
+	// Attributes holds the span's attributes,
+	// in the order in which they were set.
+	Attributes []Attribute
+
+	// StartTime and EndTime hold the times at which
+	// the span started and ended.
+	StartTime, EndTime time.Time
+
+	// Ended records whether End was called,
+	// and Err the error passed to it.
+	Ended bool
+	Err   error
+
+	rec *Recorder
+}
+
+type recordedSpanKey struct{}
+
+// Start implements Tracer.Start.
+func (r *Recorder) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	parent, ok := ctx.Value(recordedSpanKey{}).(int)
+	if !ok {
+		parent = -1
+	}
+	span := &RecordedSpan{
+		Name:      name,
+		Parent:    parent,
+		StartTime: r.now(),
+		rec:       r,
+	}
+	span.SetAttributes(attrs...)
+	r.mu.Lock()
+	index := len(r.spans)
+	r.spans = append(r.spans, span)
+	r.mu.Unlock()
+	return context.WithValue(ctx, recordedSpanKey{}, index), span
+}
+
+func (r *Recorder) now() time.Time {
+	if r.Now != nil {
+		return r.Now()
+	}
+	return time.Now()
+}
+
+// Spans returns copies of the spans recorded,
+// in the order in which they were started.
+func (r *Recorder) Spans() []RecordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	spans := make([]RecordedSpan, len(r.spans))
+	for i, span := range r.spans {
+		spans[i] = *span
+		spans[i].Attributes = append([]Attribute(nil), span.Attributes...)
+		spans[i].rec = nil
+	}
+	return spans
+}
+
+// Names returns the names of the spans recorded,
+// in the order in which they were started.
+func (r *Recorder) Names() []string {
+	var names []string
+	for _, span := range r.Spans() {
+		names = append(names, span.Name)
+	}
+	return names
+}
+
+// Attribute returns the value of the span's attribute
+// with the given key, or nil if it has none.
+func (s RecordedSpan) Attribute(key string) interface{} {
+	for _, attr := range s.Attributes {
+		if attr.Key == key {
+			return attr.Value
+		}
+	}
+	return nil
+}
+
+// SetAttributes implements Span.SetAttributes.
+func (s *RecordedSpan) SetAttributes(attrs ...Attribute) {
+	s.rec.mu.Lock()
+	defer s.rec.mu.Unlock()
+	for _, attr := range attrs {
+		replaced := false
+		for i := range s.Attributes {
+			if s.Attributes[i].Key == attr.Key {
+				s.Attributes[i] = attr
+				replaced = true
+			}
+		}
+		if !replaced {
+			s.Attributes = append(s.Attributes, attr)
+		}
+	}
+}
+
+// End implements Span.End.
+func (s *RecordedSpan) End(err error) {
+	end := s.rec.now()
+	s.rec.mu.Lock()
+	defer s.rec.mu.Unlock()
+	s.EndTime, s.Ended, s.Err = end, true, err
+}
@@ -0,0 +1,69 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/tracing"
+)
+
+type TracingSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&TracingSuite{})
+
+func (*TracingSuite) TestStartNilTracer(c *gc.C) {
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "value")
+	got, span := tracing.Start(nil, ctx, "op", tracing.String("a", "b"))
+	c.Check(got, gc.Equals, ctx)
+	span.SetAttributes(tracing.Int("n", 1))
+	span.End(errors.New("ignored"))
+}
+
+func (*TracingSuite) TestRecorder(c *gc.C) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	rec := &tracing.Recorder{Now: func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}}
+	ctx, parent := tracing.Start(rec, context.Background(), "parent", tracing.String("a", "1"))
+	_, child := tracing.Start(rec, ctx, "child")
+	child.SetAttributes(tracing.Bool("b", true), tracing.String("a", "2"))
+	child.SetAttributes(tracing.String("a", "3"))
+	child.End(errors.New("failed"))
+	parent.End(nil)
+
+	c.Check(rec.Names(), jc.DeepEquals, []string{"parent", "child"})
+	spans := rec.Spans()
+	c.Assert(spans, gc.HasLen, 2)
+
+	c.Check(spans[0].Parent, gc.Equals, -1)
+	c.Check(spans[0].Attributes, jc.DeepEquals, []tracing.Attribute{tracing.String("a", "1")})
+	c.Check(spans[0].Ended, jc.IsTrue)
+	c.Check(spans[0].Err, jc.ErrorIsNil)
+	c.Check(spans[0].EndTime.Sub(spans[0].StartTime), gc.Equals, 3*time.Second)
+
+	c.Check(spans[1].Parent, gc.Equals, 0)
+	c.Check(spans[1].Attributes, jc.DeepEquals, []tracing.Attribute{
+		tracing.Bool("b", true),
+		tracing.String("a", "3"),
+	})
+	c.Check(spans[1].Attribute("a"), gc.Equals, "3")
+	c.Check(spans[1].Attribute("missing"), gc.IsNil)
+	c.Check(spans[1].Err, gc.ErrorMatches, "failed")
+}
+
+func (*TracingSuite) TestAttributeString(c *gc.C) {
+	c.Check(tracing.Int("n", 3).String(), gc.Equals, "n=3")
+	c.Check(tracing.Float("f", 1.5).String(), gc.Equals, "f=1.5")
+}
@@ -0,0 +1,10 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package tty
+
+var (
+	IsTerminal = &isTerminal
+	GetSize    = &getSize
+	Getenv     = &getenv
+)
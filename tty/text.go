@@ -0,0 +1,150 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package tty
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/width"
+)
+
+// RuneWidth returns the number of columns r takes up on a terminal:
+// two for wide East Asian characters, none for combining marks and
+// control characters, and one otherwise.
+func RuneWidth(r rune) int {
+	switch {
+	case r < ' ' || r == 0x7f:
+		return 0
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		return 0
+	}
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	}
+	return 1
+}
+
+// StringWidth returns the number of columns s
+// takes up on a terminal.
+func StringWidth(s string) int {
+	n := 0
+	for _, r := range s {
+		n += RuneWidth(r)
+	}
+	return n
+}
+
+// Truncate returns s shortened to take up at most width columns,
+// ending with an ellipsis if it was shortened. If width is not
+// positive, s is returned unchanged.
+func Truncate(s string, width int) string {
+	if width <= 0 || StringWidth(s) <= width {
+		return s
+	}
+	n := 0
+	for i, r := range s {
+		w := RuneWidth(r)
+		// Leave a column for the ellipsis.
+		if n+w > width-1 {
+			return s[:i] + "…"
+		}
+		n += w
+	}
+	return s
+}
+
+// Pad returns s followed by enough spaces to take up
+// width columns.
+func Pad(s string, width int) string {
+	if n := width - StringWidth(s); n > 0 {
+		return s + strings.Repeat(" ", n)
+	}
+	return s
+}
+
+// Wrap breaks the lines of s so that none takes up more than width
+// columns, breaking at spaces where possible. The indentation of a
+// line is kept on each line into which it is broken. If width is not
+// positive, s is returned unchanged.
+func Wrap(s string, width int) string {
+	if width <= 0 {
+		return s
+	}
+	lines := strings.Split(s, "\n")
+	var out []string
+	for _, line := range lines {
+		out = append(out, wrapLine(line, width)...)
+	}
+	return strings.Join(out, "\n")
+}
+
+func wrapLine(line string, width int) []string {
+	body := strings.TrimLeft(line, " \t")
+	indent := line[:len(line)-len(body)]
+	if StringWidth(indent) >= width {
+		// There is no room for anything
+		// after the indentation.
+		indent = ""
+	}
+	avail := width - StringWidth(indent)
+	var out []string
+	var cur strings.Builder
+	curWidth := 0
+	flush := func() {
+		out = append(out, indent+cur.String())
+		cur.Reset()
+		curWidth = 0
+	}
+	for _, word := range strings.Fields(body) {
+		w := StringWidth(word)
+		if curWidth > 0 && curWidth+1+w > avail {
+			flush()
+		}
+		// Break words too long for a line of their own.
+		for w > avail {
+			head, rest := splitWidth(word, avail-curWidth)
+			cur.WriteString(head)
+			flush()
+			word, w = rest, StringWidth(rest)
+		}
+		if curWidth > 0 {
+			cur.WriteByte(' ')
+			curWidth++
+		}
+		cur.WriteString(word)
+		curWidth += w
+	}
+	if curWidth > 0 || len(out) == 0 {
+		flush()
+	}
+	return out
+}
+
+// splitWidth splits s after as many characters as take up at most
+// width columns, and at least one character.
+func splitWidth(s string, width int) (string, string) {
+	n := 0
+	for i, r := range s {
+		w := RuneWidth(r)
+		if n+w > width && i > 0 {
+			return s[:i], s[i:]
+		}
+		n += w
+	}
+	return s, ""
+}
+
+// Indent returns s with prefix added to the start
+// of each line that is not empty.
+func Indent(s, prefix string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,106 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package tty_test
+
+import (
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/tty"
+)
+
+type textSuite struct{}
+
+var _ = gc.Suite(&textSuite{})
+
+func (*textSuite) TestStringWidth(c *gc.C) {
+	c.Assert(tty.StringWidth(""), gc.Equals, 0)
+	c.Assert(tty.StringWidth("hello"), gc.Equals, 5)
+	c.Assert(tty.StringWidth("ünïcode"), gc.Equals, 7)
+	c.Assert(tty.StringWidth("日本語"), gc.Equals, 6)
+	c.Assert(tty.StringWidth("ｈｉ"), gc.Equals, 4)
+	// e followed by a combining acute accent.
+	c.Assert(tty.StringWidth("é"), gc.Equals, 1)
+	c.Assert(tty.StringWidth("a\tb"), gc.Equals, 2)
+}
+
+func (*textSuite) TestTruncate(c *gc.C) {
+	c.Assert(tty.Truncate("hello", 5), gc.Equals, "hello")
+	c.Assert(tty.Truncate("hello", 4), gc.Equals, "hel…")
+	c.Assert(tty.Truncate("hello", 1), gc.Equals, "…")
+	c.Assert(tty.Truncate("hello", 0), gc.Equals, "hello")
+	c.Assert(tty.Truncate("ünïcode", 3), gc.Equals, "ün…")
+	c.Assert(tty.Truncate("日本語", 6), gc.Equals, "日本語")
+	c.Assert(tty.Truncate("日本語", 5), gc.Equals, "日本…")
+	c.Assert(tty.Truncate("日本語", 4), gc.Equals, "日…")
+}
+
+func (*textSuite) TestPad(c *gc.C) {
+	c.Assert(tty.Pad("ab", 4), gc.Equals, "ab  ")
+	c.Assert(tty.Pad("日本", 5), gc.Equals, "日本 ")
+	c.Assert(tty.Pad("hello", 3), gc.Equals, "hello")
+}
+
+var wrapTests = []struct {
+	about  string
+	s      string
+	width  int
+	expect string
+}{{
+	about:  "short line",
+	s:      "hello world",
+	width:  20,
+	expect: "hello world",
+}, {
+	about:  "break at spaces",
+	s:      "the quick brown fox jumps over the lazy dog",
+	width:  10,
+	expect: "the quick\nbrown fox\njumps over\nthe lazy\ndog",
+}, {
+	about:  "collapse spaces",
+	s:      "a   b    c",
+	width:  3,
+	expect: "a b\nc",
+}, {
+	about:  "keep indentation",
+	s:      "  one two three four",
+	width:  10,
+	expect: "  one two\n  three\n  four",
+}, {
+	about:  "break long words",
+	s:      "a abcdefghij b",
+	width:  4,
+	expect: "a\nabcd\nefgh\nij b",
+}, {
+	about:  "wide characters",
+	s:      "日本語 日本語",
+	width:  7,
+	expect: "日本語\n日本語",
+}, {
+	about:  "wide word broken",
+	s:      "日本語",
+	width:  3,
+	expect: "日\n本\n語",
+}, {
+	about:  "existing lines kept",
+	s:      "one two\n\nthree",
+	width:  4,
+	expect: "one\ntwo\n\nthre\ne",
+}, {
+	about:  "zero width",
+	s:      "one two",
+	width:  0,
+	expect: "one two",
+}}
+
+func (*textSuite) TestWrap(c *gc.C) {
+	for i, test := range wrapTests {
+		c.Logf("test %d: %s", i, test.about)
+		c.Check(tty.Wrap(test.s, test.width), gc.Equals, test.expect)
+	}
+}
+
+func (*textSuite) TestIndent(c *gc.C) {
+	c.Assert(tty.Indent("a\n\nb\n", "  "), gc.Equals, "  a\n\n  b\n")
+	c.Assert(tty.Indent("", "> "), gc.Equals, "")
+}
@@ -0,0 +1,149 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package tty finds out what the terminal on which a program is
+// running can do, such as how wide it is and whether it shows
+// colour, and lays out text to fit it. Output that is piped
+// elsewhere is treated as having no colour and a default width.
+package tty
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// DefaultWidth holds the width assumed for output
+// whose width cannot be determined.
+const DefaultWidth = 80
+
+// ColorLevel describes the colours a terminal can show.
+type ColorLevel int
+
+const (
+	// NoColor means colour escape sequences should not be used.
+	NoColor ColorLevel = iota
+
+	// Color16 means the 16 basic ANSI colours can be shown.
+	Color16
+
+	// Color256 means the 256 colours of the xterm palette
+	// can be shown.
+	Color256
+
+	// TrueColor means 24-bit colour can be shown.
+	TrueColor
+)
+
+// String implements fmt.Stringer.
+func (l ColorLevel) String() string {
+	switch l {
+	case NoColor:
+		return "none"
+	case Color16:
+		return "16"
+	case Color256:
+		return "256"
+	case TrueColor:
+		return "truecolor"
+	}
+	return "unknown"
+}
+
+// Info describes the terminal to which a file refers.
+type Info struct {
+	// IsTerminal records whether the file is a terminal.
+	IsTerminal bool
+
+	// Width and Height hold the size of the terminal in
+	// characters, or zero if it is not known.
+	Width, Height int
+
+	// Color holds the colours that may be used.
+	Color ColorLevel
+}
+
+// These are variables so that they can be replaced in tests.
+var (
+	isTerminal = terminal.IsTerminal
+	getSize    = terminal.GetSize
+	getenv     = os.Getenv
+)
+
+// Detect describes the terminal to which f refers, such as
+// os.Stdout. The width and height are taken from the COLUMNS and
+// LINES environment variables when they cannot be found from the
+// terminal, as when output is piped. Colour is disabled when f is not
+// a terminal, when the NO_COLOR environment variable is set, as
+// described at https://no-color.org, or when TERM is "dumb"; it is
+// enabled, even when f is not a terminal, when FORCE_COLOR is set.
+func Detect(f *os.File) Info {
+	fd := int(f.Fd())
+	var info Info
+	info.IsTerminal = isTerminal(fd)
+	if info.IsTerminal {
+		if w, h, err := getSize(fd); err == nil {
+			info.Width, info.Height = w, h
+		}
+	}
+	if info.Width <= 0 {
+		info.Width = envInt("COLUMNS")
+	}
+	if info.Height <= 0 {
+		info.Height = envInt("LINES")
+	}
+	info.Color = colorLevel(fd, info.IsTerminal)
+	return info
+}
+
+// Width returns the width of the terminal to which f refers,
+// as found by Detect, or DefaultWidth if it is not known.
+func Width(f *os.File) int {
+	if w := Detect(f).Width; w > 0 {
+		return w
+	}
+	return DefaultWidth
+}
+
+func envInt(name string) int {
+	n, err := strconv.Atoi(strings.TrimSpace(getenv(name)))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+func colorLevel(fd int, isTerm bool) ColorLevel {
+	if getenv("NO_COLOR") != "" {
+		return NoColor
+	}
+	force := getenv("FORCE_COLOR") != ""
+	if !isTerm && !force {
+		return NoColor
+	}
+	term := getenv("TERM")
+	if term == "dumb" && !force {
+		return NoColor
+	}
+	// On Windows, escape sequences work only in consoles that
+	// support virtual terminal processing, which supports 24-bit
+	// colour, unless TERM shows that a terminal emulator such as
+	// that of Cygwin is in use.
+	if isTerm && term == "" {
+		if enableVirtualTerminal(fd) {
+			return TrueColor
+		}
+		if !force {
+			return NoColor
+		}
+	}
+	switch colorTerm := getenv("COLORTERM"); {
+	case colorTerm == "truecolor" || colorTerm == "24bit":
+		return TrueColor
+	case strings.Contains(term, "256color"):
+		return Color256
+	}
+	return Color16
+}
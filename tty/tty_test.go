@@ -0,0 +1,134 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package tty_test
+
+import (
+	"errors"
+	"os"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/tty"
+)
+
+type ttySuite struct {
+	testing.IsolationSuite
+	env map[string]string
+}
+
+var _ = gc.Suite(&ttySuite{})
+
+func (s *ttySuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.env = make(map[string]string)
+	s.PatchValue(tty.Getenv, func(name string) string { return s.env[name] })
+	s.patchTerminal(false, 0, 0)
+}
+
+// patchTerminal makes every file a terminal of the given size if
+// isTerm is true, or not a terminal otherwise.
+func (s *ttySuite) patchTerminal(isTerm bool, width, height int) {
+	s.PatchValue(tty.IsTerminal, func(int) bool { return isTerm })
+	s.PatchValue(tty.GetSize, func(int) (int, int, error) {
+		if !isTerm {
+			return 0, 0, errors.New("not a terminal")
+		}
+		return width, height, nil
+	})
+}
+
+func (s *ttySuite) TestDetectTerminal(c *gc.C) {
+	s.patchTerminal(true, 132, 43)
+	s.env["TERM"] = "xterm"
+	c.Assert(tty.Detect(os.Stdout), jc.DeepEquals, tty.Info{
+		IsTerminal: true,
+		Width:      132,
+		Height:     43,
+		Color:      tty.Color16,
+	})
+}
+
+func (s *ttySuite) TestDetectPiped(c *gc.C) {
+	s.env["TERM"] = "xterm-256color"
+	c.Assert(tty.Detect(os.Stdout), jc.DeepEquals, tty.Info{})
+	c.Assert(tty.Width(os.Stdout), gc.Equals, tty.DefaultWidth)
+}
+
+func (s *ttySuite) TestDetectSizeFromEnv(c *gc.C) {
+	s.env["COLUMNS"] = "100"
+	s.env["LINES"] = " 30 "
+	info := tty.Detect(os.Stdout)
+	c.Assert(info.Width, gc.Equals, 100)
+	c.Assert(info.Height, gc.Equals, 30)
+	c.Assert(tty.Width(os.Stdout), gc.Equals, 100)
+}
+
+func (s *ttySuite) TestDetectSizeFromEnvWhenUnknown(c *gc.C) {
+	s.patchTerminal(true, 0, 0)
+	s.env["COLUMNS"] = "90"
+	s.env["LINES"] = "bad"
+	info := tty.Detect(os.Stdout)
+	c.Assert(info.Width, gc.Equals, 90)
+	c.Assert(info.Height, gc.Equals, 0)
+}
+
+func (s *ttySuite) TestColor(c *gc.C) {
+	for i, test := range []struct {
+		isTerm bool
+		env    map[string]string
+		expect tty.ColorLevel
+	}{{
+		isTerm: true,
+		env:    map[string]string{"TERM": "xterm"},
+		expect: tty.Color16,
+	}, {
+		isTerm: true,
+		env:    map[string]string{"TERM": "xterm-256color"},
+		expect: tty.Color256,
+	}, {
+		isTerm: true,
+		env:    map[string]string{"TERM": "xterm-256color", "COLORTERM": "truecolor"},
+		expect: tty.TrueColor,
+	}, {
+		isTerm: true,
+		env:    map[string]string{"TERM": "xterm", "COLORTERM": "24bit"},
+		expect: tty.TrueColor,
+	}, {
+		isTerm: true,
+		env:    map[string]string{"TERM": "dumb"},
+		expect: tty.NoColor,
+	}, {
+		isTerm: true,
+		env:    map[string]string{"TERM": "xterm", "NO_COLOR": "1"},
+		expect: tty.NoColor,
+	}, {
+		isTerm: true,
+		env:    map[string]string{"TERM": "xterm", "NO_COLOR": "1", "FORCE_COLOR": "1"},
+		expect: tty.NoColor,
+	}, {
+		env:    map[string]string{"TERM": "xterm"},
+		expect: tty.NoColor,
+	}, {
+		env:    map[string]string{"TERM": "xterm-256color", "FORCE_COLOR": "1"},
+		expect: tty.Color256,
+	}, {
+		env:    map[string]string{"TERM": "dumb", "FORCE_COLOR": "1"},
+		expect: tty.Color16,
+	}} {
+		c.Logf("test %d: %v", i, test.env)
+		s.patchTerminal(test.isTerm, 80, 24)
+		s.env = test.env
+		c.Check(tty.Detect(os.Stdout).Color, gc.Equals, test.expect)
+	}
+}
+
+func (s *ttySuite) TestColorLevelString(c *gc.C) {
+	c.Assert(tty.NoColor.String(), gc.Equals, "none")
+	c.Assert(tty.Color16.String(), gc.Equals, "16")
+	c.Assert(tty.Color256.String(), gc.Equals, "256")
+	c.Assert(tty.TrueColor.String(), gc.Equals, "truecolor")
+	c.Assert(tty.ColorLevel(99).String(), gc.Equals, "unknown")
+}
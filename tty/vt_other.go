@@ -0,0 +1,14 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+//go:build !windows
+// +build !windows
+
+package tty
+
+// enableVirtualTerminal reports whether a terminal with no TERM set
+// handles escape sequences. Only Windows consoles need enabling;
+// elsewhere, a terminal with no TERM is assumed not to.
+func enableVirtualTerminal(fd int) bool {
+	return false
+}
@@ -0,0 +1,23 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package tty
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+// enableVirtualTerminal enables the processing of escape sequences by
+// the console open as fd, and reports whether it succeeded, as it does
+// from Windows 10 onwards.
+func enableVirtualTerminal(fd int) bool {
+	h := windows.Handle(fd)
+	var mode uint32
+	if err := windows.GetConsoleMode(h, &mode); err != nil {
+		return false
+	}
+	if mode&windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING != 0 {
+		return true
+	}
+	return windows.SetConsoleMode(h, mode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING) == nil
+}
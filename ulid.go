@@ -0,0 +1,147 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package utils
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// ULID represents a Universally Unique Lexicographically Sortable
+// Identifier, as described at https://github.com/ulid/spec. It is made
+// of a 48 bit millisecond Unix timestamp followed by 80 random bits, and
+// its string form is 26 characters of Crockford's base32.
+type ULID [16]byte
+
+// ulidAlphabet holds the characters of Crockford's base32 encoding.
+const ulidAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ulidState holds the state used to keep ULIDs generated
+// by this process in strictly increasing order.
+var ulidState struct {
+	mu     sync.Mutex
+	millis int64
+	last   ULID
+}
+
+// MustNewULID returns a new ULID, if an error occurs it panics.
+func MustNewULID() ULID {
+	id, err := NewULID()
+	if err != nil {
+		panic(err)
+	}
+	return id
+}
+
+// NewULID generates a new ULID for the current time.
+//
+// Within a process, successive ULIDs are strictly increasing: a ULID
+// generated in the same millisecond as the previous one (or after the
+// clock has gone backwards) reuses its timestamp and increments its
+// random bits by one, as recommended by the specification. In the
+// unlikely event of the random bits overflowing, an error is returned.
+func NewULID() (ULID, error) {
+	var id ULID
+	if _, err := io.ReadFull(rand.Reader, id[6:]); err != nil {
+		return ULID{}, err
+	}
+	now := uuidNow().UnixNano() / int64(time.Millisecond)
+
+	s := &ulidState
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now > s.millis {
+		s.millis = now
+		for i := 0; i < 6; i++ {
+			id[i] = byte(now >> uint(40-8*i))
+		}
+	} else {
+		id = s.last
+		i := len(id) - 1
+		for ; i >= 6; i-- {
+			id[i]++
+			if id[i] != 0 {
+				break
+			}
+		}
+		if i < 6 {
+			return ULID{}, fmt.Errorf("cannot generate ULID: random component overflow")
+		}
+	}
+	s.last = id
+	return id, nil
+}
+
+// ULIDFromString parses the string form of a ULID.
+// Lower case characters are accepted.
+func ULIDFromString(s string) (ULID, error) {
+	var id ULID
+	if len(s) != 26 {
+		return ULID{}, fmt.Errorf("invalid ULID: %q", s)
+	}
+	// The 26 characters hold 130 bits, of which
+	// the first two must be zero.
+	for i := 0; i < len(s); i++ {
+		v := bytes.IndexByte([]byte(ulidAlphabet), upperASCII(s[i]))
+		if v < 0 || i == 0 && v > 7 {
+			return ULID{}, fmt.Errorf("invalid ULID: %q", s)
+		}
+		for j := 0; j < 5; j++ {
+			bit := i*5 + j - 2
+			if bit >= 0 && v&(0x10>>uint(j)) != 0 {
+				id[bit/8] |= 0x80 >> uint(bit%8)
+			}
+		}
+	}
+	return id, nil
+}
+
+// IsValidULIDString returns true, if the given string is a valid ULID.
+func IsValidULIDString(s string) bool {
+	_, err := ULIDFromString(s)
+	return err == nil
+}
+
+func upperASCII(c byte) byte {
+	if 'a' <= c && c <= 'z' {
+		return c - 'a' + 'A'
+	}
+	return c
+}
+
+// String returns the canonical 26 character representation of the ULID.
+func (id ULID) String() string {
+	var out [26]byte
+	for i := range out {
+		v := 0
+		for j := 0; j < 5; j++ {
+			bit := i*5 + j - 2
+			if bit >= 0 && id[bit/8]&(0x80>>uint(bit%8)) != 0 {
+				v |= 0x10 >> uint(j)
+			}
+		}
+		out[i] = ulidAlphabet[v]
+	}
+	return string(out[:])
+}
+
+// Time returns the time encoded in the ULID, to the millisecond.
+func (id ULID) Time() time.Time {
+	var millis int64
+	for _, b := range id[0:6] {
+		millis = millis<<8 | int64(b)
+	}
+	return time.Unix(millis/1000, millis%1000*int64(time.Millisecond)).UTC()
+}
+
+// Compare returns an integer comparing two ULIDs. The result will
+// be 0 if id == other, -1 if id < other, and +1 if id > other.
+// ULIDs compare in the same order as their string forms.
+func (id ULID) Compare(other ULID) int {
+	return bytes.Compare(id[:], other[:])
+}
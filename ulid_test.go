@@ -0,0 +1,96 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package utils_test
+
+import (
+	"strings"
+	"time"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3"
+)
+
+type ulidSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&ulidSuite{})
+
+func (s *ulidSuite) TestNewULID(c *gc.C) {
+	now := time.Date(2022, 6, 1, 12, 30, 0, 123456789, time.UTC)
+	s.PatchValue(utils.UUIDNow, func() time.Time { return now })
+
+	id, err := utils.NewULID()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(id.String(), gc.HasLen, 26)
+	c.Check(id.String(), jc.Satisfies, utils.IsValidULIDString)
+	c.Check(id.Time(), gc.Equals, now.Truncate(time.Millisecond))
+
+	parsed, err := utils.ULIDFromString(id.String())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(parsed, gc.Equals, id)
+	parsed, err = utils.ULIDFromString(strings.ToLower(id.String()))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(parsed, gc.Equals, id)
+}
+
+func (s *ulidSuite) TestULIDMonotonic(c *gc.C) {
+	now := time.Date(2022, 6, 1, 12, 30, 0, 0, time.UTC)
+	s.PatchValue(utils.UUIDNow, func() time.Time { return now })
+
+	last := utils.MustNewULID()
+	for i := 0; i < 100; i++ {
+		if i == 50 {
+			now = now.Add(-time.Second)
+		}
+		id := utils.MustNewULID()
+		c.Assert(id.Compare(last), gc.Equals, 1)
+		c.Assert(id.String() > last.String(), jc.IsTrue)
+		c.Assert(id.Time(), gc.Equals, last.Time())
+		last = id
+	}
+	now = now.Add(2 * time.Second)
+	id := utils.MustNewULID()
+	c.Check(id.Compare(last), gc.Equals, 1)
+	c.Check(id.Time(), gc.Equals, now)
+}
+
+func (*ulidSuite) TestULIDString(c *gc.C) {
+	// Examples from the specification.
+	for _, test := range []struct {
+		id  utils.ULID
+		str string
+	}{{
+		id:  utils.ULID{},
+		str: "00000000000000000000000000",
+	}, {
+		id:  utils.ULID{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		str: "7ZZZZZZZZZZZZZZZZZZZZZZZZZ",
+	}, {
+		id:  utils.ULID{0x01, 0x56, 0x3d, 0xf3, 0x64, 0x81, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+		str: "01ARYZ6S410000000000000000",
+	}} {
+		c.Check(test.id.String(), gc.Equals, test.str)
+		id, err := utils.ULIDFromString(test.str)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(id, gc.Equals, test.id)
+	}
+}
+
+func (*ulidSuite) TestULIDFromStringInvalid(c *gc.C) {
+	for _, s := range []string{
+		"",
+		"01ARYZ6S41",
+		"01ARYZ6S41TSV4RRFFQ69G5FAVX",
+		"01ARYZ6S41TSV4RRFFQ69G5FAU",
+		"80000000000000000000000000",
+	} {
+		_, err := utils.ULIDFromString(s)
+		c.Check(err, gc.ErrorMatches, `invalid ULID: ".*"`)
+		c.Check(utils.IsValidULIDString(s), jc.IsFalse)
+	}
+}
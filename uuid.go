@@ -4,12 +4,16 @@
 package utils
 
 import (
+	"bytes"
 	"crypto/rand"
+	"encoding/binary"
 	"encoding/hex"
 	"fmt"
 	"io"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 )
 
 // UUID represent a universal identifier with 16 octets.
@@ -72,6 +76,100 @@ func NewUUID() (UUID, error) {
 	return uuid, nil
 }
 
+// uuidNow returns the current time for time-ordered identifiers.
+// It is a variable so that it can be replaced in tests.
+var uuidNow = time.Now
+
+// uuidV7State holds the state used to keep version 7 UUIDs
+// generated by this process in strictly increasing order.
+var uuidV7State struct {
+	mu      sync.Mutex
+	millis  int64
+	counter uint16
+}
+
+// MustNewUUIDv7 returns a new version 7 uuid, if an error occurs it panics.
+func MustNewUUIDv7() UUID {
+	uuid, err := NewUUIDv7()
+	if err != nil {
+		panic(err)
+	}
+	return uuid
+}
+
+// NewUUIDv7 generates a new version 7 UUID, as described in RFC 9562,
+// made from a millisecond Unix timestamp followed by random bits, so
+// that UUIDs sort in the order in which they were generated.
+//
+// Within a process, successive UUIDs are strictly increasing even when
+// generated in the same millisecond or if the clock goes backwards: the
+// 12 bits following the timestamp hold a counter, started at a random
+// value each millisecond, and the timestamp is advanced if it overflows.
+func NewUUIDv7() (UUID, error) {
+	var uuid UUID
+	if _, err := io.ReadFull(rand.Reader, uuid[6:]); err != nil {
+		return UUID{}, err
+	}
+	now := uuidNow().UnixNano() / int64(time.Millisecond)
+
+	s := &uuidV7State
+	s.mu.Lock()
+	if now > s.millis {
+		s.millis = now
+		// Start the counter in the lower half of its range,
+		// leaving room for it to be incremented.
+		s.counter = binary.BigEndian.Uint16(uuid[6:8]) & 0x7ff
+	} else {
+		s.counter++
+		if s.counter > 0xfff {
+			s.millis++
+			s.counter = 0
+		}
+	}
+	millis, counter := s.millis, s.counter
+	s.mu.Unlock()
+
+	// 48 bits of timestamp.
+	uuid[0] = byte(millis >> 40)
+	uuid[1] = byte(millis >> 32)
+	uuid[2] = byte(millis >> 24)
+	uuid[3] = byte(millis >> 16)
+	uuid[4] = byte(millis >> 8)
+	uuid[5] = byte(millis)
+	// Set version (7) and the 12 bit counter, then variant (2).
+	uuid[6] = 7<<4 | byte(counter>>8)
+	uuid[7] = byte(counter)
+	uuid[8] = 8<<4 | (uuid[8] & 0x3f)
+	return uuid, nil
+}
+
+// Version returns the version of the UUID,
+// held in the most significant 4 bits of its 7th octet.
+func (uuid UUID) Version() int {
+	return int(uuid[6] >> 4)
+}
+
+// Time returns the time at which a version 7 UUID was generated,
+// to the millisecond. It returns false for other versions.
+func (uuid UUID) Time() (time.Time, bool) {
+	if uuid.Version() != 7 {
+		return time.Time{}, false
+	}
+	var millis int64
+	for _, b := range uuid[0:6] {
+		millis = millis<<8 | int64(b)
+	}
+	return time.Unix(millis/1000, millis%1000*int64(time.Millisecond)).UTC(), true
+}
+
+// Compare returns an integer comparing two UUIDs octet by octet.
+// The result will be 0 if uuid == other, -1 if uuid < other,
+// and +1 if uuid > other. Version 7 UUIDs compare in the order
+// in which they were generated.
+func (uuid UUID) Compare(other UUID) int {
+	return bytes.Compare(uuid[:], other[:])
+}
+
 // Copy returns a copy of the UUID.
 func (uuid UUID) Copy() UUID {
 	uuidCopy := uuid
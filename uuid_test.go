@@ -4,6 +4,8 @@
 package utils_test
 
 import (
+	"time"
+
 	"github.com/juju/testing"
 	jc "github.com/juju/testing/checkers"
 	gc "gopkg.in/check.v1"
@@ -79,3 +81,59 @@ func (*uuidSuite) TestUUIDFromString(c *gc.C) {
 	c.Assert(err, gc.IsNil)
 	c.Assert(uuid.String(), gc.Equals, validUUID)
 }
+
+func (s *uuidSuite) TestUUIDv7(c *gc.C) {
+	now := time.Date(2022, 6, 1, 12, 30, 0, 123456789, time.UTC)
+	s.PatchValue(utils.UUIDNow, func() time.Time { return now })
+
+	uuid, err := utils.NewUUIDv7()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(uuid.String(), jc.Satisfies, utils.IsValidUUIDString)
+	c.Check(uuid.Version(), gc.Equals, 7)
+	c.Check(uuid[8]&0xc0, gc.Equals, byte(0x80))
+	t, ok := uuid.Time()
+	c.Assert(ok, jc.IsTrue)
+	c.Check(t, gc.Equals, now.Truncate(time.Millisecond))
+
+	parsed, err := utils.UUIDFromString(uuid.String())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(parsed.Compare(uuid), gc.Equals, 0)
+}
+
+func (s *uuidSuite) TestUUIDv7Monotonic(c *gc.C) {
+	now := time.Date(2022, 6, 1, 12, 30, 0, 0, time.UTC)
+	s.PatchValue(utils.UUIDNow, func() time.Time { return now })
+
+	last := utils.MustNewUUIDv7()
+	// Generate enough in the same millisecond to overflow the
+	// counter, and some after the clock has gone backwards.
+	for i := 0; i < 5000; i++ {
+		if i == 4000 {
+			now = now.Add(-time.Second)
+		}
+		uuid := utils.MustNewUUIDv7()
+		c.Assert(uuid.Compare(last), gc.Equals, 1, gc.Commentf("%d: %v <= %v", i, uuid, last))
+		c.Assert(uuid.String() > last.String(), jc.IsTrue)
+		last = uuid
+	}
+	t, ok := last.Time()
+	c.Assert(ok, jc.IsTrue)
+	c.Check(t.After(time.Date(2022, 6, 1, 12, 30, 0, 0, time.UTC)), jc.IsTrue)
+}
+
+func (*uuidSuite) TestUUIDTimeNotVersion7(c *gc.C) {
+	uuid := utils.MustNewUUID()
+	c.Check(uuid.Version(), gc.Equals, 4)
+	_, ok := uuid.Time()
+	c.Check(ok, jc.IsFalse)
+}
+
+func (*uuidSuite) TestUUIDCompare(c *gc.C) {
+	a, err := utils.UUIDFromString("9f484882-2f18-4fd2-967d-db9663db7bea")
+	c.Assert(err, jc.ErrorIsNil)
+	b, err := utils.UUIDFromString("9f484882-2f18-4fd2-967d-db9663db7beb")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(a.Compare(b), gc.Equals, -1)
+	c.Check(b.Compare(a), gc.Equals, 1)
+	c.Check(a.Compare(a), gc.Equals, 0)
+}
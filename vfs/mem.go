@@ -0,0 +1,614 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package vfs
+
+import (
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// maxSymlinks holds the number of symbolic links that will be
+// followed when resolving a path before giving up.
+const maxSymlinks = 40
+
+// MemFS is an FS held in memory. Paths are interpreted relative to the
+// root of the filesystem, and may use either slash or the operating
+// system's separator. The zero value is not usable; use NewMemFS.
+//
+// It is safe to use a MemFS from multiple goroutines.
+type MemFS struct {
+	mu   sync.Mutex
+	root *memNode
+	now  func() time.Time
+}
+
+// memNode is a file, directory or symbolic link. A node may appear in
+// several directories if it has been hard linked.
+type memNode struct {
+	mode     os.FileMode
+	modTime  time.Time
+	data     []byte
+	children map[string]*memNode
+	target   string
+}
+
+func (n *memNode) isDir() bool {
+	return n.mode.IsDir()
+}
+
+func (n *memNode) isSymlink() bool {
+	return n.mode&os.ModeSymlink != 0
+}
+
+// NewMemFS returns a new, empty, in-memory filesystem.
+func NewMemFS() *MemFS {
+	m := &MemFS{now: time.Now}
+	m.root = m.newNode(os.ModeDir | 0755)
+	return m
+}
+
+func (m *MemFS) newNode(mode os.FileMode) *memNode {
+	n := &memNode{mode: mode, modTime: m.now()}
+	if mode.IsDir() {
+		n.children = make(map[string]*memNode)
+	}
+	return n
+}
+
+// splitPath returns the components of name.
+func splitPath(name string) []string {
+	name = path.Clean("/" + filepath.ToSlash(name))
+	if name == "/" {
+		return nil
+	}
+	return strings.Split(name[1:], "/")
+}
+
+// resolved holds the result of resolving a path.
+type resolved struct {
+	// parent holds the directory containing the named
+	// entry, or nil if the path refers to the root.
+	parent *memNode
+
+	// base holds the name of the entry within parent.
+	base string
+
+	// node holds the named entry, or nil if it does not exist.
+	node *memNode
+
+	// path holds the resolved path.
+	path string
+}
+
+// resolve resolves name, following all symbolic links except, unless
+// follow is true, a final one. If the final component does not exist,
+// node is nil but parent and base are set. It is called with m.mu held.
+func (m *MemFS) resolve(op, name string, follow bool) (resolved, error) {
+	parts := splitPath(name)
+	stack := []*memNode{m.root}
+	var names []string
+	links := 0
+	for len(parts) > 0 {
+		comp := parts[0]
+		parts = parts[1:]
+		if comp == "." || comp == "" {
+			continue
+		}
+		if comp == ".." {
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+				names = names[:len(names)-1]
+			}
+			continue
+		}
+		dir := stack[len(stack)-1]
+		if !dir.isDir() {
+			return resolved{}, &os.PathError{Op: op, Path: name, Err: syscall.ENOTDIR}
+		}
+		child := dir.children[comp]
+		if child == nil {
+			if len(parts) == 0 {
+				return resolved{
+					parent: dir,
+					base:   comp,
+					path:   "/" + strings.Join(append(names, comp), "/"),
+				}, nil
+			}
+			return resolved{}, &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+		}
+		if child.isSymlink() && (len(parts) > 0 || follow) {
+			links++
+			if links > maxSymlinks {
+				return resolved{}, &os.PathError{Op: op, Path: name, Err: syscall.ELOOP}
+			}
+			target := filepath.ToSlash(child.target)
+			if path.IsAbs(target) {
+				stack, names = stack[:1], nil
+			}
+			parts = append(strings.Split(target, "/"), parts...)
+			continue
+		}
+		stack = append(stack, child)
+		names = append(names, comp)
+	}
+	if len(stack) == 1 {
+		return resolved{node: m.root, path: "/"}, nil
+	}
+	return resolved{
+		parent: stack[len(stack)-2],
+		base:   names[len(names)-1],
+		node:   stack[len(stack)-1],
+		path:   "/" + strings.Join(names, "/"),
+	}, nil
+}
+
+// lookup is like resolve but fails if the named entry does not exist.
+func (m *MemFS) lookup(op, name string, follow bool) (resolved, error) {
+	r, err := m.resolve(op, name, follow)
+	if err != nil {
+		return resolved{}, err
+	}
+	if r.node == nil {
+		return resolved{}, &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	return r, nil
+}
+
+// create resolves name, which must not exist, for the creation of a
+// new entry. It is called with m.mu held.
+func (m *MemFS) create(op, name string) (resolved, error) {
+	r, err := m.resolve(op, name, false)
+	if err != nil {
+		return resolved{}, err
+	}
+	if r.node != nil {
+		return resolved{}, &os.PathError{Op: op, Path: name, Err: os.ErrExist}
+	}
+	return r, nil
+}
+
+// Open implements FS.Open.
+func (m *MemFS) Open(name string) (File, error) {
+	return m.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// Create implements FS.Create.
+func (m *MemFS) Create(name string) (File, error) {
+	return m.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+// OpenFile implements FS.OpenFile.
+func (m *MemFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, err := m.resolve("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	switch {
+	case r.node == nil:
+		if flag&os.O_CREATE == 0 {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+		}
+		r.node = m.newNode(perm.Perm())
+		r.parent.children[r.base] = r.node
+		r.parent.modTime = m.now()
+	case flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+	case r.node.isDir() && writable:
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+	case flag&os.O_TRUNC != 0 && writable:
+		r.node.data = nil
+		r.node.modTime = m.now()
+	}
+	return &memFile{
+		fs:       m,
+		node:     r.node,
+		name:     name,
+		base:     r.base,
+		readable: flag&os.O_WRONLY == 0,
+		writable: writable,
+		append:   flag&os.O_APPEND != 0,
+	}, nil
+}
+
+// Stat implements FS.Stat.
+func (m *MemFS) Stat(name string) (os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, err := m.lookup("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return newMemFileInfo(r.base, r.node), nil
+}
+
+// Lstat implements FS.Lstat.
+func (m *MemFS) Lstat(name string) (os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, err := m.lookup("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return newMemFileInfo(r.base, r.node), nil
+}
+
+// Remove implements FS.Remove.
+func (m *MemFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, err := m.lookup("remove", name, false)
+	if err != nil {
+		return err
+	}
+	if r.parent == nil {
+		return &os.PathError{Op: "remove", Path: name, Err: syscall.EBUSY}
+	}
+	if r.node.isDir() && len(r.node.children) > 0 {
+		return &os.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+	}
+	delete(r.parent.children, r.base)
+	r.parent.modTime = m.now()
+	return nil
+}
+
+// RemoveAll implements FS.RemoveAll.
+func (m *MemFS) RemoveAll(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, err := m.resolve("removeall", name, false)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if r.node == nil {
+		return nil
+	}
+	if r.parent == nil {
+		r.node.children = make(map[string]*memNode)
+		return nil
+	}
+	delete(r.parent.children, r.base)
+	r.parent.modTime = m.now()
+	return nil
+}
+
+// Rename implements FS.Rename.
+func (m *MemFS) Rename(oldpath, newpath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	linkErr := func(err error) error {
+		if pe, ok := err.(*os.PathError); ok {
+			err = pe.Err
+		}
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+	}
+	from, err := m.lookup("rename", oldpath, false)
+	if err != nil {
+		return linkErr(err)
+	}
+	to, err := m.resolve("rename", newpath, false)
+	if err != nil {
+		return linkErr(err)
+	}
+	if from.parent == nil || to.parent == nil {
+		return linkErr(syscall.EBUSY)
+	}
+	if from.node == to.node {
+		return nil
+	}
+	if from.node.isDir() && strings.HasPrefix(to.path+"/", from.path+"/") {
+		return linkErr(syscall.EINVAL)
+	}
+	if to.node != nil {
+		switch {
+		case to.node.isDir() && !from.node.isDir():
+			return linkErr(syscall.EISDIR)
+		case !to.node.isDir() && from.node.isDir():
+			return linkErr(syscall.ENOTDIR)
+		case to.node.isDir() && len(to.node.children) > 0:
+			return linkErr(syscall.ENOTEMPTY)
+		}
+	}
+	delete(from.parent.children, from.base)
+	to.parent.children[to.base] = from.node
+	now := m.now()
+	from.parent.modTime, to.parent.modTime = now, now
+	return nil
+}
+
+// ReadDir implements FS.ReadDir.
+func (m *MemFS) ReadDir(name string) ([]os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, err := m.lookup("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !r.node.isDir() {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: syscall.ENOTDIR}
+	}
+	infos := make([]os.FileInfo, 0, len(r.node.children))
+	for childName, child := range r.node.children {
+		infos = append(infos, newMemFileInfo(childName, child))
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name() < infos[j].Name()
+	})
+	return infos, nil
+}
+
+// Mkdir implements FS.Mkdir.
+func (m *MemFS) Mkdir(name string, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, err := m.create("mkdir", name)
+	if err != nil {
+		return err
+	}
+	r.parent.children[r.base] = m.newNode(os.ModeDir | perm.Perm())
+	r.parent.modTime = m.now()
+	return nil
+}
+
+// MkdirAll implements FS.MkdirAll.
+func (m *MemFS) MkdirAll(name string, perm os.FileMode) error {
+	parts := splitPath(name)
+	for i := range parts {
+		dir := "/" + strings.Join(parts[:i+1], "/")
+		info, err := m.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return &os.PathError{Op: "mkdir", Path: dir, Err: syscall.ENOTDIR}
+			}
+			continue
+		}
+		if err := m.Mkdir(dir, perm); err != nil && !os.IsExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Symlink implements FS.Symlink.
+func (m *MemFS) Symlink(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, err := m.create("symlink", newname)
+	if err != nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err.(*os.PathError).Err}
+	}
+	n := m.newNode(os.ModeSymlink | 0777)
+	n.target = oldname
+	r.parent.children[r.base] = n
+	r.parent.modTime = m.now()
+	return nil
+}
+
+// Readlink implements FS.Readlink.
+func (m *MemFS) Readlink(name string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, err := m.lookup("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if !r.node.isSymlink() {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: syscall.EINVAL}
+	}
+	return r.node.target, nil
+}
+
+// Link implements FS.Link.
+func (m *MemFS) Link(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	linkErr := func(err error) error {
+		if pe, ok := err.(*os.PathError); ok {
+			err = pe.Err
+		}
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: err}
+	}
+	from, err := m.lookup("link", oldname, false)
+	if err != nil {
+		return linkErr(err)
+	}
+	if from.node.isDir() {
+		return linkErr(syscall.EPERM)
+	}
+	to, err := m.create("link", newname)
+	if err != nil {
+		return linkErr(err)
+	}
+	to.parent.children[to.base] = from.node
+	to.parent.modTime = m.now()
+	return nil
+}
+
+// Chmod implements FS.Chmod.
+func (m *MemFS) Chmod(name string, mode os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, err := m.lookup("chmod", name, true)
+	if err != nil {
+		return err
+	}
+	const changeable = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+	r.node.mode = r.node.mode&^changeable | mode&changeable
+	return nil
+}
+
+func (m *MemFS) evalSymlinks(name string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, err := m.lookup("lstat", name, true)
+	if err != nil {
+		return "", err
+	}
+	return filepath.FromSlash(r.path), nil
+}
+
+// memFile is an open file in a MemFS.
+type memFile struct {
+	fs       *MemFS
+	node     *memNode
+	name     string
+	base     string
+	offset   int64
+	readable bool
+	writable bool
+	append   bool
+	closed   bool
+}
+
+func (f *memFile) check(op string, ok bool) error {
+	if f.closed {
+		return &os.PathError{Op: op, Path: f.name, Err: os.ErrClosed}
+	}
+	if !ok {
+		return &os.PathError{Op: op, Path: f.name, Err: syscall.EBADF}
+	}
+	if f.node.isDir() && op != "seek" {
+		return &os.PathError{Op: op, Path: f.name, Err: syscall.EISDIR}
+	}
+	return nil
+}
+
+// Read implements io.Reader.
+func (f *memFile) Read(buf []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.check("read", f.readable); err != nil {
+		return 0, err
+	}
+	if f.offset >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+	n := copy(buf, f.node.data[f.offset:])
+	f.offset += int64(n)
+	return n, nil
+}
+
+// Write implements io.Writer.
+func (f *memFile) Write(buf []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.check("write", f.writable); err != nil {
+		return 0, err
+	}
+	if f.append {
+		f.offset = int64(len(f.node.data))
+	}
+	end := f.offset + int64(len(buf))
+	if end > int64(len(f.node.data)) {
+		data := make([]byte, end)
+		copy(data, f.node.data)
+		f.node.data = data
+	}
+	copy(f.node.data[f.offset:], buf)
+	f.offset = end
+	f.node.modTime = f.fs.now()
+	return len(buf), nil
+}
+
+// Seek implements io.Seeker.
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.check("seek", true); err != nil {
+		return 0, err
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += int64(len(f.node.data))
+	}
+	if offset < 0 {
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: syscall.EINVAL}
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+// Close implements io.Closer.
+func (f *memFile) Close() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.closed {
+		return &os.PathError{Op: "close", Path: f.name, Err: os.ErrClosed}
+	}
+	f.closed = true
+	return nil
+}
+
+// Name implements File.Name.
+func (f *memFile) Name() string {
+	return f.name
+}
+
+// Stat implements File.Stat.
+func (f *memFile) Stat() (os.FileInfo, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.closed {
+		return nil, &os.PathError{Op: "stat", Path: f.name, Err: os.ErrClosed}
+	}
+	return newMemFileInfo(f.base, f.node), nil
+}
+
+// Sync implements File.Sync.
+func (f *memFile) Sync() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.closed {
+		return &os.PathError{Op: "sync", Path: f.name, Err: os.ErrClosed}
+	}
+	return nil
+}
+
+// memFileInfo implements os.FileInfo for a MemFS entry. It is a
+// snapshot taken when the entry was examined.
+type memFileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+	node    *memNode
+}
+
+func newMemFileInfo(name string, n *memNode) *memFileInfo {
+	if name == "" {
+		name = "/"
+	}
+	size := int64(len(n.data))
+	if n.isSymlink() {
+		size = int64(len(n.target))
+	}
+	return &memFileInfo{
+		name:    name,
+		size:    size,
+		mode:    n.mode,
+		modTime: n.modTime,
+		node:    n,
+	}
+}
+
+func (fi *memFileInfo) Name() string       { return fi.name }
+func (fi *memFileInfo) Size() int64        { return fi.size }
+func (fi *memFileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *memFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *memFileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *memFileInfo) Sys() interface{}   { return nil }
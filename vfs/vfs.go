@@ -0,0 +1,212 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package vfs defines a minimal filesystem interface, with
+// implementations backed by the operating system and by memory, so
+// that code which manipulates files can be tested without touching
+// the disk.
+package vfs
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// File is an open file, as returned by FS.Open. It is
+// implemented by *os.File.
+type File interface {
+	io.Reader
+	io.Writer
+	io.Seeker
+	io.Closer
+
+	// Name returns the name of the file as passed to Open.
+	Name() string
+
+	// Stat returns information about the file.
+	Stat() (os.FileInfo, error)
+
+	// Sync commits the contents of the file to stable storage.
+	Sync() error
+}
+
+// FS is a filesystem. Its methods behave like the functions of the
+// same names in the os package, and return errors that may be checked
+// with os.IsNotExist, os.IsExist and so on.
+type FS interface {
+	// Open opens the named file for reading.
+	Open(name string) (File, error)
+
+	// Create creates or truncates the named file,
+	// opening it for reading and writing.
+	Create(name string) (File, error)
+
+	// OpenFile opens the named file with the given
+	// os.O_* flags, creating it with perm if needed.
+	OpenFile(name string, flag int, perm os.FileMode) (File, error)
+
+	// Stat returns information about the named file,
+	// following symbolic links.
+	Stat(name string) (os.FileInfo, error)
+
+	// Lstat returns information about the named file
+	// without following a final symbolic link.
+	Lstat(name string) (os.FileInfo, error)
+
+	// Remove removes the named file or empty directory.
+	Remove(name string) error
+
+	// RemoveAll removes path and anything it contains.
+	// It is not an error if path does not exist.
+	RemoveAll(path string) error
+
+	// Rename renames oldpath to newpath,
+	// replacing any file at newpath.
+	Rename(oldpath, newpath string) error
+
+	// ReadDir returns information about the entries of the named
+	// directory, sorted by name, as returned by Lstat.
+	ReadDir(name string) ([]os.FileInfo, error)
+
+	// Mkdir creates the named directory.
+	Mkdir(name string, perm os.FileMode) error
+
+	// MkdirAll creates the named directory
+	// and any missing parents.
+	MkdirAll(path string, perm os.FileMode) error
+
+	// Symlink creates newname as a symbolic link to oldname.
+	Symlink(oldname, newname string) error
+
+	// Readlink returns the target of the named symbolic link.
+	Readlink(name string) (string, error)
+
+	// Link creates newname as a hard link to oldname.
+	Link(oldname, newname string) error
+
+	// Chmod changes the permission bits of the named file.
+	Chmod(name string, mode os.FileMode) error
+}
+
+// OS is the FS backed by the operating system.
+var OS FS = osFS{}
+
+type osFS struct{}
+
+func (osFS) Open(name string) (File, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (osFS) Create(name string) (File, error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (osFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	f, err := os.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (osFS) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (osFS) Lstat(name string) (os.FileInfo, error) {
+	return os.Lstat(name)
+}
+
+func (osFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (osFS) RemoveAll(path string) error {
+	return os.RemoveAll(path)
+}
+
+func (osFS) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+func (osFS) ReadDir(name string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(name)
+}
+
+func (osFS) Mkdir(name string, perm os.FileMode) error {
+	return os.Mkdir(name, perm)
+}
+
+func (osFS) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+func (osFS) Symlink(oldname, newname string) error {
+	return os.Symlink(oldname, newname)
+}
+
+func (osFS) Readlink(name string) (string, error) {
+	return os.Readlink(name)
+}
+
+func (osFS) Link(oldname, newname string) error {
+	return os.Link(oldname, newname)
+}
+
+func (osFS) Chmod(name string, mode os.FileMode) error {
+	return os.Chmod(name, mode)
+}
+
+// ReadFile returns the contents of the named file in fsys.
+func ReadFile(fsys FS, name string) ([]byte, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+// WriteFile writes data to the named file in fsys, creating it
+// with perm if necessary and truncating it otherwise.
+func WriteFile(fsys FS, name string, data []byte, perm os.FileMode) error {
+	f, err := fsys.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// SameFile reports whether fi1 and fi2, as returned by the same FS,
+// describe the same file.
+func SameFile(fi1, fi2 os.FileInfo) bool {
+	m1, ok1 := fi1.(*memFileInfo)
+	m2, ok2 := fi2.(*memFileInfo)
+	if ok1 || ok2 {
+		return ok1 && ok2 && m1.node == m2.node
+	}
+	return os.SameFile(fi1, fi2)
+}
+
+// EvalSymlinks returns the path name after the evaluation of any
+// symbolic links in fsys, like filepath.EvalSymlinks.
+func EvalSymlinks(fsys FS, path string) (string, error) {
+	if m, ok := fsys.(*MemFS); ok {
+		return m.evalSymlinks(path)
+	}
+	return filepath.EvalSymlinks(path)
+}
@@ -0,0 +1,225 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package vfs_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/vfs"
+)
+
+// fsSuite holds tests that are run against both
+// the OS and the in-memory filesystem.
+type fsSuite struct {
+	fs   vfs.FS
+	root func(c *gc.C) string
+}
+
+var _ = gc.Suite(&fsSuite{
+	fs:   vfs.OS,
+	root: func(c *gc.C) string { return c.MkDir() },
+})
+
+var _ = gc.Suite(&fsSuite{
+	fs:   vfs.NewMemFS(),
+	root: func(c *gc.C) string { return "/" + filepath.Base(c.MkDir()) },
+})
+
+func (s *fsSuite) dir(c *gc.C) string {
+	dir := s.root(c)
+	c.Assert(s.fs.MkdirAll(dir, 0755), jc.ErrorIsNil)
+	return dir
+}
+
+func (s *fsSuite) TestWriteReadFile(c *gc.C) {
+	dir := s.dir(c)
+	path := filepath.Join(dir, "file")
+	err := vfs.WriteFile(s.fs, path, []byte("hello"), 0644)
+	c.Assert(err, jc.ErrorIsNil)
+	data, err := vfs.ReadFile(s.fs, path)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(data), gc.Equals, "hello")
+
+	info, err := s.fs.Stat(path)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(info.Name(), gc.Equals, "file")
+	c.Check(info.Size(), gc.Equals, int64(5))
+	c.Check(info.Mode().IsRegular(), jc.IsTrue)
+}
+
+func (s *fsSuite) TestOpenNotExist(c *gc.C) {
+	dir := s.dir(c)
+	_, err := s.fs.Open(filepath.Join(dir, "missing"))
+	c.Check(err, jc.Satisfies, os.IsNotExist)
+	_, err = s.fs.Stat(filepath.Join(dir, "missing", "file"))
+	c.Check(err, jc.Satisfies, os.IsNotExist)
+}
+
+func (s *fsSuite) TestCreateExclusive(c *gc.C) {
+	dir := s.dir(c)
+	path := filepath.Join(dir, "file")
+	f, err := s.fs.Create(path)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(f.Close(), jc.ErrorIsNil)
+	_, err = s.fs.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	c.Check(err, jc.Satisfies, os.IsExist)
+}
+
+func (s *fsSuite) TestSeekAndAppend(c *gc.C) {
+	dir := s.dir(c)
+	path := filepath.Join(dir, "file")
+	c.Assert(vfs.WriteFile(s.fs, path, []byte("hello"), 0644), jc.ErrorIsNil)
+
+	f, err := s.fs.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = f.Write([]byte(" world"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(f.Close(), jc.ErrorIsNil)
+
+	f, err = s.fs.Open(path)
+	c.Assert(err, jc.ErrorIsNil)
+	defer f.Close()
+	_, err = f.Seek(6, io.SeekStart)
+	c.Assert(err, jc.ErrorIsNil)
+	buf := make([]byte, 10)
+	n, err := f.Read(buf)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(buf[:n]), gc.Equals, "world")
+}
+
+func (s *fsSuite) TestRemove(c *gc.C) {
+	dir := s.dir(c)
+	sub := filepath.Join(dir, "sub")
+	c.Assert(s.fs.Mkdir(sub, 0755), jc.ErrorIsNil)
+	c.Assert(vfs.WriteFile(s.fs, filepath.Join(sub, "file"), nil, 0644), jc.ErrorIsNil)
+
+	c.Check(s.fs.Remove(sub), gc.NotNil)
+	c.Assert(s.fs.Remove(filepath.Join(sub, "file")), jc.ErrorIsNil)
+	c.Assert(s.fs.Remove(sub), jc.ErrorIsNil)
+	c.Check(s.fs.Remove(sub), jc.Satisfies, os.IsNotExist)
+}
+
+func (s *fsSuite) TestRemoveAll(c *gc.C) {
+	dir := s.dir(c)
+	sub := filepath.Join(dir, "a", "b")
+	c.Assert(s.fs.MkdirAll(sub, 0755), jc.ErrorIsNil)
+	c.Assert(vfs.WriteFile(s.fs, filepath.Join(sub, "file"), nil, 0644), jc.ErrorIsNil)
+
+	c.Assert(s.fs.RemoveAll(filepath.Join(dir, "a")), jc.ErrorIsNil)
+	_, err := s.fs.Stat(filepath.Join(dir, "a"))
+	c.Check(err, jc.Satisfies, os.IsNotExist)
+	c.Check(s.fs.RemoveAll(filepath.Join(dir, "a")), jc.ErrorIsNil)
+}
+
+func (s *fsSuite) TestRename(c *gc.C) {
+	dir := s.dir(c)
+	from := filepath.Join(dir, "from")
+	to := filepath.Join(dir, "to")
+	c.Assert(vfs.WriteFile(s.fs, from, []byte("new"), 0644), jc.ErrorIsNil)
+	c.Assert(vfs.WriteFile(s.fs, to, []byte("old"), 0644), jc.ErrorIsNil)
+
+	c.Assert(s.fs.Rename(from, to), jc.ErrorIsNil)
+	data, err := vfs.ReadFile(s.fs, to)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(data), gc.Equals, "new")
+	_, err = s.fs.Stat(from)
+	c.Check(err, jc.Satisfies, os.IsNotExist)
+}
+
+func (s *fsSuite) TestReadDir(c *gc.C) {
+	dir := s.dir(c)
+	for _, name := range []string{"c", "a", "b"} {
+		c.Assert(vfs.WriteFile(s.fs, filepath.Join(dir, name), nil, 0644), jc.ErrorIsNil)
+	}
+	infos, err := s.fs.ReadDir(dir)
+	c.Assert(err, jc.ErrorIsNil)
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	c.Check(names, jc.DeepEquals, []string{"a", "b", "c"})
+}
+
+func (s *fsSuite) TestSymlink(c *gc.C) {
+	dir := s.dir(c)
+	c.Assert(s.fs.Mkdir(filepath.Join(dir, "real"), 0755), jc.ErrorIsNil)
+	c.Assert(vfs.WriteFile(s.fs, filepath.Join(dir, "real", "file"), []byte("data"), 0644), jc.ErrorIsNil)
+	c.Assert(s.fs.Symlink("real", filepath.Join(dir, "link")), jc.ErrorIsNil)
+
+	target, err := s.fs.Readlink(filepath.Join(dir, "link"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(target, gc.Equals, "real")
+	info, err := s.fs.Lstat(filepath.Join(dir, "link"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(info.Mode()&os.ModeSymlink, gc.Equals, os.ModeSymlink)
+	info, err = s.fs.Stat(filepath.Join(dir, "link"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(info.IsDir(), jc.IsTrue)
+
+	data, err := vfs.ReadFile(s.fs, filepath.Join(dir, "link", "file"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(data), gc.Equals, "data")
+
+	resolved, err := vfs.EvalSymlinks(s.fs, filepath.Join(dir, "link", "file"))
+	c.Assert(err, jc.ErrorIsNil)
+	real, err := vfs.EvalSymlinks(s.fs, filepath.Join(dir, "real", "file"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(resolved, gc.Equals, real)
+}
+
+func (s *fsSuite) TestLink(c *gc.C) {
+	dir := s.dir(c)
+	path := filepath.Join(dir, "file")
+	c.Assert(vfs.WriteFile(s.fs, path, []byte("data"), 0644), jc.ErrorIsNil)
+	c.Assert(s.fs.Link(path, filepath.Join(dir, "hard")), jc.ErrorIsNil)
+
+	info1, err := s.fs.Stat(path)
+	c.Assert(err, jc.ErrorIsNil)
+	info2, err := s.fs.Stat(filepath.Join(dir, "hard"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(vfs.SameFile(info1, info2), jc.IsTrue)
+}
+
+func (s *fsSuite) TestChmod(c *gc.C) {
+	dir := s.dir(c)
+	path := filepath.Join(dir, "file")
+	c.Assert(vfs.WriteFile(s.fs, path, nil, 0644), jc.ErrorIsNil)
+	c.Assert(s.fs.Chmod(path, 0600), jc.ErrorIsNil)
+	info, err := s.fs.Stat(path)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(info.Mode().Perm(), gc.Equals, os.FileMode(0600))
+}
+
+type memSuite struct{}
+
+var _ = gc.Suite(&memSuite{})
+
+func (*memSuite) TestSymlinkLoop(c *gc.C) {
+	fsys := vfs.NewMemFS()
+	c.Assert(fsys.Symlink("/b", "/a"), jc.ErrorIsNil)
+	c.Assert(fsys.Symlink("/a", "/b"), jc.ErrorIsNil)
+	_, err := fsys.Stat("/a")
+	c.Check(err, gc.ErrorMatches, "stat /a: too many levels of symbolic links")
+}
+
+func (*memSuite) TestRenameIntoSelf(c *gc.C) {
+	fsys := vfs.NewMemFS()
+	c.Assert(fsys.MkdirAll("/a/b", 0755), jc.ErrorIsNil)
+	err := fsys.Rename("/a", "/a/b/c")
+	c.Check(err, gc.ErrorMatches, "rename /a /a/b/c: invalid argument")
+}
+
+func (*memSuite) TestClosedFile(c *gc.C) {
+	fsys := vfs.NewMemFS()
+	f, err := fsys.Create("/file")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(f.Close(), jc.ErrorIsNil)
+	_, err = f.Write([]byte("x"))
+	c.Check(err, gc.ErrorMatches, "write /file: file already closed")
+}
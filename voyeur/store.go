@@ -0,0 +1,259 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package voyeur
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+)
+
+// ErrClosed is returned by StoreWatcher.Next when
+// the watcher or its Store has been closed.
+var ErrClosed = errors.New("voyeur: closed")
+
+// Store holds a set of keyed values that can be watched for changes,
+// either individually or together. Every change to the store increments
+// its version. Methods on a Store may be called concurrently.
+type Store struct {
+	mu       sync.Mutex
+	version  int64
+	values   map[string]interface{}
+	watchers map[*StoreWatcher]struct{}
+	closed   bool
+	done     chan struct{}
+}
+
+// NewStore returns a new, empty, Store.
+func NewStore() *Store {
+	return &Store{
+		values:   make(map[string]interface{}),
+		watchers: make(map[*StoreWatcher]struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Set sets the value for key.
+func (s *Store) Set(key string, val interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = val
+	s.changed(key)
+}
+
+// Delete removes key from the store. Watchers of the key are
+// notified if it was present.
+func (s *Store) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.values[key]; !ok {
+		return
+	}
+	delete(s.values, key)
+	s.changed(key)
+}
+
+// changed records a change to key and notifies the interested
+// watchers. It is called with s.mu held.
+func (s *Store) changed(key string) {
+	s.version++
+	for w := range s.watchers {
+		if w.watches(key) {
+			w.pending[key] = struct{}{}
+			w.notify()
+		}
+	}
+}
+
+// Get returns the value for key and whether it is set.
+func (s *Store) Get(key string) (interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	val, ok := s.values[key]
+	return val, ok
+}
+
+// Version returns the number of changes made to the store.
+func (s *Store) Version() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.version
+}
+
+// Snapshot holds the values in a Store at a given version.
+type Snapshot struct {
+	// Version holds the version of the store
+	// when the snapshot was taken.
+	Version int64
+
+	// Values holds the values in the snapshot.
+	Values map[string]interface{}
+}
+
+// Snapshot returns a consistent copy of the values for the given
+// keys, or of all values if no keys are given. Keys that are not set
+// are omitted.
+func (s *Store) Snapshot(keys ...string) Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snap := Snapshot{
+		Version: s.version,
+		Values:  make(map[string]interface{}),
+	}
+	if len(keys) == 0 {
+		for key, val := range s.values {
+			snap.Values[key] = val
+		}
+		return snap
+	}
+	for _, key := range keys {
+		if val, ok := s.values[key]; ok {
+			snap.Values[key] = val
+		}
+	}
+	return snap
+}
+
+// Close closes the store, causing all outstanding and future calls
+// to StoreWatcher.Next to return ErrClosed. Close always returns nil.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+	}
+	return nil
+}
+
+// Watch returns a watcher that is notified of changes to the given
+// keys, or to any key if none are given. The first call to Next
+// reports the watched keys that are already set. The watcher must be
+// closed when it is no longer needed.
+func (s *Store) Watch(keys ...string) *StoreWatcher {
+	w := &StoreWatcher{
+		store:   s,
+		pending: make(map[string]struct{}),
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	if len(keys) > 0 {
+		w.keys = make(map[string]struct{})
+		for _, key := range keys {
+			w.keys[key] = struct{}{}
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key := range s.values {
+		if w.watches(key) {
+			w.pending[key] = struct{}{}
+		}
+	}
+	if len(w.pending) > 0 {
+		w.notify()
+	}
+	s.watchers[w] = struct{}{}
+	return w
+}
+
+// StoreWatcher watches some or all of the keys in a Store.
+type StoreWatcher struct {
+	store *Store
+
+	// keys holds the keys being watched,
+	// or nil if all keys are watched.
+	keys map[string]struct{}
+
+	// The following fields are guarded by store.mu.
+	pending map[string]struct{}
+	changed []string
+	version int64
+	closed  bool
+
+	wake chan struct{}
+	done chan struct{}
+}
+
+func (w *StoreWatcher) watches(key string) bool {
+	if w.keys == nil {
+		return true
+	}
+	_, ok := w.keys[key]
+	return ok
+}
+
+// notify wakes any call to Next without blocking.
+func (w *StoreWatcher) notify() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Next blocks until any of the watched keys has changed since the
+// previous call, then records the changed keys and the store version.
+// It returns ErrClosed if the watcher or the store is closed, or the
+// context's error if the context is done first.
+func (w *StoreWatcher) Next(ctx context.Context) error {
+	for {
+		s := w.store
+		s.mu.Lock()
+		if w.closed || s.closed {
+			s.mu.Unlock()
+			return ErrClosed
+		}
+		if len(w.pending) > 0 {
+			changed := make([]string, 0, len(w.pending))
+			for key := range w.pending {
+				changed = append(changed, key)
+			}
+			sort.Strings(changed)
+			w.changed = changed
+			w.version = s.version
+			w.pending = make(map[string]struct{})
+			s.mu.Unlock()
+			return nil
+		}
+		s.mu.Unlock()
+		select {
+		case <-w.wake:
+		case <-w.done:
+		case <-s.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Changed returns the keys, in sorted order, reported
+// as changed by the last successful call to Next.
+func (w *StoreWatcher) Changed() []string {
+	w.store.mu.Lock()
+	defer w.store.mu.Unlock()
+	return append([]string(nil), w.changed...)
+}
+
+// Version returns the version of the store as seen
+// by the last successful call to Next.
+func (w *StoreWatcher) Version() int64 {
+	w.store.mu.Lock()
+	defer w.store.mu.Unlock()
+	return w.version
+}
+
+// Close stops the watcher and releases its resources without closing
+// the store. It may be called concurrently with Next.
+func (w *StoreWatcher) Close() {
+	s := w.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if w.closed {
+		return
+	}
+	w.closed = true
+	delete(s.watchers, w)
+	close(w.done)
+}
@@ -0,0 +1,153 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package voyeur
+
+import (
+	"context"
+	"time"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type storeSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&storeSuite{})
+
+func (s *storeSuite) TestSetGetDelete(c *gc.C) {
+	st := NewStore()
+	st.Set("a", 1)
+	st.Set("b", 2)
+	val, ok := st.Get("a")
+	c.Check(ok, jc.IsTrue)
+	c.Check(val, gc.Equals, 1)
+	st.Delete("a")
+	st.Delete("a")
+	_, ok = st.Get("a")
+	c.Check(ok, jc.IsFalse)
+	c.Check(st.Version(), gc.Equals, int64(3))
+}
+
+func (s *storeSuite) TestSnapshot(c *gc.C) {
+	st := NewStore()
+	st.Set("a", 1)
+	st.Set("b", 2)
+	snap := st.Snapshot()
+	c.Check(snap, jc.DeepEquals, Snapshot{
+		Version: 2,
+		Values:  map[string]interface{}{"a": 1, "b": 2},
+	})
+	st.Set("a", 3)
+	c.Check(snap.Values["a"], gc.Equals, 1)
+	c.Check(st.Snapshot("a", "c"), jc.DeepEquals, Snapshot{
+		Version: 3,
+		Values:  map[string]interface{}{"a": 3},
+	})
+}
+
+func (s *storeSuite) TestWatchKeys(c *gc.C) {
+	st := NewStore()
+	st.Set("a", 1)
+	st.Set("other", 1)
+	w := st.Watch("a", "b")
+	defer w.Close()
+	ctx := context.Background()
+
+	// The initial call reports the watched keys already set.
+	c.Assert(w.Next(ctx), jc.ErrorIsNil)
+	c.Check(w.Changed(), jc.DeepEquals, []string{"a"})
+	c.Check(w.Version(), gc.Equals, int64(2))
+
+	st.Set("other", 2)
+	st.Set("b", 1)
+	st.Set("a", 2)
+	c.Assert(w.Next(ctx), jc.ErrorIsNil)
+	c.Check(w.Changed(), jc.DeepEquals, []string{"a", "b"})
+	c.Check(w.Version(), gc.Equals, int64(5))
+
+	st.Delete("a")
+	c.Assert(w.Next(ctx), jc.ErrorIsNil)
+	c.Check(w.Changed(), jc.DeepEquals, []string{"a"})
+}
+
+func (s *storeSuite) TestWatchAll(c *gc.C) {
+	st := NewStore()
+	w := st.Watch()
+	defer w.Close()
+	done := make(chan error)
+	go func() {
+		done <- w.Next(context.Background())
+	}()
+	select {
+	case err := <-done:
+		c.Fatalf("Next returned early: %v", err)
+	case <-time.After(testing.ShortWait):
+	}
+	st.Set("x", 1)
+	select {
+	case err := <-done:
+		c.Assert(err, jc.ErrorIsNil)
+	case <-time.After(testing.LongWait):
+		c.Fatalf("Next did not return")
+	}
+	c.Check(w.Changed(), jc.DeepEquals, []string{"x"})
+}
+
+func (s *storeSuite) TestNextContext(c *gc.C) {
+	st := NewStore()
+	w := st.Watch("a")
+	defer w.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.Check(w.Next(ctx), gc.Equals, context.Canceled)
+}
+
+func (s *storeSuite) TestWatcherClose(c *gc.C) {
+	st := NewStore()
+	w := st.Watch("a")
+	done := make(chan error)
+	go func() {
+		done <- w.Next(context.Background())
+	}()
+	w.Close()
+	w.Close()
+	select {
+	case err := <-done:
+		c.Check(err, gc.Equals, ErrClosed)
+	case <-time.After(testing.LongWait):
+		c.Fatalf("Next did not return")
+	}
+	// Closed watchers are forgotten by the store.
+	c.Check(st.watchers, gc.HasLen, 0)
+	st.Set("a", 1)
+	c.Check(w.Next(context.Background()), gc.Equals, ErrClosed)
+}
+
+func (s *storeSuite) TestStoreClose(c *gc.C) {
+	st := NewStore()
+	w1 := st.Watch("a")
+	w2 := st.Watch()
+	defer w1.Close()
+	defer w2.Close()
+	done := make(chan error, 2)
+	for _, w := range []*StoreWatcher{w1, w2} {
+		w := w
+		go func() {
+			done <- w.Next(context.Background())
+		}()
+	}
+	c.Assert(st.Close(), jc.ErrorIsNil)
+	c.Assert(st.Close(), jc.ErrorIsNil)
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-done:
+			c.Check(err, gc.Equals, ErrClosed)
+		case <-time.After(testing.LongWait):
+			c.Fatalf("Next did not return")
+		}
+	}
+}
@@ -2,7 +2,7 @@
 // Licensed under the LGPLv3, see LICENCE file for details.
 
 // Package voyeur implements a concurrency-safe value that can be watched for
-// changes.
+// changes, and a store of keyed values that can be watched together.
 package voyeur
 
 import (
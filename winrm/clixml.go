@@ -0,0 +1,487 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package winrm
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/juju/errors"
+)
+
+// Object is a PowerShell object received from the remote host.
+// PowerShell remoting serializes objects as CLIXML, which records
+// their types and properties rather than the objects themselves.
+type Object struct {
+	// TypeNames holds the names of the object's type and its base
+	// types, most derived first.
+	TypeNames []string
+
+	// ToString holds the result of calling ToString on the object.
+	ToString string
+
+	// Value holds the value wrapped by the object, if any. Enums and
+	// other primitive types hold their value, lists hold a slice and
+	// dictionaries hold a map keyed by the string form of each key.
+	Value interface{}
+
+	// Properties holds the object's properties by name.
+	Properties map[string]interface{}
+}
+
+// String returns the string form of the object.
+func (o *Object) String() string {
+	if o.ToString != "" || o.Value == nil {
+		return o.ToString
+	}
+	return fmt.Sprint(o.Value)
+}
+
+// Property returns the value of the named property,
+// or nil if the object has no such property.
+func (o *Object) Property(name string) interface{} {
+	return o.Properties[name]
+}
+
+// stringOf returns the string form of a deserialized value.
+func stringOf(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case *Object:
+		return v.String()
+	}
+	return fmt.Sprint(v)
+}
+
+// clixmlDecoder deserializes CLIXML.
+type clixmlDecoder struct {
+	d     *xml.Decoder
+	refs  map[string]*Object
+	types map[string][]string
+}
+
+// parseCLIXML deserializes a single CLIXML value.
+func parseCLIXML(data []byte) (interface{}, error) {
+	d := &clixmlDecoder{
+		d:     xml.NewDecoder(bytes.NewReader(data)),
+		refs:  make(map[string]*Object),
+		types: make(map[string][]string),
+	}
+	for {
+		tok, err := d.d.Token()
+		if err == io.EOF {
+			return nil, errors.New("no CLIXML value found")
+		}
+		if err != nil {
+			return nil, errors.Annotate(err, "cannot parse CLIXML")
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			_, v, err := d.value(start)
+			return v, errors.Annotate(err, "cannot parse CLIXML")
+		}
+	}
+}
+
+// value decodes the element that starts with start, returning the
+// name of the property it holds, if any, and its value.
+func (d *clixmlDecoder) value(start xml.StartElement) (string, interface{}, error) {
+	name := attr(start, "N")
+	switch start.Name.Local {
+	case "Obj":
+		v, err := d.object(start)
+		return name, v, err
+	case "Ref":
+		if err := d.d.Skip(); err != nil {
+			return "", nil, err
+		}
+		obj, ok := d.refs[attr(start, "RefId")]
+		if !ok {
+			return "", nil, errors.Errorf("unknown object reference %q", attr(start, "RefId"))
+		}
+		return name, obj, nil
+	case "Nil":
+		return name, nil, d.d.Skip()
+	}
+	text, err := d.text()
+	if err != nil {
+		return "", nil, err
+	}
+	v, err := primitive(start.Name.Local, text)
+	return name, v, err
+}
+
+// object decodes an Obj element.
+func (d *clixmlDecoder) object(start xml.StartElement) (*Object, error) {
+	obj := &Object{Properties: make(map[string]interface{})}
+	if id := attr(start, "RefId"); id != "" {
+		d.refs[id] = obj
+	}
+	for {
+		tok, err := d.d.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch tok := tok.(type) {
+		case xml.EndElement:
+			return obj, nil
+		case xml.StartElement:
+			if err := d.objectElement(obj, tok); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (d *clixmlDecoder) objectElement(obj *Object, start xml.StartElement) error {
+	switch start.Name.Local {
+	case "TN":
+		var tn struct {
+			T []string `xml:"T"`
+		}
+		if err := d.d.DecodeElement(&tn, &start); err != nil {
+			return err
+		}
+		d.types[attr(start, "RefId")] = tn.T
+		obj.TypeNames = tn.T
+		return nil
+	case "TNRef":
+		obj.TypeNames = d.types[attr(start, "RefId")]
+		return d.d.Skip()
+	case "ToString":
+		text, err := d.text()
+		obj.ToString = decodeString(text)
+		return err
+	case "MS", "Props":
+		return d.children(func(name string, v interface{}) {
+			obj.Properties[name] = v
+		})
+	case "LST", "IE", "STK", "QUE":
+		list := []interface{}{}
+		err := d.children(func(_ string, v interface{}) {
+			list = append(list, v)
+		})
+		obj.Value = list
+		return err
+	case "DCT":
+		dict := make(map[string]interface{})
+		err := d.children(func(_ string, v interface{}) {
+			if en, ok := v.(*Object); ok {
+				dict[stringOf(en.Properties["Key"])] = en.Properties["Value"]
+			}
+		})
+		obj.Value = dict
+		return err
+	case "En":
+		// Dictionary entries are decoded as objects
+		// with Key and Value properties.
+		return d.children(func(name string, v interface{}) {
+			obj.Properties[name] = v
+		})
+	}
+	_, v, err := d.value(start)
+	obj.Value = v
+	return err
+}
+
+// children decodes each child element of the current element,
+// calling f with its name and value.
+func (d *clixmlDecoder) children(f func(name string, v interface{})) error {
+	for {
+		tok, err := d.d.Token()
+		if err != nil {
+			return err
+		}
+		switch tok := tok.(type) {
+		case xml.EndElement:
+			return nil
+		case xml.StartElement:
+			if tok.Name.Local == "En" {
+				en := &Object{Properties: make(map[string]interface{})}
+				if err := d.objectElement(en, tok); err != nil {
+					return err
+				}
+				f("", en)
+				continue
+			}
+			name, v, err := d.value(tok)
+			if err != nil {
+				return err
+			}
+			f(name, v)
+		}
+	}
+}
+
+// text returns the text content of the current element.
+func (d *clixmlDecoder) text() (string, error) {
+	var sb strings.Builder
+	for {
+		tok, err := d.d.Token()
+		if err != nil {
+			return "", err
+		}
+		switch tok := tok.(type) {
+		case xml.CharData:
+			sb.Write(tok)
+		case xml.StartElement:
+			if err := d.d.Skip(); err != nil {
+				return "", err
+			}
+		case xml.EndElement:
+			return sb.String(), nil
+		}
+	}
+}
+
+// primitive decodes the text of a primitive CLIXML element.
+func primitive(tag, text string) (interface{}, error) {
+	var (
+		v   interface{}
+		err error
+	)
+	switch tag {
+	case "S", "URI", "XD", "SBK", "SS":
+		return decodeString(text), nil
+	case "C":
+		var c uint64
+		c, err = strconv.ParseUint(text, 10, 16)
+		v = string(rune(c))
+	case "B":
+		v, err = strconv.ParseBool(text)
+	case "By":
+		var n uint64
+		n, err = strconv.ParseUint(text, 10, 8)
+		v = uint8(n)
+	case "SB":
+		var n int64
+		n, err = strconv.ParseInt(text, 10, 8)
+		v = int8(n)
+	case "U16":
+		var n uint64
+		n, err = strconv.ParseUint(text, 10, 16)
+		v = uint16(n)
+	case "I16":
+		var n int64
+		n, err = strconv.ParseInt(text, 10, 16)
+		v = int16(n)
+	case "U32":
+		var n uint64
+		n, err = strconv.ParseUint(text, 10, 32)
+		v = uint32(n)
+	case "I32":
+		var n int64
+		n, err = strconv.ParseInt(text, 10, 32)
+		v = int32(n)
+	case "U64":
+		v, err = strconv.ParseUint(text, 10, 64)
+	case "I64":
+		v, err = strconv.ParseInt(text, 10, 64)
+	case "Sg":
+		var f float64
+		f, err = strconv.ParseFloat(text, 32)
+		v = float32(f)
+	case "Db", "D":
+		v, err = strconv.ParseFloat(text, 64)
+	case "DT":
+		v, err = time.Parse(time.RFC3339Nano, text)
+	case "BA":
+		v, err = base64.StdEncoding.DecodeString(text)
+	default:
+		// Durations, GUIDs, versions and any types added in
+		// later versions of the protocol are left as text.
+		return text, nil
+	}
+	if err != nil {
+		return nil, errors.Errorf("invalid %s value %q", tag, text)
+	}
+	return v, nil
+}
+
+func attr(start xml.StartElement, name string) string {
+	for _, a := range start.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// decodeString decodes the _xHHHH_ escape sequences used by CLIXML
+// to represent characters that cannot appear in XML.
+func decodeString(s string) string {
+	if !strings.Contains(s, "_x") {
+		return s
+	}
+	var units []uint16
+	for i := 0; i < len(s); {
+		if i+7 <= len(s) && s[i] == '_' && s[i+1] == 'x' && s[i+6] == '_' {
+			if n, err := strconv.ParseUint(s[i+2:i+6], 16, 16); err == nil {
+				units = append(units, uint16(n))
+				i += 7
+				continue
+			}
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		units = append(units, utf16.Encode([]rune{r})...)
+		i += size
+	}
+	return string(utf16.Decode(units))
+}
+
+// encodeString escapes s for use as the text of a CLIXML element.
+func encodeString(s string) string {
+	var sb strings.Builder
+	for i, r := range s {
+		switch {
+		case r == '_' && strings.HasPrefix(s[i:], "_x"):
+			sb.WriteString("_x005F_")
+		case r < 0x20 || (r >= 0x7f && r <= 0x9f) || r == 0xfffe || r == 0xffff:
+			fmt.Fprintf(&sb, "_x%04X_", r)
+		case r > 0xffff:
+			for _, u := range utf16.Encode([]rune{r}) {
+				fmt.Fprintf(&sb, "_x%04X_", u)
+			}
+		default:
+			xml.EscapeText(&sb, []byte(string(r)))
+		}
+	}
+	return sb.String()
+}
+
+// clixmlWriter serializes values as CLIXML.
+type clixmlWriter struct {
+	buf    bytes.Buffer
+	refIDs int
+	tnIDs  int
+}
+
+// String returns the CLIXML written so far.
+func (w *clixmlWriter) String() string {
+	return w.buf.String()
+}
+
+func nameAttr(name string) string {
+	if name == "" {
+		return ""
+	}
+	return fmt.Sprintf(` N="%s"`, encodeString(name))
+}
+
+// primitive writes a primitive element with the given text.
+func (w *clixmlWriter) primitive(tag, name, text string) {
+	fmt.Fprintf(&w.buf, "<%s%s>%s</%s>", tag, nameAttr(name), text, tag)
+}
+
+// object writes an object of the given types, calling body to
+// write its contents.
+func (w *clixmlWriter) object(name string, typeNames []string, body func()) {
+	fmt.Fprintf(&w.buf, `<Obj%s RefId="%d">`, nameAttr(name), w.refIDs)
+	w.refIDs++
+	if len(typeNames) > 0 {
+		fmt.Fprintf(&w.buf, `<TN RefId="%d">`, w.tnIDs)
+		w.tnIDs++
+		for _, t := range typeNames {
+			fmt.Fprintf(&w.buf, "<T>%s</T>", encodeString(t))
+		}
+		w.buf.WriteString("</TN>")
+	}
+	body()
+	w.buf.WriteString("</Obj>")
+}
+
+// properties writes an object's properties, calling body to
+// write each of them.
+func (w *clixmlWriter) properties(body func()) {
+	w.buf.WriteString("<MS>")
+	body()
+	w.buf.WriteString("</MS>")
+}
+
+// list writes a list of values, calling body to write each of them.
+func (w *clixmlWriter) list(name string, typeNames []string, body func()) {
+	w.object(name, typeNames, func() {
+		w.buf.WriteString("<LST>")
+		body()
+		w.buf.WriteString("</LST>")
+	})
+}
+
+// enum writes an enum value.
+func (w *clixmlWriter) enum(name, typeName, str string, value int32) {
+	w.object(name, []string{typeName, "System.Enum", "System.ValueType", "System.Object"}, func() {
+		w.primitive("ToString", "", encodeString(str))
+		w.primitive("I32", "", strconv.FormatInt(int64(value), 10))
+	})
+}
+
+// value writes an arbitrary Go value as the closest PowerShell type.
+func (w *clixmlWriter) value(name string, v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		fmt.Fprintf(&w.buf, "<Nil%s />", nameAttr(name))
+	case string:
+		w.primitive("S", name, encodeString(v))
+	case bool:
+		w.primitive("B", name, strconv.FormatBool(v))
+	case int:
+		if v >= math.MinInt32 && v <= math.MaxInt32 {
+			w.primitive("I32", name, strconv.Itoa(v))
+		} else {
+			w.primitive("I64", name, strconv.Itoa(v))
+		}
+	case int32:
+		w.primitive("I32", name, strconv.FormatInt(int64(v), 10))
+	case int64:
+		w.primitive("I64", name, strconv.FormatInt(v, 10))
+	case uint32:
+		w.primitive("U32", name, strconv.FormatUint(uint64(v), 10))
+	case uint64:
+		w.primitive("U64", name, strconv.FormatUint(v, 10))
+	case float64:
+		w.primitive("Db", name, strconv.FormatFloat(v, 'g', -1, 64))
+	case []byte:
+		w.primitive("BA", name, base64.StdEncoding.EncodeToString(v))
+	case time.Time:
+		w.primitive("DT", name, v.Format(time.RFC3339Nano))
+	case []string:
+		w.list(name, arrayTypes, func() {
+			for _, s := range v {
+				w.value("", s)
+			}
+		})
+	case []interface{}:
+		w.list(name, arrayTypes, func() {
+			for _, e := range v {
+				w.value("", e)
+			}
+		})
+	case map[string]interface{}:
+		w.object(name, []string{"System.Collections.Hashtable", "System.Object"}, func() {
+			w.buf.WriteString("<DCT>")
+			for key, e := range v {
+				w.buf.WriteString("<En>")
+				w.value("Key", key)
+				w.value("Value", e)
+				w.buf.WriteString("</En>")
+			}
+			w.buf.WriteString("</DCT>")
+		})
+	default:
+		w.primitive("S", name, encodeString(fmt.Sprint(v)))
+	}
+}
+
+var arrayTypes = []string{"System.Object[]", "System.Array", "System.Object"}
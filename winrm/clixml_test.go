@@ -0,0 +1,174 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package winrm
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type CLIXMLSuite struct{}
+
+var _ = gc.Suite(&CLIXMLSuite{})
+
+var primitiveTests = []struct {
+	clixml string
+	expect interface{}
+}{
+	{`<S>hello</S>`, "hello"},
+	{`<S>a_x000D__x000A_b</S>`, "a\r\nb"},
+	{`<S>_x005F_x0041_</S>`, "_x0041_"},
+	{`<S>_xD83D__xDE00_</S>`, "\U0001F600"},
+	{`<S>&lt;tag&gt; &amp; ünïcode</S>`, "<tag> & ünïcode"},
+	{`<C>65</C>`, "A"},
+	{`<B>true</B>`, true},
+	{`<By>255</By>`, uint8(255)},
+	{`<SB>-1</SB>`, int8(-1)},
+	{`<I16>-300</I16>`, int16(-300)},
+	{`<U16>300</U16>`, uint16(300)},
+	{`<I32>-7</I32>`, int32(-7)},
+	{`<U32>7</U32>`, uint32(7)},
+	{`<I64>9000000000</I64>`, int64(9000000000)},
+	{`<U64>9000000000</U64>`, uint64(9000000000)},
+	{`<Sg>1.5</Sg>`, float32(1.5)},
+	{`<Db>2.25</Db>`, 2.25},
+	{`<D>10.5</D>`, 10.5},
+	{`<DT>2022-03-04T05:06:07.5Z</DT>`, time.Date(2022, 3, 4, 5, 6, 7, 500000000, time.UTC)},
+	{`<BA>AQID</BA>`, []byte{1, 2, 3}},
+	{`<G>792e5b37-4505-47ef-b7d2-8711bb7affa8</G>`, "792e5b37-4505-47ef-b7d2-8711bb7affa8"},
+	{`<Version>2.3</Version>`, "2.3"},
+	{`<TS>PT9.0269026S</TS>`, "PT9.0269026S"},
+	{`<Nil />`, nil},
+}
+
+func (*CLIXMLSuite) TestPrimitives(c *gc.C) {
+	for i, test := range primitiveTests {
+		c.Logf("test %d: %s", i, test.clixml)
+		v, err := parseCLIXML([]byte(test.clixml))
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(v, jc.DeepEquals, test.expect)
+	}
+}
+
+func (*CLIXMLSuite) TestInvalidPrimitive(c *gc.C) {
+	_, err := parseCLIXML([]byte(`<I32>x</I32>`))
+	c.Check(err, gc.ErrorMatches, `cannot parse CLIXML: invalid I32 value "x"`)
+}
+
+func (*CLIXMLSuite) TestObject(c *gc.C) {
+	v, err := parseCLIXML([]byte(`
+<Obj RefId="0">
+  <TN RefId="0"><T>Deserialized.System.Diagnostics.Process</T><T>Deserialized.System.Object</T></TN>
+  <ToString>System.Diagnostics.Process (pwsh)</ToString>
+  <Props>
+    <S N="Name">pwsh</S>
+    <I32 N="Id">1234</I32>
+    <Obj N="Modules" RefId="1">
+      <TN RefId="1"><T>System.Object[]</T></TN>
+      <LST><S>a.dll</S><S>b.dll</S></LST>
+    </Obj>
+  </Props>
+  <MS>
+    <Obj N="Env" RefId="2">
+      <TN RefId="2"><T>System.Collections.Hashtable</T></TN>
+      <DCT>
+        <En><S N="Key">PATH</S><S N="Value">C:\bin</S></En>
+        <En><I32 N="Key">1</I32><Nil N="Value" /></En>
+      </DCT>
+    </Obj>
+    <Obj N="Priority" RefId="3">
+      <TNRef RefId="1" />
+      <ToString>Normal</ToString>
+      <I32>32</I32>
+    </Obj>
+    <Ref N="Self" RefId="0" />
+  </MS>
+</Obj>`))
+	c.Assert(err, jc.ErrorIsNil)
+	obj := v.(*Object)
+	c.Check(obj.TypeNames, jc.DeepEquals, []string{"Deserialized.System.Diagnostics.Process", "Deserialized.System.Object"})
+	c.Check(obj.String(), gc.Equals, "System.Diagnostics.Process (pwsh)")
+	c.Check(obj.Property("Name"), gc.Equals, "pwsh")
+	c.Check(obj.Property("Id"), gc.Equals, int32(1234))
+	c.Check(obj.Property("Missing"), gc.IsNil)
+	c.Check(obj.Property("Modules").(*Object).Value, jc.DeepEquals, []interface{}{"a.dll", "b.dll"})
+	c.Check(obj.Property("Env").(*Object).Value, jc.DeepEquals, map[string]interface{}{
+		"PATH": `C:\bin`,
+		"1":    nil,
+	})
+	priority := obj.Property("Priority").(*Object)
+	c.Check(priority.TypeNames, jc.DeepEquals, []string{"System.Object[]"})
+	c.Check(priority.Value, gc.Equals, int32(32))
+	c.Check(priority.String(), gc.Equals, "Normal")
+	c.Check(obj.Property("Self"), gc.Equals, obj)
+}
+
+func (*CLIXMLSuite) TestUnknownRef(c *gc.C) {
+	_, err := parseCLIXML([]byte(`<Obj RefId="0"><MS><Ref N="x" RefId="9" /></MS></Obj>`))
+	c.Check(err, gc.ErrorMatches, `cannot parse CLIXML: unknown object reference "9"`)
+}
+
+func (*CLIXMLSuite) TestWriteRoundTrip(c *gc.C) {
+	values := []interface{}{
+		nil,
+		"a\r\n<b> & _x0041_",
+		"\U0001F600",
+		true,
+		3,
+		int32(-5),
+		int64(6),
+		uint32(7),
+		uint64(8),
+		1.5,
+		[]byte{1, 2},
+		time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC),
+	}
+	if strconv.IntSize == 64 {
+		// An int too large for an I32.
+		big := int64(1) << 40
+		values = append(values, int(big))
+	}
+	for i, v := range values {
+		c.Logf("test %d: %#v", i, v)
+		w := &clixmlWriter{}
+		w.value("", v)
+		got, err := parseCLIXML([]byte(w.String()))
+		c.Assert(err, jc.ErrorIsNil)
+		switch v := v.(type) {
+		case int:
+			if int64(v) > math.MaxInt32 {
+				c.Check(got, gc.Equals, int64(v))
+			} else {
+				c.Check(got, gc.Equals, int32(v))
+			}
+		default:
+			c.Check(got, jc.DeepEquals, v)
+		}
+	}
+}
+
+func (*CLIXMLSuite) TestWriteContainers(c *gc.C) {
+	w := &clixmlWriter{}
+	w.properties(func() {
+		w.value("List", []string{"a", "b"})
+		w.value("Mixed", []interface{}{"a", 1})
+		w.value("Map", map[string]interface{}{"k": "v"})
+		w.enum("Enum", "Some.Enum", "Value", 3)
+	})
+	v, err := parseCLIXML([]byte(`<Obj RefId="x">` + w.String() + `</Obj>`))
+	c.Assert(err, jc.ErrorIsNil)
+	obj := v.(*Object)
+	c.Check(obj.Property("List").(*Object).Value, jc.DeepEquals, []interface{}{"a", "b"})
+	c.Check(obj.Property("List").(*Object).TypeNames, jc.DeepEquals, arrayTypes)
+	c.Check(obj.Property("Mixed").(*Object).Value, jc.DeepEquals, []interface{}{"a", int32(1)})
+	c.Check(obj.Property("Map").(*Object).Value, jc.DeepEquals, map[string]interface{}{"k": "v"})
+	enum := obj.Property("Enum").(*Object)
+	c.Check(enum.TypeNames[0], gc.Equals, "Some.Enum")
+	c.Check(enum.String(), gc.Equals, "Value")
+	c.Check(enum.Value, gc.Equals, int32(3))
+}
@@ -0,0 +1,285 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package winrm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/masterzen/winrm"
+)
+
+const (
+	// defaultUploadChunkSize is the number of bytes sent by each
+	// upload command. Commands are limited to 8191 characters by
+	// cmd.exe, and the data is base64 encoded in a script that is
+	// itself UTF-16 and base64 encoded, which leaves room for less
+	// than 3KB of data per command.
+	defaultUploadChunkSize = 2048
+
+	// downloadChunkSize is the number of bytes received by each
+	// download command. Output is not limited in the same way as
+	// commands are.
+	downloadChunkSize = 512 * 1024
+)
+
+// CopyOptions holds options for Client.Copy.
+type CopyOptions struct {
+	// ChunkSize, if positive, holds the maximum number of bytes sent
+	// by each command when uploading. Larger chunks make uploads
+	// faster, but the resulting commands may be too long to run.
+	ChunkSize int
+}
+
+func (o *CopyOptions) chunkSize() int {
+	if o == nil || o.ChunkSize <= 0 {
+		return defaultUploadChunkSize
+	}
+	return o.ChunkSize
+}
+
+// Copy copies files between the local machine and the client's host.
+// Paths are specified in the scp format, [[user@]host:]path, where
+// host must be the host the client connects to, and the last argument
+// is the destination. Either all the sources or the destination must
+// be remote, but not both. If there is more than one source the
+// destination must be a directory.
+//
+// Files are sent in chunks by PowerShell commands run over the WinRM
+// connection, and their SHA256 checksums are verified once they have
+// been copied. Files are written to a temporary file that is renamed
+// into place only if the checksum matches.
+func (c *Client) Copy(args []string, options *CopyOptions) error {
+	if len(args) < 2 {
+		return errors.NotValidf("copy with fewer than two arguments")
+	}
+	sources, dest := args[:len(args)-1], args[len(args)-1]
+	remoteDest, destIsRemote := c.remotePath(dest)
+	for _, src := range sources {
+		remoteSrc, srcIsRemote := c.remotePath(src)
+		var err error
+		switch {
+		case srcIsRemote && !destIsRemote:
+			err = c.downloadFile(remoteSrc, dest, len(sources) > 1)
+		case !srcIsRemote && destIsRemote:
+			err = c.uploadFile(src, remoteDest, len(sources) > 1, options.chunkSize())
+		default:
+			return errors.NotSupportedf("copy from %q to %q", src, dest)
+		}
+		if err != nil {
+			return errors.Annotatef(err, "cannot copy %q to %q", src, dest)
+		}
+	}
+	return nil
+}
+
+// remotePath returns the path part of p and true if p refers to
+// the client's host.
+func (c *Client) remotePath(p string) (string, bool) {
+	if i := strings.Index(p, "@"); i >= 0 && strings.HasPrefix(p[i+1:], c.host+":") {
+		p = p[i+1:]
+	}
+	if c.host == "" || !strings.HasPrefix(p, c.host+":") {
+		return "", false
+	}
+	return p[len(c.host)+1:], true
+}
+
+// CopyReader sends the reader's data to a file on the client's host.
+// The data is verified as described in Copy.
+func (c *Client) CopyReader(filename string, r io.Reader, options *CopyOptions) error {
+	_, err := c.upload(r, filename, "", false, options.chunkSize())
+	return errors.Trace(err)
+}
+
+// CopyWriter writes the contents of a file on the client's host to w.
+// If the data received does not match the file's checksum, CopyWriter
+// returns an error after all the data has been written to w.
+func (c *Client) CopyWriter(filename string, w io.Writer) error {
+	return errors.Trace(c.download(filename, w))
+}
+
+func (c *Client) uploadFile(src, dest string, destIsDir bool, chunkSize int) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer f.Close()
+	_, err = c.upload(f, dest, filepath.Base(src), destIsDir, chunkSize)
+	return errors.Trace(err)
+}
+
+// upload copies the contents of r to dest and returns the full path of
+// the file written. If name is not empty and dest is a directory, or
+// destIsDir is true, the file is written to name within that directory.
+func (c *Client) upload(r io.Reader, dest, name string, destIsDir bool, chunkSize int) (string, error) {
+	start := fmt.Sprintf("$d = %s\n", psQuote(dest))
+	if name != "" {
+		start += fmt.Sprintf("if (%s -or (Test-Path -LiteralPath $d -PathType Container)) { $d = Join-Path $d %s }\n",
+			psBool(destIsDir), psQuote(name))
+	}
+	start += `$d = $ExecutionContext.SessionState.Path.GetUnresolvedProviderPathFromPSPath($d)
+[IO.File]::WriteAllBytes("$d.upload", [byte[]]@())
+$d`
+	out, err := c.runPS(start)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	dest = strings.TrimSpace(out)
+	tmp := dest + ".upload"
+
+	h := sha256.New()
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			h.Write(buf[:n])
+			chunk := fmt.Sprintf(`$b = [Convert]::FromBase64String('%s')
+$f = [IO.File]::Open(%s, [IO.FileMode]::Append, [IO.FileAccess]::Write)
+try { $f.Write($b, 0, $b.Length) } finally { $f.Close() }`,
+				base64.StdEncoding.EncodeToString(buf[:n]), psQuote(tmp))
+			if _, err := c.runPS(chunk); err != nil {
+				c.runPS(fmt.Sprintf("Remove-Item -LiteralPath %s -Force", psQuote(tmp)))
+				return "", errors.Trace(err)
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			c.runPS(fmt.Sprintf("Remove-Item -LiteralPath %s -Force", psQuote(tmp)))
+			return "", errors.Trace(err)
+		}
+	}
+
+	finish := fmt.Sprintf(`$h = (Get-FileHash -LiteralPath %s -Algorithm SHA256).Hash
+if ($h -ne '%s') {
+	Remove-Item -LiteralPath %s -Force
+	throw "checksum mismatch: got $h"
+}
+Move-Item -LiteralPath %s -Destination %s -Force`,
+		psQuote(tmp), hexSum(h.Sum(nil)), psQuote(tmp), psQuote(tmp), psQuote(dest))
+	if _, err := c.runPS(finish); err != nil {
+		return "", errors.Trace(err)
+	}
+	return dest, nil
+}
+
+func (c *Client) downloadFile(src, dest string, destIsDir bool) (err error) {
+	if info, err := os.Stat(dest); err == nil && info.IsDir() {
+		destIsDir = true
+	}
+	if destIsDir {
+		// Remote paths use backslashes, but may use slashes too.
+		dest = filepath.Join(dest, path.Base(strings.Replace(src, `\`, "/", -1)))
+	}
+	dir, file := filepath.Split(dest)
+	f, err := ioutil.TempFile(dir, file)
+	if err != nil {
+		return errors.Annotate(err, "cannot create temp file")
+	}
+	defer func() {
+		f.Close()
+		if err != nil {
+			os.Remove(f.Name())
+		}
+	}()
+	if err := c.download(src, f); err != nil {
+		return errors.Trace(err)
+	}
+	if err := f.Close(); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(os.Rename(f.Name(), dest))
+}
+
+// download writes the contents of src to w.
+func (c *Client) download(src string, w io.Writer) error {
+	out, err := c.runPS(fmt.Sprintf(`$f = Get-Item -LiteralPath %s
+"$($f.Length) $((Get-FileHash -LiteralPath $f.FullName -Algorithm SHA256).Hash)"`, psQuote(src)))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	fields := strings.Fields(out)
+	if len(fields) != 2 {
+		return errors.Errorf("unexpected file info %q", out)
+	}
+	size, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return errors.Errorf("unexpected file size %q", fields[0])
+	}
+	sum := fields[1]
+
+	h := sha256.New()
+	for offset := int64(0); offset < size; {
+		out, err := c.runPS(fmt.Sprintf(`$f = [IO.File]::OpenRead(%s)
+try {
+	$f.Seek(%d, [IO.SeekOrigin]::Begin) | Out-Null
+	$b = New-Object byte[] %d
+	$n = $f.Read($b, 0, $b.Length)
+} finally { $f.Close() }
+[Convert]::ToBase64String($b, 0, $n)`, psQuote(src), offset, downloadChunkSize))
+		if err != nil {
+			return errors.Trace(err)
+		}
+		data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(out))
+		if err != nil {
+			return errors.Annotate(err, "cannot decode file data")
+		}
+		if len(data) == 0 {
+			return errors.Errorf("file truncated at %d bytes, expected %d", offset, size)
+		}
+		h.Write(data)
+		if _, err := w.Write(data); err != nil {
+			return errors.Trace(err)
+		}
+		offset += int64(len(data))
+	}
+	if got := hexSum(h.Sum(nil)); got != sum {
+		return errors.Errorf("checksum mismatch: expected %s, got %s", sum, got)
+	}
+	return nil
+}
+
+// runPS runs the given PowerShell script and returns its output.
+// The script is stopped at the first error.
+func (c *Client) runPS(script string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	exitCode, err := c.conn.Run(winrm.Powershell("$ErrorActionPreference = 'Stop'\n"+script), &stdout, &stderr)
+	if err == nil && exitCode != 0 {
+		err = errors.Errorf("exit status %d", exitCode)
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = errors.Errorf("exit status %d (%s)", exitCode, msg)
+		}
+	}
+	return stdout.String(), errors.Trace(err)
+}
+
+// psQuote quotes s as a literal PowerShell string.
+func psQuote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+func psBool(b bool) string {
+	if b {
+		return "$true"
+	}
+	return "$false"
+}
+
+// hexSum formats a checksum as Get-FileHash does.
+func hexSum(sum []byte) string {
+	return strings.ToUpper(hex.EncodeToString(sum))
+}
@@ -0,0 +1,272 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package winrm_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/winrm"
+)
+
+type CopySuite struct {
+	remote *fakeHost
+	client *winrm.Client
+	dir    string
+}
+
+var _ = gc.Suite(&CopySuite{})
+
+func (s *CopySuite) SetUpTest(c *gc.C) {
+	s.remote = &fakeHost{
+		files: make(map[string][]byte),
+		dirs:  map[string]bool{`C:\Temp`: true},
+	}
+	s.client = winrm.NewClientWithRunner("win1", s.remote.run)
+	s.dir = c.MkDir()
+}
+
+func (s *CopySuite) writeLocal(c *gc.C, name, data string) string {
+	p := filepath.Join(s.dir, name)
+	err := ioutil.WriteFile(p, []byte(data), 0644)
+	c.Assert(err, jc.ErrorIsNil)
+	return p
+}
+
+func (s *CopySuite) TestUploadToDirectory(c *gc.C) {
+	src := s.writeLocal(c, "agent.conf", "some configuration data")
+
+	err := s.client.Copy([]string{src, `win1:C:\Temp`}, &winrm.CopyOptions{ChunkSize: 5})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(s.remote.files[`C:\Temp\agent.conf`]), gc.Equals, "some configuration data")
+	c.Check(s.remote.files, gc.HasLen, 1)
+	// One command to start, five chunks and one to finish.
+	c.Check(s.remote.commands, gc.Equals, 7)
+}
+
+func (s *CopySuite) TestUploadToFile(c *gc.C) {
+	src := s.writeLocal(c, "agent.conf", "data")
+
+	err := s.client.Copy([]string{src, `Administrator@win1:C:\Temp\juju.conf`}, nil)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(s.remote.files[`C:\Temp\juju.conf`]), gc.Equals, "data")
+	c.Check(s.remote.commands, gc.Equals, 3)
+}
+
+func (s *CopySuite) TestUploadMultiple(c *gc.C) {
+	src1 := s.writeLocal(c, "one", "1")
+	src2 := s.writeLocal(c, "two", "22")
+
+	err := s.client.Copy([]string{src1, src2, `win1:C:\Temp`}, nil)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(s.remote.files, jc.DeepEquals, map[string][]byte{
+		`C:\Temp\one`: []byte("1"),
+		`C:\Temp\two`: []byte("22"),
+	})
+}
+
+func (s *CopySuite) TestUploadEmpty(c *gc.C) {
+	src := s.writeLocal(c, "empty", "")
+
+	err := s.client.Copy([]string{src, `win1:C:\Temp`}, nil)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(s.remote.files[`C:\Temp\empty`], gc.HasLen, 0)
+	c.Check(s.remote.files, gc.HasLen, 1)
+}
+
+func (s *CopySuite) TestUploadChecksumMismatch(c *gc.C) {
+	src := s.writeLocal(c, "agent.conf", "some configuration data")
+	s.remote.corrupt = true
+
+	err := s.client.Copy([]string{src, `win1:C:\Temp`}, &winrm.CopyOptions{ChunkSize: 5})
+	c.Check(err, gc.ErrorMatches, `cannot copy ".*" to "win1:C:\\\\Temp": exit status 1 \(checksum mismatch\)`)
+	c.Check(s.remote.files, gc.HasLen, 0)
+}
+
+func (s *CopySuite) TestCopyReader(c *gc.C) {
+	err := s.client.CopyReader(`C:\Temp\script.ps1`, strings.NewReader("Write-Host hello"), nil)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(s.remote.files[`C:\Temp\script.ps1`]), gc.Equals, "Write-Host hello")
+}
+
+func (s *CopySuite) TestDownloadToDirectory(c *gc.C) {
+	s.remote.files[`C:\Temp\machine.log`] = []byte("log data")
+
+	err := s.client.Copy([]string{`win1:C:\Temp\machine.log`, s.dir}, nil)
+	c.Assert(err, jc.ErrorIsNil)
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, "machine.log"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(data), gc.Equals, "log data")
+}
+
+func (s *CopySuite) TestDownloadToFile(c *gc.C) {
+	s.remote.files[`C:\Temp\machine.log`] = []byte("log data")
+	dest := filepath.Join(s.dir, "local.log")
+
+	err := s.client.Copy([]string{`win1:C:\Temp\machine.log`, dest}, nil)
+	c.Assert(err, jc.ErrorIsNil)
+	data, err := ioutil.ReadFile(dest)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(data), gc.Equals, "log data")
+}
+
+func (s *CopySuite) TestDownloadChecksumMismatch(c *gc.C) {
+	s.remote.files[`C:\Temp\machine.log`] = []byte("log data")
+	s.remote.corrupt = true
+
+	err := s.client.Copy([]string{`win1:C:\Temp\machine.log`, s.dir}, nil)
+	c.Check(err, gc.ErrorMatches, `cannot copy .*: checksum mismatch: expected [0-9A-F]+, got [0-9A-F]+`)
+	entries, err := ioutil.ReadDir(s.dir)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(entries, gc.HasLen, 0)
+}
+
+func (s *CopySuite) TestDownloadNotFound(c *gc.C) {
+	err := s.client.Copy([]string{`win1:C:\Temp\missing`, s.dir}, nil)
+	c.Check(err, gc.ErrorMatches, `cannot copy .*: exit status 1 \(not found\)`)
+}
+
+func (s *CopySuite) TestCopyWriter(c *gc.C) {
+	s.remote.files[`C:\Temp\machine.log`] = []byte("log data")
+
+	var buf bytes.Buffer
+	err := s.client.CopyWriter(`C:\Temp\machine.log`, &buf)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(buf.String(), gc.Equals, "log data")
+}
+
+func (s *CopySuite) TestCopyInvalid(c *gc.C) {
+	err := s.client.Copy([]string{"a", "b"}, nil)
+	c.Check(err, jc.Satisfies, errors.IsNotSupported)
+	err = s.client.Copy([]string{`win1:C:\a`, `win1:C:\b`}, nil)
+	c.Check(err, jc.Satisfies, errors.IsNotSupported)
+	err = s.client.Copy([]string{`other:C:\a`, s.dir}, nil)
+	c.Check(err, jc.Satisfies, errors.IsNotSupported)
+	err = s.client.Copy([]string{`win1:C:\a`}, nil)
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+	c.Check(s.remote.commands, gc.Equals, 0)
+}
+
+// fakeHost interprets the PowerShell scripts run by Client.Copy
+// against an in-memory file system.
+type fakeHost struct {
+	files    map[string][]byte
+	dirs     map[string]bool
+	corrupt  bool
+	commands int
+}
+
+var (
+	startRE  = regexp.MustCompile(`(?s)^\$d = '(.*?)'\n(?:if \((\$true|\$false) -or .*?Join-Path \$d '(.*?)' }\n)?.*WriteAllBytes`)
+	chunkRE  = regexp.MustCompile(`(?s)FromBase64String\('(.*?)'\).*Open\('(.*?)', \[IO.FileMode\]::Append`)
+	finishRE = regexp.MustCompile(`(?s)Get-FileHash -LiteralPath '(.*?)' -Algorithm SHA256\).Hash\nif \(\$h -ne '(.*?)'\).*-Destination '(.*?)' -Force`)
+	removeRE = regexp.MustCompile(`^Remove-Item -LiteralPath '(.*?)' -Force$`)
+	infoRE   = regexp.MustCompile(`^\$f = Get-Item -LiteralPath '(.*?)'\n`)
+	readRE   = regexp.MustCompile(`(?s)OpenRead\('(.*?)'\).*Seek\((\d+),.*byte\[\] (\d+)`)
+)
+
+func (h *fakeHost) run(command string, stdout, stderr io.Writer) (int, error) {
+	h.commands++
+	script, err := decodePowershell(command)
+	if err != nil {
+		return 0, err
+	}
+	script = strings.TrimPrefix(script, "$ProgressPreference = 'SilentlyContinue';$ErrorActionPreference = 'Stop'\n")
+	fail := func(msg string) (int, error) {
+		fmt.Fprint(stderr, msg)
+		return 1, nil
+	}
+	if m := startRE.FindStringSubmatch(script); m != nil {
+		dest := m[1]
+		if m[2] == "$true" || (m[2] != "" && h.dirs[dest]) {
+			dest += `\` + m[3]
+		}
+		h.files[dest+".upload"] = nil
+		fmt.Fprintln(stdout, dest)
+		return 0, nil
+	}
+	if m := chunkRE.FindStringSubmatch(script); m != nil {
+		data, err := base64.StdEncoding.DecodeString(m[1])
+		if err != nil {
+			return 0, err
+		}
+		if h.corrupt {
+			data = data[1:]
+		}
+		h.files[m[2]] = append(h.files[m[2]], data...)
+		return 0, nil
+	}
+	if m := finishRE.FindStringSubmatch(script); m != nil {
+		data := h.files[m[1]]
+		delete(h.files, m[1])
+		if checksum(data) != m[2] {
+			return fail("checksum mismatch")
+		}
+		h.files[m[3]] = data
+		return 0, nil
+	}
+	if m := removeRE.FindStringSubmatch(script); m != nil {
+		delete(h.files, m[1])
+		return 0, nil
+	}
+	if m := infoRE.FindStringSubmatch(script); m != nil {
+		data, ok := h.files[m[1]]
+		if !ok {
+			return fail("not found")
+		}
+		fmt.Fprintf(stdout, "%d %s\n", len(data), checksum(data))
+		return 0, nil
+	}
+	if m := readRE.FindStringSubmatch(script); m != nil {
+		data := h.files[m[1]]
+		offset, _ := strconv.Atoi(m[2])
+		n, _ := strconv.Atoi(m[3])
+		data = data[offset:]
+		if len(data) > n {
+			data = data[:n]
+		}
+		if h.corrupt {
+			data = bytes.ToUpper(data)
+		}
+		fmt.Fprintln(stdout, base64.StdEncoding.EncodeToString(data))
+		return 0, nil
+	}
+	return 0, fmt.Errorf("unexpected script %q", script)
+}
+
+func decodePowershell(command string) (string, error) {
+	const prefix = "powershell.exe -EncodedCommand "
+	if !strings.HasPrefix(command, prefix) {
+		return "", fmt.Errorf("unexpected command %q", command)
+	}
+	data, err := base64.StdEncoding.DecodeString(command[len(prefix):])
+	if err != nil {
+		return "", err
+	}
+	u := make([]uint16, len(data)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(data[2*i:])
+	}
+	return string(utf16.Decode(u)), nil
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
@@ -3,7 +3,22 @@
 // Licensed under the LGPLv3, see licence file for details.
 package winrm
 
+import "io"
+
 var (
 	ErrNoX509Folder = errNoX509Folder
 	ErrNoClientCert = errNoClientCert
 )
+
+// RunFunc runs a command as a WinRM client's connection would.
+type RunFunc func(command string, stdout, stderr io.Writer) (int, error)
+
+func (f RunFunc) Run(command string, stdout, stderr io.Writer) (int, error) {
+	return f(command, stdout, stderr)
+}
+
+// NewClientWithRunner returns a client for the given host
+// that runs commands with run.
+func NewClientWithRunner(host string, run RunFunc) *Client {
+	return &Client{conn: run, host: host}
+}
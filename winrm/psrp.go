@@ -0,0 +1,808 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package winrm
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"strings"
+	"sync"
+
+	"github.com/juju/errors"
+	"github.com/masterzen/simplexml/dom"
+	"github.com/masterzen/winrm/soap"
+
+	"github.com/juju/utils/v3"
+)
+
+// The PowerShell remoting protocol (MS-PSRP) exchanges messages
+// between a client and a runspace pool, a set of PowerShell sessions
+// on the remote host. Messages hold CLIXML and are split into
+// fragments, which are carried by the WS-Management shell protocol
+// used for remote commands, addressed to the PowerShell plugin
+// rather than to cmd.exe.
+
+const (
+	psResourceURI = "http://schemas.microsoft.com/powershell/Microsoft.PowerShell"
+	psNamespace   = "http://schemas.microsoft.com/powershell"
+
+	actionCreate  = "http://schemas.xmlsoap.org/ws/2004/09/transfer/Create"
+	actionDelete  = "http://schemas.xmlsoap.org/ws/2004/09/transfer/Delete"
+	actionCommand = "http://schemas.microsoft.com/wbem/wsman/1/windows/shell/Command"
+	actionReceive = "http://schemas.microsoft.com/wbem/wsman/1/windows/shell/Receive"
+	actionSignal  = "http://schemas.microsoft.com/wbem/wsman/1/windows/shell/Signal"
+
+	signalTerminate  = "http://schemas.microsoft.com/wbem/wsman/1/windows/shell/signal/terminate"
+	commandStateDone = "http://schemas.microsoft.com/wbem/wsman/1/windows/shell/CommandState/Done"
+
+	// faultOperationTimeout is the WS-Management fault code returned
+	// when a Receive request times out before there is any output.
+	faultOperationTimeout = "2150858793"
+
+	// maxFragmentSize holds the largest fragment sent, which must
+	// fit in a WS-Management envelope once base64 encoded.
+	maxFragmentSize = 32 * 1024
+
+	protocolVersion = "2.3"
+)
+
+// Message types, from MS-PSRP section 2.2.1.
+const (
+	msgSessionCapability = 0x00010002
+	msgInitRunspacePool  = 0x00010004
+	msgRunspacePoolState = 0x00021005
+	msgCreatePipeline    = 0x00021006
+	msgPipelineOutput    = 0x00041004
+	msgErrorRecord       = 0x00041005
+	msgPipelineState     = 0x00041006
+	msgDebugRecord       = 0x00041007
+	msgVerboseRecord     = 0x00041008
+	msgWarningRecord     = 0x00041009
+	msgProgressRecord    = 0x00041010
+	msgInformationRecord = 0x00041011
+	msgPipelineHostCall  = 0x00041100
+)
+
+// Runspace pool and pipeline states, from MS-PSRP
+// sections 2.2.3.4 and 2.2.3.5.
+const (
+	runspacePoolOpened = 2
+	runspacePoolClosed = 3
+	runspacePoolBroken = 5
+
+	pipelineStopped   = 3
+	pipelineCompleted = 4
+	pipelineFailed    = 5
+)
+
+// destinationServer marks messages sent to the remote host.
+const destinationServer = 2
+
+// Command describes a command in a pipeline.
+type Command struct {
+	// Name holds the name of the command, or the text of
+	// a script if IsScript is true.
+	Name string
+
+	// IsScript reports whether Name holds a script.
+	IsScript bool
+
+	// Parameters holds the parameters passed to the command.
+	Parameters []Parameter
+}
+
+// Parameter describes a parameter passed to a command.
+type Parameter struct {
+	// Name holds the name of the parameter, without a leading dash,
+	// or is empty for a positional argument.
+	Name string
+
+	// Value holds the value of the parameter. Strings, booleans,
+	// integers, floats, byte slices, times, slices and maps with
+	// string keys are sent as the equivalent PowerShell types;
+	// other values are sent as strings. Switch parameters should
+	// be given the value true.
+	Value interface{}
+}
+
+// Pipeline holds a sequence of commands, each of which receives the
+// output of the one before.
+type Pipeline struct {
+	Commands []Command
+}
+
+// NewScript returns a pipeline that runs the given script.
+func NewScript(script string) *Pipeline {
+	return (&Pipeline{}).AddScript(script)
+}
+
+// NewCommand returns a pipeline that runs the named command.
+func NewCommand(name string) *Pipeline {
+	return (&Pipeline{}).AddCommand(name)
+}
+
+// AddScript adds a script to the end of the pipeline.
+func (p *Pipeline) AddScript(script string) *Pipeline {
+	p.Commands = append(p.Commands, Command{Name: script, IsScript: true})
+	return p
+}
+
+// AddCommand adds the named command to the end of the pipeline.
+func (p *Pipeline) AddCommand(name string) *Pipeline {
+	p.Commands = append(p.Commands, Command{Name: name})
+	return p
+}
+
+// AddParameter adds a named parameter to the last command in the
+// pipeline.
+func (p *Pipeline) AddParameter(name string, value interface{}) *Pipeline {
+	if n := len(p.Commands); n > 0 {
+		p.Commands[n-1].Parameters = append(p.Commands[n-1].Parameters, Parameter{Name: name, Value: value})
+	}
+	return p
+}
+
+// AddArgument adds a positional argument to the last command in the
+// pipeline.
+func (p *Pipeline) AddArgument(value interface{}) *Pipeline {
+	return p.AddParameter("", value)
+}
+
+// Streams holds the records written to each PowerShell stream by an
+// invocation.
+type Streams struct {
+	// Output holds the objects written to the output stream. Each is
+	// either a primitive Go value or an *Object.
+	Output []interface{}
+
+	// Error holds the records written to the error stream.
+	Error []*ErrorRecord
+
+	// Warning holds the messages written to the warning stream.
+	Warning []string
+
+	// Verbose holds the messages written to the verbose stream.
+	Verbose []string
+
+	// Debug holds the messages written to the debug stream.
+	Debug []string
+
+	// Information holds the messages written to the information
+	// stream, including those written by Write-Host.
+	Information []string
+
+	// Progress holds the records written to the progress stream.
+	Progress []ProgressRecord
+}
+
+// ErrorRecord describes an error reported by PowerShell.
+type ErrorRecord struct {
+	// Message holds the error message.
+	Message string
+
+	// FullyQualifiedErrorID identifies the kind of error, such as
+	// "CommandNotFoundException".
+	FullyQualifiedErrorID string
+
+	// Category describes the category of the error, such as
+	// "ObjectNotFound: (foo:String) [], CommandNotFoundException".
+	Category string
+
+	// TargetName holds the name of the object the error concerns,
+	// if any.
+	TargetName string
+
+	// ScriptStackTrace holds the script stack at the point
+	// the error occurred, if known.
+	ScriptStackTrace string
+}
+
+// Error implements error.
+func (e *ErrorRecord) Error() string {
+	return e.Message
+}
+
+// ProgressRecord describes the progress of an activity.
+type ProgressRecord struct {
+	// Activity describes the activity.
+	Activity string
+
+	// ActivityID identifies the activity.
+	ActivityID int
+
+	// ParentActivityID identifies the parent of the
+	// activity, or is negative if it has none.
+	ParentActivityID int
+
+	// StatusDescription describes the status of the activity.
+	StatusDescription string
+
+	// CurrentOperation describes what the activity is doing.
+	CurrentOperation string
+
+	// PercentComplete holds the percentage of the activity that is
+	// complete, or is negative if it is unknown.
+	PercentComplete int
+
+	// SecondsRemaining holds the estimated time remaining, or is
+	// negative if it is unknown.
+	SecondsRemaining int
+
+	// Completed reports whether the activity has finished.
+	Completed bool
+}
+
+// RunspacePool is a pool of PowerShell sessions on a remote host,
+// used to invoke pipelines. It is safe to use concurrently, but
+// invocations run one at a time.
+type RunspacePool struct {
+	client  *Client
+	shellID string
+	id      utils.UUID
+
+	mu       sync.Mutex
+	objectID uint64
+	defrag   defragmenter
+	closed   bool
+}
+
+// OpenRunspacePool opens a runspace pool on the client's host.
+func (c *Client) OpenRunspacePool() (*RunspacePool, error) {
+	if c.post == nil {
+		return nil, errors.New("client does not support PowerShell remoting")
+	}
+	id, err := utils.NewUUID()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	rp := &RunspacePool{
+		client: c,
+		id:     id,
+		defrag: make(defragmenter),
+	}
+
+	var creation bytes.Buffer
+	creation.Write(rp.fragment(rp.message(msgSessionCapability, utils.UUID{}, sessionCapability())))
+	creation.Write(rp.fragment(rp.message(msgInitRunspacePool, utils.UUID{}, initRunspacePool())))
+
+	shellID := strings.ToUpper(id.String())
+	msg := rp.request(actionCreate, "", *soap.NewHeaderOption("protocolversion", protocolVersion))
+	shell := msg.CreateBodyElement("Shell", soap.DOM_NS_WIN_SHELL)
+	shell.SetAttr("ShellId", shellID)
+	msg.CreateElement(shell, "InputStreams", soap.DOM_NS_WIN_SHELL).SetContent("stdin pr")
+	msg.CreateElement(shell, "OutputStreams", soap.DOM_NS_WIN_SHELL).SetContent("stdout")
+	msg.CreateElement(shell, "creationXml", dom.Namespace{Prefix: "ps", Uri: psNamespace}).
+		SetContent(base64.StdEncoding.EncodeToString(creation.Bytes()))
+
+	resp, err := rp.send(msg)
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot create runspace pool")
+	}
+	var created struct {
+		ShellID string `xml:"Body>Shell>ShellId"`
+	}
+	if err := xml.Unmarshal([]byte(resp), &created); err == nil && created.ShellID != "" {
+		shellID = created.ShellID
+	}
+	rp.shellID = shellID
+
+	for opened := false; !opened; {
+		msgs, _, err := rp.receive("")
+		if err != nil {
+			rp.delete()
+			return nil, errors.Annotate(err, "cannot open runspace pool")
+		}
+		for _, m := range msgs {
+			if m.messageType != msgRunspacePoolState {
+				continue
+			}
+			switch state, reason := runspacePoolState(m.data); state {
+			case runspacePoolOpened:
+				opened = true
+			case runspacePoolBroken, runspacePoolClosed:
+				rp.delete()
+				return nil, errors.Errorf("cannot open runspace pool: %s", reason)
+			}
+		}
+	}
+	return rp, nil
+}
+
+// Invoke runs the pipeline and waits for it to finish. It returns the
+// records written to each stream even if the pipeline fails, in which
+// case the returned error is an *ErrorRecord describing the failure.
+// Errors written to the error stream do not cause the pipeline to
+// fail unless they are terminating errors.
+func (rp *RunspacePool) Invoke(p *Pipeline) (*Streams, error) {
+	if len(p.Commands) == 0 {
+		return nil, errors.NotValidf("empty pipeline")
+	}
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	if rp.closed {
+		return nil, errors.New("runspace pool is closed")
+	}
+	pid, err := utils.NewUUID()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	commandID := strings.ToUpper(pid.String())
+
+	msg := rp.request(actionCommand, rp.shellID)
+	cmd := msg.CreateBodyElement("CommandLine", soap.DOM_NS_WIN_SHELL)
+	cmd.SetAttr("CommandId", commandID)
+	msg.CreateElement(cmd, "Command", soap.DOM_NS_WIN_SHELL).SetContent("Invoke-Expression")
+	msg.CreateElement(cmd, "Arguments", soap.DOM_NS_WIN_SHELL).
+		SetContent(base64.StdEncoding.EncodeToString(rp.fragment(rp.message(msgCreatePipeline, pid, createPipeline(p)))))
+	if _, err := rp.send(msg); err != nil {
+		return nil, errors.Annotate(err, "cannot create pipeline")
+	}
+	defer rp.signal(commandID)
+
+	streams := &Streams{}
+	for {
+		msgs, done, err := rp.receive(commandID)
+		if err != nil {
+			return streams, errors.Annotate(err, "cannot receive pipeline output")
+		}
+		for _, m := range msgs {
+			finished, err := streams.add(m)
+			if finished || err != nil {
+				return streams, err
+			}
+		}
+		if done {
+			return streams, errors.New("pipeline finished without reporting its state")
+		}
+	}
+}
+
+// Close closes the runspace pool.
+func (rp *RunspacePool) Close() error {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	if rp.closed {
+		return nil
+	}
+	rp.closed = true
+	return errors.Annotate(rp.delete(), "cannot close runspace pool")
+}
+
+// Invoke opens a runspace pool, runs the pipeline in it and closes
+// it again. See RunspacePool.Invoke for details.
+func (c *Client) Invoke(p *Pipeline) (*Streams, error) {
+	rp, err := c.OpenRunspacePool()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rp.Close()
+	return rp.Invoke(p)
+}
+
+// add adds the contents of a pipeline message to the streams. It
+// returns true when the message reports that the pipeline finished,
+// along with the reason for its failure, if any.
+func (s *Streams) add(m message) (bool, error) {
+	v, err := parseCLIXML(m.data)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	obj, _ := v.(*Object)
+	switch m.messageType {
+	case msgPipelineOutput:
+		s.Output = append(s.Output, v)
+	case msgErrorRecord:
+		s.Error = append(s.Error, errorRecord(obj))
+	case msgWarningRecord:
+		s.Warning = append(s.Warning, informationalMessage(obj))
+	case msgVerboseRecord:
+		s.Verbose = append(s.Verbose, informationalMessage(obj))
+	case msgDebugRecord:
+		s.Debug = append(s.Debug, informationalMessage(obj))
+	case msgInformationRecord:
+		if obj != nil {
+			s.Information = append(s.Information, stringOf(obj.Property("MessageData")))
+		}
+	case msgProgressRecord:
+		if obj != nil {
+			s.Progress = append(s.Progress, progressRecord(obj))
+		}
+	case msgPipelineHostCall:
+		return true, errors.NotSupportedf("PowerShell host call")
+	case msgPipelineState:
+		if obj == nil {
+			return false, nil
+		}
+		switch toInt(obj.Property("PipelineState")) {
+		case pipelineCompleted:
+			return true, nil
+		case pipelineStopped:
+			return true, errors.New("pipeline was stopped")
+		case pipelineFailed:
+			if rec, ok := obj.Property("ExceptionAsErrorRecord").(*Object); ok {
+				return true, errorRecord(rec)
+			}
+			return true, errors.New("pipeline failed")
+		}
+	}
+	return false, nil
+}
+
+func errorRecord(obj *Object) *ErrorRecord {
+	if obj == nil {
+		return &ErrorRecord{}
+	}
+	rec := &ErrorRecord{
+		Message:               obj.ToString,
+		FullyQualifiedErrorID: stringOf(obj.Property("FullyQualifiedErrorId")),
+		Category:              stringOf(obj.Property("ErrorCategory_Message")),
+		TargetName:            stringOf(obj.Property("ErrorCategory_TargetName")),
+		ScriptStackTrace:      stringOf(obj.Property("ErrorDetails_ScriptStackTrace")),
+	}
+	if details := stringOf(obj.Property("ErrorDetails_Message")); details != "" {
+		rec.Message = details
+	} else if rec.Message == "" {
+		if exc, ok := obj.Property("Exception").(*Object); ok {
+			rec.Message = stringOf(exc.Property("Message"))
+		}
+	}
+	return rec
+}
+
+func informationalMessage(obj *Object) string {
+	if obj == nil {
+		return ""
+	}
+	if msg, ok := obj.Properties["InformationalRecord_Message"]; ok {
+		return stringOf(msg)
+	}
+	return obj.String()
+}
+
+func progressRecord(obj *Object) ProgressRecord {
+	rec := ProgressRecord{
+		Activity:          stringOf(obj.Property("Activity")),
+		ActivityID:        toInt(obj.Property("ActivityId")),
+		ParentActivityID:  toInt(obj.Property("ParentActivityId")),
+		StatusDescription: stringOf(obj.Property("StatusDescription")),
+		CurrentOperation:  stringOf(obj.Property("CurrentOperation")),
+		PercentComplete:   toInt(obj.Property("PercentComplete")),
+		SecondsRemaining:  toInt(obj.Property("SecondsRemaining")),
+	}
+	if t, ok := obj.Property("Type").(*Object); ok {
+		rec.Completed = toInt(t.Value) == 1
+	}
+	return rec
+}
+
+// runspacePoolState returns the state reported by a
+// RUNSPACEPOOL_STATE message, and the reason for it if any.
+func runspacePoolState(data []byte) (int, string) {
+	v, err := parseCLIXML(data)
+	if err != nil {
+		return runspacePoolBroken, err.Error()
+	}
+	obj, ok := v.(*Object)
+	if !ok {
+		return runspacePoolBroken, "invalid state message"
+	}
+	reason := "runspace pool is broken"
+	if exc, ok := obj.Property("ExceptionAsErrorRecord").(*Object); ok {
+		reason = errorRecord(exc).Message
+	}
+	return toInt(obj.Property("RunspaceState")), reason
+}
+
+func toInt(v interface{}) int {
+	switch v := v.(type) {
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case *Object:
+		return toInt(v.Value)
+	}
+	return -1
+}
+
+// request returns a WS-Management request for the
+// PowerShell plugin with the given action and header options.
+func (rp *RunspacePool) request(action, shellID string, options ...soap.HeaderOption) *soap.SoapMessage {
+	c := rp.client
+	id, _ := utils.NewUUID()
+	msg := soap.NewMessage()
+	header := msg.Header().
+		To(c.url).
+		ReplyTo("http://schemas.xmlsoap.org/ws/2004/08/addressing/role/anonymous").
+		MaxEnvelopeSize(c.params.EnvelopeSize).
+		Id("uuid:" + strings.ToUpper(id.String())).
+		Locale(c.params.Locale).
+		Timeout(c.params.Timeout).
+		Action(action).
+		ResourceURI(psResourceURI)
+	if shellID != "" {
+		header.ShellId(shellID)
+	}
+	if len(options) > 0 {
+		header.Options(options)
+	}
+	header.Build()
+	return msg
+}
+
+func (rp *RunspacePool) send(msg *soap.SoapMessage) (string, error) {
+	return rp.client.post(msg)
+}
+
+// receive returns the messages received from the runspace pool, or
+// from the given command if commandID is not empty, and whether the
+// command is done. It waits until there are messages to return.
+func (rp *RunspacePool) receive(commandID string) ([]message, bool, error) {
+	for {
+		msg := rp.request(actionReceive, rp.shellID)
+		recv := msg.CreateBodyElement("Receive", soap.DOM_NS_WIN_SHELL)
+		stream := msg.CreateElement(recv, "DesiredStream", soap.DOM_NS_WIN_SHELL)
+		stream.SetContent("stdout")
+		if commandID != "" {
+			stream.SetAttr("CommandId", commandID)
+		}
+		resp, err := rp.send(msg)
+		if err != nil {
+			if strings.Contains(err.Error(), faultOperationTimeout) {
+				continue
+			}
+			return nil, false, errors.Trace(err)
+		}
+		var received struct {
+			Streams []struct {
+				Data string `xml:",chardata"`
+			} `xml:"Body>ReceiveResponse>Stream"`
+			State struct {
+				State string `xml:"State,attr"`
+			} `xml:"Body>ReceiveResponse>CommandState"`
+		}
+		if err := xml.Unmarshal([]byte(resp), &received); err != nil {
+			return nil, false, errors.Annotate(err, "cannot parse receive response")
+		}
+		var msgs []message
+		for _, s := range received.Streams {
+			data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s.Data))
+			if err != nil {
+				return nil, false, errors.Annotate(err, "cannot decode stream")
+			}
+			m, err := rp.defrag.add(data)
+			if err != nil {
+				return nil, false, errors.Trace(err)
+			}
+			msgs = append(msgs, m...)
+		}
+		done := received.State.State == commandStateDone
+		if len(msgs) > 0 || done {
+			return msgs, done, nil
+		}
+	}
+}
+
+// signal terminates the given command, releasing its resources.
+func (rp *RunspacePool) signal(commandID string) {
+	msg := rp.request(actionSignal, rp.shellID)
+	sig := msg.CreateBodyElement("Signal", soap.DOM_NS_WIN_SHELL)
+	sig.SetAttr("CommandId", commandID)
+	msg.CreateElement(sig, "Code", soap.DOM_NS_WIN_SHELL).SetContent(signalTerminate)
+	if _, err := rp.send(msg); err != nil {
+		logger.Debugf("cannot terminate pipeline %s: %v", commandID, err)
+	}
+}
+
+func (rp *RunspacePool) delete() error {
+	_, err := rp.send(rp.request(actionDelete, rp.shellID))
+	return errors.Trace(err)
+}
+
+// message encodes a PSRP message with the given type, pipeline id
+// and CLIXML data.
+func (rp *RunspacePool) message(messageType uint32, pid utils.UUID, data string) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint32(destinationServer))
+	binary.Write(&buf, binary.LittleEndian, messageType)
+	buf.Write(guidBytes(rp.id))
+	buf.Write(guidBytes(pid))
+	// The data is UTF-8 with a byte order mark.
+	buf.WriteString("\xef\xbb\xbf")
+	buf.WriteString(data)
+	return buf.Bytes()
+}
+
+// fragment splits a message into fragments.
+func (rp *RunspacePool) fragment(msg []byte) []byte {
+	rp.objectID++
+	var buf bytes.Buffer
+	for fragmentID := uint64(0); fragmentID == 0 || len(msg) > 0; fragmentID++ {
+		n := len(msg)
+		if n > maxFragmentSize {
+			n = maxFragmentSize
+		}
+		var flags byte
+		if fragmentID == 0 {
+			flags |= fragmentStart
+		}
+		if n == len(msg) {
+			flags |= fragmentEnd
+		}
+		binary.Write(&buf, binary.BigEndian, rp.objectID)
+		binary.Write(&buf, binary.BigEndian, fragmentID)
+		buf.WriteByte(flags)
+		binary.Write(&buf, binary.BigEndian, uint32(n))
+		buf.Write(msg[:n])
+		msg = msg[n:]
+	}
+	return buf.Bytes()
+}
+
+const (
+	fragmentStart = 1 << 0
+	fragmentEnd   = 1 << 1
+
+	fragmentHeaderSize = 21
+	messageHeaderSize  = 40
+)
+
+// message holds a PSRP message received from the remote host.
+type message struct {
+	messageType uint32
+	data        []byte
+}
+
+// defragmenter reassembles messages from fragments,
+// keyed by object id.
+type defragmenter map[uint64][]byte
+
+// add adds the fragments in data and returns any
+// messages that are now complete.
+func (d defragmenter) add(data []byte) ([]message, error) {
+	var msgs []message
+	for len(data) > 0 {
+		if len(data) < fragmentHeaderSize {
+			return nil, errors.New("truncated fragment header")
+		}
+		objectID := binary.BigEndian.Uint64(data[0:8])
+		flags := data[16]
+		size := binary.BigEndian.Uint32(data[17:21])
+		if uint32(len(data)-fragmentHeaderSize) < size {
+			return nil, errors.New("truncated fragment")
+		}
+		blob := data[fragmentHeaderSize : fragmentHeaderSize+int(size)]
+		data = data[fragmentHeaderSize+int(size):]
+		if flags&fragmentStart != 0 {
+			d[objectID] = nil
+		}
+		d[objectID] = append(d[objectID], blob...)
+		if flags&fragmentEnd == 0 {
+			continue
+		}
+		msg := d[objectID]
+		delete(d, objectID)
+		if len(msg) < messageHeaderSize {
+			return nil, errors.New("truncated message")
+		}
+		msgs = append(msgs, message{
+			messageType: binary.LittleEndian.Uint32(msg[4:8]),
+			data:        bytes.TrimPrefix(msg[messageHeaderSize:], []byte("\xef\xbb\xbf")),
+		})
+	}
+	return msgs, nil
+}
+
+// guidBytes returns the bytes of a UUID in the mixed-endian order
+// used by .NET.
+func guidBytes(id utils.UUID) []byte {
+	b := id.Raw()
+	b[0], b[1], b[2], b[3] = b[3], b[2], b[1], b[0]
+	b[4], b[5] = b[5], b[4]
+	b[6], b[7] = b[7], b[6]
+	return b[:]
+}
+
+// nullHost describes a client without a PowerShell host, so that
+// the remote host never asks it to interact with the user.
+func nullHost(w *clixmlWriter) {
+	w.object("HostInfo", nil, func() {
+		w.properties(func() {
+			w.value("_isHostNull", true)
+			w.value("_isHostUINull", true)
+			w.value("_isHostRawUINull", true)
+			w.value("_useRunspaceHost", true)
+		})
+	})
+}
+
+// sessionCapability returns the data of a SESSION_CAPABILITY message.
+func sessionCapability() string {
+	w := &clixmlWriter{}
+	w.object("", nil, func() {
+		w.properties(func() {
+			w.primitive("Version", "protocolversion", protocolVersion)
+			w.primitive("Version", "PSVersion", "2.0")
+			w.primitive("Version", "SerializationVersion", "1.1.0.1")
+		})
+	})
+	return w.String()
+}
+
+// initRunspacePool returns the data of an INIT_RUNSPACEPOOL message.
+func initRunspacePool() string {
+	w := &clixmlWriter{}
+	w.object("", nil, func() {
+		w.properties(func() {
+			w.value("MinRunspaces", 1)
+			w.value("MaxRunspaces", 1)
+			w.enum("PSThreadOptions", "System.Management.Automation.Runspaces.PSThreadOptions", "Default", 0)
+			w.enum("ApartmentState", "System.Threading.ApartmentState", "Unknown", 2)
+			nullHost(w)
+			w.object("ApplicationArguments", []string{"System.Management.Automation.PSPrimitiveDictionary", "System.Collections.Hashtable", "System.Object"}, func() {
+				w.buf.WriteString("<DCT />")
+			})
+		})
+	})
+	return w.String()
+}
+
+// createPipeline returns the data of a CREATE_PIPELINE message.
+func createPipeline(p *Pipeline) string {
+	const resultTypes = "System.Management.Automation.Runspaces.PipelineResultTypes"
+	listTypes := []string{"System.Collections.Generic.List`1[[System.Management.Automation.PSObject, System.Management.Automation, Version=1.0.0.0, Culture=neutral, PublicKeyToken=31bf3856ad364e35]]", "System.Object"}
+	w := &clixmlWriter{}
+	w.object("", nil, func() {
+		w.properties(func() {
+			w.value("NoInput", true)
+			w.enum("ApartmentState", "System.Threading.ApartmentState", "Unknown", 2)
+			w.enum("RemoteStreamOptions", "System.Management.Automation.RemoteStreamOptions", "0", 0)
+			w.value("AddToHistory", false)
+			nullHost(w)
+			w.object("PowerShell", nil, func() {
+				w.properties(func() {
+					w.value("IsNested", false)
+					w.value("ExtraCmds", nil)
+					w.list("Cmds", listTypes, func() {
+						for _, cmd := range p.Commands {
+							w.object("", nil, func() {
+								w.properties(func() {
+									w.value("Cmd", cmd.Name)
+									w.value("IsScript", cmd.IsScript)
+									w.value("UseLocalScope", nil)
+									for _, merge := range []string{
+										"MergeMyResult", "MergeToResult", "MergePreviousResults",
+										"MergeError", "MergeWarning", "MergeVerbose", "MergeDebug", "MergeInformation",
+									} {
+										w.enum(merge, resultTypes, "None", 0)
+									}
+									w.list("Args", listTypes, func() {
+										for _, param := range cmd.Parameters {
+											w.object("", nil, func() {
+												w.properties(func() {
+													if param.Name == "" {
+														w.value("N", nil)
+													} else {
+														w.value("N", param.Name)
+													}
+													w.value("V", param.Value)
+												})
+											})
+										}
+									})
+								})
+							})
+						}
+					})
+					w.value("History", nil)
+					w.value("RedirectShellErrorOutputPipe", true)
+				})
+			})
+			w.value("IsNested", false)
+		})
+	})
+	return w.String()
+}
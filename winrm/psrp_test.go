@@ -0,0 +1,382 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package winrm
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	"github.com/masterzen/winrm"
+	"github.com/masterzen/winrm/soap"
+	gc "gopkg.in/check.v1"
+)
+
+type PSRPSuite struct {
+	server *fakePSRPServer
+	client *Client
+}
+
+var _ = gc.Suite(&PSRPSuite{})
+
+func (s *PSRPSuite) SetUpTest(c *gc.C) {
+	s.server = &fakePSRPServer{c: c, poolState: runspacePoolOpened}
+	s.client = &Client{
+		url:    "http://win1:5985/wsman",
+		params: winrm.NewParameters("PT60S", "en-US", 153600),
+		post:   s.server.post,
+	}
+}
+
+func (s *PSRPSuite) TestInvoke(c *gc.C) {
+	s.server.output = [][]string{{
+		clixmlOutput(msgPipelineOutput, `<S>hello_x000A_</S>`),
+		clixmlOutput(msgPipelineOutput, `<I32>42</I32>`),
+		clixmlOutput(msgPipelineOutput, `<Obj RefId="0"><TN RefId="0"><T>System.IO.FileInfo</T><T>System.Object</T></TN><ToString>C:\a.txt</ToString><Props><S N="Name">a.txt</S><I64 N="Length">12</I64></Props></Obj>`),
+		clixmlOutput(msgWarningRecord, `<Obj RefId="0"><MS><S N="InformationalRecord_Message">careful</S></MS></Obj>`),
+		clixmlOutput(msgVerboseRecord, `<Obj RefId="0"><MS><S N="InformationalRecord_Message">chatty</S></MS></Obj>`),
+	}, {
+		clixmlOutput(msgDebugRecord, `<Obj RefId="0"><MS><S N="InformationalRecord_Message">bug</S></MS></Obj>`),
+		clixmlOutput(msgInformationRecord, `<Obj RefId="0"><MS><Obj N="MessageData" RefId="1"><ToString>hi there</ToString></Obj><S N="Source">Write-Host</S></MS></Obj>`),
+		clixmlOutput(msgProgressRecord, `<Obj RefId="0"><MS><S N="Activity">Copying</S><I32 N="ActivityId">1</I32><S N="StatusDescription">half way</S><Nil N="CurrentOperation" /><I32 N="ParentActivityId">-1</I32><I32 N="PercentComplete">50</I32><Obj N="Type" RefId="1"><TN RefId="0"><T>System.Management.Automation.ProgressRecordType</T></TN><ToString>Processing</ToString><I32>0</I32></Obj><I32 N="SecondsRemaining">-1</I32></MS></Obj>`),
+		clixmlOutput(msgErrorRecord, `<Obj RefId="0"><TN RefId="0"><T>System.Management.Automation.ErrorRecord</T><T>System.Object</T></TN><ToString>not found</ToString><MS><S N="FullyQualifiedErrorId">PathNotFound</S><S N="ErrorCategory_Message">ObjectNotFound: (C:\b:String) [], ItemNotFoundException</S><S N="ErrorCategory_TargetName">C:\b</S></MS></Obj>`),
+		clixmlOutput(msgPipelineState, `<Obj RefId="0"><MS><I32 N="PipelineState">4</I32></MS></Obj>`),
+	}}
+
+	rp, err := s.client.OpenRunspacePool()
+	c.Assert(err, jc.ErrorIsNil)
+	p := NewCommand("Get-Item").AddParameter("Path", `C:\a.txt`).AddParameter("Force", true).AddArgument(3).
+		AddScript("$input | Select-Object -First 1")
+	streams, err := rp.Invoke(p)
+	c.Assert(err, jc.ErrorIsNil)
+	err = rp.Close()
+	c.Assert(err, jc.ErrorIsNil)
+
+	c.Check(streams.Output, gc.HasLen, 3)
+	c.Check(streams.Output[0], gc.Equals, "hello\n")
+	c.Check(streams.Output[1], gc.Equals, int32(42))
+	obj, ok := streams.Output[2].(*Object)
+	c.Assert(ok, jc.IsTrue)
+	c.Check(obj.TypeNames, jc.DeepEquals, []string{"System.IO.FileInfo", "System.Object"})
+	c.Check(obj.String(), gc.Equals, `C:\a.txt`)
+	c.Check(obj.Property("Length"), gc.Equals, int64(12))
+	c.Check(streams.Warning, jc.DeepEquals, []string{"careful"})
+	c.Check(streams.Verbose, jc.DeepEquals, []string{"chatty"})
+	c.Check(streams.Debug, jc.DeepEquals, []string{"bug"})
+	c.Check(streams.Information, jc.DeepEquals, []string{"hi there"})
+	c.Check(streams.Progress, jc.DeepEquals, []ProgressRecord{{
+		Activity:          "Copying",
+		ActivityID:        1,
+		ParentActivityID:  -1,
+		StatusDescription: "half way",
+		PercentComplete:   50,
+		SecondsRemaining:  -1,
+	}})
+	c.Check(streams.Error, jc.DeepEquals, []*ErrorRecord{{
+		Message:               "not found",
+		FullyQualifiedErrorID: "PathNotFound",
+		Category:              `ObjectNotFound: (C:\b:String) [], ItemNotFoundException`,
+		TargetName:            `C:\b`,
+	}})
+
+	// The server saw the pipeline as it was built.
+	c.Assert(s.server.commands, gc.HasLen, 2)
+	c.Check(s.server.commands[0], gc.Equals, `Get-Item -Path C:\a.txt -Force true 3`)
+	c.Check(s.server.commands[1], gc.Equals, `script: $input | Select-Object -First 1`)
+	c.Check(s.server.actions, jc.DeepEquals, []string{
+		"Create", "Receive", "Command", "Receive", "Receive", "Signal", "Delete",
+	})
+}
+
+func (s *PSRPSuite) TestInvokeFailed(c *gc.C) {
+	s.server.output = [][]string{{
+		clixmlOutput(msgPipelineOutput, `<S>partial</S>`),
+		clixmlOutput(msgPipelineState, `<Obj RefId="0"><MS><I32 N="PipelineState">5</I32><Obj N="ExceptionAsErrorRecord" RefId="1"><TN RefId="0"><T>System.Management.Automation.ErrorRecord</T><T>System.Object</T></TN><ToString>boom</ToString><MS><S N="FullyQualifiedErrorId">RuntimeException</S></MS></Obj></MS></Obj>`),
+	}}
+
+	streams, err := s.client.Invoke(NewScript("throw 'boom'"))
+	c.Check(err, gc.ErrorMatches, "boom")
+	rec, ok := err.(*ErrorRecord)
+	c.Assert(ok, jc.IsTrue)
+	c.Check(rec.FullyQualifiedErrorID, gc.Equals, "RuntimeException")
+	c.Check(streams.Output, jc.DeepEquals, []interface{}{"partial"})
+	c.Check(s.server.actions[len(s.server.actions)-1], gc.Equals, "Delete")
+}
+
+func (s *PSRPSuite) TestInvokeRetriesTimeouts(c *gc.C) {
+	s.server.timeouts = 2
+	s.server.output = [][]string{{
+		clixmlOutput(msgPipelineState, `<Obj RefId="0"><MS><I32 N="PipelineState">4</I32></MS></Obj>`),
+	}}
+
+	_, err := s.client.Invoke(NewScript("Start-Sleep 120"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(s.server.actions, jc.DeepEquals, []string{
+		"Create", "Receive", "Command", "Receive", "Receive", "Receive", "Signal", "Delete",
+	})
+}
+
+func (s *PSRPSuite) TestInvokeFragmented(c *gc.C) {
+	// Split one large output message across several fragments
+	// in separate responses.
+	big := strings.Repeat("x", 100)
+	s.server.fragmentSize = 30
+	s.server.output = [][]string{{
+		clixmlOutput(msgPipelineOutput, "<S>"+big+"</S>"),
+		clixmlOutput(msgPipelineState, `<Obj RefId="0"><MS><I32 N="PipelineState">4</I32></MS></Obj>`),
+	}}
+
+	streams, err := s.client.Invoke(NewScript("'x' * 100"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(streams.Output, jc.DeepEquals, []interface{}{big})
+}
+
+func (s *PSRPSuite) TestInvokeCommandDoneWithoutState(c *gc.C) {
+	s.server.output = [][]string{{}}
+
+	_, err := s.client.Invoke(NewScript("exit"))
+	c.Check(err, gc.ErrorMatches, "pipeline finished without reporting its state")
+}
+
+func (s *PSRPSuite) TestInvokeEmptyPipeline(c *gc.C) {
+	_, err := s.client.Invoke(&Pipeline{})
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+}
+
+func (s *PSRPSuite) TestOpenRunspacePoolBroken(c *gc.C) {
+	s.server.poolState = runspacePoolBroken
+
+	_, err := s.client.OpenRunspacePool()
+	c.Check(err, gc.ErrorMatches, "cannot open runspace pool: runspace pool is broken")
+	c.Check(s.server.actions, jc.DeepEquals, []string{"Create", "Receive", "Delete"})
+}
+
+func (s *PSRPSuite) TestOpenRunspacePoolError(c *gc.C) {
+	s.server.err = errors.New("http error 401: ")
+
+	_, err := s.client.OpenRunspacePool()
+	c.Check(err, gc.ErrorMatches, "cannot create runspace pool: http error 401: ")
+}
+
+func (s *PSRPSuite) TestInvokeClosed(c *gc.C) {
+	rp, err := s.client.OpenRunspacePool()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(rp.Close(), jc.ErrorIsNil)
+	c.Assert(rp.Close(), jc.ErrorIsNil)
+
+	_, err = rp.Invoke(NewScript("1"))
+	c.Check(err, gc.ErrorMatches, "runspace pool is closed")
+}
+
+func (s *PSRPSuite) TestFragmentRoundTrip(c *gc.C) {
+	rp := &RunspacePool{}
+	data := bytes.Repeat([]byte("y"), 2*maxFragmentSize+10)
+	frags := rp.fragment(append(make([]byte, messageHeaderSize), data...))
+	c.Check(len(frags), gc.Equals, len(data)+messageHeaderSize+3*fragmentHeaderSize)
+
+	msgs, err := make(defragmenter).add(frags)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(msgs, gc.HasLen, 1)
+	c.Check(msgs[0].data, jc.DeepEquals, data)
+}
+
+func (s *PSRPSuite) TestDefragmenterTruncated(c *gc.C) {
+	_, err := make(defragmenter).add([]byte{1, 2, 3})
+	c.Check(err, gc.ErrorMatches, "truncated fragment header")
+}
+
+// clixmlOutput returns a server message of the given type and data.
+func clixmlOutput(messageType uint32, data string) string {
+	return fmt.Sprintf("%08x%s", messageType, data)
+}
+
+// fakePSRPServer implements just enough of WS-Management and the
+// server side of PSRP to test the client.
+type fakePSRPServer struct {
+	c *gc.C
+
+	poolState    int
+	output       [][]string
+	timeouts     int
+	fragmentSize int
+	err          error
+
+	actions  []string
+	commands []string
+	objectID uint64
+	pending  []string
+}
+
+type fakeRequest struct {
+	Action      string `xml:"Header>Action"`
+	ResourceURI string `xml:"Header>ResourceURI"`
+	ShellID     string `xml:"Header>SelectorSet>Selector"`
+	Options     []struct {
+		Name  string `xml:"Name,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"Header>OptionSet>Option"`
+	Shell struct {
+		ShellID     string `xml:"ShellId,attr"`
+		CreationXML string `xml:"creationXml"`
+	} `xml:"Body>Shell"`
+	CommandLine struct {
+		CommandID string `xml:"CommandId,attr"`
+		Arguments string `xml:"Arguments"`
+	} `xml:"Body>CommandLine"`
+	Receive struct {
+		Stream struct {
+			CommandID string `xml:"CommandId,attr"`
+		} `xml:"DesiredStream"`
+	} `xml:"Body>Receive"`
+	Signal struct {
+		CommandID string `xml:"CommandId,attr"`
+		Code      string `xml:"Code"`
+	} `xml:"Body>Signal"`
+}
+
+func (s *fakePSRPServer) post(msg *soap.SoapMessage) (string, error) {
+	c := s.c
+	if s.err != nil {
+		return "", s.err
+	}
+	var req fakeRequest
+	err := xml.Unmarshal([]byte(msg.String()), &req)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(req.ResourceURI, gc.Equals, psResourceURI)
+	action := req.Action[strings.LastIndex(req.Action, "/")+1:]
+	s.actions = append(s.actions, action)
+
+	switch action {
+	case "Create":
+		c.Check(req.Options, gc.HasLen, 1)
+		c.Check(req.Options[0].Name, gc.Equals, "protocolversion")
+		msgs := s.decode(req.Shell.CreationXML)
+		c.Assert(msgs, gc.HasLen, 2)
+		c.Check(msgs[0].messageType, gc.Equals, uint32(msgSessionCapability))
+		c.Check(msgs[1].messageType, gc.Equals, uint32(msgInitRunspacePool))
+		_, err := parseCLIXML(msgs[1].data)
+		c.Check(err, jc.ErrorIsNil)
+		return fmt.Sprintf(`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:rsp="%s"><s:Body><rsp:Shell><rsp:ShellId>%s</rsp:ShellId></rsp:Shell></s:Body></s:Envelope>`,
+			soap.NS_WIN_SHELL, req.Shell.ShellID), nil
+	case "Command":
+		c.Check(req.ShellID, gc.Not(gc.Equals), "")
+		msgs := s.decode(req.CommandLine.Arguments)
+		c.Assert(msgs, gc.HasLen, 1)
+		c.Check(msgs[0].messageType, gc.Equals, uint32(msgCreatePipeline))
+		s.recordPipeline(msgs[0].data)
+		return "<Envelope/>", nil
+	case "Receive":
+		if req.Receive.Stream.CommandID == "" {
+			return s.receiveResponse([]string{
+				clixmlOutput(msgSessionCapability, sessionCapability()),
+				clixmlOutput(msgRunspacePoolState, fmt.Sprintf(`<Obj RefId="0"><MS><I32 N="RunspaceState">%d</I32></MS></Obj>`, s.poolState)),
+			}, false), nil
+		}
+		if s.timeouts > 0 {
+			s.timeouts--
+			return "", fmt.Errorf("http error 500: <f:WSManFault Code=%q/>", faultOperationTimeout)
+		}
+		c.Assert(s.output, gc.Not(gc.HasLen), 0)
+		out := s.output[0]
+		s.output = s.output[1:]
+		return s.receiveResponse(out, len(s.output) == 0), nil
+	case "Signal":
+		c.Check(req.Signal.Code, gc.Equals, signalTerminate)
+		return "<Envelope/>", nil
+	case "Delete":
+		return "<Envelope/>", nil
+	}
+	c.Fatalf("unexpected action %q", req.Action)
+	return "", nil
+}
+
+func (s *fakePSRPServer) decode(data string) []message {
+	b, err := base64.StdEncoding.DecodeString(data)
+	s.c.Assert(err, jc.ErrorIsNil)
+	msgs, err := make(defragmenter).add(b)
+	s.c.Assert(err, jc.ErrorIsNil)
+	return msgs
+}
+
+// recordPipeline records a summary of each command in a
+// CREATE_PIPELINE message.
+func (s *fakePSRPServer) recordPipeline(data []byte) {
+	v, err := parseCLIXML(data)
+	s.c.Assert(err, jc.ErrorIsNil)
+	ps := v.(*Object).Property("PowerShell").(*Object)
+	for _, cmd := range ps.Property("Cmds").(*Object).Value.([]interface{}) {
+		cmd := cmd.(*Object)
+		summary := stringOf(cmd.Property("Cmd"))
+		if cmd.Property("IsScript") == true {
+			summary = "script: " + summary
+		}
+		for _, arg := range cmd.Property("Args").(*Object).Value.([]interface{}) {
+			arg := arg.(*Object)
+			if name := arg.Property("N"); name != nil {
+				summary += " -" + stringOf(name)
+			}
+			summary += " " + stringOf(arg.Property("V"))
+		}
+		s.commands = append(s.commands, summary)
+	}
+}
+
+// receiveResponse returns a Receive response holding the given
+// messages, each split into fragments and sent in its own stream
+// element.
+func (s *fakePSRPServer) receiveResponse(msgs []string, done bool) string {
+	var body strings.Builder
+	for _, m := range msgs {
+		var messageType uint32
+		fmt.Sscanf(m[:8], "%08x", &messageType)
+		for _, frag := range s.fragments(messageType, m[8:]) {
+			fmt.Fprintf(&body, `<rsp:Stream Name="stdout" CommandId="x">%s</rsp:Stream>`, base64.StdEncoding.EncodeToString(frag))
+		}
+	}
+	if done {
+		body.WriteString(`<rsp:CommandState CommandId="x" State="` + commandStateDone + `"/>`)
+	}
+	return fmt.Sprintf(`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:rsp="%s"><s:Body><rsp:ReceiveResponse>%s</rsp:ReceiveResponse></s:Body></s:Envelope>`,
+		soap.NS_WIN_SHELL, body.String())
+}
+
+// fragments encodes a message sent to the client and splits it into
+// fragments of at most fragmentSize bytes.
+func (s *fakePSRPServer) fragments(messageType uint32, data string) [][]byte {
+	var msg bytes.Buffer
+	binary.Write(&msg, binary.LittleEndian, uint32(1))
+	binary.Write(&msg, binary.LittleEndian, messageType)
+	msg.Write(make([]byte, 32))
+	msg.WriteString("\xef\xbb\xbf" + data)
+
+	size := s.fragmentSize
+	if size == 0 {
+		size = msg.Len()
+	}
+	s.objectID++
+	var frags [][]byte
+	for id := uint64(0); msg.Len() > 0; id++ {
+		blob := msg.Next(size)
+		var flags byte
+		if id == 0 {
+			flags |= fragmentStart
+		}
+		if msg.Len() == 0 {
+			flags |= fragmentEnd
+		}
+		var frag bytes.Buffer
+		binary.Write(&frag, binary.BigEndian, s.objectID)
+		binary.Write(&frag, binary.BigEndian, id)
+		frag.WriteByte(flags)
+		binary.Write(&frag, binary.BigEndian, uint32(len(blob)))
+		frag.Write(blob)
+		frags = append(frags, frag.Bytes())
+	}
+	return frags
+}
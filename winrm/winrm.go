@@ -16,7 +16,10 @@ import (
 	"github.com/juju/errors"
 	"github.com/juju/loggo"
 	"github.com/masterzen/winrm"
+	"github.com/masterzen/winrm/soap"
 	"golang.org/x/crypto/ssh/terminal"
+
+	"github.com/juju/utils/v3/redact"
 )
 
 const (
@@ -31,9 +34,22 @@ var (
 
 // Client type retains information about the winrm connection
 type Client struct {
-	conn   *winrm.Client
+	conn   runner
+	host   string
 	pass   string
 	secure bool
+
+	// url, params and post are used to send the WS-Management
+	// requests that make up the PowerShell remoting protocol.
+	url    string
+	params *winrm.Parameters
+	post   func(request *soap.SoapMessage) (string, error)
+}
+
+// runner runs commands on the remote machine. It is
+// implemented by *winrm.Client.
+type runner interface {
+	Run(command string, stdout io.Writer, stderr io.Writer) (int, error)
 }
 
 // Secure returns true if the client is using a secure connection or false
@@ -181,6 +197,20 @@ func NewClient(config ClientConfig) (*Client, error) {
 		}
 	}
 
+	// Keep hold of the transport so that PowerShell remoting
+	// requests, which the winrm client cannot make itself, can
+	// be sent over it.
+	var transport winrm.Transporter
+	decorator := params.TransportDecorator
+	params.TransportDecorator = func() winrm.Transporter {
+		if decorator != nil {
+			transport = decorator()
+		} else {
+			transport = winrm.NewClientWithDial(nil)
+		}
+		return transport
+	}
+
 	port := httpPort
 	cli.secure = false
 	if config.Secure {
@@ -200,17 +230,28 @@ func NewClient(config ClientConfig) (*Client, error) {
 		config.User = defaultWinndowsUser
 	}
 
-	cli.conn, err = winrm.NewClientWithParameters(endpoint, config.User, cli.pass, params)
+	conn, err := winrm.NewClientWithParameters(endpoint, config.User, cli.pass, params)
 	if err != nil {
 		return nil, errors.Annotatef(err, "cannot create WinRM https client conn")
 	}
+	cli.conn = conn
+	cli.host = config.Host
+	scheme := "http"
+	if config.Secure {
+		scheme = "https"
+	}
+	cli.url = fmt.Sprintf("%s://%s:%d/wsman", scheme, config.Host, port)
+	cli.params = params
+	cli.post = func(request *soap.SoapMessage) (string, error) {
+		return transport.Post(conn, request)
+	}
 	return cli, nil
 }
 
 // Run powershell command and direct output to stdout and errors to stderr
 // If the Run successfully executes it returns nil
 func (c *Client) Run(command string, stdout io.Writer, stderr io.Writer) error {
-	logger.Debugf("Runing cmd on WinRM connection %q", command)
+	logger.Debugf("Runing cmd on WinRM connection %q", redact.Credentials.Redact(command))
 	exitCode, err := c.conn.Run(command, stdout, stderr)
 	if exitCode != 0 {
 		if err == nil {
@@ -0,0 +1,186 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package wsclient
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+
+	"github.com/juju/utils/v3/retry"
+)
+
+// ErrNotConnected is returned by Client.Send when the client
+// is not connected.
+var ErrNotConnected = errors.New("websocket not connected")
+
+// ClientConfig holds the configuration of a Client.
+type ClientConfig struct {
+	Config
+
+	// Backoff gives the delays before reconnecting. The sequence
+	// restarts after each successful connection. If it is nil,
+	// delays start at a second and double up to a minute, with
+	// jitter.
+	Backoff retry.Backoff
+
+	// OnConnect, if not nil, is called with each new connection
+	// before any messages are received on it, so that a client
+	// can subscribe again to the streams it wants. If it returns
+	// an error, the connection is closed and made again later.
+	OnConnect func(conn *Conn) error
+
+	// OnDisconnect, if not nil, is called with the reason that a
+	// connection could not be made or was lost.
+	OnDisconnect func(err error)
+}
+
+// DefaultBackoff is used by Client when ClientConfig.Backoff is nil.
+var DefaultBackoff = retry.ExponentialBackoff(time.Second, 2).Jitter(0.2, nil).Cap(time.Minute)
+
+// Client keeps a websocket connection open, reconnecting whenever it
+// is lost, and delivers the messages received on it.
+type Client struct {
+	config   ClientConfig
+	messages chan json.RawMessage
+	quit     chan struct{}
+	done     chan struct{}
+
+	mu   sync.Mutex
+	conn *Conn
+}
+
+// NewClient returns a client that connects as described by config.
+// It must be closed with Close when it is no longer needed.
+func NewClient(config ClientConfig) (*Client, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if config.Backoff == nil {
+		config.Backoff = DefaultBackoff
+	}
+	config.Config = config.Config.withDefaults()
+	c := &Client{
+		config:   config,
+		messages: make(chan json.RawMessage),
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go c.loop()
+	return c, nil
+}
+
+// Messages returns a channel on which the messages received are
+// sent. It is closed when the client is closed.
+func (c *Client) Messages() <-chan json.RawMessage {
+	return c.messages
+}
+
+// Send sends v as a JSON message on the current connection.
+// It returns ErrNotConnected if there is none.
+func (c *Client) Send(v interface{}) error {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	if conn == nil {
+		return ErrNotConnected
+	}
+	return errors.Trace(conn.Send(v))
+}
+
+// Close closes the current connection, if any, with the close
+// handshake, and stops the client reconnecting.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	select {
+	case <-c.quit:
+	default:
+		close(c.quit)
+	}
+	conn := c.conn
+	c.mu.Unlock()
+	var err error
+	if conn != nil {
+		err = conn.Close()
+	}
+	<-c.done
+	return errors.Trace(err)
+}
+
+func (c *Client) loop() {
+	defer close(c.done)
+	defer close(c.messages)
+	delays := c.config.Backoff.Iterator()
+	for {
+		err := c.connect()
+		if err == nil {
+			delays = c.config.Backoff.Iterator()
+			err = c.receive()
+		}
+		select {
+		case <-c.quit:
+			return
+		default:
+		}
+		if c.config.OnDisconnect != nil {
+			c.config.OnDisconnect(err)
+		}
+		select {
+		case <-c.config.Clock.After(delays.Next()):
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// connect makes a new connection and sets it as current.
+func (c *Client) connect() error {
+	conn, err := Dial(c.config.Config)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if c.config.OnConnect != nil {
+		if err := c.config.OnConnect(conn); err != nil {
+			conn.Close()
+			return errors.Trace(err)
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.quit:
+		conn.Close()
+		return errors.New("client closed")
+	default:
+	}
+	c.conn = conn
+	return nil
+}
+
+// receive delivers the messages received on the current connection
+// until it is lost, and then closes it.
+func (c *Client) receive() error {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.conn = nil
+		c.mu.Unlock()
+		conn.Close()
+	}()
+	for {
+		var msg json.RawMessage
+		if err := conn.Receive(&msg); err != nil {
+			return err
+		}
+		select {
+		case c.messages <- msg:
+		case <-c.quit:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package wsclient_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	"golang.org/x/net/websocket"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/retry"
+	"github.com/juju/utils/v3/wsclient"
+)
+
+type clientSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&clientSuite{})
+
+var quickBackoff = retry.ExponentialBackoff(time.Millisecond, 1)
+
+func receiveMessage(c *gc.C, client *wsclient.Client) message {
+	select {
+	case data, ok := <-client.Messages():
+		c.Assert(ok, jc.IsTrue)
+		var m message
+		c.Assert(json.Unmarshal(data, &m), jc.ErrorIsNil)
+		return m
+	case <-time.After(testing.LongWait):
+		c.Fatalf("no message received")
+	}
+	panic("unreachable")
+}
+
+func (s *clientSuite) TestReconnectAndResubscribe(c *gc.C) {
+	// Each connection replies to a subscription
+	// with a single message and then closes.
+	url := newServer(&s.IsolationSuite, func(ws *websocket.Conn) {
+		var m message
+		if websocket.JSON.Receive(ws, &m) == nil {
+			websocket.JSON.Send(ws, message{m.N * 10})
+		}
+	})
+	var mu sync.Mutex
+	connects := 0
+	disconnects := 0
+	client, err := wsclient.NewClient(wsclient.ClientConfig{
+		Config:  wsclient.Config{URL: url},
+		Backoff: quickBackoff,
+		OnConnect: func(conn *wsclient.Conn) error {
+			mu.Lock()
+			connects++
+			n := connects
+			mu.Unlock()
+			return conn.Send(message{n})
+		},
+		OnDisconnect: func(error) {
+			mu.Lock()
+			disconnects++
+			mu.Unlock()
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	for i := 1; i <= 3; i++ {
+		c.Assert(receiveMessage(c, client), gc.Equals, message{i * 10})
+	}
+	c.Assert(client.Close(), jc.ErrorIsNil)
+	_, ok := <-client.Messages()
+	c.Assert(ok, jc.IsFalse)
+	mu.Lock()
+	defer mu.Unlock()
+	c.Assert(connects >= 3, jc.IsTrue)
+	c.Assert(disconnects >= 2, jc.IsTrue)
+}
+
+func (s *clientSuite) TestSend(c *gc.C) {
+	url := newServer(&s.IsolationSuite, echo)
+	connected := make(chan struct{}, 1)
+	client, err := wsclient.NewClient(wsclient.ClientConfig{
+		Config: wsclient.Config{URL: url},
+		OnConnect: func(*wsclient.Conn) error {
+			connected <- struct{}{}
+			return nil
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	defer client.Close()
+	select {
+	case <-connected:
+	case <-time.After(testing.LongWait):
+		c.Fatalf("client did not connect")
+	}
+	// The connection is set just after OnConnect returns.
+	deadline := time.Now().Add(testing.LongWait)
+	for {
+		err = client.Send(message{41})
+		if err != wsclient.ErrNotConnected || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(receiveMessage(c, client), gc.Equals, message{42})
+}
+
+func (s *clientSuite) TestNotConnected(c *gc.C) {
+	// Find an address on which nothing is listening.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, jc.ErrorIsNil)
+	addr := l.Addr().String()
+	l.Close()
+
+	failures := make(chan error, 10)
+	client, err := wsclient.NewClient(wsclient.ClientConfig{
+		Config:  wsclient.Config{URL: "ws://" + addr},
+		Backoff: quickBackoff,
+		OnDisconnect: func(err error) {
+			select {
+			case failures <- err:
+			default:
+			}
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	select {
+	case err := <-failures:
+		c.Assert(err, gc.ErrorMatches, `cannot connect to ".*": .*`)
+	case <-time.After(testing.LongWait):
+		c.Fatalf("no connection failure")
+	}
+	c.Assert(client.Send(message{1}), gc.Equals, wsclient.ErrNotConnected)
+	c.Assert(client.Close(), jc.ErrorIsNil)
+}
+
+func (s *clientSuite) TestOnConnectError(c *gc.C) {
+	url := newServer(&s.IsolationSuite, echo)
+	failures := make(chan error, 10)
+	client, err := wsclient.NewClient(wsclient.ClientConfig{
+		Config:  wsclient.Config{URL: url},
+		Backoff: quickBackoff,
+		OnConnect: func(*wsclient.Conn) error {
+			return errors.New("no subscription")
+		},
+		OnDisconnect: func(err error) {
+			select {
+			case failures <- err:
+			default:
+			}
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	defer client.Close()
+	select {
+	case err := <-failures:
+		c.Assert(err, gc.ErrorMatches, "no subscription")
+	case <-time.After(testing.LongWait):
+		c.Fatalf("no connection failure")
+	}
+}
+
+func (s *clientSuite) TestInvalidConfig(c *gc.C) {
+	_, err := wsclient.NewClient(wsclient.ClientConfig{})
+	c.Assert(err, gc.ErrorMatches, `URL scheme "" not valid`)
+}
@@ -0,0 +1,295 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package wsclient provides websocket connections exchanging JSON
+// messages, with keepalive pings, a graceful close handshake and,
+// with Client, reconnection with exponential backoff. It is intended
+// for clients of long-lived streams, such as logs.
+package wsclient
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/clock"
+	"github.com/juju/errors"
+	"golang.org/x/net/websocket"
+
+	"github.com/juju/utils/v3"
+)
+
+// Config holds the configuration of a websocket connection.
+type Config struct {
+	// URL holds the ws or wss URL to connect to.
+	URL string
+
+	// Origin holds the origin sent when connecting. If it is
+	// empty, the http or https URL of the server is used.
+	Origin string
+
+	// Header holds any extra headers to send when connecting.
+	Header http.Header
+
+	// TLSConfig holds the TLS configuration used
+	// for wss URLs.
+	TLSConfig *tls.Config
+
+	// PingInterval, if positive, is the interval after which a ping
+	// is sent if nothing has been received.
+	PingInterval time.Duration
+
+	// PongTimeout is the time allowed for a reply to a ping
+	// before the connection is treated as lost and closed. If it
+	// is zero, PingInterval is used.
+	PongTimeout time.Duration
+
+	// CloseTimeout is the time Close waits for the server to
+	// acknowledge the close handshake. If it is zero, 5s is used.
+	CloseTimeout time.Duration
+
+	// Clock is used to time pings and the close handshake.
+	// If it is nil, clock.WallClock is used.
+	Clock clock.Clock
+}
+
+// Validate checks that the configuration is usable.
+func (config Config) Validate() error {
+	u, err := url.Parse(config.URL)
+	if err != nil {
+		return errors.NotValidf("URL %q", config.URL)
+	}
+	if u.Scheme != "ws" && u.Scheme != "wss" {
+		return errors.NotValidf("URL scheme %q", u.Scheme)
+	}
+	if config.PingInterval < 0 || config.PongTimeout < 0 || config.CloseTimeout < 0 {
+		return errors.NotValidf("negative timeout")
+	}
+	return nil
+}
+
+func (config Config) withDefaults() Config {
+	if config.PongTimeout == 0 {
+		config.PongTimeout = config.PingInterval
+	}
+	if config.CloseTimeout == 0 {
+		config.CloseTimeout = 5 * time.Second
+	}
+	if config.Clock == nil {
+		config.Clock = clock.WallClock
+	}
+	return config
+}
+
+// closeStatusNormal is the status sent
+// in the close handshake.
+const closeStatusNormal = 1000
+
+// pingCodec sends ping frames.
+var pingCodec = websocket.Codec{
+	Marshal: func(interface{}) ([]byte, byte, error) {
+		return nil, websocket.PingFrame, nil
+	},
+}
+
+// Conn is a websocket connection on which JSON messages are sent and
+// received. Send and Receive may be called concurrently with each
+// other and with Close.
+type Conn struct {
+	config Config
+	ws     *websocket.Conn
+	raw    *activityConn
+
+	closeOnce sync.Once
+	closeErr  error
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// Dial connects to the websocket server described by config.
+func Dial(config Config) (*Conn, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	config = config.withDefaults()
+	wsConfig, err := websocket.NewConfig(config.URL, origin(config))
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	wsConfig.TlsConfig = config.TLSConfig
+	for name, values := range config.Header {
+		wsConfig.Header[name] = values
+	}
+	netConn, err := dialNet(wsConfig.Location, config.TLSConfig)
+	if err != nil {
+		return nil, errors.Annotatef(err, "cannot connect to %q", utils.RedactURL(config.URL))
+	}
+	raw := &activityConn{
+		Conn:   netConn,
+		active: make(chan struct{}, 1),
+	}
+	ws, err := websocket.NewClient(wsConfig, raw)
+	if err != nil {
+		netConn.Close()
+		return nil, errors.Annotatef(err, "cannot open websocket to %q", utils.RedactURL(config.URL))
+	}
+	c := &Conn{
+		config: config,
+		ws:     ws,
+		raw:    raw,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	if config.PingInterval > 0 {
+		go c.keepalive()
+	} else {
+		close(c.done)
+	}
+	return c, nil
+}
+
+// origin returns the origin to send for config.
+func origin(config Config) string {
+	if config.Origin != "" {
+		return config.Origin
+	}
+	// The URL has been validated.
+	u, _ := url.Parse(config.URL)
+	scheme := "http"
+	if u.Scheme == "wss" {
+		scheme = "https"
+	}
+	return scheme + "://" + u.Host
+}
+
+// dialNet makes the network connection for a websocket.
+func dialNet(u *url.URL, tlsConfig *tls.Config) (net.Conn, error) {
+	host := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "wss" {
+			port = "443"
+		}
+		host = net.JoinHostPort(strings.Trim(u.Hostname(), "[]"), port)
+	}
+	if u.Scheme == "wss" {
+		return tls.Dial("tcp", host, tlsConfig)
+	}
+	return net.Dial("tcp", host)
+}
+
+// Send sends v as a JSON message.
+func (c *Conn) Send(v interface{}) error {
+	return errors.Trace(websocket.JSON.Send(c.ws, v))
+}
+
+// Receive receives a JSON message into v. It returns io.EOF once
+// the connection has been closed by either end with the close
+// handshake.
+func (c *Conn) Receive(v interface{}) error {
+	err := websocket.JSON.Receive(c.ws, v)
+	if err == io.EOF {
+		// The server has started the close handshake,
+		// or has acknowledged ours.
+		c.closeOnce.Do(func() {
+			c.stopKeepalive()
+			c.ws.WriteClose(closeStatusNormal)
+			c.closeErr = c.raw.Close()
+		})
+		return io.EOF
+	}
+	return errors.Trace(err)
+}
+
+// Close closes the connection, sending a close message and waiting
+// up to the configured timeout for the server to acknowledge it.
+// Messages received meanwhile are discarded.
+func (c *Conn) Close() error {
+	c.closeOnce.Do(func() {
+		c.stopKeepalive()
+		if err := c.ws.WriteClose(closeStatusNormal); err == nil {
+			c.awaitClose()
+		}
+		c.closeErr = c.raw.Close()
+	})
+	return errors.Trace(c.closeErr)
+}
+
+// awaitClose waits for the server to acknowledge the close handshake
+// by closing the connection, or for the close timeout to expire.
+func (c *Conn) awaitClose() {
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		var discard []byte
+		for websocket.Message.Receive(c.ws, &discard) == nil {
+		}
+	}()
+	select {
+	case <-drained:
+	case <-c.config.Clock.After(c.config.CloseTimeout):
+	}
+}
+
+func (c *Conn) stopKeepalive() {
+	close(c.stop)
+	<-c.done
+}
+
+// keepalive sends a ping whenever nothing has been received for the
+// ping interval, and closes the connection if nothing is received in
+// reply before the pong timeout.
+func (c *Conn) keepalive() {
+	defer close(c.done)
+	timer := c.config.Clock.NewTimer(c.config.PingInterval)
+	defer timer.Stop()
+	pinged := false
+	for {
+		select {
+		case <-c.raw.active:
+			if !timer.Stop() {
+				<-timer.Chan()
+			}
+			pinged = false
+			timer.Reset(c.config.PingInterval)
+		case <-timer.Chan():
+			if pinged {
+				// The connection is dead, so there is no
+				// point in attempting the close handshake.
+				c.raw.Close()
+				return
+			}
+			if err := pingCodec.Send(c.ws, nil); err != nil {
+				c.raw.Close()
+				return
+			}
+			pinged = true
+			timer.Reset(c.config.PongTimeout)
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// activityConn notifies active whenever
+// anything is read from the connection.
+type activityConn struct {
+	net.Conn
+	active chan struct{}
+}
+
+func (c *activityConn) Read(buf []byte) (int, error) {
+	n, err := c.Conn.Read(buf)
+	if n > 0 {
+		select {
+		case c.active <- struct{}{}:
+		default:
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,179 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package wsclient_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	"golang.org/x/net/websocket"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/wsclient"
+)
+
+type connSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&connSuite{})
+
+// newServer starts a websocket server, stopped when the test
+// finishes, calling handle for each connection, and returns its
+// ws URL.
+func newServer(s *testing.IsolationSuite, handle func(*websocket.Conn)) string {
+	srv := httptest.NewServer(websocket.Handler(handle))
+	s.AddCleanup(func(*gc.C) { srv.Close() })
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+type message struct {
+	N int
+}
+
+func echo(ws *websocket.Conn) {
+	for {
+		var m message
+		if err := websocket.JSON.Receive(ws, &m); err != nil {
+			return
+		}
+		m.N++
+		if err := websocket.JSON.Send(ws, m); err != nil {
+			return
+		}
+	}
+}
+
+func (s *connSuite) TestSendReceive(c *gc.C) {
+	url := newServer(&s.IsolationSuite, echo)
+	conn, err := wsclient.Dial(wsclient.Config{URL: url})
+	c.Assert(err, jc.ErrorIsNil)
+	defer conn.Close()
+	for i := 0; i < 3; i++ {
+		c.Assert(conn.Send(message{i * 10}), jc.ErrorIsNil)
+		var m message
+		c.Assert(conn.Receive(&m), jc.ErrorIsNil)
+		c.Assert(m.N, gc.Equals, i*10+1)
+	}
+}
+
+func (s *connSuite) TestDialErrors(c *gc.C) {
+	_, err := wsclient.Dial(wsclient.Config{URL: "http://example.com"})
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+	_, err = wsclient.Dial(wsclient.Config{URL: "ws://example.com", PingInterval: -1})
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+}
+
+func (s *connSuite) TestHeaderAndOrigin(c *gc.C) {
+	type request struct {
+		origin, token string
+	}
+	requests := make(chan request, 2)
+	url := newServer(&s.IsolationSuite, func(ws *websocket.Conn) {
+		req := ws.Request()
+		requests <- request{req.Header.Get("Origin"), req.Header.Get("X-Token")}
+	})
+	conn, err := wsclient.Dial(wsclient.Config{
+		URL:    url,
+		Header: http.Header{"X-Token": {"secret"}},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	conn.Close()
+	c.Assert(<-requests, gc.Equals, request{"http" + strings.TrimPrefix(url, "ws"), "secret"})
+
+	conn, err = wsclient.Dial(wsclient.Config{
+		URL:    url,
+		Origin: "http://example.com",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	conn.Close()
+	c.Assert(<-requests, gc.Equals, request{"http://example.com", ""})
+}
+
+func (s *connSuite) TestCloseHandshake(c *gc.C) {
+	gotClose := make(chan error, 1)
+	url := newServer(&s.IsolationSuite, func(ws *websocket.Conn) {
+		var m message
+		gotClose <- websocket.JSON.Receive(ws, &m)
+	})
+	conn, err := wsclient.Dial(wsclient.Config{URL: url})
+	c.Assert(err, jc.ErrorIsNil)
+
+	start := time.Now()
+	c.Assert(conn.Close(), jc.ErrorIsNil)
+	// The server acknowledged the close rather than
+	// the close timing out.
+	c.Assert(time.Since(start) < 5*time.Second, jc.IsTrue)
+	select {
+	case err := <-gotClose:
+		c.Assert(err, gc.Equals, io.EOF)
+	case <-time.After(testing.LongWait):
+		c.Fatalf("server did not see close")
+	}
+	c.Assert(conn.Close(), jc.ErrorIsNil)
+}
+
+func (s *connSuite) TestServerClose(c *gc.C) {
+	url := newServer(&s.IsolationSuite, func(ws *websocket.Conn) {
+		websocket.JSON.Send(ws, message{1})
+	})
+	conn, err := wsclient.Dial(wsclient.Config{URL: url})
+	c.Assert(err, jc.ErrorIsNil)
+	var m message
+	c.Assert(conn.Receive(&m), jc.ErrorIsNil)
+	c.Assert(m.N, gc.Equals, 1)
+	c.Assert(conn.Receive(&m), gc.Equals, io.EOF)
+	c.Assert(conn.Close(), jc.ErrorIsNil)
+}
+
+func (s *connSuite) TestKeepalive(c *gc.C) {
+	url := newServer(&s.IsolationSuite, echo)
+	conn, err := wsclient.Dial(wsclient.Config{
+		URL:          url,
+		PingInterval: 10 * time.Millisecond,
+		PongTimeout:  testing.LongWait,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	defer conn.Close()
+	// The server answers pings while waiting for a message,
+	// so the connection stays open while idle.
+	time.Sleep(100 * time.Millisecond)
+	c.Assert(conn.Send(message{1}), jc.ErrorIsNil)
+	var m message
+	c.Assert(conn.Receive(&m), jc.ErrorIsNil)
+	c.Assert(m.N, gc.Equals, 2)
+}
+
+func (s *connSuite) TestKeepaliveDeadServer(c *gc.C) {
+	release := make(chan struct{})
+	defer close(release)
+	url := newServer(&s.IsolationSuite, func(ws *websocket.Conn) {
+		// Never read, so pings are not answered.
+		<-release
+	})
+	conn, err := wsclient.Dial(wsclient.Config{
+		URL:          url,
+		PingInterval: 10 * time.Millisecond,
+		PongTimeout:  10 * time.Millisecond,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	defer conn.Close()
+	received := make(chan error, 1)
+	go func() {
+		var m message
+		received <- conn.Receive(&m)
+	}()
+	select {
+	case err := <-received:
+		c.Assert(err, gc.NotNil)
+	case <-time.After(testing.LongWait):
+		c.Fatalf("dead connection not detected")
+	}
+}
@@ -4,9 +4,12 @@
 package utils
 
 import (
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 
 	"github.com/juju/errors"
 
@@ -111,3 +114,158 @@ func ConformYAML(input interface{}) (interface{}, error) {
 		return input, nil
 	}
 }
+
+// YAMLToJSON returns a copy of input, as decoded from YAML, in which
+// every nested map[interface{}]interface{} and yaml.MapSlice is
+// replaced by a map[string]interface{}, so that the result can be
+// marshaled as JSON. Unlike ConformYAML, the error returned for a
+// non-string key reports where the key was found, and input holding
+// a reference to itself is rejected rather than recursing forever.
+func YAMLToJSON(input interface{}) (interface{}, error) {
+	c := converter{
+		mapValue: func(m map[string]interface{}) interface{} { return m },
+	}
+	return c.convert(input, "")
+}
+
+// JSONToYAML returns a copy of input, as decoded from JSON, in which
+// every nested map[string]interface{} is replaced by the
+// map[interface{}]interface{} that YAML decoding produces, and every
+// json.Number is replaced by an int64 or float64, so that the result
+// can be compared or merged with values decoded from YAML.
+func JSONToYAML(input interface{}) (interface{}, error) {
+	c := converter{
+		mapValue: func(m map[string]interface{}) interface{} {
+			out := make(map[interface{}]interface{}, len(m))
+			for k, v := range m {
+				out[k] = v
+			}
+			return out
+		},
+	}
+	return c.convert(input, "")
+}
+
+// converter holds the state of a YAMLToJSON or JSONToYAML conversion.
+type converter struct {
+	// mapValue returns the final form of a converted map.
+	mapValue func(map[string]interface{}) interface{}
+
+	// parents holds the maps and slices enclosing the value
+	// currently being converted.
+	parents []uintptr
+}
+
+func (c *converter) convert(input interface{}, path string) (interface{}, error) {
+	switch input := input.(type) {
+	case map[string]interface{}:
+		return c.convertMap(input, path, len(input), func(f func(key, value interface{}) error) error {
+			for k, v := range input {
+				if err := f(k, v); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	case map[interface{}]interface{}:
+		return c.convertMap(input, path, len(input), func(f func(key, value interface{}) error) error {
+			for k, v := range input {
+				if err := f(k, v); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	case yaml.MapSlice:
+		return c.convertMap(input, path, len(input), func(f func(key, value interface{}) error) error {
+			for _, item := range input {
+				if err := f(item.Key, item.Value); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	case []interface{}:
+		if err := c.push(input, path); err != nil {
+			return nil, err
+		}
+		defer c.pop()
+		out := make([]interface{}, len(input))
+		for i, v := range input {
+			newValue, err := c.convert(v, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			out[i] = newValue
+		}
+		return out, nil
+	case json.Number:
+		if i, err := input.Int64(); err == nil {
+			return i, nil
+		}
+		f, err := input.Float64()
+		if err != nil {
+			return nil, errors.Errorf("invalid number %q at %s", input, pathString(path))
+		}
+		return f, nil
+	}
+	return input, nil
+}
+
+// convertMap converts the map m, which has n entries that
+// are passed in turn to the function given to each.
+func (c *converter) convertMap(m interface{}, path string, n int, each func(func(key, value interface{}) error) error) (interface{}, error) {
+	if err := c.push(m, path); err != nil {
+		return nil, err
+	}
+	defer c.pop()
+	out := make(map[string]interface{}, n)
+	err := each(func(key, value interface{}) error {
+		k, ok := key.(string)
+		if !ok {
+			return errors.Errorf("map key %#v (%T) at %s is not a string", key, key, pathString(path))
+		}
+		newValue, err := c.convert(value, joinPath(path, k))
+		if err != nil {
+			return err
+		}
+		out[k] = newValue
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.mapValue(out), nil
+}
+
+// push records that the map or slice v, found at path, encloses the
+// values about to be converted, returning an error if it already
+// encloses v itself.
+func (c *converter) push(v interface{}, path string) error {
+	rv := reflect.ValueOf(v)
+	if rv.Len() == 0 {
+		// Empty values cannot hold themselves, and
+		// empty slices may share a pointer.
+		c.parents = append(c.parents, 0)
+		return nil
+	}
+	p := rv.Pointer()
+	for _, parent := range c.parents {
+		if parent == p {
+			return errors.Errorf("cycle detected at %s", pathString(path))
+		}
+	}
+	c.parents = append(c.parents, p)
+	return nil
+}
+
+func (c *converter) pop() {
+	c.parents = c.parents[:len(c.parents)-1]
+}
+
+func pathString(path string) string {
+	if path == "" {
+		return "top level"
+	}
+	return fmt.Sprintf("%q", path)
+}
@@ -4,12 +4,15 @@
 package utils
 
 import (
+	"encoding/json"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 
 	jc "github.com/juju/testing/checkers"
 	gc "gopkg.in/check.v1"
+	"gopkg.in/yaml.v2"
 )
 
 type yamlSuite struct {
@@ -189,3 +192,110 @@ func (s *ConformSuite) TestConformYAML(c *gc.C) {
 		}
 	}
 }
+
+func (s *ConformSuite) TestYAMLToJSON(c *gc.C) {
+	var input interface{}
+	err := yaml.Unmarshal([]byte(`
+name: app
+options:
+  debug: true
+  ports: [80, 443]
+  limits:
+    - cpu: 2
+      memory: {soft: 1G}
+`), &input)
+	c.Assert(err, jc.ErrorIsNil)
+
+	output, err := YAMLToJSON(input)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(output, jc.DeepEquals, map[string]interface{}{
+		"name": "app",
+		"options": map[string]interface{}{
+			"debug": true,
+			"ports": []interface{}{80, 443},
+			"limits": []interface{}{
+				map[string]interface{}{
+					"cpu":    2,
+					"memory": map[string]interface{}{"soft": "1G"},
+				},
+			},
+		},
+	})
+	_, err = json.Marshal(output)
+	c.Check(err, jc.ErrorIsNil)
+}
+
+func (s *ConformSuite) TestYAMLToJSONMapSlice(c *gc.C) {
+	var input yaml.MapSlice
+	err := yaml.Unmarshal([]byte("b: 1\na: {c: [x]}\n"), &input)
+	c.Assert(err, jc.ErrorIsNil)
+
+	output, err := YAMLToJSON(input)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(output, jc.DeepEquals, map[string]interface{}{
+		"b": 1,
+		"a": map[string]interface{}{"c": []interface{}{"x"}},
+	})
+}
+
+func (s *ConformSuite) TestYAMLToJSONNonStringKey(c *gc.C) {
+	var input interface{}
+	err := yaml.Unmarshal([]byte("a:\n  - b:\n      1: x\n"), &input)
+	c.Assert(err, jc.ErrorIsNil)
+
+	_, err = YAMLToJSON(input)
+	c.Check(err, gc.ErrorMatches, `map key 1 \(int\) at "a\[0\].b" is not a string`)
+
+	_, err = YAMLToJSON(map[interface{}]interface{}{true: 1})
+	c.Check(err, gc.ErrorMatches, `map key true \(bool\) at top level is not a string`)
+}
+
+func (s *ConformSuite) TestYAMLToJSONCycle(c *gc.C) {
+	m := map[interface{}]interface{}{"a": "b"}
+	m["self"] = []interface{}{m}
+	_, err := YAMLToJSON(m)
+	c.Check(err, gc.ErrorMatches, `cycle detected at "self\[0\]"`)
+
+	l := []interface{}{1, nil}
+	l[1] = l
+	_, err = YAMLToJSON(l)
+	c.Check(err, gc.ErrorMatches, `cycle detected at "\[1\]"`)
+}
+
+func (s *ConformSuite) TestYAMLToJSONSharedValues(c *gc.C) {
+	// Values referenced more than once, as YAML aliases are,
+	// are not cycles.
+	shared := map[interface{}]interface{}{"x": 1}
+	output, err := YAMLToJSON([]interface{}{shared, shared, []interface{}{}, []interface{}{}})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(output, jc.DeepEquals, []interface{}{
+		map[string]interface{}{"x": 1},
+		map[string]interface{}{"x": 1},
+		[]interface{}{},
+		[]interface{}{},
+	})
+}
+
+func (s *ConformSuite) TestJSONToYAML(c *gc.C) {
+	dec := json.NewDecoder(strings.NewReader(`{"a": {"b": [1, 2.5, {"c": null}]}, "d": "e"}`))
+	dec.UseNumber()
+	var input interface{}
+	err := dec.Decode(&input)
+	c.Assert(err, jc.ErrorIsNil)
+
+	output, err := JSONToYAML(input)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(output, jc.DeepEquals, map[interface{}]interface{}{
+		"a": map[interface{}]interface{}{
+			"b": []interface{}{int64(1), 2.5, map[interface{}]interface{}{"c": nil}},
+		},
+		"d": "e",
+	})
+
+	// Converting back gives JSON-compatible values again.
+	back, err := YAMLToJSON(output)
+	c.Assert(err, jc.ErrorIsNil)
+	data, err := json.Marshal(back)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(data), gc.Equals, `{"a":{"b":[1,2.5,{"c":null}]},"d":"e"}`)
+}
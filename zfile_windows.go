@@ -12,7 +12,8 @@ import "syscall"
 var (
 	modkernel32 = syscall.NewLazyDLL("kernel32.dll")
 
-	procMoveFileExW = modkernel32.NewProc("MoveFileExW")
+	procMoveFileExW  = modkernel32.NewProc("MoveFileExW")
+	procReplaceFileW = modkernel32.NewProc("ReplaceFileW")
 )
 
 func moveFileEx(lpExistingFileName *uint16, lpNewFileName *uint16, dwFlags uint32) (err error) {
@@ -26,3 +27,15 @@ func moveFileEx(lpExistingFileName *uint16, lpNewFileName *uint16, dwFlags uint3
 	}
 	return
 }
+
+func replaceFileW(lpReplacedFileName *uint16, lpReplacementFileName *uint16, lpBackupFileName *uint16, dwReplaceFlags uint32, lpExclude uintptr, lpReserved uintptr) (err error) {
+	r1, _, e1 := syscall.Syscall6(procReplaceFileW.Addr(), 6, uintptr(unsafe.Pointer(lpReplacedFileName)), uintptr(unsafe.Pointer(lpReplacementFileName)), uintptr(unsafe.Pointer(lpBackupFileName)), uintptr(dwReplaceFlags), uintptr(lpExclude), uintptr(lpReserved))
+	if r1 == 0 {
+		if e1 != 0 {
+			err = error(e1)
+		} else {
+			err = syscall.EINVAL
+		}
+	}
+	return
+}
@@ -0,0 +1,182 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package zip
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// EntryType describes the kind of an archive entry.
+type EntryType string
+
+// The types of entry reported by List.
+const (
+	TypeFile    EntryType = "file"
+	TypeDir     EntryType = "directory"
+	TypeSymlink EntryType = "symlink"
+	TypeOther   EntryType = "other"
+)
+
+// Entry describes an entry in a zip archive.
+type Entry struct {
+	// Path holds the cleaned, slash separated path of the entry.
+	Path string
+
+	// Type holds the kind of entry.
+	Type EntryType
+
+	// Size holds the uncompressed size of the entry in bytes.
+	Size int64
+
+	// Mode holds the permission and type bits of the entry.
+	Mode os.FileMode
+
+	// Linkname holds the target of a symlink.
+	Linkname string
+
+	// ModTime holds the modification time of the entry.
+	ModTime time.Time
+}
+
+// List returns the entries in the supplied zip reader without
+// extracting them. Only the targets of symlinks are read.
+func List(reader *zip.Reader) ([]Entry, error) {
+	entries := make([]Entry, 0, len(reader.File))
+	for _, zipFile := range reader.File {
+		mode := zipFile.Mode()
+		entry := Entry{
+			Path:    path.Clean(zipFile.Name),
+			Size:    int64(zipFile.UncompressedSize64),
+			Mode:    mode,
+			ModTime: zipFile.Modified,
+		}
+		switch mode & os.ModeType {
+		case 0:
+			entry.Type = TypeFile
+		case os.ModeDir:
+			entry.Type = TypeDir
+		case os.ModeSymlink:
+			entry.Type = TypeSymlink
+			var buffer bytes.Buffer
+			if err := copyTo(&buffer, zipFile); err != nil {
+				return nil, fmt.Errorf("cannot read symlink %q: %v", entry.Path, err)
+			}
+			entry.Linkname = buffer.String()
+		default:
+			entry.Type = TypeOther
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// ExtractOptions selects the entries extracted by ExtractSelected.
+type ExtractOptions struct {
+	// Patterns, if not empty, restricts extraction to entries whose
+	// paths match at least one of the patterns, as interpreted by
+	// path.Match. An entry is also extracted if a pattern matches
+	// any of its parent directories, so "etc/*" extracts everything
+	// beneath etc.
+	Patterns []string
+
+	// Prefix, if not empty, restricts extraction to the entry with
+	// that path and everything beneath it.
+	Prefix string
+
+	// StripComponents removes that many leading path elements from
+	// each entry before extraction, as tar's --strip-components does.
+	// Entries with no elements left are skipped.
+	StripComponents int
+}
+
+// ExtractSelected extracts the entries of the supplied zip reader
+// selected by options into the target path, overwriting existing
+// files and directories only where necessary. It returns an error
+// satisfying errors.IsNotFound if Patterns or Prefix were given but
+// no entries were extracted.
+func ExtractSelected(reader *zip.Reader, targetRoot string, options ExtractOptions) error {
+	for _, pattern := range options.Patterns {
+		if _, err := path.Match(pattern, "check"); err != nil {
+			return errors.Annotatef(err, "invalid pattern %q", pattern)
+		}
+	}
+	extracted := 0
+	extractor := extractor{
+		targetRoot: targetRoot,
+		selected: func(cleanPath string) (string, bool, error) {
+			relPath, ok, err := options.target(cleanPath)
+			if ok {
+				extracted++
+			}
+			return relPath, ok, err
+		},
+	}
+	for _, zipFile := range reader.File {
+		if err := extractor.extract(zipFile); err != nil {
+			cleanName := path.Clean(zipFile.Name)
+			return fmt.Errorf("cannot extract %q: %v", cleanName, err)
+		}
+	}
+	if extracted == 0 && (len(options.Patterns) > 0 || options.Prefix != "") {
+		return errors.NotFoundf("entries matching %s", options.describe())
+	}
+	return nil
+}
+
+// target returns the path to which the entry with the given cleaned
+// path is extracted, and whether it is selected.
+func (o ExtractOptions) target(p string) (string, bool, error) {
+	p = strings.TrimLeft(p, "/")
+	if p == "." || p == "" || !o.selects(p) {
+		return "", false, nil
+	}
+	if !isSanePath(p) {
+		return "", false, fmt.Errorf("path leads out of scope")
+	}
+	parts := strings.Split(p, "/")
+	if len(parts) <= o.StripComponents {
+		return "", false, nil
+	}
+	return path.Join(parts[o.StripComponents:]...), true, nil
+}
+
+// selects reports whether the entry with the cleaned path p
+// is selected by the options.
+func (o ExtractOptions) selects(p string) bool {
+	if prefix := path.Clean(strings.TrimLeft(o.Prefix, "/")); prefix != "." {
+		if p != prefix && !strings.HasPrefix(p, prefix+"/") {
+			return false
+		}
+	}
+	if len(o.Patterns) == 0 {
+		return true
+	}
+	for dir := p; dir != "." && dir != "/"; dir = path.Dir(dir) {
+		for _, pattern := range o.Patterns {
+			if ok, _ := path.Match(pattern, dir); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (o ExtractOptions) describe() string {
+	var parts []string
+	if o.Prefix != "" {
+		parts = append(parts, fmt.Sprintf("prefix %q", o.Prefix))
+	}
+	if len(o.Patterns) > 0 {
+		parts = append(parts, fmt.Sprintf("patterns %q", o.Patterns))
+	}
+	return strings.Join(parts, " and ")
+}
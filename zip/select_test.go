@@ -0,0 +1,130 @@
+// Copyright 2022 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package zip_test
+
+import (
+	stdzip "archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	ft "github.com/juju/testing/filetesting"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/v3/zip"
+)
+
+func (s *ZipSuite) makeBackupZip(c *gc.C) *stdzip.Reader {
+	return s.makeZip(c,
+		ft.Dir{Path: "backup", Perm: 0755},
+		ft.Dir{Path: "backup/etc", Perm: 0755},
+		ft.File{Path: "backup/etc/agent.conf", Data: "agent", Perm: 0600},
+		ft.Symlink{Path: "backup/etc/current", Link: "agent.conf"},
+		ft.Dir{Path: "backup/etc/juju", Perm: 0755},
+		ft.File{Path: "backup/etc/juju/db.yaml", Data: "db: true", Perm: 0644},
+		ft.Dir{Path: "backup/var", Perm: 0755},
+		ft.File{Path: "backup/var/machine.log", Data: "log data", Perm: 0640},
+	)
+}
+
+func (s *ZipSuite) TestList(c *gc.C) {
+	entries, err := zip.List(s.makeBackupZip(c))
+	c.Assert(err, jc.ErrorIsNil)
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+	type entry struct {
+		path     string
+		typ      zip.EntryType
+		size     int64
+		mode     os.FileMode
+		linkname string
+	}
+	var got []entry
+	for _, e := range entries {
+		c.Check(e.ModTime.IsZero(), jc.IsFalse)
+		got = append(got, entry{e.Path, e.Type, e.Size, e.Mode, e.Linkname})
+	}
+	c.Check(got, jc.DeepEquals, []entry{
+		{"backup", zip.TypeDir, 0, os.ModeDir | 0755, ""},
+		{"backup/etc", zip.TypeDir, 0, os.ModeDir | 0755, ""},
+		{"backup/etc/agent.conf", zip.TypeFile, 5, 0600, ""},
+		{"backup/etc/current", zip.TypeSymlink, 10, os.ModeSymlink | 0777, "agent.conf"},
+		{"backup/etc/juju", zip.TypeDir, 0, os.ModeDir | 0755, ""},
+		{"backup/etc/juju/db.yaml", zip.TypeFile, 8, 0644, ""},
+		{"backup/var", zip.TypeDir, 0, os.ModeDir | 0755, ""},
+		{"backup/var/machine.log", zip.TypeFile, 8, 0640, ""},
+	})
+}
+
+func (s *ZipSuite) TestExtractSelectedPattern(c *gc.C) {
+	reader := s.makeBackupZip(c)
+	targetPath := c.MkDir()
+	err := zip.ExtractSelected(reader, targetPath, zip.ExtractOptions{
+		Patterns:        []string{"*/etc/agent.conf", "*/*/juju"},
+		StripComponents: 2,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	for _, entry := range []ft.Entry{
+		ft.File{Path: "agent.conf", Data: "agent", Perm: 0600},
+		ft.Dir{Path: "juju", Perm: 0755},
+		ft.File{Path: "juju/db.yaml", Data: "db: true", Perm: 0644},
+		ft.Removed{Path: "current"},
+		ft.Removed{Path: "backup"},
+		ft.Removed{Path: "machine.log"},
+	} {
+		entry.Check(c, targetPath)
+	}
+}
+
+func (s *ZipSuite) TestExtractSelectedPrefix(c *gc.C) {
+	reader := s.makeBackupZip(c)
+	targetPath := c.MkDir()
+	err := zip.ExtractSelected(reader, targetPath, zip.ExtractOptions{
+		Prefix:          "backup/etc/",
+		StripComponents: 1,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	for _, entry := range []ft.Entry{
+		ft.Dir{Path: "etc", Perm: 0755},
+		ft.File{Path: "etc/agent.conf", Data: "agent", Perm: 0600},
+		ft.Symlink{Path: "etc/current", Link: "agent.conf"},
+		ft.File{Path: "etc/juju/db.yaml", Data: "db: true", Perm: 0644},
+		ft.Removed{Path: "var"},
+	} {
+		entry.Check(c, targetPath)
+	}
+}
+
+func (s *ZipSuite) TestExtractSelectedNoMatch(c *gc.C) {
+	reader := s.makeBackupZip(c)
+	err := zip.ExtractSelected(reader, c.MkDir(), zip.ExtractOptions{Patterns: []string{"*.json"}})
+	c.Check(err, gc.ErrorMatches, `entries matching patterns \["\*.json"\] not found`)
+	c.Check(err, jc.Satisfies, errors.IsNotFound)
+}
+
+func (s *ZipSuite) TestExtractSelectedInvalidPattern(c *gc.C) {
+	reader := s.makeBackupZip(c)
+	err := zip.ExtractSelected(reader, c.MkDir(), zip.ExtractOptions{Patterns: []string{"["}})
+	c.Check(err, gc.ErrorMatches, `invalid pattern "\[": syntax error in pattern`)
+}
+
+func (s *ZipSuite) TestExtractSelectedOutOfScope(c *gc.C) {
+	var buf bytes.Buffer
+	zw := stdzip.NewWriter(&buf)
+	_, err := zw.Create("a/../../evil")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(zw.Close(), jc.ErrorIsNil)
+	reader, err := stdzip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	c.Assert(err, jc.ErrorIsNil)
+
+	targetPath := c.MkDir()
+	err = zip.ExtractSelected(reader, filepath.Join(targetPath, "out"), zip.ExtractOptions{})
+	c.Check(err, gc.ErrorMatches, `cannot extract "../evil": path leads out of scope`)
+	_, err = os.Stat(filepath.Join(targetPath, "evil"))
+	c.Check(os.IsNotExist(err), jc.IsTrue)
+}
@@ -56,7 +56,7 @@ func Extract(reader *zip.Reader, targetRoot, sourceRoot string) error {
 	if !isSanePath(sourceRoot) {
 		return fmt.Errorf("cannot extract files rooted at %q", sourceRoot)
 	}
-	extractor := extractor{targetRoot, sourceRoot}
+	extractor := extractor{targetRoot: targetRoot, sourceRoot: sourceRoot}
 	for _, zipFile := range reader.File {
 		if err := extractor.extract(zipFile); err != nil {
 			cleanName := path.Clean(zipFile.Name)
@@ -69,29 +69,42 @@ func Extract(reader *zip.Reader, targetRoot, sourceRoot string) error {
 type extractor struct {
 	targetRoot string
 	sourceRoot string
+
+	// selected, if not nil, is used instead of sourceRoot to choose
+	// the files extracted. It is passed the cleaned path of a file
+	// and returns its path relative to targetRoot, and whether it
+	// should be extracted.
+	selected func(cleanPath string) (string, bool, error)
 }
 
 // targetPath returns the target path for a given zip file and whether
 // it should be extracted.
-func (x extractor) targetPath(zipFile *zip.File) (string, bool) {
+func (x extractor) targetPath(zipFile *zip.File) (string, bool, error) {
 	cleanPath := path.Clean(zipFile.Name)
+	if x.selected != nil {
+		relPath, ok, err := x.selected(cleanPath)
+		if !ok || err != nil {
+			return "", false, err
+		}
+		return filepath.Join(x.targetRoot, filepath.FromSlash(relPath)), true, nil
+	}
 	if cleanPath == x.sourceRoot {
-		return x.targetRoot, true
+		return x.targetRoot, true, nil
 	}
 	if x.sourceRoot != "" {
 		mustPrefix := x.sourceRoot + "/"
 		if !strings.HasPrefix(cleanPath, mustPrefix) {
-			return "", false
+			return "", false, nil
 		}
 		cleanPath = cleanPath[len(mustPrefix):]
 	}
-	return filepath.Join(x.targetRoot, filepath.FromSlash(cleanPath)), true
+	return filepath.Join(x.targetRoot, filepath.FromSlash(cleanPath)), true, nil
 }
 
 func (x extractor) extract(zipFile *zip.File) error {
-	targetPath, ok := x.targetPath(zipFile)
-	if !ok {
-		return nil
+	targetPath, ok, err := x.targetPath(zipFile)
+	if !ok || err != nil {
+		return err
 	}
 	parentPath := filepath.Dir(targetPath)
 	if err := os.MkdirAll(parentPath, 0777); err != nil {